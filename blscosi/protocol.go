@@ -0,0 +1,282 @@
+// Package blscosi is a collective signing protocol using BLS signatures.
+//
+// The root sends the message down the tree, every node verifies it and signs
+// it with its BLS key, and the signatures are aggregated on the way back up.
+// Unlike the Schnorr signatures of ftcosi, the final signature has a
+// constant size and only needs one round-trip. It is followed by a bitmap of
+// the nodes that signed, so a verifier only needs to add up the public keys
+// of the signers.
+package blscosi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/pairing/bn256"
+	"github.com/dedis/kyber/sign/bls"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// Suite is the pairing suite used for the BLS signatures.
+var Suite = bn256.NewSuite()
+
+// VerificationFn is called on every node. Where msg is the message that is
+// co-signed and the data is additional data for verification. A node refuses
+// to sign if it returns an error.
+type VerificationFn func(msg []byte, data []byte) error
+
+func init() {
+	network.RegisterMessages(Announcement{}, Response{})
+}
+
+// BlsCosi holds the parameters of the protocol. The final signature is only
+// sent to the FinalSignature channel of the root.
+type BlsCosi struct {
+	*onet.TreeNodeInstance
+
+	Msg  []byte
+	Data []byte
+	// Timeout is how long the root waits for the responses of its children.
+	// Every level of the tree gets half of the timeout of its parent.
+	Timeout time.Duration
+	// Threshold is the number of nodes that need to sign. If fewer nodes
+	// sign, the root sends nil as the final signature.
+	Threshold      int
+	FinalSignature chan []byte
+
+	keys                KeyStore
+	verificationFn      VerificationFn
+	startChan           chan bool
+	stoppedOnce         sync.Once
+	ChannelAnnouncement chan StructAnnouncement
+	ChannelResponse     chan StructResponse
+}
+
+// NewBlsCosi creates the protocol instance. The BLS keys of the nodes are
+// taken from keys.
+func NewBlsCosi(n *onet.TreeNodeInstance, vf VerificationFn, keys KeyStore) (onet.ProtocolInstance, error) {
+	c := &BlsCosi{
+		TreeNodeInstance: n,
+		FinalSignature:   make(chan []byte, 1),
+		Data:             make([]byte, 0),
+		startChan:        make(chan bool, 1),
+		verificationFn:   vf,
+		keys:             keys,
+	}
+	err := n.RegisterChannels(&c.ChannelAnnouncement, &c.ChannelResponse)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Start is done only by root and starts the protocol.
+// It also verifies that the protocol has been correctly parameterized.
+func (p *BlsCosi) Start() error {
+	if p.Msg == nil {
+		p.Shutdown()
+		return errors.New("no proposal msg specified")
+	}
+	if p.verificationFn == nil {
+		p.Shutdown()
+		return errors.New("verification function cannot be nil")
+	}
+	if p.keys == nil {
+		p.Shutdown()
+		return errors.New("no BLS keys given")
+	}
+	if p.Timeout < 10*time.Nanosecond {
+		p.Shutdown()
+		return errors.New("unrealistic timeout")
+	}
+	if p.Threshold < 1 || p.Threshold > p.Tree().Size() {
+		p.Shutdown()
+		return fmt.Errorf("threshold (%d) must be between 1 and the number of nodes (%d)",
+			p.Threshold, p.Tree().Size())
+	}
+	p.startChan <- true
+	return nil
+}
+
+// Shutdown stops the protocol
+func (p *BlsCosi) Shutdown() error {
+	p.stoppedOnce.Do(func() {
+		close(p.startChan)
+		close(p.FinalSignature)
+	})
+	return nil
+}
+
+// Dispatch forwards the announcement to the children, signs the message if
+// it is valid and sends the signatures of its subtree to the parent, or to
+// FinalSignature on the root.
+func (p *BlsCosi) Dispatch() error {
+	defer p.Done()
+
+	var ann Announcement
+	if p.IsRoot() {
+		select {
+		case _, ok := <-p.startChan:
+			if !ok {
+				return errors.New("protocol finished prematurely")
+			}
+		case <-time.After(time.Second):
+			return errors.New("timeout, did you forget to call Start?")
+		}
+		ann = Announcement{Msg: p.Msg, Data: p.Data, Timeout: p.Timeout}
+	} else {
+		a := <-p.ChannelAnnouncement
+		ann = a.Announcement
+	}
+
+	sig, m, err := p.collectSignatures(ann)
+	if err != nil {
+		if p.IsRoot() {
+			p.FinalSignature <- nil
+		}
+		return err
+	}
+
+	if !p.IsRoot() {
+		return p.SendToParent(&Response{Signature: sig, Mask: m})
+	}
+	if n := m.count(); n < p.Threshold {
+		log.Lvlf2("%s: only %d nodes signed, but %d are needed", p.ServerIdentity(), n, p.Threshold)
+		p.FinalSignature <- nil
+		return nil
+	}
+	p.FinalSignature <- append(sig, m...)
+	return nil
+}
+
+// collectSignatures returns the aggregated signature of the subtree of this
+// node and the mask of the nodes that signed.
+func (p *BlsCosi) collectSignatures(ann Announcement) ([]byte, mask, error) {
+	publics, err := p.keys.Publics(p.Roster())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(publics) != len(p.Roster().List) {
+		return nil, nil, errors.New("need one BLS key per node")
+	}
+
+	if !p.IsLeaf() {
+		child := ann
+		child.Timeout = ann.Timeout / 2
+		if errs := p.SendToChildrenInParallel(&child); len(errs) > 0 {
+			log.Lvl2(p.ServerIdentity(), "failed to send announcement to all children:", errs)
+		}
+	}
+
+	verified := make(chan error, 1)
+	go func() {
+		verified <- p.verificationFn(ann.Msg, ann.Data)
+	}()
+
+	var sigs [][]byte
+	m := newMask(len(publics))
+	timeout := time.After(ann.Timeout)
+	missing := len(p.Children())
+	for missing > 0 {
+		select {
+		case r := <-p.ChannelResponse:
+			missing--
+			rm := mask(r.Mask)
+			if err := rm.check(len(publics)); err != nil {
+				log.Lvl2(p.ServerIdentity(), "invalid response from", r.ServerIdentity, err)
+				continue
+			}
+			if rm.count() == 0 {
+				continue
+			}
+			if rm.overlaps(m) {
+				log.Lvl2(p.ServerIdentity(), "response from", r.ServerIdentity, "overlaps other responses")
+				continue
+			}
+			if err := bls.Verify(Suite, rm.aggregate(publics), ann.Msg, r.Signature); err != nil {
+				log.Lvl2(p.ServerIdentity(), "invalid signature from", r.ServerIdentity, err)
+				continue
+			}
+			sigs = append(sigs, r.Signature)
+			m.merge(rm)
+		case <-timeout:
+			log.Lvlf2("%s: timeout while waiting for %d responses", p.ServerIdentity(), missing)
+			missing = 0
+		}
+	}
+
+	var verificationErr error
+	select {
+	case verificationErr = <-verified:
+	case <-time.After(ann.Timeout):
+		log.Error(p.ServerIdentity(), "timeout while waiting for the verification!")
+		verificationErr = errors.New("timeout while waiting for the verification")
+	}
+	if verificationErr == nil {
+		private, err := p.keys.Private(p.ServerIdentity())
+		if err != nil {
+			return nil, nil, err
+		}
+		sig, err := bls.Sign(Suite, private, ann.Msg)
+		if err != nil {
+			return nil, nil, err
+		}
+		sigs = append(sigs, sig)
+		m.set(p.TreeNode().RosterIndex)
+	} else if p.IsRoot() {
+		// root should not fail the verification otherwise it would not have started the protocol
+		return nil, nil, fmt.Errorf("verification failed on root node: %s", verificationErr)
+	} else {
+		log.Lvl2(p.ServerIdentity(), "refused to sign:", verificationErr)
+	}
+
+	if len(sigs) == 0 {
+		return nil, m, nil
+	}
+	sig, err := bls.AggregateSignatures(Suite, sigs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sig, m, nil
+}
+
+// Verify checks that sig, as returned by the protocol, is a signature of msg
+// by at least threshold of the nodes with the given BLS public keys.
+func Verify(publics []kyber.Point, msg, sig []byte, threshold int) error {
+	sigLen := Suite.G1().PointLen()
+	if len(sig) < sigLen {
+		return errors.New("signature too short")
+	}
+	m := mask(sig[sigLen:])
+	if err := m.check(len(publics)); err != nil {
+		return err
+	}
+	if n := m.count(); n < threshold {
+		return fmt.Errorf("only %d nodes signed, but %d are needed", n, threshold)
+	}
+	return bls.Verify(Suite, m.aggregate(publics), msg, sig[:sigLen])
+}
+
+// Signers returns the indexes in the roster of the nodes that signed.
+func Signers(n int, sig []byte) ([]int, error) {
+	sigLen := Suite.G1().PointLen()
+	if len(sig) < sigLen {
+		return nil, errors.New("signature too short")
+	}
+	m := mask(sig[sigLen:])
+	if err := m.check(n); err != nil {
+		return nil, err
+	}
+	var signers []int
+	for i := 0; i < n; i++ {
+		if m.isSet(i) {
+			signers = append(signers, i)
+		}
+	}
+	return signers, nil
+}
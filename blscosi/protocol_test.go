@@ -0,0 +1,160 @@
+package blscosi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+const testProtocolName = "testBlsCosi"
+const refuseProtocolName = "testBlsCosiRefuse"
+
+var testSuite = cothority.Suite
+var defaultTimeout = 5 * time.Second
+
+// keys is shared by all nodes of the tests, as they run in the same process.
+var keys = &MemKeyStore{}
+
+func init() {
+	onet.GlobalProtocolRegister(testProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		vf := func(a, b []byte) error { return nil }
+		return NewBlsCosi(n, vf, keys)
+	})
+	onet.GlobalProtocolRegister(refuseProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		// Only the root and the first node sign.
+		vf := func(a, b []byte) error {
+			if n.Index() > 1 {
+				return errors.New("refusing")
+			}
+			return nil
+		}
+		return NewBlsCosi(n, vf, keys)
+	})
+}
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+// setup returns a tree of n nodes and creates BLS keys for all of them.
+func setup(t *testing.T, n int) (*onet.LocalTest, []*onet.Server, *onet.Tree, []kyber.Point) {
+	local := onet.NewLocalTest(testSuite)
+	servers, roster, tree := local.GenTree(n, false)
+	keys = NewMemKeyStore(roster)
+	publics, err := keys.Publics(roster)
+	require.Nil(t, err)
+	return local, servers, tree, publics
+}
+
+func startProtocol(t *testing.T, local *onet.LocalTest, name string, tree *onet.Tree,
+	msg []byte, threshold int) *BlsCosi {
+	pi, err := local.CreateProtocol(name, tree)
+	require.Nil(t, err)
+	p := pi.(*BlsCosi)
+	p.Msg = msg
+	p.Timeout = defaultTimeout
+	p.Threshold = threshold
+	require.Nil(t, p.Start())
+	return p
+}
+
+func TestProtocol(t *testing.T) {
+	msg := []byte("hello world")
+	for _, n := range []int{1, 2, 5, 13} {
+		log.Lvl2("test with", n, "nodes")
+		local, _, tree, publics := setup(t, n)
+
+		p := startProtocol(t, local, testProtocolName, tree, msg, n)
+		sig := <-p.FinalSignature
+		require.NotNil(t, sig)
+		require.Nil(t, Verify(publics, msg, sig, n))
+
+		// the signature has a constant size plus the bitmap
+		require.Equal(t, Suite.G1().PointLen()+(n+7)/8, len(sig))
+		signers, err := Signers(n, sig)
+		require.Nil(t, err)
+		require.Equal(t, n, len(signers))
+
+		require.NotNil(t, Verify(publics, []byte("another message"), sig, n))
+		require.NotNil(t, Verify(publics, msg, sig, n+1))
+		local.CloseAll()
+	}
+}
+
+func TestProtocolUnresponsive(t *testing.T) {
+	msg := []byte("hello world")
+	n := 5
+	local, servers, tree, publics := setup(t, n)
+	defer local.CloseAll()
+
+	// pause a leaf of the binary tree
+	servers[n-1].Pause()
+	p := startProtocol(t, local, testProtocolName, tree, msg, n-1)
+	sig := <-p.FinalSignature
+	require.NotNil(t, sig)
+	require.Nil(t, Verify(publics, msg, sig, n-1))
+	require.NotNil(t, Verify(publics, msg, sig, n))
+	signers, err := Signers(n, sig)
+	require.Nil(t, err)
+	require.Equal(t, []int{0, 1, 2, 3}, signers)
+}
+
+func TestProtocolRefuse(t *testing.T) {
+	msg := []byte("hello world")
+	n := 5
+	local, _, tree, publics := setup(t, n)
+	defer local.CloseAll()
+
+	// not enough nodes sign
+	p := startProtocol(t, local, refuseProtocolName, tree, msg, 3)
+	require.Nil(t, <-p.FinalSignature)
+
+	// but it is enough for a lower threshold
+	p = startProtocol(t, local, refuseProtocolName, tree, msg, 2)
+	sig := <-p.FinalSignature
+	require.NotNil(t, sig)
+	require.Nil(t, Verify(publics, msg, sig, 2))
+}
+
+func TestProtocolErrors(t *testing.T) {
+	local, _, tree, _ := setup(t, 3)
+	defer local.CloseAll()
+
+	pi, err := local.CreateProtocol(testProtocolName, tree)
+	require.Nil(t, err)
+	p := pi.(*BlsCosi)
+	p.Timeout = defaultTimeout
+	p.Threshold = 3
+	require.NotNil(t, p.Start(), "missing message")
+
+	pi, err = local.CreateProtocol(testProtocolName, tree)
+	require.Nil(t, err)
+	p = pi.(*BlsCosi)
+	p.Msg = []byte("hello world")
+	p.Timeout = defaultTimeout
+	p.Threshold = 4
+	require.NotNil(t, p.Start(), "threshold too big")
+}
+
+func TestMask(t *testing.T) {
+	m := newMask(10)
+	require.Equal(t, 2, len(m))
+	m.set(0)
+	m.set(9)
+	require.Equal(t, 2, m.count())
+	require.Nil(t, m.check(10))
+	require.NotNil(t, m.check(9))
+
+	other := newMask(10)
+	other.set(3)
+	require.False(t, m.overlaps(other))
+	m.merge(other)
+	require.Equal(t, 3, m.count())
+	require.True(t, m.overlaps(other))
+}
@@ -0,0 +1,172 @@
+package blscosi
+
+/*
+Struct holds the messages that will be sent around in the protocol. You have
+to define each message twice: once the actual message, and a second time
+with the `*onet.TreeNode` embedded. The latter is used in the handler-function
+so that it can find out who sent the message.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/bls"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// Announcement is sent down the tree and asks the nodes to sign Msg.
+type Announcement struct {
+	Msg  []byte
+	Data []byte
+	// Timeout is how long the receiving node waits for the responses of its
+	// children.
+	Timeout time.Duration
+}
+
+// StructAnnouncement just contains Announcement and the data necessary to identify and
+// process the message in the onet framework.
+type StructAnnouncement struct {
+	*onet.TreeNode
+	Announcement
+}
+
+// Response holds the aggregated signature of a subtree together with the
+// mask of the nodes that signed.
+type Response struct {
+	Signature []byte
+	Mask      []byte
+}
+
+// StructResponse just contains Response and the data necessary to identify and
+// process the message in the onet framework.
+type StructResponse struct {
+	*onet.TreeNode
+	Response
+}
+
+// KeyStore gives the BLS keys used by the protocol. The BLS keys are not part
+// of the onet roster, so every service running the protocol has to know them.
+// As the signatures are aggregated without proof of knowledge, a KeyStore
+// must only return public keys whose owner proved possession of the private
+// key, else a node can cancel out the keys of others.
+type KeyStore interface {
+	// Private returns the BLS private key of the node.
+	Private(si *network.ServerIdentity) (kyber.Scalar, error)
+	// Publics returns the BLS public keys of the nodes of the roster, in
+	// the same order.
+	Publics(ro *onet.Roster) ([]kyber.Point, error)
+}
+
+// MemKeyStore keeps the BLS key pairs of all nodes in memory. It is meant for
+// tests and simulations, where all nodes run in the same process.
+type MemKeyStore struct {
+	privates map[network.ServerIdentityID]kyber.Scalar
+	publics  map[network.ServerIdentityID]kyber.Point
+}
+
+// NewMemKeyStore creates a new BLS key pair for every node of the roster.
+func NewMemKeyStore(ro *onet.Roster) *MemKeyStore {
+	ks := &MemKeyStore{
+		privates: make(map[network.ServerIdentityID]kyber.Scalar),
+		publics:  make(map[network.ServerIdentityID]kyber.Point),
+	}
+	for _, si := range ro.List {
+		private, public := bls.NewKeyPair(Suite, Suite.RandomStream())
+		ks.privates[si.ID] = private
+		ks.publics[si.ID] = public
+	}
+	return ks
+}
+
+// Private implements KeyStore.
+func (ks *MemKeyStore) Private(si *network.ServerIdentity) (kyber.Scalar, error) {
+	private, ok := ks.privates[si.ID]
+	if !ok {
+		return nil, errors.New("no BLS key for " + si.Address.String())
+	}
+	return private, nil
+}
+
+// Publics implements KeyStore.
+func (ks *MemKeyStore) Publics(ro *onet.Roster) ([]kyber.Point, error) {
+	publics := make([]kyber.Point, len(ro.List))
+	for i, si := range ro.List {
+		public, ok := ks.publics[si.ID]
+		if !ok {
+			return nil, fmt.Errorf("no BLS key for %s", si.Address)
+		}
+		publics[i] = public
+	}
+	return publics, nil
+}
+
+// mask is a bitmap of the nodes that signed, in the order of the roster.
+type mask []byte
+
+func newMask(n int) mask {
+	return make(mask, (n+7)/8)
+}
+
+func (m mask) set(i int) {
+	m[i/8] |= 1 << uint(i%8)
+}
+
+func (m mask) isSet(i int) bool {
+	return m[i/8]&(1<<uint(i%8)) != 0
+}
+
+// check returns an error if the mask has not the length needed for n nodes
+// or if bits are set after the n'th one.
+func (m mask) check(n int) error {
+	if len(m) != (n+7)/8 {
+		return errors.New("wrong mask length")
+	}
+	for i := n; i < len(m)*8; i++ {
+		if m.isSet(i) {
+			return errors.New("mask has bits set for unknown nodes")
+		}
+	}
+	return nil
+}
+
+// count returns the number of nodes that signed.
+func (m mask) count() int {
+	c := 0
+	for i := 0; i < len(m)*8; i++ {
+		if m.isSet(i) {
+			c++
+		}
+	}
+	return c
+}
+
+// overlaps returns true if a node is set in both masks.
+func (m mask) overlaps(other mask) bool {
+	for i := range m {
+		if m[i]&other[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (m mask) merge(other mask) {
+	for i := range m {
+		m[i] |= other[i]
+	}
+}
+
+// aggregate returns the sum of the public keys of the nodes that signed.
+func (m mask) aggregate(publics []kyber.Point) kyber.Point {
+	var signers []kyber.Point
+	for i, p := range publics {
+		if m.isSet(i) {
+			signers = append(signers, p)
+		}
+	}
+	return bls.AggregatePublicKeys(Suite, signers...)
+}
@@ -0,0 +1,148 @@
+package byzcoinx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/protobuf"
+)
+
+// A batch of proposals is signed in a single round by signing the root of a
+// Merkle tree over the proposals. The leaves and the inner nodes are hashed
+// with a different prefix, so that an inner node cannot be passed off as a
+// proposal. If a level has an odd number of nodes, the last one is moved up
+// unchanged.
+
+const (
+	leafPrefix  = 0
+	innerPrefix = 1
+)
+
+// Batch is sent as the Data of the collective signing protocols when a list
+// of proposals is signed, so that every node can verify each proposal.
+type Batch struct {
+	Proposals [][]byte
+	// Data is the Data given to ByzCoinX, it is not signed.
+	Data []byte
+}
+
+// InclusionProof shows that a proposal is part of a signed batch.
+type InclusionProof struct {
+	// Index is the position of the proposal in the batch.
+	Index int
+	// Count is the number of proposals in the batch.
+	Count int
+	// Path holds the hashes of the siblings from the leaf up to the root.
+	// Levels where the node has no sibling are skipped.
+	Path [][]byte
+}
+
+// MerkleRoot returns the root of the Merkle tree over the proposals, which is
+// the message signed for the batch.
+func MerkleRoot(proposals [][]byte) ([]byte, error) {
+	root, _, err := merkleTree(proposals)
+	return root, err
+}
+
+// merkleTree returns the root of the Merkle tree over the proposals and the
+// inclusion proof of every proposal.
+func merkleTree(proposals [][]byte) ([]byte, []InclusionProof, error) {
+	if len(proposals) == 0 {
+		return nil, nil, errors.New("no proposals in the batch")
+	}
+	proofs := make([]InclusionProof, len(proposals))
+	level := make([][]byte, len(proposals))
+	for i, p := range proposals {
+		level[i] = hashLeaf(p)
+		proofs[i] = InclusionProof{Index: i, Count: len(proposals)}
+	}
+	// positions holds the index of every proposal in the current level.
+	positions := make([]int, len(proposals))
+	for i := range positions {
+		positions[i] = i
+	}
+	for len(level) > 1 {
+		for i, pos := range positions {
+			if sibling := pos ^ 1; sibling < len(level) {
+				proofs[i].Path = append(proofs[i].Path, level[sibling])
+			}
+			positions[i] = pos / 2
+		}
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, hashInner(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+	}
+	return level[0], proofs, nil
+}
+
+// Verify returns an error if the proof doesn't show that the proposal is
+// part of the batch with the given Merkle root.
+func (p InclusionProof) Verify(root, proposal []byte) error {
+	if p.Count < 1 || p.Index < 0 || p.Index >= p.Count {
+		return fmt.Errorf("invalid index %d for a batch of %d proposals", p.Index, p.Count)
+	}
+	h := hashLeaf(proposal)
+	path := p.Path
+	for pos, n := p.Index, p.Count; n > 1; pos, n = pos/2, (n+1)/2 {
+		if pos^1 >= n {
+			continue
+		}
+		if len(path) == 0 {
+			return errors.New("inclusion path too short")
+		}
+		if pos%2 == 0 {
+			h = hashInner(h, path[0])
+		} else {
+			h = hashInner(path[0], h)
+		}
+		path = path[1:]
+	}
+	if len(path) > 0 {
+		return errors.New("inclusion path too long")
+	}
+	if !bytes.Equal(h, root) {
+		return errors.New("proposal is not part of the batch")
+	}
+	return nil
+}
+
+// DecodeBatch is meant for the verification functions of batches. It
+// returns the proposals and the data of the batch given to the verification
+// function and checks that msg is their Merkle root.
+func DecodeBatch(msg, data []byte) (*Batch, error) {
+	b := &Batch{}
+	if err := protobuf.Decode(data, b); err != nil {
+		return nil, fmt.Errorf("couldn't decode batch: %v", err)
+	}
+	root, err := MerkleRoot(b.Proposals)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(root, msg) {
+		return nil, errors.New("message is not the Merkle root of the proposals")
+	}
+	return b, nil
+}
+
+func hashLeaf(proposal []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(proposal)
+	return h.Sum(nil)
+}
+
+func hashInner(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{innerPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
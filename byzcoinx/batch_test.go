@@ -0,0 +1,54 @@
+package byzcoinx
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerkleTree(t *testing.T) {
+	_, err := MerkleRoot(nil)
+	require.NotNil(t, err)
+
+	for _, n := range []int{1, 2, 3, 5, 8, 13} {
+		var proposals [][]byte
+		for i := 0; i < n; i++ {
+			proposals = append(proposals, []byte(fmt.Sprintf("proposal %d", i)))
+		}
+		root, proofs, err := merkleTree(proposals)
+		require.Nil(t, err)
+		require.Equal(t, n, len(proofs))
+		for i, p := range proofs {
+			require.Nil(t, p.Verify(root, proposals[i]))
+			require.NotNil(t, p.Verify(root, []byte("another proposal")))
+			if n > 1 {
+				require.NotNil(t, p.Verify(root, proposals[(i+1)%n]))
+			}
+		}
+
+		// the root changes with the order of the proposals
+		if n > 1 {
+			proposals[0], proposals[1] = proposals[1], proposals[0]
+			other, err := MerkleRoot(proposals)
+			require.Nil(t, err)
+			require.NotEqual(t, root, other)
+		}
+	}
+}
+
+func TestInclusionProofErrors(t *testing.T) {
+	proposals := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	root, proofs, err := merkleTree(proposals)
+	require.Nil(t, err)
+
+	p := proofs[0]
+	p.Index = 3
+	require.NotNil(t, p.Verify(root, proposals[0]), "index out of range")
+	p = proofs[0]
+	p.Path = p.Path[:1]
+	require.NotNil(t, p.Verify(root, proposals[0]), "path too short")
+	p = proofs[2]
+	p.Path = append(p.Path, root)
+	require.NotNil(t, p.Verify(root, proposals[2]), "path too long")
+}
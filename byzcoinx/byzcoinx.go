@@ -6,15 +6,20 @@
 package byzcoinx
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math"
+	"sync"
 	"time"
 
+	"github.com/dedis/cothority/blscosi"
 	"github.com/dedis/cothority/ftcosi/protocol"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/sign/cosi"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
 )
 
 // ByzCoinX contains the state used in the execution of the BFTCoSi
@@ -27,6 +32,11 @@ type ByzCoinX struct {
 	Msg []byte
 	// Data is used for verification only, not signed
 	Data []byte
+	// Proposals can be given instead of Msg to sign a batch of proposals in
+	// one round. Msg is then set to their Merkle root and Data to the
+	// encoded Batch, which the verification functions can read with
+	// DecodeBatch. The inclusion proofs are returned by Proofs.
+	Proposals [][]byte
 	// FinalSignature is output of the protocol, for the caller to read
 	FinalSignatureChan chan FinalSignature
 	// CreateProtocol stores a function pointer used to create the ftcosi
@@ -37,6 +47,47 @@ type ByzCoinX struct {
 	Timeout time.Duration
 	// Threshold is the number of nodes to reach for a signature to be valid
 	Threshold int
+	// Policy is passed down to the ftcosi protocols, which don't produce a
+	// signature that doesn't fulfill it, and it is used to verify the
+	// signature of the prepare phase instead of the Threshold. It is not
+	// supported with BLS signatures.
+	Policy cosi.Policy
+	// PrepareTimeout and CommitTimeout are passed down to the ftcosi protocol
+	// of the prepare and the commit phase. If they are 0, each phase gets
+	// half of Timeout.
+	PrepareTimeout time.Duration
+	CommitTimeout  time.Duration
+	// SubleaderTimeout is passed down to the ftcosi protocols and is how long
+	// a sub-leader waits for its children. If it is 0, ftcosi uses a third
+	// of the timeout of the phase.
+	SubleaderTimeout time.Duration
+	// Topology sets how the nodes are arranged in the trees of the ftcosi
+	// protocols. With TopologyKAry, BranchingFactor is the maximum number of
+	// children of every node of the trees.
+	Topology        Topology
+	BranchingFactor int
+	// UnreliableNodes are passed down to the ftcosi protocols, which don't
+	// choose them as sub-leaders. The nodes skipped in the prepare phase are
+	// added to them for the commit phase.
+	UnreliableNodes []*network.ServerIdentity
+	// Deadline is how long the protocol may take from Start. If it is not
+	// done by then, a FinalSignature with only a PartialSignature is sent.
+	// If it is 0, the protocol waits for the phases to time out.
+	Deadline time.Duration
+	// Sequence is passed down to the ftcosi protocols. Nodes refuse to sign
+	// if they already got a higher sequence from this root.
+	Sequence uint64
+	// SequenceID is passed down to the ftcosi protocols with Sequence.
+	SequenceID []byte
+	// Round identifies what is signed, for example the hash of the block the
+	// message follows. If Round and Detector are set, and Msg is
+	// RoundMessage(Round, RoundData), the final signature is recorded in the
+	// Detector, and Evidence returns what it found.
+	Round     []byte
+	RoundData []byte
+	Detector  *EquivocationDetector
+	// deadline fires once the Deadline is over.
+	deadline <-chan time.Time
 	// prepCosiProtoName is the ftcosi protocol name for the prepare phase
 	prepCosiProtoName string
 	// commitCosiProtoName is the ftcosi protocol name for the commit phase
@@ -51,14 +102,67 @@ type ByzCoinX struct {
 	suite cosi.Suite
 	// nSubtrees is the number of subtrees used for the ftcosi protocols.
 	nSubtrees int
+	// blsKeys is only set if the phases use blscosi instead of ftcosi.
+	blsKeys blscosi.KeyStore
+	// cosiProtos are the ftcosi protocols started for the phases.
+	cosiProtos      []*protocol.FtCosi
+	cosiProtosMutex sync.Mutex
+	// proofs are the inclusion proofs of the Proposals.
+	proofs []InclusionProof
+	// evidence is set if the final signature conflicts with another one of
+	// the same Round.
+	evidence *Evidence
 }
 
 // FinalSignature holds the message Msg and its signature
 type FinalSignature struct {
 	Msg []byte
 	Sig []byte
+	// Partial is only set if the protocol didn't finish before its
+	// Deadline, Sig is then nil.
+	Partial *PartialSignature
 }
 
+// PartialSignature is what the protocol collected when the Deadline was
+// reached. The caller can use Missing to retry with a smaller roster.
+type PartialSignature struct {
+	// PrepareSig is the signature of the prepare phase, or nil if the
+	// prepare phase didn't finish. It is a signature on the message, but
+	// it doesn't show that the nodes committed to it.
+	PrepareSig []byte
+	// Missing is a bitmap, in the order of the roster, of the nodes that
+	// didn't sign the prepare phase. If the prepare phase didn't finish,
+	// all nodes but the root are missing.
+	Missing []byte
+}
+
+// MissingIndexes returns the indexes in the roster of the nodes marked in
+// Missing.
+func (ps *PartialSignature) MissingIndexes() []int {
+	var missing []int
+	for i := 0; i < len(ps.Missing)*8; i++ {
+		if ps.Missing[i/8]&(1<<uint(i%8)) != 0 {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Topology is the shape of the trees of the ftcosi protocols.
+type Topology int
+
+const (
+	// TopologyCubeRoot uses the cube root of the number of nodes as the
+	// number of subtrees.
+	TopologyCubeRoot Topology = iota
+	// TopologyFlat makes every node a direct child of the root.
+	TopologyFlat
+	// TopologyKAry gives the root BranchingFactor sub-leaders, and every
+	// subtree has as many levels as needed so that no node has more than
+	// BranchingFactor children. A BranchingFactor of 2 gives a binary tree.
+	TopologyKAry
+)
+
 type phase int
 
 const (
@@ -74,26 +178,37 @@ func (bft *ByzCoinX) Start() error {
 	if bft.FinalSignatureChan == nil {
 		return fmt.Errorf("no FinalSignatureChan")
 	}
-
-	// prepare phase (part 1)
-	log.Lvl3("Starting prepare phase")
-	prepProto, err := bft.initCosiProtocol(phasePrep)
+	if bft.Policy != nil && bft.blsKeys != nil {
+		return fmt.Errorf("policies are not supported with BLS signatures")
+	}
+	nSubtrees, err := bft.subtrees(len(bft.List()))
 	if err != nil {
 		return err
 	}
+	bft.nSubtrees = nSubtrees
+	if bft.Deadline > 0 {
+		bft.deadline = time.After(bft.Deadline)
+	}
+	if len(bft.Proposals) > 0 {
+		if err := bft.prepareBatch(); err != nil {
+			return err
+		}
+	}
 
-	err = prepProto.Start()
+	// prepare phase (part 1)
+	log.Lvl3("Starting prepare phase")
+	prepSig, err := bft.startPhase(phasePrep)
 	if err != nil {
 		return err
 	}
 
 	go func() {
 		select {
-		case tmpSig := <-prepProto.FinalSignature:
+		case tmpSig := <-prepSig:
 			bft.prepSigChan <- tmpSig
-		case <-time.After(bft.Timeout):
-			// Waiting for bft.Timeout is too long here but used as a safeguard in
-			// case the prepProto does not return in time.
+		case <-time.After(2 * bft.phaseTimeout(phasePrep)):
+			// Waiting for twice the phase timeout is too long here but used as a
+			// safeguard in case the prepProto does not return in time.
 			log.Error(bft.ServerIdentity().Address, "timeout should not happen while waiting for signature")
 			bft.prepSigChan <- nil
 		}
@@ -102,14 +217,151 @@ func (bft *ByzCoinX) Start() error {
 	return nil
 }
 
-func (bft *ByzCoinX) initCosiProtocol(phase phase) (*protocol.FtCosi, error) {
-	var name string
+// subtrees returns the number of subtrees for the ftcosi protocols of n nodes
+// following the topology.
+func (bft *ByzCoinX) subtrees(n int) (int, error) {
+	switch bft.Topology {
+	case TopologyCubeRoot:
+		return bft.nSubtrees, nil
+	case TopologyFlat:
+		if n < 2 {
+			return 1, nil
+		}
+		return n - 1, nil
+	case TopologyKAry:
+		if bft.BranchingFactor < 1 {
+			return 0, fmt.Errorf("branching factor must be positive, but is %d", bft.BranchingFactor)
+		}
+		// every sub-leader is a child of the root
+		if n < 2 {
+			return 1, nil
+		}
+		if n-1 < bft.BranchingFactor {
+			return n - 1, nil
+		}
+		return bft.BranchingFactor, nil
+	}
+	return 0, fmt.Errorf("unknown topology %d", bft.Topology)
+}
+
+// prepareBatch sets the message to the Merkle root of the proposals and
+// passes the proposals to the verification functions.
+func (bft *ByzCoinX) prepareBatch() error {
+	if bft.Msg != nil {
+		return fmt.Errorf("only one of Msg and Proposals can be set")
+	}
+	root, proofs, err := merkleTree(bft.Proposals)
+	if err != nil {
+		return err
+	}
+	data, err := protobuf.Encode(&Batch{Proposals: bft.Proposals, Data: bft.Data})
+	if err != nil {
+		return err
+	}
+	bft.Msg = root
+	bft.Data = data
+	bft.proofs = proofs
+	return nil
+}
+
+// Proofs returns the inclusion proofs of the Proposals in the order of the
+// proposals, or nil if no batch was signed. Together with the
+// FinalSignature, a proof shows that its proposal has been signed.
+func (bft *ByzCoinX) Proofs() []InclusionProof {
+	return bft.proofs
+}
+
+// startPhase starts the collective signing protocol of the given phase and
+// returns the channel of its signature.
+func (bft *ByzCoinX) startPhase(phase phase) (chan []byte, error) {
+	if bft.blsKeys != nil {
+		blsProto, err := bft.initBlsProtocol(phase)
+		if err != nil {
+			return nil, err
+		}
+		return blsProto.FinalSignature, blsProto.Start()
+	}
+	cosiProto, err := bft.initCosiProtocol(phase)
+	if err != nil {
+		return nil, err
+	}
+	bft.cosiProtosMutex.Lock()
+	bft.cosiProtos = append(bft.cosiProtos, cosiProto)
+	bft.cosiProtosMutex.Unlock()
+	return cosiProto.FinalSignature, cosiProto.Start()
+}
+
+// SkippedNodes returns the sub-leaders that didn't respond in the prepare
+// and the commit phase, so that the caller can record unreliable nodes. It
+// is complete once the FinalSignature has been sent.
+func (bft *ByzCoinX) SkippedNodes() []*network.ServerIdentity {
+	bft.cosiProtosMutex.Lock()
+	defer bft.cosiProtosMutex.Unlock()
+	var skipped []*network.ServerIdentity
+	for _, p := range bft.cosiProtos {
+		skipped = append(skipped, p.SkippedNodes()...)
+	}
+	return skipped
+}
+
+// Refusals returns the nodes that didn't sign in the prepare and the commit
+// phase together with the reason, so that the caller can tell why a
+// signature failed. It is complete once the FinalSignature has been sent.
+// Only the ftcosi phases report refusals.
+func (bft *ByzCoinX) Refusals() []protocol.Refusal {
+	bft.cosiProtosMutex.Lock()
+	defer bft.cosiProtosMutex.Unlock()
+	var refusals []protocol.Refusal
+	for _, p := range bft.cosiProtos {
+		refusals = append(refusals, p.Refusals()...)
+	}
+	return refusals
+}
+
+// VerificationStats returns the minimum, median and maximum time the nodes
+// took to verify the proposal in the prepare phase. It is complete once the
+// FinalSignature has been sent. Only the ftcosi phases report timings.
+func (bft *ByzCoinX) VerificationStats() protocol.VerificationStats {
+	bft.cosiProtosMutex.Lock()
+	defer bft.cosiProtosMutex.Unlock()
+	if len(bft.cosiProtos) == 0 {
+		return protocol.VerificationStats{Slowest: -1}
+	}
+	return bft.cosiProtos[0].VerificationStats()
+}
+
+func (bft *ByzCoinX) phaseName(phase phase) (string, error) {
 	if phase == phasePrep {
-		name = bft.prepCosiProtoName
+		return bft.prepCosiProtoName, nil
 	} else if phase == phaseCommit {
-		name = bft.commitCosiProtoName
-	} else {
-		return nil, fmt.Errorf("invalid phase %v", phase)
+		return bft.commitCosiProtoName, nil
+	}
+	return "", fmt.Errorf("invalid phase %v", phase)
+}
+
+func (bft *ByzCoinX) initBlsProtocol(phase phase) (*blscosi.BlsCosi, error) {
+	name, err := bft.phaseName(phase)
+	if err != nil {
+		return nil, err
+	}
+
+	pi, err := bft.CreateProtocol(name, bft.Tree())
+	if err != nil {
+		return nil, err
+	}
+	blsProto := pi.(*blscosi.BlsCosi)
+	blsProto.Msg = bft.Msg
+	blsProto.Data = bft.Data
+	blsProto.Threshold = bft.Threshold
+	blsProto.Timeout = bft.phaseTimeout(phase)
+
+	return blsProto, nil
+}
+
+func (bft *ByzCoinX) initCosiProtocol(phase phase) (*protocol.FtCosi, error) {
+	name, err := bft.phaseName(phase)
+	if err != nil {
+		return nil, err
 	}
 
 	pi, err := bft.CreateProtocol(name, bft.Tree())
@@ -119,15 +371,44 @@ func (bft *ByzCoinX) initCosiProtocol(phase phase) (*protocol.FtCosi, error) {
 	cosiProto := pi.(*protocol.FtCosi)
 	cosiProto.CreateProtocol = bft.CreateProtocol
 	cosiProto.NSubtrees = bft.nSubtrees
+	if bft.Topology == TopologyKAry {
+		cosiProto.BranchingFactor = bft.BranchingFactor
+	}
 	cosiProto.Msg = bft.Msg
 	cosiProto.Data = bft.Data
 	cosiProto.Threshold = bft.Threshold
-	// For each of the prepare and commit phase we get half of the time.
-	cosiProto.Timeout = bft.Timeout / 2
+	cosiProto.Timeout = bft.phaseTimeout(phase)
+	cosiProto.SubleaderTimeout = bft.SubleaderTimeout
+	cosiProto.Sequence = bft.Sequence
+	cosiProto.SequenceID = bft.SequenceID
+	cosiProto.Policy = bft.Policy
+	cosiProto.UnreliableNodes = append([]*network.ServerIdentity{}, bft.UnreliableNodes...)
+	if phase == phaseCommit {
+		cosiProto.UnreliableNodes = append(cosiProto.UnreliableNodes, bft.SkippedNodes()...)
+	}
 
 	return cosiProto, nil
 }
 
+// phaseTimeout returns the timeout of the ftcosi protocol of the given phase.
+func (bft *ByzCoinX) phaseTimeout(phase phase) time.Duration {
+	if phase == phasePrep && bft.PrepareTimeout > 0 {
+		return bft.PrepareTimeout
+	}
+	if phase == phaseCommit && bft.CommitTimeout > 0 {
+		return bft.CommitTimeout
+	}
+	// For each of the prepare and commit phase we get half of the time.
+	return bft.Timeout / 2
+}
+
+// TotalTimeout returns the time the protocol may take at most with the
+// current timeouts, so that callers know how long to wait for the
+// FinalSignature.
+func (bft *ByzCoinX) TotalTimeout() time.Duration {
+	return bft.phaseTimeout(phasePrep) + bft.phaseTimeout(phaseCommit)
+}
+
 // Dispatch is the main logic of the BFTCoSi protocol. It runs two CoSi
 // protocols as the prepare and the commit phase of PBFT. Concretely, it does:
 // 1, wait for the prepare phase to finish
@@ -144,41 +425,95 @@ func (bft *ByzCoinX) Dispatch() error {
 	}
 
 	// prepare phase (part 2)
-	prepSig := <-bft.prepSigChan
-	err := cosi.Verify(bft.suite, bft.publics, bft.Msg, prepSig, cosi.NewThresholdPolicy(bft.Threshold))
+	var prepSig []byte
+	select {
+	case prepSig = <-bft.prepSigChan:
+	case <-bft.deadline:
+		log.Lvl2(bft.ServerIdentity(), "deadline reached during the prepare phase")
+		bft.FinalSignatureChan <- bft.partialSignature(nil)
+		return nil
+	}
+	err := bft.verifySignature(prepSig)
 	if err != nil {
 		log.Lvl2("Signature verification failed on root during the prepare phase with error:", err)
-		bft.FinalSignatureChan <- FinalSignature{nil, nil}
+		bft.FinalSignatureChan <- FinalSignature{}
 		return nil
 	}
 	log.Lvl3("Finished prepare phase")
 
 	// commit phase
 	log.Lvl3("Starting commit phase")
-	commitProto, err := bft.initCosiProtocol(phaseCommit)
-	if err != nil {
-		return err
-	}
-
-	err = commitProto.Start()
+	commitSigChan, err := bft.startPhase(phaseCommit)
 	if err != nil {
 		return err
 	}
 
 	var commitSig []byte
 	select {
-	case commitSig = <-commitProto.FinalSignature:
+	case commitSig = <-commitSigChan:
 		log.Lvl3("Finished commit phase")
-	case <-time.After(bft.Timeout):
-		// Waiting for bft.Timeout is too long here but used as a safeguard in
-		// case the commitProto does not return in time.
+	case <-time.After(2 * bft.phaseTimeout(phaseCommit)):
+		// Waiting for twice the phase timeout is too long here but used as a
+		// safeguard in case the commitProto does not return in time.
 		log.Error(bft.ServerIdentity().Address, "timeout should not happen while waiting for signature")
+	case <-bft.deadline:
+		log.Lvl2(bft.ServerIdentity(), "deadline reached during the commit phase")
+		bft.FinalSignatureChan <- bft.partialSignature(prepSig)
+		return nil
 	}
 
-	bft.FinalSignatureChan <- FinalSignature{bft.Msg, commitSig}
+	sig := FinalSignature{Msg: bft.Msg, Sig: commitSig}
+	if bft.Round != nil && bft.Detector != nil {
+		if e := bft.Detector.Record(bft.Round, bft.RoundData, sig); e != nil {
+			log.Warn(bft.ServerIdentity(), "found conflicting signatures for round", hex.EncodeToString(bft.Round))
+			bft.evidence = e
+		}
+	}
+	bft.FinalSignatureChan <- sig
 	return nil
 }
 
+// Evidence returns the evidence of equivocation if the final signature
+// conflicts with a signature recorded in the Detector for the same Round. It
+// is set once the FinalSignature has been sent.
+func (bft *ByzCoinX) Evidence() *Evidence {
+	return bft.evidence
+}
+
+// partialSignature returns the FinalSignature sent when the deadline is
+// reached, with the signature of the prepare phase if it finished.
+func (bft *ByzCoinX) partialSignature(prepSig []byte) FinalSignature {
+	n := len(bft.Roster().List)
+	missing := make([]byte, (n+7)/8)
+	for i := 0; i < n; i++ {
+		ok := i == bft.TreeNode().RosterIndex
+		if prepSig != nil {
+			ok = signed(prepSig, n, i)
+		}
+		if !ok {
+			missing[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return FinalSignature{Msg: bft.Msg,
+		Partial: &PartialSignature{PrepareSig: prepSig, Missing: missing}}
+}
+
+// verifySignature checks the signature of a phase against the threshold.
+func (bft *ByzCoinX) verifySignature(sig []byte) error {
+	if bft.blsKeys != nil {
+		publics, err := bft.blsKeys.Publics(bft.Roster())
+		if err != nil {
+			return err
+		}
+		return blscosi.Verify(publics, bft.Msg, sig, bft.Threshold)
+	}
+	policy := bft.Policy
+	if policy == nil {
+		policy = cosi.NewThresholdPolicy(bft.Threshold)
+	}
+	return cosi.Verify(bft.suite, bft.publics, bft.Msg, sig, policy)
+}
+
 // NewByzCoinX creates and initialises a ByzCoinX protocol.
 func NewByzCoinX(n *onet.TreeNodeInstance, prepCosiProtoName, commitCosiProtoName string,
 	suite cosi.Suite) (*ByzCoinX, error) {
@@ -189,7 +524,7 @@ func NewByzCoinX(n *onet.TreeNodeInstance, prepCosiProtoName, commitCosiProtoNam
 		Data:                make([]byte, 0),
 		prepCosiProtoName:   prepCosiProtoName,
 		commitCosiProtoName: commitCosiProtoName,
-		prepSigChan:         make(chan []byte, 0),
+		prepSigChan:         make(chan []byte, 1),
 		publics:             n.Roster().Publics(),
 		suite:               suite,
 		// We set nSubtrees to the cube root of n to evenly distribute the load,
@@ -198,7 +533,8 @@ func NewByzCoinX(n *onet.TreeNodeInstance, prepCosiProtoName, commitCosiProtoNam
 	}, nil
 }
 
-func makeProtocols(vf, ack protocol.VerificationFn, protoName string, suite cosi.Suite) map[string]onet.NewProtocol {
+func makeProtocols(vf, ack protocol.VerificationFn, abort protocol.AbortFn, protoName string,
+	suite cosi.Suite) map[string]onet.NewProtocol {
 
 	protocolMap := make(map[string]onet.NewProtocol)
 
@@ -218,7 +554,7 @@ func makeProtocols(vf, ack protocol.VerificationFn, protoName string, suite cosi
 	protocolMap[prepCosiProtoName] = prepCosiProto
 
 	prepCosiSubProto := func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-		return protocol.NewSubFtCosi(n, vf, suite)
+		return newSubFtCosi(n, vf, abort, suite)
 	}
 	protocolMap[prepCosiSubProtoName] = prepCosiSubProto
 
@@ -228,17 +564,58 @@ func makeProtocols(vf, ack protocol.VerificationFn, protoName string, suite cosi
 	protocolMap[commitCosiProtoName] = commitCosiProto
 
 	commitCosiSubProto := func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-		return protocol.NewSubFtCosi(n, ack, suite)
+		return newSubFtCosi(n, ack, abort, suite)
 	}
 	protocolMap[commitCosiSubProtoName] = commitCosiSubProto
 
 	return protocolMap
 }
 
+// newSubFtCosi creates the ftcosi sub-protocol and sets its abort handler.
+func newSubFtCosi(n *onet.TreeNodeInstance, vf protocol.VerificationFn, abort protocol.AbortFn,
+	suite cosi.Suite) (onet.ProtocolInstance, error) {
+	pi, err := protocol.NewSubFtCosi(n, vf, suite)
+	if err != nil {
+		return nil, err
+	}
+	pi.(*protocol.SubFtCosi).OnAbort = abort
+	return pi, nil
+}
+
+func makeBlsProtocols(keys blscosi.KeyStore, vf, ack protocol.VerificationFn, protoName string) map[string]onet.NewProtocol {
+
+	protocolMap := make(map[string]onet.NewProtocol)
+
+	prepBlsProtoName := protoName + "_blscosi_prep"
+	commitBlsProtoName := protoName + "_blscosi_commit"
+
+	bftProto := func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		bft, err := NewByzCoinX(n, prepBlsProtoName, commitBlsProtoName, nil)
+		if err != nil {
+			return nil, err
+		}
+		bft.blsKeys = keys
+		return bft, nil
+	}
+	protocolMap[protoName] = bftProto
+
+	prepBlsProto := func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		return blscosi.NewBlsCosi(n, blscosi.VerificationFn(vf), keys)
+	}
+	protocolMap[prepBlsProtoName] = prepBlsProto
+
+	commitBlsProto := func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		return blscosi.NewBlsCosi(n, blscosi.VerificationFn(ack), keys)
+	}
+	protocolMap[commitBlsProtoName] = commitBlsProto
+
+	return protocolMap
+}
+
 // GlobalInitBFTCoSiProtocol creates and registers the protocols required to run
 // BFTCoSi globally.
 func GlobalInitBFTCoSiProtocol(suite cosi.Suite, vf, ack protocol.VerificationFn, protoName string) error {
-	protocolMap := makeProtocols(vf, ack, protoName, suite)
+	protocolMap := makeProtocols(vf, ack, nil, protoName, suite)
 	for protoName, proto := range protocolMap {
 		if _, err := onet.GlobalProtocolRegister(protoName, proto); err != nil {
 			return err
@@ -250,7 +627,61 @@ func GlobalInitBFTCoSiProtocol(suite cosi.Suite, vf, ack protocol.VerificationFn
 // InitBFTCoSiProtocol creates and registers the protocols required to run
 // BFTCoSi to the context c.
 func InitBFTCoSiProtocol(suite cosi.Suite, c *onet.Context, vf, ack protocol.VerificationFn, protoName string) error {
-	protocolMap := makeProtocols(vf, ack, protoName, suite)
+	protocolMap := makeProtocols(vf, ack, nil, protoName, suite)
+	for protoName, proto := range protocolMap {
+		if _, err := c.ProtocolRegister(protoName, proto); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GlobalInitBFTCoSiProtocolWithAbort is like GlobalInitBFTCoSiProtocol, but
+// abort is called on the nodes if the leader aborts a round or doesn't go on
+// with it in time.
+func GlobalInitBFTCoSiProtocolWithAbort(suite cosi.Suite, vf, ack protocol.VerificationFn,
+	abort protocol.AbortFn, protoName string) error {
+	protocolMap := makeProtocols(vf, ack, abort, protoName, suite)
+	for protoName, proto := range protocolMap {
+		if _, err := onet.GlobalProtocolRegister(protoName, proto); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitBFTCoSiProtocolWithAbort is like InitBFTCoSiProtocol, but abort is
+// called on the nodes if the leader aborts a round or doesn't go on with it
+// in time, so that the service can start a view-change.
+func InitBFTCoSiProtocolWithAbort(suite cosi.Suite, c *onet.Context, vf, ack protocol.VerificationFn,
+	abort protocol.AbortFn, protoName string) error {
+	protocolMap := makeProtocols(vf, ack, abort, protoName, suite)
+	for protoName, proto := range protocolMap {
+		if _, err := c.ProtocolRegister(protoName, proto); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GlobalInitBLSBFTCoSiProtocol creates and registers the protocols required
+// to run BFTCoSi with BLS signatures globally. The final signatures have to
+// be verified with blscosi.Verify and the BLS public keys from keys.
+func GlobalInitBLSBFTCoSiProtocol(keys blscosi.KeyStore, vf, ack protocol.VerificationFn, protoName string) error {
+	protocolMap := makeBlsProtocols(keys, vf, ack, protoName)
+	for protoName, proto := range protocolMap {
+		if _, err := onet.GlobalProtocolRegister(protoName, proto); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitBLSBFTCoSiProtocol creates and registers the protocols required to run
+// BFTCoSi with BLS signatures to the context c. The final signatures have to
+// be verified with blscosi.Verify and the BLS public keys from keys.
+func InitBLSBFTCoSiProtocol(c *onet.Context, keys blscosi.KeyStore, vf, ack protocol.VerificationFn, protoName string) error {
+	protocolMap := makeBlsProtocols(keys, vf, ack, protoName)
 	for protoName, proto := range protocolMap {
 		if _, err := c.ProtocolRegister(protoName, proto); err != nil {
 			return err
@@ -2,6 +2,7 @@ package byzcoinx
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"math"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/blscosi"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/sign/cosi"
 	"github.com/dedis/onet"
@@ -53,16 +55,14 @@ func (co *Counters) get(i int) *Counter {
 var counters = &Counters{}
 
 // verify function that returns true if the length of the data is 1.
-func verify(msg, data []byte) bool {
+func verify(msg, data []byte) error {
 	c, err := strconv.Atoi(string(msg))
 	if err != nil {
-		log.Error("Failed to cast msg", msg)
-		return false
+		return fmt.Errorf("failed to cast msg %x", msg)
 	}
 
 	if len(data) == 0 {
-		log.Error("Data is empty.")
-		return false
+		return errors.New("data is empty")
 	}
 
 	counter := counters.get(c)
@@ -71,18 +71,16 @@ func verify(msg, data []byte) bool {
 	log.Lvl4("Verification called", counter.veriCount, "times")
 	counter.Unlock()
 	if len(msg) == 0 {
-		log.Error("Didn't receive correct data")
-		return false
+		return errors.New("didn't receive correct data")
 	}
-	return true
+	return nil
 }
 
 // verifyRefuse will refuse the refuseIndex'th calls
-func verifyRefuse(msg, data []byte) bool {
+func verifyRefuse(msg, data []byte) error {
 	c, err := strconv.Atoi(string(msg))
 	if err != nil {
-		log.Error("Failed to cast", msg)
-		return false
+		return fmt.Errorf("failed to cast msg %x", msg)
 	}
 
 	counter := counters.get(c)
@@ -91,19 +89,18 @@ func verifyRefuse(msg, data []byte) bool {
 	defer func() { counter.veriCount++ }()
 	if counter.veriCount == counter.refuseIndex {
 		log.Lvl2("Refusing for count==", counter.refuseIndex)
-		return false
+		return fmt.Errorf("refusing for count %d", counter.refuseIndex)
 	}
 	log.Lvl3("Verification called", counter.veriCount, "times")
 	if len(msg) == 0 {
-		log.Error("Didn't receive correct data")
-		return false
+		return errors.New("didn't receive correct data")
 	}
-	return true
+	return nil
 }
 
 // ack is a dummy
-func ack(a, b []byte) bool {
-	return true
+func ack(a, b []byte) error {
+	return nil
 }
 
 func TestMain(m *testing.M) {
@@ -157,6 +154,352 @@ func TestBftCoSiFault(t *testing.T) {
 	}
 }
 
+func TestBftCoSiTimeouts(t *testing.T) {
+	const protoName = "TestBftCoSiTimeouts"
+
+	err := GlobalInitBFTCoSiProtocol(testSuite, verify, ack, protoName)
+	require.Nil(t, err)
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, tree := local.GenTree(9, false)
+
+	pi, err := local.CreateProtocol(protoName, tree)
+	require.Nil(t, err)
+	bftCosiProto := pi.(*ByzCoinX)
+	bftCosiProto.CreateProtocol = local.CreateProtocol
+	bftCosiProto.FinalSignatureChan = make(chan FinalSignature, 1)
+	bftCosiProto.Timeout = defaultTimeout
+
+	// without phase timeouts, every phase gets half of the timeout
+	require.Equal(t, defaultTimeout/2, bftCosiProto.phaseTimeout(phasePrep))
+	require.Equal(t, defaultTimeout/2, bftCosiProto.phaseTimeout(phaseCommit))
+	require.Equal(t, defaultTimeout, bftCosiProto.TotalTimeout())
+
+	bftCosiProto.PrepareTimeout = defaultTimeout / 4
+	bftCosiProto.CommitTimeout = defaultTimeout
+	bftCosiProto.SubleaderTimeout = defaultTimeout / 8
+	require.Equal(t, defaultTimeout/4, bftCosiProto.phaseTimeout(phasePrep))
+	require.Equal(t, defaultTimeout, bftCosiProto.phaseTimeout(phaseCommit))
+	require.Equal(t, defaultTimeout*5/4, bftCosiProto.TotalTimeout())
+
+	// the timeouts are passed down to ftcosi
+	prepProto, err := bftCosiProto.initCosiProtocol(phasePrep)
+	require.Nil(t, err)
+	require.Equal(t, defaultTimeout/4, prepProto.Timeout)
+	require.Equal(t, defaultTimeout/8, prepProto.SubleaderTimeout)
+	prepProto.Shutdown()
+
+	// and the protocol still succeeds
+	counter := &Counter{}
+	counters.add(counter)
+	proposal := []byte(strconv.Itoa(counters.size() - 1))
+	bftCosiProto.Msg = proposal
+	bftCosiProto.Data = []byte("hello world")
+	bftCosiProto.Threshold = Threshold(9)
+	require.Nil(t, bftCosiProto.Start())
+	err = getAndVerifySignature(bftCosiProto.FinalSignatureChan, roster.Publics(), proposal, nil)
+	require.Nil(t, err)
+}
+
+func TestBftCoSiBLS(t *testing.T) {
+	const protoName = "TestBftCoSiBLS"
+
+	for _, n := range []int{1, 4, 9} {
+		local := onet.NewLocalTest(testSuite)
+		_, roster, tree := local.GenTree(n, false)
+		keys := blscosi.NewMemKeyStore(roster)
+		name := fmt.Sprintf("%s%d", protoName, n)
+		err := GlobalInitBLSBFTCoSiProtocol(keys, verify, ack, name)
+		require.Nil(t, err)
+
+		pi, err := local.CreateProtocol(name, tree)
+		require.Nil(t, err)
+		bftCosiProto := pi.(*ByzCoinX)
+		bftCosiProto.CreateProtocol = local.CreateProtocol
+		bftCosiProto.FinalSignatureChan = make(chan FinalSignature, 1)
+
+		counter := &Counter{}
+		counters.add(counter)
+		proposal := []byte(strconv.Itoa(counters.size() - 1))
+		bftCosiProto.Msg = proposal
+		bftCosiProto.Data = []byte("hello world")
+		bftCosiProto.Timeout = defaultTimeout
+		bftCosiProto.Threshold = Threshold(n)
+		require.Nil(t, bftCosiProto.Start())
+
+		var sig FinalSignature
+		select {
+		case sig = <-bftCosiProto.FinalSignatureChan:
+		case <-time.After(defaultTimeout + time.Second):
+			t.Fatal("didn't get a signature")
+		}
+		require.NotNil(t, sig.Sig)
+		require.Equal(t, proposal, sig.Msg)
+		publics, err := keys.Publics(roster)
+		require.Nil(t, err)
+		require.Nil(t, blscosi.Verify(publics, proposal, sig.Sig, Threshold(n)))
+		require.NotNil(t, cosi.Verify(testSuite, roster.Publics(), proposal, sig.Sig, nil))
+		local.CloseAll()
+	}
+}
+
+func TestBftCoSiTopology(t *testing.T) {
+	const protoName = "TestBftCoSiTopology"
+
+	err := GlobalInitBFTCoSiProtocol(testSuite, verify, ack, protoName)
+	require.Nil(t, err)
+
+	configs := []struct {
+		n         int
+		topology  Topology
+		branching int
+		subtrees  int
+	}{
+		{5, TopologyFlat, 0, 4},
+		{7, TopologyKAry, 2, 2},
+		{13, TopologyKAry, 2, 2},
+		{15, TopologyKAry, 3, 3},
+		{13, TopologyKAry, 20, 12},
+	}
+	for _, c := range configs {
+		local := onet.NewLocalTest(testSuite)
+		_, roster, tree := local.GenTree(c.n, false)
+
+		pi, err := local.CreateProtocol(protoName, tree)
+		require.Nil(t, err)
+		bftCosiProto := pi.(*ByzCoinX)
+		bftCosiProto.CreateProtocol = local.CreateProtocol
+		bftCosiProto.FinalSignatureChan = make(chan FinalSignature, 1)
+		bftCosiProto.Topology = c.topology
+		bftCosiProto.BranchingFactor = c.branching
+
+		counter := &Counter{}
+		counters.add(counter)
+		proposal := []byte(strconv.Itoa(counters.size() - 1))
+		bftCosiProto.Msg = proposal
+		bftCosiProto.Data = []byte("hello world")
+		bftCosiProto.Timeout = defaultTimeout
+		bftCosiProto.Threshold = Threshold(c.n)
+		require.Nil(t, bftCosiProto.Start())
+		require.Equal(t, c.subtrees, bftCosiProto.nSubtrees)
+
+		err = getAndVerifySignature(bftCosiProto.FinalSignatureChan, roster.Publics(), proposal, nil)
+		require.Nil(t, err)
+		local.CloseAll()
+	}
+
+	bft := &ByzCoinX{Topology: TopologyKAry}
+	_, err = bft.subtrees(4)
+	require.NotNil(t, err, "missing branching factor")
+}
+
+func TestBftCoSiDeadline(t *testing.T) {
+	const protoName = "TestBftCoSiDeadline"
+
+	// the commit phase takes longer than the deadline
+	ackSlow := func(a, b []byte) error {
+		time.Sleep(2 * time.Second)
+		return nil
+	}
+	err := GlobalInitBFTCoSiProtocol(testSuite, verify, ackSlow, protoName)
+	require.Nil(t, err)
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, tree := local.GenTree(4, false)
+
+	pi, err := local.CreateProtocol(protoName, tree)
+	require.Nil(t, err)
+	bftCosiProto := pi.(*ByzCoinX)
+	bftCosiProto.CreateProtocol = local.CreateProtocol
+	bftCosiProto.FinalSignatureChan = make(chan FinalSignature, 1)
+
+	counter := &Counter{}
+	counters.add(counter)
+	proposal := []byte(strconv.Itoa(counters.size() - 1))
+	bftCosiProto.Msg = proposal
+	bftCosiProto.Data = []byte("hello world")
+	bftCosiProto.Timeout = defaultTimeout
+	bftCosiProto.Deadline = time.Second
+	bftCosiProto.Threshold = 4
+	require.Nil(t, bftCosiProto.Start())
+
+	var sig FinalSignature
+	select {
+	case sig = <-bftCosiProto.FinalSignatureChan:
+	case <-time.After(defaultTimeout / 2):
+		t.Fatal("didn't get a partial signature before the timeout")
+	}
+	require.Nil(t, sig.Sig)
+	require.Equal(t, proposal, sig.Msg)
+	require.NotNil(t, sig.Partial)
+	require.Nil(t, cosi.Verify(testSuite, roster.Publics(), proposal, sig.Partial.PrepareSig, nil))
+	require.Equal(t, 0, len(sig.Partial.MissingIndexes()))
+
+	ps := &PartialSignature{Missing: []byte{0x12, 0x01}}
+	require.Equal(t, []int{1, 4, 8}, ps.MissingIndexes())
+
+	// let the commit phase finish before closing
+	time.Sleep(2 * time.Second)
+}
+
+func TestBftCoSiEquivocation(t *testing.T) {
+	const protoName = "TestBftCoSiEquivocation"
+
+	// the messages of a round are not counter indexes
+	accept := func(msg, data []byte) error { return nil }
+	err := GlobalInitBFTCoSiProtocol(testSuite, accept, accept, protoName)
+	require.Nil(t, err)
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, tree := local.GenTree(4, false)
+
+	detector := NewEquivocationDetector()
+	found := make(chan *Evidence, 1)
+	detector.OnEvidence = func(e *Evidence) { found <- e }
+	round := []byte("round")
+
+	// sign runs the protocol for the data of the round and returns the
+	// protocol instance once the signature is done.
+	sign := func(round, data []byte) *ByzCoinX {
+		pi, err := local.CreateProtocol(protoName, tree)
+		require.Nil(t, err)
+		bftCosiProto := pi.(*ByzCoinX)
+		bftCosiProto.CreateProtocol = local.CreateProtocol
+		bftCosiProto.FinalSignatureChan = make(chan FinalSignature, 1)
+
+		proposal := RoundMessage(round, data)
+		bftCosiProto.Msg = proposal
+		bftCosiProto.Data = []byte("hello world")
+		bftCosiProto.Timeout = defaultTimeout
+		bftCosiProto.Threshold = 4
+		bftCosiProto.Round = round
+		bftCosiProto.RoundData = data
+		bftCosiProto.Detector = detector
+		require.Nil(t, bftCosiProto.Start())
+		err = getAndVerifySignature(bftCosiProto.FinalSignatureChan, roster.Publics(), proposal, nil)
+		require.Nil(t, err)
+		return bftCosiProto
+	}
+
+	require.Nil(t, sign(round, []byte("first")).Evidence())
+	require.Equal(t, 0, len(detector.Evidence()))
+	other := sign([]byte("other round"), []byte("second"))
+	require.Nil(t, other.Evidence())
+
+	e := sign(round, []byte("second")).Evidence()
+	require.NotNil(t, e)
+	require.Equal(t, e, <-found)
+	require.Equal(t, 1, len(detector.Evidence()))
+	culprits, err := e.Verify(testSuite, roster.Publics(), 4)
+	require.Nil(t, err)
+	require.Equal(t, []int{0, 1, 2, 3}, culprits)
+
+	// signatures of different rounds are no evidence
+	fake := *e
+	fake.Second = FinalSignature{Msg: other.Msg, Sig: e.Second.Sig}
+	fake.SecondData = []byte("second")
+	_, err = fake.Verify(testSuite, roster.Publics(), 4)
+	require.NotNil(t, err)
+
+	// the same message twice is no evidence
+	e.Second = e.First
+	e.SecondData = e.FirstData
+	_, err = e.Verify(testSuite, roster.Publics(), 4)
+	require.NotNil(t, err)
+	require.Nil(t, detector.Record(round, e.FirstData, e.First))
+}
+
+func TestEquivocationDetector_MaxRounds(t *testing.T) {
+	d := NewEquivocationDetector()
+	sig := func(round, data []byte) FinalSignature {
+		return FinalSignature{Msg: RoundMessage(round, data), Sig: []byte("sig")}
+	}
+	for i := 0; i <= maxRounds; i++ {
+		round := []byte(strconv.Itoa(i))
+		require.Nil(t, d.Record(round, []byte("a"), sig(round, []byte("a"))))
+	}
+	require.Equal(t, maxRounds, len(d.signed))
+	require.Equal(t, maxRounds, len(d.rounds))
+
+	// the oldest round is forgotten, the newest one is still there
+	round := []byte("0")
+	require.Nil(t, d.Record(round, []byte("b"), sig(round, []byte("b"))))
+	round = []byte(strconv.Itoa(maxRounds))
+	require.NotNil(t, d.Record(round, []byte("b"), sig(round, []byte("b"))))
+
+	// a message that is not of the round is ignored
+	require.Nil(t, d.Record(round, []byte("c"), sig(round, []byte("d"))))
+}
+
+// verifyBatch checks every proposal of the batch with verify.
+func verifyBatch(msg, data []byte) error {
+	b, err := DecodeBatch(msg, data)
+	if err != nil {
+		return err
+	}
+	for _, p := range b.Proposals {
+		if err := verify(p, b.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBftCoSiBatch(t *testing.T) {
+	const protoName = "TestBftCoSiBatch"
+
+	err := GlobalInitBFTCoSiProtocol(testSuite, verifyBatch, ack, protoName)
+	require.Nil(t, err)
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, roster, tree := local.GenTree(4, false)
+
+	pi, err := local.CreateProtocol(protoName, tree)
+	require.Nil(t, err)
+	bftCosiProto := pi.(*ByzCoinX)
+	bftCosiProto.CreateProtocol = local.CreateProtocol
+	bftCosiProto.FinalSignatureChan = make(chan FinalSignature, 1)
+
+	var proposals [][]byte
+	var cs []*Counter
+	for i := 0; i < 5; i++ {
+		counter := &Counter{}
+		counters.add(counter)
+		cs = append(cs, counter)
+		proposals = append(proposals, []byte(strconv.Itoa(counters.size()-1)))
+	}
+	bftCosiProto.Proposals = proposals
+	bftCosiProto.Data = []byte("hello world")
+	bftCosiProto.Timeout = defaultTimeout
+	bftCosiProto.Threshold = 4
+	require.Nil(t, bftCosiProto.Start())
+
+	root, err := MerkleRoot(proposals)
+	require.Nil(t, err)
+	require.Nil(t, getAndVerifySignature(bftCosiProto.FinalSignatureChan, roster.Publics(), root, nil))
+
+	// every node verified every proposal
+	for _, c := range cs {
+		c.Lock()
+		require.Equal(t, 4, c.veriCount)
+		c.Unlock()
+	}
+
+	proofs := bftCosiProto.Proofs()
+	require.Equal(t, len(proposals), len(proofs))
+	for i, p := range proofs {
+		require.Nil(t, p.Verify(root, proposals[i]))
+	}
+
+	// Msg and Proposals cannot be given together
+	bft := &ByzCoinX{Msg: []byte("hello"), Proposals: proposals}
+	require.NotNil(t, bft.prepareBatch())
+}
+
 func runProtocol(t *testing.T, nbrHosts int, nbrFault int, refuseIndex int, protoName string) {
 	log.Lvlf1("Starting with %d hosts with %d faulty ones and refusing at %d. Protocol name is %s",
 		nbrHosts, nbrFault, refuseIndex, protoName)
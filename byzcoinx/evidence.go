@@ -0,0 +1,186 @@
+package byzcoinx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dedis/cothority/blscosi"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/cosi"
+	"github.com/dedis/onet/network"
+)
+
+// A node equivocates if it signs two different messages for the same round,
+// for example two blocks following the same block during a view-change. As
+// both collective signatures hold the mask of their signers, the nodes that
+// signed both are known and the two signatures are the evidence against them.
+// The round must be part of what is signed, else two signatures of different
+// rounds could be passed off as one round: the messages are
+// RoundMessage(round, data), like the forward-links of the skipchains, whose
+// round is the block they come from.
+
+// maxRounds is how many rounds an EquivocationDetector remembers. Once it is
+// reached, the oldest rounds are forgotten.
+const maxRounds = 1024
+
+func init() {
+	network.RegisterMessage(Evidence{})
+}
+
+// RoundMessage returns the message to sign for the data of a round, which
+// commits to the round. It is the hash of the forward-link of a skipchain
+// block with the hash round, if data is the hash of the target block followed
+// by the ID of the new roster, if any.
+func RoundMessage(round, data []byte) []byte {
+	h := sha256.New()
+	h.Write(round)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Evidence holds two signatures on different messages for the same round.
+// It is registered with the network package, so that a service can store it
+// in the data of a block.
+type Evidence struct {
+	Round  []byte
+	First  FinalSignature
+	Second FinalSignature
+	// FirstData and SecondData are the data of the round in the messages
+	// of First and Second.
+	FirstData  []byte
+	SecondData []byte
+}
+
+// Verify checks that both signatures are valid ftcosi signatures of at
+// least threshold nodes on different messages of the round. It returns the
+// indexes in the roster of the nodes that signed both messages.
+func (e *Evidence) Verify(suite cosi.Suite, publics []kyber.Point, threshold int) ([]int, error) {
+	policy := cosi.NewThresholdPolicy(threshold)
+	return e.verify(len(publics), func(sig FinalSignature) error {
+		return cosi.Verify(suite, publics, sig.Msg, sig.Sig, policy)
+	})
+}
+
+// VerifyBLS is like Verify, but for blscosi signatures, with the BLS public
+// keys of the roster.
+func (e *Evidence) VerifyBLS(publics []kyber.Point, threshold int) ([]int, error) {
+	return e.verify(len(publics), func(sig FinalSignature) error {
+		return blscosi.Verify(publics, sig.Msg, sig.Sig, threshold)
+	})
+}
+
+// verify checks both signatures with verifySig and returns the indexes of
+// the n nodes that signed both.
+func (e *Evidence) verify(n int, verifySig func(FinalSignature) error) ([]int, error) {
+	if len(e.Round) == 0 {
+		return nil, errors.New("missing round")
+	}
+	if bytes.Equal(e.First.Msg, e.Second.Msg) {
+		return nil, errors.New("both signatures are on the same message")
+	}
+	if !bytes.Equal(e.First.Msg, RoundMessage(e.Round, e.FirstData)) ||
+		!bytes.Equal(e.Second.Msg, RoundMessage(e.Round, e.SecondData)) {
+		return nil, errors.New("the messages are not of the round")
+	}
+	for _, sig := range []FinalSignature{e.First, e.Second} {
+		if err := verifySig(sig); err != nil {
+			return nil, fmt.Errorf("invalid signature: %v", err)
+		}
+	}
+	var culprits []int
+	for i := 0; i < n; i++ {
+		if signed(e.First.Sig, n, i) && signed(e.Second.Sig, n, i) {
+			culprits = append(culprits, i)
+		}
+	}
+	if len(culprits) == 0 {
+		return nil, errors.New("no node signed both messages")
+	}
+	return culprits, nil
+}
+
+// EquivocationDetector remembers the signed message of the last maxRounds
+// rounds and collects evidence if a different message is signed for one of
+// them. It can be shared by all the ByzCoinX instances of a service, which
+// can also record signatures it gets from other nodes.
+type EquivocationDetector struct {
+	// OnEvidence is called once for every new evidence, so that the service
+	// can store it, for example on its skipchain. It must not block.
+	OnEvidence func(*Evidence)
+
+	signed map[string]roundSignature
+	// rounds are the keys of signed, from the oldest to the newest.
+	rounds   []string
+	evidence []*Evidence
+	sync.Mutex
+}
+
+// roundSignature is the first signature recorded for a round.
+type roundSignature struct {
+	sig  FinalSignature
+	data []byte
+}
+
+// NewEquivocationDetector returns a detector without any recorded rounds.
+func NewEquivocationDetector() *EquivocationDetector {
+	return &EquivocationDetector{signed: make(map[string]roundSignature)}
+}
+
+// Record stores the signature of the data of the round. If another message
+// has already been signed for this round, it returns the evidence, else nil.
+// Signatures whose message is not RoundMessage(round, data) are ignored.
+// Signatures must be verified by the caller.
+func (d *EquivocationDetector) Record(round, data []byte, sig FinalSignature) *Evidence {
+	if sig.Sig == nil || !bytes.Equal(sig.Msg, RoundMessage(round, data)) {
+		return nil
+	}
+	d.Lock()
+	key := hex.EncodeToString(round)
+	first, ok := d.signed[key]
+	if !ok {
+		d.signed[key] = roundSignature{sig: sig, data: data}
+		d.rounds = append(d.rounds, key)
+		if len(d.rounds) > maxRounds {
+			delete(d.signed, d.rounds[0])
+			d.rounds = d.rounds[1:]
+		}
+		d.Unlock()
+		return nil
+	}
+	if bytes.Equal(first.sig.Msg, sig.Msg) {
+		d.Unlock()
+		return nil
+	}
+	e := &Evidence{Round: round, First: first.sig, Second: sig,
+		FirstData: first.data, SecondData: data}
+	d.evidence = append(d.evidence, e)
+	onEvidence := d.OnEvidence
+	d.Unlock()
+
+	if onEvidence != nil {
+		onEvidence(e)
+	}
+	return e
+}
+
+// Evidence returns all evidence collected so far.
+func (d *EquivocationDetector) Evidence() []*Evidence {
+	d.Lock()
+	defer d.Unlock()
+	return append([]*Evidence{}, d.evidence...)
+}
+
+// signed returns true if the i'th of n nodes is set in the mask at the end
+// of the signature. Both the ftcosi and the blscosi signatures end with it.
+func signed(sig []byte, n, i int) bool {
+	maskLen := (n + 7) / 8
+	if len(sig) < maskLen {
+		return false
+	}
+	mask := sig[len(sig)-maskLen:]
+	return mask[i/8]&(1<<uint(i%8)) != 0
+}
@@ -0,0 +1,110 @@
+package byzcoinx
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dedis/cothority/ftcosi/protocol"
+	"github.com/dedis/kyber/sign/cosi"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+)
+
+// DefaultSignerTimeout is the timeout of a Signer if none is given.
+const DefaultSignerTimeout = 20 * time.Second
+
+// Signer lets a service sign proposals with ByzCoinX without setting up the
+// protocol itself. The verification functions are registered once when the
+// Signer is created, then every call to SignProposal runs a new round with
+// this node as the leader.
+type Signer struct {
+	// Timeout is the time a round may take, it is split between the two
+	// phases. It must not be changed while signing.
+	Timeout time.Duration
+
+	context   *onet.Context
+	protoName string
+}
+
+// NewSigner registers the protocols of ByzCoinX with the given verification
+// functions to the context c and returns a Signer for them. protoName must
+// be unique in the service.
+func NewSigner(c *onet.Context, suite cosi.Suite, vf, ack protocol.VerificationFn,
+	protoName string) (*Signer, error) {
+	if err := InitBFTCoSiProtocol(suite, c, vf, ack, protoName); err != nil {
+		return nil, err
+	}
+	return &Signer{
+		Timeout:   DefaultSignerTimeout,
+		context:   c,
+		protoName: protoName,
+	}, nil
+}
+
+// SignProposal asks the nodes of the roster to sign msg. The nodes verify
+// msg together with data with the verification functions of the Signer.
+// This node must be part of the roster and is the leader of the round.
+func (s *Signer) SignProposal(roster *onet.Roster, msg, data []byte) (*FinalSignature, error) {
+	return s.Sign(roster, msg, data, s.Timeout)
+}
+
+// Sign is like SignProposal, but with the given timeout for this round.
+func (s *Signer) Sign(roster *onet.Roster, msg, data []byte, timeout time.Duration) (*FinalSignature, error) {
+	return s.SignSequence(roster, msg, data, timeout, nil, 0)
+}
+
+// SignSequence is like Sign, but the nodes refuse to sign if they already
+// signed a higher sequence than seq for the sequence ID id with this leader.
+func (s *Signer) SignSequence(roster *onet.Roster, msg, data []byte, timeout time.Duration,
+	id []byte, seq uint64) (*FinalSignature, error) {
+	if roster == nil || len(roster.List) == 0 {
+		return nil, errors.New("found empty Roster")
+	}
+
+	// The leader talks to every node directly.
+	bf := 2
+	if len(roster.List)-1 > 2 {
+		bf = len(roster.List) - 1
+	}
+	tree := roster.GenerateNaryTreeWithRoot(bf, s.context.ServerIdentity())
+	if tree == nil {
+		return nil, errors.New("couldn't form tree, is this node in the roster?")
+	}
+	pi, err := s.context.CreateProtocol(s.protoName, tree)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create new node: %s", err.Error())
+	}
+	root := pi.(*ByzCoinX)
+	root.Msg = msg
+	root.Data = data
+	root.CreateProtocol = s.context.CreateProtocol
+	root.FinalSignatureChan = make(chan FinalSignature, 1)
+	root.Timeout = timeout
+	root.Threshold = Threshold(len(tree.List()))
+	root.SequenceID = id
+	root.Sequence = seq
+
+	log.Lvl3(s.context.ServerIdentity(), "starts bft-cosi")
+	if err := root.Start(); err != nil {
+		log.Error("failed to start with error", err)
+		return nil, err
+	}
+
+	select {
+	case sig := <-root.FinalSignatureChan:
+		if sig.Sig == nil {
+			if refusals := root.Refusals(); len(refusals) > 0 {
+				return nil, fmt.Errorf("couldn't sign: %v", refusals)
+			}
+			return nil, errors.New("couldn't sign")
+		}
+		log.Lvl3(s.context.ServerIdentity(), "bft-cosi done")
+		if skipped := root.SkippedNodes(); len(skipped) > 0 {
+			log.Lvl2(s.context.ServerIdentity(), "nodes didn't respond as sub-leaders:", skipped)
+		}
+		return &sig, nil
+	case <-time.After(root.TotalTimeout() * 2):
+		return nil, errors.New("timed out while waiting for signature")
+	}
+}
@@ -20,14 +20,20 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"path"
 	"reflect"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/ftcosi/check"
 	_ "github.com/dedis/cothority/ftcosi/service"
 	_ "github.com/dedis/cothority/identity"
+	"github.com/dedis/cothority/metrics"
+	"github.com/dedis/cothority/rpc"
 	_ "github.com/dedis/cothority/skipchain"
 	_ "github.com/dedis/cothority/status/service"
 	"github.com/dedis/kyber/util/encoding"
@@ -36,6 +42,8 @@ import (
 	"github.com/dedis/onet/cfgpath"
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -87,6 +95,29 @@ func main() {
 			Name:   "server",
 			Usage:  "Start cothority server",
 			Action: runServer,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "grpc",
+					Usage: "also serve the skipchain and omniledger APIs over gRPC on this address, which must be a loopback address without TLS",
+				},
+				cli.StringFlag{
+					Name:  "grpc-cert",
+					Usage: "PEM file with the TLS certificate of the gRPC APIs",
+				},
+				cli.StringFlag{
+					Name:  "grpc-key",
+					Usage: "PEM file with the TLS key of the gRPC APIs",
+				},
+				cli.DurationFlag{
+					Name:  "shutdown-timeout",
+					Value: 30 * time.Second,
+					Usage: "how long to wait for the pending transactions on SIGINT or SIGTERM",
+				},
+				cli.BoolFlag{
+					Name:  "log-json",
+					Usage: "write the messages of the omniledger transactions as JSON",
+				},
+			},
 		},
 		{
 			Name:      "check",
@@ -145,7 +176,67 @@ func main() {
 func runServer(ctx *cli.Context) error {
 	// first check the options
 	config := ctx.GlobalString("config")
-	app.RunServer(config)
+	setLogJSON(ctx.Bool("log-json"))
+	_, server, err := app.ParseCothority(config)
+	if err != nil {
+		return err
+	}
+	var gs *grpc.Server
+	if grpcAddress := ctx.String("grpc"); grpcAddress != "" {
+		var creds credentials.TransportCredentials
+		if cert := ctx.String("grpc-cert"); cert != "" {
+			creds, err = credentials.NewServerTLSFromFile(cert, ctx.String("grpc-key"))
+			if err != nil {
+				return fmt.Errorf("couldn't load the TLS credentials of gRPC: %v", err)
+			}
+		}
+		if gs, err = rpc.Start(server, grpcAddress, creds); err != nil {
+			return err
+		}
+	}
+	if err := startMetrics(config); err != nil {
+		return err
+	}
+
+	// On SIGINT or SIGTERM the services finish their work before the
+	// server and its database are closed.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Info("Received", sig, "- shutting down")
+		if gs != nil {
+			gs.Stop()
+		}
+		shutdownServices(server, ctx.Duration("shutdown-timeout"))
+		log.ErrFatal(server.Close())
+	}()
+	server.Start()
+	return nil
+}
+
+// metricsConfig holds the options of the metrics listener. They are read
+// from the configuration file of the server, next to the options of onet.
+type metricsConfig struct {
+	// MetricsAddress is where the metrics are exported in the Prometheus
+	// format, e.g. "127.0.0.1:9100". If empty, they are not exported.
+	MetricsAddress string
+}
+
+// startMetrics exports the metrics of the conode if the configuration file
+// has a MetricsAddress.
+func startMetrics(config string) error {
+	var c metricsConfig
+	if _, err := toml.DecodeFile(config, &c); err != nil {
+		return fmt.Errorf("couldn't read the metrics config: %v", err)
+	}
+	if c.MetricsAddress == "" {
+		return nil
+	}
+	log.Info("Exporting the metrics on", c.MetricsAddress)
+	go func() {
+		log.ErrFatal(metrics.Serve(c.MetricsAddress))
+	}()
 	return nil
 }
 
@@ -6,9 +6,36 @@ stable branch.
 */
 
 import (
+	"time"
+
+	_ "github.com/dedis/cothority/dkg"
 	_ "github.com/dedis/cothority/eventlog"
 	_ "github.com/dedis/cothority/evoting/service"
 	_ "github.com/dedis/cothority/ocs/service"
+	_ "github.com/dedis/cothority/omniledger/calypso"
 	_ "github.com/dedis/cothority/omniledger/contracts"
-	_ "github.com/dedis/cothority/omniledger/service"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
 )
+
+// shutdownServices lets omniledger include the pending transactions in
+// its last blocks and stops the gossiping of the skipchains before the server
+// is closed.
+func shutdownServices(server *onet.Server, timeout time.Duration) {
+	if ol, ok := server.Service(omniledger.ServiceName).(*omniledger.Service); ok {
+		if err := ol.Shutdown(timeout); err != nil {
+			log.Error("omniledger shutdown:", err)
+		}
+	}
+	if sc, ok := server.Service(skipchain.ServiceName).(*skipchain.Service); ok {
+		sc.StopGossip()
+	}
+}
+
+// setLogJSON makes omniledger write the messages about its transactions and
+// blocks as JSON objects.
+func setLogJSON(on bool) {
+	omniledger.LogJSON = on
+}
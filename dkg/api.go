@@ -0,0 +1,56 @@
+package dkg
+
+import (
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// Client is a structure to communicate with the DKG service.
+type Client struct {
+	*onet.Client
+}
+
+// NewClient instantiates a new DKG client.
+func NewClient() *Client {
+	return &Client{Client: onet.NewClient(cothority.Suite, ServiceName)}
+}
+
+// Setup creates a new shared key with the ID id on the nodes of the roster.
+func (c *Client) Setup(roster *onet.Roster, id []byte, purpose string, data []byte) (*SetupReply, error) {
+	reply := &SetupReply{}
+	err := c.SendProtobuf(roster.List[0], &Setup{
+		Roster:  *roster,
+		ID:      id,
+		Purpose: purpose,
+		Data:    data,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetPublic asks dst for the shared public key and the roster of a key.
+func (c *Client) GetPublic(dst *network.ServerIdentity, id []byte) (*GetPublicReply, error) {
+	reply := &GetPublicReply{}
+	err := c.SendProtobuf(dst, &GetPublic{ID: id}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Reshare asks dst, a node holding a share of the key, to move the shares to
+// the nodes of newRoster.
+func (c *Client) Reshare(dst *network.ServerIdentity, id []byte, newRoster *onet.Roster) (*ReshareReply, error) {
+	reply := &ReshareReply{}
+	err := c.SendProtobuf(dst, &Reshare{
+		ID:        id,
+		NewRoster: *newRoster,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
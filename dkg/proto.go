@@ -0,0 +1,60 @@
+package dkg
+
+import (
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet"
+)
+
+// PROTOSTART
+// package dkg;
+// import "onet.proto";
+//
+// option java_package = "ch.epfl.dedis.proto";
+// option java_outer_classname = "DKGProto";
+
+// ***
+// These are the messages used in the API-calls
+// ***
+
+// Setup asks the nodes of the roster to run a distributed key generation for
+// a new shared key.
+type Setup struct {
+	Roster onet.Roster
+	// ID of the new shared key. It must not be used on any node of the
+	// roster.
+	ID []byte
+	// Purpose is the name of the service using the key. It decides with its
+	// ReshareVerifier whether the key can be reshared.
+	Purpose string
+	// Data is stored with the shares for the service using the key.
+	Data []byte
+}
+
+// SetupReply returns the shared public key.
+type SetupReply struct {
+	X kyber.Point
+}
+
+// GetPublic asks for the shared public key and the roster of a key.
+type GetPublic struct {
+	ID []byte
+}
+
+// GetPublicReply holds the shared public key and the roster of a key.
+type GetPublicReply struct {
+	X      kyber.Point
+	Roster onet.Roster
+}
+
+// Reshare asks the nodes holding the shares of a key to distribute new
+// shares of the same key to the nodes of NewRoster. The nodes that are not
+// in NewRoster drop their shares.
+type Reshare struct {
+	ID        []byte
+	NewRoster onet.Roster
+}
+
+// ReshareReply returns the shared public key, which doesn't change.
+type ReshareReply struct {
+	X kyber.Point
+}
@@ -0,0 +1,392 @@
+package dkg
+
+/*
+The reshare protocol moves a shared key to a new roster. Every node of the
+old roster shares its own share with a new random polynomial of the
+threshold of the new roster, and sends the evaluations, encrypted, to the new
+nodes. Once a new node got the deals of enough old nodes, it interpolates
+them to its new share. The shared public key doesn't change, so the secrets
+encrypted under it stay readable.
+*/
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/ocs/protocol"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/share"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// NameReshare can be used from other packages to refer to this protocol.
+const NameReshare = "DKGReshare"
+
+// reshareTimeout is how long the nodes wait for the resharing to finish.
+const reshareTimeout = time.Minute
+
+func init() {
+	network.RegisterMessages(&ReshareStart{}, &ReshareDeal{}, &ReshareDone{}, &ReshareCommit{})
+	onet.GlobalProtocolRegister(NameReshare, NewReshareProtocol)
+}
+
+// ReshareStart is sent by the root to all nodes of the old and the new
+// roster.
+type ReshareStart struct {
+	ID        []byte
+	OldRoster onet.Roster
+	NewRoster onet.Roster
+	// Commits of the polynomial of the old shares.
+	Commits []kyber.Point
+	Purpose string
+	Data    []byte
+}
+
+type structReshareStart struct {
+	*onet.TreeNode
+	ReshareStart
+}
+
+// ReshareDeal is sent by every old node to every new node.
+type ReshareDeal struct {
+	// Index of the sender in the old roster.
+	Index int
+	// Commits of the polynomial of the sender, which shares its old share.
+	Commits []kyber.Point
+	// Share is the evaluation of the polynomial at the index of the
+	// receiver, encrypted for the receiver.
+	Share []byte
+}
+
+type structReshareDeal struct {
+	*onet.TreeNode
+	ReshareDeal
+}
+
+// ReshareDone is sent by every new node to the root once it has its new
+// share.
+type ReshareDone struct {
+	OK bool
+}
+
+type structReshareDone struct {
+	*onet.TreeNode
+	ReshareDone
+}
+
+// ReshareCommit is sent by the root to all nodes once all new nodes have
+// their share.
+type ReshareCommit struct {
+	OK bool
+}
+
+type structReshareCommit struct {
+	*onet.TreeNode
+	ReshareCommit
+}
+
+// ReshareProtocol runs on a flat tree of all nodes of the old and the new
+// roster, with an old node as root. Before calling Start, the root must set
+// Request.
+type ReshareProtocol struct {
+	*onet.TreeNodeInstance
+	// Request is the resharing started by the root.
+	Request *ReshareStart
+	// Share of this node, or nil if the node is not in the old roster.
+	Share *protocol.SharedSecret
+	// Verify is called by every node before it takes part.
+	Verify func(*ReshareStart) bool
+	// NewShare is the share of this node once Finished returned true, or
+	// nil if the node is not in the new roster.
+	NewShare *protocol.SharedSecret
+	// Finished receives true once the new shares are committed.
+	Finished chan bool
+
+	mut     sync.Mutex
+	start   *ReshareStart
+	pending []structReshareDeal
+	deals   []*share.PriShare
+	commits [][]kyber.Point
+	dones   int
+	timeout *time.Timer
+	once    sync.Once
+}
+
+// NewReshareProtocol initialises the structure for use in one round.
+func NewReshareProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	p := &ReshareProtocol{
+		TreeNodeInstance: n,
+		Finished:         make(chan bool, 1),
+	}
+	err := p.RegisterHandlers(p.handleStart, p.handleDeal, p.handleDone, p.handleCommit)
+	if err != nil {
+		return nil, err
+	}
+	p.timeout = time.AfterFunc(reshareTimeout, func() {
+		log.Lvl1(p.ServerIdentity(), "reshare protocol timeout")
+		p.finish(false)
+	})
+	return p, nil
+}
+
+// Start sends the request to all nodes.
+func (p *ReshareProtocol) Start() error {
+	if p.Request == nil || p.Share == nil {
+		p.finish(false)
+		return errors.New("the root needs a request and a share")
+	}
+	errs := p.Broadcast(p.Request)
+	if len(errs) > 0 {
+		log.Errorf("Some nodes failed with error(s) %v", errs)
+	}
+	return p.handleStart(structReshareStart{p.TreeNode(), *p.Request})
+}
+
+func (p *ReshareProtocol) handleStart(msg structReshareStart) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	start := &msg.ReshareStart
+	if p.Verify == nil || !p.Verify(start) {
+		p.finish(false)
+		return errors.New("refusing to reshare")
+	}
+	p.start = start
+	if p.Share != nil {
+		if err := p.sendDeals(); err != nil {
+			return err
+		}
+	}
+	for _, d := range p.pending {
+		if err := p.addDeal(d); err != nil {
+			log.Error(p.ServerIdentity(), err)
+		}
+	}
+	p.pending = nil
+	return nil
+}
+
+// sendDeals shares the old share of this node with the new nodes.
+func (p *ReshareProtocol) sendDeals() error {
+	threshold := Threshold(len(p.start.NewRoster.List))
+	poly := share.NewPriPoly(cothority.Suite, threshold, p.Share.V, cothority.Suite.RandomStream())
+	_, commits := poly.Commit(nil).Info()
+	for j, si := range p.start.NewRoster.List {
+		buf, err := encryptScalar(dhKey(p.Private(), si.Public), poly.Eval(j).V)
+		if err != nil {
+			return err
+		}
+		deal := &ReshareDeal{
+			Index:   p.Share.Index,
+			Commits: commits,
+			Share:   buf,
+		}
+		tn := p.treeNode(si)
+		if tn == nil {
+			return errors.New("new node is not in the tree")
+		}
+		if tn.ID.Equal(p.TreeNode().ID) {
+			if err := p.addDeal(structReshareDeal{tn, *deal}); err != nil {
+				return err
+			}
+		} else if err := p.SendTo(tn, deal); err != nil {
+			log.Error(p.ServerIdentity(), "couldn't send deal:", err)
+		}
+	}
+	return nil
+}
+
+func (p *ReshareProtocol) handleDeal(msg structReshareDeal) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if p.start == nil {
+		p.pending = append(p.pending, msg)
+		return nil
+	}
+	return p.addDeal(msg)
+}
+
+// addDeal verifies a deal and computes the new share once enough deals
+// arrived.
+func (p *ReshareProtocol) addDeal(msg structReshareDeal) error {
+	oldThreshold := len(p.start.Commits)
+	if p.NewShare != nil || len(p.deals) >= oldThreshold {
+		return nil
+	}
+	index, _ := p.start.NewRoster.Search(p.ServerIdentity().ID)
+	if index < 0 {
+		return errors.New("got a deal but not in the new roster")
+	}
+	if msg.Index < 0 || msg.Index >= len(p.start.OldRoster.List) ||
+		!p.start.OldRoster.List[msg.Index].ID.Equal(msg.ServerIdentity.ID) {
+		return errors.New("deal from a wrong node")
+	}
+	if len(msg.Commits) != Threshold(len(p.start.NewRoster.List)) {
+		return errors.New("deal has wrong threshold")
+	}
+	oldPub := share.NewPubPoly(cothority.Suite, nil, p.start.Commits).Eval(msg.Index).V
+	if !msg.Commits[0].Equal(oldPub) {
+		return errors.New("deal doesn't share the old share of the sender")
+	}
+	v, err := decryptScalar(dhKey(p.Private(), msg.ServerIdentity.Public), msg.Share)
+	if err != nil {
+		return err
+	}
+	pub := share.NewPubPoly(cothority.Suite, nil, msg.Commits).Eval(index).V
+	if !cothority.Suite.Point().Mul(v, nil).Equal(pub) {
+		return errors.New("deal doesn't match its commits")
+	}
+	p.deals = append(p.deals, &share.PriShare{I: msg.Index, V: v})
+	p.commits = append(p.commits, msg.Commits)
+	if len(p.deals) < oldThreshold {
+		return nil
+	}
+
+	n := len(p.start.OldRoster.List)
+	newV, err := share.RecoverSecret(cothority.Suite, p.deals, oldThreshold, n)
+	if err != nil {
+		return err
+	}
+	newCommits := make([]kyber.Point, len(msg.Commits))
+	for k := range newCommits {
+		pubs := make([]*share.PubShare, len(p.deals))
+		for i, d := range p.deals {
+			pubs[i] = &share.PubShare{I: d.I, V: p.commits[i][k]}
+		}
+		newCommits[k], err = share.RecoverCommit(cothority.Suite, pubs, oldThreshold, n)
+		if err != nil {
+			return err
+		}
+	}
+	if !newCommits[0].Equal(p.start.Commits[0]) {
+		return errors.New("the shared key changed")
+	}
+	p.NewShare = &protocol.SharedSecret{
+		Index:   index,
+		V:       newV,
+		X:       newCommits[0],
+		Commits: newCommits,
+	}
+	if p.IsRoot() {
+		return p.addDone()
+	}
+	return p.SendToParent(&ReshareDone{OK: true})
+}
+
+func (p *ReshareProtocol) handleDone(msg structReshareDone) error {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if !msg.OK {
+		p.finish(false)
+		return nil
+	}
+	return p.addDone()
+}
+
+// addDone counts the new nodes that have their share, and commits the new
+// shares once all of them are done.
+func (p *ReshareProtocol) addDone() error {
+	p.dones++
+	if p.dones < len(p.start.NewRoster.List) {
+		return nil
+	}
+	errs := p.Broadcast(&ReshareCommit{OK: true})
+	if len(errs) > 0 {
+		log.Errorf("Some nodes failed with error(s) %v", errs)
+	}
+	p.finish(true)
+	return nil
+}
+
+func (p *ReshareProtocol) handleCommit(msg structReshareCommit) error {
+	p.finish(msg.OK)
+	return nil
+}
+
+// finish sends the result to Finished and ends the protocol, only once.
+func (p *ReshareProtocol) finish(ok bool) {
+	p.once.Do(func() {
+		p.timeout.Stop()
+		p.Finished <- ok
+		p.Done()
+	})
+}
+
+// treeNode returns the node of the tree of si.
+func (p *ReshareProtocol) treeNode(si *network.ServerIdentity) *onet.TreeNode {
+	for _, tn := range p.Tree().List() {
+		if tn.ServerIdentity.ID.Equal(si.ID) {
+			return tn
+		}
+	}
+	return nil
+}
+
+// Threshold returns how many of n nodes are needed to use a shared key.
+func Threshold(n int) int {
+	return n - (n-1)/3
+}
+
+// dhKey returns the symmetric key shared between the owner of priv and the
+// owner of pub.
+func dhKey(priv kyber.Scalar, pub kyber.Point) []byte {
+	buf, err := cothority.Suite.Point().Mul(priv, pub).MarshalBinary()
+	if err != nil {
+		log.Error(err)
+	}
+	key := sha256.Sum256(buf)
+	return key[:]
+}
+
+// encryptScalar encrypts v with the symmetric key using AES-GCM.
+func encryptScalar(key []byte, v kyber.Scalar) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := v.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, buf, nil), nil
+}
+
+// decryptScalar decrypts a scalar encrypted with encryptScalar.
+func decryptScalar(key []byte, buf []byte) (kyber.Scalar, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < aead.NonceSize() {
+		return nil, errors.New("encrypted scalar is too short")
+	}
+	plain, err := aead.Open(nil, buf[:aead.NonceSize()], buf[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt scalar: %v", err)
+	}
+	v := cothority.Suite.Scalar()
+	if err := v.UnmarshalBinary(plain); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
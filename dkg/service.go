@@ -0,0 +1,438 @@
+// Package dkg runs distributed key generations among the nodes of a roster.
+// Every node keeps its share of the private key, encrypted with its own
+// private key, and the shared public key can be used by other services, like
+// Calypso. When the roster changes, the shares can be moved to a new roster
+// without changing the shared public key, if the service using the key
+// agrees.
+package dkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/ocs/protocol"
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// ServiceName is used for registration on the onet.
+const ServiceName = "DKG"
+
+// setupTimeout is how long Setup waits for the DKG to finish.
+const setupTimeout = 10 * time.Second
+
+var dkgID onet.ServiceID
+var storageKey = []byte("storage")
+
+func init() {
+	network.RegisterMessages(
+		&storage{},
+		&Setup{}, &SetupReply{},
+		&GetPublic{}, &GetPublicReply{},
+		&Reshare{}, &ReshareReply{},
+	)
+	var err error
+	dkgID, err = onet.RegisterNewService(ServiceName, newService)
+	log.ErrFatal(err)
+}
+
+// ReshareVerifier is given the ID and the data of a shared key, and decides
+// whether it may be reshared to newRoster.
+type ReshareVerifier func(id, data []byte, newRoster *onet.Roster) bool
+
+// Service holds the shares of this node.
+type Service struct {
+	// We need to embed the ServiceProcessor, so that incoming messages
+	// are correctly handled.
+	*onet.ServiceProcessor
+
+	// storageMutex protects access to the storage field.
+	storageMutex sync.Mutex
+	storage      *storage
+
+	verifiersMutex sync.Mutex
+	verifiers      map[string]ReshareVerifier
+}
+
+// storage holds the shared keys, indexed by their ID.
+type storage struct {
+	Keys map[string]*sharedKey
+}
+
+// sharedKey is the share of this node of a shared key. The private share is
+// only stored encrypted.
+type sharedKey struct {
+	Roster  onet.Roster
+	Purpose string
+	Data    []byte
+	Index   int
+	X       kyber.Point
+	Commits []kyber.Point
+	EncV    []byte
+}
+
+// Setup runs a distributed key generation among the nodes of the roster,
+// which must include this node.
+func (s *Service) Setup(req *Setup) (*SetupReply, error) {
+	if i, _ := req.Roster.Search(s.ServerIdentity().ID); i < 0 {
+		return nil, errors.New("this node is not in the roster")
+	}
+	if len(req.ID) == 0 {
+		return nil, errors.New("missing ID")
+	}
+	if s.hasKey(req.ID) {
+		return nil, errors.New("this ID is already used")
+	}
+	confBuf, err := protobuf.Encode(req)
+	if err != nil {
+		return nil, err
+	}
+	log.Lvlf2("%s: Setting up shared key %x", s.ServerIdentity(), req.ID)
+
+	tree := req.Roster.GenerateNaryTreeWithRoot(len(req.Roster.List), s.ServerIdentity())
+	pi, err := s.CreateProtocol(protocol.NameDKG, tree)
+	if err != nil {
+		return nil, err
+	}
+	setupDKG := pi.(*protocol.SetupDKG)
+	setupDKG.Wait = true
+	setupDKG.SetConfig(&onet.GenericConfig{Data: confBuf})
+	if err := pi.Start(); err != nil {
+		return nil, err
+	}
+	select {
+	case <-setupDKG.SetupDone:
+	case <-time.After(setupTimeout):
+		return nil, errors.New("dkg didn't finish in time")
+	}
+	shared, err := setupDKG.SharedSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storeKey(req.ID, &req.Roster, req.Purpose, req.Data, shared); err != nil {
+		return nil, err
+	}
+	return &SetupReply{X: shared.X}, nil
+}
+
+// GetPublic returns the shared public key and the roster of a key.
+func (s *Service) GetPublic(req *GetPublic) (*GetPublicReply, error) {
+	k, err := s.getKey(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetPublicReply{
+		X:      k.X,
+		Roster: k.Roster,
+	}, nil
+}
+
+// Reshare moves the shares of a key to the nodes of req.NewRoster. This node
+// must hold a share of the key, and the ReshareVerifier of the purpose of the
+// key must accept the new roster on every node.
+func (s *Service) Reshare(req *Reshare) (*ReshareReply, error) {
+	k, err := s.getKey(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := s.decryptShare(k)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.NewRoster.List) == 0 {
+		return nil, errors.New("empty roster")
+	}
+	log.Lvlf2("%s: Resharing key %x", s.ServerIdentity(), req.ID)
+
+	list := []*network.ServerIdentity{s.ServerIdentity()}
+	for _, si := range append(k.Roster.List, req.NewRoster.List...) {
+		if i, _ := onet.NewRoster(list).Search(si.ID); i < 0 {
+			list = append(list, si)
+		}
+	}
+	all := onet.NewRoster(list)
+	tree := all.GenerateNaryTreeWithRoot(len(all.List), s.ServerIdentity())
+	pi, err := s.CreateProtocol(NameReshare, tree)
+	if err != nil {
+		return nil, err
+	}
+	reshare := pi.(*ReshareProtocol)
+	reshare.Share = shared
+	reshare.Verify = s.verifyReshare
+	reshare.Request = &ReshareStart{
+		ID:        req.ID,
+		OldRoster: k.Roster,
+		NewRoster: req.NewRoster,
+		Commits:   k.Commits,
+		Purpose:   k.Purpose,
+		Data:      k.Data,
+	}
+	reshare.SetConfig(&onet.GenericConfig{Data: req.ID})
+	if err := reshare.Start(); err != nil {
+		return nil, err
+	}
+	if err := s.finishReshare(reshare); err != nil {
+		return nil, err
+	}
+	return &ReshareReply{X: k.X}, nil
+}
+
+// RegisterReshareVerifier sets the verifier for the keys of a purpose. A key
+// whose purpose has no verifier can't be reshared.
+func (s *Service) RegisterReshareVerifier(purpose string, v ReshareVerifier) {
+	s.verifiersMutex.Lock()
+	defer s.verifiersMutex.Unlock()
+	s.verifiers[purpose] = v
+}
+
+// GetShare returns the roster, the data and the share of this node of a key,
+// for the services using it.
+func (s *Service) GetShare(id []byte) (*onet.Roster, []byte, *protocol.SharedSecret, error) {
+	k, err := s.getKey(id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	shared, err := s.decryptShare(k)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return &k.Roster, k.Data, shared, nil
+}
+
+// verifyReshare is called by every node before it takes part in a
+// resharing. The nodes of the old roster check that the request is for the
+// key they hold, and all nodes ask the verifier of the purpose of the key.
+func (s *Service) verifyReshare(start *ReshareStart) bool {
+	err := func() error {
+		if k, err := s.getKey(start.ID); err == nil {
+			if !k.Roster.ID.Equal(start.OldRoster.ID) {
+				return errors.New("wrong old roster")
+			}
+			if k.Purpose != start.Purpose || !bytes.Equal(k.Data, start.Data) {
+				return errors.New("wrong purpose or data")
+			}
+			if len(k.Commits) != len(start.Commits) {
+				return errors.New("wrong commits")
+			}
+			for i, c := range k.Commits {
+				if !c.Equal(start.Commits[i]) {
+					return errors.New("wrong commits")
+				}
+			}
+		} else if i, _ := start.OldRoster.Search(s.ServerIdentity().ID); i >= 0 {
+			return errors.New("unknown key")
+		}
+		s.verifiersMutex.Lock()
+		v, ok := s.verifiers[start.Purpose]
+		s.verifiersMutex.Unlock()
+		if !ok {
+			return fmt.Errorf("no verifier for purpose %s", start.Purpose)
+		}
+		if !v(start.ID, start.Data, &start.NewRoster) {
+			return errors.New("verifier refused new roster")
+		}
+		return nil
+	}()
+	if err != nil {
+		log.Lvl2(s.ServerIdentity(), "refusing to reshare:", err)
+		return false
+	}
+	return true
+}
+
+// finishReshare waits for the resharing to end and stores the new share of
+// this node, or deletes the key if this node is not in the new roster.
+func (s *Service) finishReshare(p *ReshareProtocol) error {
+	if !<-p.Finished {
+		return errors.New("resharing failed")
+	}
+	p.mut.Lock()
+	start, newShare := p.start, p.NewShare
+	p.mut.Unlock()
+	if start == nil {
+		return errors.New("resharing finished without request")
+	}
+	if newShare == nil {
+		return s.deleteKey(start.ID)
+	}
+	return s.storeKey(start.ID, &start.NewRoster, start.Purpose, start.Data, newShare)
+}
+
+// NewProtocol intercepts the DKG and reshare protocols to store the new
+// shares of this node.
+func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfig) (onet.ProtocolInstance, error) {
+	switch tn.ProtocolName() {
+	case protocol.NameDKG:
+		var req Setup
+		if err := protobuf.Decode(conf.Data, &req); err != nil {
+			return nil, err
+		}
+		if s.hasKey(req.ID) {
+			return nil, errors.New("this ID is already used")
+		}
+		pi, err := protocol.NewSetupDKG(tn)
+		if err != nil {
+			return nil, err
+		}
+		setupDKG := pi.(*protocol.SetupDKG)
+		go func() {
+			<-setupDKG.SetupDone
+			shared, err := setupDKG.SharedSecret()
+			if err != nil {
+				log.Error(err)
+				return
+			}
+			if err := s.storeKey(req.ID, tn.Roster(), req.Purpose, req.Data, shared); err != nil {
+				log.Error(err)
+			}
+		}()
+		return pi, nil
+	case NameReshare:
+		pi, err := NewReshareProtocol(tn)
+		if err != nil {
+			return nil, err
+		}
+		reshare := pi.(*ReshareProtocol)
+		if k, err := s.getKey(conf.Data); err == nil {
+			reshare.Share, err = s.decryptShare(k)
+			if err != nil {
+				return nil, err
+			}
+		}
+		reshare.Verify = s.verifyReshare
+		go func() {
+			if err := s.finishReshare(reshare); err != nil {
+				log.Error(s.ServerIdentity(), err)
+			}
+		}()
+		return reshare, nil
+	}
+	return nil, nil
+}
+
+// storageSecret returns the symmetric key used to encrypt the shares at
+// rest. It is derived from the private key of this node.
+func (s *Service) storageSecret() ([]byte, error) {
+	tree := onet.NewRoster([]*network.ServerIdentity{s.ServerIdentity()}).GenerateBinaryTree()
+	tni := s.NewTreeNodeInstance(tree, tree.Root, "dummy")
+	buf, err := tni.Private().MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	secret := sha256.Sum256(append([]byte("dkg storage"), buf...))
+	return secret[:], nil
+}
+
+func (s *Service) decryptShare(k *sharedKey) (*protocol.SharedSecret, error) {
+	secret, err := s.storageSecret()
+	if err != nil {
+		return nil, err
+	}
+	v, err := decryptScalar(secret, k.EncV)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.SharedSecret{
+		Index:   k.Index,
+		V:       v,
+		X:       k.X,
+		Commits: k.Commits,
+	}, nil
+}
+
+func (s *Service) hasKey(id []byte) bool {
+	_, err := s.getKey(id)
+	return err == nil
+}
+
+func (s *Service) getKey(id []byte) (*sharedKey, error) {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	k, ok := s.storage.Keys[string(id)]
+	if !ok {
+		return nil, errors.New("unknown key")
+	}
+	return k, nil
+}
+
+// storeKey saves the share of this node of a key.
+func (s *Service) storeKey(id []byte, roster *onet.Roster, purpose string, data []byte,
+	shared *protocol.SharedSecret) error {
+	secret, err := s.storageSecret()
+	if err != nil {
+		return err
+	}
+	encV, err := encryptScalar(secret, shared.V)
+	if err != nil {
+		return err
+	}
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	s.storage.Keys[string(id)] = &sharedKey{
+		Roster:  *roster,
+		Purpose: purpose,
+		Data:    data,
+		Index:   shared.Index,
+		X:       shared.X,
+		Commits: shared.Commits,
+		EncV:    encV,
+	}
+	return s.Save(storageKey, s.storage)
+}
+
+// deleteKey removes the share of this node of a key.
+func (s *Service) deleteKey(id []byte) error {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	delete(s.storage.Keys, string(id))
+	return s.Save(storageKey, s.storage)
+}
+
+// tryLoad loads the shares of this node, if they have been saved before.
+func (s *Service) tryLoad() error {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	defer func() {
+		if s.storage.Keys == nil {
+			s.storage.Keys = make(map[string]*sharedKey)
+		}
+	}()
+	msg, err := s.Load(storageKey)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		return nil
+	}
+	var ok bool
+	s.storage, ok = msg.(*storage)
+	if !ok {
+		return errors.New("data of wrong type")
+	}
+	return nil
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+		storage:          &storage{},
+		verifiers:        make(map[string]ReshareVerifier),
+	}
+	if err := s.RegisterHandlers(s.Setup, s.GetPublic, s.Reshare); err != nil {
+		log.Error("Couldn't register messages", err)
+		return nil, err
+	}
+	if err := s.tryLoad(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return s, nil
+}
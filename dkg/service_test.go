@@ -0,0 +1,82 @@
+package dkg
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/kyber/share"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestService_Reshare(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	hosts, roster, _ := local.GenTree(5, true)
+	services := local.GetServices(hosts, dkgID)
+	oldRoster := onet.NewRoster(roster.List[:4])
+	newRoster := onet.NewRoster(roster.List[1:])
+	for _, s := range services {
+		s.(*Service).RegisterReshareVerifier("test", func(id, data []byte, r *onet.Roster) bool {
+			return string(data) == "data" && r.ID.Equal(newRoster.ID)
+		})
+	}
+
+	cl := NewClient()
+	id := []byte("key")
+	setup, err := cl.Setup(oldRoster, id, "test", []byte("data"))
+	require.Nil(t, err)
+	_, err = cl.Setup(oldRoster, id, "test", []byte("data"))
+	require.NotNil(t, err)
+	pub, err := cl.GetPublic(roster.List[2], id)
+	require.Nil(t, err)
+	require.True(t, pub.X.Equal(setup.X))
+	require.True(t, pub.Roster.ID.Equal(oldRoster.ID))
+
+	// The verifier only accepts the new roster.
+	_, err = cl.Reshare(roster.List[0], id, onet.NewRoster(roster.List[:3]))
+	require.NotNil(t, err)
+
+	reply, err := cl.Reshare(roster.List[0], id, newRoster)
+	require.Nil(t, err)
+	require.True(t, reply.X.Equal(setup.X))
+
+	// The old node dropped its share, and the new shares still hold the
+	// same secret.
+	_, err = cl.GetPublic(roster.List[0], id)
+	require.NotNil(t, err)
+	var shares []*share.PriShare
+	for _, s := range services[1:] {
+		r, data, shared, err := s.(*Service).GetShare(id)
+		require.Nil(t, err)
+		require.True(t, r.ID.Equal(newRoster.ID))
+		require.Equal(t, []byte("data"), data)
+		require.True(t, shared.X.Equal(setup.X))
+		shares = append(shares, &share.PriShare{I: shared.Index, V: shared.V})
+	}
+	secret, err := share.RecoverSecret(cothority.Suite, shares, Threshold(4), 4)
+	require.Nil(t, err)
+	require.True(t, cothority.Suite.Point().Mul(secret, nil).Equal(setup.X))
+}
+
+func TestService_ReshareNoVerifier(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	_, roster, _ := local.GenTree(4, true)
+	cl := NewClient()
+	id := []byte("key")
+	_, err := cl.Setup(roster, id, "unknown", nil)
+	require.Nil(t, err)
+	_, err = cl.Reshare(roster.List[0], id, onet.NewRoster(roster.List[1:]))
+	require.NotNil(t, err)
+	pub, err := cl.GetPublic(roster.List[0], id)
+	require.Nil(t, err)
+	require.True(t, pub.Roster.ID.Equal(roster.ID))
+}
@@ -3,11 +3,13 @@ package eventlog
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/dedis/cothority/omniledger/darc"
 	"github.com/dedis/cothority/omniledger/darc/expression"
 	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
 	"github.com/dedis/protobuf"
 
 	"github.com/dedis/cothority"
@@ -55,7 +57,7 @@ func (c *Client) Create(d darc.ID) error {
 		Length: 1,
 		Spawn:  &omniledger.Spawn{ContractID: contractName},
 	}
-	if err := instr.SignBy(c.Signers...); err != nil {
+	if err := instr.SignWith(c.OmniLedger.ID, c.Signers...); err != nil {
 		return err
 	}
 	tx := omniledger.ClientTransaction{
@@ -178,7 +180,7 @@ func makeTx(eventlogID omniledger.InstanceID, msgs []Event, signers []darc.Signe
 	for i := range tx.Instructions {
 		darcSigs := make([]darc.Signature, len(signers))
 		for j, signer := range signers {
-			dr, err := tx.Instructions[i].ToDarcRequest()
+			dr, err := tx.Instructions[i].ToDarcRequest(nil)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -198,6 +200,37 @@ func makeTx(eventlogID omniledger.InstanceID, msgs []Event, signers []darc.Signe
 	return &tx, keys, nil
 }
 
+// VerifyProofs checks that every event of the response has a valid proof of
+// inclusion in the skipchain scID. The search must have asked for proofs.
+func (r *SearchResponse) VerifyProofs(scID skipchain.SkipBlockID) error {
+	if len(r.Proofs) != len(r.Events) {
+		return errors.New("missing proofs")
+	}
+	for i, pr := range r.Proofs {
+		if err := pr.Verify(scID); err != nil {
+			return fmt.Errorf("proof of event %d: %v", i, err)
+		}
+		if !pr.InclusionProof.Match() {
+			return fmt.Errorf("event %d is not in the proof", i)
+		}
+		_, vs, err := pr.KeyValue()
+		if err != nil {
+			return err
+		}
+		if len(vs) < 2 || string(vs[1]) != contractName {
+			return fmt.Errorf("proof of event %d is not an event", i)
+		}
+		var e Event
+		if err := protobuf.Decode(vs[0], &e); err != nil {
+			return err
+		}
+		if e != r.Events[i] {
+			return fmt.Errorf("event %d doesn't match its proof", i)
+		}
+	}
+	return nil
+}
+
 // Search executes a search on the filter in req. See the definition of
 // type SearchRequest for additional details about how the filter is interpreted.
 // The ID field of the SearchRequest will be filled in from c, if it is null.
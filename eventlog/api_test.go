@@ -264,6 +264,17 @@ func TestClient_Search(t *testing.T) {
 	require.NotNil(t, resp)
 	require.False(t, resp.Truncated)
 	require.Equal(t, 3, len(resp.Events))
+	require.NotNil(t, resp.VerifyProofs(c.OmniLedger.ID))
+
+	// The same search with proofs.
+	req.Proofs = true
+	resp, err = c.Search(req)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(resp.Events))
+	require.Equal(t, 3, len(resp.Proofs))
+	require.Nil(t, resp.VerifyProofs(c.OmniLedger.ID))
+	resp.Events[0].Content = "tampered"
+	require.NotNil(t, resp.VerifyProofs(c.OmniLedger.ID))
 
 	// Cause truncation.
 	sm := searchMax
@@ -52,6 +52,8 @@ type SearchRequest struct {
 	From int64
 	// Return events where When is <= To.
 	To int64
+	// Return an inclusion proof for every event, if Proofs is true.
+	Proofs bool `protobuf:"opt"`
 }
 
 // SearchResponse is the reply to LogRequest.
@@ -61,6 +63,8 @@ type SearchResponse struct {
 	// a new SearchRequest to continue searching, for instance by setting
 	// From to the time of the last received event.
 	Truncated bool
+	// Proofs of the events, in the same order, if they have been asked for.
+	Proofs []omniledger.Proof `protobuf:"opt"`
 }
 
 // Event is sent to create an event log. When should be set using the UnixNano() method
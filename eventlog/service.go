@@ -47,7 +47,8 @@ func (s *Service) waitForBlock(scID skipchain.SkipBlockID) {
 // This should be a const, but we want to be able to hack it from tests.
 var searchMax = 10000
 
-// Search will search the event log for matching entries.
+// Search will search the event log for matching entries. If req.Proofs is
+// set, every event comes with the proof that it is stored in the skipchain.
 func (s *Service) Search(req *SearchRequest) (*SearchResponse, error) {
 	if req.ID.IsNull() {
 		return nil, errors.New("skipchain ID required")
@@ -124,6 +125,17 @@ filter:
 			if req.From <= ev.When && ev.When < req.To {
 				if req.Topic == "" || req.Topic == ev.Topic {
 					reply.Events = append(reply.Events, *ev)
+					if req.Proofs {
+						pr, err := s.omni.GetProof(&omniledger.GetProof{
+							Version: omniledger.CurrentVersion,
+							ID:      req.ID,
+							Key:     e,
+						})
+						if err != nil {
+							return nil, err
+						}
+						reply.Proofs = append(reply.Proofs, pr.Proof)
+					}
 					if len(reply.Events) >= searchMax {
 						reply.Truncated = true
 						break filter
@@ -333,7 +345,7 @@ func newService(c *onet.Context) (onet.Service, error) {
 		log.ErrFatal(err, "Couldn't register messages")
 	}
 
-	omniledger.RegisterContract(s, contractName, s.contractFunction)
+	omniledger.RegisterContract(s, contractName, omniledger.OmniLedgerContract(s.contractFunction))
 	return s, nil
 }
 
@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"strconv"
+
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/proof"
 	"github.com/dedis/kyber/share/dkg/rabin"
@@ -9,17 +11,27 @@ import (
 	"github.com/dedis/onet/network"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
 )
 
 // Ballot represents an encrypted vote.
 type Ballot struct {
-	User uint32 // User identifier.
+	User  uint32         // User identifier.
+	Voter *darc.Identity // Voter is the identity authorized by the Voters darc of the election; optional.
 
 	// ElGamal ciphertext pair.
 	Alpha kyber.Point
 	Beta  kyber.Point
 }
 
+// voter returns a string that identifies the voter of the ballot.
+func (b *Ballot) voter() string {
+	if b.Voter != nil {
+		return b.Voter.String()
+	}
+	return strconv.Itoa(int(b.User))
+}
+
 // Box is a wrapper around a list of encrypted ballots.
 type Box struct {
 	Ballots []*Ballot
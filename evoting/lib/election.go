@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
 
@@ -8,9 +9,13 @@ import (
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/network"
 
+	"github.com/dedis/cothority/omniledger/darc"
 	"github.com/dedis/cothority/skipchain"
 )
 
+// CastAction is the action of the Voters darc that authorizes the voters.
+const CastAction = darc.Action("cast")
+
 // ElectionState is the type for storing the stage of Election.
 type ElectionState uint32
 
@@ -34,6 +39,7 @@ type Election struct {
 	Name    map[string]string // Name of the election. lang-code, value pair
 	Creator uint32            // Creator is the election responsible.
 	Users   []uint32          // Users is the list of registered voters.
+	Voters  *darc.Darc        // Voters authorizes the voters with its "cast" rule instead of Users; optional.
 
 	ID        skipchain.SkipBlockID // ID is the hash of the genesis block.
 	Master    skipchain.SkipBlockID // Master is the hash of the master skipchain.
@@ -184,12 +190,13 @@ func (e *Election) Box(s *skipchain.Service) (*Box, error) {
 	}
 
 	// Only keep last casted ballot per user
-	mapping := make(map[uint32]bool)
+	mapping := make(map[string]bool)
 	unique := make([]*Ballot, 0)
 	for _, ballot := range ballots {
-		if _, found := mapping[ballot.User]; !found {
+		voter := ballot.voter()
+		if _, found := mapping[voter]; !found {
 			unique = append(unique, ballot)
-			mapping[ballot.User] = true
+			mapping[voter] = true
 		}
 	}
 
@@ -301,6 +308,55 @@ func (e *Election) IsUser(user uint32) bool {
 	return false
 }
 
+// castRequest returns the darc request with which the voter of the ballot
+// authorizes it through the Voters darc.
+func (e *Election) castRequest(ballot *Ballot, signature []byte) (*darc.Request, error) {
+	if e.Voters == nil {
+		return nil, errors.New("election has no voters darc")
+	}
+	if ballot.Voter == nil {
+		return nil, errors.New("ballot has no voter")
+	}
+	h := sha256.New()
+	h.Write(e.ID)
+	if _, err := ballot.Alpha.MarshalTo(h); err != nil {
+		return nil, err
+	}
+	if _, err := ballot.Beta.MarshalTo(h); err != nil {
+		return nil, err
+	}
+	req := darc.InitRequest(e.Voters.GetBaseID(), CastAction, h.Sum(nil),
+		[]darc.Identity{*ballot.Voter}, [][]byte{signature})
+	return &req, nil
+}
+
+// SignBallot sets the voter of the ballot to the identity of the signer and
+// returns the signature that authorizes the ballot through the Voters darc.
+func (e *Election) SignBallot(ballot *Ballot, signer darc.Signer) ([]byte, error) {
+	id := signer.Identity()
+	ballot.Voter = &id
+	req, err := e.castRequest(ballot, nil)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(req.Hash())
+}
+
+// VerifyVoter checks that the voter of the ballot is allowed to cast it by
+// the Voters darc, and that the signature is correct. Delegations can only
+// be resolved through the VerificationDarcs of the Voters darc.
+func (e *Election) VerifyVoter(ballot *Ballot, signature []byte) error {
+	req, err := e.castRequest(ballot, signature)
+	if err != nil {
+		return err
+	}
+	if ballot.Voter.PoP != nil {
+		// Only omniledger knows which pop-tokens have been issued.
+		return errors.New("pop-token voters are not supported")
+	}
+	return req.VerifyWithCB(e.Voters, darc.DarcsToGetDarcs(e.Voters.VerificationDarcs))
+}
+
 // IsCreator checks if a given user is the creator of the election.
 func (e *Election) IsCreator(user uint32) bool {
 	return user == e.Creator
@@ -3,6 +3,10 @@ package lib
 import (
 	"testing"
 
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/kyber/util/key"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,3 +21,30 @@ func TestIsCreator(t *testing.T) {
 	assert.True(t, e.IsCreator(0))
 	assert.False(t, e.IsCreator(1))
 }
+
+func TestVerifyVoter(t *testing.T) {
+	voter := darc.NewSignerEd25519(nil, nil)
+	rules := darc.InitRules([]darc.Identity{voter.Identity()}, nil)
+	assert.Nil(t, rules.AddRule(CastAction, expression.InitOrExpr(voter.Identity().String())))
+	e := &Election{ID: []byte("election"), Voters: darc.NewDarc(rules, []byte("voters"))}
+
+	kp := key.NewKeyPair(cothority.Suite)
+	alpha, beta := Encrypt(kp.Public, []byte{1, 2, 3})
+	ballot := &Ballot{Alpha: alpha, Beta: beta}
+	sig, err := e.SignBallot(ballot, voter)
+	assert.Nil(t, err)
+	assert.Nil(t, e.VerifyVoter(ballot, sig))
+
+	// The signature is bound to the ballot and the election.
+	ballot.Alpha, ballot.Beta = beta, alpha
+	assert.NotNil(t, e.VerifyVoter(ballot, sig))
+	ballot.Alpha, ballot.Beta = alpha, beta
+	e.ID = []byte("other election")
+	assert.NotNil(t, e.VerifyVoter(ballot, sig))
+
+	// Only the voters in the cast rule are allowed.
+	other := darc.NewSignerEd25519(nil, nil)
+	sig, err = e.SignBallot(ballot, other)
+	assert.Nil(t, err)
+	assert.NotNil(t, e.VerifyVoter(ballot, sig))
+}
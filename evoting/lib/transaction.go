@@ -162,6 +162,9 @@ func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service
 		if election.End < time.Now().Unix() {
 			return errors.New("open error: invalid end date")
 		}
+		if election.Voters != nil && !election.Voters.Rules.Contains(CastAction) {
+			return errors.New("open error: voters darc has no cast rule")
+		}
 
 		master, err := GetMaster(s, election.Master)
 		if err != nil {
@@ -176,15 +179,26 @@ func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service
 		if err != nil {
 			return err
 		}
-		err = schnorr.Verify(cothority.Suite, election.MasterKey, digest, t.Signature)
-		if err != nil {
-			return err
-		}
+		if election.Voters != nil {
+			// The voter signs the ballot, and the darc tells whether
+			// it is allowed to vote.
+			if err = election.VerifyVoter(t.Ballot, t.Signature); err != nil {
+				return errors.New("cast error: " + err.Error())
+			}
+		} else {
+			err = schnorr.Verify(cothority.Suite, election.MasterKey, digest, t.Signature)
+			if err != nil {
+				return err
+			}
 
-		// t.User is trusted at this point, so make sure that they did not try to sneak
-		// through a different user-id in the ballot.
-		if t.User != t.Ballot.User {
-			return errors.New("ballot user-id differs from transaction user-id")
+			// t.User is trusted at this point, so make sure that they did not try to sneak
+			// through a different user-id in the ballot.
+			if t.User != t.Ballot.User {
+				return errors.New("ballot user-id differs from transaction user-id")
+			}
+			if t.Ballot.Voter != nil {
+				return errors.New("cast error: election has no voters darc")
+			}
 		}
 
 		latest, err := s.GetDB().GetLatest(s.GetDB().GetByID(election.ID))
@@ -194,7 +208,7 @@ func (t *Transaction) Verify(genesis skipchain.SkipBlockID, s *skipchain.Service
 		}
 		if transaction.Mix != nil || transaction.Partial != nil {
 			return errors.New("cast error: election not in running stage")
-		} else if !election.IsUser(t.User) {
+		} else if election.Voters == nil && !election.IsUser(t.User) {
 			return errors.New("cast error: user not part")
 		}
 		return nil
@@ -0,0 +1,25 @@
+// Protogen writes the .proto files of external/proto from the Go structures
+// of the messages, so that the clients in other languages can be generated
+// from them. It is run by proto.sh in the root of the repository.
+//
+// The test of this package fails if a .proto file is not up to date.
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/dedis/onet/log"
+)
+
+func main() {
+	srcs, err := sources(".")
+	log.ErrFatal(err)
+	for _, src := range srcs {
+		proto, err := generate(src)
+		log.ErrFatal(err)
+		path := filepath.Join("external", "proto", src.Proto)
+		log.Info(src.Files[0], "=>", path)
+		log.ErrFatal(ioutil.WriteFile(path, []byte(proto), 0644))
+	}
+}
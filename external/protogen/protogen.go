@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// source describes how a .proto file in external/proto is generated from the
+// Go structures of a package.
+type source struct {
+	// Files are the Go files holding the structures. If Messages is empty,
+	// the first file must have a PROTOSTART comment, and every structure
+	// after it becomes a message.
+	Files []string
+	// Proto is the name of the file in external/proto.
+	Proto string
+	// Header is written after the syntax line if Messages is set.
+	Header string
+	// Messages are the structures to write, in that order.
+	Messages []string
+	// Rename maps the name of a structure to the name of its message.
+	Rename map[string]string
+	// Types replaces Go types by proto types, like the "// type :go:proto"
+	// lines of the PROTOSTART comment.
+	Types [][2]string
+	// Fields overrides the "label type name" of a field, indexed by
+	// "Structure.Field".
+	Fields map[string]string
+}
+
+// builtinTypes are replaced before the Types of the source.
+var builtinTypes = map[string]string{
+	"[]byte":         "bytes",
+	"abstract.Point": "bytes",
+	"StateAction":    "int",
+	"SubID":          "bytes",
+	"Nonce":          "bytes",
+	"Version":        "sint32",
+}
+
+// scalarTypes are the types whose repeated fields are packed by the protobuf
+// library of onet.
+var scalarTypes = map[string]bool{
+	"sint32": true, "sint64": true, "int32": true, "int64": true,
+	"uint32": true, "uint64": true, "bool": true, "double": true,
+	"float": true,
+}
+
+var (
+	reStruct   = regexp.MustCompile(`^type\s+(\S+)\s+struct`)
+	reHidden   = regexp.MustCompile(`^[[:blank:]]*[[:lower:]]`)
+	reComment  = regexp.MustCompile(`[[:blank:]]*//[[:blank:]]*`)
+	reTrailing = regexp.MustCompile(`//.*`)
+	reArray    = regexp.MustCompile(`^\[.*\]byte$`)
+)
+
+// sources returns the proto.go files below root, which follow the PROTOSTART
+// convention, and the skipchain package.
+func sources(root string) ([]source, error) {
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == "node_modules" ||
+			(path != root && strings.HasPrefix(info.Name(), "."))) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && info.Name() == "proto.go" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var srcs []source
+	for _, f := range files {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		pkg := regexp.MustCompile(`// package\s+(\S+);`).FindSubmatch(buf)
+		if pkg == nil {
+			return nil, fmt.Errorf("%s has no package name", f)
+		}
+		srcs = append(srcs, source{Files: []string{f}, Proto: string(pkg[1]) + ".proto"})
+	}
+	sc := skipchainSource
+	sc.Files = nil
+	for _, f := range skipchainSource.Files {
+		sc.Files = append(sc.Files, filepath.Join(root, f))
+	}
+	return append(srcs, sc), nil
+}
+
+// generate returns the .proto file of the source.
+func generate(src source) (string, error) {
+	var lines []string
+	for _, f := range src.Files {
+		fd, err := os.Open(f)
+		if err != nil {
+			return "", err
+		}
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		fd.Close()
+		if err = scanner.Err(); err != nil {
+			return "", err
+		}
+	}
+	g := &generator{src: src, structs: map[string][]string{}, docs: map[string][]string{}}
+	g.parse(lines)
+	g.println(`syntax = "proto2";`)
+	if len(src.Messages) == 0 {
+		if err := g.protostart(lines); err != nil {
+			return "", err
+		}
+		return g.out.String(), nil
+	}
+
+	g.out.WriteString(src.Header)
+	for _, name := range src.Messages {
+		if _, ok := g.structs[name]; !ok {
+			return "", fmt.Errorf("structure %s not found", name)
+		}
+		g.println("")
+		for _, l := range g.docs[name] {
+			g.println(l)
+		}
+		g.message(name)
+	}
+	return g.out.String(), nil
+}
+
+type generator struct {
+	src     source
+	types   [][2]string
+	structs map[string][]string
+	docs    map[string][]string
+	out     bytes.Buffer
+}
+
+func (g *generator) println(s string) {
+	g.out.WriteString(s + "\n")
+}
+
+// parse stores the body and the doc-comment of all structures.
+func (g *generator) parse(lines []string) {
+	g.types = append(g.types, g.src.Types...)
+	var doc []string
+	for i := 0; i < len(lines); i++ {
+		m := reStruct.FindStringSubmatch(lines[i])
+		if m == nil {
+			if strings.HasPrefix(lines[i], "//") {
+				doc = append(doc, lines[i])
+			} else {
+				doc = nil
+			}
+			continue
+		}
+		g.docs[m[1]] = doc
+		doc = nil
+		var body []string
+		for i++; i < len(lines) && !strings.HasPrefix(lines[i], "}"); i++ {
+			body = append(body, lines[i])
+		}
+		g.structs[m[1]] = body
+	}
+}
+
+// protostart copies the comment starting with PROTOSTART and everything
+// after it, replacing the structures with messages.
+func (g *generator) protostart(lines []string) error {
+	start := -1
+	for i, l := range lines {
+		if strings.Contains(l, "PROTOSTART") {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return errors.New("no PROTOSTART found")
+	}
+	i := start
+	for ; i < len(lines) && strings.HasPrefix(lines[i], "//"); i++ {
+		if strings.HasPrefix(lines[i], "// type") {
+			t := strings.Split(lines[i], ":")
+			g.types = append(g.types, [2]string{t[1], t[2]})
+			continue
+		}
+		g.println(strings.TrimLeft(strings.TrimPrefix(lines[i], "//"), " "))
+	}
+	// The first line after the comment is copied as is.
+	first := i
+	for ; i < len(lines); i++ {
+		if i > first && reStruct.MatchString(lines[i]) {
+			g.message(reStruct.FindStringSubmatch(lines[i])[1])
+			for i < len(lines) && !strings.HasPrefix(lines[i], "}") {
+				i++
+			}
+			continue
+		}
+		g.println(lines[i])
+	}
+	return nil
+}
+
+// message writes the structure as a message.
+func (g *generator) message(name string) {
+	msg := name
+	if r, ok := g.src.Rename[name]; ok {
+		msg = r
+	}
+	g.println("message " + strings.ToUpper(msg[:1]) + msg[1:] + " {")
+	index := 1
+	g.fields(name, &index)
+	g.println("}")
+}
+
+// fields writes the fields of the structure, starting at index. The fields
+// of embedded structures are written in place.
+func (g *generator) fields(name string, index *int) {
+	optional := false
+	for _, l := range g.structs[name] {
+		f := strings.Fields(l)
+		switch {
+		case optional && len(f) > 1:
+			g.field(name, "optional", reTrailing.ReplaceAllString(f[1], ""), f[0], index)
+			optional = false
+		case strings.Contains(l, "// optional"):
+			optional = true
+		case reHidden.MatchString(l):
+		case strings.Contains(l, "//"):
+			loc := reComment.FindStringIndex(l)
+			g.println("  // " + l[:loc[0]] + l[loc[1]:])
+		case len(f) == 1:
+			g.fields(strings.TrimPrefix(f[0], "*"), index)
+		case strings.Contains(l, "*"):
+			g.field(name, "optional", strings.Replace(f[1], "*", "", 1), f[0], index)
+		case strings.Contains(l, "`protobuf:\"opt\"`"):
+			g.field(name, "optional", f[1], f[0], index)
+		case len(f) > 1:
+			g.field(name, "required", f[1], f[0], index)
+		}
+	}
+}
+
+// field writes one field and increases the index.
+func (g *generator) field(structure, label, typ, name string, index *int) {
+	defer func() { *index++ }()
+	if o, ok := g.src.Fields[structure+"."+name]; ok {
+		g.println(fmt.Sprintf("  %s = %d;", o, *index))
+		return
+	}
+	if t, ok := builtinTypes[typ]; ok {
+		typ = t
+	}
+	if strings.Contains(name, "bytes") {
+		label = "repeated"
+	}
+	for _, t := range g.types {
+		typ = replace(`^\[\]`+t[0], "[]"+t[1], typ)
+		typ = replace(`^\[\]\*`+t[0], "[]*"+t[1], typ)
+		typ = replace("^"+t[0], t[1], typ)
+	}
+	if strings.Contains(typ, "map") {
+		label = ""
+	}
+	if strings.HasPrefix(typ, "[]") {
+		label = "repeated"
+		typ = typ[2:]
+	}
+	typ = reArray.ReplaceAllLiteralString(typ, "bytes")
+	switch typ {
+	case "time.Duration", "int64":
+		typ = "sint64"
+	case "kyber.Point", "kyber.Scalar":
+		typ = "bytes"
+	case "int32", "int":
+		typ = "sint32"
+	}
+	typ = strings.TrimPrefix(typ, "*")
+	packed := ""
+	if label == "repeated" && scalarTypes[typ] {
+		packed = " [packed=true]"
+	}
+	g.println(fmt.Sprintf("  %s %s %s = %d%s;", label, typ, strings.ToLower(name), *index, packed))
+}
+
+// replace replaces the match of the regular expression re in s.
+func replace(re, repl, s string) string {
+	return regexp.MustCompile(re).ReplaceAllLiteralString(s, repl)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	root := filepath.Join("..", "..")
+	srcs, err := sources(root)
+	require.Nil(t, err)
+	for _, src := range srcs {
+		proto, err := generate(src)
+		require.Nil(t, err)
+		exp, err := ioutil.ReadFile(filepath.Join(root, "external", "proto", src.Proto))
+		require.Nil(t, err)
+		require.Equal(t, string(exp), proto,
+			"%s is not up to date, run proto.sh", src.Proto)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+// skipchainSource generates skipchain.proto. The messages of the skipchain
+// are spread over several files and embed the SkipBlockFix, so they are
+// listed here. The names of some fields differ from the Go names, as the
+// clients already use them.
+var skipchainSource = source{
+	Files: []string{
+		"skipchain/msgs.go",
+		"skipchain/struct.go",
+		"skipchain/proof.go",
+		"byzcoinx/byzcoinx.go",
+	},
+	Proto: "skipchain.proto",
+	Header: `
+package skipchain;
+
+// This file is generated from the skipchain package by external/protogen.
+
+option java_package = "ch.epfl.dedis.proto";
+option java_outer_classname = "SkipchainProto";
+
+import "onet.proto";
+`,
+	Messages: []string{
+		"StoreSkipBlock",
+		"StoreSkipBlockReply",
+		"GetSingleBlock",
+		"GetSingleBlockByIndex",
+		"GetUpdateChain",
+		"GetUpdateChainReply",
+		"GetAllSkipChainIDs",
+		"GetAllSkipChainIDsReply",
+		"GetBlocksByID",
+		"GetBlocksByIDReply",
+		"GetChainProof",
+		"GetChainProofReply",
+		"ChainProof",
+		"GetChildren",
+		"GetChildrenReply",
+		"GetNewBlocks",
+		"GetNewBlocksReply",
+		"SkipBlock",
+		"SkipBlockFix",
+		"ForwardLink",
+		"FinalSignature",
+		"PartialSignature",
+	},
+	Rename: map[string]string{
+		"FinalSignature": "ByzcoinSig",
+	},
+	Types: [][2]string{
+		{"SkipBlockID", "bytes"},
+		{"byzcoinx.FinalSignature", "ByzcoinSig"},
+	},
+	Fields: map[string]string{
+		"GetUpdateChain.LatestID":    "required bytes latestID",
+		"GetChildren.ParentID":       "required bytes parentID",
+		"GetChildrenReply.Parent":    "required SkipBlock parent",
+		"GetNewBlocks.LatestID":      "required bytes latestID",
+		"SkipBlockFix.Index":         "required int32 index",
+		"SkipBlockFix.Height":        "required int32 height",
+		"SkipBlockFix.MaximumHeight": "required int32 max_height",
+		"SkipBlockFix.BaseHeight":    "required int32 base_height",
+		"SkipBlockFix.BackLinkIDs":   "repeated bytes backlinks",
+		"SkipBlockFix.VerifierIDs":   "repeated bytes verifiers",
+		"SkipBlockFix.ParentBlockID": "optional bytes parent",
+		"SkipBlockFix.GenesisID":     "required bytes genesis",
+		"SkipBlockFix.Roster":        "required onet.Roster roster",
+		"SkipBlock.ForwardLink":      "repeated ForwardLink forward",
+		"SkipBlock.ChildSL":          "repeated bytes children",
+		"ForwardLink.NewRoster":      "optional onet.Roster newRoster",
+	},
+}
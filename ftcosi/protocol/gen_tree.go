@@ -122,3 +122,104 @@ func genSubtree(roster *onet.Roster, nodes []int) (*onet.Tree, error) {
 
 	return onet.NewTree(roster, rootNode), nil
 }
+
+// genKArySubtree generates a subtree like genSubtree, but if branching is
+// positive, the nodes after the sub-leader are added level by level, so that
+// no node has more than branching children. The subtree has as many levels
+// as needed, the first nodes of the list being the closest to the root.
+func genKArySubtree(roster *onet.Roster, nodes []int, branching int) (*onet.Tree, error) {
+	tree, err := genSubtree(roster, nodes)
+	if err != nil || branching < 1 {
+		return tree, err
+	}
+	subleader := tree.Root.Children[0]
+	leaves := subleader.Children
+	subleader.Children = nil
+	parents := []*onet.TreeNode{subleader}
+	for _, node := range leaves {
+		parent := parents[0]
+		node.Parent = parent
+		parent.Children = append(parent.Children, node)
+		parents = append(parents, node)
+		if len(parent.Children) == branching {
+			parents = parents[1:]
+		}
+	}
+	return onet.NewTree(roster, tree.Root), nil
+}
+
+// subtreeNodes returns the roster indexes of the nodes below the sub-leader
+// of the subtree, level by level, so that genKArySubtree builds the same
+// levels again.
+func subtreeNodes(subleader *onet.TreeNode) []int {
+	var nodes []int
+	level := subleader.Children
+	for len(level) > 0 {
+		var next []*onet.TreeNode
+		for _, n := range level {
+			nodes = append(nodes, n.RosterIndex)
+			next = append(next, n.Children...)
+		}
+		level = next
+	}
+	return nodes
+}
+
+// genBalancedTrees generates the same number of subtrees of the same size as
+// genTrees, but the nodes in unreliable are never chosen as sub-leaders and
+// are spread evenly over the subtrees, after the reliable leaves. So if a
+// sub-leader fails, it is replaced by a reliable node, and a subtree isn't
+// dropped because all its nodes are paused. If branching is positive, the
+// subtrees are generated with genKArySubtree.
+func genBalancedTrees(roster *onet.Roster, root, nNodes, nSubtrees, branching int,
+	unreliable map[int]bool) ([]*onet.Tree, error) {
+	// genTrees checks the parameters and gives the size of the subtrees.
+	trees, err := genTrees(roster, root, nNodes, nSubtrees)
+	if err != nil || len(trees) == 0 || trees[0] == nil {
+		return trees, err
+	}
+	if len(unreliable) == 0 {
+		if branching < 1 {
+			return trees, nil
+		}
+		for i, tree := range trees {
+			subleader := tree.Root.Children[0]
+			nodes := append([]int{root, subleader.RosterIndex}, subtreeNodes(subleader)...)
+			trees[i], err = genKArySubtree(roster, nodes, branching)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return trees, nil
+	}
+
+	var reliable, others []int
+	for i := 0; i < nNodes; i++ {
+		if i == root {
+			continue
+		}
+		if unreliable[i] {
+			others = append(others, i)
+		} else {
+			reliable = append(reliable, i)
+		}
+	}
+	order := append(reliable, others...)
+
+	// The first node of every subtree is its sub-leader, then the remaining
+	// nodes are dealt in turn, so that the subtrees keep their size.
+	nodes := make([][]int, len(trees))
+	for i := range nodes {
+		nodes[i] = []int{root}
+	}
+	for i, n := range order {
+		nodes[i%len(trees)] = append(nodes[i%len(trees)], n)
+	}
+	for i := range trees {
+		trees[i], err = genKArySubtree(roster, nodes[i], branching)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return trees, nil
+}
@@ -395,3 +395,105 @@ func TestGenSubtreeErrors(t *testing.T) {
 		local.CloseAll()
 	}
 }
+
+// tests that unreliable nodes are not sub-leaders and are spread evenly
+func TestGenBalancedTrees(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(10)
+	roster := local.GenRosterFromHost(servers...)
+
+	unreliable := map[int]bool{1: true, 2: true, 3: true}
+	trees, err := genBalancedTrees(roster, 0, 10, 3, 0, unreliable)
+	if err != nil {
+		t.Fatal("Error in tree generation:", err)
+	}
+	expected, err := genTrees(roster, 0, 10, 3)
+	if err != nil {
+		t.Fatal("Error in tree generation:", err)
+	}
+	if len(trees) != len(expected) {
+		t.Fatal("Should have", len(expected), "subtrees, but has", len(trees))
+	}
+	for i, tree := range trees {
+		if tree.Size() != expected[i].Size() {
+			t.Fatal("The subtree", i, "should contain", expected[i].Size(), "nodes, but contains", tree.Size())
+		}
+		subleader := tree.Root.Children[0]
+		if unreliable[subleader.RosterIndex] {
+			t.Fatal("Unreliable node", subleader.RosterIndex, "is a sub-leader")
+		}
+		count := 0
+		for j, leaf := range subleader.Children {
+			if unreliable[leaf.RosterIndex] {
+				count++
+				if j != len(subleader.Children)-1 {
+					t.Fatal("Unreliable node", leaf.RosterIndex, "is not after the reliable leaves")
+				}
+			}
+		}
+		if count != 1 {
+			t.Fatal("The subtree", i, "should contain one unreliable node, but contains", count)
+		}
+		testNode(t, tree.Root, nil, tree)
+	}
+}
+
+// tests that the subtrees with a branching factor have as many levels as
+// needed and no node with more children than the branching factor
+func TestGenBalancedTreesBranching(t *testing.T) {
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	servers := local.GenServers(31)
+	roster := local.GenRosterFromHost(servers...)
+
+	for _, unreliable := range []map[int]bool{nil, {1: true, 2: true}} {
+		trees, err := genBalancedTrees(roster, 0, 31, 2, 2, unreliable)
+		if err != nil {
+			t.Fatal("Error in tree generation:", err)
+		}
+		if len(trees) != 2 {
+			t.Fatal("Should have 2 subtrees, but has", len(trees))
+		}
+		for i, tree := range trees {
+			if tree.Size() != 16 {
+				t.Fatal("The subtree", i, "should contain 16 nodes, but contains", tree.Size())
+			}
+			if unreliable[tree.Root.Children[0].RosterIndex] {
+				t.Fatal("Unreliable node", tree.Root.Children[0].RosterIndex, "is a sub-leader")
+			}
+			depth := 0
+			tree.Root.Visit(0, func(d int, node *onet.TreeNode) {
+				if d > 0 && len(node.Children) > 2 {
+					t.Fatal("Node", node.RosterIndex, "has", len(node.Children), "children")
+				}
+				if d > depth {
+					depth = d
+				}
+				testNode(t, node, node.Parent, tree)
+			})
+			// a binary tree of the 15 nodes below the root
+			if depth != 4 {
+				t.Fatal("The subtree", i, "should have a depth of 4, but has", depth)
+			}
+		}
+	}
+
+	// a new sub-leader keeps all the nodes of the subtree
+	trees, err := genBalancedTrees(roster, 0, 31, 2, 2, nil)
+	if err != nil {
+		t.Fatal("Error in tree generation:", err)
+	}
+	subleader := trees[0].Root.Children[0]
+	nodes := append([]int{0}, subtreeNodes(subleader)...)
+	tree, err := genKArySubtree(roster, append(nodes, subleader.RosterIndex), 2)
+	if err != nil {
+		t.Fatal("Error in tree generation:", err)
+	}
+	if tree.Size() != trees[0].Size() {
+		t.Fatal("The new subtree should contain", trees[0].Size(), "nodes, but contains", tree.Size())
+	}
+	if tree.Root.Children[0].RosterIndex == subleader.RosterIndex {
+		t.Fatal("The sub-leader has not been replaced")
+	}
+}
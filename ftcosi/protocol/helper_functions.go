@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/sign/cosi"
@@ -111,3 +112,21 @@ func GetLeafsIDs(tree *onet.Tree, root, nNodes, nSubtrees int) ([]network.Server
 	}
 	return leafsIDs, nil
 }
+
+// verificationStats returns the minimum, median and maximum of the timings.
+func verificationStats(timings []VerificationTiming) VerificationStats {
+	if len(timings) == 0 {
+		return VerificationStats{Slowest: -1}
+	}
+	sorted := append([]VerificationTiming{}, timings...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Duration < sorted[j].Duration
+	})
+	return VerificationStats{
+		Count:   len(sorted),
+		Min:     sorted[0].Duration,
+		Median:  sorted[len(sorted)/2].Duration,
+		Max:     sorted[len(sorted)-1].Duration,
+		Slowest: sorted[len(sorted)-1].Index,
+	}
+}
@@ -0,0 +1,31 @@
+package protocol
+
+import (
+	"github.com/dedis/kyber/sign/cosi"
+)
+
+// WeightedPolicy is a cosi.Policy that gives every node a weight. It is
+// fulfilled if the weights of the nodes that signed add up to at least
+// Threshold.
+type WeightedPolicy struct {
+	// Weights of the nodes, in the order of the roster. Nodes without a
+	// weight count as 0.
+	Weights   []int
+	Threshold int
+}
+
+// NewWeightedPolicy returns a policy with the given weights and threshold.
+func NewWeightedPolicy(weights []int, threshold int) *WeightedPolicy {
+	return &WeightedPolicy{Weights: weights, Threshold: threshold}
+}
+
+// Check implements cosi.Policy.
+func (wp *WeightedPolicy) Check(m *cosi.Mask) bool {
+	total := 0
+	for i, w := range wp.Weights {
+		if enabled, err := m.IndexEnabled(i); err == nil && enabled {
+			total += w
+		}
+	}
+	return total >= wp.Threshold
+}
@@ -21,8 +21,10 @@ import (
 )
 
 // VerificationFn is called on every node. Where msg is the message that is
-// co-signed and the data is additional data for verification.
-type VerificationFn func(msg []byte, data []byte) bool
+// co-signed and the data is additional data for verification, for example
+// the whole block of which msg is the digest. A node refuses to sign if it
+// returns an error, the error is reported to the root.
+type VerificationFn func(msg []byte, data []byte) error
 
 // init is done at startup. It defines every messages that is handled by the network
 // and registers the protocols.
@@ -36,17 +38,53 @@ func init() {
 type FtCosi struct {
 	*onet.TreeNodeInstance
 
-	NSubtrees      int
-	Msg            []byte
-	Data           []byte
-	CreateProtocol CreateProtocolFunction
+	NSubtrees int
+	// BranchingFactor is the maximum number of children of the nodes of
+	// the subtrees. If it is 0, all the nodes of a subtree are children of
+	// its sub-leader, else the subtrees have as many levels as needed.
+	BranchingFactor int
+	Msg             []byte
+	Data            []byte
+	CreateProtocol  CreateProtocolFunction
 	// Timeout is not a global timeout for the protocol, but a timeout used
 	// for waiting for responses for sub protocols.
-	Timeout        time.Duration
-	Threshold      int
+	Timeout time.Duration
+	// SubleaderTimeout is passed down to the sub protocols and is how long a
+	// sub-leader waits for the commitments and responses of its children. If
+	// it is 0, a third of Timeout is used.
+	SubleaderTimeout time.Duration
+	// MaxSubleaderRetries is how many times a sub-leader that doesn't
+	// respond is replaced by the next node of its subtree. Once the retries
+	// are used up, the subtree is counted as refusing. If it is 0,
+	// defaultMaxSubleaderRetries is used, a negative value disables the
+	// replacement.
+	MaxSubleaderRetries int
+	// UnreliableNodes are nodes that recently didn't respond, for example
+	// the SkippedNodes of a previous run. They are not chosen as sub-leaders
+	// and are spread evenly over the subtrees.
+	UnreliableNodes []*network.ServerIdentity
+	// Sequence identifies the round. It is sent with the announcement and
+	// every node refuses to sign if it already got a higher sequence from
+	// this root for this protocol, so a delayed announcement cannot be
+	// signed once the nodes moved on. If it is 0, it is not checked.
+	Sequence uint64
+	// SequenceID separates the sequences of the rounds of the same root and
+	// protocol, for example the skipchain the rounds sign blocks of.
+	SequenceID []byte
+	Threshold  int
+	// Policy is checked against the nodes that committed before the
+	// challenge is sent, so that no signature is produced that doesn't
+	// fulfill it. The Threshold is still used to know when enough
+	// commitments arrived. If it is nil, only the Threshold is used.
+	Policy         cosi.Policy
 	FinalSignature chan []byte
 
 	publics         []kyber.Point
+	skipped         []*network.ServerIdentity
+	abortReason     string
+	refusals        []Refusal
+	timings         []VerificationTiming
+	reportMutex     sync.Mutex
 	stoppedOnce     sync.Once
 	subProtocols    []*SubFtCosi
 	startChan       chan bool
@@ -55,6 +93,11 @@ type FtCosi struct {
 	suite           cosi.Suite
 }
 
+// defaultMaxSubleaderRetries is the number of sub-leaders that can fail in
+// every subtree. Every failure takes half of the sub-leader timeout, so more
+// retries only fit if the timeouts are adjusted.
+const defaultMaxSubleaderRetries = 2
+
 // CreateProtocolFunction is a function type which creates a new protocol
 // used in FtCosi protocol for creating sub leader protocols.
 type CreateProtocolFunction func(name string, t *onet.Tree) (onet.ProtocolInstance, error)
@@ -62,7 +105,7 @@ type CreateProtocolFunction func(name string, t *onet.Tree) (onet.ProtocolInstan
 // NewDefaultProtocol is the default protocol function used for registration
 // with an always-true verification.
 func NewDefaultProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-	vf := func(a, b []byte) bool { return true }
+	vf := func(a, b []byte) error { return nil }
 	return NewFtCosi(n, vf, DefaultSubProtocolName, cothority.Suite)
 }
 
@@ -93,8 +136,11 @@ func NewFtCosi(n *onet.TreeNodeInstance, vf VerificationFn, subProtocolName stri
 // Shutdown stops the protocol
 func (p *FtCosi) Shutdown() error {
 	p.stoppedOnce.Do(func() {
+		p.reportMutex.Lock()
+		reason := p.abortReason
+		p.reportMutex.Unlock()
 		for _, subFtCosi := range p.subProtocols {
-			subFtCosi.HandleStop(StructStop{subFtCosi.TreeNode(), Stop{}})
+			subFtCosi.HandleStop(StructStop{subFtCosi.TreeNode(), Stop{reason}})
 		}
 		close(p.startChan)
 		close(p.FinalSignature)
@@ -103,9 +149,20 @@ func (p *FtCosi) Shutdown() error {
 }
 
 // Dispatch is the main method of the protocol, defining the root node behaviour
-// and sequential handling of subprotocols.
+// and sequential handling of subprotocols. If it fails, the nodes are told
+// that the round is aborted.
 func (p *FtCosi) Dispatch() error {
 	defer p.Done()
+	err := p.dispatch()
+	if err != nil {
+		p.reportMutex.Lock()
+		p.abortReason = err.Error()
+		p.reportMutex.Unlock()
+	}
+	return err
+}
+
+func (p *FtCosi) dispatch() error {
 	if !p.IsRoot() {
 		return nil
 	}
@@ -121,15 +178,25 @@ func (p *FtCosi) Dispatch() error {
 
 	log.Lvl3("root protocol started")
 
-	verifyChan := make(chan bool, 1)
+	verifyChan := make(chan error, 1)
 	go func() {
 		log.Lvl3(p.ServerIdentity().Address, "starting verification")
-		verifyChan <- p.verificationFn(p.Msg, p.Data)
+		start := time.Now()
+		err := p.verificationFn(p.Msg, p.Data)
+		p.addTimings(VerificationTiming{Index: p.TreeNode().RosterIndex, Duration: time.Since(start)})
+		verifyChan <- err
 	}()
 
 	// generate trees
 	nNodes := p.Tree().Size()
-	trees, err := genTrees(p.Tree().Roster, p.Tree().Root.RosterIndex, nNodes, p.NSubtrees)
+	unreliable := make(map[int]bool)
+	for _, si := range p.UnreliableNodes {
+		if i, _ := p.Tree().Roster.Search(si.ID); i >= 0 {
+			unreliable[i] = true
+		}
+	}
+	trees, err := genBalancedTrees(p.Tree().Roster, p.Tree().Root.RosterIndex, nNodes, p.NSubtrees,
+		p.BranchingFactor, unreliable)
 	if err != nil {
 		p.FinalSignature <- nil
 		return fmt.Errorf("error in tree generation: %s", err)
@@ -160,17 +227,20 @@ func (p *FtCosi) Dispatch() error {
 
 	var secret kyber.Scalar
 	// verifies the proposal
-	var verificationOk bool
+	var verificationErr error
 	select {
-	case verificationOk = <-verifyChan:
+	case verificationErr = <-verifyChan:
 		close(verifyChan)
 	case <-time.After(p.Timeout):
 		log.Error(p.ServerIdentity(), "timeout while waiting for the verification!")
+		verificationErr = errors.New("timeout while waiting for the verification")
 	}
-	if !verificationOk {
+	if verificationErr != nil {
 		// root should not fail the verification otherwise it would not have started the protocol
+		p.addRefusals(Refusal{Index: p.TreeNode().RosterIndex, Reason: RefusalVerification,
+			Message: verificationErr.Error()})
 		p.FinalSignature <- nil
-		return fmt.Errorf("verification failed on root node")
+		return fmt.Errorf("verification failed on root node: %s", verificationErr)
 	}
 
 	// add own commitment
@@ -182,7 +252,7 @@ func (p *FtCosi) Dispatch() error {
 		return err
 	}
 	personalStructCommitment := StructCommitment{p.TreeNode(),
-		Commitment{personalCommitment, personalMask.Mask(), 0}}
+		Commitment{personalCommitment, personalMask.Mask(), 0, nil, nil, p.Sequence}}
 	commitments = append(commitments, personalStructCommitment)
 
 	// generate own aggregated commitment
@@ -191,6 +261,11 @@ func (p *FtCosi) Dispatch() error {
 		p.FinalSignature <- nil
 		return err
 	}
+	if p.Policy != nil && !p.Policy.Check(finalMask) {
+		p.FinalSignature <- nil
+		return fmt.Errorf("the %d nodes that committed don't fulfill the policy",
+			finalMask.CountEnabled())
+	}
 
 	log.Lvl3("root-node generating global challenge")
 	cosiChallenge, err := cosi.Challenge(p.suite, commitment, finalMask.AggregatePublic, p.Msg)
@@ -295,6 +370,11 @@ func (p *FtCosi) Start() error {
 		p.Shutdown()
 		return fmt.Errorf("unrealistic timeout")
 	}
+	if p.SubleaderTimeout < 0 || p.SubleaderTimeout > p.Timeout {
+		p.Shutdown()
+		return fmt.Errorf("sub-leader timeout (%s) must be between 0 and the timeout (%s)",
+			p.SubleaderTimeout, p.Timeout)
+	}
 	if p.Threshold > p.Tree().Size() {
 		p.Shutdown()
 		return fmt.Errorf("threshold (%d) bigger than number of nodes (%d)", p.Threshold, p.Tree().Size())
@@ -304,6 +384,14 @@ func (p *FtCosi) Start() error {
 		return fmt.Errorf("threshold of %d smaller than one node", p.Threshold)
 	}
 
+	if p.BranchingFactor < 0 {
+		p.Shutdown()
+		return fmt.Errorf("negative branching factor (%d)", p.BranchingFactor)
+	}
+	if p.MaxSubleaderRetries == 0 {
+		p.MaxSubleaderRetries = defaultMaxSubleaderRetries
+	}
+
 	if p.NSubtrees < 1 {
 		log.Warn("no number of subtree specified, using one subtree")
 		p.NSubtrees = 1
@@ -319,6 +407,60 @@ func (p *FtCosi) Start() error {
 	return nil
 }
 
+// SkippedNodes returns the sub-leaders that didn't respond and have been
+// replaced or dropped together with their subtree. It is only set on the
+// root and complete once the FinalSignature has been sent.
+func (p *FtCosi) SkippedNodes() []*network.ServerIdentity {
+	p.reportMutex.Lock()
+	defer p.reportMutex.Unlock()
+	return append([]*network.ServerIdentity{}, p.skipped...)
+}
+
+// addSkipped records a sub-leader that didn't respond.
+func (p *FtCosi) addSkipped(subleader *onet.TreeNode) {
+	p.reportMutex.Lock()
+	defer p.reportMutex.Unlock()
+	p.skipped = append(p.skipped, subleader.ServerIdentity)
+	p.refusals = append(p.refusals, Refusal{Index: subleader.RosterIndex,
+		Reason: RefusalTimeout, Message: "sub-leader didn't respond"})
+}
+
+// Refusals returns the nodes that refused to sign or couldn't be reached,
+// together with the reason. It is only set on the root and complete once the
+// FinalSignature has been sent, also if the signature failed.
+func (p *FtCosi) Refusals() []Refusal {
+	p.reportMutex.Lock()
+	defer p.reportMutex.Unlock()
+	return append([]Refusal{}, p.refusals...)
+}
+
+func (p *FtCosi) addRefusals(refusals ...Refusal) {
+	p.reportMutex.Lock()
+	defer p.reportMutex.Unlock()
+	p.refusals = append(p.refusals, refusals...)
+}
+
+// VerificationTimings returns how long the verification took on the nodes
+// that answered, including the root. It is only set on the root and complete
+// once the FinalSignature has been sent.
+func (p *FtCosi) VerificationTimings() []VerificationTiming {
+	p.reportMutex.Lock()
+	defer p.reportMutex.Unlock()
+	return append([]VerificationTiming{}, p.timings...)
+}
+
+// VerificationStats returns the minimum, median and maximum of the
+// VerificationTimings.
+func (p *FtCosi) VerificationStats() VerificationStats {
+	return verificationStats(p.VerificationTimings())
+}
+
+func (p *FtCosi) addTimings(timings ...VerificationTiming) {
+	p.reportMutex.Lock()
+	defer p.reportMutex.Unlock()
+	p.timings = append(p.timings, timings...)
+}
+
 // startSubProtocol creates, parametrize and starts a subprotocol on a given tree
 // and returns the started protocol.
 func (p *FtCosi) startSubProtocol(tree *onet.Tree) (*SubFtCosi, error) {
@@ -332,9 +474,18 @@ func (p *FtCosi) startSubProtocol(tree *onet.Tree) (*SubFtCosi, error) {
 	cosiSubProtocol.Publics = p.publics
 	cosiSubProtocol.Msg = p.Msg
 	cosiSubProtocol.Data = p.Data
+	cosiSubProtocol.Sequence = p.Sequence
+	cosiSubProtocol.SequenceID = p.SequenceID
+	// The root waits for the commitments and for its own verification
+	// before sending the challenge.
+	cosiSubProtocol.LeaderTimeout = 2 * p.Timeout
 	// We allow for one subleader failure during the commit phase, and thus
-	// only allocate one third of the ftcosi budget to the subprotocol.
+	// only allocate one third of the ftcosi budget to the subprotocol by
+	// default.
 	cosiSubProtocol.Timeout = p.Timeout / 3
+	if p.SubleaderTimeout > 0 {
+		cosiSubProtocol.Timeout = p.SubleaderTimeout
+	}
 
 	// the Threshold (minus root node) is divided evenly among the subtrees
 	subThreshold := int(math.Ceil(float64(p.Threshold-1) / float64(p.NSubtrees)))
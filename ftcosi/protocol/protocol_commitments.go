@@ -31,29 +31,39 @@ func (p *FtCosi) collectCommitments(trees []*onet.Tree,
 		go func(i int, subProtocol *SubFtCosi) {
 			defer closingWg.Done()
 			timeout := time.After(p.Timeout / 2)
+			retries := 0
 			for {
 				select {
 				case <-closingChan:
 					return
 				case <-subProtocol.subleaderNotResponding:
-					subleaderID := trees[i].Root.Children[0].RosterIndex
-					log.Lvlf2("(subprotocol %v) subleader with id %d failed, restarting subprotocol", i, subleaderID)
+					subleader := trees[i].Root.Children[0]
+					p.addSkipped(subleader)
 
 					// generate new tree by adding the current subleader to the end of the
-					// leafs and taking the first leaf for the new subleader.
-					nodes := []int{trees[i].Root.RosterIndex}
-					for _, child := range trees[i].Root.Children[0].Children {
-						nodes = append(nodes, child.RosterIndex)
-					}
-					if subleaderID > nodes[len(nodes)-1] {
-						errChan <- fmt.Errorf("(subprotocol %v) failed with every subleader, ignoring this subtree",
-							i)
+					// nodes of the subtree and taking the first one for the new subleader.
+					nodes := append([]int{trees[i].Root.RosterIndex}, subtreeNodes(subleader)...)
+					if retries >= p.MaxSubleaderRetries || retries >= len(nodes)-1 {
+						log.Lvlf2("(subprotocol %v) failed with %d subleaders, ignoring this subtree",
+							i, retries+1)
+						subProtocol.HandleStop(StructStop{subProtocol.TreeNode(), Stop{}})
+						// The whole subtree counts as refusing, the threshold
+						// might still be reached with the other subtrees.
+						com, err := p.refusalCommitment(subProtocol, nodes[1:])
+						if err != nil {
+							errChan <- err
+							return
+						}
+						commitmentsChan <- commitmentProtocol{com, subProtocol}
 						return
 					}
-					nodes = append(nodes, subleaderID)
+					retries++
+					log.Lvlf2("(subprotocol %v) subleader with id %d failed, restarting subprotocol",
+						i, subleader.RosterIndex)
+					nodes = append(nodes, subleader.RosterIndex)
 
 					var err error
-					trees[i], err = genSubtree(trees[i].Roster, nodes)
+					trees[i], err = genKArySubtree(trees[i].Roster, nodes, p.BranchingFactor)
 					if err != nil {
 						errChan <- fmt.Errorf("(subprotocol %v) error in tree generation: %v", i, err)
 						return
@@ -86,6 +96,12 @@ func (p *FtCosi) collectCommitments(trees []*onet.Tree,
 		return nil, nil, err
 	}
 	commitmentsMap := make(map[*SubFtCosi]StructCommitment, len(subProtocols))
+	defer func() {
+		for _, com := range commitmentsMap {
+			p.addRefusals(com.Refusals...)
+			p.addTimings(com.Timings...)
+		}
+	}()
 	thresholdReached := true
 	thresholdReachable := true
 	if len(subProtocols) > 0 {
@@ -162,6 +178,23 @@ func (p *FtCosi) collectCommitments(trees []*onet.Tree,
 	return commitments, runningSubProtocols, nil
 }
 
+// refusalCommitment returns a commitment that counts the subtree of the
+// subprotocol as refusing. The subleader has already been reported, so only
+// the refusals of the leafs are added.
+func (p *FtCosi) refusalCommitment(subProtocol *SubFtCosi, leafs []int) (StructCommitment, error) {
+	mask, err := cosi.NewMask(p.suite, p.publics, nil)
+	if err != nil {
+		return StructCommitment{}, err
+	}
+	refusals := make([]Refusal, len(leafs))
+	for i, leaf := range leafs {
+		refusals[i] = Refusal{Index: leaf, Reason: RefusalTimeout,
+			Message: "dropped with its sub-leader"}
+	}
+	return StructCommitment{subProtocol.TreeNode(),
+		Commitment{p.suite.Point().Null(), mask.Mask(), len(leafs) + 1, refusals, nil, p.Sequence}}, nil
+}
+
 func sumRefusals(commitmentsMap map[*SubFtCosi]StructCommitment) int {
 	sumRefusal := 0
 	for _, commitment := range commitmentsMap {
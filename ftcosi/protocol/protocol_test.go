@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"sync"
@@ -12,6 +13,7 @@ import (
 	"github.com/dedis/kyber/sign/cosi"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
 	"github.com/stretchr/testify/require"
 )
 
@@ -21,25 +23,50 @@ const FailureSubProtocolName = "FailureSubProtocol"
 const RefuseOneProtocolName = "RefuseOneProtocol"
 const RefuseOneSubProtocolName = "RefuseOneSubProtocol"
 
+const AbortProtocolName = "AbortProtocol"
+const AbortSubProtocolName = "AbortSubProtocol"
+
+// aborts gets the rounds aborted on the nodes of the AbortProtocol
+var aborts = make(chan error, 10)
+
 func init() {
 	GlobalRegisterDefaultProtocols()
 	onet.GlobalProtocolRegister(FailureProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-		vf := func(a, b []byte) bool { return true }
+		vf := func(a, b []byte) error { return nil }
 		return NewFtCosi(n, vf, FailureSubProtocolName, cothority.Suite)
 	})
 	onet.GlobalProtocolRegister(FailureSubProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-		vf := func(a, b []byte) bool { return false }
+		vf := func(a, b []byte) error { return errors.New("refusing") }
 		return NewSubFtCosi(n, vf, cothority.Suite)
 	})
 	onet.GlobalProtocolRegister(RefuseOneProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-		vf := func(a, b []byte) bool { return true }
+		vf := func(a, b []byte) error { return nil }
 		return NewFtCosi(n, vf, RefuseOneSubProtocolName, cothority.Suite)
 	})
 	onet.GlobalProtocolRegister(RefuseOneSubProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-		return NewSubFtCosi(n, func(msg, data []byte) bool {
+		return NewSubFtCosi(n, func(msg, data []byte) error {
 			return refuse(n, msg, data)
 		}, cothority.Suite)
 	})
+	onet.GlobalProtocolRegister(AbortProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		vf := func(a, b []byte) error { return nil }
+		return NewFtCosi(n, vf, AbortSubProtocolName, cothority.Suite)
+	})
+	onet.GlobalProtocolRegister(AbortSubProtocolName, func(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		pi, err := NewSubFtCosi(n, func(msg, data []byte) error {
+			return refuse(n, msg, data)
+		}, cothority.Suite)
+		if err != nil {
+			return nil, err
+		}
+		pi.(*SubFtCosi).OnAbort = func(leader *network.ServerIdentity, msg []byte, reason error) {
+			if !leader.Equal(n.Root().ServerIdentity) {
+				reason = errors.New("wrong leader")
+			}
+			aborts <- reason
+		}
+		return pi, nil
+	})
 }
 
 var testSuite = cothority.Suite
@@ -100,6 +127,177 @@ func TestProtocol(t *testing.T) {
 	}
 }
 
+// seqStore is a SequenceStore that already got the sequence highest for
+// every key.
+type seqStore struct {
+	highest uint64
+	stored  []uint64
+	sync.Mutex
+}
+
+func (s *seqStore) LoadSequence(key string) (uint64, error) {
+	return s.highest, nil
+}
+
+func (s *seqStore) StoreSequence(key string, seq uint64) error {
+	s.Lock()
+	defer s.Unlock()
+	s.stored = append(s.stored, seq)
+	return nil
+}
+
+// Tests that the nodes refuse the sequences older than the ones of their
+// store, for example after a restart, and store the new ones
+func TestProtocolSequenceStore(t *testing.T) {
+	nNodes := 5
+	proposal := []byte{0xFF}
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(nNodes, false)
+	store := &seqStore{highest: 10}
+	for _, s := range servers {
+		RegisterSequenceStore(s.ServerIdentity.ID, store)
+	}
+
+	run := func(id []byte, sequence uint64) []byte {
+		pi, err := local.CreateProtocol(DefaultProtocolName, tree)
+		require.Nil(t, err)
+		cosiProtocol := pi.(*FtCosi)
+		cosiProtocol.CreateProtocol = local.CreateProtocol
+		cosiProtocol.Msg = proposal
+		cosiProtocol.NSubtrees = 2
+		cosiProtocol.Timeout = defaultTimeout
+		cosiProtocol.Threshold = nNodes
+		cosiProtocol.Sequence = sequence
+		cosiProtocol.SequenceID = id
+		require.Nil(t, cosiProtocol.Start())
+		return <-cosiProtocol.FinalSignature
+	}
+
+	require.Nil(t, run([]byte("a"), 5), "stale sequence")
+	require.NotNil(t, run([]byte("b"), 10))
+	require.NotNil(t, run([]byte("b"), 12))
+	store.Lock()
+	require.Equal(t, nNodes-1, len(store.stored))
+	for _, seq := range store.stored {
+		require.Equal(t, uint64(12), seq)
+	}
+	store.Unlock()
+}
+
+// Tests the signature with subtrees of more than three levels, also when a
+// node in the middle of a subtree refuses
+func TestProtocolBranchingFactor(t *testing.T) {
+	nNodes := 15
+	proposal := []byte{0xFF}
+
+	for _, refuseIdx := range []int{-1, 1, 2, nNodes - 1} {
+		counter = &Counter{refuseIdx: refuseIdx}
+		local := onet.NewLocalTest(testSuite)
+		_, _, tree := local.GenTree(nNodes, false)
+		publics := tree.Roster.Publics()
+
+		pi, err := local.CreateProtocol(RefuseOneProtocolName, tree)
+		require.Nil(t, err)
+		cosiProtocol := pi.(*FtCosi)
+		cosiProtocol.CreateProtocol = local.CreateProtocol
+		cosiProtocol.Msg = proposal
+		cosiProtocol.NSubtrees = 2
+		cosiProtocol.BranchingFactor = 2
+		cosiProtocol.Timeout = defaultTimeout
+		cosiProtocol.Threshold = nNodes - 1
+		require.Nil(t, cosiProtocol.Start())
+
+		var policy cosi.Policy = cosi.CompletePolicy{}
+		if refuseIdx >= 0 {
+			policy = cosi.NewThresholdPolicy(nNodes - 1)
+		}
+		_, err = getAndVerifySignature(cosiProtocol, publics, proposal, policy)
+		local.CloseAll()
+		require.Nil(t, err, "refused index: %d", refuseIdx)
+	}
+}
+
+// Tests that every node reports how long its verification took
+func TestProtocolVerificationTimings(t *testing.T) {
+	nNodes := 5
+	proposal := []byte{0xFF}
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(nNodes, false)
+
+	pi, err := local.CreateProtocol(DefaultProtocolName, tree)
+	require.Nil(t, err)
+	cosiProtocol := pi.(*FtCosi)
+	cosiProtocol.CreateProtocol = local.CreateProtocol
+	cosiProtocol.Msg = proposal
+	cosiProtocol.NSubtrees = 2
+	cosiProtocol.Timeout = defaultTimeout
+	cosiProtocol.Threshold = nNodes
+	require.Nil(t, cosiProtocol.Start())
+	_, err = getAndVerifySignature(cosiProtocol, tree.Roster.Publics(), proposal, cosi.CompletePolicy{})
+	require.Nil(t, err)
+
+	timings := cosiProtocol.VerificationTimings()
+	require.Equal(t, nNodes, len(timings))
+	seen := make(map[int]bool)
+	for _, timing := range timings {
+		seen[timing.Index] = true
+	}
+	require.Equal(t, nNodes, len(seen))
+	stats := cosiProtocol.VerificationStats()
+	require.Equal(t, nNodes, stats.Count)
+	require.True(t, stats.Min <= stats.Median && stats.Median <= stats.Max)
+
+	stats = verificationStats([]VerificationTiming{{0, 3 * time.Second},
+		{1, time.Second}, {2, 5 * time.Second}, {3, 2 * time.Second}})
+	require.Equal(t, VerificationStats{Count: 4, Min: time.Second, Median: 3 * time.Second,
+		Max: 5 * time.Second, Slowest: 2}, stats)
+	require.Equal(t, -1, verificationStats(nil).Slowest)
+}
+
+// Tests that nodes refuse to sign for an older sequence
+func TestProtocolSequence(t *testing.T) {
+	nNodes := 5
+	proposal := []byte{0xFF}
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(nNodes, false)
+
+	run := func(sequence uint64) (*FtCosi, []byte) {
+		pi, err := local.CreateProtocol(DefaultProtocolName, tree)
+		require.Nil(t, err)
+		cosiProtocol := pi.(*FtCosi)
+		cosiProtocol.CreateProtocol = local.CreateProtocol
+		cosiProtocol.Msg = proposal
+		cosiProtocol.NSubtrees = 2
+		cosiProtocol.Timeout = defaultTimeout
+		cosiProtocol.Threshold = nNodes
+		cosiProtocol.Sequence = sequence
+		require.Nil(t, cosiProtocol.Start())
+		return cosiProtocol, <-cosiProtocol.FinalSignature
+	}
+
+	_, sig := run(10)
+	require.NotNil(t, sig)
+	_, sig = run(10)
+	require.NotNil(t, sig, "same sequence")
+
+	p, sig := run(5)
+	require.Nil(t, sig, "stale sequence")
+	refusals := p.Refusals()
+	require.NotEqual(t, 0, len(refusals))
+	for _, r := range refusals {
+		require.Equal(t, RefusalVerification, r.Reason)
+		require.Contains(t, r.Message, "stale sequence")
+	}
+
+	_, sig = run(0)
+	require.NotNil(t, sig, "sequence not checked")
+	_, sig = run(11)
+	require.NotNil(t, sig)
+}
+
 // Tests various trees configurations
 func TestProtocolQuickAnswer(t *testing.T) {
 	nodes := []int{2, 5, 13, 24}
@@ -286,11 +484,58 @@ func TestUnresponsiveSubleader(t *testing.T) {
 				t.Fatal(err)
 			}
 
+			// the failed subleader is reported
+			skipped := cosiProtocol.SkippedNodes()
+			if len(skipped) != 1 || !skipped[0].ID.Equal(subleaderIds[0]) {
+				local.CloseAll()
+				t.Fatal("expected the first subleader to be reported, got", skipped)
+			}
+
 			local.CloseAll()
 		}
 	}
 }
 
+// Tests that a subtree is dropped once its subleader retries are used up,
+// while the other subtree can still reach the threshold.
+func TestSubleaderRetriesExhausted(t *testing.T) {
+	nNodes := 13
+	nSubtrees := 2
+	proposal := []byte{0xFF}
+
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	servers, _, tree := local.GenTree(nNodes, false)
+	publics := tree.Roster.Publics()
+
+	subleaderIds, err := GetSubleaderIDs(tree, 0, nNodes, nSubtrees)
+	require.Nil(t, err)
+	for _, s := range servers {
+		if s.ServerIdentity.ID == subleaderIds[0] {
+			s.Pause()
+		}
+	}
+
+	pi, err := local.CreateProtocol(DefaultProtocolName, tree)
+	require.Nil(t, err)
+	cosiProtocol := pi.(*FtCosi)
+	cosiProtocol.CreateProtocol = local.CreateProtocol
+	cosiProtocol.Msg = proposal
+	cosiProtocol.NSubtrees = nSubtrees
+	cosiProtocol.Timeout = defaultTimeout
+	cosiProtocol.MaxSubleaderRetries = -1
+	// the root and the second subtree
+	threshold := 1 + (nNodes-1)/nSubtrees
+	cosiProtocol.Threshold = threshold
+	require.Nil(t, cosiProtocol.Start())
+
+	_, err = getAndVerifySignature(cosiProtocol, publics, proposal, cosi.NewThresholdPolicy(threshold))
+	require.Nil(t, err)
+	skipped := cosiProtocol.SkippedNodes()
+	require.Equal(t, 1, len(skipped))
+	require.True(t, skipped[0].ID.Equal(subleaderIds[0]))
+}
+
 // Tests that the protocol throws errors with invalid configurations
 func TestProtocolErrors(t *testing.T) {
 	nodes := []int{1, 2, 24}
@@ -343,6 +588,26 @@ func TestProtocolErrors(t *testing.T) {
 				t.Fatal("protocol should throw an error if called without a proposal, but doesn't")
 			}
 
+			// sub-leader timeout bigger than the timeout
+			pi, err = local.CreateProtocol(DefaultProtocolName, tree)
+			if err != nil {
+				local.CloseAll()
+				t.Fatal("Error in creation of protocol:", err)
+			}
+			cosiProtocol = pi.(*FtCosi)
+			cosiProtocol.CreateProtocol = local.CreateProtocol
+			cosiProtocol.Msg = proposal
+			cosiProtocol.NSubtrees = nSubtrees
+			cosiProtocol.Timeout = defaultTimeout
+			cosiProtocol.Threshold = nNodes
+			cosiProtocol.SubleaderTimeout = 2 * defaultTimeout
+
+			err = cosiProtocol.Start()
+			if err == nil {
+				local.CloseAll()
+				t.Fatal("protocol should throw an error if the sub-leader timeout is too big, but doesn't")
+			}
+
 			local.CloseAll()
 		}
 	}
@@ -398,11 +663,89 @@ func TestProtocolRefusalAll(t *testing.T) {
 
 			require.Nil(t, signature)
 
+			// the root knows why the signature failed
+			refusals := cosiProtocol.Refusals()
+			require.NotEqual(t, 0, len(refusals))
+			for _, r := range refusals {
+				require.Equal(t, RefusalVerification, r.Reason, r.String())
+				require.Equal(t, "refusing", r.Message)
+				require.NotEqual(t, 0, r.Index)
+			}
+
 			local.CloseAll()
 		}
 	}
 }
 
+// Tests that no signature is produced if the policy isn't fulfilled
+func TestProtocolPolicy(t *testing.T) {
+	nNodes := 5
+	proposal := []byte{0xFF}
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(nNodes, false)
+	publics := tree.Roster.Publics()
+
+	run := func(policy cosi.Policy) []byte {
+		pi, err := local.CreateProtocol(DefaultProtocolName, tree)
+		require.Nil(t, err)
+		cosiProtocol := pi.(*FtCosi)
+		cosiProtocol.CreateProtocol = local.CreateProtocol
+		cosiProtocol.Msg = proposal
+		cosiProtocol.NSubtrees = 2
+		cosiProtocol.Timeout = defaultTimeout
+		cosiProtocol.Threshold = nNodes
+		cosiProtocol.Policy = policy
+		require.Nil(t, cosiProtocol.Start())
+		return <-cosiProtocol.FinalSignature
+	}
+
+	policy := NewWeightedPolicy([]int{1, 1, 1, 1, 5}, 9)
+	sig := run(policy)
+	require.NotNil(t, sig)
+	require.Nil(t, verifySignature(sig, publics, proposal, policy))
+
+	require.Nil(t, run(NewWeightedPolicy([]int{1, 1, 1, 1, 5}, 10)))
+
+	// the weights of the nodes that signed are added up
+	mask, err := cosi.NewMask(testSuite, publics, nil)
+	require.Nil(t, err)
+	require.Nil(t, mask.SetBit(0, true))
+	require.Nil(t, mask.SetBit(4, true))
+	require.False(t, policy.Check(mask))
+	require.True(t, NewWeightedPolicy([]int{1, 1, 1, 1, 5}, 6).Check(mask))
+	require.False(t, NewWeightedPolicy([]int{1, 1}, 2).Check(mask))
+}
+
+// Tests that the nodes are told when the root aborts a round
+func TestProtocolAbort(t *testing.T) {
+	nNodes := 5
+	counter = &Counter{refuseIdx: nNodes - 1}
+	local := onet.NewLocalTest(testSuite)
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(nNodes, false)
+
+	pi, err := local.CreateProtocol(AbortProtocolName, tree)
+	require.Nil(t, err)
+	cosiProtocol := pi.(*FtCosi)
+	cosiProtocol.CreateProtocol = local.CreateProtocol
+	cosiProtocol.Msg = []byte{0xFF}
+	cosiProtocol.NSubtrees = 1
+	cosiProtocol.Timeout = defaultTimeout
+	cosiProtocol.Threshold = nNodes
+	require.Nil(t, cosiProtocol.Start())
+	require.Nil(t, <-cosiProtocol.FinalSignature)
+
+	// the sub-leader and the leaves that accepted still wait for the
+	// challenge and are told that the round is aborted
+	select {
+	case reason := <-aborts:
+		require.Contains(t, reason.Error(), "refusals")
+	case <-time.After(defaultTimeout):
+		t.Fatal("nodes didn't get the abort")
+	}
+}
+
 func TestProtocolRefuseOne(t *testing.T) {
 	nodes := []int{4, 5, 13}
 	subtrees := []int{1, 2, 5, 9}
@@ -508,12 +851,12 @@ type Counter struct {
 
 var counter = &Counter{}
 
-func refuse(n *onet.TreeNodeInstance, msg, data []byte) bool {
+func refuse(n *onet.TreeNodeInstance, msg, data []byte) error {
 	counter.Lock()
 	defer counter.Unlock()
 	defer func() { counter.veriCount++ }()
 	if n.TreeNode().RosterIndex == counter.refuseIdx {
-		return false
+		return errors.New("refusing")
 	}
-	return true
+	return nil
 }
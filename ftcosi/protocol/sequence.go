@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dedis/onet/network"
+)
+
+// sequences keeps the highest sequence every node got for every root and
+// protocol. It is shared by all the nodes of this process.
+var sequences = &sequenceTracker{
+	highest: make(map[string]uint64),
+	stores:  make(map[network.ServerIdentityID]SequenceStore),
+}
+
+// SequenceStore persists the highest sequences a node got, so that it still
+// refuses the stale rounds once it restarted.
+type SequenceStore interface {
+	// LoadSequence returns the highest sequence stored for key, or 0.
+	LoadSequence(key string) (uint64, error)
+	// StoreSequence stores seq as the highest sequence for key.
+	StoreSequence(key string, seq uint64) error
+}
+
+// RegisterSequenceStore sets the store of the sequences of the node with the
+// given ID. The services call it when they start, before the node takes part
+// in rounds with a sequence.
+func RegisterSequenceStore(id network.ServerIdentityID, store SequenceStore) {
+	sequences.Lock()
+	defer sequences.Unlock()
+	sequences.stores[id] = store
+}
+
+type sequenceTracker struct {
+	highest map[string]uint64
+	stores  map[network.ServerIdentityID]SequenceStore
+	sync.Mutex
+}
+
+// check returns an error if a higher sequence than seq has already been seen
+// for key by the node id, else it records seq. A sequence of 0 is never
+// checked. The same sequence can be announced again, as the root restarts the
+// subtrees of sub-leaders that fail. If the node has a store, the sequence
+// is only accepted once it is stored.
+func (st *sequenceTracker) check(id network.ServerIdentityID, key string, seq uint64) error {
+	if seq == 0 {
+		return nil
+	}
+	st.Lock()
+	defer st.Unlock()
+	store := st.stores[id]
+	highest, ok := st.highest[key]
+	if !ok && store != nil {
+		var err error
+		highest, err = store.LoadSequence(key)
+		if err != nil {
+			return fmt.Errorf("couldn't load the sequence: %v", err)
+		}
+	}
+	if seq < highest {
+		return fmt.Errorf("stale sequence %d, already got %d", seq, highest)
+	}
+	if store != nil && seq > highest {
+		if err := store.StoreSequence(key, seq); err != nil {
+			return fmt.Errorf("couldn't store the sequence: %v", err)
+		}
+	}
+	st.highest[key] = seq
+	return nil
+}
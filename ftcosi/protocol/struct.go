@@ -10,6 +10,7 @@ so that it can find out who sent the message.
 import (
 	"crypto/cipher"
 	"crypto/sha512"
+	"fmt"
 	"hash"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/dedis/kyber/sign/cosi"
 	"github.com/dedis/kyber/util/random"
 	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
 )
 
 // DefaultProtocolName can be used from other packages to refer to this protocol.
@@ -53,6 +55,14 @@ type Announcement struct {
 	Publics   []kyber.Point
 	Timeout   time.Duration
 	Threshold int
+	// Sequence identifies the round, see FtCosi.Sequence.
+	Sequence uint64
+	// LeaderTimeout is how long the nodes wait for the challenge after the
+	// announcement before they consider the root as failed. If it is 0,
+	// they wait until the root stops them.
+	LeaderTimeout time.Duration
+	// SequenceID is the one of the round, see FtCosi.SequenceID.
+	SequenceID []byte
 }
 
 // StructAnnouncement just contains Announcement and the data necessary to identify and
@@ -67,6 +77,74 @@ type Commitment struct {
 	CoSiCommitment kyber.Point
 	Mask           []byte
 	NRefusal       int
+	// Refusals tells which nodes of the subtree didn't commit and why.
+	Refusals []Refusal
+	// Timings tells how long the verification took on the nodes of the
+	// subtree that answered.
+	Timings []VerificationTiming
+	// Sequence is the one of the announcement, commitments of other rounds
+	// are ignored.
+	Sequence uint64
+}
+
+// VerificationTiming is how long the verification function took on a node.
+type VerificationTiming struct {
+	// Index of the node in the roster.
+	Index    int
+	Duration time.Duration
+}
+
+// VerificationStats sums up the verification timings of the nodes, so that
+// slow nodes can be found.
+type VerificationStats struct {
+	// Count is the number of nodes that reported a timing.
+	Count  int
+	Min    time.Duration
+	Median time.Duration
+	Max    time.Duration
+	// Slowest is the roster index of the node that took Max.
+	Slowest int
+}
+
+// RefusalReason tells why a node didn't sign.
+type RefusalReason int
+
+const (
+	// RefusalVerification is used if the verification function of the node
+	// refused the proposal.
+	RefusalVerification RefusalReason = iota + 1
+	// RefusalTimeout is used if the node didn't answer in time.
+	RefusalTimeout
+	// RefusalNetwork is used if the node couldn't be contacted.
+	RefusalNetwork
+)
+
+func (r RefusalReason) String() string {
+	switch r {
+	case RefusalVerification:
+		return "verification refused"
+	case RefusalTimeout:
+		return "timeout"
+	case RefusalNetwork:
+		return "network error"
+	}
+	return fmt.Sprintf("unknown reason %d", int(r))
+}
+
+// Refusal is a node that didn't sign together with the reason.
+type Refusal struct {
+	// Index of the node in the roster.
+	Index  int
+	Reason RefusalReason
+	// Message gives more details, it may be empty.
+	Message string
+}
+
+func (r Refusal) String() string {
+	if r.Message == "" {
+		return fmt.Sprintf("node %d: %s", r.Index, r.Reason)
+	}
+	return fmt.Sprintf("node %d: %s (%s)", r.Index, r.Reason, r.Message)
 }
 
 // StructCommitment just contains Commitment and the data necessary to identify and
@@ -106,10 +184,19 @@ type StructResponse struct {
 }
 
 // Stop is a message used to instruct a node to stop its protocol
-type Stop struct{}
+type Stop struct {
+	// Reason is set if the root aborted the round.
+	Reason string
+}
 
 // StructStop is a wrapper around Stop for it to work with onet
 type StructStop struct {
 	*onet.TreeNode
 	Stop
 }
+
+// AbortFn is called on a node if the round it signs is aborted by the root,
+// or if the root doesn't go on with the round in time, for example because
+// it died. The service can then start a view-change right away. msg is the
+// message of the round. It must not block.
+type AbortFn func(leader *network.ServerIdentity, msg []byte, reason error)
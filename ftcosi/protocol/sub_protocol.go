@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"sync"
@@ -20,11 +21,19 @@ func init() {
 // SubFtCosi holds the different channels used to receive the different protocol messages.
 type SubFtCosi struct {
 	*onet.TreeNodeInstance
-	Publics        []kyber.Point
-	Msg            []byte
-	Data           []byte
-	Timeout        time.Duration
-	Threshold      int
+	Publics       []kyber.Point
+	Msg           []byte
+	Data          []byte
+	Timeout       time.Duration
+	Threshold     int
+	Sequence      uint64
+	SequenceID    []byte
+	LeaderTimeout time.Duration
+	// OnAbort is called if the round is aborted, see AbortFn. It can be
+	// set when the protocol instance is created.
+	OnAbort        AbortFn
+	stopReason     string
+	stopMutex      sync.Mutex
 	stoppedOnce    sync.Once
 	verificationFn VerificationFn
 	suite          cosi.Suite
@@ -45,7 +54,7 @@ type SubFtCosi struct {
 // NewDefaultSubProtocol is the default sub-protocol function used for registration
 // with an always-true verification.
 func NewDefaultSubProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-	vf := func(a, b []byte) bool { return true }
+	vf := func(a, b []byte) error { return nil }
 	return NewSubFtCosi(n, vf, cothority.Suite)
 }
 
@@ -53,17 +62,6 @@ func NewDefaultSubProtocol(n *onet.TreeNodeInstance) (onet.ProtocolInstance, err
 // the channels where the messages will be received.
 func NewSubFtCosi(n *onet.TreeNodeInstance, vf VerificationFn, suite cosi.Suite) (onet.ProtocolInstance, error) {
 
-	// tests if it's a three level tree
-	moreThreeLevel := false
-	n.Tree().Root.Visit(0, func(depth int, n *onet.TreeNode) {
-		if depth > 2 {
-			moreThreeLevel = true
-		}
-	})
-	if moreThreeLevel {
-		return nil, fmt.Errorf("subFtCosi launched with a more than three level tree")
-	}
-
 	c := &SubFtCosi{
 		TreeNodeInstance: n,
 		verificationFn:   vf,
@@ -94,7 +92,7 @@ func NewSubFtCosi(n *onet.TreeNodeInstance, vf VerificationFn, suite cosi.Suite)
 func (p *SubFtCosi) Dispatch() error {
 	defer func() {
 		if p.IsRoot() {
-			err := p.Broadcast(&Stop{})
+			err := p.Broadcast(&Stop{p.getStopReason()})
 			if err != nil {
 				log.Error("error while broadcasting stopping message:", err)
 			}
@@ -109,7 +107,7 @@ func (p *SubFtCosi) Dispatch() error {
 	for {
 		announcement, channelOpen = <-p.ChannelAnnouncement
 		if !channelOpen {
-			return nil
+			return p.stopped()
 		}
 		if !isValidSender(announcement.TreeNode, p.Parent(), p.TreeNode()) {
 			log.Warn(p.ServerIdentity(), "received announcement from node", announcement.ServerIdentity,
@@ -132,6 +130,9 @@ func (p *SubFtCosi) Dispatch() error {
 	p.Msg = announcement.Msg
 	p.Data = announcement.Data
 	p.Threshold = announcement.Threshold
+	p.Sequence = announcement.Sequence
+	p.SequenceID = announcement.SequenceID
+	p.LeaderTimeout = announcement.LeaderTimeout
 
 	// verify that threshold is valid
 	maxThreshold := p.Tree().Size() - 1
@@ -145,25 +146,44 @@ func (p *SubFtCosi) Dispatch() error {
 	if !p.IsRoot() {
 		go func() {
 			log.Lvl3(p.ServerIdentity(), "starting verification in the background")
-			verificationOk := p.verificationFn(p.Msg, p.Data)
+			var duration time.Duration
+			verificationErr := sequences.check(p.ServerIdentity().ID, p.sequenceKey(), p.Sequence)
+			if verificationErr == nil {
+				start := time.Now()
+				verificationErr = p.verificationFn(p.Msg, p.Data)
+				duration = time.Since(start)
+			}
 
 			var personalStructCommitment StructCommitment
 			var err error
-			secret, personalStructCommitment, err = p.getCommitment(verificationOk)
+			secret, personalStructCommitment, err = p.getCommitment(verificationErr, duration)
 			if err != nil {
 				log.Error("error while generating own commitment:", err)
 				return
 			}
 			p.ChannelCommitment <- personalStructCommitment
-			log.Lvl3(p.ServerIdentity(), "verification done:", verificationOk)
+			log.Lvl3(p.ServerIdentity(), "verification done:", verificationErr)
 		}()
 	}
 
+	// children the announcement couldn't be sent to
+	var unreachable []*onet.TreeNode
+	var unreachableMutex sync.Mutex
 	if !p.IsLeaf() {
-		// Only send commits if the node has children
+		// Only send commits if the node has children. The nodes below
+		// the sub-leader that have children of their own get the timeout
+		// of this node, so that they answer before it times out.
+		forward := announcement.Announcement
+		if !p.IsRoot() && !childrenAreLeaves(p.TreeNode()) {
+			forward.Timeout = p.Timeout
+		}
 		go func() {
-			if errs := p.SendToChildrenInParallel(&announcement.Announcement); len(errs) > 0 {
+			failed, errs := p.multicastParallel(&forward, p.Children()...)
+			if len(errs) > 0 {
 				log.Error(p.ServerIdentity(), "failed to send announcement to all children, trying to continue")
+				unreachableMutex.Lock()
+				unreachable = failed
+				unreachableMutex.Unlock()
 			}
 		}()
 	}
@@ -176,11 +196,18 @@ func (p *SubFtCosi) Dispatch() error {
 	var challengeMask *cosi.Mask                                   // the mask received in the challenge, set only if not root.
 	var childrenCanResponse = make([]*onet.TreeNode, 0)            // the list of children that can send a response. That is the list of children present in the challenge mask.
 
-	var NRefusal = 0                  // number of refusal received. Will be used only for the subleader
-	var firstCommitmentSent = false   // to avoid sending the quick commitment multiple times
-	var verificationDone = false      // to send the aggregate commitment only once this node has done its verification
-	var timedOut = false              // to refuse new commitments once it times out
-	var t = time.After(p.Timeout / 2) // the timeout
+	var NRefusal = 0                   // number of refusal received. Will be used only for the subleader
+	var accepted = 0                   // number of nodes in the accepted commitments
+	var refusals []Refusal             // the nodes that refused, with their reason
+	var timings []VerificationTiming   // the verification timings of the nodes that answered
+	var firstCommitmentSent = false    // to avoid sending the quick commitment multiple times
+	var verificationDone = false       // to send the aggregate commitment only once this node has done its verification
+	var timedOut = false               // to refuse new commitments once it times out
+	var t = time.After(p.Timeout / 2)  // the timeout
+	var leaderTimeout <-chan time.Time // the timeout for the challenge of the root
+	if !p.IsRoot() && p.LeaderTimeout > 0 {
+		leaderTimeout = time.After(p.LeaderTimeout)
+	}
 
 	copy(nodesCanCommit, p.Children())
 	if p.IsRoot() {
@@ -194,13 +221,18 @@ loop:
 		select {
 		case commitment, channelOpen := <-p.ChannelCommitment:
 			if !channelOpen {
-				return nil
+				return p.stopped()
 			}
 			if timedOut {
 				// ignore new commits once time-out has been reached
 				break
 			}
 
+			if commitment.Sequence != p.Sequence {
+				log.Warn(p.ServerIdentity(), "received a Commitment from node", commitment.ServerIdentity,
+					"for sequence", commitment.Sequence, "instead of", p.Sequence, ", ignored")
+				break // discards it
+			}
 			if !isValidSender(commitment.TreeNode, nodesCanCommit...) {
 				log.Warn(p.ServerIdentity(), "received a Commitment from node", commitment.ServerIdentity,
 					"that is not in the list of nodes that can still commit, ignored")
@@ -230,38 +262,53 @@ loop:
 				if err != nil {
 					return err
 				}
-				if verificationMask.CountEnabled() > 1 {
+				maxEnabled := 1
+				if !commitment.TreeNode.Equal(p.TreeNode()) {
+					maxEnabled = subtreeSize(commitment.TreeNode)
+				}
+				if verificationMask.CountEnabled() > maxEnabled {
 					log.Warn(p.ServerIdentity(), "received commitment with ill-formed mask in non-root node: has",
-						verificationMask.CountEnabled(), "nodes enabled instead of 0 or 1, ignored")
+						verificationMask.CountEnabled(), "nodes enabled instead of at most", maxEnabled, ", ignored")
 					break
 				}
 
+				timings = append(timings, commitment.Timings...)
+				refusals = append(refusals, commitment.Refusals...)
+
 				// checks if commitment is a refusal or acceptance
 				if commitment.CoSiCommitment.Equal(p.suite.Point().Null()) { // refusal
-					NRefusal++
+					if commitment.NRefusal > 1 {
+						NRefusal += commitment.NRefusal
+					} else {
+						NRefusal++
+					}
 					if p.IsLeaf() {
 						log.Warn(p.ServerIdentity(), "leaf refused Commitment, marking as not signed")
-						return p.sendAggregatedCommitments([]StructCommitment{}, 1)
+						return p.sendAggregatedCommitments([]StructCommitment{}, 1, refusals, timings)
 					}
 					log.Warn(p.ServerIdentity(), "non-leaf got refusal")
 				} else {
-					// accepted
+					// accepted, the commitment of a node with children
+					// can carry the refusals of its subtree
 					commitments = append(commitments, commitment)
+					accepted += verificationMask.CountEnabled()
+					NRefusal += commitment.NRefusal
 				}
 
-				thresholdRefusal := (1 + len(p.Children()) - p.Threshold) + 1
+				thresholdRefusal := (subtreeSize(p.TreeNode()) - p.Threshold) + 1
 
-				// checks if threshold is reached or unreachable
-				quickAnswer := !firstCommitmentSent &&
-					(len(commitments) >= p.Threshold || // quick valid answer
+				// checks if threshold is reached or unreachable, only the
+				// sub-leader answers before its whole subtree committed
+				quickAnswer := !firstCommitmentSent && p.Parent().Equal(p.Root()) &&
+					(accepted >= p.Threshold || // quick valid answer
 						NRefusal >= thresholdRefusal) // quick refusal answer
 
 				// checks if every child and himself committed
-				finalAnswer := len(commitments)+NRefusal == len(p.Children())+1
+				finalAnswer := len(nodesCanCommit) == 0
 
 				if (quickAnswer || finalAnswer) && verificationDone {
 
-					err = p.sendAggregatedCommitments(commitments, NRefusal)
+					err = p.sendAggregatedCommitments(commitments, NRefusal, refusals, timings)
 					if err != nil {
 						return err
 					}
@@ -275,14 +322,14 @@ loop:
 				}
 
 				// security check
-				if len(commitments)+NRefusal > maxThreshold {
-					log.Error(p.ServerIdentity(), "more commitments (", len(commitments),
+				if accepted+NRefusal > maxThreshold {
+					log.Error(p.ServerIdentity(), "more commitments (", accepted,
 						") and refusals (", NRefusal, ") than possible in subleader (", maxThreshold, ")")
 				}
 			}
 		case challenge, channelOpen = <-p.ChannelChallenge:
 			if !channelOpen {
-				return nil
+				return p.stopped()
 			}
 			if !isValidSender(challenge.TreeNode, p.Parent(), p.TreeNode()) {
 				log.Warn(p.ServerIdentity(), "received a Challenge from node", challenge.ServerIdentity,
@@ -309,7 +356,7 @@ loop:
 					return fmt.Errorf("error in setting challenge mask: %s", err)
 				}
 				for _, child := range p.Children() {
-					isEnabled, err := challengeMask.KeyEnabled(child.ServerIdentity.Public)
+					isEnabled, err := subtreeEnabled(challengeMask, child)
 					if err != nil {
 						return fmt.Errorf("error in checking a child presence in challenge mask: %s", err)
 					}
@@ -322,12 +369,19 @@ loop:
 			childrenToSendChallenge := make([]*onet.TreeNode, len(childrenCanResponse))
 			copy(childrenToSendChallenge, childrenCanResponse) // copy to avoid data race
 			go func() {
-				if errs := p.multicastParallel(&challenge.Challenge, childrenToSendChallenge...); len(errs) > 0 {
+				if _, errs := p.multicastParallel(&challenge.Challenge, childrenToSendChallenge...); len(errs) > 0 {
 					log.Error(p.ServerIdentity(), errs)
 				}
 			}()
 
 			break loop
+		case <-leaderTimeout:
+			err := fmt.Errorf("no challenge from the root after %s", p.LeaderTimeout)
+			log.Lvl2(p.ServerIdentity(), err)
+			if p.OnAbort != nil {
+				p.OnAbort(p.Root().ServerIdentity, p.Msg, err)
+			}
+			return err
 		case <-t:
 			if p.IsRoot() {
 				log.Warn(p.ServerIdentity(), "timed out while waiting for subleader commitment")
@@ -336,8 +390,22 @@ loop:
 			}
 			log.Warn(p.ServerIdentity(), "timed out while waiting for commits, got", len(commitments), "commitments and", NRefusal, "refusals")
 
+			// report the children that didn't commit
+			unreachableMutex.Lock()
+			for _, node := range nodesCanCommit {
+				if node.Equal(p.TreeNode()) {
+					continue
+				}
+				reason := RefusalTimeout
+				if isValidSender(node, unreachable...) {
+					reason = RefusalNetwork
+				}
+				refusals = append(refusals, Refusal{Index: node.RosterIndex, Reason: reason})
+			}
+			unreachableMutex.Unlock()
+
 			// sending commits received
-			err = p.sendAggregatedCommitments(commitments, NRefusal)
+			err = p.sendAggregatedCommitments(commitments, NRefusal, refusals, timings)
 			if err != nil {
 				return err
 			}
@@ -354,7 +422,7 @@ loop:
 		select {
 		case response, channelOpen := <-p.ChannelResponse:
 			if !channelOpen {
-				return nil
+				return p.stopped()
 			}
 
 			if !isValidSender(response.TreeNode, childrenCanResponse...) {
@@ -432,7 +500,8 @@ loop:
 	return nil
 }
 
-func (p *SubFtCosi) sendAggregatedCommitments(commitments []StructCommitment, NRefusal int) error {
+func (p *SubFtCosi) sendAggregatedCommitments(commitments []StructCommitment, NRefusal int,
+	refusals []Refusal, timings []VerificationTiming) error {
 
 	// aggregate commitments
 	commitment, mask, err := aggregateCommitments(p.suite, p.Publics, commitments)
@@ -441,7 +510,7 @@ func (p *SubFtCosi) sendAggregatedCommitments(commitments []StructCommitment, NR
 	}
 
 	// send to parent
-	err = p.SendToParent(&Commitment{commitment, mask.Mask(), NRefusal})
+	err = p.SendToParent(&Commitment{commitment, mask.Mask(), NRefusal, refusals, timings, p.Sequence})
 	if err != nil {
 		return err
 	}
@@ -457,6 +526,9 @@ func (p *SubFtCosi) HandleStop(stop StructStop) error {
 		log.Warn(p.ServerIdentity(), "received a Stop from node", stop.ServerIdentity,
 			"that is not the root, ignored")
 	}
+	p.stopMutex.Lock()
+	p.stopReason = stop.Reason
+	p.stopMutex.Unlock()
 	close(p.ChannelAnnouncement)
 	// close(p.ChannelCommitment) // Channel left open to allow verification function to safely return
 	close(p.ChannelChallenge)
@@ -464,6 +536,26 @@ func (p *SubFtCosi) HandleStop(stop StructStop) error {
 	return nil
 }
 
+func (p *SubFtCosi) getStopReason() string {
+	p.stopMutex.Lock()
+	defer p.stopMutex.Unlock()
+	return p.stopReason
+}
+
+// stopped is called once the protocol has been stopped and tells OnAbort
+// if the root aborted the round.
+func (p *SubFtCosi) stopped() error {
+	reason := p.getStopReason()
+	if reason == "" || p.IsRoot() {
+		return nil
+	}
+	log.Lvl2(p.ServerIdentity(), "round aborted by the root:", reason)
+	if p.OnAbort != nil {
+		p.OnAbort(p.Root().ServerIdentity, p.Msg, errors.New(reason))
+	}
+	return nil
+}
+
 // Start is done only by root and starts the subprotocol
 func (p *SubFtCosi) Start() error {
 	log.Lvl3(p.ServerIdentity(), "Starting subCoSi")
@@ -491,16 +583,25 @@ func (p *SubFtCosi) Start() error {
 
 	announcement := StructAnnouncement{
 		p.TreeNode(),
-		Announcement{p.Msg, p.Data, p.Publics, p.Timeout, p.Threshold},
+		Announcement{p.Msg, p.Data, p.Publics, p.Timeout, p.Threshold, p.Sequence, p.LeaderTimeout,
+			p.SequenceID},
 	}
 	p.ChannelAnnouncement <- announcement
 	return nil
 }
 
+// sequenceKey identifies the leader, the protocol and the sequence ID the
+// sequence of this node is tracked for.
+func (p *SubFtCosi) sequenceKey() string {
+	return p.ServerIdentity().ID.String() + "/" + p.Root().ServerIdentity.ID.String() +
+		"/" + p.ProtocolName() + "/" + hex.EncodeToString(p.SequenceID)
+}
+
 // generates a commitment.
-// the boolean indicates whether the commitment is a proposal acceptance or a proposal refusal.
+// the verification error indicates whether the commitment is a proposal acceptance or a proposal refusal.
+// the duration of the verification is reported with the commitment.
 // Returns the generated secret, the commitment and an error if there was a problem in the process.
-func (p *SubFtCosi) getCommitment(accepts bool) (kyber.Scalar, StructCommitment, error) {
+func (p *SubFtCosi) getCommitment(verificationErr error, duration time.Duration) (kyber.Scalar, StructCommitment, error) {
 
 	emptyMask, err := cosi.NewMask(p.suite, p.Publics, nil)
 	if err != nil {
@@ -508,10 +609,11 @@ func (p *SubFtCosi) getCommitment(accepts bool) (kyber.Scalar, StructCommitment,
 	}
 
 	structCommitment := StructCommitment{p.TreeNode(),
-		Commitment{p.suite.Point().Null(), emptyMask.Mask(), 0}}
+		Commitment{p.suite.Point().Null(), emptyMask.Mask(), 0, nil,
+			[]VerificationTiming{{Index: p.TreeNode().RosterIndex, Duration: duration}}, p.Sequence}}
 
 	var secret kyber.Scalar // nil
-	if accepts {
+	if verificationErr == nil {
 		secret, structCommitment.CoSiCommitment = cosi.Commit(p.suite)
 		var personalMask *cosi.Mask
 		personalMask, err = cosi.NewMask(p.suite, p.Publics, p.Public())
@@ -521,14 +623,18 @@ func (p *SubFtCosi) getCommitment(accepts bool) (kyber.Scalar, StructCommitment,
 		structCommitment.Mask = personalMask.Mask()
 	} else { // refuses
 		structCommitment.NRefusal++
+		structCommitment.Refusals = []Refusal{{Index: p.TreeNode().RosterIndex,
+			Reason: RefusalVerification, Message: verificationErr.Error()}}
 	}
 
 	return secret, structCommitment, nil
 }
 
 // multicastParallel can be moved to onet.TreeNodeInstance once it shows
-// promise.
-func (p *SubFtCosi) multicastParallel(msg interface{}, nodes ...*onet.TreeNode) []error {
+// promise. It returns the nodes the message couldn't be sent to, together
+// with the errors.
+func (p *SubFtCosi) multicastParallel(msg interface{}, nodes ...*onet.TreeNode) ([]*onet.TreeNode, []error) {
+	var failed []*onet.TreeNode
 	var errs []error
 	eMut := sync.Mutex{}
 	wg := sync.WaitGroup{}
@@ -538,6 +644,7 @@ func (p *SubFtCosi) multicastParallel(msg interface{}, nodes ...*onet.TreeNode)
 		go func(n2 *onet.TreeNode) {
 			if err := p.SendTo(n2, msg); err != nil {
 				eMut.Lock()
+				failed = append(failed, n2)
 				errs = append(errs, errors.New(name+": "+err.Error()))
 				eMut.Unlock()
 			}
@@ -545,7 +652,43 @@ func (p *SubFtCosi) multicastParallel(msg interface{}, nodes ...*onet.TreeNode)
 		}(node)
 	}
 	wg.Wait()
-	return errs
+	return failed, errs
+}
+
+// subtreeSize returns the number of nodes of the subtree of node, including
+// itself.
+func subtreeSize(node *onet.TreeNode) int {
+	size := 1
+	for _, child := range node.Children {
+		size += subtreeSize(child)
+	}
+	return size
+}
+
+// childrenAreLeaves returns true if no child of node has children.
+func childrenAreLeaves(node *onet.TreeNode) bool {
+	for _, child := range node.Children {
+		if len(child.Children) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// subtreeEnabled returns true if the key of node or of one of the nodes of
+// its subtree is enabled in the mask.
+func subtreeEnabled(mask *cosi.Mask, node *onet.TreeNode) (bool, error) {
+	isEnabled, err := mask.KeyEnabled(node.ServerIdentity.Public)
+	if err != nil || isEnabled {
+		return isEnabled, err
+	}
+	for _, child := range node.Children {
+		isEnabled, err = subtreeEnabled(mask, child)
+		if err != nil || isEnabled {
+			return isEnabled, err
+		}
+	}
+	return false, nil
 }
 
 // checks if a node is in a list of nodes
@@ -450,7 +450,7 @@ func createIdentity(l *onet.LocalTest, services []onet.Service, roster *onet.Ros
 }
 
 func registerCosiProtocols(c *onet.Context, protoName string) error {
-	vf := func(a, b []byte) bool { return true }
+	vf := func(a, b []byte) error { return nil }
 	suite := protocol.EdDSACompatibleCosiSuite
 	cosiSubProtoName := protoName + "_sub"
 
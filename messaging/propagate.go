@@ -156,6 +156,14 @@ func (p *Propagate) Dispatch() error {
 	var received int
 	var errs []error
 	subtreeCount := p.TreeNode().SubtreeCount()
+	// The root always reports the number of nodes that stored the data,
+	// even if the propagation failed, so that the caller doesn't wait
+	// forever.
+	defer func() {
+		if p.IsRoot() && p.onDoneCb != nil {
+			p.onDoneCb(received + 1)
+		}
+	}()
 
 	for process {
 		p.Lock()
@@ -226,11 +234,6 @@ func (p *Propagate) Dispatch() error {
 		}
 	}
 	log.Lvl3(p.ServerIdentity(), "done, isroot:", p.IsRoot())
-	if p.IsRoot() {
-		if p.onDoneCb != nil {
-			p.onDoneCb(received + 1)
-		}
-	}
 	return nil
 }
 
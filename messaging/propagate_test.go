@@ -76,6 +76,40 @@ func propagate(t *testing.T, nbrNodes, nbrFailures []int) {
 	}
 }
 
+// TestPropagation_TooManyFailures makes sure that the root returns the number
+// of nodes that stored the data instead of blocking if more nodes than
+// allowed fail.
+func TestPropagation_TooManyFailures(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	servers, el, _ := local.GenTree(4, true)
+	msg := &propagateMsg{[]byte("propagate")}
+	propFuncs := make([]PropagationFunc, len(servers))
+	var err error
+	for n, server := range servers {
+		pc := &PC{server, local.Overlays[server.ServerIdentity.ID]}
+		propFuncs[n], err = NewPropagationFunc(pc, "PropagateFailures",
+			func(m network.Message) {}, 0)
+		log.ErrFatal(err)
+	}
+	log.ErrFatal(servers[3].Close())
+
+	done := make(chan int)
+	go func() {
+		children, err := propFuncs[0](el, msg, 1*time.Second)
+		log.ErrFatal(err)
+		done <- children
+	}()
+	select {
+	case children := <-done:
+		if children >= len(servers) {
+			t.Fatal("closed node cannot have replied")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("propagation didn't return")
+	}
+}
+
 type PC struct {
 	C *onet.Server
 	O *onet.Overlay
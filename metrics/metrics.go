@@ -0,0 +1,83 @@
+// Package metrics holds the metrics of the conode and of its skipchains,
+// which are exported in the Prometheus format if the conode is configured
+// with a MetricsAddress.
+//
+// The metrics of a skipchain have a "chain" label with the hex ID of the
+// skipchain, see Chain. The go runtime and process metrics of the conode are
+// exported, too.
+package metrics
+
+import (
+	"encoding/hex"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cothority"
+
+var (
+	// BlockHeight is the index of the latest block of every skipchain
+	// stored by the conode.
+	BlockHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "skipchain",
+		Name:      "block_height",
+		Help:      "Index of the latest block of the skipchain.",
+	}, []string{"chain"})
+
+	// BlockLatency is the time a leader needs to add a new block, including
+	// the collective signature of the forward link.
+	BlockLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "skipchain",
+		Name:      "block_latency_seconds",
+		Help:      "Time to verify, sign and store a new block on the leader.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"chain"})
+
+	// Transactions counts the transactions stored in the blocks of every
+	// omniledger skipchain. Its rate is the throughput of the skipchain.
+	Transactions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "omniledger",
+		Name:      "transactions_total",
+		Help:      "Number of transactions stored in the blocks of the skipchain.",
+	}, []string{"chain"})
+
+	// ProofLatency is the time to create the proofs requested by the
+	// clients.
+	ProofLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "omniledger",
+		Name:      "proof_latency_seconds",
+		Help:      "Time to create a proof for a client.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+	}, []string{"chain"})
+
+	// ProtocolFailures counts the protocols that failed, by protocol name.
+	ProtocolFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "protocol_failures_total",
+		Help:      "Number of protocols that failed or timed out.",
+	}, []string{"protocol"})
+)
+
+func init() {
+	prometheus.MustRegister(BlockHeight, BlockLatency, Transactions,
+		ProofLatency, ProtocolFailures)
+}
+
+// Chain returns the value of the chain label of the skipchain id.
+func Chain(id []byte) string {
+	return hex.EncodeToString(id)
+}
+
+// Serve exports the metrics on http://address/metrics. It only returns if
+// the listener fails.
+func Serve(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return http.ListenAndServe(address, mux)
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	chain := Chain([]byte{1, 2})
+	require.Equal(t, "0102", chain)
+	BlockHeight.WithLabelValues(chain).Set(3)
+	Transactions.WithLabelValues(chain).Add(2)
+	ProtocolFailures.WithLabelValues("test").Inc()
+
+	srv := httptest.NewServer(promhttp.Handler())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), `cothority_skipchain_block_height{chain="0102"} 3`)
+	require.Contains(t, string(body), `cothority_omniledger_transactions_total{chain="0102"} 2`)
+	require.Contains(t, string(body), `cothority_protocol_failures_total{protocol="test"} 1`)
+}
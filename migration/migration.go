@@ -0,0 +1,91 @@
+// Package migration upgrades the layout of the buckets that the services
+// store in the bolt database of the conode, so that a conode can be updated
+// without wiping its data.
+//
+// The schema version of every bucket is stored in the VersionsBucket. A
+// bucket without a version has version 0, the layout before the versioning
+// was introduced. When a service opens a bucket, it calls Schema.Upgrade,
+// which runs the missing migrations and stores the new version in the same
+// transaction. New buckets are empty, so they are upgraded to the current
+// version without changes.
+package migration
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/onet/log"
+)
+
+// VersionsBucket holds the schema version of the other buckets.
+var VersionsBucket = []byte("schema-versions")
+
+// Migration upgrades a bucket to the next version.
+type Migration struct {
+	// Description is logged when the migration runs.
+	Description string
+	// Run changes the layout of the bucket name in tx.
+	Run func(tx *bolt.Tx, name []byte) error
+}
+
+// Schema describes the layouts of a kind of bucket. The migration at index
+// i upgrades a bucket from version i to i+1.
+type Schema []Migration
+
+// Current returns the version of the latest layout.
+func (s Schema) Current() int {
+	return len(s)
+}
+
+// Upgrade runs the migrations of the bucket name from its stored version to
+// the current one, and returns the version it had. It fails if the bucket
+// is newer than the schema, e.g. if the conode has been downgraded.
+func (s Schema) Upgrade(tx *bolt.Tx, name []byte) (int, error) {
+	old, err := Version(tx, name)
+	if err != nil {
+		return 0, err
+	}
+	if old > s.Current() {
+		return old, fmt.Errorf("bucket %s has version %d, but the latest known version is %d",
+			name, old, s.Current())
+	}
+	for v := old; v < s.Current(); v++ {
+		log.Lvlf1("Migrating bucket %s to version %d: %s", name, v+1, s[v].Description)
+		if err := s[v].Run(tx, name); err != nil {
+			return old, fmt.Errorf("migration of bucket %s to version %d failed: %v", name, v+1, err)
+		}
+	}
+	if old == s.Current() {
+		return old, nil
+	}
+	return old, SetVersion(tx, name, s.Current())
+}
+
+// Version returns the stored version of the bucket name, 0 if it has none.
+func Version(tx *bolt.Tx, name []byte) (int, error) {
+	b := tx.Bucket(VersionsBucket)
+	if b == nil {
+		return 0, nil
+	}
+	v := b.Get(name)
+	if v == nil {
+		return 0, nil
+	}
+	if len(v) != 4 {
+		return 0, errors.New("invalid schema version")
+	}
+	return int(binary.BigEndian.Uint32(v)), nil
+}
+
+// SetVersion stores the version of the bucket name.
+func SetVersion(tx *bolt.Tx, name []byte, version int) error {
+	b, err := tx.CreateBucketIfNotExists(VersionsBucket)
+	if err != nil {
+		return err
+	}
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, uint32(version))
+	return b.Put(name, v)
+}
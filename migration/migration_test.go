@@ -0,0 +1,79 @@
+package migration
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema_Upgrade(t *testing.T) {
+	f, err := ioutil.TempFile("", "migration")
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	defer os.Remove(f.Name())
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	require.Nil(t, err)
+	defer db.Close()
+
+	name := []byte("data")
+	var runs []int
+	migration := func(v int) Migration {
+		return Migration{
+			Description: "test",
+			Run: func(tx *bolt.Tx, n []byte) error {
+				require.Equal(t, name, n)
+				runs = append(runs, v)
+				return tx.Bucket(n).Put([]byte{byte(v)}, []byte{})
+			},
+		}
+	}
+	upgrade := func(s Schema) (int, error) {
+		var old int
+		err := db.Update(func(tx *bolt.Tx) error {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+			var err error
+			old, err = s.Upgrade(tx, name)
+			return err
+		})
+		return old, err
+	}
+
+	old, err := upgrade(Schema{migration(1)})
+	require.Nil(t, err)
+	require.Equal(t, 0, old)
+	require.Equal(t, []int{1}, runs)
+
+	// Only the new migrations run.
+	old, err = upgrade(Schema{migration(1), migration(2), migration(3)})
+	require.Nil(t, err)
+	require.Equal(t, 1, old)
+	require.Equal(t, []int{1, 2, 3}, runs)
+	old, err = upgrade(Schema{migration(1), migration(2), migration(3)})
+	require.Nil(t, err)
+	require.Equal(t, 3, old)
+	require.Equal(t, []int{1, 2, 3}, runs)
+
+	// Downgrades are refused.
+	_, err = upgrade(Schema{migration(1)})
+	require.NotNil(t, err)
+
+	// A failed migration keeps the old version.
+	failing := Migration{Run: func(tx *bolt.Tx, n []byte) error {
+		tx.Bucket(n).Put([]byte("failed"), []byte{})
+		return os.ErrInvalid
+	}}
+	_, err = upgrade(Schema{migration(1), migration(2), migration(3), failing})
+	require.NotNil(t, err)
+	require.Nil(t, db.View(func(tx *bolt.Tx) error {
+		v, err := Version(tx, name)
+		require.Nil(t, err)
+		require.Equal(t, 3, v)
+		require.Nil(t, tx.Bucket(name).Get([]byte("failed")))
+		return nil
+	}))
+}
@@ -0,0 +1,263 @@
+// Package anchor publishes the state of an omniledger chain to external
+// blockchains, so that the history of the chain can be audited even if all
+// its nodes are gone or compromised later.
+//
+// An anchor holds the index and the hash of a block and the root of the
+// collection after that block. As the block is signed by the roster of the
+// chain and its hash binds the collection root, an anchor found in an
+// external chain proves that the state existed at the time of the external
+// transaction. The payload is 72 bytes, so it fits in a Bitcoin OP_RETURN
+// output.
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/client"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// magic starts every payload, with the version of the format.
+var magic = []byte("OLA1")
+
+// PayloadSize is the size of an encoded anchor.
+const PayloadSize = 4 + 4 + 32 + 32
+
+// Anchor is the state of a chain at a block.
+type Anchor struct {
+	// Index of the block.
+	Index int
+	// BlockID is the hash of the block.
+	BlockID skipchain.SkipBlockID
+	// Root is the collection root stored in the header of the block.
+	Root []byte
+}
+
+// Encode returns the payload published to the external chain.
+func (a Anchor) Encode() ([]byte, error) {
+	if len(a.BlockID) != 32 || len(a.Root) != 32 {
+		return nil, errors.New("block ID and root must be 32 bytes")
+	}
+	buf := make([]byte, 0, PayloadSize)
+	buf = append(buf, magic...)
+	buf = append(buf, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(buf[4:], uint32(a.Index))
+	buf = append(buf, a.BlockID...)
+	return append(buf, a.Root...), nil
+}
+
+// Decode returns the anchor of a payload returned by Encode.
+func Decode(buf []byte) (Anchor, error) {
+	if len(buf) != PayloadSize || !bytes.Equal(buf[:4], magic) {
+		return Anchor{}, errors.New("not an anchor payload")
+	}
+	return Anchor{
+		Index:   int(binary.BigEndian.Uint32(buf[4:8])),
+		BlockID: append(skipchain.SkipBlockID{}, buf[8:40]...),
+		Root:    append([]byte{}, buf[40:]...),
+	}, nil
+}
+
+// Publisher writes payloads to an external chain.
+type Publisher interface {
+	// Name of the external chain.
+	Name() string
+	// Publish writes the payload and returns the reference of the
+	// transaction holding it, e.g. its hash.
+	Publish(ctx context.Context, payload []byte) (string, error)
+	// Lookup returns the payload of the transaction ref. It fails if the
+	// transaction is not confirmed yet.
+	Lookup(ctx context.Context, ref string) ([]byte, error)
+}
+
+// Record is an anchor published to an external chain.
+type Record struct {
+	Anchor
+	// Publisher is the name of the external chain.
+	Publisher string
+	// Ref is the reference returned by the publisher.
+	Ref string
+	// Time of the publication.
+	Time time.Time
+}
+
+// Anchorer periodically publishes the latest block of a chain.
+type Anchorer struct {
+	// Client of the chain, the latest block is verified with it.
+	Client *client.Client
+	// Publisher of the anchors.
+	Publisher Publisher
+	// Interval between two anchors.
+	Interval time.Duration
+	// OnAnchor is called with every published anchor, if it is set.
+	OnAnchor func(Record)
+
+	last *Record
+}
+
+// Run publishes an anchor every Interval until ctx is done. No anchor is
+// published if no block has been added since the previous one. Errors are
+// logged and the anchor is tried again at the next interval.
+func (a *Anchorer) Run(ctx context.Context) error {
+	if a.Interval <= 0 {
+		return errors.New("the interval must be positive")
+	}
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := a.AnchorLatest(ctx); err != nil {
+			log.Error("couldn't publish anchor:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// AnchorLatest publishes the latest verified block of the chain. It returns
+// nil if that block has already been anchored.
+func (a *Anchorer) AnchorLatest(ctx context.Context) (*Record, error) {
+	p, err := a.Client.GetProof(ctx, service.GenesisReferenceID.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if a.last != nil && a.last.BlockID.Equal(p.Latest.Hash) {
+		return nil, nil
+	}
+	header, err := decodeHeader(&p.Latest)
+	if err != nil {
+		return nil, err
+	}
+	anchor := Anchor{
+		Index:   p.Latest.Index,
+		BlockID: p.Latest.Hash,
+		Root:    header.CollectionRoot,
+	}
+	payload, err := anchor.Encode()
+	if err != nil {
+		return nil, err
+	}
+	ref, err := a.Publisher.Publish(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	a.last = &Record{
+		Anchor:    anchor,
+		Publisher: a.Publisher.Name(),
+		Ref:       ref,
+		Time:      time.Now(),
+	}
+	log.Lvlf2("Anchored block %d of %x in %s transaction %s", anchor.Index,
+		a.Client.ID, a.last.Publisher, ref)
+	if a.OnAnchor != nil {
+		a.OnAnchor(*a.last)
+	}
+	return a.last, nil
+}
+
+// Verify reads the anchor of the transaction ref of the external chain and
+// checks that it is the state of the chain of c at the anchored block: the
+// block is fetched together with a chain of forward-links from the genesis
+// block, which is verified, and its collection root must match.
+func Verify(ctx context.Context, c *client.Client, pub Publisher, ref string) (*Anchor, error) {
+	payload, err := pub.Lookup(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	anchor, err := Decode(payload)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := proveBlock(ctx, c, anchor.Index)
+	if err != nil {
+		return nil, err
+	}
+	if err = proof.Verify(); err != nil {
+		return nil, err
+	}
+	sb := proof.Latest()
+	if !sb.Hash.Equal(anchor.BlockID) {
+		return nil, fmt.Errorf("block %d of the chain is not the anchored block", anchor.Index)
+	}
+	header, err := decodeHeader(sb)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header.CollectionRoot, anchor.Root) {
+		return nil, errors.New("the collection root doesn't match the anchor")
+	}
+	return &anchor, nil
+}
+
+// proveBlock returns the chain proof from the genesis block to the block
+// at index, taking at every block the highest forward-link that doesn't go
+// past index. The proof must still be verified.
+func proveBlock(ctx context.Context, c *client.Client, index int) (*skipchain.ChainProof, error) {
+	cl := skipchain.NewClient()
+	sb, err := cl.GetSingleBlock(c.Roster, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	proof := &skipchain.ChainProof{GenesisID: c.ID}
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		proof.Blocks = append(proof.Blocks, sb.SkipBlockFix)
+		if sb.Index == index {
+			return proof, nil
+		}
+		var link *skipchain.ForwardLink
+		for h := len(sb.ForwardLink) - 1; h >= 0; h-- {
+			if sb.Index+pow(sb.BaseHeight, h) <= index && !sb.ForwardLink[h].IsEmpty() {
+				link = sb.ForwardLink[h]
+				break
+			}
+		}
+		if link == nil {
+			return nil, fmt.Errorf("no block %d in the chain", index)
+		}
+		next, err := cl.GetSingleBlock(c.Roster, link.To)
+		if err != nil {
+			return nil, err
+		}
+		if next.Index <= sb.Index || next.Index > index {
+			return nil, fmt.Errorf("forward-link of block %d goes to block %d", sb.Index, next.Index)
+		}
+		proof.Links = append(proof.Links, link)
+		sb = next
+	}
+}
+
+// pow returns base**exp.
+func pow(base, exp int) int {
+	r := 1
+	for i := 0; i < exp; i++ {
+		r *= base
+	}
+	return r
+}
+
+// decodeHeader returns the omniledger header of the block.
+func decodeHeader(sb *skipchain.SkipBlock) (*service.DataHeader, error) {
+	_, d, err := network.Unmarshal(sb.Data, cothority.Suite)
+	if err != nil {
+		return nil, err
+	}
+	header, ok := d.(*service.DataHeader)
+	if !ok {
+		return nil, errors.New("not an omniledger block")
+	}
+	return header, nil
+}
@@ -0,0 +1,132 @@
+package anchor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/client"
+	"github.com/dedis/cothority/omniledger/contracts"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+// memPublisher keeps the payloads in memory.
+type memPublisher struct {
+	txs [][]byte
+}
+
+func (m *memPublisher) Name() string {
+	return "memory"
+}
+
+func (m *memPublisher) Publish(ctx context.Context, payload []byte) (string, error) {
+	m.txs = append(m.txs, payload)
+	return fmt.Sprint(len(m.txs) - 1), nil
+}
+
+func (m *memPublisher) Lookup(ctx context.Context, ref string) ([]byte, error) {
+	for i, tx := range m.txs {
+		if fmt.Sprint(i) == ref {
+			return tx, nil
+		}
+	}
+	return nil, errors.New("unknown transaction")
+}
+
+func TestAnchor_Encode(t *testing.T) {
+	a := Anchor{Index: 12, BlockID: make([]byte, 32), Root: make([]byte, 32)}
+	a.BlockID[0] = 1
+	a.Root[0] = 2
+	buf, err := a.Encode()
+	require.Nil(t, err)
+	require.Equal(t, PayloadSize, len(buf))
+	require.True(t, len(buf) <= 80)
+	a2, err := Decode(buf)
+	require.Nil(t, err)
+	require.Equal(t, a, a2)
+
+	_, err = Decode(buf[1:])
+	require.NotNil(t, err)
+	buf[0] = 'X'
+	_, err = Decode(buf)
+	require.NotNil(t, err)
+	_, err = Anchor{BlockID: a.BlockID}.Encode()
+	require.NotNil(t, err)
+}
+
+func TestAnchorer(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+	msg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:value"}, signer.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 500 * time.Millisecond
+	msg.BaseHeight = 2
+	msg.MaximumHeight = 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	c, err := client.CreateChain(ctx, msg)
+	require.Nil(t, err)
+	pub := &memPublisher{}
+	a := &Anchorer{Client: c, Publisher: pub, Interval: time.Second}
+
+	rec, err := a.AnchorLatest(ctx)
+	require.Nil(t, err)
+	require.Equal(t, 0, rec.Index)
+	rec, err = a.AnchorLatest(ctx)
+	require.Nil(t, err)
+	require.Nil(t, rec)
+
+	// Add some blocks, so that the proof follows higher forward-links.
+	for i := 0; i < 5; i++ {
+		tx, err := c.Sign(service.Instructions{{
+			InstanceID: service.InstanceID{DarcID: msg.GenesisDarc.GetBaseID()},
+			Spawn: &service.Spawn{
+				ContractID: contracts.ContractValueID,
+				Args:       service.Arguments{{Name: "value", Value: []byte{byte(i)}}},
+			},
+		}}, signer)
+		require.Nil(t, err)
+		require.Nil(t, c.AddTransaction(ctx, tx))
+		_, err = c.WaitProof(ctx, tx.Instructions[0].DeriveID(contracts.ContractValueID), nil)
+		require.Nil(t, err)
+	}
+	rec, err = a.AnchorLatest(ctx)
+	require.Nil(t, err)
+	require.True(t, rec.Index >= 5)
+	require.Equal(t, "memory", rec.Publisher)
+
+	for _, ref := range []string{"0", rec.Ref} {
+		anchor, err := Verify(ctx, c, pub, ref)
+		require.Nil(t, err)
+		buf, err := anchor.Encode()
+		require.Nil(t, err)
+		require.Contains(t, pub.txs, buf)
+	}
+
+	// A wrong root or block is detected.
+	for _, pos := range []int{10, 50} {
+		buf := append([]byte{}, pub.txs[1]...)
+		buf[pos] ^= 1
+		pub.txs = append(pub.txs, buf)
+		_, err = Verify(ctx, c, pub, fmt.Sprint(len(pub.txs)-1))
+		require.NotNil(t, err)
+	}
+	_, err = Verify(ctx, c, pub, "100")
+	require.NotNil(t, err)
+}
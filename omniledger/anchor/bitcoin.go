@@ -0,0 +1,118 @@
+package anchor
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// DefaultConfirmations is the number of blocks needed on top of the
+// transaction of an anchor before Lookup returns it, unless the
+// Confirmations of the publisher is set.
+const DefaultConfirmations = 6
+
+// Bitcoin publishes anchors in the OP_RETURN output of transactions sent by
+// the wallet of a bitcoind node, which pays the fees.
+//
+// Lookup uses getrawtransaction, so the node must run with txindex=1 to find
+// transactions that are not in its wallet.
+type Bitcoin struct {
+	// Confirmations needed by Lookup.
+	Confirmations int
+	rpc           rpcClient
+}
+
+// NewBitcoin returns a publisher using the JSON-RPC API of the bitcoind
+// node at url.
+func NewBitcoin(url, user, password string) *Bitcoin {
+	return &Bitcoin{
+		Confirmations: DefaultConfirmations,
+		rpc:           rpcClient{url: url, version: "1.0", user: user, password: password},
+	}
+}
+
+// Name implements Publisher.
+func (b *Bitcoin) Name() string {
+	return "bitcoin"
+}
+
+// Publish implements Publisher. It returns the ID of the transaction.
+func (b *Bitcoin) Publish(ctx context.Context, payload []byte) (string, error) {
+	var raw string
+	outputs := map[string]string{"data": hex.EncodeToString(payload)}
+	if err := b.rpc.call(ctx, &raw, "createrawtransaction", []interface{}{}, outputs); err != nil {
+		return "", err
+	}
+	var funded struct {
+		Hex string `json:"hex"`
+	}
+	if err := b.rpc.call(ctx, &funded, "fundrawtransaction", raw); err != nil {
+		return "", err
+	}
+	var signed struct {
+		Hex      string `json:"hex"`
+		Complete bool   `json:"complete"`
+	}
+	if err := b.rpc.call(ctx, &signed, "signrawtransactionwithwallet", funded.Hex); err != nil {
+		return "", err
+	}
+	if !signed.Complete {
+		return "", errors.New("the wallet couldn't sign the transaction")
+	}
+	var txid string
+	if err := b.rpc.call(ctx, &txid, "sendrawtransaction", signed.Hex); err != nil {
+		return "", err
+	}
+	return txid, nil
+}
+
+// Lookup implements Publisher. It returns the data of the first OP_RETURN
+// output of the transaction.
+func (b *Bitcoin) Lookup(ctx context.Context, ref string) ([]byte, error) {
+	var tx struct {
+		Confirmations int `json:"confirmations"`
+		Vout          []struct {
+			ScriptPubKey struct {
+				Hex string `json:"hex"`
+			} `json:"scriptPubKey"`
+		} `json:"vout"`
+	}
+	if err := b.rpc.call(ctx, &tx, "getrawtransaction", ref, true); err != nil {
+		return nil, err
+	}
+	if tx.Confirmations < b.Confirmations {
+		return nil, fmt.Errorf("transaction has %d of %d confirmations", tx.Confirmations, b.Confirmations)
+	}
+	for _, out := range tx.Vout {
+		script, err := hex.DecodeString(out.ScriptPubKey.Hex)
+		if err != nil {
+			return nil, err
+		}
+		if data, ok := opReturnData(script); ok {
+			return data, nil
+		}
+	}
+	return nil, errors.New("transaction has no OP_RETURN output")
+}
+
+// opReturnData returns the data pushed by an OP_RETURN script.
+func opReturnData(script []byte) ([]byte, bool) {
+	const opReturn, opPushData1 = 0x6a, 0x4c
+	if len(script) < 2 || script[0] != opReturn {
+		return nil, false
+	}
+	n, data := int(script[1]), script[2:]
+	if script[1] == opPushData1 {
+		if len(script) < 3 {
+			return nil, false
+		}
+		n, data = int(script[2]), script[3:]
+	} else if n > 75 {
+		return nil, false
+	}
+	if len(data) != n {
+		return nil, false
+	}
+	return data, true
+}
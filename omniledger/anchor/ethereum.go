@@ -0,0 +1,88 @@
+package anchor
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Ethereum publishes anchors in the data of transactions from an account to
+// itself, sent with eth_sendTransaction. The account must be unlocked on
+// the node, which signs the transactions.
+type Ethereum struct {
+	// Confirmations needed by Lookup.
+	Confirmations int
+	from          string
+	rpc           rpcClient
+}
+
+// NewEthereum returns a publisher using the JSON-RPC API of the node at url,
+// sending the transactions from the account from.
+func NewEthereum(url, from string) *Ethereum {
+	return &Ethereum{
+		Confirmations: DefaultConfirmations,
+		from:          from,
+		rpc:           rpcClient{url: url, version: "2.0"},
+	}
+}
+
+// Name implements Publisher.
+func (e *Ethereum) Name() string {
+	return "ethereum"
+}
+
+// Publish implements Publisher. It returns the hash of the transaction.
+func (e *Ethereum) Publish(ctx context.Context, payload []byte) (string, error) {
+	tx := map[string]string{
+		"from":  e.from,
+		"to":    e.from,
+		"value": "0x0",
+		"data":  "0x" + hex.EncodeToString(payload),
+	}
+	var hash string
+	if err := e.rpc.call(ctx, &hash, "eth_sendTransaction", tx); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Lookup implements Publisher. It returns the data of the transaction.
+func (e *Ethereum) Lookup(ctx context.Context, ref string) ([]byte, error) {
+	var tx struct {
+		Input       string  `json:"input"`
+		BlockNumber *string `json:"blockNumber"`
+	}
+	if err := e.rpc.call(ctx, &tx, "eth_getTransactionByHash", ref); err != nil {
+		return nil, err
+	}
+	if tx.BlockNumber == nil {
+		return nil, errors.New("transaction is not mined yet")
+	}
+	var head string
+	if err := e.rpc.call(ctx, &head, "eth_blockNumber"); err != nil {
+		return nil, err
+	}
+	mined, err := parseQuantity(*tx.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := parseQuantity(head)
+	if err != nil {
+		return nil, err
+	}
+	if confirmations := int(latest-mined) + 1; confirmations < e.Confirmations {
+		return nil, fmt.Errorf("transaction has %d of %d confirmations", confirmations, e.Confirmations)
+	}
+	return hex.DecodeString(strings.TrimPrefix(tx.Input, "0x"))
+}
+
+// parseQuantity decodes a hex encoded number of the JSON-RPC API.
+func parseQuantity(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("invalid quantity %s", s)
+	}
+	return strconv.ParseUint(s[2:], 16, 64)
+}
@@ -0,0 +1,125 @@
+package anchor
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rpcServer answers the JSON-RPC calls with the results of handle.
+func rpcServer(t *testing.T, handle func(method string, params []json.RawMessage) interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		result := handle(req.Method, req.Params)
+		if err, ok := result.(error); ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{"code": -5, "message": err.Error()},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	}))
+}
+
+func TestBitcoin(t *testing.T) {
+	payload := make([]byte, PayloadSize)
+	payload[0] = 1
+	var script string
+	confirmations := 1
+	srv := rpcServer(t, func(method string, params []json.RawMessage) interface{} {
+		switch method {
+		case "createrawtransaction":
+			var outputs map[string]string
+			require.Nil(t, json.Unmarshal(params[1], &outputs))
+			script = "6a48" + outputs["data"]
+			return "raw"
+		case "fundrawtransaction":
+			return map[string]string{"hex": "funded"}
+		case "signrawtransactionwithwallet":
+			return map[string]interface{}{"hex": "signed", "complete": true}
+		case "sendrawtransaction":
+			return "txid"
+		case "getrawtransaction":
+			return map[string]interface{}{
+				"confirmations": confirmations,
+				"vout": []interface{}{
+					map[string]interface{}{"scriptPubKey": map[string]string{"hex": "76a914"}},
+					map[string]interface{}{"scriptPubKey": map[string]string{"hex": script}},
+				},
+			}
+		}
+		return http.ErrNotSupported
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	b := NewBitcoin(srv.URL, "user", "password")
+	ref, err := b.Publish(ctx, payload)
+	require.Nil(t, err)
+	require.Equal(t, "txid", ref)
+	_, err = b.Lookup(ctx, ref)
+	require.NotNil(t, err)
+	confirmations = 6
+	buf, err := b.Lookup(ctx, ref)
+	require.Nil(t, err)
+	require.Equal(t, payload, buf)
+
+	data, ok := opReturnData([]byte{0x6a, 0x4c, 2, 1, 2})
+	require.True(t, ok)
+	require.Equal(t, []byte{1, 2}, data)
+	_, ok = opReturnData([]byte{0x6a, 3, 1, 2})
+	require.False(t, ok)
+	_, ok = opReturnData([]byte{0x76, 1, 1})
+	require.False(t, ok)
+}
+
+func TestEthereum(t *testing.T) {
+	payload := make([]byte, PayloadSize)
+	payload[0] = 1
+	var input string
+	var mined interface{}
+	srv := rpcServer(t, func(method string, params []json.RawMessage) interface{} {
+		switch method {
+		case "eth_sendTransaction":
+			var tx map[string]string
+			require.Nil(t, json.Unmarshal(params[0], &tx))
+			require.Equal(t, "0xabcd", tx["from"])
+			input = tx["data"]
+			return "0x1234"
+		case "eth_getTransactionByHash":
+			return map[string]interface{}{"input": input, "blockNumber": mined}
+		case "eth_blockNumber":
+			return "0x10"
+		}
+		return http.ErrNotSupported
+	})
+	defer srv.Close()
+
+	ctx := context.Background()
+	e := NewEthereum(srv.URL, "0xabcd")
+	ref, err := e.Publish(ctx, payload)
+	require.Nil(t, err)
+	require.Equal(t, "0x1234", ref)
+	require.Equal(t, "0x"+hex.EncodeToString(payload), input)
+
+	_, err = e.Lookup(ctx, ref)
+	require.NotNil(t, err)
+	mined = "0x0d"
+	_, err = e.Lookup(ctx, ref)
+	require.NotNil(t, err)
+	mined = "0x0b"
+	buf, err := e.Lookup(ctx, ref)
+	require.Nil(t, err)
+	require.Equal(t, payload, buf)
+
+	require.NotNil(t, e.rpc.call(ctx, nil, "eth_unknown"))
+}
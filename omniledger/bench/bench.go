@@ -0,0 +1,326 @@
+// Package bench drives a configurable mix of transactions against an
+// omniledger and measures its throughput and the latency of the transactions,
+// from the moment they are sent until their proof shows the new value. It is
+// used by "ol bench" to compare the transaction pipeline from one release to
+// the next.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/client"
+	"github.com/dedis/cothority/omniledger/contracts"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/cothority/omniledger/service"
+)
+
+// Mix describes the transactions of a benchmark. The transactions spawn
+// value instances, or update the value instances that have been spawned by
+// the benchmark.
+type Mix struct {
+	// Spawn and Invoke are the relative weights of the two kinds of
+	// transactions.
+	Spawn  int
+	Invoke int
+	// PayloadSize is the number of bytes of the values, at least 8.
+	PayloadSize int
+	// Signers is the number of signatures of every transaction.
+	Signers int
+}
+
+// Config holds the parameters of a benchmark.
+type Config struct {
+	Mix Mix
+	// Transactions is the number of transactions to send.
+	Transactions int
+	// Concurrency is the number of transactions that are sent at the same
+	// time.
+	Concurrency int
+	// Timeout is how long a transaction may take before it fails.
+	Timeout time.Duration
+	// Seed makes the order of the spawns and invokes reproducible.
+	Seed int64
+}
+
+// DefaultConfig is a small benchmark with as many spawns as invokes.
+var DefaultConfig = Config{
+	Mix:          Mix{Spawn: 1, Invoke: 1, PayloadSize: 64, Signers: 1},
+	Transactions: 100,
+	Concurrency:  10,
+	Timeout:      time.Minute,
+}
+
+func (c Config) check() error {
+	if c.Mix.Spawn < 0 || c.Mix.Invoke < 0 || c.Mix.Spawn+c.Mix.Invoke == 0 {
+		return errors.New("need a positive weight for the spawns or the invokes")
+	}
+	if c.Mix.PayloadSize < 8 {
+		return errors.New("the payload must have at least 8 bytes")
+	}
+	if c.Mix.Signers < 1 {
+		return errors.New("need at least one signer")
+	}
+	if c.Transactions < 1 || c.Concurrency < 1 {
+		return errors.New("need at least one transaction and one worker")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("need a positive timeout")
+	}
+	return nil
+}
+
+// Percentiles of the latency of the transactions.
+type Percentiles struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// Report is the outcome of a benchmark.
+type Report struct {
+	// Spawns and Invokes are the number of transactions of each kind
+	// that were included in the chain.
+	Spawns  int
+	Invokes int
+	// Failed is the number of transactions that were refused or that
+	// timed out.
+	Failed int
+	// Duration of the benchmark, without the setup.
+	Duration time.Duration
+	// Throughput is the number of included transactions per second.
+	Throughput float64
+	// Latency of the included transactions.
+	Latency Percentiles
+}
+
+// String returns the report in a human readable form.
+func (r *Report) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "transactions: %d spawns, %d invokes, %d failed\n", r.Spawns, r.Invokes, r.Failed)
+	fmt.Fprintf(&b, "duration:     %s\n", r.Duration)
+	fmt.Fprintf(&b, "throughput:   %.2f tx/s\n", r.Throughput)
+	fmt.Fprintf(&b, "latency:      p50 %s, p90 %s, p99 %s, max %s\n",
+		r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	return b.String()
+}
+
+// Run creates a darc for the signers of the benchmark, spawned by owner from
+// the darc parent, which must allow "spawn:darc". Then it sends the
+// transactions of cfg to the omniledger of cl and waits for each of them to
+// be included. Only the errors of the setup stop the benchmark, the failed
+// transactions are counted in the report.
+func Run(ctx context.Context, cl *client.Client, owner darc.Signer, parent darc.ID, cfg Config) (*Report, error) {
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	signers, darcID, err := setup(ctx, cl, owner, parent, cfg)
+	if err != nil {
+		return nil, errors.New("couldn't set up the benchmark: " + err.Error())
+	}
+
+	jobs := make(chan int)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < cfg.Concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			wk := &worker{
+				cl:      cl,
+				cfg:     cfg,
+				signers: signers,
+				darcID:  darcID,
+				rand:    mrand.New(mrand.NewSource(cfg.Seed + int64(w))),
+			}
+			for i := range jobs {
+				results <- wk.send(ctx, i)
+			}
+		}(w)
+	}
+	go func() {
+		defer close(jobs)
+		for i := 0; i < cfg.Transactions; i++ {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	r := &Report{}
+	var latencies []time.Duration
+	for res := range results {
+		switch {
+		case res.err != nil:
+			r.Failed++
+			continue
+		case res.spawn:
+			r.Spawns++
+		default:
+			r.Invokes++
+		}
+		latencies = append(latencies, res.latency)
+	}
+	r.Duration = time.Since(start)
+	if r.Duration > 0 {
+		r.Throughput = float64(len(latencies)) / r.Duration.Seconds()
+	}
+	r.Latency = percentiles(latencies)
+	return r, ctx.Err()
+}
+
+// setup returns the signers of the benchmark and the darc that lets them
+// spawn and update value instances together.
+func setup(ctx context.Context, cl *client.Client, owner darc.Signer, parent darc.ID,
+	cfg Config) ([]darc.Signer, darc.ID, error) {
+	var signers []darc.Signer
+	var ids []string
+	for i := 0; i < cfg.Mix.Signers; i++ {
+		s := darc.NewSignerEd25519(nil, nil)
+		signers = append(signers, s)
+		ids = append(ids, s.Identity().String())
+	}
+	rules := darc.InitRules([]darc.Identity{owner.Identity()}, nil)
+	expr := expression.InitAndExpr(ids...)
+	if err := rules.AddRule("spawn:"+darc.Action(contracts.ContractValueID), expr); err != nil {
+		return nil, nil, err
+	}
+	if err := rules.AddRule("invoke:update", expr); err != nil {
+		return nil, nil, err
+	}
+	d := darc.NewDarc(rules, []byte("benchmark"))
+	dBuf, err := d.ToProto()
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := cl.Sign(service.Instructions{{
+		InstanceID: service.InstanceID{DarcID: parent},
+		Spawn: &service.Spawn{
+			ContractID: service.ContractDarcID,
+			Args:       service.Arguments{{Name: "darc", Value: dBuf}},
+		},
+	}}, owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	if err := cl.AddTransaction(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+	if _, err := cl.WaitProof(ctx, service.InstanceID{DarcID: d.GetBaseID()}, nil); err != nil {
+		return nil, nil, err
+	}
+	return signers, d.GetBaseID(), nil
+}
+
+// result is the outcome of one transaction.
+type result struct {
+	spawn   bool
+	latency time.Duration
+	err     error
+}
+
+// worker sends transactions one after the other. It updates only the
+// instances it spawned, so that no other worker changes their value while it
+// waits for its update.
+type worker struct {
+	cl        *client.Client
+	cfg       Config
+	signers   []darc.Signer
+	darcID    darc.ID
+	rand      *mrand.Rand
+	instances []service.InstanceID
+}
+
+// send sends the transaction i and waits until its value is in the chain.
+func (w *worker) send(ctx context.Context, i int) result {
+	mix := w.cfg.Mix
+	spawn := len(w.instances) == 0 || w.rand.Intn(mix.Spawn+mix.Invoke) < mix.Spawn
+	value := make([]byte, mix.PayloadSize)
+	binary.LittleEndian.PutUint64(value, uint64(i))
+	rand.Read(value[8:])
+
+	var instr service.Instruction
+	if spawn {
+		instr = service.Instruction{
+			InstanceID: service.InstanceID{DarcID: w.darcID},
+			Spawn: &service.Spawn{
+				ContractID: contracts.ContractValueID,
+				Args:       service.Arguments{{Name: "value", Value: value}},
+			},
+		}
+	} else {
+		instr = service.Instruction{
+			InstanceID: w.instances[w.rand.Intn(len(w.instances))],
+			Invoke: &service.Invoke{
+				Command: "update",
+				Args:    service.Arguments{{Name: "value", Value: value}},
+			},
+		}
+	}
+	res := result{spawn: spawn}
+	tx, err := w.cl.Sign(service.Instructions{instr}, w.signers...)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	id := tx.Instructions[0].InstanceID
+	if spawn {
+		id = tx.Instructions[0].DeriveID(contracts.ContractValueID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+	defer cancel()
+	start := time.Now()
+	if res.err = w.cl.AddTransaction(ctx, tx); res.err != nil {
+		return res
+	}
+	if _, res.err = w.cl.WaitProof(ctx, id, value); res.err != nil {
+		return res
+	}
+	res.latency = time.Since(start)
+	if spawn {
+		w.instances = append(w.instances, id)
+	}
+	return res
+}
+
+// percentiles returns the percentiles of the latencies, using the nearest
+// rank.
+func percentiles(latencies []time.Duration) Percentiles {
+	if len(latencies) == 0 {
+		return Percentiles{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	rank := func(p int) time.Duration {
+		i := (p*len(latencies)+99)/100 - 1
+		if i < 0 {
+			i = 0
+		}
+		return latencies[i]
+	}
+	return Percentiles{
+		P50: rank(50),
+		P90: rank(90),
+		P99: rank(99),
+		Max: latencies[len(latencies)-1],
+	}
+}
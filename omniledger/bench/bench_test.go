@@ -0,0 +1,67 @@
+package bench
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/client"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestPercentiles(t *testing.T) {
+	require.Equal(t, Percentiles{}, percentiles(nil))
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	p := percentiles(latencies)
+	require.Equal(t, 50*time.Millisecond, p.P50)
+	require.Equal(t, 90*time.Millisecond, p.P90)
+	require.Equal(t, 99*time.Millisecond, p.P99)
+	require.Equal(t, 100*time.Millisecond, p.Max)
+}
+
+func TestRun(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	owner := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+	msg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:darc"}, owner.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 500 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cl, err := client.CreateChain(ctx, msg)
+	require.Nil(t, err)
+	cl.PollInterval = 100 * time.Millisecond
+
+	cfg := DefaultConfig
+	cfg.Mix.Signers = 0
+	_, err = Run(ctx, cl, owner, msg.GenesisDarc.GetBaseID(), cfg)
+	require.NotNil(t, err)
+
+	cfg.Mix.Signers = 2
+	cfg.Transactions = 6
+	cfg.Concurrency = 3
+	cfg.Timeout = 10 * time.Second
+	r, err := Run(ctx, cl, owner, msg.GenesisDarc.GetBaseID(), cfg)
+	require.Nil(t, err)
+	require.Equal(t, 0, r.Failed)
+	require.Equal(t, 6, r.Spawns+r.Invokes)
+	require.True(t, r.Spawns >= 3)
+	require.True(t, r.Latency.P50 > 0)
+	require.True(t, r.Throughput > 0)
+}
@@ -0,0 +1,59 @@
+package calypso
+
+import (
+	"github.com/dedis/cothority"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// Client is a structure to communicate with the Calypso service.
+type Client struct {
+	*onet.Client
+}
+
+// NewClient instantiates a new Calypso client.
+func NewClient() *Client {
+	return &Client{Client: onet.NewClient(cothority.Suite, ServiceName)}
+}
+
+// CreateLTS creates a new long term secret on the nodes of the roster, to
+// encrypt the secrets of the omniledger skipchain olid.
+func (c *Client) CreateLTS(roster *onet.Roster, olid skipchain.SkipBlockID) (*CreateLTSReply, error) {
+	reply := &CreateLTSReply{}
+	err := c.SendProtobuf(roster.List[0], &CreateLTS{
+		Roster: *roster,
+		OLID:   olid,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// SharedPublic asks dst for the shared public key of the long term secret
+// ltsid.
+func (c *Client) SharedPublic(dst *network.ServerIdentity, ltsid []byte) (*SharedPublicReply, error) {
+	reply := &SharedPublicReply{}
+	err := c.SendProtobuf(dst, &SharedPublic{LTSID: ltsid}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// DecryptKey asks dst, a node of the long term secret, to re-encrypt the
+// secret of the write instance to the reader of the read instance. The
+// reader gets the key with DecodeKey.
+func (c *Client) DecryptKey(dst *network.ServerIdentity, read, write omniledger.Proof) (*DecryptKeyReply, error) {
+	reply := &DecryptKeyReply{}
+	err := c.SendProtobuf(dst, &DecryptKey{
+		Read:  read,
+		Write: write,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
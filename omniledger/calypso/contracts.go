@@ -0,0 +1,69 @@
+package calypso
+
+import (
+	"errors"
+
+	"github.com/dedis/cothority"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// ContractWriteID denotes a contract that stores an encrypted secret.
+var ContractWriteID = "calypsoWrite"
+
+// ContractReadID denotes a contract that logs the access to a secret.
+var ContractReadID = "calypsoRead"
+
+// ContractWrite accepts the following instructions:
+//   - Spawn - stores the Write in the argument "write". Its proof must be
+//     bound to the darc the instruction is sent to. This darc is the access
+//     darc of the secret: its "spawn:calypsoRead" rule decides who can read
+//     the secret.
+var ContractWrite = omniledger.BasicContract{
+	SpawnFn: func(cdb omniledger.CollectionView, inst omniledger.Instruction, c []omniledger.Coin) ([]omniledger.StateChange, []omniledger.Coin, error) {
+		writeBuf := inst.Spawn.Args.Search("write")
+		var wr Write
+		err := protobuf.DecodeWithConstructors(writeBuf, &wr, network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return nil, nil, errors.New("couldn't decode write: " + err.Error())
+		}
+		if err := wr.CheckProof(cothority.Suite, inst.InstanceID.DarcID); err != nil {
+			return nil, nil, errors.New("proof of write failed: " + err.Error())
+		}
+		return []omniledger.StateChange{
+			omniledger.NewStateChange(omniledger.Create, inst.DeriveID(ContractWriteID),
+				ContractWriteID, writeBuf),
+		}, c, nil
+	},
+}
+
+// ContractRead accepts the following instructions:
+//   - Spawn - sent to a calypsoWrite instance, logs the Read in the argument
+//     "read". The Read must point to the instance. The new instance is the
+//     proof needed by DecryptKey to get the secret re-encrypted to the
+//     public key of the reader.
+var ContractRead = omniledger.BasicContract{
+	SpawnFn: func(cdb omniledger.CollectionView, inst omniledger.Instruction, c []omniledger.Coin) ([]omniledger.StateChange, []omniledger.Coin, error) {
+		_, cid, err := cdb.GetValues(inst.InstanceID.Slice())
+		if err != nil || cid != ContractWriteID {
+			return nil, nil, errors.New("read must be sent to a calypsoWrite instance")
+		}
+		readBuf := inst.Spawn.Args.Search("read")
+		var rd Read
+		err = protobuf.DecodeWithConstructors(readBuf, &rd, network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return nil, nil, errors.New("couldn't decode read: " + err.Error())
+		}
+		if !rd.Write.Equal(inst.InstanceID) {
+			return nil, nil, errors.New("read doesn't point to this write")
+		}
+		if rd.Xc == nil {
+			return nil, nil, errors.New("read has no public key")
+		}
+		return []omniledger.StateChange{
+			omniledger.NewStateChange(omniledger.Create, inst.DeriveID(ContractReadID),
+				ContractReadID, readBuf),
+		}, c, nil
+	},
+}
@@ -0,0 +1,99 @@
+package calypso
+
+import (
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet"
+)
+
+// PROTOSTART
+// type :skipchain.SkipBlockID:bytes
+// package calypso;
+// import "onet.proto";
+// import "omniledger.proto";
+//
+// option java_package = "ch.epfl.dedis.proto";
+// option java_outer_classname = "CalypsoProto";
+
+// ***
+// These are the instances stored in omniledger
+// ***
+
+// Write is the value of a calypsoWrite instance. It holds the secret
+// encrypted under the shared public key of a long term secret.
+type Write struct {
+	// Data should be encrypted by the application under the symmetric key
+	// in U and Cs.
+	Data []byte
+	// U is the encrypted random value for the ElGamal encryption.
+	U kyber.Point
+	// Ubar, E and F are used by the nodes to verify that the writer did
+	// correctly encrypt the key. They bind the darc of the instance to the
+	// cyphertext.
+	Ubar kyber.Point
+	// E is the non-interactive challenge as scalar.
+	E kyber.Scalar
+	// F is the proof.
+	F kyber.Scalar
+	// Cs are the ElGamal parts of the symmetric key material.
+	Cs []kyber.Point
+	// ExtraData is clear text and application-specific.
+	ExtraData []byte
+	// LTSID is the long term secret the key is encrypted for.
+	LTSID []byte
+}
+
+// Read is the value of a calypsoRead instance. It logs that the reader with
+// the public key Xc has been allowed to read the secret of a Write.
+type Read struct {
+	// Write is the instance of the secret.
+	Write omniledger.InstanceID
+	// Xc is the public key of the reader.
+	Xc kyber.Point
+}
+
+// ***
+// Requests and replies to/from the service
+// ***
+
+// CreateLTS asks the nodes of the roster to run a distributed key generation
+// for a new long term secret, used to encrypt the secrets stored in the
+// omniledger skipchain OLID.
+type CreateLTS struct {
+	Roster onet.Roster
+	OLID   skipchain.SkipBlockID
+}
+
+// CreateLTSReply returns the ID and the shared public key of the new long
+// term secret.
+type CreateLTSReply struct {
+	LTSID []byte
+	X     kyber.Point
+}
+
+// SharedPublic asks for the shared public key of a long term secret.
+type SharedPublic struct {
+	LTSID []byte
+}
+
+// SharedPublicReply holds the shared public key of a long term secret.
+type SharedPublicReply struct {
+	X kyber.Point
+}
+
+// DecryptKey asks the nodes to re-encrypt the secret of the Write instance
+// under the public key of the Read instance. Both instances are given as
+// proofs from the omniledger skipchain.
+type DecryptKey struct {
+	Read  omniledger.Proof
+	Write omniledger.Proof
+}
+
+// DecryptKeyReply holds the secret re-encrypted under the key of the
+// reader. It can be decrypted with DecodeKey.
+type DecryptKeyReply struct {
+	Cs      []kyber.Point
+	XhatEnc kyber.Point
+	X       kyber.Point
+}
@@ -0,0 +1,276 @@
+// Package calypso stores secrets on an omniledger skipchain, so that only
+// the readers allowed by a darc can get them, and every access is logged.
+//
+// The secrets are encrypted under the shared public key of a long term
+// secret, which is created by the DKG service among the nodes of a roster. A
+// writer stores the encrypted secret in a calypsoWrite instance, whose darc
+// decides who can spawn a calypsoRead instance for it. With the proofs of
+// both instances, the nodes re-encrypt the secret to the public key of the
+// reader, without ever learning it.
+package calypso
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/dkg"
+	"github.com/dedis/cothority/ocs/protocol"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/share"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// ServiceName is used for registration on the onet.
+const ServiceName = "Calypso"
+
+// dkgPurpose is the purpose of the keys of the long term secrets in the DKG
+// service.
+const dkgPurpose = "calypso"
+
+func init() {
+	_, err := onet.RegisterNewService(ServiceName, newService)
+	log.ErrFatal(err)
+}
+
+// Service re-encrypts the secrets with the shares of the long term secrets
+// of this node, which are kept by the DKG service.
+type Service struct {
+	// We need to embed the ServiceProcessor, so that incoming messages
+	// are correctly handled.
+	*onet.ServiceProcessor
+}
+
+// lts is the share of this node of a long term secret.
+type lts struct {
+	// OLID is the omniledger skipchain the secrets are stored in.
+	OLID   skipchain.SkipBlockID
+	Roster *onet.Roster
+	Shared *protocol.SharedSecret
+}
+
+// CreateLTS runs a distributed key generation among the nodes of the roster,
+// which must include this node. The returned shared public key is used to
+// encrypt the secrets of the omniledger skipchain req.OLID.
+func (s *Service) CreateLTS(req *CreateLTS) (*CreateLTSReply, error) {
+	ltsid := make([]byte, 32)
+	if _, err := rand.Read(ltsid); err != nil {
+		return nil, err
+	}
+	log.Lvlf2("%s: Creating long term secret %x", s.ServerIdentity(), ltsid)
+	reply, err := s.dkgService().Setup(&dkg.Setup{
+		Roster:  req.Roster,
+		ID:      ltsid,
+		Purpose: dkgPurpose,
+		Data:    req.OLID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CreateLTSReply{
+		LTSID: ltsid,
+		X:     reply.X,
+	}, nil
+}
+
+// SharedPublic returns the shared public key of a long term secret.
+func (s *Service) SharedPublic(req *SharedPublic) (*SharedPublicReply, error) {
+	reply, err := s.dkgService().GetPublic(&dkg.GetPublic{ID: req.LTSID})
+	if err != nil {
+		return nil, err
+	}
+	return &SharedPublicReply{X: reply.X}, nil
+}
+
+// DecryptKey re-encrypts the secret of the write instance to the public key
+// of the read instance. Every node checks the proofs of both instances
+// before giving its share.
+func (s *Service) DecryptKey(req *DecryptKey) (*DecryptKeyReply, error) {
+	read, write, l, err := s.verifyProofs(req)
+	if err != nil {
+		return nil, err
+	}
+	log.Lvlf2("%s: Re-encrypting secret of %x", s.ServerIdentity(), req.Write.InclusionProof.Key)
+	vData, err := protobuf.Encode(req)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := len(l.Roster.List)
+	threshold := dkg.Threshold(nodes)
+	tree := l.Roster.GenerateNaryTreeWithRoot(nodes, s.ServerIdentity())
+	if tree == nil {
+		return nil, errors.New("this node is not in the roster of the long term secret")
+	}
+	pi, err := s.CreateProtocol(protocol.NameOCS, tree)
+	if err != nil {
+		return nil, err
+	}
+	ocsProto := pi.(*protocol.OCS)
+	ocsProto.U = write.U
+	ocsProto.Xc = read.Xc
+	ocsProto.Shared = l.Shared
+	ocsProto.Poly = share.NewPubPoly(cothority.Suite, cothority.Suite.Point().Base(), l.Shared.Commits)
+	ocsProto.VerificationData = vData
+	ocsProto.Verify = s.verifyReencryption
+	ocsProto.SetConfig(&onet.GenericConfig{Data: write.LTSID})
+	if err := ocsProto.Start(); err != nil {
+		return nil, err
+	}
+	if !<-ocsProto.Reencrypted {
+		return nil, errors.New("reencryption got refused")
+	}
+	xhatEnc, err := share.RecoverCommit(cothority.Suite, ocsProto.Uis, threshold, nodes)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptKeyReply{
+		Cs:      write.Cs,
+		XhatEnc: xhatEnc,
+		X:       l.Shared.X,
+	}, nil
+}
+
+// verifyProofs checks that the proofs of req are valid for the omniledger
+// skipchain of the long term secret, and that the read instance points to
+// the write instance.
+func (s *Service) verifyProofs(req *DecryptKey) (*Read, *Write, *lts, error) {
+	var read Read
+	if err := decodeProof(req.Read, ContractReadID, &read); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid read: %v", err)
+	}
+	var write Write
+	if err := decodeProof(req.Write, ContractWriteID, &write); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid write: %v", err)
+	}
+	if !read.Write.Equal(omniledger.NewInstanceID(req.Write.InclusionProof.Key)) {
+		return nil, nil, nil, errors.New("read doesn't point to the write")
+	}
+	l, err := s.getLTS(write.LTSID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := req.Read.Verify(l.OLID); err != nil {
+		return nil, nil, nil, errors.New("proof of read failed: " + err.Error())
+	}
+	if err := req.Write.Verify(l.OLID); err != nil {
+		return nil, nil, nil, errors.New("proof of write failed: " + err.Error())
+	}
+	return &read, &write, l, nil
+}
+
+// decodeProof decodes the value of the instance in p into value, if the
+// instance is of the contract contractID.
+func decodeProof(p omniledger.Proof, contractID string, value interface{}) error {
+	if !p.InclusionProof.Match() {
+		return errors.New("instance is not in the proof")
+	}
+	_, values, err := p.KeyValue()
+	if err != nil {
+		return err
+	}
+	if len(values) < 2 || string(values[1]) != contractID {
+		return fmt.Errorf("instance is not of contract %s", contractID)
+	}
+	return protobuf.DecodeWithConstructors(values[0], value, network.DefaultConstructors(cothority.Suite))
+}
+
+// verifyReencryption is called by every node before it gives its share. It
+// makes sure the request holds valid proofs for the secret and the reader.
+func (s *Service) verifyReencryption(rc *protocol.Reencrypt) bool {
+	err := func() error {
+		if rc.VerificationData == nil {
+			return errors.New("missing proofs")
+		}
+		var req DecryptKey
+		err := protobuf.DecodeWithConstructors(*rc.VerificationData, &req,
+			network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return err
+		}
+		read, write, _, err := s.verifyProofs(&req)
+		if err != nil {
+			return err
+		}
+		if !write.U.Equal(rc.U) {
+			return errors.New("wrong secret")
+		}
+		if !read.Xc.Equal(rc.Xc) {
+			return errors.New("wrong reader")
+		}
+		return nil
+	}()
+	if err != nil {
+		log.Lvl2(s.ServerIdentity(), "wrong reencryption:", err)
+		return false
+	}
+	return true
+}
+
+// verifyReshare only lets the DKG service move a long term secret to the
+// roster of the latest block of its omniledger skipchain, so the secrets
+// follow the nodes of the skipchain.
+func (s *Service) verifyReshare(id, data []byte, newRoster *onet.Roster) bool {
+	db := s.Service(skipchain.ServiceName).(*skipchain.Service).GetDB()
+	latest, err := db.GetLatestByID(data)
+	if err != nil {
+		log.Lvl2(s.ServerIdentity(), "unknown omniledger skipchain:", err)
+		return false
+	}
+	return latest.Roster.ID.Equal(newRoster.ID)
+}
+
+// NewProtocol intercepts the OCS protocol to give it the share of this node.
+func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfig) (onet.ProtocolInstance, error) {
+	switch tn.ProtocolName() {
+	case protocol.NameOCS:
+		l, err := s.getLTS(conf.Data)
+		if err != nil {
+			return nil, err
+		}
+		pi, err := protocol.NewOCS(tn)
+		if err != nil {
+			return nil, err
+		}
+		ocs := pi.(*protocol.OCS)
+		ocs.Shared = l.Shared
+		ocs.Verify = s.verifyReencryption
+		return ocs, nil
+	}
+	return nil, nil
+}
+
+func (s *Service) dkgService() *dkg.Service {
+	return s.Service(dkg.ServiceName).(*dkg.Service)
+}
+
+func (s *Service) getLTS(id []byte) (*lts, error) {
+	roster, data, shared, err := s.dkgService().GetShare(id)
+	if err != nil {
+		return nil, errors.New("unknown long term secret")
+	}
+	return &lts{
+		OLID:   data,
+		Roster: roster,
+		Shared: shared,
+	}, nil
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+	}
+	if err := s.RegisterHandlers(s.CreateLTS, s.SharedPublic, s.DecryptKey); err != nil {
+		log.Error("Couldn't register messages", err)
+		return nil, err
+	}
+	omniledger.RegisterContract(c, ContractWriteID, ContractWrite)
+	omniledger.RegisterContract(c, ContractReadID, ContractRead)
+	s.dkgService().RegisterReshareVerifier(dkgPurpose, s.verifyReshare)
+	return s, nil
+}
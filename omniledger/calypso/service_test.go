@@ -0,0 +1,88 @@
+package calypso
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestService_DecryptKey(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := omniledger.DefaultGenesisMsg(omniledger.CurrentVersion, roster,
+		[]string{"spawn:" + ContractWriteID, "spawn:" + ContractReadID}, signer.Identity())
+	require.Nil(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+	genesisMsg.BlockInterval = time.Second
+	ol := omniledger.NewClient()
+	_, err = ol.CreateGenesisBlock(genesisMsg)
+	require.Nil(t, err)
+
+	cl := NewClient()
+	ltsReply, err := cl.CreateLTS(roster, ol.ID)
+	require.Nil(t, err)
+	pub, err := cl.SharedPublic(roster.List[1], ltsReply.LTSID)
+	require.Nil(t, err)
+	require.True(t, pub.X.Equal(ltsReply.X))
+
+	// spawn sends a spawn instruction to the instance id and returns the
+	// proof of the new instance.
+	spawn := func(id omniledger.InstanceID, contractID, arg string, value interface{}) *omniledger.Proof {
+		buf, err := protobuf.Encode(value)
+		require.Nil(t, err)
+		instr := omniledger.Instruction{
+			InstanceID: id,
+			Nonce:      omniledger.GenNonce(),
+			Length:     1,
+			Spawn: &omniledger.Spawn{
+				ContractID: contractID,
+				Args:       omniledger.Arguments{{Name: arg, Value: buf}},
+			},
+		}
+		require.Nil(t, instr.SignBy(signer))
+		_, err = ol.AddTransaction(omniledger.ClientTransaction{
+			Instructions: []omniledger.Instruction{instr},
+		})
+		require.Nil(t, err)
+		pr, err := ol.WaitProof(instr.DeriveID(contractID), genesisMsg.BlockInterval, nil)
+		require.Nil(t, err)
+		return pr
+	}
+
+	secret := []byte("secret key")
+	write := NewWrite(cothority.Suite, ltsReply.LTSID, gDarc.GetBaseID(), ltsReply.X, secret)
+	writeProof := spawn(omniledger.InstanceID{DarcID: gDarc.GetBaseID()}, ContractWriteID, "write", write)
+	reader := key.NewKeyPair(cothority.Suite)
+	readProof := spawn(omniledger.NewInstanceID(writeProof.InclusionProof.Key), ContractReadID, "read",
+		&Read{Write: omniledger.NewInstanceID(writeProof.InclusionProof.Key), Xc: reader.Public})
+
+	reply, err := cl.DecryptKey(roster.List[0], *readProof, *writeProof)
+	require.Nil(t, err)
+	decoded, err := DecodeKey(cothority.Suite, reply.X, reply.Cs, reply.XhatEnc, reader.Private)
+	require.Nil(t, err)
+	require.Equal(t, secret, decoded)
+
+	// The proofs must be of a read and its write.
+	_, err = cl.DecryptKey(roster.List[0], *writeProof, *readProof)
+	require.NotNil(t, err)
+	_, err = cl.DecryptKey(roster.List[0], *writeProof, *writeProof)
+	require.NotNil(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
@@ -0,0 +1,125 @@
+package calypso
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/suites"
+	"github.com/dedis/onet/network"
+)
+
+// We need to register all messages so the network knows how to handle them.
+func init() {
+	network.RegisterMessages(
+		Write{}, Read{},
+		CreateLTS{}, CreateLTSReply{},
+		SharedPublic{}, SharedPublicReply{},
+		DecryptKey{}, DecryptKeyReply{},
+	)
+}
+
+type suite interface {
+	kyber.Group
+	kyber.XOFFactory
+}
+
+// NewWrite is used by the writer to encrypt the symmetric key under the
+// shared public key X of the long term secret ltsid. The proof of the
+// encryption is bound to the darc writeDarc, which must be the darc of the
+// instance the write is spawned to. As the key is embedded into points,
+// more than one point is needed for longer keys.
+func NewWrite(suite suites.Suite, ltsid []byte, writeDarc darc.ID, X kyber.Point, key []byte) *Write {
+	wr := &Write{LTSID: ltsid}
+	r := suite.Scalar().Pick(suite.RandomStream())
+	C := suite.Point().Mul(r, X)
+	wr.U = suite.Point().Mul(r, nil)
+
+	for len(key) > 0 {
+		kp := suite.Point().Embed(key, suite.RandomStream())
+		wr.Cs = append(wr.Cs, suite.Point().Add(C, kp))
+		key = key[min(len(key), kp.EmbedLen()):]
+	}
+
+	gBar := suite.Point().Mul(suite.Scalar().SetBytes(ltsid), nil)
+	wr.Ubar = suite.Point().Mul(r, gBar)
+	s := suite.Scalar().Pick(suite.RandomStream())
+	w := suite.Point().Mul(s, nil)
+	wBar := suite.Point().Mul(s, gBar)
+	wr.E = wr.challenge(suite, writeDarc, w, wBar)
+	wr.F = suite.Scalar().Add(s, suite.Scalar().Mul(wr.E, r))
+	return wr
+}
+
+// CheckProof verifies that the write has been created by somebody knowing
+// the encrypted secret, and for the darc writeDarc.
+func (wr *Write) CheckProof(suite suite, writeDarc darc.ID) error {
+	if wr.U == nil || wr.Ubar == nil || wr.E == nil || wr.F == nil {
+		return errors.New("the write is missing its proof")
+	}
+	gf := suite.Point().Mul(wr.F, nil)
+	ue := suite.Point().Mul(suite.Scalar().Neg(wr.E), wr.U)
+	w := suite.Point().Add(gf, ue)
+
+	gBar := suite.Point().Mul(suite.Scalar().SetBytes(wr.LTSID), nil)
+	gfBar := suite.Point().Mul(wr.F, gBar)
+	ueBar := suite.Point().Mul(suite.Scalar().Neg(wr.E), wr.Ubar)
+	wBar := suite.Point().Add(gfBar, ueBar)
+
+	if !wr.challenge(suite, writeDarc, w, wBar).Equal(wr.E) {
+		return errors.New("recreated proof is not equal to stored proof")
+	}
+	return nil
+}
+
+// challenge returns the hash of the write and the commitments of its proof.
+func (wr *Write) challenge(suite suite, writeDarc darc.ID, w, wBar kyber.Point) kyber.Scalar {
+	hash := sha256.New()
+	for _, c := range wr.Cs {
+		c.MarshalTo(hash)
+	}
+	wr.U.MarshalTo(hash)
+	wr.Ubar.MarshalTo(hash)
+	w.MarshalTo(hash)
+	wBar.MarshalTo(hash)
+	hash.Write(writeDarc)
+	return suite.Scalar().SetBytes(hash.Sum(nil))
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// DecodeKey can be used by the reader to convert the re-encrypted secret
+// back to the symmetric key.
+//
+// Input:
+//   - suite - the cryptographic suite to use
+//   - X - the shared public key of the long term secret
+//   - Cs - the encrypted key-slices
+//   - XhatEnc - the re-encrypted schnorr-commit
+//   - xc - the private key of the reader
+//
+// Output:
+//   - key - the re-assembled key
+//   - err - an eventual error when trying to recover the data from the points
+func DecodeKey(suite suite, X kyber.Point, Cs []kyber.Point, XhatEnc kyber.Point,
+	xc kyber.Scalar) (key []byte, err error) {
+	XhatDec := suite.Point().Mul(suite.Scalar().Neg(xc), X)
+	Xhat := suite.Point().Add(XhatEnc, XhatDec)
+	XhatInv := suite.Point().Neg(Xhat)
+
+	for _, C := range Cs {
+		keyPointHat := suite.Point().Add(C, XhatInv)
+		keyPart, err := keyPointHat.Data()
+		if err != nil {
+			return nil, err
+		}
+		key = append(key, keyPart...)
+	}
+	return
+}
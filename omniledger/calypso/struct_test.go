@@ -0,0 +1,33 @@
+package calypso
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite_CheckProof(t *testing.T) {
+	kp := key.NewKeyPair(cothority.Suite)
+	ltsid := []byte("long term secret")
+	writeDarc := darc.ID(make([]byte, 32))
+	secret := []byte("this is a secret key of 32 bytes")
+
+	wr := NewWrite(cothority.Suite, ltsid, writeDarc, kp.Public, secret)
+	require.Nil(t, wr.CheckProof(cothority.Suite, writeDarc))
+
+	// The proof is bound to the darc.
+	otherDarc := darc.ID(make([]byte, 32))
+	otherDarc[0] = 1
+	require.NotNil(t, wr.CheckProof(cothority.Suite, otherDarc))
+
+	// With the private key as the only share, the reader gets the secret.
+	reader := key.NewKeyPair(cothority.Suite)
+	xhatEnc := cothority.Suite.Point().Add(wr.U, reader.Public)
+	xhatEnc.Mul(kp.Private, xhatEnc)
+	decoded, err := DecodeKey(cothority.Suite, kp.Public, wr.Cs, xhatEnc, reader.Private)
+	require.Nil(t, err)
+	require.Equal(t, secret, decoded)
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// DefaultCacheMaxAge is how long a Cache returns its proofs before asking
+// for updates, unless MaxAge is set.
+const DefaultCacheMaxAge = 10 * time.Second
+
+// Cache keeps verified proofs and the latest verified block of the chain,
+// for light clients that read the same keys again and again. It verifies the
+// whole chain only once, then asks for the blocks added since the latest
+// verified block, so only the new forward-links are verified.
+//
+// The instances protected by a ReadRule are redacted in the proofs of the
+// cache, as its requests are not signed.
+type Cache struct {
+	// MaxAge is how long the proofs are returned before asking for
+	// updates.
+	MaxAge time.Duration
+
+	client *Client
+	// chain goes from the genesis block to latest and has been verified.
+	chain   *skipchain.ChainProof
+	latest  *skipchain.SkipBlock
+	proofs  map[string]*service.Proof
+	updated time.Time
+	sync.Mutex
+}
+
+// NewCache returns an empty cache that fetches the proofs with c.
+func NewCache(c *Client) *Cache {
+	return &Cache{
+		MaxAge: DefaultCacheMaxAge,
+		client: c,
+		proofs: make(map[string]*service.Proof),
+	}
+}
+
+// GetProof returns the proof for the key. The cache is updated first if
+// the key is not in the cache or if it is older than MaxAge.
+func (ca *Cache) GetProof(ctx context.Context, key []byte) (*service.Proof, error) {
+	ca.Lock()
+	defer ca.Unlock()
+	if p, ok := ca.proofs[string(key)]; ok && time.Since(ca.updated) < ca.MaxAge {
+		return p, nil
+	}
+	if err := ca.update(ctx, key); err != nil {
+		return nil, err
+	}
+	return ca.proofs[string(key)], nil
+}
+
+// Update gets the new blocks and the proofs of all keys in the cache.
+func (ca *Cache) Update(ctx context.Context) error {
+	ca.Lock()
+	defer ca.Unlock()
+	return ca.update(ctx, nil)
+}
+
+// Latest returns the latest verified block, or nil if the cache has never
+// been updated.
+func (ca *Cache) Latest() *skipchain.SkipBlock {
+	ca.Lock()
+	defer ca.Unlock()
+	return ca.latest
+}
+
+// update asks for the updates of the keys in the cache and of key, if it is
+// not nil.
+func (ca *Cache) update(ctx context.Context, key []byte) error {
+	if ca.chain == nil {
+		// The first proof is verified from the genesis block.
+		first := key
+		if first == nil {
+			first = service.GenesisReferenceID.Slice()
+		}
+		p, err := ca.client.GetProof(ctx, first)
+		if err != nil {
+			return err
+		}
+		ca.chain = &p.Chain
+		ca.latest = &p.Latest
+		ca.proofs[string(first)] = p
+		ca.updated = time.Now()
+		if key != nil {
+			return nil
+		}
+	}
+
+	keys := make([][]byte, 0, len(ca.proofs)+1)
+	for k := range ca.proofs {
+		keys = append(keys, []byte(k))
+	}
+	if _, ok := ca.proofs[string(key)]; key != nil && !ok {
+		keys = append(keys, key)
+	}
+	reply := &service.GetUpdatesResponse{}
+	err := ca.client.send(ctx, &service.GetUpdates{
+		Version:     service.CurrentVersion,
+		SkipchainID: ca.client.ID,
+		LatestID:    ca.latest.Hash,
+		Keys:        keys,
+	}, reply)
+	if err != nil {
+		return err
+	}
+
+	if err = reply.Chain.VerifyFrom(ca.latest); err != nil {
+		return fmt.Errorf("invalid update: %v", err)
+	}
+	latest := reply.Chain.Latest()
+	if !reply.Latest.Hash.Equal(latest.Hash) || !reply.Latest.CalculateHash().Equal(latest.Hash) {
+		return errors.New("invalid update: the latest block is not the last block of the chain")
+	}
+	if len(reply.Proofs) != len(keys) {
+		return errors.New("invalid update: wrong number of proofs")
+	}
+	n := len(ca.chain.Blocks)
+	chain := &skipchain.ChainProof{
+		GenesisID: ca.chain.GenesisID,
+		Blocks:    append(ca.chain.Blocks[:n:n], reply.Chain.Blocks[1:]...),
+		Links:     append(ca.chain.Links[:n-1:n-1], reply.Chain.Links...),
+	}
+	proofs := make(map[string]*service.Proof, len(keys))
+	for i, kp := range reply.Proofs {
+		p := &service.Proof{
+			InclusionProof: kp.InclusionProof,
+			Latest:         reply.Latest,
+			Chain:          *chain,
+			Redacted:       kp.Redacted,
+		}
+		if err = p.VerifyInclusion(); err != nil {
+			return fmt.Errorf("invalid proof: %v", err)
+		}
+		if !bytes.Equal(p.InclusionProof.Key, keys[i]) {
+			return errors.New("got a proof for another key")
+		}
+		proofs[string(keys[i])] = p
+	}
+	ca.chain = chain
+	ca.latest = &reply.Latest
+	ca.proofs = proofs
+	ca.updated = time.Now()
+	return nil
+}
@@ -0,0 +1,314 @@
+// Package client is the Go client of omniledger. Unlike the Client of the
+// service package, it sends every request to the other nodes of the roster
+// if a node fails, verifies the proofs it gets against the ID of the chain
+// and takes a context to cancel requests or to give them a deadline.
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// DefaultPollInterval is how often WaitProof asks for a new proof, unless
+// PollInterval is set.
+const DefaultPollInterval = 500 * time.Millisecond
+
+// Client talks to the nodes of the roster of one omniledger. It can be used
+// by many goroutines at the same time.
+type Client struct {
+	// ID is the genesis block of the omniledger, all proofs are verified
+	// against it.
+	ID skipchain.SkipBlockID
+	// Roster holds the nodes that are asked, starting with the first one.
+	// It doesn't need to be the current roster of the omniledger.
+	Roster *onet.Roster
+	// PollInterval is how often WaitProof asks for a new proof.
+	PollInterval time.Duration
+	// Quorum makes GetProof, and so all the reads, accept a proof only if
+	// enough nodes return the same one, see GetProofQuorum.
+	Quorum bool
+
+	onet *onet.Client
+	// next is the index of the node of the roster that is asked first,
+	// the last one that answered.
+	next int
+	sync.Mutex
+}
+
+// New returns a client for the omniledger with the given genesis block ID,
+// served by the nodes of roster.
+func New(roster *onet.Roster, id skipchain.SkipBlockID) *Client {
+	return &Client{
+		ID:           id,
+		Roster:       roster,
+		PollInterval: DefaultPollInterval,
+		onet:         onet.NewClient(cothority.Suite, service.ServiceName),
+	}
+}
+
+// CreateChain creates a new omniledger with the genesis message and returns
+// a client for it. The nodes of the roster of msg are asked one after the
+// other until one of them creates the chain.
+func CreateChain(ctx context.Context, msg *service.CreateGenesisBlock) (*Client, error) {
+	if len(msg.Roster.List) == 0 {
+		return nil, errors.New("empty roster")
+	}
+	c := New(&msg.Roster, nil)
+	reply := &service.CreateGenesisBlockResponse{}
+	if err := c.send(ctx, msg, reply); err != nil {
+		return nil, err
+	}
+	sb := reply.Skipblock
+	if sb == nil || sb.Index != 0 || !sb.CalculateHash().Equal(sb.Hash) {
+		return nil, errors.New("got an invalid genesis block")
+	}
+	if !sb.Roster.ID.Equal(msg.Roster.ID) {
+		return nil, errors.New("the genesis block has another roster")
+	}
+	c.ID = sb.Hash
+	return c, nil
+}
+
+// AddTransaction sends the transaction to a node of the roster. It returns
+// once a node accepted it, use WaitProof to find out whether it has been
+// included in a block.
+func (c *Client) AddTransaction(ctx context.Context, tx service.ClientTransaction) error {
+	return c.send(ctx, &service.AddTxRequest{
+		Version:     service.CurrentVersion,
+		SkipchainID: c.ID,
+		Transaction: tx,
+	}, &service.AddTxResponse{})
+}
+
+// Sign returns a transaction with the instructions, after setting their
+// nonce, index and length, signed by the signers for this chain. The signers
+// can be loaded from a keystore.
+func (c *Client) Sign(instrs service.Instructions, signers ...darc.Signer) (service.ClientTransaction, error) {
+	tx := service.ClientTransaction{Instructions: make(service.Instructions, len(instrs))}
+	for i, instr := range instrs {
+		instr.Nonce = service.GenNonce()
+		instr.Index = i
+		instr.Length = len(instrs)
+		if err := instr.SignWith(c.ID, signers...); err != nil {
+			return service.ClientTransaction{}, err
+		}
+		tx.Instructions[i] = instr
+	}
+	return tx, nil
+}
+
+// GetProof returns the proof for the key, once it has been verified against
+// the ID of the chain. The proof shows either the presence or the absence of
+// the key. If Quorum is set, it is the same as GetProofQuorum.
+func (c *Client) GetProof(ctx context.Context, key []byte) (*service.Proof, error) {
+	if c.Quorum {
+		return c.GetProofQuorum(ctx, key)
+	}
+	reply := &service.GetProofResponse{}
+	if err := c.send(ctx, c.getProofMsg(key), reply); err != nil {
+		return nil, err
+	}
+	return c.verifyProof(&reply.Proof, key)
+}
+
+// getProofMsg returns the request for the proof of the key.
+func (c *Client) getProofMsg(key []byte) *service.GetProof {
+	return &service.GetProof{
+		Version: service.CurrentVersion,
+		ID:      c.ID,
+		Key:     key,
+	}
+}
+
+// verifyProof verifies the proof p against the ID of the chain and checks
+// that it is a proof for the key.
+func (c *Client) verifyProof(p *service.Proof, key []byte) (*service.Proof, error) {
+	if err := p.Verify(c.ID); err != nil {
+		return nil, fmt.Errorf("invalid proof: %v", err)
+	}
+	if !bytes.Equal(p.InclusionProof.Key, key) {
+		return nil, errors.New("got a proof for another key")
+	}
+	return p, nil
+}
+
+// WaitProof asks for the proof of the instance id until it is present in
+// the chain and, if value is not nil, holds value. It returns an error once
+// ctx is done, so ctx should have a deadline.
+func (c *Client) WaitProof(ctx context.Context, id service.InstanceID, value []byte) (*service.Proof, error) {
+	for {
+		pr, err := c.GetProof(ctx, id.Slice())
+		if err != nil && err != ErrNoQuorum {
+			return nil, err
+		}
+		if pr != nil && pr.InclusionProof.Match() {
+			_, vs, err := pr.KeyValue()
+			if err != nil {
+				return nil, err
+			}
+			if value == nil || bytes.Equal(vs[0], value) {
+				return pr, nil
+			}
+		}
+		select {
+		case <-time.After(c.PollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Resolve returns the instance with the name of the darc darcID. The
+// answer is taken from a verified proof of the naming instance, so the
+// nodes can't lie about it.
+func (c *Client) Resolve(ctx context.Context, darcID darc.ID, name string) (service.InstanceID, error) {
+	pr, err := c.GetProof(ctx, service.NamingKey(darcID, name).Slice())
+	if err != nil {
+		return service.InstanceID{}, err
+	}
+	if !pr.InclusionProof.Match() {
+		return service.InstanceID{}, fmt.Errorf("unknown name %s", name)
+	}
+	_, vs, err := pr.KeyValue()
+	if err != nil {
+		return service.InstanceID{}, err
+	}
+	if len(vs) < 2 || string(vs[1]) != service.ContractNamingID || len(vs[0]) != 64 {
+		return service.InstanceID{}, errors.New("invalid name record")
+	}
+	return service.NewInstanceID(vs[0]), nil
+}
+
+// CallView returns the result of the view of the contract of the instance
+// id. Views are computed by one node and can't be verified, so the result
+// should only be trusted as much as the node that answered.
+func (c *Client) CallView(ctx context.Context, id service.InstanceID, view string, args service.Arguments) ([]byte, error) {
+	reply := &service.CallViewResponse{}
+	err := c.send(ctx, &service.CallView{
+		Version:     service.CurrentVersion,
+		SkipchainID: c.ID,
+		InstanceID:  id,
+		View:        view,
+		Args:        args,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Result, nil
+}
+
+// SearchEvents returns the events emitted by contractID with the given topic
+// in the blocks from the index from to the index to. Empty strings match any
+// contract or topic, and to == 0 searches until the latest block. Like views,
+// the events can't be verified.
+func (c *Client) SearchEvents(ctx context.Context, contractID, topic string, from, to int) (*service.SearchEventsResponse, error) {
+	reply := &service.SearchEventsResponse{}
+	err := c.send(ctx, &service.SearchEvents{
+		Version:     service.CurrentVersion,
+		SkipchainID: c.ID,
+		ContractID:  contractID,
+		Topic:       topic,
+		From:        from,
+		To:          to,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// ListBlocks returns the summaries of count blocks before the block with
+// index before, or before the latest block if before == 0, starting with
+// the newest one. Like views, the summaries can't be verified.
+func (c *Client) ListBlocks(ctx context.Context, before, count int) (*service.ListBlocksResponse, error) {
+	reply := &service.ListBlocksResponse{}
+	err := c.send(ctx, &service.ListBlocks{
+		Version:     service.CurrentVersion,
+		SkipchainID: c.ID,
+		Before:      before,
+		Count:       count,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// DecodeBlock returns the summaries of the transactions of the block with
+// the given index. The summaries can't be verified.
+func (c *Client) DecodeBlock(ctx context.Context, index int) (*service.DecodeBlockResponse, error) {
+	reply := &service.DecodeBlockResponse{}
+	err := c.send(ctx, &service.DecodeBlock{
+		Version:     service.CurrentVersion,
+		SkipchainID: c.ID,
+		Index:       index,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// SearchInstances returns the instances whose ID contains the hex encoded
+// query and the darcs whose description contains it. The instances can be
+// verified with GetProof.
+func (c *Client) SearchInstances(ctx context.Context, query string) (*service.SearchInstancesResponse, error) {
+	reply := &service.SearchInstancesResponse{}
+	err := c.send(ctx, &service.SearchInstances{
+		Version:     service.CurrentVersion,
+		SkipchainID: c.ID,
+		Query:       query,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// send sends msg to the nodes of the roster one after the other, starting
+// with the last one that answered, until one of them answers. It stops
+// once ctx is done, but the request to the current node is not aborted.
+func (c *Client) send(ctx context.Context, msg, reply interface{}) error {
+	c.Lock()
+	list := c.Roster.List
+	if len(list) == 0 {
+		c.Unlock()
+		return errors.New("empty roster")
+	}
+	first := c.next % len(list)
+	c.Unlock()
+
+	var err error
+	for i := range list {
+		idx := (first + i) % len(list)
+		done := make(chan error, 1)
+		go func(si *network.ServerIdentity) {
+			done <- c.onet.SendProtobuf(si, msg, reply)
+		}(list[idx])
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err == nil {
+			c.Lock()
+			c.next = idx
+			c.Unlock()
+			return nil
+		}
+		log.Lvlf2("Request to %s failed: %v", list[idx], err)
+	}
+	return fmt.Errorf("no node of the roster answered, last error: %v", err)
+}
@@ -0,0 +1,288 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/contracts"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestClient(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+	msg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:value", "spawn:naming"}, signer.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 500 * time.Millisecond
+	gDarc := &msg.GenesisDarc
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := CreateChain(ctx, msg)
+	require.Nil(t, err)
+
+	// The first node can't be reached, so the requests go to the others.
+	down := network.NewServerIdentity(key.NewKeyPair(cothority.Suite).Public,
+		network.NewTCPAddress("127.0.0.1:2"))
+	c.Roster = onet.NewRoster(append([]*network.ServerIdentity{down}, roster.List...))
+
+	value := []byte("1234")
+	tx := service.ClientTransaction{Instructions: service.Instructions{{
+		InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+		Nonce:      service.GenNonce(),
+		Index:      0,
+		Length:     1,
+		Spawn: &service.Spawn{
+			ContractID: contracts.ContractValueID,
+			Args:       service.Arguments{{Name: "value", Value: value}},
+		},
+	}}}
+	require.Nil(t, tx.Instructions[0].SignBy(signer))
+	require.Nil(t, c.AddTransaction(ctx, tx))
+	id := tx.Instructions[0].DeriveID(contracts.ContractValueID)
+	pr, err := c.WaitProof(ctx, id, value)
+	require.Nil(t, err)
+	require.True(t, pr.InclusionProof.Match())
+
+	tx, err = c.Sign(service.Instructions{{
+		InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+		Spawn: &service.Spawn{
+			ContractID: service.ContractNamingID,
+			Args: service.Arguments{
+				{Name: "name", Value: []byte("values/first")},
+				{Name: "instanceID", Value: id.Slice()},
+			},
+		},
+	}}, signer)
+	require.Nil(t, err)
+	require.Equal(t, 1, tx.Instructions[0].Length)
+	require.Nil(t, c.AddTransaction(ctx, tx))
+	_, err = c.WaitProof(ctx, service.NamingKey(gDarc.GetBaseID(), "values/first"), nil)
+	require.Nil(t, err)
+	resolved, err := c.Resolve(ctx, gDarc.GetBaseID(), "values/first")
+	require.Nil(t, err)
+	require.True(t, resolved.Equal(id))
+	_, err = c.Resolve(ctx, gDarc.GetBaseID(), "values/second")
+	require.NotNil(t, err)
+
+	// Proofs of another chain are refused.
+	other := New(c.Roster, []byte("another chain"))
+	_, err = other.GetProof(ctx, id.Slice())
+	require.NotNil(t, err)
+
+	// Requests stop once the context is done.
+	short, cancelShort := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelShort()
+	_, err = c.WaitProof(short, service.InstanceID{DarcID: gDarc.GetBaseID(), SubID: service.SubID{1}}, nil)
+	require.NotNil(t, err)
+
+	local.WaitDone(msg.BlockInterval)
+}
+
+// TestClient_Offline builds a transaction on one client, signs it without
+// a connection and submits it from another client.
+func TestClient_Offline(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	other := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+	msg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:value"}, signer.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 500 * time.Millisecond
+	gDarc := &msg.GenesisDarc
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := CreateChain(ctx, msg)
+	require.Nil(t, err)
+
+	value := []byte("offline")
+	spawn := service.Instruction{
+		InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+		Spawn: &service.Spawn{
+			ContractID: contracts.ContractValueID,
+			Args:       service.Arguments{{Name: "value", Value: value}},
+		},
+	}
+	u, err := c.Build(ctx, service.Instructions{spawn}, signer.Identity())
+	require.Nil(t, err)
+	buf, err := u.Encode()
+	require.Nil(t, err)
+
+	// The air-gapped machine only has the encoded transaction.
+	offline, err := DecodeUnsignedTransaction(buf)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(offline.Missing()))
+	require.NotNil(t, offline.Sign(other))
+	require.Nil(t, offline.Sign(signer))
+	require.Equal(t, 0, len(offline.Missing()))
+	signed, err := offline.Encode()
+	require.Nil(t, err)
+
+	u, err = DecodeUnsignedTransaction(signed)
+	require.Nil(t, err)
+	require.NotNil(t, New(roster, []byte("another chain")).Submit(ctx, u))
+	c2 := New(roster, c.ID)
+	require.Nil(t, c2.Submit(ctx, u))
+	id := u.Transaction.Instructions[0].DeriveID(contracts.ContractValueID)
+	_, err = c2.WaitProof(ctx, id, value)
+	require.Nil(t, err)
+
+	// Unsigned transactions and unknown darcs are refused.
+	u, err = c.Build(ctx, service.Instructions{spawn}, signer.Identity())
+	require.Nil(t, err)
+	require.NotNil(t, c.Submit(ctx, u))
+	spawn.InstanceID.DarcID = []byte("0123456789abcdef0123456789abcdef")
+	_, err = c.Build(ctx, service.Instructions{spawn}, signer.Identity())
+	require.NotNil(t, err)
+
+	local.WaitDone(msg.BlockInterval)
+}
+
+func TestClient_Quorum(t *testing.T) {
+	require.Equal(t, 1, QuorumSize(1))
+	require.Equal(t, 1, QuorumSize(3))
+	require.Equal(t, 2, QuorumSize(4))
+	require.Equal(t, 3, QuorumSize(7))
+
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(4, true)
+	msg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:value"}, signer.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 500 * time.Millisecond
+	gDarc := &msg.GenesisDarc
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := CreateChain(ctx, msg)
+	require.Nil(t, err)
+	c.Quorum = true
+
+	value := []byte("quorum")
+	tx, err := c.Sign(service.Instructions{{
+		InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+		Spawn: &service.Spawn{
+			ContractID: contracts.ContractValueID,
+			Args:       service.Arguments{{Name: "value", Value: value}},
+		},
+	}}, signer)
+	require.Nil(t, err)
+	require.Nil(t, c.AddTransaction(ctx, tx))
+	id := tx.Instructions[0].DeriveID(contracts.ContractValueID)
+	_, err = c.WaitProof(ctx, id, value)
+	require.Nil(t, err)
+
+	// With only one of the four nodes answering there is no quorum.
+	var list []*network.ServerIdentity
+	for i := 0; i < 3; i++ {
+		list = append(list, network.NewServerIdentity(key.NewKeyPair(cothority.Suite).Public,
+			network.NewTCPAddress(fmt.Sprintf("127.0.0.1:%d", i+2))))
+	}
+	c.Roster = onet.NewRoster(append(list, roster.List[0]))
+	_, err = c.GetProofQuorum(ctx, id.Slice())
+	require.Equal(t, ErrNoQuorum, err)
+
+	local.WaitDone(msg.BlockInterval)
+}
+
+func TestClient_Cache(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+	msg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:value", "invoke:update"}, signer.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 500 * time.Millisecond
+	gDarc := &msg.GenesisDarc
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := CreateChain(ctx, msg)
+	require.Nil(t, err)
+
+	spawn := service.Instruction{
+		InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+		Spawn: &service.Spawn{
+			ContractID: contracts.ContractValueID,
+			Args:       service.Arguments{{Name: "value", Value: []byte("first")}},
+		},
+	}
+	tx, err := c.Sign(service.Instructions{spawn}, signer)
+	require.Nil(t, err)
+	require.Nil(t, c.AddTransaction(ctx, tx))
+	id := tx.Instructions[0].DeriveID(contracts.ContractValueID)
+	_, err = c.WaitProof(ctx, id, []byte("first"))
+	require.Nil(t, err)
+
+	cache := NewCache(c)
+	require.Nil(t, cache.Latest())
+	pr, err := cache.GetProof(ctx, id.Slice())
+	require.Nil(t, err)
+	_, vs, err := pr.KeyValue()
+	require.Nil(t, err)
+	require.Equal(t, []byte("first"), vs[0])
+	first := cache.Latest()
+	require.NotNil(t, first)
+
+	// Until MaxAge, the cached proof is returned.
+	tx, err = c.Sign(service.Instructions{{
+		InstanceID: id,
+		Invoke: &service.Invoke{
+			Command: "update",
+			Args:    service.Arguments{{Name: "value", Value: []byte("second")}},
+		},
+	}}, signer)
+	require.Nil(t, err)
+	require.Nil(t, c.AddTransaction(ctx, tx))
+	_, err = c.WaitProof(ctx, id, []byte("second"))
+	require.Nil(t, err)
+	cached, err := cache.GetProof(ctx, id.Slice())
+	require.Nil(t, err)
+	require.Equal(t, pr, cached)
+
+	// After an update, the proof holds the new value and is valid from the
+	// genesis block.
+	require.Nil(t, cache.Update(ctx))
+	require.True(t, cache.Latest().Index > first.Index)
+	pr, err = cache.GetProof(ctx, id.Slice())
+	require.Nil(t, err)
+	require.Nil(t, pr.Verify(c.ID))
+	_, vs, err = pr.KeyValue()
+	require.Nil(t, err)
+	require.Equal(t, []byte("second"), vs[0])
+
+	// New keys are added to the cache.
+	cache.MaxAge = 0
+	pr, err = cache.GetProof(ctx, service.GenesisReferenceID.Slice())
+	require.Nil(t, err)
+	require.True(t, pr.InclusionProof.Match())
+	require.Nil(t, pr.Verify(c.ID))
+
+	local.WaitDone(msg.BlockInterval)
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// UnsignedTransactionVersion is the version of the encoding of
+// UnsignedTransaction.
+const UnsignedTransactionVersion = 1
+
+// UnsignedTransaction is a transaction that is built on a machine connected
+// to the nodes and signed on another one, which can be air-gapped. Its
+// instructions are complete, only the signatures are missing.
+type UnsignedTransaction struct {
+	// Version of the encoding.
+	Version int
+	// SkipchainID is the chain the signatures are valid for.
+	SkipchainID skipchain.SkipBlockID
+	// Transaction holds the instructions, the Signer of every signature is
+	// set, and its Signature once it is signed.
+	Transaction service.ClientTransaction
+}
+
+// Build returns the transaction of the instructions, to be signed by the
+// signers. It sets the nonce, index and length of the instructions and
+// checks that their darcs exist.
+func (c *Client) Build(ctx context.Context, instrs service.Instructions, signers ...darc.Identity) (*UnsignedTransaction, error) {
+	if len(signers) == 0 {
+		return nil, errors.New("need at least one signer")
+	}
+	u := &UnsignedTransaction{
+		Version:     UnsignedTransactionVersion,
+		SkipchainID: c.ID,
+		Transaction: service.ClientTransaction{
+			Instructions: make(service.Instructions, len(instrs)),
+		},
+	}
+	checked := map[string]bool{}
+	for i, instr := range instrs {
+		darcID := string(instr.InstanceID.DarcID)
+		if !checked[darcID] {
+			p, err := c.GetProof(ctx, service.InstanceID{DarcID: instr.InstanceID.DarcID}.Slice())
+			if err != nil {
+				return nil, err
+			}
+			if !p.InclusionProof.Match() {
+				return nil, fmt.Errorf("darc %x of instruction %d not found", instr.InstanceID.DarcID, i)
+			}
+			_, vs, err := p.KeyValue()
+			if err != nil {
+				return nil, err
+			}
+			if len(vs) < 2 || string(vs[1]) != service.ContractDarcID {
+				return nil, fmt.Errorf("instance %x is not a darc", instr.InstanceID.DarcID)
+			}
+			checked[darcID] = true
+		}
+		instr.Nonce = service.GenNonce()
+		instr.Index = i
+		instr.Length = len(instrs)
+		instr.SignatureVersion = darc.CurrentRequestVersion
+		instr.Signatures = make([]darc.Signature, len(signers))
+		for j, signer := range signers {
+			instr.Signatures[j] = darc.Signature{Signer: signer}
+		}
+		u.Transaction.Instructions[i] = instr
+	}
+	return u, nil
+}
+
+// SetSignatureVersion sets the version of the darc requests the instructions
+// are signed with, for example darc.RequestVersionHardware for hardware
+// wallets. It fails once an instruction has been signed.
+func (u *UnsignedTransaction) SetSignatureVersion(version uint32) error {
+	for _, instr := range u.Transaction.Instructions {
+		for _, sig := range instr.Signatures {
+			if len(sig.Signature) > 0 {
+				return errors.New("the transaction is already signed")
+			}
+		}
+	}
+	for i := range u.Transaction.Instructions {
+		u.Transaction.Instructions[i].SignatureVersion = version
+	}
+	return nil
+}
+
+// Digests returns the message the signers sign for every instruction.
+func (u *UnsignedTransaction) Digests() ([][]byte, error) {
+	digests := make([][]byte, len(u.Transaction.Instructions))
+	for i, instr := range u.Transaction.Instructions {
+		req, err := instr.ToDarcRequest(u.SkipchainID)
+		if err != nil {
+			return nil, err
+		}
+		digests[i] = req.Hash()
+	}
+	return digests, nil
+}
+
+// Sign adds the signatures of the signer to all instructions. The signer
+// must be one of the signers given to Build. Sign doesn't contact the nodes.
+func (u *UnsignedTransaction) Sign(signer darc.Signer) error {
+	digests, err := u.Digests()
+	if err != nil {
+		return err
+	}
+	id := signer.Identity()
+	for i, instr := range u.Transaction.Instructions {
+		found := false
+		for j := range instr.Signatures {
+			if !instr.Signatures[j].Signer.Equal(&id) {
+				continue
+			}
+			instr.Signatures[j].Signature, err = signer.Sign(digests[i])
+			if err != nil {
+				return err
+			}
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("%s is not a signer of instruction %d", id, i)
+		}
+	}
+	return nil
+}
+
+// Missing returns the signers that didn't sign yet.
+func (u *UnsignedTransaction) Missing() []darc.Identity {
+	if len(u.Transaction.Instructions) == 0 {
+		return nil
+	}
+	var missing []darc.Identity
+	for _, sig := range u.Transaction.Instructions[0].Signatures {
+		if len(sig.Signature) == 0 {
+			missing = append(missing, sig.Signer)
+		}
+	}
+	return missing
+}
+
+// Encode returns the transaction in the format read by
+// DecodeUnsignedTransaction, to be moved between the machines.
+func (u *UnsignedTransaction) Encode() ([]byte, error) {
+	return protobuf.Encode(u)
+}
+
+// DecodeUnsignedTransaction decodes a transaction encoded by Encode.
+func DecodeUnsignedTransaction(buf []byte) (*UnsignedTransaction, error) {
+	u := &UnsignedTransaction{}
+	err := protobuf.DecodeWithConstructors(buf, u, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	if u.Version != UnsignedTransactionVersion {
+		return nil, fmt.Errorf("unknown version %d of the transaction", u.Version)
+	}
+	return u, nil
+}
+
+// Submit sends the signed transaction to a node of the roster, it fails if
+// a signature is missing or if the transaction is for another chain.
+func (c *Client) Submit(ctx context.Context, u *UnsignedTransaction) error {
+	if !u.SkipchainID.Equal(c.ID) {
+		return errors.New("the transaction is for another chain")
+	}
+	for i, instr := range u.Transaction.Instructions {
+		for _, sig := range instr.Signatures {
+			if len(sig.Signature) == 0 {
+				return fmt.Errorf("instruction %d is not signed by %s", i, sig.Signer)
+			}
+		}
+	}
+	return c.AddTransaction(ctx, u.Transaction)
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// ErrNoQuorum is returned by GetProofQuorum if not enough nodes agree on
+// the latest block. It is usually temporary, as the nodes catch up.
+var ErrNoQuorum = errors.New("not enough nodes agree on the latest block")
+
+// QuorumSize returns the number of nodes that must agree on a proof in a
+// roster of n nodes: f+1, where f = (n-1)/3 is the number of faulty nodes
+// the roster tolerates. At least one of them is honest.
+func QuorumSize(n int) int {
+	return (n-1)/3 + 1
+}
+
+// GetProofQuorum returns the proof for the key once QuorumSize distinct
+// nodes of the roster returned valid proofs for the same latest block. As
+// the collection root is stored in the block, they also agree on the value
+// of the key. This protects against a single malicious or late node serving
+// an outdated view of the chain. ErrNoQuorum is returned if the nodes are not
+// at the same block, for example while a new block is added.
+func (c *Client) GetProofQuorum(ctx context.Context, key []byte) (*service.Proof, error) {
+	c.Lock()
+	var list []*network.ServerIdentity
+	seen := map[network.ServerIdentityID]bool{}
+	for _, si := range c.Roster.List {
+		if !seen[si.ID] {
+			seen[si.ID] = true
+			list = append(list, si)
+		}
+	}
+	c.Unlock()
+	if len(list) == 0 {
+		return nil, errors.New("empty roster")
+	}
+	quorum := QuorumSize(len(list))
+
+	type answer struct {
+		si    *network.ServerIdentity
+		proof *service.Proof
+		err   error
+	}
+	answers := make(chan answer, len(list))
+	for _, si := range list {
+		go func(si *network.ServerIdentity) {
+			reply := &service.GetProofResponse{}
+			err := c.onet.SendProtobuf(si, c.getProofMsg(key), reply)
+			if err != nil {
+				answers <- answer{si: si, err: err}
+				return
+			}
+			p, err := c.verifyProof(&reply.Proof, key)
+			answers <- answer{si: si, proof: p, err: err}
+		}(si)
+	}
+
+	votes := map[string]int{}
+	var err error
+	for range list {
+		select {
+		case a := <-answers:
+			if a.err != nil {
+				log.Lvlf2("Proof from %s refused: %v", a.si, a.err)
+				err = a.err
+				continue
+			}
+			latest := string(a.proof.Latest.Hash)
+			votes[latest]++
+			if votes[latest] >= quorum {
+				return a.proof, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err != nil {
+		log.Lvlf2("Less than %d nodes returned the same proof, last error: %v", quorum, err)
+	}
+	return nil, ErrNoQuorum
+}
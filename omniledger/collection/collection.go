@@ -5,7 +5,10 @@
 // distributed and decentralized ledgers with minimal bootstrapping time.
 package collection
 
-import "sync"
+import (
+	"errors"
+	"sync"
+)
 
 // Collection represents the Merkle-tree based data structure.
 // The data is defined by a pointer to its root.
@@ -16,6 +19,7 @@ type Collection struct {
 	scope  scope
 
 	autoCollect flag
+	hashValues  bool
 	transaction struct {
 		ongoing bool
 		id      uint64
@@ -86,6 +90,7 @@ func (c *Collection) Clone() (collection *Collection) {
 
 	collection.scope = c.scope.clone()
 	collection.autoCollect = c.autoCollect
+	collection.hashValues = c.hashValues
 
 	collection.transaction.ongoing = false
 	collection.transaction.id = 0
@@ -121,3 +126,52 @@ func (c *Collection) GetRoot() []byte {
 	defer c.Unlock()
 	return c.root.key
 }
+
+// HashValues switches the labels of the leaves to a hash of their key and of
+// the hash of their values, and recomputes the labels of the collection. The
+// proofs of such a collection still verify a leaf whose values have been
+// removed, because it carries the hash of the values. It fails if some nodes
+// of the collection are unknown.
+func (c *Collection) HashValues() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.transaction.ongoing {
+		return errors.New("cannot hash the values while a transaction is ongoing")
+	}
+	if c.hashValues {
+		return nil
+	}
+
+	var known func(*node) bool
+	known = func(cursor *node) bool {
+		return cursor.known && (cursor.leaf() ||
+			(known(cursor.children.left) && known(cursor.children.right)))
+	}
+	if !(known(c.root)) {
+		return errors.New("cannot hash the values of unknown nodes")
+	}
+
+	var relabel func(*node) error
+	relabel = func(cursor *node) error {
+		if !(cursor.leaf()) {
+			if err := relabel(cursor.children.left); err != nil {
+				return err
+			}
+			if err := relabel(cursor.children.right); err != nil {
+				return err
+			}
+		}
+		return c.update(cursor)
+	}
+
+	c.hashValues = true
+	return relabel(c.root)
+}
+
+// HashesValues returns true if the labels of the leaves commit to the hash of
+// their values, see HashValues.
+func (c *Collection) HashesValues() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.hashValues
+}
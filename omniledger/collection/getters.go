@@ -73,7 +73,7 @@ func (g Getter) Proof() (Proof, error) {
 	proof.Key = make([]byte, len(g.key))
 	copy(proof.Key, g.key)
 
-	proof.Root = dumpNode(g.collection.root)
+	proof.Root = dumpNode(g.collection.root, g.collection.hashValues)
 
 	path := sha256.Sum256(g.key)
 
@@ -90,8 +90,8 @@ func (g Getter) Proof() (Proof, error) {
 		}
 
 		proof.Steps = append(proof.Steps,
-			step{dumpNode(cursor.children.left),
-				dumpNode(cursor.children.right)})
+			step{dumpNode(cursor.children.left, g.collection.hashValues),
+				dumpNode(cursor.children.right, g.collection.hashValues)})
 
 		if bit(path[:], depth) {
 			cursor = cursor.children.right
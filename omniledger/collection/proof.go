@@ -1,6 +1,7 @@
 package collection
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"errors"
 
@@ -9,7 +10,7 @@ import (
 
 // Constructors
 
-func dumpNode(n *node) (d dump) {
+func dumpNode(n *node, hashValues bool) (d dump) {
 	// To avoid race conditions, we want a deep copy here.
 	var nodeCopy node
 	n.copyTo(&nodeCopy)
@@ -20,6 +21,10 @@ func dumpNode(n *node) (d dump) {
 	// NOTE: this is the same as node.leaf() without the locks.
 	if nodeCopy.children.left == nil {
 		d.Key = nodeCopy.key
+		if hashValues {
+			h := valuesHash(nodeCopy.values)
+			d.ValuesHash = h[:]
+		}
 	} else {
 		// Do we still need locking when we copy?
 		nodeCopy.children.left.Lock()
@@ -45,6 +50,18 @@ func (d *dump) leaf() bool {
 // Methods
 
 func (d *dump) consistent() bool {
+	if d.hashedValues() {
+		var h [sha256.Size]byte
+		if len(d.ValuesHash) != len(h) {
+			return false
+		}
+		copy(h[:], d.ValuesHash)
+		if len(d.Values) > 0 && valuesHash(d.Values) != h {
+			return false
+		}
+		return d.Label == (&hashedLeaf{d.Key, h}).hash()
+	}
+
 	var toEncode toHash
 	if d.leaf() {
 		toEncode = toHash{true, d.Key, d.Values, [sha256.Size]byte{}, [sha256.Size]byte{}}
@@ -158,9 +175,54 @@ func (p Proof) Values() ([]interface{}, error) {
 	return values, nil
 }
 
+// hashedValues returns true if the dump is a leaf of a collection with hashed
+// values.
+func (d *dump) hashedValues() bool {
+	return d.leaf() && len(d.ValuesHash) > 0
+}
+
+// redacted returns true if the values of the leaf have been removed by
+// Proof.Redact. Leaves of a collection always have one value per field.
+func (d *dump) redacted() bool {
+	empty := valuesHash(nil)
+	return d.hashedValues() && len(d.Values) == 0 && !bytes.Equal(d.ValuesHash, empty[:])
+}
+
 // Consistent returns true if the given proof is correct, that is, if it is
 // a valid representation and all steps are valid.
 func (p Proof) Consistent() bool {
+	return p.consistent(false)
+}
+
+// ConsistentRedacted is like Consistent, but accepts the leaves whose values
+// have been removed with Redact. The label of such a leaf is recomputed from
+// its key and the hash of its values, so the key is verified, too.
+func (p Proof) ConsistentRedacted() bool {
+	return p.consistent(true)
+}
+
+// Redact removes the values of the leaves in the proof for which redact
+// returns true, and returns true if any values have been removed. It fails if
+// such a leaf is not from a collection with hashed values, see
+// Collection.HashValues, as its label couldn't be verified without the
+// values. A redacted proof must be verified with ConsistentRedacted.
+func (p *Proof) Redact(redact func(key []byte) bool) (bool, error) {
+	var removed bool
+	for i := range p.Steps {
+		for _, d := range []*dump{&p.Steps[i].Left, &p.Steps[i].Right} {
+			if d.leaf() && len(d.Values) > 0 && redact(d.Key) {
+				if !d.hashedValues() {
+					return false, errors.New("cannot redact a leaf without hashed values")
+				}
+				d.Values = nil
+				removed = true
+			}
+		}
+	}
+	return removed, nil
+}
+
+func (p Proof) consistent(allowRedacted bool) bool {
 	if len(p.Steps) == 0 {
 		return false
 	}
@@ -177,8 +239,13 @@ func (p Proof) Consistent() bool {
 			return false
 		}
 
-		if !(p.Steps[depth].Left.consistent()) || !(p.Steps[depth].Right.consistent()) {
-			return false
+		for _, d := range []*dump{&p.Steps[depth].Left, &p.Steps[depth].Right} {
+			if !allowRedacted && d.redacted() {
+				return false
+			}
+			if !d.consistent() {
+				return false
+			}
 		}
 
 		if bit(path[:], depth) {
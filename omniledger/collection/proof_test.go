@@ -15,7 +15,7 @@ func TestProofDumpNode(test *testing.T) {
 	collection := New(stake64, data)
 	collection.Add([]byte("mykey"), uint64(66), []byte("myvalue"))
 
-	rootDump := dumpNode(collection.root)
+	rootDump := dumpNode(collection.root, false)
 
 	if rootDump.Label != collection.root.label {
 		test.Error("[proof.go]", "[dumpNode]", "dumpNode() sets wrong label on dump of internal node.")
@@ -45,7 +45,7 @@ func TestProofDumpNode(test *testing.T) {
 		leaf = collection.root.children.left
 	}
 
-	leafDump := dumpNode(leaf)
+	leafDump := dumpNode(leaf, false)
 
 	if leafDump.Label != leaf.label {
 		test.Error("[proof.go]", "[dumpNode]", "dumpNode() sets wrong label on dump of leaf.")
@@ -77,7 +77,7 @@ func TestProofDumpGetters(test *testing.T) {
 	collection := New(stake64, data)
 	collection.Add([]byte("mykey"), uint64(66), []byte("myvalue"))
 
-	rootDump := dumpNode(collection.root)
+	rootDump := dumpNode(collection.root, false)
 
 	var leaf *node
 
@@ -87,7 +87,7 @@ func TestProofDumpGetters(test *testing.T) {
 		leaf = collection.root.children.left
 	}
 
-	leafDump := dumpNode(leaf)
+	leafDump := dumpNode(leaf, false)
 
 	if rootDump.leaf() {
 		test.Error("[proof.go]", "[dumpgetters]", "leaf() returns true on internal node.")
@@ -105,7 +105,7 @@ func TestProofDumpConsistent(test *testing.T) {
 	collection := New(stake64, data)
 	collection.Add([]byte("mykey"), uint64(66), []byte("myvalue"))
 
-	rootDump := dumpNode(collection.root)
+	rootDump := dumpNode(collection.root, false)
 
 	var leaf *node
 
@@ -115,7 +115,7 @@ func TestProofDumpConsistent(test *testing.T) {
 		leaf = collection.root.children.left
 	}
 
-	leafDump := dumpNode(leaf)
+	leafDump := dumpNode(leaf, false)
 
 	if !(rootDump.consistent()) {
 		test.Error("[proof.go]", "[consistent]", "consistent() returns false on valid internal node.")
@@ -147,9 +147,9 @@ func TestProofDumpTo(test *testing.T) {
 	collection := New(stake64, data)
 	collection.Add([]byte("mykey"), uint64(66), []byte("myvalue"))
 
-	rootDump := dumpNode(collection.root)
-	leftDump := dumpNode(collection.root.children.left)
-	rightDump := dumpNode(collection.root.children.right)
+	rootDump := dumpNode(collection.root, false)
+	leftDump := dumpNode(collection.root.children.left, false)
+	rightDump := dumpNode(collection.root.children.right, false)
 
 	unknown := New(stake64, data)
 	unknown.scope.None()
@@ -236,13 +236,13 @@ func TestProofMatchValues(test *testing.T) {
 	proof := Proof{}
 	proof.collection = collection
 	proof.Key = firstKey
-	proof.Root = dumpNode(collection.root)
+	proof.Root = dumpNode(collection.root, false)
 
 	path := sha256.Sum256(firstKey)
 	cursor := collection.root
 
 	for depth := 0; depth < 6; depth++ {
-		proof.Steps = append(proof.Steps, step{dumpNode(cursor.children.left), dumpNode(cursor.children.right)})
+		proof.Steps = append(proof.Steps, step{dumpNode(cursor.children.left, false), dumpNode(cursor.children.right, false)})
 
 		if bit(path[:], depth) {
 			cursor = cursor.children.right
@@ -485,6 +485,83 @@ func TestProofConsistent(test *testing.T) {
 	}
 }
 
+func TestProofRedact(test *testing.T) {
+	collection := New(Data{})
+
+	for index := 0; index < 64; index++ {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(index))
+
+		collection.Add(key, key)
+	}
+
+	key := make([]byte, 8)
+	proof, _ := collection.Get(key).Proof()
+
+	if _, err := proof.Redact(func([]byte) bool { return true }); err == nil {
+		test.Error("[proof.go]", "[redact]", "Redact removed values of a collection without hashed values.")
+	}
+
+	root := collection.root.label
+	if collection.HashValues() != nil {
+		test.Error("[collection.go]", "[hashvalues]", "HashValues returns an error.")
+	}
+	if !(collection.HashesValues()) || !(collection.Clone().HashesValues()) {
+		test.Error("[collection.go]", "[hashvalues]", "Collection doesn't hash the values.")
+	}
+	if collection.root.label == root {
+		test.Error("[collection.go]", "[hashvalues]", "HashValues didn't change the labels.")
+	}
+	other := make([]byte, 8)
+	binary.BigEndian.PutUint64(other, 64)
+	collection.Add(other, other)
+
+	proof, _ = collection.Get(key).Proof()
+	if !(proof.Consistent()) {
+		test.Error("[proof.go]", "[redact]", "Proof of a collection with hashed values is not consistent.")
+	}
+	if removed, _ := proof.Redact(func([]byte) bool { return false }); removed {
+		test.Error("[proof.go]", "[redact]", "Redact removed values although no key was selected.")
+	}
+	if removed, _ := proof.Redact(func(k []byte) bool { return equal(k, key) }); !removed {
+		test.Error("[proof.go]", "[redact]", "Redact didn't remove the values of the key.")
+	}
+
+	if proof.Consistent() {
+		test.Error("[proof.go]", "[redact]", "Redacted proof is consistent.")
+	}
+	if !(proof.ConsistentRedacted()) {
+		test.Error("[proof.go]", "[redact]", "Redacted proof is not consistent with redacted leaves allowed.")
+	}
+	if !(proof.Match()) {
+		test.Error("[proof.go]", "[redact]", "Redacted proof doesn't match the key anymore.")
+	}
+	values, _ := proof.RawValues()
+	if len(values) != 0 {
+		test.Error("[proof.go]", "[redact]", "Redacted proof still has values.")
+	}
+
+	leaf := &(proof.Steps[len(proof.Steps)-1].Left)
+	if !(equal(leaf.Key, key)) {
+		leaf = &(proof.Steps[len(proof.Steps)-1].Right)
+	}
+	leaf.Key[0]++
+	if proof.ConsistentRedacted() {
+		test.Error("[proof.go]", "[redact]", "Redacted proof is still consistent after altering the key of the leaf.")
+	}
+	leaf.Key[0]--
+	leaf.ValuesHash[0]++
+	if proof.ConsistentRedacted() {
+		test.Error("[proof.go]", "[redact]", "Redacted proof is still consistent after altering the hash of the values.")
+	}
+	leaf.ValuesHash[0]--
+
+	leaf.Values = [][]byte{other}
+	if proof.Consistent() || proof.ConsistentRedacted() {
+		test.Error("[proof.go]", "[redact]", "Proof is consistent with other values than the hashed ones.")
+	}
+}
+
 func TestProofSerialization(test *testing.T) {
 	stake64 := Stake64{}
 	data := Data{}
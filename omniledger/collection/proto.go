@@ -18,6 +18,9 @@ type dump struct {
 	Values   [][]byte
 	Children children
 	Label    [sha256.Size]byte
+	// ValuesHash is the hash of the values of a leaf in a collection with
+	// hashed values. It is kept when the values are redacted.
+	ValuesHash []byte
 }
 
 type children struct {
@@ -16,6 +16,19 @@ type toHash struct {
 	RightLabel [sha256.Size]byte
 }
 
+// hashedLeaf is hashed to get the label of a leaf in a collection with hashed
+// values. Its label commits to the hash of the values, so that it can be
+// recomputed from a proof without the values.
+type hashedLeaf struct {
+	Key        []byte
+	ValuesHash [sha256.Size]byte
+}
+
+// hashedLeafPrefix is written before the encoding of a hashedLeaf. It is not
+// a valid protobuf tag, so that the label of a hashedLeaf is never the one of
+// a toHash.
+const hashedLeafPrefix = 0
+
 // Private methods (collection) (single node operations)
 
 func (c *Collection) update(node *node) error {
@@ -41,7 +54,7 @@ func (c *Collection) update(node *node) error {
 		}
 	}
 
-	label := node.generateHash()
+	label := node.generateHash(c.hashValues)
 	node.label = label
 
 	return nil
@@ -66,10 +79,12 @@ func (c *Collection) setPlaceholder(node *node) error {
 	return nil
 }
 
-func (n *node) generateHash() [sha256.Size]byte {
+func (n *node) generateHash(hashValues bool) [sha256.Size]byte {
 
 	var toEncode toHash
-	if n.leaf() {
+	if n.leaf() && hashValues {
+		return (&hashedLeaf{n.key, valuesHash(n.values)}).hash()
+	} else if n.leaf() {
 		toEncode = toHash{true, n.key, n.values, [sha256.Size]byte{}, [sha256.Size]byte{}}
 	} else {
 		toEncode = toHash{false, []byte{}, n.values, n.children.left.label, n.children.right.label}
@@ -86,3 +101,23 @@ func (data *toHash) hash() [sha256.Size]byte {
 
 	return sha256.Sum256(buff)
 }
+
+func (data *hashedLeaf) hash() [sha256.Size]byte {
+	buff, err := protobuf.Encode(data)
+	if err != nil {
+		panic("couldn't encode: " + err.Error())
+	}
+
+	return sha256.Sum256(append([]byte{hashedLeafPrefix}, buff...))
+}
+
+// valuesHash returns the hash of the values of a leaf, to which its label
+// commits in a collection with hashed values.
+func valuesHash(values [][]byte) [sha256.Size]byte {
+	buff, err := protobuf.Encode(&struct{ Values [][]byte }{values})
+	if err != nil {
+		panic("couldn't encode: " + err.Error())
+	}
+
+	return sha256.Sum256(buff)
+}
@@ -50,7 +50,7 @@ func (t testCtxVerifier) node(prefix string, collection *Collection, node *node)
 			return
 		}
 
-		expectedLabel := node.generateHash()
+		expectedLabel := node.generateHash(collection.hashValues)
 
 		if node.label != expectedLabel {
 			t.test.Error(t.file, prefix, "wrong leaf node label")
@@ -67,7 +67,7 @@ func (t testCtxVerifier) node(prefix string, collection *Collection, node *node)
 			return
 		}
 
-		expectedLabel := node.generateHash()
+		expectedLabel := node.generateHash(collection.hashValues)
 
 		if node.label != expectedLabel {
 			t.test.Error(t.file, prefix, "wrong internal node label")
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 
+	"github.com/dedis/cothority/omniledger/darc"
 	omniledger "github.com/dedis/cothority/omniledger/service"
 	"github.com/dedis/onet/log"
 )
@@ -17,6 +18,11 @@ var ContractCoinID = "coin"
 // to this contract.
 var CoinName = iid("olCoin")
 
+// MintRule is the rule of the genesis darc that the signers of a mint
+// instruction must satisfy, on top of the "invoke:mint" rule of the darc of
+// the account. If the genesis darc has no such rule, nobody can mint coins.
+var MintRule = darc.Action("mint:coin")
+
 // safeUint64 is a uin64 that guards against overflow/underflow.
 type safeUint64 uint64
 
@@ -47,7 +53,8 @@ func (s safeUint64) sub(a uint64) (safeUint64, error) {
 // of 0 coins.
 // The following methods are available:
 //  - mint will add the number of coins in the argument "coins" to the
-//    current coin instance. The argument must be a 64-bit uint in LittleEndian
+//    current coin instance. The argument must be a 64-bit uint in LittleEndian.
+//    The signers must also satisfy the MintRule of the genesis darc
 //  - transfer will send the coins given in the argument "coins" to the
 //    instance given in the argument "destination". The "coins"-argument must
 //    be a 64-bit uint in LittleEndian. The "destination" must be a 64-bit
@@ -93,6 +100,10 @@ func ContractCoin(cdb omniledger.CollectionView, inst omniledger.Instruction, c
 		case "mint":
 			// mint simply adds this amount of coins to the account.
 			log.Lvl2("minting", coinsArg)
+			err = checkMintRule(cdb, inst)
+			if err != nil {
+				return
+			}
 			coinsCurrent, err = coinsCurrent.add(coinsArg)
 			if err != nil {
 				return
@@ -105,6 +116,10 @@ func ContractCoin(cdb omniledger.CollectionView, inst omniledger.Instruction, c
 			}
 
 			target := inst.Invoke.Args.Search("destination")
+			if bytes.Equal(target, inst.InstanceID.Slice()) {
+				err = errors.New("cannot transfer coins to the same account")
+				return
+			}
 			var (
 				v   []byte
 				cid string
@@ -184,6 +199,57 @@ func ContractCoin(cdb omniledger.CollectionView, inst omniledger.Instruction, c
 	return
 }
 
+// CoinBalance is the "balance" view of the coin contract. It returns the
+// number of coins in the account as a 64-bit uint in LittleEndian.
+func CoinBalance(cdb omniledger.CollectionView, id omniledger.InstanceID, args omniledger.Arguments) ([]byte, error) {
+	value, cid, err := cdb.GetValues(id.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if cid != ContractCoinID {
+		return nil, errors.New("instance is not a coin account")
+	}
+	return value, nil
+}
+
+// checkMintRule returns an error if the signers of the instruction don't
+// satisfy the MintRule of the genesis darc. The signatures have already been
+// verified against the darc of the account by the service. The rule is
+// evaluated like the ones of the service, so it can delegate to other darcs.
+func checkMintRule(cdb omniledger.CollectionView, inst omniledger.Instruction) error {
+	darcID, cid, err := cdb.GetValues(omniledger.GenesisReferenceID.Slice())
+	if err != nil {
+		return err
+	}
+	if cid != omniledger.ContractConfigID {
+		return errors.New("couldn't find the chain config")
+	}
+	darcBuf, cid, err := cdb.GetValues(omniledger.InstanceID{DarcID: darcID}.Slice())
+	if err != nil {
+		return err
+	}
+	if cid != omniledger.ContractDarcID {
+		return errors.New("couldn't find the genesis darc")
+	}
+	d, err := darc.NewFromProtobuf(darcBuf)
+	if err != nil {
+		return err
+	}
+	if !d.Rules.Contains(MintRule) {
+		return errors.New("the genesis darc doesn't allow minting")
+	}
+	ids := make([]string, len(inst.Signatures))
+	for i, sig := range inst.Signatures {
+		ids[i] = sig.Signer.String()
+	}
+	err = darc.EvalExprWithLimits(d.Rules[MintRule], omniledger.NewDarcGetter(cdb, inst.DarcProofs...),
+		omniledger.LoadDarcLimits(cdb), ids...)
+	if err != nil {
+		return errors.New("signers are not allowed to mint: " + err.Error())
+	}
+	return nil
+}
+
 // iid uses darc=sha256(in) and subid=sha256(in) in order to manufacture an
 // InstanceID from in.
 //
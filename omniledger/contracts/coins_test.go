@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
 	omniledger "github.com/dedis/cothority/omniledger/service"
 	"github.com/stretchr/testify/require"
 )
@@ -41,6 +43,7 @@ func TestCoin_Spawn(t *testing.T) {
 func TestCoin_InvokeMint(t *testing.T) {
 	// Test that a coin can be minted
 	ct := newCT()
+	minter := ct.storeGenesis(t)
 	coAddr := omniledger.NewInstanceID(nil)
 	ct.Store(coAddr, coinZero, ContractCoinID)
 
@@ -51,6 +54,14 @@ func TestCoin_InvokeMint(t *testing.T) {
 			Args:    omniledger.Arguments{{Name: "coins", Value: coinOne}},
 		},
 	}
+	// Only the minter of the genesis darc can mint.
+	_, _, err := ContractCoin(ct, inst, []omniledger.Coin{})
+	require.Error(t, err)
+	inst.Signatures = []darc.Signature{{Signer: darc.NewSignerEd25519(nil, nil).Identity()}}
+	_, _, err = ContractCoin(ct, inst, []omniledger.Coin{})
+	require.Error(t, err)
+
+	inst.Signatures = []darc.Signature{{Signer: minter}}
 	sc, co, err := ContractCoin(ct, inst, []omniledger.Coin{})
 	require.Nil(t, err)
 	require.Equal(t, 0, len(co))
@@ -59,9 +70,48 @@ func TestCoin_InvokeMint(t *testing.T) {
 		sc[0])
 }
 
+func TestCoin_InvokeMintDelegated(t *testing.T) {
+	// The MintRule can delegate to another darc
+	ct := newCT()
+	minter := darc.NewSignerEd25519(nil, nil).Identity()
+	minters := darc.NewDarc(darc.InitRules([]darc.Identity{minter}, []darc.Identity{minter}),
+		[]byte("minters"))
+	mintersBuf, err := minters.ToProto()
+	require.Nil(t, err)
+	ct.Store(omniledger.InstanceID{DarcID: minters.GetBaseID()}, mintersBuf, omniledger.ContractDarcID)
+
+	owner := darc.NewSignerEd25519(nil, nil).Identity()
+	rules := darc.InitRules([]darc.Identity{owner}, []darc.Identity{owner})
+	require.Nil(t, rules.AddRule(MintRule, expression.Expr(darc.NewIdentityDarc(minters.GetBaseID()).String())))
+	d := darc.NewDarc(rules, []byte("genesis"))
+	darcBuf, err := d.ToProto()
+	require.Nil(t, err)
+	ct.Store(omniledger.GenesisReferenceID, d.GetBaseID(), omniledger.ContractConfigID)
+	ct.Store(omniledger.InstanceID{DarcID: d.GetBaseID()}, darcBuf, omniledger.ContractDarcID)
+
+	coAddr := omniledger.NewInstanceID(nil)
+	ct.Store(coAddr, coinZero, ContractCoinID)
+	inst := omniledger.Instruction{
+		InstanceID: coAddr,
+		Invoke: &omniledger.Invoke{
+			Command: "mint",
+			Args:    omniledger.Arguments{{Name: "coins", Value: coinOne}},
+		},
+		Signatures: []darc.Signature{{Signer: owner}},
+	}
+	_, _, err = ContractCoin(ct, inst, []omniledger.Coin{})
+	require.Error(t, err)
+
+	inst.Signatures = []darc.Signature{{Signer: minter}}
+	sc, _, err := ContractCoin(ct, inst, []omniledger.Coin{})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(sc))
+}
+
 func TestCoin_InvokeOverflow(t *testing.T) {
 	uint64max := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
 	ct := newCT()
+	minter := ct.storeGenesis(t)
 	coAddr := omniledger.NewInstanceID(nil)
 	ct.Store(coAddr, uint64max, ContractCoinID)
 
@@ -71,6 +121,7 @@ func TestCoin_InvokeOverflow(t *testing.T) {
 			Command: "mint",
 			Args:    omniledger.Arguments{{Name: "coins", Value: coinOne}},
 		},
+		Signatures: []darc.Signature{{Signer: minter}},
 	}
 	sc, co, err := ContractCoin(ct, inst, []omniledger.Coin{})
 	require.Error(t, err)
@@ -167,6 +218,26 @@ func TestCoin_InvokeTransfer(t *testing.T) {
 	require.Equal(t, 2, len(sc))
 	require.Equal(t, omniledger.NewStateChange(omniledger.Update, coAddr2, ContractCoinID, coinOne), sc[0])
 	require.Equal(t, omniledger.NewStateChange(omniledger.Update, coAddr1, ContractCoinID, coinZero), sc[1])
+
+	// Transferring to the same account must fail.
+	inst.Invoke.Args[1].Value = coAddr1.Slice()
+	_, _, err = ContractCoin(ct, inst, []omniledger.Coin{})
+	require.Error(t, err)
+}
+
+func TestCoin_Balance(t *testing.T) {
+	ct := newCT()
+	coAddr := omniledger.NewInstanceID(nil)
+	ct.Store(coAddr, coinTwo, ContractCoinID)
+	valAddr := omniledger.InstanceID{DarcID: make([]byte, 32), SubID: omniledger.SubID{}}
+	valAddr.DarcID[31] = byte(1)
+	ct.Store(valAddr, coinTwo, ContractValueID)
+
+	balance, err := CoinBalance(ct, coAddr, nil)
+	require.Nil(t, err)
+	require.Equal(t, coinTwo, balance)
+	_, err = CoinBalance(ct, valAddr, nil)
+	require.Error(t, err)
 }
 
 type cvTest struct {
@@ -178,6 +249,21 @@ func newCT() *cvTest {
 	return &cvTest{make(map[string][]byte), make(map[string]string)}
 }
 
+// storeGenesis stores a genesis darc with a MintRule for a new identity,
+// which is returned.
+func (ct *cvTest) storeGenesis(t *testing.T) darc.Identity {
+	minter := darc.NewSignerEd25519(nil, nil).Identity()
+	owner := darc.NewSignerEd25519(nil, nil).Identity()
+	rules := darc.InitRules([]darc.Identity{owner}, []darc.Identity{owner})
+	require.Nil(t, rules.AddRule(MintRule, expression.InitOrExpr(minter.String())))
+	d := darc.NewDarc(rules, []byte("genesis"))
+	darcBuf, err := d.ToProto()
+	require.Nil(t, err)
+	ct.Store(omniledger.GenesisReferenceID, d.GetBaseID(), omniledger.ContractConfigID)
+	ct.Store(omniledger.InstanceID{DarcID: d.GetBaseID()}, darcBuf, omniledger.ContractDarcID)
+	return minter
+}
+
 func (ct cvTest) Get(key []byte) collection.Getter {
 	panic("not implemented")
 }
@@ -0,0 +1,133 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// The escrow contract locks coins of a payer until they are either released
+// to a payee, or refunded to the payer after a timeout. It is built on the
+// StateMachine of the service and moves the coins by calling the coin
+// contract, so it also serves as an example of both. The darcs of the
+// accounts must let the ContractIdentity of the escrow contract fetch and
+// store their coins.
+
+// ContractEscrowID denotes an escrow contract.
+var ContractEscrowID = "escrow"
+
+// EscrowData is the data of an escrow instance.
+type EscrowData struct {
+	// Payer is the coin account the coins are taken from.
+	Payer omniledger.InstanceID
+	// Payee is the coin account the coins are released to.
+	Payee omniledger.InstanceID
+	// Coins is the number of locked coins.
+	Coins uint64
+	// Timeout in nanoseconds after which the coins can be refunded.
+	Timeout int64
+}
+
+// ContractEscrow accepts the following instructions:
+//   - Spawn - sent to the darc of the account in the argument "payer", locks
+//     the number of coins in the argument "coins" for the account in the
+//     argument "payee". The argument "timeout" holds the time in nanoseconds
+//     after which the coins can be refunded. "coins" and "timeout" are 64-bit
+//     uints in LittleEndian
+//   - Invoke.release - sends the coins to the payee. The darc of the escrow
+//     decides with its "invoke:release" rule who can release them
+//   - Invoke.timeout - sends the coins back to the payer once the timeout
+//     passed in chain time
+//   - Delete - removes the escrow once the coins have been released or
+//     refunded
+var ContractEscrow = omniledger.StateMachine{
+	ContractID: ContractEscrowID,
+	Initial:    "locked",
+	SpawnFn:    escrowLock,
+	Transitions: []omniledger.Transition{{
+		Command: "release",
+		From:    "locked",
+		To:      "released",
+		Apply:   escrowPay(func(ed *EscrowData) omniledger.InstanceID { return ed.Payee }),
+	}},
+	Timeouts: []omniledger.Timeout{{
+		State:   "locked",
+		AfterFn: escrowTimeout,
+		To:      "refunded",
+		Apply:   escrowPay(func(ed *EscrowData) omniledger.InstanceID { return ed.Payer }),
+	}},
+	Final: []string{"released", "refunded"},
+}
+
+// escrowLock takes the coins out of the account of the payer.
+func escrowLock(cdb omniledger.CollectionView, inst omniledger.Instruction, data []byte, c []omniledger.Coin) ([]byte, []omniledger.StateChange, []omniledger.Coin, error) {
+	args := inst.Spawn.Args
+	payer, payee := args.Search("payer"), args.Search("payee")
+	coinsBuf, timeoutBuf := args.Search("coins"), args.Search("timeout")
+	if len(payer) != 64 || len(payee) != 64 || len(coinsBuf) != 8 || len(timeoutBuf) != 8 {
+		return nil, nil, nil, errors.New("need the arguments payer, payee, coins and timeout")
+	}
+	ed := EscrowData{
+		Payer:   omniledger.NewInstanceID(payer),
+		Payee:   omniledger.NewInstanceID(payee),
+		Coins:   binary.LittleEndian.Uint64(coinsBuf),
+		Timeout: int64(binary.LittleEndian.Uint64(timeoutBuf)),
+	}
+	if !ed.Payer.DarcID.Equal(inst.InstanceID.DarcID) {
+		return nil, nil, nil, errors.New("the escrow must be spawned by the darc of the payer")
+	}
+	for _, id := range []omniledger.InstanceID{ed.Payer, ed.Payee} {
+		if _, cid, err := cdb.GetValues(id.Slice()); err != nil || cid != ContractCoinID {
+			return nil, nil, nil, errors.New("payer and payee must be coin accounts")
+		}
+	}
+	coinsArg := make([]byte, 8)
+	binary.LittleEndian.PutUint64(coinsArg, ed.Coins)
+	scs, _, err := omniledger.CallContract(cdb, omniledger.Instruction{
+		InstanceID: ed.Payer,
+		Invoke: &omniledger.Invoke{
+			Command: "fetch",
+			Args:    omniledger.Arguments{{Name: "coins", Value: coinsArg}},
+		},
+	}, nil)
+	if err != nil {
+		return nil, nil, nil, errors.New("couldn't lock coins: " + err.Error())
+	}
+	log.Lvlf3("Locking %d coins of %x", ed.Coins, payer)
+	buf, err := protobuf.Encode(&ed)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return buf, scs, c, nil
+}
+
+// escrowPay returns a TransitionFn that stores the locked coins in the
+// account returned by to.
+func escrowPay(to func(*EscrowData) omniledger.InstanceID) omniledger.TransitionFn {
+	return func(cdb omniledger.CollectionView, inst omniledger.Instruction, data []byte, c []omniledger.Coin) ([]byte, []omniledger.StateChange, []omniledger.Coin, error) {
+		var ed EscrowData
+		if err := protobuf.Decode(data, &ed); err != nil {
+			return nil, nil, nil, err
+		}
+		scs, _, err := omniledger.CallContract(cdb, omniledger.Instruction{
+			InstanceID: to(&ed),
+			Invoke:     &omniledger.Invoke{Command: "store"},
+		}, []omniledger.Coin{{Name: CoinName, Value: ed.Coins}})
+		if err != nil {
+			return nil, nil, nil, errors.New("couldn't pay coins: " + err.Error())
+		}
+		return data, scs, c, nil
+	}
+}
+
+func escrowTimeout(data []byte) (time.Duration, error) {
+	var ed EscrowData
+	if err := protobuf.Decode(data, &ed); err != nil {
+		return 0, err
+	}
+	return time.Duration(ed.Timeout), nil
+}
@@ -0,0 +1,124 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscrow(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(2, true)
+
+	genesisMsg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:coin", "invoke:mint", "spawn:escrow", "invoke:release",
+			"invoke:timeout"}, signer.Identity())
+	require.Nil(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+	require.Nil(t, gDarc.Rules.AddRule(MintRule, expression.InitOrExpr(signer.Identity().String())))
+	// The escrow contract moves the coins of the accounts.
+	escrow := expression.Expr(service.ContractIdentity(ContractEscrowID))
+	require.Nil(t, gDarc.Rules.AddRule("invoke:fetch", escrow))
+	require.Nil(t, gDarc.Rules.AddRule("invoke:store", escrow))
+	genesisMsg.BlockInterval = time.Second
+
+	cl := service.NewClient()
+	_, err = cl.CreateGenesisBlock(genesisMsg)
+	require.Nil(t, err)
+
+	// send signs instr and waits for it to be included.
+	send := func(instr *service.Instruction) error {
+		instr.Nonce = service.GenNonce()
+		instr.Length = 1
+		require.Nil(t, instr.SignBy(signer))
+		_, err := cl.AddTransactionAndWait(service.ClientTransaction{
+			Instructions: []service.Instruction{*instr},
+		}, 10)
+		return err
+	}
+	uint64Arg := func(v uint64) []byte {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, v)
+		return buf
+	}
+	balance := func(id service.InstanceID) uint64 {
+		r, err := cl.CallView(id, "balance", nil)
+		require.Nil(t, err)
+		return binary.LittleEndian.Uint64(r.Result)
+	}
+	newAccount := func() service.InstanceID {
+		instr := &service.Instruction{
+			InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+			Spawn:      &service.Spawn{ContractID: ContractCoinID},
+		}
+		require.Nil(t, send(instr))
+		return service.InstanceID{DarcID: gDarc.GetBaseID(), SubID: service.NewSubID(instr.Hash())}
+	}
+	lock := func(payer, payee service.InstanceID, coins uint64, timeout time.Duration) (service.InstanceID, error) {
+		instr := &service.Instruction{
+			InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+			Spawn: &service.Spawn{
+				ContractID: ContractEscrowID,
+				Args: service.Arguments{
+					{Name: "payer", Value: payer.Slice()},
+					{Name: "payee", Value: payee.Slice()},
+					{Name: "coins", Value: uint64Arg(coins)},
+					{Name: "timeout", Value: uint64Arg(uint64(timeout))},
+				},
+			},
+		}
+		err := send(instr)
+		return instr.DeriveID(ContractEscrowID), err
+	}
+	invoke := func(id service.InstanceID, cmd string) error {
+		return send(&service.Instruction{
+			InstanceID: id,
+			Invoke:     &service.Invoke{Command: cmd},
+		})
+	}
+
+	payer, payee := newAccount(), newAccount()
+	require.Nil(t, send(&service.Instruction{
+		InstanceID: payer,
+		Invoke: &service.Invoke{
+			Command: "mint",
+			Args:    service.Arguments{{Name: "coins", Value: uint64Arg(100)}},
+		},
+	}))
+
+	// Released coins go to the payee, and can't be refunded anymore.
+	escrow, err := lock(payer, payee, 30, time.Hour)
+	require.Nil(t, err)
+	require.Equal(t, uint64(70), balance(payer))
+	require.NotNil(t, invoke(escrow, "timeout"))
+	require.Nil(t, invoke(escrow, "release"))
+	require.Equal(t, uint64(30), balance(payee))
+	require.NotNil(t, invoke(escrow, "release"))
+
+	// Once the timeout passed in chain time, the coins can only be
+	// refunded.
+	escrow, err = lock(payer, payee, 20, time.Nanosecond)
+	require.Nil(t, err)
+	require.Equal(t, uint64(50), balance(payer))
+	require.NotNil(t, invoke(escrow, "release"))
+	require.Nil(t, invoke(escrow, "timeout"))
+	require.Equal(t, uint64(70), balance(payer))
+	require.Equal(t, uint64(30), balance(payee))
+
+	// The payer must have the coins.
+	_, err = lock(payer, payee, 1000, time.Hour)
+	require.NotNil(t, err)
+	require.Equal(t, uint64(70), balance(payer))
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
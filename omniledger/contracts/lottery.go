@@ -0,0 +1,204 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// The lottery contract distributes a number of prizes among the identities
+// that registered before a given block. The winners are drawn with the
+// randomness of the lottery instance, which the roster only reveals once the
+// registration is closed, so neither the participants nor the leader can
+// know or choose the winners while they can still register. It is also the
+// template for other contracts that need randomness.
+
+// ContractLotteryID denotes a lottery contract.
+var ContractLotteryID = "lottery"
+
+// LotteryData is the data of a lottery instance.
+type LotteryData struct {
+	// Prizes is the number of winners.
+	Prizes uint64
+	// Close is the index of the last block that takes registrations.
+	Close uint64
+	// Participants are the registered identities.
+	Participants []darc.Identity
+	// Winners are the drawn participants, in the order of the draw.
+	Winners []darc.Identity
+	// Randomness the winners have been drawn with.
+	Randomness []byte
+}
+
+// LotteryID returns the instance ID of the lottery of the darc with the
+// given ID. There is one lottery per darc.
+func LotteryID(darcID darc.ID) omniledger.InstanceID {
+	h := sha256.Sum256([]byte(ContractLotteryID))
+	return omniledger.InstanceID{
+		DarcID: darcID,
+		SubID:  omniledger.NewSubID(h[:]),
+	}
+}
+
+// ContractLottery accepts the following instructions:
+//   - Spawn - sent to the darc of the lottery. The first spawn creates the
+//     lottery with the number of winners in the argument "prizes" and the
+//     index of the last block that takes registrations in the argument
+//     "close", both 64-bit uints in LittleEndian. Every other spawn
+//     registers the identity that signed it, once
+//   - Invoke.draw - draws the winners once the registration is closed. The
+//     argument "randomness" holds the shares of the randomness of the
+//     lottery, as returned by Client.GetRandomness and encoded with
+//     protobuf
+//
+// The darc decides with its "spawn:lottery" rule who can create the lottery
+// and register, and with its "invoke:draw" rule who can draw. Drawing can't
+// change the winners, so anybody can be allowed to do it.
+func ContractLottery(cdb omniledger.CollectionView, inst omniledger.Instruction, c []omniledger.Coin) ([]omniledger.StateChange, []omniledger.Coin, error) {
+	switch inst.GetType() {
+	case omniledger.SpawnType:
+		id := LotteryID(inst.InstanceID.DarcID)
+		if _, _, err := cdb.GetValues(id.Slice()); err != nil {
+			return lotteryCreate(id, inst, c)
+		}
+		ld, err := loadLottery(cdb, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		ct, err := omniledger.LoadChainTime(cdb)
+		if err != nil {
+			return nil, nil, errors.New("the lottery needs the chain time: " + err.Error())
+		}
+		if uint64(ct.BlockIndex) >= ld.Close {
+			return nil, nil, errors.New("the registration is closed")
+		}
+		signer := inst.Signatures[0].Signer
+		for _, p := range ld.Participants {
+			if p.Equal(&signer) {
+				return nil, nil, errors.New("already registered")
+			}
+		}
+		ld.Participants = append(ld.Participants, signer)
+		return lotteryStore(omniledger.Update, id, ld, c)
+	case omniledger.InvokeType:
+		if inst.Invoke.Command != "draw" {
+			return nil, nil, errors.New("unknown command: " + inst.Invoke.Command)
+		}
+		ld, err := loadLottery(cdb, inst.InstanceID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := lotteryClosed(cdb, ld); err != nil {
+			return nil, nil, err
+		}
+		if ld.Randomness != nil {
+			return nil, nil, errors.New("the winners have already been drawn")
+		}
+		var shares omniledger.TxDecryption
+		err = protobuf.DecodeWithConstructors(inst.Invoke.Args.Search("randomness"), &shares,
+			network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return nil, nil, errors.New("couldn't decode randomness: " + err.Error())
+		}
+		ld.Randomness, err = omniledger.Randomness(cdb, inst.InstanceID, shares)
+		if err != nil {
+			return nil, nil, err
+		}
+		ld.Winners = drawWinners(ld.Participants, ld.Prizes, ld.Randomness)
+		log.Lvlf3("Drew %d winners out of %d participants", len(ld.Winners), len(ld.Participants))
+		return lotteryStore(omniledger.Update, inst.InstanceID, ld, c)
+	}
+	return nil, nil, errors.New("didn't find any instruction")
+}
+
+// LotteryRandomness lets the roster reveal the randomness of a lottery once
+// its registration is closed.
+func LotteryRandomness(cdb omniledger.CollectionView, id omniledger.InstanceID) error {
+	ld, err := loadLottery(cdb, id)
+	if err != nil {
+		return err
+	}
+	return lotteryClosed(cdb, ld)
+}
+
+// lotteryCreate creates the lottery id with the arguments of the spawn.
+func lotteryCreate(id omniledger.InstanceID, inst omniledger.Instruction, c []omniledger.Coin) ([]omniledger.StateChange, []omniledger.Coin, error) {
+	prizes, closeBuf := inst.Spawn.Args.Search("prizes"), inst.Spawn.Args.Search("close")
+	if len(prizes) != 8 || len(closeBuf) != 8 {
+		return nil, nil, errors.New("need the arguments prizes and close")
+	}
+	ld := &LotteryData{
+		Prizes: binary.LittleEndian.Uint64(prizes),
+		Close:  binary.LittleEndian.Uint64(closeBuf),
+	}
+	if ld.Prizes == 0 {
+		return nil, nil, errors.New("a lottery needs prizes")
+	}
+	return lotteryStore(omniledger.Create, id, ld, c)
+}
+
+// lotteryClosed returns an error as long as the lottery takes
+// registrations. The chain time holds the index of the latest block, so the
+// block after Close is the first one that can't change the participants.
+func lotteryClosed(cdb omniledger.CollectionView, ld *LotteryData) error {
+	ct, err := omniledger.LoadChainTime(cdb)
+	if err != nil {
+		return errors.New("the lottery needs the chain time: " + err.Error())
+	}
+	if uint64(ct.BlockIndex) < ld.Close {
+		return errors.New("the registration is still open")
+	}
+	return nil
+}
+
+// drawWinners returns min(prizes, len(participants)) distinct participants,
+// shuffled with the randomness.
+func drawWinners(participants []darc.Identity, prizes uint64, randomness []byte) []darc.Identity {
+	ps := append([]darc.Identity{}, participants...)
+	if prizes > uint64(len(ps)) {
+		prizes = uint64(len(ps))
+	}
+	for i := uint64(0); i < prizes; i++ {
+		h := sha256.New()
+		h.Write(randomness)
+		binary.Write(h, binary.LittleEndian, i)
+		j := i + binary.LittleEndian.Uint64(h.Sum(nil))%(uint64(len(ps))-i)
+		ps[i], ps[j] = ps[j], ps[i]
+	}
+	return ps[:prizes]
+}
+
+// loadLottery returns the lottery stored in the instance id.
+func loadLottery(cdb omniledger.CollectionView, id omniledger.InstanceID) (*LotteryData, error) {
+	buf, contract, err := cdb.GetValues(id.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if contract != ContractLotteryID {
+		return nil, errors.New("not a lottery instance")
+	}
+	var ld LotteryData
+	err = protobuf.DecodeWithConstructors(buf, &ld, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, errors.New("couldn't decode lottery: " + err.Error())
+	}
+	return &ld, nil
+}
+
+// lotteryStore returns the state change that stores ld in the instance id.
+func lotteryStore(action omniledger.StateAction, id omniledger.InstanceID, ld *LotteryData, c []omniledger.Coin) ([]omniledger.StateChange, []omniledger.Coin, error) {
+	buf, err := protobuf.Encode(ld)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []omniledger.StateChange{
+		omniledger.NewStateChange(action, id, ContractLotteryID, buf),
+	}, c, nil
+}
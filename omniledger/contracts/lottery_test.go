@@ -0,0 +1,174 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLottery(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	alice, bob := darc.NewSignerEd25519(nil, nil), darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"invoke:update_config", "invoke:draw", "spawn:value"}, signer.Identity())
+	require.Nil(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+	require.Nil(t, gDarc.Rules.AddRule("spawn:lottery", expression.InitOrExpr(signer.Identity().String(),
+		alice.Identity().String(), bob.Identity().String())))
+	genesisMsg.BlockInterval = time.Second
+
+	cl := service.NewClient()
+	_, err = cl.CreateGenesisBlock(genesisMsg)
+	require.Nil(t, err)
+
+	// send signs the instructions and waits for them to be included.
+	send := func(instrs []service.Instruction, signers ...darc.Signer) error {
+		for i := range instrs {
+			instrs[i].Nonce = service.GenNonce()
+			instrs[i].Index = i
+			instrs[i].Length = len(instrs)
+			require.Nil(t, instrs[i].SignBy(signers[i]))
+		}
+		_, err := cl.AddTransactionAndWait(service.ClientTransaction{Instructions: instrs}, 10)
+		return err
+	}
+	spawn := func(args service.Arguments) service.Instruction {
+		return service.Instruction{
+			InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+			Spawn:      &service.Spawn{ContractID: ContractLotteryID, Args: args},
+		}
+	}
+	// tick creates a block, as the chain only grows with transactions.
+	tick := func() {
+		require.Nil(t, send([]service.Instruction{{
+			InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+			Spawn: &service.Spawn{
+				ContractID: ContractValueID,
+				Args:       service.Arguments{{Name: "value", Value: []byte("tick")}},
+			},
+		}}, signer))
+	}
+	uint64Arg := func(v uint64) []byte {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, v)
+		return buf
+	}
+	getLottery := func(id service.InstanceID) *LotteryData {
+		p, err := cl.GetProof(id.Slice())
+		require.Nil(t, err)
+		require.True(t, p.Proof.InclusionProof.Match())
+		_, vs, err := p.Proof.KeyValue()
+		require.Nil(t, err)
+		ld := &LotteryData{}
+		require.Nil(t, protobuf.DecodeWithConstructors(vs[0], ld, network.DefaultConstructors(cothority.Suite)))
+		return ld
+	}
+
+	// The lottery needs the chain time and the key of the roster.
+	key, err := cl.CreateTxKey()
+	require.Nil(t, err)
+	config, err := cl.GetChainConfig()
+	require.Nil(t, err)
+	config.TxKey = &key.Key
+	config.MinServiceVersion = service.ServiceVersion
+	configBuf, err := protobuf.Encode(config)
+	require.Nil(t, err)
+	var one service.SubID
+	one[31] = 1
+	require.Nil(t, send([]service.Instruction{{
+		InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID(), SubID: one},
+		Invoke: &service.Invoke{
+			Command: "update_config",
+			Args:    service.Arguments{{Name: "config", Value: configBuf}},
+		},
+	}}, signer))
+	var ct service.ChainTimeValue
+	for i := 0; i < 10; i++ {
+		p, err := cl.GetProof(service.ChainTimeID.Slice())
+		require.Nil(t, err)
+		if p.Proof.InclusionProof.Match() {
+			_, vs, err := p.Proof.KeyValue()
+			require.Nil(t, err)
+			require.Nil(t, protobuf.Decode(vs[0], &ct))
+			break
+		}
+		time.Sleep(genesisMsg.BlockInterval)
+	}
+	require.NotEqual(t, 0, ct.BlockIndex)
+
+	id := LotteryID(gDarc.GetBaseID())
+	require.NotNil(t, send([]service.Instruction{spawn(nil)}, signer))
+	require.Nil(t, send([]service.Instruction{spawn(service.Arguments{
+		{Name: "prizes", Value: uint64Arg(2)},
+		{Name: "close", Value: uint64Arg(uint64(ct.BlockIndex) + 3)},
+	})}, signer))
+	require.Nil(t, send([]service.Instruction{spawn(nil), spawn(nil), spawn(nil)},
+		signer, alice, bob))
+	require.NotNil(t, send([]service.Instruction{spawn(nil)}, alice))
+	require.Equal(t, 3, len(getLottery(id).Participants))
+
+	// The roster only reveals the randomness once the registration is
+	// closed.
+	var resp *service.GetRandomnessResponse
+	for i := 0; i < 10; i++ {
+		if resp, err = cl.GetRandomness(id); err == nil {
+			break
+		}
+		tick()
+	}
+	require.Nil(t, err)
+	require.NotNil(t, send([]service.Instruction{spawn(nil)}, signer))
+
+	draw := func(shares service.TxDecryption) error {
+		buf, err := protobuf.Encode(&shares)
+		require.Nil(t, err)
+		return send([]service.Instruction{{
+			InstanceID: id,
+			Invoke: &service.Invoke{
+				Command: "draw",
+				Args:    service.Arguments{{Name: "randomness", Value: buf}},
+			},
+		}}, signer)
+	}
+	wrong := resp.Shares
+	wrong.Shares = append([]service.DecryptionShare{}, resp.Shares.Shares...)
+	wrong.Shares[0].Ui = wrong.Shares[1].Ui
+	require.NotNil(t, draw(wrong))
+	require.Nil(t, draw(resp.Shares))
+	ld := getLottery(id)
+	require.Equal(t, 2, len(ld.Winners))
+	require.False(t, ld.Winners[0].Equal(&ld.Winners[1]))
+	require.Equal(t, drawWinners(ld.Participants, ld.Prizes, ld.Randomness), ld.Winners)
+	require.NotNil(t, draw(resp.Shares))
+}
+
+func TestLottery_DrawWinners(t *testing.T) {
+	var ps []darc.Identity
+	for i := 0; i < 5; i++ {
+		ps = append(ps, darc.NewSignerEd25519(nil, nil).Identity())
+	}
+	winners := drawWinners(ps, 3, []byte("randomness"))
+	require.Equal(t, 3, len(winners))
+	require.Equal(t, winners, drawWinners(ps, 3, []byte("randomness")))
+	for i, w := range winners {
+		for _, w2 := range winners[i+1:] {
+			require.False(t, w.Equal(&w2))
+		}
+	}
+	require.Equal(t, 5, len(drawWinners(ps, 10, []byte("randomness"))))
+	require.Equal(t, 0, len(drawWinners(nil, 3, []byte("randomness"))))
+}
@@ -0,0 +1,237 @@
+package contracts
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// otsMagic starts every detached OpenTimestamps proof.
+var otsMagic = []byte("\x00OpenTimestamps\x00\x00Proof\x00\xbf\x89\xe2\xe8\x84\xe8\x92\x94")
+
+// otsBitcoinTag is the tag of the Bitcoin block attestations.
+var otsBitcoinTag = []byte{0x05, 0x88, 0x96, 0x0d, 0x73, 0xd7, 0x19, 0x01}
+
+// The limits of the reference implementation.
+const (
+	otsMaxMsgLength = 4096
+	otsMaxDepth     = 256
+)
+
+// BitcoinAttestation is the commitment of an OpenTimestamps proof to a
+// Bitcoin block.
+type BitcoinAttestation struct {
+	// Height of the block.
+	Height uint64
+	// MerkleRoot the document is committed to, in the byte order of the
+	// block header.
+	MerkleRoot []byte
+}
+
+// VerifyOpenTimestamps checks that proof is a detached OpenTimestamps proof
+// for the sha256 hash that ends in at least one Bitcoin block attestation,
+// and returns the attestation of the lowest block. Pending attestations are
+// ignored, the proof must be upgraded before it is verified.
+//
+// The operations of the proof are executed, but the merkle root of the
+// attestation is not compared to the Bitcoin chain, which needs a Bitcoin
+// node.
+func VerifyOpenTimestamps(proof, hash []byte) (*BitcoinAttestation, error) {
+	r := &otsReader{buf: proof}
+	magic, err := r.bytes(len(otsMagic))
+	if err != nil || !bytes.Equal(magic, otsMagic) {
+		return nil, errors.New("not an OpenTimestamps proof")
+	}
+	if v, err := r.varuint(); err != nil || v != 1 {
+		return nil, errors.New("unknown version of the OpenTimestamps proof")
+	}
+	op, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if op != 0x08 {
+		return nil, errors.New("the proof is not for a sha256 hash")
+	}
+	digest, err := r.bytes(sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(digest, hash) {
+		return nil, errors.New("the proof is for another hash")
+	}
+	var atts []BitcoinAttestation
+	if err = r.timestamp(digest, 0, &atts); err != nil {
+		return nil, err
+	}
+	if len(r.buf) > 0 {
+		return nil, errors.New("garbage at the end of the proof")
+	}
+	if len(atts) == 0 {
+		return nil, errors.New("the proof has no Bitcoin attestation")
+	}
+	lowest := atts[0]
+	for _, a := range atts[1:] {
+		if a.Height < lowest.Height {
+			lowest = a
+		}
+	}
+	return &lowest, nil
+}
+
+// otsReader reads the serialization of OpenTimestamps.
+type otsReader struct {
+	buf []byte
+}
+
+func (r *otsReader) byte() (byte, error) {
+	b, err := r.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *otsReader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.buf) {
+		return nil, errors.New("truncated OpenTimestamps proof")
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+func (r *otsReader) varuint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("varuint too long")
+}
+
+func (r *otsReader) varbytes() ([]byte, error) {
+	n, err := r.varuint()
+	if err != nil {
+		return nil, err
+	}
+	if n > otsMaxMsgLength {
+		return nil, errors.New("varbytes too long")
+	}
+	return r.bytes(int(n))
+}
+
+// timestamp reads a timestamp of msg: a list of operations and
+// attestations, where all but the last are prefixed with 0xff. Every
+// operation is followed by the timestamp of its result.
+func (r *otsReader) timestamp(msg []byte, depth int, atts *[]BitcoinAttestation) error {
+	if depth > otsMaxDepth {
+		return errors.New("OpenTimestamps proof too deep")
+	}
+	for {
+		tag, err := r.byte()
+		if err != nil {
+			return err
+		}
+		last := tag != 0xff
+		if !last {
+			if tag, err = r.byte(); err != nil {
+				return err
+			}
+		}
+		if tag == 0x00 {
+			err = r.attestation(msg, atts)
+		} else {
+			var result []byte
+			if result, err = r.operation(tag, msg); err == nil {
+				err = r.timestamp(result, depth+1, atts)
+			}
+		}
+		if err != nil || last {
+			return err
+		}
+	}
+}
+
+// attestation reads an attestation of msg and adds it to atts if it is a
+// Bitcoin attestation.
+func (r *otsReader) attestation(msg []byte, atts *[]BitcoinAttestation) error {
+	tag, err := r.bytes(8)
+	if err != nil {
+		return err
+	}
+	payload, err := r.varbytes()
+	if err != nil {
+		return err
+	}
+	// Pending and unknown attestations are skipped, like in the reference
+	// implementation.
+	if !bytes.Equal(tag, otsBitcoinTag) {
+		return nil
+	}
+	height, err := (&otsReader{buf: payload}).varuint()
+	if err != nil {
+		return err
+	}
+	if len(msg) != sha256.Size {
+		return errors.New("the Bitcoin attestation is not for a merkle root")
+	}
+	*atts = append(*atts, BitcoinAttestation{
+		Height:     height,
+		MerkleRoot: append([]byte{}, msg...),
+	})
+	return nil
+}
+
+// operation reads the operation with the tag and applies it to msg.
+func (r *otsReader) operation(tag byte, msg []byte) ([]byte, error) {
+	var result []byte
+	switch tag {
+	case 0x02:
+		h := sha1.Sum(msg)
+		result = h[:]
+	case 0x03:
+		h := ripemd160.New()
+		h.Write(msg)
+		result = h.Sum(nil)
+	case 0x08:
+		h := sha256.Sum256(msg)
+		result = h[:]
+	case 0xf0, 0xf1:
+		arg, err := r.varbytes()
+		if err != nil {
+			return nil, err
+		}
+		if len(arg) == 0 {
+			return nil, errors.New("empty argument of append or prepend")
+		}
+		if tag == 0xf0 {
+			result = append(append([]byte{}, msg...), arg...)
+		} else {
+			result = append(append([]byte{}, arg...), msg...)
+		}
+	case 0xf2:
+		result = make([]byte, len(msg))
+		for i, b := range msg {
+			result[len(msg)-1-i] = b
+		}
+	case 0xf3:
+		result = []byte(hex.EncodeToString(msg))
+	default:
+		return nil, fmt.Errorf("unsupported OpenTimestamps operation %#x", tag)
+	}
+	if len(result) > otsMaxMsgLength {
+		return nil, errors.New("OpenTimestamps message too long")
+	}
+	return result, nil
+}
@@ -0,0 +1,205 @@
+package contracts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	pop "github.com/dedis/cothority/pop/service"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/anon"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// The pop contracts bring proof-of-personhood parties to omniledger. The
+// final statement of a party is stored in a popParty instance, and every
+// attendee can get one anonymous pop-token from it. A darc can then refer to
+// all token holders of a party with the identity "pop:" followed by the hex
+// encoding of the hash of the final statement, which gives one vote, account
+// or coin per person.
+
+// ContractPopPartyID denotes a contract that stores the final statement of a
+// pop-party and issues the pop-tokens.
+var ContractPopPartyID = "popParty"
+
+// ContractPopTokenID denotes the records of the issued pop-tokens. There is
+// no contract with this name, so only the popParty contract creates them.
+var ContractPopTokenID = "popToken"
+
+// ContractPopTagID denotes the records of the linkage tags of the attendees
+// that already got their pop-token.
+var ContractPopTagID = "popTag"
+
+// PopPartyID returns the instance ID of the party with the given final
+// statement hash, stored under the darc with the given ID.
+func PopPartyID(darcID darc.ID, party []byte) omniledger.InstanceID {
+	return omniledger.InstanceID{
+		DarcID: darcID,
+		SubID:  omniledger.NewSubID(party),
+	}
+}
+
+// PopTokenID returns the key of the record of the pop-token with the given
+// public key, issued for the party with the given final statement hash.
+func PopTokenID(party []byte, public kyber.Point) omniledger.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractPopTokenID))
+	public.MarshalTo(h)
+	return omniledger.InstanceID{
+		DarcID: party,
+		SubID:  omniledger.NewSubID(h.Sum(nil)),
+	}
+}
+
+// popTagID returns the key of the record of the linkage tag of an attendee of
+// the party with the given final statement hash.
+func popTagID(party, tag []byte) omniledger.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractPopTagID))
+	h.Write(tag)
+	return omniledger.InstanceID{
+		DarcID: party,
+		SubID:  omniledger.NewSubID(h.Sum(nil)),
+	}
+}
+
+// PopTokenSignature returns the anonymous signature that the attendee with
+// the given index and private key in the final statement needs to get a
+// pop-token with the given public key. The index is the position of the
+// public key of the attendee in final.Attendees.
+func PopTokenSignature(final *pop.FinalStatement, index int, private kyber.Scalar, token kyber.Point) ([]byte, error) {
+	party, err := final.Hash()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := token.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return anon.Sign(cothority.Suite.(anon.Suite), msg, anon.Set(final.Attendees),
+		party, index, private), nil
+}
+
+// ContractPopParty accepts the following instructions:
+//   - Spawn - stores the final statement in the argument "final", encoded
+//     with protobuf, if its collective signature is valid. The instance ID is
+//     given by PopPartyID
+//   - Invoke.token - issues a pop-token with the public key in the argument
+//     "public" to an attendee. The argument "signature" must be an anonymous
+//     signature of the attendee as returned by PopTokenSignature. As the
+//     attendee is anonymous, the instruction is signed by the new token, so
+//     the "invoke:token" rule of the darc is usually the pop identity of the
+//     party
+//
+// Every attendee can only get one token per party, the tokens can't be
+// revoked.
+func ContractPopParty(cdb omniledger.CollectionView, inst omniledger.Instruction, c []omniledger.Coin) ([]omniledger.StateChange, []omniledger.Coin, error) {
+	switch inst.GetType() {
+	case omniledger.SpawnType:
+		finalBuf := inst.Spawn.Args.Search("final")
+		final, err := decodeFinal(finalBuf)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = final.Verify(); err != nil {
+			return nil, nil, errors.New("invalid final statement: " + err.Error())
+		}
+		party, err := final.Hash()
+		if err != nil {
+			return nil, nil, err
+		}
+		id := PopPartyID(inst.InstanceID.DarcID, party)
+		if _, _, err = cdb.GetValues(id.Slice()); err == nil {
+			return nil, nil, errors.New("the party has already been stored")
+		}
+		log.Lvlf3("Storing party %x with %d attendees", party, len(final.Attendees))
+		return []omniledger.StateChange{
+			omniledger.NewStateChange(omniledger.Create, id, ContractPopPartyID, finalBuf),
+		}, c, nil
+	case omniledger.InvokeType:
+		if inst.Invoke.Command != "token" {
+			return nil, nil, errors.New("unknown command: " + inst.Invoke.Command)
+		}
+		finalBuf, _, err := cdb.GetValues(inst.InstanceID.Slice())
+		if err != nil {
+			return nil, nil, err
+		}
+		final, err := decodeFinal(finalBuf)
+		if err != nil {
+			return nil, nil, err
+		}
+		party, err := final.Hash()
+		if err != nil {
+			return nil, nil, err
+		}
+		public := cothority.Suite.Point()
+		if err = public.UnmarshalBinary(inst.Invoke.Args.Search("public")); err != nil {
+			return nil, nil, errors.New("invalid public key: " + err.Error())
+		}
+		tag, err := anon.Verify(cothority.Suite.(anon.Suite), inst.Invoke.Args.Search("public"),
+			anon.Set(final.Attendees), party, inst.Invoke.Args.Search("signature"))
+		if err != nil {
+			return nil, nil, errors.New("invalid attendee signature: " + err.Error())
+		}
+		tagID := popTagID(party, tag)
+		if _, _, err = cdb.GetValues(tagID.Slice()); err == nil {
+			return nil, nil, errors.New("the attendee already has a token")
+		}
+		tokenID := PopTokenID(party, public)
+		if _, _, err = cdb.GetValues(tokenID.Slice()); err == nil {
+			return nil, nil, errors.New("the token has already been issued")
+		}
+		log.Lvlf3("Issuing token %s of party %x", public, party)
+		return []omniledger.StateChange{
+			omniledger.NewStateChange(omniledger.Create, tagID, ContractPopTagID, tokenID.Slice()),
+			omniledger.NewStateChange(omniledger.Create, tokenID, ContractPopTokenID, party),
+		}, c, nil
+	}
+	return nil, nil, errors.New("only spawn and invoke are allowed")
+}
+
+// VerifyPopIdentity checks that the pop-token of id has been issued for its
+// party. The only token that can sign before being issued is the one that the
+// instruction instr issues.
+func VerifyPopIdentity(coll omniledger.CollectionView, instr omniledger.Instruction, id darc.Identity) error {
+	if id.PoP == nil {
+		return errors.New("not a pop identity")
+	}
+	party, contractID, err := coll.GetValues(PopTokenID(id.PoP.Party, id.PoP.Public).Slice())
+	if err == nil && contractID == ContractPopTokenID && bytes.Equal(party, id.PoP.Party) {
+		return nil
+	}
+	if instr.Invoke == nil || instr.Invoke.Command != "token" {
+		return errors.New("the pop-token has not been issued")
+	}
+	if _, contractID, err = coll.GetValues(instr.InstanceID.Slice()); err != nil ||
+		contractID != ContractPopPartyID ||
+		instr.InstanceID.SubID != omniledger.NewSubID(id.PoP.Party) {
+		return errors.New("the pop-token is not issued for this party")
+	}
+	public, err := id.PoP.Public.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(public, instr.Invoke.Args.Search("public")) {
+		return errors.New("the instruction issues another pop-token")
+	}
+	return nil
+}
+
+func decodeFinal(buf []byte) (*pop.FinalStatement, error) {
+	var final pop.FinalStatement
+	err := protobuf.DecodeWithConstructors(buf, &final, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, errors.New("couldn't decode final statement: " + err.Error())
+	}
+	if final.Desc == nil || final.Desc.Roster == nil {
+		return nil, errors.New("final statement without roster")
+	}
+	return &final, nil
+}
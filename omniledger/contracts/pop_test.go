@@ -0,0 +1,148 @@
+package contracts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/cothority/omniledger/service"
+	pop "github.com/dedis/cothority/pop/service"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/eddsa"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/kyber/util/random"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPopParty(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	final, attendees := newFinalStatement(t, 3)
+	party, err := final.Hash()
+	require.Nil(t, err)
+	finalBuf, err := protobuf.Encode(final)
+	require.Nil(t, err)
+
+	// Attendees get tokens, and token holders can spawn values.
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(2, true)
+	genesisMsg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:popParty"}, signer.Identity())
+	require.Nil(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+	popID := darc.NewIdentityPoP(party, nil).String()
+	require.Nil(t, gDarc.Rules.AddRule("invoke:token", expression.Expr(popID)))
+	require.Nil(t, gDarc.Rules.AddRule("spawn:value", expression.Expr(popID)))
+	genesisMsg.BlockInterval = time.Second
+
+	cl := service.NewClient()
+	_, err = cl.CreateGenesisBlock(genesisMsg)
+	require.Nil(t, err)
+
+	send := func(instr *service.Instruction, s darc.Signer) error {
+		instr.Nonce = service.GenNonce()
+		instr.Length = 1
+		require.Nil(t, instr.SignBy(s))
+		_, err := cl.AddTransactionAndWait(service.ClientTransaction{
+			Instructions: []service.Instruction{*instr},
+		}, 10)
+		return err
+	}
+	partyID := PopPartyID(gDarc.GetBaseID(), party)
+	getToken := func(f *pop.FinalStatement, index int, private kyber.Scalar, token *key.Pair) error {
+		sig, err := PopTokenSignature(f, index, private, token.Public)
+		require.Nil(t, err)
+		public, err := token.Public.MarshalBinary()
+		require.Nil(t, err)
+		return send(&service.Instruction{
+			InstanceID: partyID,
+			Invoke: &service.Invoke{
+				Command: "token",
+				Args: service.Arguments{
+					{Name: "public", Value: public},
+					{Name: "signature", Value: sig},
+				},
+			},
+		}, darc.NewSignerPoP(party, token.Public, token.Private))
+	}
+	spawnValue := func(token *key.Pair) error {
+		return send(&service.Instruction{
+			InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+			Spawn: &service.Spawn{
+				ContractID: ContractValueID,
+				Args:       service.Arguments{{Name: "value", Value: []byte("one person")}},
+			},
+		}, darc.NewSignerPoP(party, token.Public, token.Private))
+	}
+
+	require.Nil(t, send(&service.Instruction{
+		InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+		Spawn: &service.Spawn{
+			ContractID: ContractPopPartyID,
+			Args:       service.Arguments{{Name: "final", Value: finalBuf}},
+		},
+	}, signer))
+
+	token := key.NewKeyPair(cothority.Suite)
+	require.NotNil(t, spawnValue(token))
+	require.Nil(t, getToken(final, 1, attendees[1].Private, token))
+	require.Nil(t, spawnValue(token))
+
+	// An attendee only gets one token.
+	require.NotNil(t, getToken(final, 1, attendees[1].Private, key.NewKeyPair(cothority.Suite)))
+	// Only attendees get tokens.
+	outsider := key.NewKeyPair(cothority.Suite)
+	fake := *final
+	fake.Attendees = append(final.Attendees[:len(final.Attendees):len(final.Attendees)], outsider.Public)
+	require.NotNil(t, getToken(&fake, 3, outsider.Private, key.NewKeyPair(cothority.Suite)))
+	token2 := key.NewKeyPair(cothority.Suite)
+	require.Nil(t, getToken(final, 2, attendees[2].Private, token2))
+	require.Nil(t, spawnValue(token2))
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
+
+// TestPopTokenSignature makes sure that the same attendee always has the same
+// tag, so that it can't get two tokens.
+func TestPopTokenSignature(t *testing.T) {
+	final, attendees := newFinalStatement(t, 2)
+	tags := make(map[string]bool)
+	for _, i := range []int{0, 0, 1} {
+		token := key.NewKeyPair(cothority.Suite)
+		sig, err := PopTokenSignature(final, i, attendees[i].Private, token.Public)
+		require.Nil(t, err)
+		tags[string(sig[len(sig)-pop.SIGSIZE/2:])] = true
+	}
+	require.Equal(t, 2, len(tags))
+}
+
+// newFinalStatement returns the signed final statement of a party with n
+// attendees, and the keys of the attendees.
+func newFinalStatement(t *testing.T, n int) (*pop.FinalStatement, []*key.Pair) {
+	org := eddsa.NewEdDSA(random.New())
+	si := network.NewServerIdentity(org.Public, network.NewAddress(network.PlainTCP, "0:2000"))
+	final := &pop.FinalStatement{
+		Desc: &pop.PopDesc{
+			Name:     "test",
+			DateTime: "2018-08-01 18:00",
+			Roster:   onet.NewRoster([]*network.ServerIdentity{si}),
+		},
+	}
+	var attendees []*key.Pair
+	for i := 0; i < n; i++ {
+		kp := key.NewKeyPair(cothority.Suite)
+		attendees = append(attendees, kp)
+		final.Attendees = append(final.Attendees, kp.Public)
+	}
+	h, err := final.Hash()
+	require.Nil(t, err)
+	final.Signature, err = org.Sign(h)
+	require.Nil(t, err)
+	return final, attendees
+}
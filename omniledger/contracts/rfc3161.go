@@ -0,0 +1,337 @@
+package contracts
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// The object identifiers of RFC 3161 and CMS (RFC 5652).
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidExtKeyUsage   = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type timeStampResp struct {
+	Status struct {
+		Status int
+	}
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashedMessage []byte
+	}
+	SerialNumber *big.Int
+	GenTime      time.Time `asn1:"generalized"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// signerInfo holds the fields of a CMS SignerInfo that are needed to verify
+// its signature.
+type signerInfo struct {
+	sid             asn1.RawValue
+	digestAlgorithm asn1.ObjectIdentifier
+	signedAttrs     *asn1.RawValue
+	signature       []byte
+}
+
+// VerifyRFC3161 checks that token is an RFC 3161 timestamp token, or a
+// response holding one, for the sha256 hash, signed by the certificate of
+// the timestamping authority. It returns the time of the token. The
+// certificates embedded in the token are ignored, so the certificate of the
+// authority must be known in advance. As required by RFC 3161, the
+// certificate must only be usable for timestamping, and the token must
+// identify it as its signer.
+func VerifyRFC3161(token, hash []byte, cert *x509.Certificate) (time.Time, error) {
+	if err := checkTimestampingUsage(cert); err != nil {
+		return time.Time{}, err
+	}
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(token, &ci)
+	if err != nil || len(rest) > 0 || !ci.ContentType.Equal(oidSignedData) {
+		var resp timeStampResp
+		if rest, err = asn1.Unmarshal(token, &resp); err != nil || len(rest) > 0 {
+			return time.Time{}, errors.New("not a timestamp token or response")
+		}
+		// 0 is granted and 1 grantedWithMods.
+		if resp.Status.Status > 1 || len(resp.TimeStampToken.FullBytes) == 0 {
+			return time.Time{}, fmt.Errorf("timestamp was not granted: status %d", resp.Status.Status)
+		}
+		if _, err = asn1.Unmarshal(resp.TimeStampToken.FullBytes, &ci); err != nil {
+			return time.Time{}, err
+		}
+		if !ci.ContentType.Equal(oidSignedData) {
+			return time.Time{}, errors.New("token is not signed data")
+		}
+	}
+	content, si, err := parseSignedData(ci.Content.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var info tstInfo
+	if _, err = asn1.Unmarshal(content, &info); err != nil {
+		return time.Time{}, fmt.Errorf("invalid TSTInfo: %v", err)
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return time.Time{}, errors.New("the token is not for a sha256 hash")
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, hash) {
+		return time.Time{}, errors.New("the token is for another hash")
+	}
+	if err = si.checkSigner(cert); err != nil {
+		return time.Time{}, err
+	}
+	if err = si.verify(content, cert); err != nil {
+		return time.Time{}, err
+	}
+	if info.GenTime.Before(cert.NotBefore) || info.GenTime.After(cert.NotAfter) {
+		return time.Time{}, errors.New("the certificate was not valid at the time of the token")
+	}
+	return info.GenTime, nil
+}
+
+// parseSignedData returns the TSTInfo and the only signer of a CMS
+// SignedData. The optional fields are tagged, so the elements are read one
+// by one.
+func parseSignedData(buf []byte) ([]byte, *signerInfo, error) {
+	var sd asn1.RawValue
+	if _, err := asn1.Unmarshal(buf, &sd); err != nil {
+		return nil, nil, err
+	}
+	elems, err := rawElements(sd.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	// version, digestAlgorithms, encapContentInfo, [0] certificates,
+	// [1] crls, signerInfos
+	if len(elems) < 4 {
+		return nil, nil, errors.New("invalid signed data")
+	}
+	var encap struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     asn1.RawValue
+	}
+	if _, err = asn1.Unmarshal(elems[2].FullBytes, &encap); err != nil {
+		return nil, nil, err
+	}
+	if !encap.EContentType.Equal(oidTSTInfo) {
+		return nil, nil, errors.New("the signed content is not a TSTInfo")
+	}
+	var content []byte
+	if _, err = asn1.Unmarshal(encap.EContent.Bytes, &content); err != nil {
+		return nil, nil, err
+	}
+	signers := elems[len(elems)-1]
+	if signers.Class != asn1.ClassUniversal || signers.Tag != asn1.TagSet {
+		return nil, nil, errors.New("missing signer infos")
+	}
+	infos, err := rawElements(signers.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(infos) != 1 {
+		return nil, nil, errors.New("the token must have exactly one signer")
+	}
+	si, err := parseSignerInfo(infos[0].Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, si, nil
+}
+
+// parseSignerInfo reads version, sid, digestAlgorithm, [0] signedAttrs,
+// signatureAlgorithm, signature and [1] unsignedAttrs.
+func parseSignerInfo(buf []byte) (*signerInfo, error) {
+	elems, err := rawElements(buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) < 5 {
+		return nil, errors.New("invalid signer info")
+	}
+	var alg pkix.AlgorithmIdentifier
+	if _, err = asn1.Unmarshal(elems[2].FullBytes, &alg); err != nil {
+		return nil, err
+	}
+	si := &signerInfo{sid: elems[1], digestAlgorithm: alg.Algorithm}
+	i := 3
+	if elems[i].Class == asn1.ClassContextSpecific && elems[i].Tag == 0 {
+		si.signedAttrs = &elems[i]
+		i++
+	}
+	if len(elems) < i+2 {
+		return nil, errors.New("invalid signer info")
+	}
+	if _, err = asn1.Unmarshal(elems[i+1].FullBytes, &si.signature); err != nil {
+		return nil, err
+	}
+	return si, nil
+}
+
+// checkTimestampingUsage checks that the extended key usage of cert is
+// critical and only allows timestamping.
+func checkTimestampingUsage(cert *x509.Certificate) error {
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping ||
+		len(cert.UnknownExtKeyUsage) > 0 {
+		return errors.New("the certificate of the authority is not only for timestamping")
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) && !ext.Critical {
+			return errors.New("the extended key usage of the authority is not critical")
+		}
+	}
+	return nil
+}
+
+// checkSigner checks that the sid of the signer identifies cert, either by
+// its issuer and serial number or by its subject key identifier.
+func (si *signerInfo) checkSigner(cert *x509.Certificate) error {
+	switch {
+	case si.sid.Class == asn1.ClassUniversal && si.sid.Tag == asn1.TagSequence:
+		var ias issuerAndSerialNumber
+		if _, err := asn1.Unmarshal(si.sid.FullBytes, &ias); err != nil {
+			return err
+		}
+		if bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) && ias.SerialNumber != nil &&
+			ias.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return nil
+		}
+	case si.sid.Class == asn1.ClassContextSpecific && si.sid.Tag == 0:
+		if len(cert.SubjectKeyId) > 0 && bytes.Equal(si.sid.Bytes, cert.SubjectKeyId) {
+			return nil
+		}
+	}
+	return errors.New("the token is signed by another certificate than the authority")
+}
+
+// verify checks the signature of the signer over content with the public
+// key of cert.
+func (si *signerInfo) verify(content []byte, cert *x509.Certificate) error {
+	var h crypto.Hash
+	switch {
+	case si.digestAlgorithm.Equal(oidSHA256):
+		h = crypto.SHA256
+	case si.digestAlgorithm.Equal(oidSHA384):
+		h = crypto.SHA384
+	case si.digestAlgorithm.Equal(oidSHA512):
+		h = crypto.SHA512
+	default:
+		return errors.New("unsupported digest algorithm")
+	}
+	signed := content
+	if si.signedAttrs != nil {
+		// The signature covers the DER encoding of the attributes with the
+		// SET tag instead of the implicit [0] tag.
+		signed = append([]byte{0x31}, si.signedAttrs.FullBytes[1:]...)
+		if err := checkSignedAttrs(si.signedAttrs.Bytes, h, content); err != nil {
+			return err
+		}
+	}
+	algo, err := signatureAlgorithm(h, cert)
+	if err != nil {
+		return err
+	}
+	if err = cert.CheckSignature(algo, signed, si.signature); err != nil {
+		return errors.New("the token is not signed by the authority: " + err.Error())
+	}
+	return nil
+}
+
+// checkSignedAttrs checks that the content type of the signed attributes is
+// TSTInfo and that their message digest is the digest of content.
+func checkSignedAttrs(buf []byte, h crypto.Hash, content []byte) error {
+	var contentType asn1.ObjectIdentifier
+	var digest []byte
+	for len(buf) > 0 {
+		var attr attribute
+		var err error
+		if buf, err = asn1.Unmarshal(buf, &attr); err != nil {
+			return err
+		}
+		switch {
+		case attr.Type.Equal(oidContentType):
+			_, err = asn1.Unmarshal(attr.Values.Bytes, &contentType)
+		case attr.Type.Equal(oidMessageDigest):
+			_, err = asn1.Unmarshal(attr.Values.Bytes, &digest)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !contentType.Equal(oidTSTInfo) {
+		return errors.New("the signed attributes are not for a TSTInfo")
+	}
+	d := h.New()
+	d.Write(content)
+	if !bytes.Equal(d.Sum(nil), digest) {
+		return errors.New("the message digest doesn't match the TSTInfo")
+	}
+	return nil
+}
+
+// signatureAlgorithm returns the PKCS #1 v1.5 or ECDSA algorithm of the key
+// of cert with the hash h.
+func signatureAlgorithm(h crypto.Hash, cert *x509.Certificate) (x509.SignatureAlgorithm, error) {
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return map[crypto.Hash]x509.SignatureAlgorithm{
+			crypto.SHA256: x509.SHA256WithRSA,
+			crypto.SHA384: x509.SHA384WithRSA,
+			crypto.SHA512: x509.SHA512WithRSA,
+		}[h], nil
+	case *ecdsa.PublicKey:
+		return map[crypto.Hash]x509.SignatureAlgorithm{
+			crypto.SHA256: x509.ECDSAWithSHA256,
+			crypto.SHA384: x509.ECDSAWithSHA384,
+			crypto.SHA512: x509.ECDSAWithSHA512,
+		}[h], nil
+	}
+	return x509.UnknownSignatureAlgorithm, errors.New("unsupported key of the authority")
+}
+
+// rawElements splits the content of a SEQUENCE or SET into its elements.
+func rawElements(buf []byte) ([]asn1.RawValue, error) {
+	var elems []asn1.RawValue
+	for len(buf) > 0 {
+		var rv asn1.RawValue
+		var err error
+		if buf, err = asn1.Unmarshal(buf, &rv); err != nil {
+			return nil, err
+		}
+		elems = append(elems, rv)
+	}
+	return elems, nil
+}
@@ -27,6 +27,45 @@ func newService(c *onet.Context) (onet.Service, error) {
 		ServiceProcessor: onet.NewServiceProcessor(c),
 	}
 	service.RegisterContract(c, ContractValueID, ContractValue)
-	service.RegisterContract(c, ContractCoinID, ContractCoin)
+	service.RegisterContract(c, ContractCoinID, service.OmniLedgerContract(ContractCoin))
+	service.RegisterView(c, ContractCoinID, "balance", CoinBalance)
+	if err := service.RegisterStateMachine(c, ContractEscrow); err != nil {
+		return nil, err
+	}
+	service.RegisterArgumentSchema(c, ContractEscrowID, "spawn", service.ArgumentSchema{
+		{Name: "payer", Type: service.ArgInstanceID, Required: true},
+		{Name: "payee", Type: service.ArgInstanceID, Required: true},
+		{Name: "coins", Type: service.ArgUint64, Required: true},
+		{Name: "timeout", Type: service.ArgUint64, Required: true},
+	})
+	service.RegisterContract(c, ContractPopPartyID, service.OmniLedgerContract(ContractPopParty))
+	service.RegisterArgumentSchema(c, ContractPopPartyID, "spawn", service.ArgumentSchema{
+		{Name: "final", Type: service.ArgBytes, Required: true},
+	})
+	service.RegisterArgumentSchema(c, ContractPopPartyID, "invoke:token", service.ArgumentSchema{
+		{Name: "public", Type: service.ArgBytes, Required: true},
+		{Name: "signature", Type: service.ArgBytes, Required: true},
+	})
+	service.RegisterContract(c, ContractTimestampID, service.OmniLedgerContract(ContractTimestamp))
+	service.RegisterArgumentSchema(c, ContractTimestampID, "spawn", service.ArgumentSchema{
+		{Name: "hash", Type: service.ArgBytes, Required: true},
+		{Name: "type", Type: service.ArgString, Required: true},
+		{Name: "proof", Type: service.ArgBytes, Required: true},
+		{Name: "authority", Type: service.ArgInstanceID},
+	})
+	service.RegisterContract(c, ContractLotteryID, service.OmniLedgerContract(ContractLottery))
+	service.RegisterArgumentSchema(c, ContractLotteryID, "spawn", service.ArgumentSchema{
+		{Name: "prizes", Type: service.ArgUint64},
+		{Name: "close", Type: service.ArgUint64},
+	})
+	service.RegisterArgumentSchema(c, ContractLotteryID, "invoke:draw", service.ArgumentSchema{
+		{Name: "randomness", Type: service.ArgBytes, Required: true},
+	})
+	if err := service.RegisterRandomness(c, ContractLotteryID, LotteryRandomness); err != nil {
+		return nil, err
+	}
+	if err := service.RegisterIdentityVerifier(c, "pop", VerifyPopIdentity); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
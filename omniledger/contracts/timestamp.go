@@ -0,0 +1,133 @@
+package contracts
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/protobuf"
+)
+
+// The timestamp contract stores the hash of an external document together
+// with a proof from a timestamping service that the document existed at a
+// given time. The proof is verified when the instance is spawned, so that
+// the ledger only holds valid timestamps and can be used as a verifiable
+// timestamping service. Two kinds of proofs are accepted:
+//   - RFC 3161 tokens, signed by a timestamping authority whose certificate
+//     is stored in a value instance of the darc of the timestamp, so only the
+//     identities that can spawn values on the darc choose the trusted
+//     authorities
+//   - OpenTimestamps proofs, that commit the document to a merkle root. The
+//     nodes don't check that it is the merkle root of the claimed Bitcoin
+//     block, as they have no Bitcoin node, so these timestamps are only as
+//     good as the check of the client that reads them
+
+// ContractTimestampID denotes a contract that stores verified timestamps.
+var ContractTimestampID = "timestamp"
+
+// The types of timestamp proofs.
+const (
+	TimestampRFC3161        = "rfc3161"
+	TimestampOpenTimestamps = "ots"
+)
+
+// TimestampData is the data of a timestamp instance.
+type TimestampData struct {
+	// Hash is the sha256 hash of the document.
+	Hash []byte
+	// Type of the proof, TimestampRFC3161 or TimestampOpenTimestamps.
+	Type string
+	// Proof as given by the timestamping service.
+	Proof []byte
+	// Time is the time of the RFC 3161 token in unix nanoseconds.
+	Time int64
+	// Authority is the value instance holding the certificate of the
+	// timestamping authority of an RFC 3161 token.
+	Authority omniledger.InstanceID
+	// BitcoinHeight is the height of the Bitcoin block of an OpenTimestamps
+	// proof, as claimed by the proof.
+	BitcoinHeight uint64
+	// BitcoinMerkleRoot is the merkle root the document is committed to, in
+	// the byte order of the Bitcoin block header. Only a Bitcoin node can
+	// tell if it is the merkle root of the block at BitcoinHeight.
+	BitcoinMerkleRoot []byte
+}
+
+// TimestampID returns the instance ID of the timestamp of the document with
+// the given hash, spawned by the darc with the given ID. Every document can
+// only be timestamped once per darc.
+func TimestampID(darcID darc.ID, hash []byte) omniledger.InstanceID {
+	return omniledger.InstanceID{
+		DarcID: darcID,
+		SubID:  omniledger.NewSubID(hash),
+	}
+}
+
+// ContractTimestamp accepts the following instruction:
+//   - Spawn - verifies the proof in the argument "proof" of the type in the
+//     argument "type" for the sha256 hash in the argument "hash" and stores
+//     a TimestampData at TimestampID. RFC 3161 tokens need the argument
+//     "authority", the instance ID of a value instance of the same darc
+//     holding the DER encoded certificate of the timestamping authority
+//
+// Timestamps can neither be updated nor deleted.
+func ContractTimestamp(cdb omniledger.CollectionView, inst omniledger.Instruction, c []omniledger.Coin) ([]omniledger.StateChange, []omniledger.Coin, error) {
+	if inst.GetType() != omniledger.SpawnType {
+		return nil, nil, errors.New("timestamps can only be spawned")
+	}
+	args := inst.Spawn.Args
+	td := TimestampData{
+		Hash:  args.Search("hash"),
+		Type:  string(args.Search("type")),
+		Proof: args.Search("proof"),
+	}
+	if len(td.Hash) != 32 {
+		return nil, nil, errors.New("the hash must be 32 bytes")
+	}
+	switch td.Type {
+	case TimestampRFC3161:
+		authority := args.Search("authority")
+		if len(authority) != 64 {
+			return nil, nil, errors.New("need the instance ID of the authority")
+		}
+		td.Authority = omniledger.NewInstanceID(authority)
+		if !td.Authority.DarcID.Equal(inst.InstanceID.DarcID) {
+			return nil, nil, errors.New("the authority must be a value of the darc of the timestamp")
+		}
+		certBuf, cid, err := cdb.GetValues(authority)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cid != ContractValueID {
+			return nil, nil, errors.New("the authority is not a value instance")
+		}
+		cert, err := x509.ParseCertificate(certBuf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid certificate of the authority: %v", err)
+		}
+		t, err := VerifyRFC3161(td.Proof, td.Hash, cert)
+		if err != nil {
+			return nil, nil, err
+		}
+		td.Time = t.UnixNano()
+	case TimestampOpenTimestamps:
+		att, err := VerifyOpenTimestamps(td.Proof, td.Hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		td.BitcoinHeight = att.Height
+		td.BitcoinMerkleRoot = att.MerkleRoot
+	default:
+		return nil, nil, fmt.Errorf("unknown timestamp type %s", td.Type)
+	}
+	tdBuf, err := protobuf.Encode(&td)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []omniledger.StateChange{
+		omniledger.NewStateChange(omniledger.Create,
+			TimestampID(inst.InstanceID.DarcID, td.Hash), ContractTimestampID, tdBuf),
+	}, c, nil
+}
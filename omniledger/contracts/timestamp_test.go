@@ -0,0 +1,300 @@
+package contracts
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestamp(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(2, true)
+
+	genesisMsg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:value", "spawn:timestamp"}, signer.Identity())
+	require.Nil(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+	genesisMsg.BlockInterval = time.Second
+
+	cl := service.NewClient()
+	_, err = cl.CreateGenesisBlock(genesisMsg)
+	require.Nil(t, err)
+
+	spawn := func(contractID string, args service.Arguments) (*service.Instruction, error) {
+		instr := &service.Instruction{
+			InstanceID: service.InstanceID{DarcID: gDarc.GetBaseID()},
+			Nonce:      service.GenNonce(),
+			Length:     1,
+			Spawn:      &service.Spawn{ContractID: contractID, Args: args},
+		}
+		require.Nil(t, instr.SignBy(signer))
+		_, err := cl.AddTransactionAndWait(service.ClientTransaction{
+			Instructions: []service.Instruction{*instr},
+		}, 10)
+		return instr, err
+	}
+	getTimestamp := func(hash []byte) *TimestampData {
+		p, err := cl.GetProof(TimestampID(gDarc.GetBaseID(), hash).Slice())
+		require.Nil(t, err)
+		require.True(t, p.Proof.InclusionProof.Match())
+		_, vs, err := p.Proof.KeyValue()
+		require.Nil(t, err)
+		require.Equal(t, ContractTimestampID, string(vs[1]))
+		td := &TimestampData{}
+		require.Nil(t, protobuf.Decode(vs[0], td))
+		return td
+	}
+
+	key, cert := newTSA(t)
+	instr, err := spawn(ContractValueID, service.Arguments{{Name: "value", Value: cert.Raw}})
+	require.Nil(t, err)
+	authority := instr.DeriveID(ContractValueID)
+
+	hash := sha256.Sum256([]byte("document"))
+	genTime := time.Now().Truncate(time.Second)
+	_, err = spawn(ContractTimestampID, service.Arguments{
+		{Name: "hash", Value: hash[:]},
+		{Name: "type", Value: []byte(TimestampRFC3161)},
+		{Name: "proof", Value: newToken(t, hash[:], key, cert, genTime)},
+		{Name: "authority", Value: authority.Slice()},
+	})
+	require.Nil(t, err)
+	td := getTimestamp(hash[:])
+	require.Equal(t, genTime.UnixNano(), td.Time)
+	require.Equal(t, authority, td.Authority)
+
+	// The authority must belong to the darc of the timestamp.
+	hash3 := sha256.Sum256([]byte("document 3"))
+	foreign := service.InstanceID{DarcID: darc.ID(hash3[:]), SubID: authority.SubID}
+	_, err = spawn(ContractTimestampID, service.Arguments{
+		{Name: "hash", Value: hash3[:]},
+		{Name: "type", Value: []byte(TimestampRFC3161)},
+		{Name: "proof", Value: newToken(t, hash3[:], key, cert, genTime)},
+		{Name: "authority", Value: foreign.Slice()},
+	})
+	require.NotNil(t, err)
+
+	// The same document can't be timestamped twice.
+	_, err = spawn(ContractTimestampID, service.Arguments{
+		{Name: "hash", Value: hash[:]},
+		{Name: "type", Value: []byte(TimestampOpenTimestamps)},
+		{Name: "proof", Value: newOTS(hash[:], 1)},
+	})
+	require.NotNil(t, err)
+
+	hash2 := sha256.Sum256([]byte("document 2"))
+	_, err = spawn(ContractTimestampID, service.Arguments{
+		{Name: "hash", Value: hash2[:]},
+		{Name: "type", Value: []byte(TimestampOpenTimestamps)},
+		{Name: "proof", Value: newOTS(hash[:], 1)},
+	})
+	require.NotNil(t, err)
+	_, err = spawn(ContractTimestampID, service.Arguments{
+		{Name: "hash", Value: hash2[:]},
+		{Name: "type", Value: []byte(TimestampOpenTimestamps)},
+		{Name: "proof", Value: newOTS(hash2[:], 500000)},
+	})
+	require.Nil(t, err)
+	td = getTimestamp(hash2[:])
+	require.Equal(t, uint64(500000), td.BitcoinHeight)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
+
+func TestVerifyRFC3161(t *testing.T) {
+	key, cert := newTSA(t)
+	hash := sha256.Sum256([]byte("document"))
+	genTime := time.Now().Truncate(time.Second)
+	token := newToken(t, hash[:], key, cert, genTime)
+
+	ts, err := VerifyRFC3161(token, hash[:], cert)
+	require.Nil(t, err)
+	require.True(t, genTime.Equal(ts))
+
+	// A response holding the token.
+	resp := seq(t, mustMarshal(t, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true,
+		Bytes: mustMarshal(t, 0)}), token)
+	ts, err = VerifyRFC3161(resp, hash[:], cert)
+	require.Nil(t, err)
+	require.True(t, genTime.Equal(ts))
+	rejected := seq(t, mustMarshal(t, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true,
+		Bytes: mustMarshal(t, 2)}))
+	_, err = VerifyRFC3161(rejected, hash[:], cert)
+	require.NotNil(t, err)
+
+	other := sha256.Sum256([]byte("other"))
+	_, err = VerifyRFC3161(token, other[:], cert)
+	require.NotNil(t, err)
+	_, cert2 := newTSA(t)
+	_, err = VerifyRFC3161(token, hash[:], cert2)
+	require.NotNil(t, err)
+	_, err = VerifyRFC3161(newToken(t, hash[:], key, cert, cert.NotAfter.Add(time.Hour)), hash[:], cert)
+	require.NotNil(t, err)
+	_, err = VerifyRFC3161(token[:len(token)-1], hash[:], cert)
+	require.NotNil(t, err)
+
+	// The certificate must only be for timestamping, with a critical
+	// extension, and be the signer named in the token.
+	_, err = VerifyRFC3161(token, hash[:], newTSACert(t, key, 1, false))
+	require.NotNil(t, err)
+	_, err = VerifyRFC3161(token, hash[:], newTSACert(t, key, 2, true))
+	require.NotNil(t, err)
+}
+
+func TestVerifyOpenTimestamps(t *testing.T) {
+	hash := sha256.Sum256([]byte("document"))
+	proof := newOTS(hash[:], 500000)
+	att, err := VerifyOpenTimestamps(proof, hash[:])
+	require.Nil(t, err)
+	require.Equal(t, uint64(500000), att.Height)
+	root := sha256.Sum256(append(hash[:], []byte("nonce")...))
+	require.Equal(t, root[:], att.MerkleRoot)
+
+	other := sha256.Sum256([]byte("other"))
+	_, err = VerifyOpenTimestamps(proof, other[:])
+	require.NotNil(t, err)
+	_, err = VerifyOpenTimestamps(proof[:len(proof)-1], hash[:])
+	require.NotNil(t, err)
+	_, err = VerifyOpenTimestamps(append(proof, 0), hash[:])
+	require.NotNil(t, err)
+
+	// Only a pending attestation.
+	pending := append(append([]byte{}, otsMagic...), 1, 0x08)
+	pending = append(pending, hash[:]...)
+	pending = append(pending, 0x00, 0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e, 2, 'c', 'c')
+	_, err = VerifyOpenTimestamps(pending, hash[:])
+	require.NotNil(t, err)
+}
+
+// newOTS returns an OpenTimestamps proof of hash with a pending attestation
+// and a Bitcoin attestation of sha256(hash || "nonce") at height.
+func newOTS(hash []byte, height uint64) []byte {
+	proof := append(append([]byte{}, otsMagic...), 1, 0x08)
+	proof = append(proof, hash...)
+	proof = append(proof, 0xff, 0x00, 0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e)
+	proof = append(proof, 8)
+	proof = append(proof, "calendar"...)
+	proof = append(proof, 0xf0, 5)
+	proof = append(proof, "nonce"...)
+	proof = append(proof, 0x08, 0x00)
+	proof = append(proof, otsBitcoinTag...)
+	var h []byte
+	for ; height >= 0x80; height >>= 7 {
+		h = append(h, byte(height)|0x80)
+	}
+	h = append(h, byte(height))
+	proof = append(proof, byte(len(h)))
+	return append(proof, h...)
+}
+
+// newTSA returns the key and the self-signed certificate of a timestamping
+// authority.
+func newTSA(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	return key, newTSACert(t, key, 1, true)
+}
+
+// newTSACert returns a self-signed certificate of key with the serial
+// number, whose extended key usage is critical and only for timestamping if
+// timestamping is true.
+func newTSACert(t *testing.T, key *ecdsa.PrivateKey, serial int64, timestamping bool) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if timestamping {
+		tmpl.ExtraExtensions = []pkix.Extension{{
+			Id:       oidExtKeyUsage,
+			Critical: true,
+			Value:    mustMarshal(t, []asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 8}}),
+		}}
+	} else {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}
+	}
+	buf, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(buf)
+	require.Nil(t, err)
+	return cert
+}
+
+// newToken returns an RFC 3161 token for hash at genTime, signed by key
+// with signed attributes.
+func newToken(t *testing.T, hash []byte, key *ecdsa.PrivateKey, cert *x509.Certificate, genTime time.Time) []byte {
+	info := tstInfo{
+		Version:      1,
+		Policy:       asn1.ObjectIdentifier{1, 2, 3},
+		SerialNumber: big.NewInt(1),
+		GenTime:      genTime.UTC(),
+	}
+	info.MessageImprint.HashAlgorithm.Algorithm = oidSHA256
+	info.MessageImprint.HashedMessage = hash
+	content := mustMarshal(t, info)
+
+	digest := sha256.Sum256(content)
+	attr := func(oid asn1.ObjectIdentifier, value []byte) []byte {
+		return seq(t, mustMarshal(t, oid),
+			mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value}))
+	}
+	attrs := append(attr(oidContentType, mustMarshal(t, oidTSTInfo)),
+		attr(oidMessageDigest, mustMarshal(t, digest[:]))...)
+	signed := sha256.Sum256(mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs}))
+	sig, err := key.Sign(rand.Reader, signed[:], crypto.SHA256)
+	require.Nil(t, err)
+
+	sha256Alg := mustMarshal(t, pkix.AlgorithmIdentifier{Algorithm: oidSHA256})
+	si := seq(t,
+		mustMarshal(t, 1),
+		seq(t, cert.RawIssuer, mustMarshal(t, cert.SerialNumber)),
+		sha256Alg,
+		mustMarshal(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs}),
+		mustMarshal(t, pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}),
+		mustMarshal(t, sig))
+	sd := seq(t,
+		mustMarshal(t, 3),
+		mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: sha256Alg}),
+		seq(t, mustMarshal(t, oidTSTInfo), explicit0(t, mustMarshal(t, content))),
+		mustMarshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si}))
+	return seq(t, mustMarshal(t, oidSignedData), explicit0(t, sd))
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	buf, err := asn1.Marshal(v)
+	require.Nil(t, err)
+	return buf
+}
+
+// seq returns the SEQUENCE of the DER encoded elements.
+func seq(t *testing.T, elems ...[]byte) []byte {
+	var buf []byte
+	for _, e := range elems {
+		buf = append(buf, e...)
+	}
+	return mustMarshal(t, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: buf})
+}
+
+// explicit0 returns the DER encoded element with an explicit [0] tag.
+func explicit0(t *testing.T, elem []byte) []byte {
+	return mustMarshal(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: elem})
+}
@@ -1,8 +1,6 @@
 package contracts
 
 import (
-	"errors"
-
 	"github.com/dedis/cothority/omniledger/service"
 )
 
@@ -19,25 +17,32 @@ var ContractValueID = "value"
 // It can spawn new value instances and will store the "value" argument in these
 // new instances.
 // Existing value instances can be "update"d and deleted.
-func ContractValue(cdb service.CollectionView, inst service.Instruction, c []service.Coin) ([]service.StateChange, []service.Coin, error) {
-	switch {
-	case inst.Spawn != nil:
-		return []service.StateChange{
-			service.NewStateChange(service.Create, inst.DeriveID(ContractValueID),
-				ContractValueID, inst.Spawn.Args.Search("value")),
-		}, c, nil
-	case inst.Invoke != nil:
-		if inst.Invoke.Command != "update" {
-			return nil, nil, errors.New("Value contract can only update")
+var ContractValue = service.BasicContract{
+	SpawnFn: func(cdb service.CollectionView, inst service.Instruction, c []service.Coin) ([]service.StateChange, []service.Coin, error) {
+		value, err := inst.Spawn.Args.Bytes("value")
+		if err != nil {
+			return nil, nil, err
 		}
 		return []service.StateChange{
-			service.NewStateChange(service.Update, inst.InstanceID,
-				ContractValueID, inst.Invoke.Args.Search("value")),
+			service.NewStateChange(service.Create, inst.DeriveID(ContractValueID),
+				ContractValueID, value),
 		}, c, nil
-	case inst.Delete != nil:
+	},
+	Commands: map[string]service.OmniLedgerContract{
+		"update": func(cdb service.CollectionView, inst service.Instruction, c []service.Coin) ([]service.StateChange, []service.Coin, error) {
+			value, err := inst.Invoke.Args.Bytes("value")
+			if err != nil {
+				return nil, nil, err
+			}
+			return []service.StateChange{
+				service.NewStateChange(service.Update, inst.InstanceID,
+					ContractValueID, value),
+			}, c, nil
+		},
+	},
+	DeleteFn: func(cdb service.CollectionView, inst service.Instruction, c []service.Coin) ([]service.StateChange, []service.Coin, error) {
 		return service.StateChanges{
 			service.NewStateChange(service.Remove, inst.InstanceID, ContractValueID, nil),
 		}, c, nil
-	}
-	return nil, nil, errors.New("didn't find any instruction")
+	},
 }
@@ -61,3 +61,39 @@ func TestValue_Spawn(t *testing.T) {
 
 	local.WaitDone(genesisMsg.BlockInterval)
 }
+
+func TestValue_UpdateDelete(t *testing.T) {
+	ct := newCT()
+	addr := service.NewInstanceID(nil)
+	ct.Store(addr, []byte("1234"), ContractValueID)
+
+	inst := service.Instruction{
+		InstanceID: addr,
+		Invoke: &service.Invoke{
+			Command: "update",
+		},
+	}
+	_, _, err := ContractValue.Invoke(ct, inst, nil)
+	require.Error(t, err)
+
+	inst.Invoke.Args = service.Arguments{{Name: "value", Value: []byte("5678")}}
+	sc, _, err := ContractValue.Invoke(ct, inst, nil)
+	require.Nil(t, err)
+	require.Equal(t, []service.StateChange{
+		service.NewStateChange(service.Update, addr, ContractValueID, []byte("5678")),
+	}, sc)
+
+	inst.Invoke.Command = "append"
+	_, _, err = ContractValue.Invoke(ct, inst, nil)
+	require.Error(t, err)
+
+	inst = service.Instruction{
+		InstanceID: addr,
+		Delete:     &service.Delete{},
+	}
+	sc, _, err = ContractValue.Delete(ct, inst, nil)
+	require.Nil(t, err)
+	require.Equal(t, []service.StateChange{
+		service.NewStateChange(service.Remove, addr, ContractValueID, nil),
+	}, sc)
+}
@@ -0,0 +1,117 @@
+package darc
+
+import (
+	"strings"
+
+	"github.com/dedis/cothority/omniledger/darc/expression"
+)
+
+// Role is a template of actions that is expanded into rules for a set of
+// identities. Actions in AndActions need a signature of all identities of the
+// role, whereas actions in OrActions need a signature of any one of them.
+type Role struct {
+	AndActions []Action
+	OrActions  []Action
+}
+
+// RoleAdmin can evolve the darc if all admins sign, and any admin can sign
+// on behalf of the darc. This is what InitRules gives to the owners.
+var RoleAdmin = Role{
+	AndActions: []Action{evolve},
+	OrActions:  []Action{sign},
+}
+
+// RoleEvolver can only evolve the darc, all evolvers need to sign.
+var RoleEvolver = Role{
+	AndActions: []Action{evolve},
+}
+
+// RoleUser returns a role where any one of the identities is allowed to
+// perform the given actions and to sign on behalf of the darc.
+func RoleUser(actions ...Action) Role {
+	return Role{
+		OrActions: append([]Action{sign}, actions...),
+	}
+}
+
+// Builder assembles the rules of a darc from roles. If more than one role
+// grants the same action, the expressions of the roles are joined with a
+// logical-or. The "_evolve" and "_sign" actions are always present in the
+// resulting darc, even if no role grants them.
+type Builder struct {
+	desc    []byte
+	actions []Action
+	exprs   map[Action][]expression.Expr
+}
+
+// NewBuilder returns a builder for a darc with the given description.
+func NewBuilder(desc []byte) *Builder {
+	return &Builder{
+		desc:  desc,
+		exprs: make(map[Action][]expression.Expr),
+	}
+}
+
+// AddRole grants the role to the identities.
+func (b *Builder) AddRole(role Role, ids ...Identity) *Builder {
+	if len(ids) == 0 {
+		return b
+	}
+	idStrs := make([]string, len(ids))
+	for i, id := range ids {
+		idStrs[i] = id.String()
+	}
+	for _, a := range role.AndActions {
+		b.add(a, expression.InitAndExpr(idStrs...))
+	}
+	for _, a := range role.OrActions {
+		b.add(a, expression.InitOrExpr(idStrs...))
+	}
+	return b
+}
+
+// Delegate grants the role to the darc, typically a management darc. As
+// the darc identity points to the base ID, the delegation stays valid when
+// the darc evolves.
+func (b *Builder) Delegate(role Role, d *Darc) *Builder {
+	return b.AddRole(role, NewIdentityDarc(d.GetBaseID()))
+}
+
+// Rules returns the expanded rules.
+func (b *Builder) Rules() (Rules, error) {
+	rs := make(Rules)
+	rs[evolve] = expression.Expr{}
+	rs[sign] = expression.Expr{}
+	for _, a := range b.actions {
+		exprs := b.exprs[a]
+		if len(exprs) == 1 {
+			rs[a] = exprs[0]
+			continue
+		}
+		parts := make([]string, len(exprs))
+		for i, e := range exprs {
+			parts[i] = "(" + string(e) + ")"
+		}
+		rs[a] = expression.Expr(strings.Join(parts, " | "))
+	}
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Build returns a new darc with the expanded rules.
+func (b *Builder) Build() (*Darc, error) {
+	rs, err := b.Rules()
+	if err != nil {
+		return nil, err
+	}
+	return NewDarc(rs, b.desc), nil
+}
+
+func (b *Builder) add(a Action, expr expression.Expr) {
+	if _, ok := b.exprs[a]; !ok {
+		b.actions = append(b.actions, a)
+	}
+	b.exprs[a] = append(b.exprs[a], expr)
+}
@@ -0,0 +1,63 @@
+package darc
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder_Roles(t *testing.T) {
+	admin1, _ := createSignerIdentity()
+	admin2, _ := createSignerIdentity()
+	user, _ := createSignerIdentity()
+
+	d, err := NewBuilder([]byte("app")).
+		AddRole(RoleAdmin, admin1.Identity(), admin2.Identity()).
+		AddRole(RoleUser("spawn:value"), user.Identity()).
+		Build()
+	require.Nil(t, err)
+	require.Equal(t, expression.InitAndExpr(admin1.Identity().String(), admin2.Identity().String()),
+		d.Rules.GetEvolutionExpr())
+	require.True(t, d.Rules.Contains("spawn:value"))
+
+	r, err := InitAndSignRequest(d.GetID(), "spawn:value", []byte("msg"), user)
+	require.Nil(t, err)
+	require.Nil(t, r.Verify(d))
+	r, err = InitAndSignRequest(d.GetID(), "spawn:value", []byte("msg"), admin1)
+	require.Nil(t, err)
+	require.NotNil(t, r.Verify(d))
+
+	// An empty builder still has the default actions.
+	rs, err := NewBuilder(nil).Rules()
+	require.Nil(t, err)
+	require.True(t, rs.Contains(evolve))
+	require.True(t, rs.Contains(sign))
+}
+
+func TestBuilder_Delegate(t *testing.T) {
+	owner, _ := createSignerIdentity()
+	mgmt, err := NewBuilder([]byte("management")).
+		AddRole(RoleAdmin, owner.Identity()).
+		Build()
+	require.Nil(t, err)
+
+	evolver, _ := createSignerIdentity()
+	app, err := NewBuilder([]byte("application")).
+		Delegate(RoleEvolver, mgmt).
+		AddRole(RoleEvolver, evolver.Identity()).
+		Build()
+	require.Nil(t, err)
+	_, err = expression.Validate(app.Rules.GetEvolutionExpr())
+	require.Nil(t, err)
+
+	getDarc := DarcsToGetDarcs([]*Darc{mgmt, app})
+	for _, s := range []Signer{owner, evolver} {
+		td := createDarc(1, "new")
+		require.Nil(t, localEvolution(td.darc, app, s))
+		require.Nil(t, td.darc.VerifyWithCB(getDarc, true))
+	}
+	td := createDarc(1, "new")
+	require.Nil(t, localEvolution(td.darc, app, td.owners[0]))
+	require.NotNil(t, td.darc.VerifyWithCB(getDarc, true))
+}
@@ -38,6 +38,7 @@ import (
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
@@ -55,6 +56,24 @@ import (
 const evolve = "_evolve"
 const sign = "_sign"
 
+// RequestVersionLegacy is the hashing scheme of requests that has been used
+// before versioning was introduced. It does not include the skipchain ID and
+// is kept so that existing signatures stay valid.
+const RequestVersionLegacy uint32 = 0
+
+// RequestVersion1 hashes a length-prefixed encoding of all fields of the
+// request, including the version and the skipchain ID.
+const RequestVersion1 uint32 = 1
+
+// RequestVersionHardware is RequestVersion1 bound to a summary of the
+// request, for hardware wallets that can't parse requests but can show the
+// summary to the user before signing, see Request.HardwarePayload.
+const RequestVersionHardware uint32 = 2
+
+// CurrentRequestVersion is the version of the request hashing used by
+// default.
+const CurrentRequestVersion = RequestVersion1
+
 // GetDarc is a callback function that we expect the user of this library to
 // supply in some of our methods. The user is free to choose how he/she wants
 // to store the darc. Hence, during verification, we need a way to retrieve an
@@ -65,7 +84,10 @@ const sign = "_sign"
 // if latest is true, then given a darc base-ID (a darc of version 0), the
 // callback should return the latest one with that base-ID. If latest is false,
 // then the callback should return an exact match. The callback should return
-// nil if no match is found.
+// nil if no match is found. Identities pointing to a darc on another
+// skipchain (output of IdentityChainDarc.String()) are also resolved through
+// this callback, so it is the responsibility of the caller to fetch and verify
+// the foreign darc.
 type GetDarc func(s string, latest bool) *Darc
 
 // InitRules initialise a set of rules with the default actions "_evolve" and
@@ -206,6 +228,9 @@ func (r Rules) AddRule(a Action, expr expression.Expr) error {
 	if _, ok := r[a]; ok {
 		return errors.New("action already exists")
 	}
+	if err := validateExpr(expr); err != nil {
+		return err
+	}
 	r[a] = expr
 	return nil
 }
@@ -266,10 +291,33 @@ func (r Rules) updateRule(a Action, expr expression.Expr) error {
 	if _, ok := r[a]; !ok {
 		return fmt.Errorf("updateRule: action '%v' does not exist", a)
 	}
+	if err := validateExpr(expr); err != nil {
+		return err
+	}
 	r[a] = expr
 	return nil
 }
 
+// Validate checks that all expressions in the rules are syntactically
+// correct. An empty expression is valid and means that nobody is allowed to
+// perform the action.
+func (r Rules) Validate() error {
+	for a, expr := range r {
+		if err := validateExpr(expr); err != nil {
+			return fmt.Errorf("invalid expression for action '%v': %v", a, err)
+		}
+	}
+	return nil
+}
+
+func validateExpr(expr expression.Expr) error {
+	if len(expr) == 0 {
+		return nil
+	}
+	_, err := expression.Validate(expr)
+	return err
+}
+
 func isDefault(action Action) bool {
 	if action == evolve || action == sign {
 		return true
@@ -388,9 +436,28 @@ func (r *Request) Verify(d *Darc) error {
 // argument. This function will ignore darcs in Darc.VerificationDarcs, please
 // use Darc.Verify if you wish to use it.
 func (r *Request) VerifyWithCB(d *Darc, getDarc GetDarc) error {
+	if err := r.VerifySignatures(d); err != nil {
+		return err
+	}
+	validIDs := r.GetIdentityStrings()
+	err := evalExpr(d.Rules[r.Action], getDarc, validIDs...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// VerifySignatures checks that the request is for an action of the darc d and
+// that all its identities signed it, but it doesn't evaluate the rule of the
+// action. It lets the caller cache the result of EvalExpr for the identities
+// of the request.
+func (r *Request) VerifySignatures(d *Darc) error {
 	if len(r.Signatures) == 0 {
 		return errors.New("no signatures - nothing to verify")
 	}
+	if r.Version > RequestVersionHardware {
+		return fmt.Errorf("unknown request version %d", r.Version)
+	}
 	if len(r.Signatures) != len(r.Identities) {
 		return fmt.Errorf("signatures and identities have unequal length - %d != %d",
 			len(r.Signatures), len(r.Identities))
@@ -408,11 +475,6 @@ func (r *Request) VerifyWithCB(d *Darc, getDarc GetDarc) error {
 			return err
 		}
 	}
-	validIDs := r.GetIdentityStrings()
-	err := evalExpr(d.Rules[r.Action], getDarc, validIDs...)
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
@@ -555,11 +617,27 @@ func evalExprWithSigs(expr expression.Expr, getDarc GetDarc, sigs ...Signature)
 	return nil
 }
 
+// EvalExpr checks whether the expression evaluates to true given a list of
+// identities. Unlike Request.VerifyWithCB, it doesn't verify any signature,
+// so the caller must have verified that the identities signed.
+func EvalExpr(expr expression.Expr, getDarc GetDarc, ids ...string) error {
+	return evalExpr(expr, getDarc, ids...)
+}
+
 // evalExpr checks whether the expression evaluates to true given a list of
 // identities.
 func evalExpr(expr expression.Expr, getDarc GetDarc, ids ...string) error {
+	return evalExprBudget(expr, getDarc, nil, ids...)
+}
+
+// evalExprBudget is like evalExpr, but if b is not nil, every identity
+// evaluated takes a step of b.
+func evalExprBudget(expr expression.Expr, getDarc GetDarc, b *budget, ids ...string) error {
 	Y := expression.InitParser(func(s string) bool {
-		if strings.HasPrefix(s, "darc") {
+		if !b.step() {
+			return false
+		}
+		if strings.HasPrefix(s, "darc") || strings.HasPrefix(s, "chaindarc") {
 			// getDarc is responsible for returning the latest Darc
 			d := getDarc(s, true)
 			if d == nil {
@@ -574,7 +652,7 @@ func evalExpr(expr expression.Expr, getDarc GetDarc, ids ...string) error {
 			}
 			// Recursively evaluate the sign expression until we
 			// find the final signer with a ed25519 key.
-			if err := evalExpr(d.Rules[sign], getDarc, ids...); err != nil {
+			if err := evalExprBudget(d.Rules[sign], getDarc, b, ids...); err != nil {
 				return false
 			}
 			return true
@@ -587,6 +665,9 @@ func evalExpr(expr expression.Expr, getDarc GetDarc, ids ...string) error {
 		return false
 	})
 	res, err := expression.Evaluate(Y, expr)
+	if b.err() != nil {
+		return b.err()
+	}
 	if err != nil {
 		return fmt.Errorf("evaluation failed on '%s' with error: %v", expr, err)
 	}
@@ -604,6 +685,8 @@ func (s Signer) Type() int {
 		return 1
 	case s.X509EC != nil:
 		return 2
+	case s.PoP != nil:
+		return 4
 	default:
 		return -1
 	}
@@ -617,6 +700,8 @@ func (s Signer) Identity() Identity {
 		return NewIdentityEd25519(s.Ed25519.Point)
 	case 2:
 		return NewIdentityX509EC(s.X509EC.Point)
+	case 4:
+		return NewIdentityPoP(s.PoP.Party, s.PoP.Point)
 	default:
 		return Identity{}
 	}
@@ -634,6 +719,8 @@ func (s Signer) Sign(msg []byte) ([]byte, error) {
 		return s.Ed25519.Sign(msg)
 	case 2:
 		return s.X509EC.Sign(msg)
+	case 4:
+		return s.PoP.Sign(msg)
 	default:
 		return nil, errors.New("unknown signer type")
 	}
@@ -644,6 +731,8 @@ func (s Signer) GetPrivate() (kyber.Scalar, error) {
 	switch s.Type() {
 	case 1:
 		return s.Ed25519.Secret, nil
+	case 4:
+		return s.PoP.Secret, nil
 	case 0, 2:
 		return nil, errors.New("signer lacks a private key")
 	default:
@@ -664,6 +753,10 @@ func (id Identity) Equal(id2 *Identity) bool {
 		return id.Ed25519.Equal(id2.Ed25519)
 	case 2:
 		return id.X509EC.Equal(id2.X509EC)
+	case 3:
+		return id.ChainDarc.Equal(id2.ChainDarc)
+	case 4:
+		return id.PoP.Equal(id2.PoP)
 	}
 	return false
 }
@@ -678,6 +771,10 @@ func (id Identity) Type() int {
 		return 1
 	case id.X509EC != nil:
 		return 2
+	case id.ChainDarc != nil:
+		return 3
+	case id.PoP != nil:
+		return 4
 	}
 	return -1
 }
@@ -691,6 +788,10 @@ func (id Identity) TypeString() string {
 		return "ed25519"
 	case 2:
 		return "x509ec"
+	case 3:
+		return "chaindarc"
+	case 4:
+		return "pop"
 	default:
 		return "No identity"
 	}
@@ -705,6 +806,12 @@ func (id Identity) String() string {
 		return fmt.Sprintf("%s:%s", id.TypeString(), id.Ed25519.Point.String())
 	case 2:
 		return fmt.Sprintf("%s:%x", id.TypeString(), id.X509EC.Public)
+	case 3:
+		return fmt.Sprintf("%s:%x%x", id.TypeString(), id.ChainDarc.SkipchainID, id.ChainDarc.BaseID)
+	case 4:
+		// All token holders of a party have the same string, so that
+		// an expression can refer to them.
+		return fmt.Sprintf("%s:%x", id.TypeString(), id.PoP.Party)
 	default:
 		return "No identity"
 	}
@@ -714,12 +821,14 @@ func (id Identity) String() string {
 // went wrong.
 func (id Identity) Verify(msg, sig []byte) error {
 	switch id.Type() {
-	case 0:
+	case 0, 3:
 		return errors.New("cannot verify a darc-signature")
 	case 1:
 		return id.Ed25519.Verify(msg, sig)
 	case 2:
 		return id.X509EC.Verify(msg, sig)
+	case 4:
+		return id.PoP.Verify(msg, sig)
 	default:
 		return errors.New("unknown identity")
 	}
@@ -739,6 +848,77 @@ func (idd IdentityDarc) Equal(idd2 *IdentityDarc) bool {
 	return bytes.Equal(idd.ID, idd2.ID)
 }
 
+// NewIdentityChainDarc creates a new identity pointing to the darc with the
+// given base ID that is stored on the skipchain with the given ID.
+func NewIdentityChainDarc(scID []byte, baseID ID) Identity {
+	return Identity{
+		ChainDarc: &IdentityChainDarc{
+			SkipchainID: scID,
+			BaseID:      baseID,
+		},
+	}
+}
+
+// Equal returns true if both IdentityChainDarcs point to the same data.
+func (idc IdentityChainDarc) Equal(idc2 *IdentityChainDarc) bool {
+	return bytes.Equal(idc.SkipchainID, idc2.SkipchainID) &&
+		bytes.Equal(idc.BaseID, idc2.BaseID)
+}
+
+// ParseIdentityChainDarc parses the output of IdentityChainDarc.String(),
+// i.e., "chaindarc:" followed by the hex encoding of the skipchain ID and the
+// base ID of the darc. The base ID is always the last 32 bytes.
+func ParseIdentityChainDarc(s string) (*IdentityChainDarc, error) {
+	if !strings.HasPrefix(s, "chaindarc:") {
+		return nil, errors.New("not a chaindarc identity")
+	}
+	buf, err := hex.DecodeString(s[len("chaindarc:"):])
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) <= sha256.Size {
+		return nil, errors.New("chaindarc identity is too short")
+	}
+	split := len(buf) - sha256.Size
+	return &IdentityChainDarc{
+		SkipchainID: buf[:split],
+		BaseID:      buf[split:],
+	}, nil
+}
+
+// ParseIdentity is the inverse of Identity.String for the darc, ed25519,
+// x509ec and chaindarc identities.
+func ParseIdentity(s string) (Identity, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return Identity{}, fmt.Errorf("invalid identity %s", s)
+	}
+	if parts[0] == "chaindarc" {
+		idc, err := ParseIdentityChainDarc(s)
+		if err != nil {
+			return Identity{}, err
+		}
+		return Identity{ChainDarc: idc}, nil
+	}
+	buf, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return Identity{}, fmt.Errorf("identity %s is not hex encoded", s)
+	}
+	switch parts[0] {
+	case "darc":
+		return NewIdentityDarc(ID(buf)), nil
+	case "ed25519":
+		p := cothority.Suite.Point()
+		if err = p.UnmarshalBinary(buf); err != nil {
+			return Identity{}, fmt.Errorf("invalid ed25519 key: %v", err)
+		}
+		return NewIdentityEd25519(p), nil
+	case "x509ec":
+		return NewIdentityX509EC(buf), nil
+	}
+	return Identity{}, fmt.Errorf("identities of type %s can't be parsed", parts[0])
+}
+
 // NewIdentityEd25519 creates a new Ed25519 identity struct given a point.
 func NewIdentityEd25519(point kyber.Point) Identity {
 	return Identity{
@@ -773,6 +953,29 @@ func (idkc IdentityX509EC) Equal(idkc2 *IdentityX509EC) bool {
 	return bytes.Compare(idkc.Public, idkc2.Public) == 0
 }
 
+// NewIdentityPoP creates a new identity of the holder of the pop-token with
+// the given public key, issued for the party with the given final statement
+// hash.
+func NewIdentityPoP(party []byte, public kyber.Point) Identity {
+	return Identity{
+		PoP: &IdentityPoP{
+			Party:  party,
+			Public: public,
+		},
+	}
+}
+
+// Equal returns true if both IdentityPoP point to the same data.
+func (idp IdentityPoP) Equal(idp2 *IdentityPoP) bool {
+	return bytes.Equal(idp.Party, idp2.Party) && idp.Public.Equal(idp2.Public)
+}
+
+// Verify returns nil if the signature is correct, or an error if something
+// fails. It doesn't check whether the token has been issued for the party.
+func (idp IdentityPoP) Verify(msg, sig []byte) error {
+	return schnorr.Verify(cothority.Suite, idp.Public, msg, sig)
+}
+
 type sigRS struct {
 	R *big.Int
 	S *big.Int
@@ -816,15 +1019,98 @@ func (eds SignerEd25519) Sign(msg []byte) ([]byte, error) {
 	return schnorr.Sign(cothority.Suite, eds.Secret, msg)
 }
 
-// Hash computes the digest of the request, the identities and signatures are
-// not included.
+// Hash computes the digest of the request, the signatures are not included.
+// The way the digest is computed depends on the version of the request:
+//
+//   - RequestVersionLegacy: sha256(BaseID | Action | Msg | Identities), where
+//     every identity is written using its string representation. The
+//     skipchain ID is ignored.
+//   - RequestVersion1: sha256 over the following fields, where every variable
+//     length field is prefixed with its length as a little-endian uint32:
+//     "darc.Request" | Version | SkipchainID | BaseID | Action | Msg |
+//     number of identities | Identities, again in their string
+//     representation.
+//   - RequestVersionHardware: HardwareDigest of the summary and of the hash
+//     of RequestVersion1 with the version set to RequestVersionHardware.
+//
+// Unknown versions are rejected by Request.VerifyWithCB.
 func (r Request) Hash() []byte {
+	switch r.Version {
+	case RequestVersionLegacy:
+		h := sha256.New()
+		h.Write(r.BaseID)
+		h.Write([]byte(r.Action))
+		h.Write(r.Msg)
+		for _, i := range r.Identities {
+			h.Write([]byte(i.String()))
+		}
+		return h.Sum(nil)
+	case RequestVersionHardware:
+		return HardwareDigest(r.HardwarePayload())
+	default:
+		return r.hashFields()
+	}
+}
+
+// HardwarePayload returns what is sent to a hardware wallet to sign a
+// request of RequestVersionHardware: a human-readable summary and the 32-byte
+// hash of all fields. The first line of the summary has the action, the base
+// ID and the skipchain ID, and every detail of the request follows on its own
+// line. Characters that can't be shown are replaced with '?'. The wallet
+// shows the summary and signs the HardwareDigest of both, so the signature is
+// only valid for a request with the shown summary.
+func (r Request) HardwarePayload() (summary string, inner []byte) {
+	lines := []string{fmt.Sprintf("%s on darc %x of chain %x", r.Action,
+		[]byte(r.BaseID), r.SkipchainID)}
+	lines = append(lines, r.Details...)
+	for i, l := range lines {
+		line := []byte(l)
+		for j, c := range line {
+			if c < 0x20 || c > 0x7e {
+				line[j] = '?'
+			}
+		}
+		lines[i] = string(line)
+	}
+	return strings.Join(lines, "\n"), r.hashFields()
+}
+
+// HardwareDigest returns the digest a hardware wallet signs, from the summary
+// and the hash returned by Request.HardwarePayload:
+// sha256("darc.Request.hw" | summary | inner), where every field is prefixed
+// with its length as a little-endian uint32.
+func HardwareDigest(summary string, inner []byte) []byte {
 	h := sha256.New()
-	h.Write(r.BaseID)
-	h.Write([]byte(r.Action))
-	h.Write(r.Msg)
+	buf := make([]byte, 4)
+	for _, b := range [][]byte{[]byte("darc.Request.hw"), []byte(summary), inner} {
+		binary.LittleEndian.PutUint32(buf, uint32(len(b)))
+		h.Write(buf)
+		h.Write(b)
+	}
+	return h.Sum(nil)
+}
+
+// hashFields returns the hash of RequestVersion1.
+func (r Request) hashFields() []byte {
+	h := sha256.New()
+	buf := make([]byte, 4)
+	writeUint32 := func(i uint32) {
+		binary.LittleEndian.PutUint32(buf, i)
+		h.Write(buf)
+	}
+	writeBytes := func(b []byte) {
+		writeUint32(uint32(len(b)))
+		h.Write(b)
+	}
+	writeBytes([]byte("darc.Request"))
+	writeUint32(r.Version)
+	writeBytes(r.SkipchainID)
+	writeBytes(r.BaseID)
+	writeBytes([]byte(r.Action))
+	writeBytes(r.Msg)
+	writeUint32(uint32(len(r.Identities)))
 	for _, i := range r.Identities {
-		h.Write([]byte(i.String()))
+		writeBytes([]byte(i.String()))
 	}
 	return h.Sum(nil)
 }
@@ -910,6 +1196,21 @@ func InitAndSignRequest(baseID ID, action Action, msg []byte, signers ...Signer)
 	return &req, nil
 }
 
+// NewSignerPoP creates a new signer for the pop-token with the given keys
+// that has been issued for the party with the given final statement hash.
+func NewSignerPoP(party []byte, public kyber.Point, private kyber.Scalar) Signer {
+	return Signer{PoP: &SignerPoP{
+		Party:  party,
+		Point:  public,
+		Secret: private,
+	}}
+}
+
+// Sign creates a schnorr signature on the message.
+func (sp SignerPoP) Sign(msg []byte) ([]byte, error) {
+	return schnorr.Sign(cothority.Suite, sp.Secret, msg)
+}
+
 // NewSignerX509EC creates a new SignerX509EC - mostly for tests.
 func NewSignerX509EC() Signer {
 	return Signer{}
@@ -1,9 +1,15 @@
 package darc
 
 import (
+	"encoding/hex"
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/kyber/util/random"
 	"github.com/stretchr/testify/require"
 )
 
@@ -395,6 +401,73 @@ func TestDarc_DelegationChain(t *testing.T) {
 	require.Nil(t, td.darc.VerifyWithCB(getDarc, true))
 }
 
+// TestDarc_ChainDarc delegates the evolution of a darc to a darc stored on
+// another skipchain.
+func TestDarc_ChainDarc(t *testing.T) {
+	scID := random.Bits(256, true, random.New())
+	foreign := createDarc(1, "foreign")
+	require.Nil(t, foreign.darc.Rules.UpdateSign(foreign.darc.Rules.GetEvolutionExpr()))
+	id := NewIdentityChainDarc(scID, foreign.darc.GetBaseID())
+	idc, err := ParseIdentityChainDarc(id.String())
+	require.Nil(t, err)
+	require.True(t, id.ChainDarc.Equal(idc))
+	_, err = ParseIdentityChainDarc(NewIdentityDarc(foreign.darc.GetBaseID()).String())
+	require.NotNil(t, err)
+
+	local := createDarc(1, "local")
+	require.Nil(t, local.darc.Rules.UpdateEvolution([]byte(id.String())))
+	getDarc := func(s string, latest bool) *Darc {
+		if s == id.String() {
+			return foreign.darc
+		}
+		return nil
+	}
+	td := createDarc(1, "new")
+	require.Nil(t, localEvolution(td.darc, local.darc, local.owners[0]))
+	require.NotNil(t, td.darc.VerifyWithCB(getDarc, true))
+	require.Nil(t, localEvolution(td.darc, local.darc, foreign.owners[0]))
+	require.Nil(t, td.darc.VerifyWithCB(getDarc, true))
+}
+
+// TestDarc_PoP signs a request with a pop-token. All tokens of a party
+// satisfy the same expression.
+func TestDarc_PoP(t *testing.T) {
+	party := random.Bits(256, true, random.New())
+	kp := key.NewKeyPair(cothority.Suite)
+	signer := NewSignerPoP(party, kp.Public, kp.Private)
+	id := signer.Identity()
+	require.Equal(t, "pop:"+hex.EncodeToString(party), id.String())
+	other := NewIdentityPoP(party, key.NewKeyPair(cothority.Suite).Public)
+	require.Equal(t, id.String(), other.String())
+	require.False(t, id.Equal(&other))
+
+	d := NewDarc(InitRules([]Identity{createIdentity()}, []Identity{}), []byte("pop"))
+	require.Nil(t, d.Rules.AddRule("use", []byte(id.String())))
+	r, err := InitAndSignRequest(d.GetBaseID(), "use", []byte("msg"), signer)
+	require.Nil(t, err)
+	require.Nil(t, r.Verify(d))
+	r.Identities[0] = other
+	require.NotNil(t, r.Verify(d))
+}
+
+func TestParseIdentity(t *testing.T) {
+	ids := []Identity{
+		createIdentity(),
+		NewIdentityDarc(random.Bits(256, true, random.New())),
+		NewIdentityX509EC([]byte{1, 2, 3}),
+		NewIdentityChainDarc(random.Bits(256, true, random.New()), random.Bits(256, true, random.New())),
+	}
+	for _, id := range ids {
+		parsed, err := ParseIdentity(id.String())
+		require.Nil(t, err)
+		require.True(t, id.Equal(&parsed), id.String())
+	}
+	for _, s := range []string{"ed25519", "ed25519:xyz", "ed25519:1234", "pop:1234"} {
+		_, err := ParseIdentity(s)
+		require.NotNil(t, err, s)
+	}
+}
+
 func TestDarc_X509(t *testing.T) {
 	// TODO
 }
@@ -451,3 +524,46 @@ func localEvolution(newDarc *Darc, oldDarc *Darc, signers ...Signer) error {
 	newDarc.VerificationDarcs = append(oldDarc.VerificationDarcs, oldDarc)
 	return nil
 }
+
+func TestRequest_Hardware(t *testing.T) {
+	signer := NewSignerEd25519(nil, nil)
+	id := signer.Identity()
+	d := NewDarc(InitRules([]Identity{id}, []Identity{id}), []byte("hardware"))
+	require.Nil(t, d.Rules.AddRule("spawn:value", []byte(id.String())))
+
+	r := InitRequest(d.GetBaseID(), "spawn:value", []byte("msg"), []Identity{id}, nil)
+	r.Version = RequestVersionHardware
+	r.SkipchainID = []byte{1, 2, 3, 4, 5}
+	summary, inner := r.HardwarePayload()
+	require.Equal(t, fmt.Sprintf("spawn:value on darc %x of chain 0102030405", d.GetBaseID()), summary)
+	require.Equal(t, 32, len(inner))
+	digest := HardwareDigest(summary, inner)
+	require.Equal(t, digest, r.Hash())
+	sig, err := signer.Sign(digest)
+	require.Nil(t, err)
+	r.Signatures = [][]byte{sig}
+	require.Nil(t, r.Verify(d))
+
+	// The signature doesn't match another summary or another version.
+	require.NotEqual(t, digest, HardwareDigest("spawn:coin", inner))
+	r.Version = RequestVersion1
+	require.NotNil(t, r.Verify(d))
+	r.Version = RequestVersionHardware + 1
+	require.NotNil(t, r.Verify(d))
+
+	// The details are shown on their own lines and bound to the signature.
+	r.Version = RequestVersionHardware
+	r.Details = []string{"value: \"one\"", "amount: 2"}
+	summary, _ = r.HardwarePayload()
+	require.Equal(t, fmt.Sprintf("spawn:value on darc %x of chain 0102030405\nvalue: \"one\"\namount: 2",
+		d.GetBaseID()), summary)
+	require.NotNil(t, r.Verify(d))
+
+	// Characters that can't be shown are replaced, nothing is truncated.
+	long := strings.Repeat("a", 100)
+	r.Action = Action("spawn:\x00" + long)
+	r.Details = []string{"\nvalue"}
+	summary, _ = r.HardwarePayload()
+	require.True(t, strings.HasPrefix(summary, "spawn:?"+long+" on darc"))
+	require.True(t, strings.HasSuffix(summary, "\n?value"))
+}
@@ -0,0 +1,148 @@
+package expression
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MaxSize is the maximum length in bytes of an expression that is accepted
+// by Validate.
+const MaxSize = 16 * 1024
+
+// MaxDepth is the maximum nesting of parentheses that is accepted by
+// Validate.
+const MaxDepth = 32
+
+// SyntaxError is returned by Validate if the expression is malformed. Offset
+// is the position in bytes in the expression where the error has been
+// detected.
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// Validate checks that expr follows the grammar described in the package
+// documentation and that it respects MaxSize and MaxDepth. On success it
+// returns the canonical form of the expression: operators are surrounded by
+// a single space and there is no whitespace anywhere else. The evaluation of
+// the canonical form is always the same as the evaluation of expr.
+// On failure a *SyntaxError is returned.
+func Validate(expr Expr) (Expr, error) {
+	if len(expr) > MaxSize {
+		return nil, &SyntaxError{MaxSize, fmt.Sprintf("expression is longer than %d bytes", MaxSize)}
+	}
+	v := validator{expr: expr}
+	if err := v.sum(0); err != nil {
+		return nil, err
+	}
+	v.skipWS()
+	if v.pos != len(expr) {
+		return nil, v.errorf("unexpected character '%c'", expr[v.pos])
+	}
+	return Expr(v.out.Bytes()), nil
+}
+
+type validator struct {
+	expr Expr
+	pos  int
+	out  bytes.Buffer
+}
+
+func (v *validator) errorf(format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{v.pos, fmt.Sprintf(format, args...)}
+}
+
+func (v *validator) skipWS() {
+	for v.pos < len(v.expr) {
+		switch v.expr[v.pos] {
+		case ' ', '\t', '\n', '\r':
+			v.pos++
+		default:
+			return
+		}
+	}
+}
+
+// sum parses value, [ op, value ]*
+func (v *validator) sum(depth int) error {
+	if err := v.value(depth); err != nil {
+		return err
+	}
+	for {
+		v.skipWS()
+		if v.pos == len(v.expr) {
+			return nil
+		}
+		switch c := v.expr[v.pos]; c {
+		case '&', '|':
+			v.out.WriteString(" " + string(c) + " ")
+			v.pos++
+		default:
+			return nil
+		}
+		if err := v.value(depth); err != nil {
+			return err
+		}
+	}
+}
+
+// value parses id | '(', sum, ')'
+func (v *validator) value(depth int) error {
+	v.skipWS()
+	if v.pos == len(v.expr) {
+		return v.errorf("unexpected end of expression")
+	}
+	if v.expr[v.pos] != '(' {
+		return v.id()
+	}
+	if depth >= MaxDepth {
+		return v.errorf("expression is nested deeper than %d", MaxDepth)
+	}
+	v.out.WriteByte('(')
+	v.pos++
+	if err := v.sum(depth + 1); err != nil {
+		return err
+	}
+	if v.pos == len(v.expr) || v.expr[v.pos] != ')' {
+		return v.errorf("missing closing parenthesis")
+	}
+	v.out.WriteByte(')')
+	v.pos++
+	return nil
+}
+
+// id parses [0-9a-z]+, ':', [0-9a-f]+
+func (v *validator) id() error {
+	start := v.pos
+	for v.pos < len(v.expr) && isTypeChar(v.expr[v.pos]) {
+		v.pos++
+	}
+	if v.pos == start {
+		return v.errorf("expected identity or '(' but got '%c'", v.expr[v.pos])
+	}
+	if v.pos == len(v.expr) || v.expr[v.pos] != ':' {
+		return v.errorf("missing ':' in identity")
+	}
+	v.pos++
+	hexStart := v.pos
+	for v.pos < len(v.expr) && isHexChar(v.expr[v.pos]) {
+		v.pos++
+	}
+	if v.pos == hexStart {
+		return v.errorf("identity needs a hexadecimal value after ':'")
+	}
+	v.out.Write(v.expr[start:v.pos])
+	return nil
+}
+
+func isTypeChar(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z')
+}
+
+func isHexChar(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')
+}
@@ -0,0 +1,59 @@
+package expression
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct{ in, out string }{
+		{"a:abc", "a:abc"},
+		{" a:abc&b:bb ", "a:abc & b:bb"},
+		{"( a:a |b:b)\n& (c:c)", "(a:a | b:b) & (c:c)"},
+	} {
+		out, err := Validate(Expr(c.in))
+		require.Nil(t, err)
+		require.Equal(t, c.out, string(out))
+		// the canonical form must evaluate like the original one
+		v1, err := DefaultParser(Expr(c.in), "a:abc", "c:c")
+		require.Nil(t, err)
+		v2, err := DefaultParser(out, "a:abc", "c:c")
+		require.Nil(t, err)
+		require.Equal(t, v1, v2)
+	}
+}
+
+func TestValidate_Errors(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		offset int
+	}{
+		{"", 0},
+		{"a:abg", 4},
+		{"a:abc &", 7},
+		{"(a:abc", 6},
+		{"a:abc)", 5},
+		{"A:abc", 0},
+		{"a abc", 1},
+		{"a:", 2},
+		{"a:a && b:b", 5},
+	} {
+		_, err := Validate(Expr(c.in))
+		require.NotNil(t, err, c.in)
+		require.Equal(t, c.offset, err.(*SyntaxError).Offset, c.in)
+	}
+}
+
+func TestValidate_Limits(t *testing.T) {
+	deep := strings.Repeat("(", MaxDepth) + "a:a" + strings.Repeat(")", MaxDepth)
+	_, err := Validate(Expr(deep))
+	require.Nil(t, err)
+	_, err = Validate(Expr("(" + deep + ")"))
+	require.NotNil(t, err)
+
+	long := Expr(strings.Repeat("a:a | ", MaxSize/6+1) + "a:a")
+	_, err = Validate(long)
+	require.NotNil(t, err)
+}
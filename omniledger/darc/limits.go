@@ -0,0 +1,103 @@
+package darc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dedis/cothority/omniledger/darc/expression"
+)
+
+// DefaultLimits are used when no other limits are given. An ed25519 identity
+// takes 72 bytes, so MaxIdentities of them joined with " | " fit in
+// MaxExprLen.
+var DefaultLimits = Limits{
+	MaxExprLen:    8192,
+	MaxIdentities: 100,
+	MaxSteps:      1000,
+}
+
+// Check returns an error if one of the limits is not positive.
+func (l Limits) Check() error {
+	if l.MaxExprLen <= 0 || l.MaxIdentities <= 0 || l.MaxSteps <= 0 {
+		return errors.New("the limits of the darcs must be positive")
+	}
+	return nil
+}
+
+// CheckExpr returns an error if the expression is longer or has more
+// identities than allowed by the limits.
+func (l Limits) CheckExpr(expr expression.Expr) error {
+	if l.MaxExprLen > 0 && len(expr) > l.MaxExprLen {
+		return fmt.Errorf("expression of %d bytes, the limit is %d", len(expr), l.MaxExprLen)
+	}
+	if n := countIdentities(expr); l.MaxIdentities > 0 && n > l.MaxIdentities {
+		return fmt.Errorf("expression with %d identities, the limit is %d", n, l.MaxIdentities)
+	}
+	return nil
+}
+
+// CheckLimits returns an error if an expression of the rules is not within
+// the limits l. The expressions that are the same in old, the rules of the
+// previous version of the darc, are not checked, so that the darcs created
+// before the limits can still be evolved.
+func (r Rules) CheckLimits(l Limits, old Rules) error {
+	for a, expr := range r {
+		if oldExpr, ok := old[a]; ok && bytes.Equal(oldExpr, expr) {
+			continue
+		}
+		if err := l.CheckExpr(expr); err != nil {
+			return fmt.Errorf("invalid expression for action '%v': %v", a, err)
+		}
+	}
+	return nil
+}
+
+// EvalExprWithLimits is like EvalExpr, but it fails once more than
+// l.MaxSteps identities have been evaluated, including the ones of the
+// delegated darcs. The size of the expressions is checked when the darcs are
+// stored, so that the darcs stored before the limits can still be used.
+func EvalExprWithLimits(expr expression.Expr, getDarc GetDarc, l Limits, ids ...string) error {
+	return evalExprBudget(expr, getDarc, &budget{limits: l}, ids...)
+}
+
+// countIdentities returns the number of identities in expr, without parsing
+// it.
+func countIdentities(expr expression.Expr) int {
+	return len(strings.FieldsFunc(string(expr), func(r rune) bool {
+		return r == '&' || r == '|' || r == '(' || r == ')' ||
+			r == ' ' || r == '\t' || r == '\n'
+	}))
+}
+
+// budget counts the steps of an evaluation. A nil budget has no limits.
+type budget struct {
+	limits   Limits
+	steps    int
+	exceeded error
+}
+
+// step takes a step of the budget, or returns false if there is none left.
+func (b *budget) step() bool {
+	if b == nil {
+		return true
+	}
+	if b.exceeded != nil {
+		return false
+	}
+	b.steps++
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		b.exceeded = fmt.Errorf("the evaluation took more than %d steps", b.limits.MaxSteps)
+		return false
+	}
+	return true
+}
+
+// err returns why the evaluation has been stopped, if it has.
+func (b *budget) err() error {
+	if b == nil {
+		return nil
+	}
+	return b.exceeded
+}
@@ -0,0 +1,75 @@
+package darc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits_CheckExpr(t *testing.T) {
+	l := Limits{MaxExprLen: 40, MaxIdentities: 2, MaxSteps: 10}
+	require.Nil(t, l.Check())
+	require.NotNil(t, Limits{MaxExprLen: 1}.Check())
+
+	require.Nil(t, l.CheckExpr(expression.Expr("ed25519:aa | (ed25519:bb)")))
+	require.NotNil(t, l.CheckExpr(expression.InitOrExpr("ed25519:aa", "ed25519:bb", "ed25519:cc")))
+	require.NotNil(t, l.CheckExpr(expression.Expr("ed25519:"+strings.Repeat("a", 40))))
+
+	rules := make(Rules)
+	require.Nil(t, rules.AddRule("spawn:test", expression.Expr("ed25519:aa")))
+	require.Nil(t, rules.CheckLimits(l, nil))
+	require.Nil(t, rules.AddRule("invoke:test", expression.InitAndExpr("a:1", "b:2", "c:3")))
+	require.NotNil(t, rules.CheckLimits(l, nil))
+	require.Nil(t, Limits{}.CheckExpr(rules["invoke:test"]))
+
+	// The expressions of the previous version are grandfathered.
+	old := Rules{"spawn:test": rules["spawn:test"], "invoke:test": rules["invoke:test"]}
+	require.Nil(t, rules.CheckLimits(l, old))
+	require.Nil(t, rules.UpdateRule("invoke:test", expression.InitAndExpr("a:1", "b:2", "c:4")))
+	require.NotNil(t, rules.CheckLimits(l, old))
+
+	// The default limits accept as many ed25519 identities as they allow.
+	var ids []string
+	for i := 0; i < DefaultLimits.MaxIdentities; i++ {
+		ids = append(ids, NewSignerEd25519(nil, nil).Identity().String())
+	}
+	require.Nil(t, DefaultLimits.CheckExpr(expression.InitOrExpr(ids...)))
+}
+
+func TestLimits_Eval(t *testing.T) {
+	td := createDarc(1, "limits")
+	id := td.ids[0].String()
+	l := Limits{MaxExprLen: 1000, MaxIdentities: 10, MaxSteps: 10}
+	require.Nil(t, EvalExprWithLimits(expression.Expr(id), nil, l, id))
+
+	// Two darcs that delegate their sign rule to each other never end
+	// without a budget.
+	a := createDarc(1, "a").darc
+	b := createDarc(1, "b").darc
+	require.Nil(t, a.Rules.UpdateSign(expression.Expr("darc:bb")))
+	require.Nil(t, b.Rules.UpdateSign(expression.Expr("darc:aa | darc:bb")))
+	getDarc := func(s string, latest bool) *Darc {
+		switch s {
+		case "darc:aa":
+			return a
+		case "darc:bb":
+			return b
+		}
+		return nil
+	}
+	err := EvalExprWithLimits(expression.Expr("darc:aa"), getDarc, l, id)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "steps")
+
+	// The size of the stored expressions is not checked, so that the darcs
+	// stored before the limits can still be used, but the steps are.
+	require.Nil(t, b.Rules.UpdateSign(expression.InitOrExpr("a:1", "b:2", id)))
+	l.MaxIdentities = 2
+	require.Nil(t, EvalExprWithLimits(expression.Expr("darc:bb"), getDarc, l, id))
+	l.MaxSteps = 3
+	err = EvalExprWithLimits(expression.Expr("darc:bb"), getDarc, l, id)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "steps")
+}
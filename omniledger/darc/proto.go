@@ -61,6 +61,10 @@ type Identity struct {
 	Ed25519 *IdentityEd25519
 	// Public-key identity
 	X509EC *IdentityX509EC
+	// Darc identity on another skipchain
+	ChainDarc *IdentityChainDarc
+	// Holder of a pop-token of a party
+	PoP *IdentityPoP
 }
 
 // IdentityEd25519 holds a Ed25519 public key (Point)
@@ -80,6 +84,27 @@ type IdentityDarc struct {
 	ID ID
 }
 
+// IdentityChainDarc is a structure that points to a Darc stored on a
+// different skipchain. It allows a darc on one chain to delegate to a darc
+// managed on another chain, e.g., a consortium chain.
+type IdentityChainDarc struct {
+	// SkipchainID is the genesis ID of the skipchain that stores the darc.
+	SkipchainID []byte
+	// BaseID is the base ID of the darc on the foreign skipchain.
+	BaseID ID
+}
+
+// IdentityPoP is the identity of the holder of a pop-token of a
+// proof-of-personhood party. The signature only proves that the signer holds
+// the private key of Public, the verifier must check that the token has been
+// issued to an attendee of the party.
+type IdentityPoP struct {
+	// Party is the hash of the final statement of the party.
+	Party []byte
+	// Public is the public key of the token.
+	Public kyber.Point
+}
+
 // Signature is a signature on a Darc to accept a given decision.
 // can be verified using the appropriate identity.
 type Signature struct {
@@ -93,6 +118,7 @@ type Signature struct {
 type Signer struct {
 	Ed25519 *SignerEd25519
 	X509EC  *SignerX509EC
+	PoP     *SignerPoP
 }
 
 // SignerEd25519 holds a public and private keys necessary to sign Darcs
@@ -108,6 +134,14 @@ type SignerX509EC struct {
 	secret []byte
 }
 
+// SignerPoP holds the keys of a pop-token and the party it has been issued
+// for.
+type SignerPoP struct {
+	Party  []byte
+	Point  kyber.Point
+	Secret kyber.Scalar
+}
+
 // Request is the structure that the client must provide to be verified
 type Request struct {
 	BaseID     ID
@@ -115,4 +149,27 @@ type Request struct {
 	Msg        []byte
 	Identities []Identity
 	Signatures [][]byte
+	// Version indicates how the request is hashed, see Request.Hash.
+	Version uint32
+	// SkipchainID is included in the hash starting with RequestVersion1,
+	// so that a request cannot be replayed on another skipchain.
+	SkipchainID []byte
+	// Details are the lines that describe Msg in the summary of
+	// RequestVersionHardware, for example the arguments of an instruction.
+	// The verifier must derive them from the message itself, so that the
+	// signature only matches the shown details.
+	Details []string `protobuf:"opt"`
+}
+
+// Limits bound the work needed to evaluate the rules of the darcs, so that an
+// identity that has been granted a rule can't write an expression that stalls
+// the verification of the requests. A zero field doesn't bound anything.
+type Limits struct {
+	// MaxExprLen is the maximum length of an expression in bytes.
+	MaxExprLen int
+	// MaxIdentities is the maximum number of identities in an expression.
+	MaxIdentities int
+	// MaxSteps is the maximum number of identities that are evaluated to
+	// verify one request, including the ones of the delegated darcs.
+	MaxSteps int
 }
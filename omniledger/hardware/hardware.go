@@ -0,0 +1,76 @@
+// Package hardware signs omniledger instructions with hardware wallets, so
+// that the keys of darc owners never leave the device.
+//
+// The instructions must be signed with darc.RequestVersionHardware: the
+// device gets a summary of every instruction and the hash of all its fields.
+// The summary has the action, the full IDs of the darc and of the skipchain,
+// the instance and the arguments, where large arguments are only shown by
+// their size and hash. The device shows the summary to the user and, once the
+// user confirms, signs the darc.HardwareDigest of both with its Ed25519 key.
+// The nodes compute the summary from the instruction they verify, so the
+// signature is only valid for an instruction with the shown summary. The
+// device can't check what the arguments mean: the user must compare them with
+// the expected ones, and a host that chooses large arguments can only be
+// detected by their hash.
+//
+// Devices are connected over USB HID and speak APDUs framed like Ledger
+// devices, see HID.
+package hardware
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority/omniledger/client"
+	"github.com/dedis/cothority/omniledger/darc"
+)
+
+// ErrDenied is returned if the user refused to sign on the device.
+var ErrDenied = errors.New("denied on the device")
+
+// Device is a hardware wallet holding an Ed25519 key.
+type Device interface {
+	// Identity returns the identity of the key of the device.
+	Identity() (darc.Identity, error)
+	// Sign shows the summary to the user and returns the signature of
+	// darc.HardwareDigest(summary, inner) once the user confirmed.
+	Sign(summary string, inner []byte) ([]byte, error)
+}
+
+// SignTransaction signs all instructions of u with the device. The
+// instructions must use darc.RequestVersionHardware and the device must be
+// one of their signers.
+func SignTransaction(dev Device, u *client.UnsignedTransaction) error {
+	id, err := dev.Identity()
+	if err != nil {
+		return err
+	}
+	for i := range u.Transaction.Instructions {
+		instr := &u.Transaction.Instructions[i]
+		req, err := instr.ToDarcRequest(u.SkipchainID)
+		if err != nil {
+			return err
+		}
+		if req.Version != darc.RequestVersionHardware {
+			return fmt.Errorf("instruction %d is not signed with the hardware version", i)
+		}
+		slot := -1
+		for j, sig := range instr.Signatures {
+			if sig.Signer.Equal(&id) {
+				slot = j
+			}
+		}
+		if slot < 0 {
+			return fmt.Errorf("%s is not a signer of instruction %d", id, i)
+		}
+		sig, err := dev.Sign(req.HardwarePayload())
+		if err != nil {
+			return err
+		}
+		if err = id.Verify(req.Hash(), sig); err != nil {
+			return errors.New("the device returned an invalid signature")
+		}
+		instr.Signatures[slot].Signature = sig
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package hardware
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/dedis/cothority/omniledger/client"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDevice answers the APDUs written to it like the app of a device with
+// the key of signer.
+type fakeDevice struct {
+	signer  darc.Signer
+	deny    bool
+	shown   []string
+	request bytes.Buffer
+	chunks  [][]byte
+	answer  [][]byte
+	t       *testing.T
+}
+
+func (f *fakeDevice) Write(p []byte) (int, error) {
+	f.request.Write(p)
+	apdu, err := unframe(bytes.NewReader(f.request.Bytes()))
+	if err != nil {
+		// Wait for the next packet.
+		return len(p), nil
+	}
+	f.request.Reset()
+	require.Equal(f.t, byte(cla), apdu[0])
+	data := apdu[5:]
+	require.Equal(f.t, int(apdu[4]), len(data))
+	var resp []byte
+	sw := uint16(swOK)
+	switch apdu[1] {
+	case insGetPublicKey:
+		resp, err = f.signer.Ed25519.Point.MarshalBinary()
+		require.Nil(f.t, err)
+	case insSign:
+		require.Equal(f.t, len(f.chunks), int(apdu[2]))
+		f.chunks = append(f.chunks, data)
+		if apdu[3] == 1 {
+			break
+		}
+		data = bytes.Join(f.chunks, nil)
+		f.chunks = nil
+		n := 2 + int(binary.BigEndian.Uint16(data))
+		summary := string(data[2:n])
+		f.shown = append(f.shown, summary)
+		if f.deny {
+			sw = swDenied
+			break
+		}
+		resp, err = f.signer.Sign(darc.HardwareDigest(summary, data[n:]))
+		require.Nil(f.t, err)
+	}
+	resp = append(resp, 0, 0)
+	binary.BigEndian.PutUint16(resp[len(resp)-2:], sw)
+	f.answer = append(f.answer, frame(resp)...)
+	return len(p), nil
+}
+
+func (f *fakeDevice) Read(p []byte) (int, error) {
+	n := copy(p, f.answer[0])
+	f.answer = f.answer[1:]
+	return n, nil
+}
+
+func TestSignTransaction(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	fake := &fakeDevice{signer: signer, t: t}
+	dev := NewHID(fake)
+	id, err := dev.Identity()
+	require.Nil(t, err)
+	require.Equal(t, signer.Identity().String(), id.String())
+
+	other := darc.NewSignerEd25519(nil, nil).Identity()
+	darcID := darc.ID(bytes.Repeat([]byte{0xaa}, 32))
+	u := &client.UnsignedTransaction{
+		Version:     client.UnsignedTransactionVersion,
+		SkipchainID: bytes.Repeat([]byte{0xbb}, 32),
+		Transaction: service.ClientTransaction{Instructions: service.Instructions{{
+			InstanceID: service.InstanceID{DarcID: darcID},
+			Nonce:      service.GenNonce(),
+			Length:     1,
+			Spawn: &service.Spawn{
+				ContractID: "value",
+				Args: service.Arguments{
+					{Name: "value", Value: []byte("hello")},
+					{Name: "data", Value: bytes.Repeat([]byte{0xcc}, 32)},
+				},
+			},
+			Signatures: []darc.Signature{{Signer: other}, {Signer: id}},
+		}}},
+	}
+	require.NotNil(t, SignTransaction(dev, u))
+	require.Nil(t, u.SetSignatureVersion(darc.RequestVersionHardware))
+
+	fake.deny = true
+	require.Equal(t, ErrDenied, SignTransaction(dev, u))
+	fake.deny = false
+	require.Nil(t, SignTransaction(dev, u))
+	// The summary is longer than an APDU and shows the arguments.
+	require.Equal(t, "spawn:value on darc "+strings.Repeat("aa", 32)+" of chain "+strings.Repeat("bb", 32)+
+		"\nvalue: \"hello\"\ndata: "+strings.Repeat("cc", 32), fake.shown[len(fake.shown)-1])
+	require.Equal(t, []darc.Identity{other}, u.Missing())
+	require.NotNil(t, u.SetSignatureVersion(darc.CurrentRequestVersion))
+
+	req, err := u.Transaction.Instructions[0].ToDarcRequest(u.SkipchainID)
+	require.Nil(t, err)
+	require.Nil(t, id.Verify(req.Hash(), u.Transaction.Instructions[0].Signatures[1].Signature))
+
+	// A device that isn't a signer is refused.
+	require.NotNil(t, SignTransaction(NewHID(&fakeDevice{signer: darc.NewSignerEd25519(nil, nil), t: t}), u))
+}
+
+func TestFrame(t *testing.T) {
+	msg := bytes.Repeat([]byte{1, 2, 3}, 100)
+	packets := frame(msg)
+	require.Equal(t, 6, len(packets))
+	var buf bytes.Buffer
+	for _, p := range packets {
+		require.Equal(t, packetSize, len(p))
+		buf.Write(p)
+	}
+	out, err := unframe(&buf)
+	require.Nil(t, err)
+	require.Equal(t, msg, out)
+
+	packets[1][4] = 5
+	buf.Reset()
+	for _, p := range packets {
+		buf.Write(p)
+	}
+	_, err = unframe(&buf)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,194 @@
+package hardware
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+)
+
+// The HID transport sends every APDU in reports of packetSize bytes: the
+// channel, the tag, the sequence number of the packet and, in the first
+// packet, the length of the APDU. The answer is framed the same way and ends
+// with the status word.
+const (
+	packetSize = 64
+	headerSize = 5
+	channel    = 0x0101
+	tagAPDU    = 0x05
+)
+
+// The APDUs of the omniledger app of the device.
+const (
+	cla             = 0xe0
+	insGetPublicKey = 0x02
+	insSign         = 0x04
+	swOK            = 0x9000
+	swDenied        = 0x6985
+)
+
+// maxData is the maximum size of the data of an APDU.
+const maxData = 255
+
+// maxSummary is the size of the longest summary that is sent to the device.
+const maxSummary = 4096
+
+// HID is a Device connected over USB HID.
+type HID struct {
+	rw io.ReadWriter
+	sync.Mutex
+}
+
+// Open opens the hidraw device at path, like /dev/hidraw0.
+func Open(path string) (*HID, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewHID(hidraw{f}), nil
+}
+
+// NewHID returns the device that reads and writes its reports on rw.
+func NewHID(rw io.ReadWriter) *HID {
+	return &HID{rw: rw}
+}
+
+// Close closes the connection to the device, if it can be closed.
+func (h *HID) Close() error {
+	if c, ok := h.rw.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Identity asks the device for its public key.
+func (h *HID) Identity() (darc.Identity, error) {
+	h.Lock()
+	defer h.Unlock()
+	buf, err := h.exchange(insGetPublicKey, 0, 0, nil)
+	if err != nil {
+		return darc.Identity{}, err
+	}
+	public := cothority.Suite.Point()
+	if err = public.UnmarshalBinary(buf); err != nil {
+		return darc.Identity{}, errors.New("invalid public key: " + err.Error())
+	}
+	return darc.NewIdentityEd25519(public), nil
+}
+
+// Sign sends the summary and the hash to the device, which shows the summary
+// and waits for the user to confirm. The data is the length of the summary
+// as a big-endian uint16, the summary and the hash. As it doesn't fit in one
+// APDU, it is sent in chunks: P1 is the index of the chunk and P2 is 1 if
+// more chunks follow. The device answers the last chunk with the signature.
+func (h *HID) Sign(summary string, inner []byte) ([]byte, error) {
+	if len(summary) > maxSummary {
+		return nil, errors.New("summary too long")
+	}
+	data := make([]byte, 2, 2+len(summary)+len(inner))
+	binary.BigEndian.PutUint16(data, uint16(len(summary)))
+	data = append(append(data, summary...), inner...)
+	h.Lock()
+	defer h.Unlock()
+	for chunk := 0; ; chunk++ {
+		n, more := len(data), byte(0)
+		if n > maxData {
+			n, more = maxData, 1
+		}
+		resp, err := h.exchange(insSign, byte(chunk), more, data[:n])
+		if err != nil || more == 0 {
+			return resp, err
+		}
+		data = data[n:]
+	}
+}
+
+// exchange sends an APDU and returns the data of the answer. The caller must
+// hold the lock.
+func (h *HID) exchange(ins, p1, p2 byte, data []byte) ([]byte, error) {
+	if len(data) > maxData {
+		return nil, errors.New("APDU too long")
+	}
+	apdu := append([]byte{cla, ins, p1, p2, byte(len(data))}, data...)
+	for _, packet := range frame(apdu) {
+		if _, err := h.rw.Write(packet); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := unframe(h.rw)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 {
+		return nil, errors.New("answer without status")
+	}
+	switch sw := binary.BigEndian.Uint16(resp[len(resp)-2:]); sw {
+	case swOK:
+		return resp[:len(resp)-2], nil
+	case swDenied:
+		return nil, ErrDenied
+	default:
+		return nil, fmt.Errorf("device returned status %#04x", sw)
+	}
+}
+
+// frame splits msg into the packets sent over HID.
+func frame(msg []byte) [][]byte {
+	buf := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	buf = append(buf, msg...)
+	var packets [][]byte
+	for seq := 0; len(buf) > 0; seq++ {
+		packet := make([]byte, packetSize)
+		binary.BigEndian.PutUint16(packet, channel)
+		packet[2] = tagAPDU
+		binary.BigEndian.PutUint16(packet[3:], uint16(seq))
+		n := copy(packet[headerSize:], buf)
+		buf = buf[n:]
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+// unframe reads packets from r until it has a whole message.
+func unframe(r io.Reader) ([]byte, error) {
+	var msg []byte
+	length := -1
+	for seq := 0; length < 0 || len(msg) < length; seq++ {
+		packet := make([]byte, packetSize)
+		n, err := r.Read(packet)
+		if err != nil {
+			return nil, err
+		}
+		if n < headerSize+2 || binary.BigEndian.Uint16(packet) != channel ||
+			packet[2] != tagAPDU || binary.BigEndian.Uint16(packet[3:]) != uint16(seq) {
+			return nil, errors.New("invalid packet")
+		}
+		data := packet[headerSize:n]
+		if seq == 0 {
+			length = int(binary.BigEndian.Uint16(data))
+			data = data[2:]
+		}
+		msg = append(msg, data...)
+	}
+	return msg[:length], nil
+}
+
+// hidraw writes the reports with the report ID 0, as the device doesn't
+// number its reports.
+type hidraw struct {
+	*os.File
+}
+
+func (h hidraw) Write(p []byte) (int, error) {
+	n, err := h.File.Write(append([]byte{0}, p...))
+	if n > 0 {
+		n--
+	}
+	return n, err
+}
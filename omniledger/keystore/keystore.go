@@ -0,0 +1,265 @@
+// Package keystore stores the private keys of darc signers, encrypted with
+// a password, so that tools and scripts can sign instructions without
+// handling the private keys themselves.
+//
+// Every key is stored in its own JSON file, which is also the format to
+// export and import keys:
+//
+//	{
+//	  "version": 1,
+//	  "identity": "ed25519:...",
+//	  "crypto": {
+//	    "cipher": "aes-256-gcm",
+//	    "ciphertext": "...",
+//	    "nonce": "...",
+//	    "kdf": "scrypt",
+//	    "salt": "...",
+//	    "n": 32768, "r": 8, "p": 1
+//	  }
+//	}
+//
+// The AES key is derived from the password with scrypt, and the identity is
+// authenticated together with the encrypted private key. All binary values
+// are hex encoded.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Version of the key files written by this package.
+const Version = 1
+
+const (
+	cipherName = "aes-256-gcm"
+	kdfName    = "scrypt"
+	scryptN    = 1 << 15
+	scryptR    = 8
+	scryptP    = 1
+)
+
+// Key is the private key of a signer, encrypted with a password.
+type Key struct {
+	Version  int    `json:"version"`
+	Identity string `json:"identity"`
+	Crypto   Crypto `json:"crypto"`
+}
+
+// Crypto holds the encrypted private key and what is needed to decrypt it.
+type Crypto struct {
+	Cipher     string `json:"cipher"`
+	Ciphertext string `json:"ciphertext"`
+	Nonce      string `json:"nonce"`
+	KDF        string `json:"kdf"`
+	Salt       string `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+}
+
+// Encrypt returns the key of the signer, encrypted with the password. Only
+// Ed25519 signers are supported.
+func Encrypt(signer darc.Signer, password []byte) (*Key, error) {
+	if signer.Ed25519 == nil {
+		return nil, errors.New("only ed25519 signers are supported")
+	}
+	secret, err := signer.Ed25519.Secret.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{
+		Version:  Version,
+		Identity: signer.Identity().String(),
+		Crypto: Crypto{
+			Cipher: cipherName,
+			KDF:    kdfName,
+			N:      scryptN,
+			R:      scryptR,
+			P:      scryptP,
+		},
+	}
+	salt := make([]byte, 32)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	k.Crypto.Salt = hex.EncodeToString(salt)
+	aead, err := k.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	k.Crypto.Nonce = hex.EncodeToString(nonce)
+	k.Crypto.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, secret, []byte(k.Identity)))
+	return k, nil
+}
+
+// Decrypt returns the signer of the key. It fails if the password is wrong
+// or if the key doesn't match the identity.
+func (k *Key) Decrypt(password []byte) (darc.Signer, error) {
+	if k.Version != Version {
+		return darc.Signer{}, fmt.Errorf("unknown key version %d", k.Version)
+	}
+	if k.Crypto.Cipher != cipherName || k.Crypto.KDF != kdfName {
+		return darc.Signer{}, errors.New("unknown cipher or key derivation")
+	}
+	aead, err := k.aead(password)
+	if err != nil {
+		return darc.Signer{}, err
+	}
+	nonce, err := hex.DecodeString(k.Crypto.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return darc.Signer{}, errors.New("invalid nonce")
+	}
+	ciphertext, err := hex.DecodeString(k.Crypto.Ciphertext)
+	if err != nil {
+		return darc.Signer{}, errors.New("invalid ciphertext")
+	}
+	secret, err := aead.Open(nil, nonce, ciphertext, []byte(k.Identity))
+	if err != nil {
+		return darc.Signer{}, errors.New("wrong password")
+	}
+	private := cothority.Suite.Scalar()
+	if err = private.UnmarshalBinary(secret); err != nil {
+		return darc.Signer{}, err
+	}
+	public := cothority.Suite.Point().Mul(private, nil)
+	signer := darc.NewSignerEd25519(public, private)
+	if signer.Identity().String() != k.Identity {
+		return darc.Signer{}, errors.New("the private key doesn't match the identity")
+	}
+	return signer, nil
+}
+
+// aead returns the cipher with the key derived from the password.
+func (k *Key) aead(password []byte) (cipher.AEAD, error) {
+	salt, err := hex.DecodeString(k.Crypto.Salt)
+	if err != nil {
+		return nil, errors.New("invalid salt")
+	}
+	key, err := scrypt.Key(password, salt, k.Crypto.N, k.Crypto.R, k.Crypto.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Store holds the key files in a directory.
+type Store struct {
+	dir string
+}
+
+// NewStore returns the store of the directory, which is created when the
+// first key is added.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Generate creates a new Ed25519 signer and adds it to the store.
+func (s *Store) Generate(password []byte) (darc.Signer, error) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	if err := s.Add(signer, password); err != nil {
+		return darc.Signer{}, err
+	}
+	return signer, nil
+}
+
+// Add encrypts the key of the signer with the password and stores it.
+func (s *Store) Add(signer darc.Signer, password []byte) error {
+	k, err := Encrypt(signer, password)
+	if err != nil {
+		return err
+	}
+	return s.write(k)
+}
+
+// Import stores a key file exported by Export. The password is not needed,
+// the key stays encrypted.
+func (s *Store) Import(buf []byte) (string, error) {
+	k := &Key{}
+	if err := json.Unmarshal(buf, k); err != nil {
+		return "", err
+	}
+	if k.Version != Version || !strings.HasPrefix(k.Identity, "ed25519:") {
+		return "", errors.New("not a key file")
+	}
+	return k.Identity, s.write(k)
+}
+
+// Export returns the key file of the identity.
+func (s *Store) Export(identity string) ([]byte, error) {
+	return ioutil.ReadFile(s.path(identity))
+}
+
+// Load decrypts the key of the identity with the password.
+func (s *Store) Load(identity string, password []byte) (darc.Signer, error) {
+	buf, err := s.Export(identity)
+	if err != nil {
+		return darc.Signer{}, err
+	}
+	k := &Key{}
+	if err = json.Unmarshal(buf, k); err != nil {
+		return darc.Signer{}, err
+	}
+	if k.Identity != identity {
+		return darc.Signer{}, errors.New("the key file holds another identity")
+	}
+	return k.Decrypt(password)
+}
+
+// List returns the sorted identities of the keys in the store.
+func (s *Store) List() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".json") {
+			ids = append(ids, strings.Replace(strings.TrimSuffix(f.Name(), ".json"), "-", ":", 1))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *Store) write(k *Key) error {
+	buf, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	// The file is only readable by the user, even if the key is encrypted.
+	return ioutil.WriteFile(s.path(k.Identity), buf, 0600)
+}
+
+// path returns the file of the identity, which must not contain a path.
+func (s *Store) path(identity string) string {
+	return filepath.Join(s.dir, strings.Replace(filepath.Base(identity), ":", "-", 1)+".json")
+}
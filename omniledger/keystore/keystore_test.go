@@ -0,0 +1,88 @@
+package keystore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	k, err := Encrypt(signer, []byte("secret"))
+	require.Nil(t, err)
+	require.Equal(t, signer.Identity().String(), k.Identity)
+
+	s, err := k.Decrypt([]byte("secret"))
+	require.Nil(t, err)
+	id := signer.Identity()
+	require.True(t, s.Identity().Equal(&id))
+	msg := []byte("message")
+	sig, err := s.Sign(msg)
+	require.Nil(t, err)
+	require.Nil(t, signer.Identity().Verify(msg, sig))
+
+	_, err = k.Decrypt([]byte("wrong"))
+	require.NotNil(t, err)
+
+	// The identity is authenticated.
+	k.Identity = darc.NewSignerEd25519(nil, nil).Identity().String()
+	_, err = k.Decrypt([]byte("secret"))
+	require.NotNil(t, err)
+
+	_, err = Encrypt(darc.Signer{}, []byte("secret"))
+	require.NotNil(t, err)
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s := NewStore(dir)
+	ids, err := s.List()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(ids))
+
+	signer, err := s.Generate([]byte("secret"))
+	require.Nil(t, err)
+	id := signer.Identity().String()
+	ids, err = s.List()
+	require.Nil(t, err)
+	require.Equal(t, []string{id}, ids)
+
+	loaded, err := s.Load(id, []byte("secret"))
+	require.Nil(t, err)
+	require.Equal(t, id, loaded.Identity().String())
+	_, err = s.Load(id, []byte("wrong"))
+	require.NotNil(t, err)
+	_, err = s.Load("ed25519:1234", []byte("secret"))
+	require.NotNil(t, err)
+
+	// The exported file doesn't hold the private key in clear.
+	buf, err := s.Export(id)
+	require.Nil(t, err)
+	secret, err := signer.Ed25519.Secret.MarshalBinary()
+	require.Nil(t, err)
+	require.NotContains(t, string(buf), string(secret))
+	k := &Key{}
+	require.Nil(t, json.Unmarshal(buf, k))
+	require.Equal(t, id, k.Identity)
+
+	dir2, err := ioutil.TempDir("", "keystore")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir2)
+	s2 := NewStore(dir2)
+	imported, err := s2.Import(buf)
+	require.Nil(t, err)
+	require.Equal(t, id, imported)
+	loaded, err = s2.Load(id, []byte("secret"))
+	require.Nil(t, err)
+	require.Equal(t, id, loaded.Identity().String())
+
+	_, err = s2.Import([]byte("{}"))
+	require.NotNil(t, err)
+}
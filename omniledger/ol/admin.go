@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// getClient returns the client of the OmniLedger config given by the ol
+// flag.
+func getClient(c *cli.Context) (*omniledger.Client, error) {
+	ol := c.String("ol")
+	if ol == "" {
+		return nil, errors.New("--ol flag is required")
+	}
+	return omniledger.NewClientFromConfig(ol)
+}
+
+// getSigner returns the signer given by the key flag, or the owner of the
+// ledger if the flag is not set. The key flag is either the identity of a key
+// in the keystore or a key file.
+func getSigner(c *cli.Context, cl *omniledger.Client) (darc.Signer, error) {
+	key := c.String("key")
+	if strings.HasPrefix(key, "ed25519:") {
+		password, err := getPassword(c)
+		if err != nil {
+			return darc.Signer{}, err
+		}
+		return getKeystore().Load(key, password)
+	}
+	var private *configPrivate
+	var err error
+	if key != "" {
+		private, err = loadPrivate(key)
+	} else {
+		private, err = loadKey(cl.OwnerID)
+	}
+	if err != nil {
+		return darc.Signer{}, err
+	}
+	return private.Owner, nil
+}
+
+// getDarcID returns the darc given by the darc flag, or the genesis darc if
+// the flag is not set.
+func getDarcID(c *cli.Context, cl *omniledger.Client) (darc.ID, error) {
+	if c.String("darc") == "" {
+		d, err := cl.GetGenDarc()
+		if err != nil {
+			return nil, err
+		}
+		return d.GetBaseID(), nil
+	}
+	id, err := hex.DecodeString(c.String("darc"))
+	if err != nil || len(id) != 32 {
+		return nil, errors.New("the darc ID must be 32 hex encoded bytes")
+	}
+	return darc.ID(id), nil
+}
+
+// parseInstanceID decodes the hex encoded instance ID.
+func parseInstanceID(s string) (omniledger.InstanceID, error) {
+	buf, err := hex.DecodeString(s)
+	if err != nil || len(buf) != 64 {
+		return omniledger.InstanceID{}, errors.New("the instance ID must be 64 hex encoded bytes")
+	}
+	return omniledger.NewInstanceID(buf), nil
+}
+
+// parseArgs decodes the arguments given as name=value, where the value is
+// hex encoded.
+func parseArgs(args []string) (omniledger.Arguments, error) {
+	var out omniledger.Arguments
+	for _, a := range args {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("argument %s is not of the form name=value", a)
+		}
+		value, err := hex.DecodeString(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("value of argument %s is not hex encoded", kv[0])
+		}
+		out = append(out, omniledger.Argument{Name: kv[0], Value: value})
+	}
+	return out, nil
+}
+
+// sendInstruction signs the instruction with the signer and waits for its
+// transaction to be accepted.
+func sendInstruction(cl *omniledger.Client, signer darc.Signer, inst *omniledger.Instruction) error {
+	inst.Nonce = omniledger.GenNonce()
+	inst.Index = 0
+	inst.Length = 1
+	if err := inst.SignWith(cl.ID, signer); err != nil {
+		return err
+	}
+	_, err := cl.AddTransactionAndWait(omniledger.ClientTransaction{
+		Instructions: omniledger.Instructions{*inst},
+	}, 10)
+	return err
+}
+
+// getDarc fetches the latest version of the darc and verifies its proof.
+func getDarc(cl *omniledger.Client, id darc.ID) (*darc.Darc, error) {
+	p, err := cl.GetProof(omniledger.InstanceID{DarcID: id}.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Proof.Verify(cl.ID); err != nil {
+		return nil, err
+	}
+	if !p.Proof.InclusionProof.Match() {
+		return nil, errors.New("darc not found")
+	}
+	_, vs, err := p.Proof.KeyValue()
+	if err != nil {
+		return nil, err
+	}
+	if len(vs) < 2 || string(vs[1]) != omniledger.ContractDarcID {
+		return nil, errors.New("the instance is not a darc")
+	}
+	return darc.NewFromProtobuf(vs[0])
+}
+
+// evolveDarc sends an evolution of the darc d, after changing its rules with
+// change.
+func evolveDarc(cl *omniledger.Client, signer darc.Signer, d *darc.Darc, change func(darc.Rules) error) error {
+	d2 := d.Copy()
+	if err := d2.EvolveFrom(d); err != nil {
+		return err
+	}
+	if err := change(d2.Rules); err != nil {
+		return err
+	}
+	d2Buf, err := d2.ToProto()
+	if err != nil {
+		return err
+	}
+	return sendInstruction(cl, signer, &omniledger.Instruction{
+		InstanceID: omniledger.InstanceID{DarcID: d2.GetBaseID()},
+		Invoke: &omniledger.Invoke{
+			Command: omniledger.CmdDarcEvolve,
+			Args:    omniledger.Arguments{{Name: "darc", Value: d2Buf}},
+		},
+	})
+}
+
+func darcShow(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	id, err := getDarcID(c, cl)
+	if err != nil {
+		return err
+	}
+	d, err := getDarc(cl, id)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, d)
+	return nil
+}
+
+func darcSpawn(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	signer, err := getSigner(c, cl)
+	if err != nil {
+		return err
+	}
+	parent, err := getDarcID(c, cl)
+	if err != nil {
+		return err
+	}
+	owner := c.String("owner")
+	if owner == "" {
+		return errors.New("--owner flag is required")
+	}
+
+	evolve := darc.Action("invoke:" + omniledger.CmdDarcEvolve)
+	rules := darc.InitRulesWith(nil, nil, evolve)
+	if err = rules.UpdateRule(evolve, expression.Expr(owner)); err != nil {
+		return err
+	}
+	if err = rules.UpdateSign(expression.Expr(owner)); err != nil {
+		return err
+	}
+	d := darc.NewDarc(rules, []byte(c.String("desc")))
+	dBuf, err := d.ToProto()
+	if err != nil {
+		return err
+	}
+	err = sendInstruction(cl, signer, &omniledger.Instruction{
+		InstanceID: omniledger.InstanceID{DarcID: parent},
+		Spawn: &omniledger.Spawn{
+			ContractID: omniledger.ContractDarcID,
+			Args:       omniledger.Arguments{{Name: "darc", Value: dBuf}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Spawned darc %x\n", d.GetBaseID())
+	return nil
+}
+
+func darcRule(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	signer, err := getSigner(c, cl)
+	if err != nil {
+		return err
+	}
+	id, err := getDarcID(c, cl)
+	if err != nil {
+		return err
+	}
+	action := darc.Action(c.String("rule"))
+	if action == "" {
+		return errors.New("--rule flag is required")
+	}
+	expr := expression.Expr(c.String("identity"))
+	if !c.Bool("delete") && len(expr) == 0 {
+		return errors.New("--identity flag is required")
+	}
+	d, err := getDarc(cl, id)
+	if err != nil {
+		return err
+	}
+	return evolveDarc(cl, signer, d, func(r darc.Rules) error {
+		switch {
+		case c.Bool("delete"):
+			return r.DeleteRules(action)
+		case r.Contains(action):
+			return r.UpdateRule(action, expr)
+		default:
+			return r.AddRule(action, expr)
+		}
+	})
+}
+
+func spawn(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	id, err := getDarcID(c, cl)
+	if err != nil {
+		return err
+	}
+	contract := c.String("contract")
+	if contract == "" {
+		return errors.New("--contract flag is required")
+	}
+	args, err := parseArgs(c.StringSlice("arg"))
+	if err != nil {
+		return err
+	}
+	inst := omniledger.Instruction{
+		InstanceID: omniledger.InstanceID{DarcID: id},
+		Spawn: &omniledger.Spawn{
+			ContractID: contract,
+			Args:       args,
+		},
+	}
+	if c.String("unsigned") != "" {
+		return writeUnsigned(c, cl, inst)
+	}
+	signer, err := getSigner(c, cl)
+	if err != nil {
+		return err
+	}
+	if err = sendInstruction(cl, signer, &inst); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Spawned instance %x\n", inst.DeriveID(contract).Slice())
+	return nil
+}
+
+func invoke(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	id, err := parseInstanceID(c.String("instance"))
+	if err != nil {
+		return err
+	}
+	command := c.String("command")
+	if command == "" {
+		return errors.New("--command flag is required")
+	}
+	args, err := parseArgs(c.StringSlice("arg"))
+	if err != nil {
+		return err
+	}
+	inst := omniledger.Instruction{
+		InstanceID: id,
+		Invoke: &omniledger.Invoke{
+			Command: command,
+			Args:    args,
+		},
+	}
+	if c.String("unsigned") != "" {
+		return writeUnsigned(c, cl, inst)
+	}
+	signer, err := getSigner(c, cl)
+	if err != nil {
+		return err
+	}
+	return sendInstruction(cl, signer, &inst)
+}
+
+func proof(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	id, err := parseInstanceID(c.String("instance"))
+	if err != nil {
+		return err
+	}
+	p, err := cl.GetProof(id.Slice())
+	if err != nil {
+		return err
+	}
+	if err = p.Proof.Verify(cl.ID); err != nil {
+		return errors.New("invalid proof: " + err.Error())
+	}
+	if !p.Proof.InclusionProof.Match() {
+		fmt.Fprintln(c.App.Writer, "The instance doesn't exist, the proof of absence is valid.")
+		return nil
+	}
+	_, vs, err := p.Proof.KeyValue()
+	if err != nil {
+		return err
+	}
+	if len(vs) < 2 {
+		return errors.New("not enough records")
+	}
+	fmt.Fprintf(c.App.Writer, "The proof is valid.\nContract: %s\nValue: %x\n", vs[1], vs[0])
+	return nil
+}
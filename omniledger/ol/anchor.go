@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/dedis/cothority/omniledger/anchor"
+	"github.com/dedis/cothority/omniledger/client"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// getPublisher returns the publisher of the external chain given by the
+// chain flag.
+func getPublisher(c *cli.Context) (anchor.Publisher, error) {
+	if c.String("rpc") == "" {
+		return nil, errors.New("--rpc flag is required")
+	}
+	switch c.String("chain") {
+	case "bitcoin":
+		b := anchor.NewBitcoin(c.String("rpc"), c.String("rpc-user"), c.String("rpc-password"))
+		b.Confirmations = c.Int("confirmations")
+		return b, nil
+	case "ethereum":
+		if c.String("from") == "" {
+			return nil, errors.New("--from flag is required for ethereum")
+		}
+		e := anchor.NewEthereum(c.String("rpc"), c.String("from"))
+		e.Confirmations = c.Int("confirmations")
+		return e, nil
+	}
+	return nil, errors.New("--chain must be bitcoin or ethereum")
+}
+
+// getOmniClient returns the client of the chain given by the ol flag.
+func getOmniClient(c *cli.Context) (*client.Client, error) {
+	cl, err := getClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(cl.Roster, cl.ID), nil
+}
+
+func anchorRun(c *cli.Context) error {
+	cl, err := getOmniClient(c)
+	if err != nil {
+		return err
+	}
+	pub, err := getPublisher(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+	a := &anchor.Anchorer{
+		Client:    cl,
+		Publisher: pub,
+		Interval:  c.Duration("interval"),
+		OnAnchor: func(r anchor.Record) {
+			fmt.Fprintf(c.App.Writer, "Anchored block %d in %s transaction %s\n", r.Index, r.Publisher, r.Ref)
+		},
+	}
+	if err = a.Run(ctx); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+func anchorVerify(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("need the reference of the transaction")
+	}
+	cl, err := getOmniClient(c)
+	if err != nil {
+		return err
+	}
+	pub, err := getPublisher(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), txTimeout)
+	defer cancel()
+	a, err := anchor.Verify(ctx, cl, pub, c.Args().First())
+	if err != nil {
+		return errors.New("invalid anchor: " + err.Error())
+	}
+	fmt.Fprintf(c.App.Writer, "The anchor is valid.\nBlock: %d %x\nRoot: %x\n", a.Index, a.BlockID, a.Root)
+	return nil
+}
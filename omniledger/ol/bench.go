@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dedis/cothority/omniledger/bench"
+	"github.com/dedis/cothority/omniledger/client"
+	"gopkg.in/urfave/cli.v1"
+)
+
+func runBench(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	signer, err := getSigner(c, cl)
+	if err != nil {
+		return err
+	}
+	parent, err := getDarcID(c, cl)
+	if err != nil {
+		return err
+	}
+	cfg := bench.Config{
+		Mix: bench.Mix{
+			Spawn:       c.Int("spawn"),
+			Invoke:      c.Int("invoke"),
+			PayloadSize: c.Int("payload"),
+			Signers:     c.Int("signers"),
+		},
+		Transactions: c.Int("tx"),
+		Concurrency:  c.Int("concurrency"),
+		Timeout:      c.Duration("timeout"),
+		Seed:         int64(c.Int("seed")),
+	}
+	r, err := bench.Run(context.Background(), client.New(cl.Roster, cl.ID), signer, parent, cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(c.App.Writer, r)
+	return nil
+}
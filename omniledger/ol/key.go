@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/dedis/cothority/omniledger/hardware"
+	"github.com/dedis/cothority/omniledger/keystore"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// getKeystore returns the keystore in the config directory.
+func getKeystore() *keystore.Store {
+	return keystore.NewStore(filepath.Join(getDataPath(cliApp.Name), "keys"))
+}
+
+// getPassword returns the password of the keystore given by the password
+// flag.
+func getPassword(c *cli.Context) ([]byte, error) {
+	if c.String("password") == "" {
+		return nil, errors.New("--password flag is required")
+	}
+	return []byte(c.String("password")), nil
+}
+
+func keyGenerate(c *cli.Context) error {
+	password, err := getPassword(c)
+	if err != nil {
+		return err
+	}
+	signer, err := getKeystore().Generate(password)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, signer.Identity())
+	return nil
+}
+
+func keyList(c *cli.Context) error {
+	ids, err := getKeystore().List()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		fmt.Fprintln(c.App.Writer, id)
+	}
+	return nil
+}
+
+func keyExport(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("need the identity of the key to export")
+	}
+	buf, err := getKeystore().Export(c.Args().First())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, string(buf))
+	return nil
+}
+
+func keyImport(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("need the key file to import")
+	}
+	buf, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		return err
+	}
+	id, err := getKeystore().Import(buf)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, "Imported", id)
+	return nil
+}
+
+func keyDevice(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("need the path of the device")
+	}
+	dev, err := hardware.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+	id, err := dev.Identity()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, id)
+	return nil
+}
@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/anchor"
+	"github.com/dedis/cothority/omniledger/bench"
 	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/cothority/omniledger/rest"
 	omniledger "github.com/dedis/cothority/omniledger/service"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/app"
@@ -68,8 +73,333 @@ var cmds = cli.Commands{
 		},
 		Action: add,
 	},
+	{
+		Name:  "darc",
+		Usage: "show, spawn and evolve darcs",
+		Subcommands: cli.Commands{
+			{
+				Name:   "show",
+				Usage:  "show the latest version of a darc",
+				Flags:  []cli.Flag{olFlag, darcFlag},
+				Action: darcShow,
+			},
+			{
+				Name:  "spawn",
+				Usage: "spawn a new darc from an existing darc",
+				Flags: []cli.Flag{olFlag, keyFlag, passwordFlag, darcFlag,
+					cli.StringFlag{
+						Name:  "owner",
+						Usage: "the expression of the identities that can evolve the new darc and sign for it",
+					},
+					cli.StringFlag{
+						Name:  "desc",
+						Usage: "the description of the new darc",
+					},
+				},
+				Action: darcSpawn,
+			},
+			{
+				Name:  "rule",
+				Usage: "add, update or delete a rule of a darc",
+				Flags: []cli.Flag{olFlag, keyFlag, passwordFlag, darcFlag,
+					cli.StringFlag{
+						Name:  "rule",
+						Usage: "the action of the rule, e.g. spawn:value",
+					},
+					cli.StringFlag{
+						Name:  "identity",
+						Usage: "the expression of the identities allowed to do the action",
+					},
+					cli.BoolFlag{
+						Name:  "delete",
+						Usage: "delete the rule instead of setting it",
+					},
+				},
+				Action: darcRule,
+			},
+		},
+	},
+	{
+		Name:  "spawn",
+		Usage: "spawn an instance of a contract",
+		Flags: []cli.Flag{olFlag, keyFlag, passwordFlag, darcFlag, argFlag, unsignedFlag, signerFlag, hardwareFlag,
+			cli.StringFlag{
+				Name:  "contract",
+				Usage: "the contract to spawn",
+			},
+		},
+		Action: spawn,
+	},
+	{
+		Name:  "invoke",
+		Usage: "invoke a command of an instance",
+		Flags: []cli.Flag{olFlag, keyFlag, passwordFlag, argFlag, instanceFlag, unsignedFlag, signerFlag, hardwareFlag,
+			cli.StringFlag{
+				Name:  "command",
+				Usage: "the command to invoke",
+			},
+		},
+		Action: invoke,
+	},
+	{
+		Name:   "proof",
+		Usage:  "fetch and verify the proof of an instance",
+		Flags:  []cli.Flag{olFlag, instanceFlag},
+		Action: proof,
+	},
+	{
+		Name:  "tx",
+		Usage: "sign and submit the transactions written by --unsigned",
+		Subcommands: cli.Commands{
+			{
+				Name:      "sign",
+				Usage:     "add the signature of a key or a hardware wallet to a transaction, without contacting the nodes",
+				ArgsUsage: "file",
+				Flags:     []cli.Flag{keyFlag, passwordFlag, deviceFlag},
+				Action:    txSign,
+			},
+			{
+				Name:      "submit",
+				Usage:     "send a signed transaction to the nodes",
+				ArgsUsage: "file",
+				Flags:     []cli.Flag{olFlag},
+				Action:    txSubmit,
+			},
+		},
+	},
+	{
+		Name:  "bench",
+		Usage: "send a mix of transactions and report the throughput and the latency",
+		Flags: []cli.Flag{olFlag, keyFlag, passwordFlag, darcFlag,
+			cli.IntFlag{
+				Name:  "tx",
+				Usage: "the number of transactions",
+				Value: bench.DefaultConfig.Transactions,
+			},
+			cli.IntFlag{
+				Name:  "concurrency",
+				Usage: "the number of transactions sent at the same time",
+				Value: bench.DefaultConfig.Concurrency,
+			},
+			cli.IntFlag{
+				Name:  "spawn",
+				Usage: "the weight of the transactions that spawn a value instance",
+				Value: bench.DefaultConfig.Mix.Spawn,
+			},
+			cli.IntFlag{
+				Name:  "invoke",
+				Usage: "the weight of the transactions that update a value instance",
+				Value: bench.DefaultConfig.Mix.Invoke,
+			},
+			cli.IntFlag{
+				Name:  "payload",
+				Usage: "the size of the values in bytes",
+				Value: bench.DefaultConfig.Mix.PayloadSize,
+			},
+			cli.IntFlag{
+				Name:  "signers",
+				Usage: "the number of signatures of every transaction",
+				Value: bench.DefaultConfig.Mix.Signers,
+			},
+			cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "how long a transaction may take",
+				Value: bench.DefaultConfig.Timeout,
+			},
+			cli.IntFlag{
+				Name:  "seed",
+				Usage: "the seed of the order of the transactions",
+			},
+		},
+		Action: runBench,
+	},
+	{
+		Name:  "key",
+		Usage: "manage the keystore of darc signers",
+		Subcommands: cli.Commands{
+			{
+				Name:   "generate",
+				Usage:  "generate a new ed25519 signer and print its identity",
+				Flags:  []cli.Flag{passwordFlag},
+				Action: keyGenerate,
+			},
+			{
+				Name:   "list",
+				Usage:  "list the identities of the keystore",
+				Action: keyList,
+			},
+			{
+				Name:      "export",
+				Usage:     "print the encrypted key file of an identity",
+				ArgsUsage: "identity",
+				Action:    keyExport,
+			},
+			{
+				Name:      "import",
+				Usage:     "add an exported key file to the keystore",
+				ArgsUsage: "file",
+				Action:    keyImport,
+			},
+			{
+				Name:      "device",
+				Usage:     "print the identity of a hardware wallet",
+				ArgsUsage: "hidraw device",
+				Action:    keyDevice,
+			},
+		},
+	},
+	{
+		Name:  "rest",
+		Usage: "run a REST gateway to the nodes of the roster",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "roster, r",
+				Usage: "the roster of the cothority the gateway talks to",
+			},
+			cli.StringFlag{
+				Name:  "listen, l",
+				Usage: "the address the gateway listens on",
+				Value: "localhost:7771",
+			},
+		},
+		Action: runRest,
+	},
+	{
+		Name:  "timestamp",
+		Usage: "store verified timestamps of documents",
+		Subcommands: cli.Commands{
+			{
+				Name:      "add",
+				Usage:     "store the hash of a document with its RFC 3161 or OpenTimestamps proof",
+				ArgsUsage: "document",
+				Flags: []cli.Flag{olFlag, keyFlag, passwordFlag, darcFlag,
+					cli.StringFlag{
+						Name:  "rfc3161",
+						Usage: "the file of the RFC 3161 token or response",
+					},
+					cli.StringFlag{
+						Name:  "authority",
+						Usage: "the value instance holding the certificate of the RFC 3161 authority",
+					},
+					cli.StringFlag{
+						Name:  "ots",
+						Usage: "the file of the upgraded OpenTimestamps proof",
+					},
+				},
+				Action: timestampAdd,
+			},
+			{
+				Name:      "show",
+				Usage:     "fetch and verify the timestamp of a document",
+				ArgsUsage: "document",
+				Flags:     []cli.Flag{olFlag, darcFlag},
+				Action:    timestampShow,
+			},
+		},
+	},
+	{
+		Name:  "anchor",
+		Usage: "publish the state of a ledger to an external chain",
+		Subcommands: cli.Commands{
+			{
+				Name:  "run",
+				Usage: "periodically publish the latest block and collection root",
+				Flags: append([]cli.Flag{olFlag,
+					cli.DurationFlag{
+						Name:  "interval, i",
+						Usage: "the time between two anchors",
+						Value: time.Hour,
+					},
+				}, anchorFlags...),
+				Action: anchorRun,
+			},
+			{
+				Name:      "verify",
+				Usage:     "check that an anchor is the state of the ledger",
+				ArgsUsage: "transaction",
+				Flags:     append([]cli.Flag{olFlag}, anchorFlags...),
+				Action:    anchorVerify,
+			},
+		},
+	},
+}
+
+// anchorFlags select the external chain of the anchor commands.
+var anchorFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "chain",
+		Usage: "the external chain: bitcoin or ethereum",
+		Value: "bitcoin",
+	},
+	cli.StringFlag{
+		Name:  "rpc",
+		Usage: "the JSON-RPC URL of the node of the external chain",
+	},
+	cli.StringFlag{
+		Name:  "rpc-user",
+		Usage: "the user of the bitcoind JSON-RPC API",
+	},
+	cli.StringFlag{
+		Name:   "rpc-password",
+		EnvVar: "OL_RPC_PASSWORD",
+		Usage:  "the password of the bitcoind JSON-RPC API",
+	},
+	cli.StringFlag{
+		Name:  "from",
+		Usage: "the unlocked ethereum account that sends the anchors",
+	},
+	cli.IntFlag{
+		Name:  "confirmations",
+		Usage: "the number of confirmations before an anchor is verified",
+		Value: anchor.DefaultConfirmations,
+	},
 }
 
+var (
+	olFlag = cli.StringFlag{
+		Name:   "ol",
+		EnvVar: "OL",
+		Usage:  "the OmniLedger config to use",
+	}
+	keyFlag = cli.StringFlag{
+		Name:  "key",
+		Usage: "the identity of the signer in the keystore or its key file, the owner of the ledger if not set",
+	}
+	passwordFlag = cli.StringFlag{
+		Name:   "password",
+		EnvVar: "OL_PASSWORD",
+		Usage:  "the password of the keystore",
+	}
+	darcFlag = cli.StringFlag{
+		Name:  "darc",
+		Usage: "the hex encoded ID of the darc, the genesis darc if not set",
+	}
+	instanceFlag = cli.StringFlag{
+		Name:  "instance",
+		Usage: "the hex encoded ID of the instance",
+	}
+	unsignedFlag = cli.StringFlag{
+		Name:  "unsigned",
+		Usage: "write the unsigned transaction to this file instead of sending it",
+	}
+	signerFlag = cli.StringSliceFlag{
+		Name:  "signer",
+		Usage: "the identity that will sign the unsigned transaction, can be repeated",
+	}
+	deviceFlag = cli.StringFlag{
+		Name:  "device",
+		Usage: "the hidraw device of the hardware wallet to sign with",
+	}
+	hardwareFlag = cli.BoolFlag{
+		Name:  "hardware",
+		Usage: "let the unsigned transaction be signed by hardware wallets",
+	}
+	argFlag = cli.StringSliceFlag{
+		Name:  "arg",
+		Usage: "an argument of the instruction as name=value, with a hex encoded value",
+	}
+)
+
 var cliApp = cli.NewApp()
 
 func init() {
@@ -179,23 +509,28 @@ func show(c *cli.Context) error {
 		fmt.Fprintln(c.App.Writer, gd)
 	} else {
 		fmt.Fprintln(c.App.ErrWriter, "could not fetch darc:", err)
+		return err
+	}
+
+	chainConfig, err := cl.GetChainConfig()
+	if err == nil {
+		fmt.Fprintln(c.App.Writer)
+		fmt.Fprintln(c.App.Writer, "Block interval:", chainConfig.BlockInterval)
+		fmt.Fprintln(c.App.Writer, "Chain roster:", chainConfig.Roster.List)
+	} else {
+		fmt.Fprintln(c.App.ErrWriter, "could not fetch chain config:", err)
 	}
 
 	return err
 }
 
 func add(c *cli.Context) error {
-	ol := c.String("ol")
-	if ol == "" {
-		return errors.New("--ol flag is required")
-	}
-
-	cl, err := omniledger.NewClientFromConfig(ol)
+	cl, err := getClient(c)
 	if err != nil {
 		return err
 	}
 
-	private, err := loadKey(cl.OwnerID)
+	signer, err := getSigner(c, cl)
 	if err != nil {
 		return err
 	}
@@ -216,49 +551,27 @@ func add(c *cli.Context) error {
 		return err
 	}
 
-	d2 := d.Copy()
-	d2.EvolveFrom(d)
-
-	d2.Rules.AddRule(darc.Action(action), []byte(identity))
-
-	d2Buf, err := d2.ToProto()
-	if err != nil {
-		return err
-	}
+	return evolveDarc(cl, signer, d, func(r darc.Rules) error {
+		return r.AddRule(darc.Action(action), expression.Expr(identity))
+	})
+}
 
-	invoke := omniledger.Invoke{
-		Command: "evolve",
-		Args: []omniledger.Argument{
-			omniledger.Argument{
-				Name:  "darc",
-				Value: d2Buf,
-			},
-		},
-	}
-	instr := omniledger.Instruction{
-		InstanceID: omniledger.InstanceID{
-			DarcID: d2.GetBaseID(),
-		},
-		Index:  0,
-		Length: 1,
-		Invoke: &invoke,
-		Signatures: []darc.Signature{
-			darc.Signature{Signer: private.Owner.Identity()},
-		},
+func runRest(c *cli.Context) error {
+	fn := c.String("roster")
+	if fn == "" {
+		return errors.New("--roster flag is required")
 	}
-	err = instr.SignBy(private.Owner)
+	in, err := os.Open(fn)
 	if err != nil {
-		return err
+		return fmt.Errorf("Could not open roster %v: %v", fn, err)
 	}
-
-	_, err = cl.AddTransactionAndWait(omniledger.ClientTransaction{
-		Instructions: []omniledger.Instruction{instr},
-	}, 10)
+	r, err := readRoster(in)
+	in.Close()
 	if err != nil {
 		return err
 	}
-
-	return nil
+	log.Info("REST gateway listening on", c.String("listen"))
+	return http.ListenAndServe(c.String("listen"), rest.NewGateway(r))
 }
 
 type configPrivate struct {
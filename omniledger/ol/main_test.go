@@ -2,13 +2,17 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/contracts"
+	omniledger "github.com/dedis/cothority/omniledger/service"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/app"
 	"github.com/dedis/onet/log"
@@ -97,4 +101,83 @@ func TestCli(t *testing.T) {
 	require.NoError(t, err)
 	require.Contains(t, string(b.Bytes()), "Roster: 127.0.0.1")
 	require.Contains(t, string(b.Bytes()), "spawn:xxx - \"ed25519:XXX\"")
+	require.Contains(t, string(b.Bytes()), "Block interval: "+interval.String())
+
+	cl, err := omniledger.NewClientFromConfig(ol.(string))
+	require.NoError(t, err)
+	owner := cl.OwnerID.String()
+
+	log.Lvl1("darc rule: ")
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"ol", "darc", "rule", "--rule", "spawn:value", "--identity", owner}
+	require.NoError(t, cliApp.Run(args))
+
+	log.Lvl1("spawn: ")
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"ol", "spawn", "--contract", contracts.ContractValueID, "--arg", "value=01020304"}
+	require.NoError(t, cliApp.Run(args))
+	var instance string
+	_, err = fmt.Sscanf(b.String(), "Spawned instance %s", &instance)
+	require.NoError(t, err)
+
+	log.Lvl1("proof: ")
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"ol", "proof", "--instance", instance}
+	require.NoError(t, cliApp.Run(args))
+	require.Contains(t, b.String(), "Value: 01020304")
+
+	log.Lvl1("darc spawn: ")
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"ol", "darc", "spawn", "--owner", owner, "--desc", "child"}
+	require.NoError(t, cliApp.Run(args))
+	var child string
+	_, err = fmt.Sscanf(b.String(), "Spawned darc %s", &child)
+	require.NoError(t, err)
+
+	log.Lvl1("darc show: ")
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"ol", "darc", "show", "--darc", child}
+	require.NoError(t, cliApp.Run(args))
+	require.Contains(t, b.String(), "invoke:evolve - \""+owner+"\"")
+
+	log.Lvl1("key generate: ")
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"ol", "key", "generate", "--password", "pw"}
+	require.NoError(t, cliApp.Run(args))
+	user := strings.TrimSpace(b.String())
+	require.True(t, strings.HasPrefix(user, "ed25519:"))
+
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"ol", "key", "list"}
+	require.NoError(t, cliApp.Run(args))
+	require.Contains(t, b.String(), user)
+
+	// The key of the keystore signs once it is allowed by the darc.
+	args = []string{"ol", "darc", "rule", "--rule", "spawn:value", "--identity", owner + " | " + user}
+	require.NoError(t, cliApp.Run(args))
+	args = []string{"ol", "spawn", "--key", user, "--password", "pw",
+		"--contract", contracts.ContractValueID, "--arg", "value=05"}
+	require.NoError(t, cliApp.Run(args))
+	args = []string{"ol", "spawn", "--key", user, "--password", "wrong",
+		"--contract", contracts.ContractValueID, "--arg", "value=05"}
+	require.Error(t, cliApp.Run(args))
+
+	args = []string{"ol", "proof", "--instance", "1234"}
+	require.Error(t, cliApp.Run(args))
+	args = []string{"ol", "spawn", "--contract", contracts.ContractValueID, "--arg", "value"}
+	require.Error(t, cliApp.Run(args))
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/contracts"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/protobuf"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// hashFile returns the sha256 hash of the file given as argument.
+func hashFile(c *cli.Context) ([]byte, error) {
+	if c.NArg() != 1 {
+		return nil, errors.New("need the file of the document")
+	}
+	buf, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(buf)
+	return h[:], nil
+}
+
+func timestampAdd(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	darcID, err := getDarcID(c, cl)
+	if err != nil {
+		return err
+	}
+	hash, err := hashFile(c)
+	if err != nil {
+		return err
+	}
+	args := omniledger.Arguments{{Name: "hash", Value: hash}}
+	switch {
+	case c.String("rfc3161") != "":
+		authority, err := parseInstanceID(c.String("authority"))
+		if err != nil {
+			return errors.New("--authority must be the value instance of the certificate of the authority")
+		}
+		token, err := ioutil.ReadFile(c.String("rfc3161"))
+		if err != nil {
+			return err
+		}
+		args = append(args,
+			omniledger.Argument{Name: "type", Value: []byte(contracts.TimestampRFC3161)},
+			omniledger.Argument{Name: "proof", Value: token},
+			omniledger.Argument{Name: "authority", Value: authority.Slice()})
+	case c.String("ots") != "":
+		proof, err := ioutil.ReadFile(c.String("ots"))
+		if err != nil {
+			return err
+		}
+		args = append(args,
+			omniledger.Argument{Name: "type", Value: []byte(contracts.TimestampOpenTimestamps)},
+			omniledger.Argument{Name: "proof", Value: proof})
+	default:
+		return errors.New("--rfc3161 or --ots flag is required")
+	}
+	signer, err := getSigner(c, cl)
+	if err != nil {
+		return err
+	}
+	err = sendInstruction(cl, signer, &omniledger.Instruction{
+		InstanceID: omniledger.InstanceID{DarcID: darcID},
+		Spawn: &omniledger.Spawn{
+			ContractID: contracts.ContractTimestampID,
+			Args:       args,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Spawned timestamp %x\n", contracts.TimestampID(darcID, hash).Slice())
+	return nil
+}
+
+func timestampShow(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	darcID, err := getDarcID(c, cl)
+	if err != nil {
+		return err
+	}
+	hash, err := hashFile(c)
+	if err != nil {
+		return err
+	}
+	p, err := cl.GetProof(contracts.TimestampID(darcID, hash).Slice())
+	if err != nil {
+		return err
+	}
+	if err = p.Proof.Verify(cl.ID); err != nil {
+		return errors.New("invalid proof: " + err.Error())
+	}
+	if !p.Proof.InclusionProof.Match() {
+		return errors.New("the document is not timestamped")
+	}
+	_, vs, err := p.Proof.KeyValue()
+	if err != nil {
+		return err
+	}
+	if len(vs) < 2 || string(vs[1]) != contracts.ContractTimestampID {
+		return errors.New("the instance is not a timestamp")
+	}
+	td := &contracts.TimestampData{}
+	if err = protobuf.Decode(vs[0], td); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Document: %x\n", td.Hash)
+	switch td.Type {
+	case contracts.TimestampRFC3161:
+		fmt.Fprintf(c.App.Writer, "Time: %s\nAuthority: %x\n",
+			time.Unix(0, td.Time).UTC().Format(time.RFC3339), td.Authority.Slice())
+	case contracts.TimestampOpenTimestamps:
+		fmt.Fprintf(c.App.Writer, "Bitcoin block: %d\nMerkle root: %x\n",
+			td.BitcoinHeight, td.BitcoinMerkleRoot)
+	}
+	return nil
+}
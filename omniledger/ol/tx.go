@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/client"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/hardware"
+	omniledger "github.com/dedis/cothority/omniledger/service"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// txTimeout is how long the tx commands wait for the nodes.
+const txTimeout = time.Minute
+
+// writeUnsigned builds the transaction of the instruction, to be signed by
+// the signers of the signer flag, and writes it to the file of the unsigned
+// flag.
+func writeUnsigned(c *cli.Context, cl *omniledger.Client, inst omniledger.Instruction) error {
+	var signers []darc.Identity
+	for _, s := range c.StringSlice("signer") {
+		id, err := darc.ParseIdentity(s)
+		if err != nil {
+			return err
+		}
+		signers = append(signers, id)
+	}
+	if len(signers) == 0 {
+		return errors.New("--signer flag is required with --unsigned")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), txTimeout)
+	defer cancel()
+	u, err := client.New(cl.Roster, cl.ID).Build(ctx, omniledger.Instructions{inst}, signers...)
+	if err != nil {
+		return err
+	}
+	if c.Bool("hardware") {
+		if err = u.SetSignatureVersion(darc.RequestVersionHardware); err != nil {
+			return err
+		}
+	}
+	buf, err := u.Encode()
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(c.String("unsigned"), buf, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, "Wrote the unsigned transaction to", c.String("unsigned"))
+	return nil
+}
+
+// readTx reads the transaction of the file given as argument.
+func readTx(c *cli.Context) (*client.UnsignedTransaction, error) {
+	if c.NArg() != 1 {
+		return nil, errors.New("need the file of the transaction")
+	}
+	buf, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		return nil, err
+	}
+	return client.DecodeUnsignedTransaction(buf)
+}
+
+func txSign(c *cli.Context) error {
+	u, err := readTx(c)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c.String("device") != "":
+		dev, err := hardware.Open(c.String("device"))
+		if err != nil {
+			return err
+		}
+		defer dev.Close()
+		fmt.Fprintln(c.App.Writer, "Confirm the instructions on the device")
+		if err = hardware.SignTransaction(dev, u); err != nil {
+			return err
+		}
+	case c.String("key") != "":
+		signer, err := getSigner(c, nil)
+		if err != nil {
+			return err
+		}
+		if err = u.Sign(signer); err != nil {
+			return err
+		}
+	default:
+		return errors.New("--key or --device flag is required")
+	}
+	buf, err := u.Encode()
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(c.Args().First(), buf, 0644); err != nil {
+		return err
+	}
+	for _, id := range u.Missing() {
+		fmt.Fprintln(c.App.Writer, "Missing the signature of", id)
+	}
+	return nil
+}
+
+func txSubmit(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return err
+	}
+	u, err := readTx(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), txTimeout)
+	defer cancel()
+	if err = client.New(cl.Roster, cl.ID).Submit(ctx, u); err != nil {
+		return err
+	}
+	for _, inst := range u.Transaction.Instructions {
+		if inst.Spawn != nil {
+			fmt.Fprintf(c.App.Writer, "Spawned instance %x\n", inst.DeriveID(inst.Spawn.ContractID).Slice())
+		}
+	}
+	return nil
+}
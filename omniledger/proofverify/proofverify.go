@@ -0,0 +1,368 @@
+// Package proofverify verifies the proofs of omniledger without contacting
+// any node. Unlike the service package, it doesn't depend on onet or on a
+// database, only on kyber and protobuf, so that it can be built for an IoT
+// gateway with gomobile, or for a browser with wasm.
+//
+// The proof is the service.Proof, encoded with protobuf. The structures of
+// this package mirror the ones of the skipchain and service packages, and
+// must be kept in sync with them.
+package proofverify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/cosi"
+	"github.com/dedis/protobuf"
+)
+
+// ErrorVerifyCollection is returned if the collection-proof itself is not
+// properly set up.
+var ErrorVerifyCollection = errors.New("collection inclusion proof is wrong")
+
+// ErrorVerifyCollectionRoot is returned if the root of the collection is
+// different than the stored value in the skipblock.
+var ErrorVerifyCollectionRoot = errors.New("root of collection is not in skipblock")
+
+// ErrorVerifySkipchain is returned if the stored skipblock doesn't have a
+// proper proof that it comes from the genesis block.
+var ErrorVerifySkipchain = errors.New("stored skipblock is not properly evolved from genesis block")
+
+// Proof mirrors service.Proof.
+type Proof struct {
+	InclusionProof collection.Proof
+	Latest         SkipBlock
+	Chain          ChainProof
+	Redacted       bool
+}
+
+// SkipBlock mirrors skipchain.SkipBlock.
+type SkipBlock struct {
+	*SkipBlockFix
+	Hash        []byte
+	ForwardLink []*ForwardLink
+	ChildSL     [][]byte
+	Payload     []byte `protobuf:"opt"`
+	ChildLinks  []*ForwardLink
+}
+
+// SkipBlockFix mirrors skipchain.SkipBlockFix.
+type SkipBlockFix struct {
+	Index         int
+	Height        int
+	MaximumHeight int
+	BaseHeight    int
+	BackLinkIDs   [][]byte
+	VerifierIDs   [][16]byte
+	ParentBlockID []byte
+	GenesisID     []byte
+	Data          []byte
+	Roster        *Roster
+}
+
+// Roster mirrors onet.Roster, with the points as bytes.
+type Roster struct {
+	ID        [16]byte
+	List      []*ServerIdentity
+	Aggregate []byte
+}
+
+// ServerIdentity mirrors network.ServerIdentity, with the public key as
+// bytes.
+type ServerIdentity struct {
+	Public      []byte
+	ID          [16]byte
+	Address     string
+	Description string
+}
+
+// ChainProof mirrors skipchain.ChainProof.
+type ChainProof struct {
+	GenesisID []byte
+	Blocks    []*SkipBlockFix
+	Links     []*ForwardLink
+}
+
+// ForwardLink mirrors skipchain.ForwardLink.
+type ForwardLink struct {
+	From      []byte
+	To        []byte
+	NewRoster *Roster
+	Signature FinalSignature
+}
+
+// FinalSignature mirrors byzcoinx.FinalSignature.
+type FinalSignature struct {
+	Msg     []byte
+	Sig     []byte
+	Partial *PartialSignature
+}
+
+// PartialSignature mirrors byzcoinx.PartialSignature.
+type PartialSignature struct {
+	PrepareSig []byte
+	Missing    []byte
+}
+
+// Decode decodes a proof encoded with protobuf.
+func Decode(buf []byte) (*Proof, error) {
+	p := &Proof{}
+	if err := protobuf.Decode(buf, p); err != nil {
+		return nil, errors.New("couldn't decode proof: " + err.Error())
+	}
+	if p.Latest.SkipBlockFix == nil {
+		return nil, errors.New("proof has no latest block")
+	}
+	return p, nil
+}
+
+// Verify decodes the proof in buf and verifies it for the skipchain scID.
+func Verify(buf []byte, scID []byte) (*Proof, error) {
+	p, err := Decode(buf)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Verify(scID); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Verify checks that the proof is valid for the skipchain scID, like
+// service.Proof.Verify: the collection-proof must be consistent, its root
+// must be in the latest block, and the latest block must be linked to the
+// genesis block by the forward-links.
+func (p *Proof) Verify(scID []byte) error {
+	if err := p.VerifyInclusion(); err != nil {
+		return err
+	}
+	if !bytes.Equal(p.Chain.GenesisID, scID) {
+		return ErrorVerifySkipchain
+	}
+	if err := p.Chain.Verify(); err != nil {
+		return ErrorVerifySkipchain
+	}
+	latest := p.Chain.Blocks[len(p.Chain.Blocks)-1].CalculateHash()
+	if !bytes.Equal(p.Latest.Hash, latest) || !bytes.Equal(p.Latest.CalculateHash(), latest) {
+		return ErrorVerifySkipchain
+	}
+	return nil
+}
+
+// VerifyInclusion only verifies the collection-proof and that its root is
+// stored in the latest block.
+func (p *Proof) VerifyInclusion() error {
+	if p.Redacted {
+		if !p.InclusionProof.ConsistentRedacted() {
+			return ErrorVerifyCollection
+		}
+	} else if !p.InclusionProof.Consistent() {
+		return ErrorVerifyCollection
+	}
+	root, err := collectionRoot(p.Latest.Data)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(p.InclusionProof.TreeRootHash(), root) {
+		return ErrorVerifyCollectionRoot
+	}
+	return nil
+}
+
+// KeyValue returns the key and the values stored in the proof.
+func (p *Proof) KeyValue() (key []byte, values [][]byte, err error) {
+	key = p.InclusionProof.Key
+	values, err = p.InclusionProof.RawValues()
+	return
+}
+
+// Verify checks that the proof starts at the genesis block and that every
+// forward-link is correctly signed by the roster of the block it comes from.
+func (cp *ChainProof) Verify() error {
+	if len(cp.Blocks) == 0 {
+		return errors.New("proof has no blocks")
+	}
+	if !bytes.Equal(cp.Blocks[0].CalculateHash(), cp.GenesisID) {
+		return errors.New("first block is not the genesis block")
+	}
+	if len(cp.Links) != len(cp.Blocks)-1 {
+		return errors.New("proof needs one forward-link between two blocks")
+	}
+	from := cp.Blocks[0]
+	fromHash := from.CalculateHash()
+	for i, fl := range cp.Links {
+		if fl == nil || from.Roster == nil {
+			return fmt.Errorf("missing forward-link or roster at block %d", i)
+		}
+		pubs, err := from.Roster.publics()
+		if err != nil {
+			return err
+		}
+		if err := fl.Verify(pubs); err != nil {
+			return fmt.Errorf("wrong forward-link at block %d: %v", i, err)
+		}
+		to := cp.Blocks[i+1]
+		toHash := to.CalculateHash()
+		if err := fl.verifyRoster(from, to, fromHash, toHash); err != nil {
+			return fmt.Errorf("wrong forward-link at block %d: %v", i, err)
+		}
+		if !bytes.Equal(to.GenesisID, cp.GenesisID) {
+			return fmt.Errorf("block %d is not part of the skipchain", i+1)
+		}
+		from, fromHash = to, toHash
+	}
+	return nil
+}
+
+// CalculateHash returns the hash of the block, like
+// skipchain.SkipBlockFix.CalculateHash, which it must match.
+func (sbf *SkipBlockFix) CalculateHash() []byte {
+	hash := sha256.New()
+	for _, i := range []int{sbf.Index, sbf.Height, sbf.MaximumHeight,
+		sbf.BaseHeight} {
+		binary.Write(hash, binary.LittleEndian, i)
+	}
+	for _, bl := range sbf.BackLinkIDs {
+		hash.Write(bl)
+	}
+	for _, v := range sbf.VerifierIDs {
+		hash.Write(v[:])
+	}
+	hash.Write(sbf.ParentBlockID)
+	hash.Write(sbf.GenesisID)
+	hash.Write(sbf.Data)
+	if sbf.Roster != nil {
+		for _, si := range sbf.Roster.List {
+			hash.Write(si.Public)
+		}
+	}
+	return hash.Sum(nil)
+}
+
+// publics returns the public keys of the roster.
+func (ro *Roster) publics() ([]kyber.Point, error) {
+	pubs := make([]kyber.Point, len(ro.List))
+	for i, si := range ro.List {
+		pubs[i] = cothority.Suite.Point()
+		if err := pubs[i].UnmarshalBinary(si.Public); err != nil {
+			return nil, errors.New("invalid public key in roster: " + err.Error())
+		}
+	}
+	return pubs, nil
+}
+
+// Hash returns the message signed by the forward-link.
+func (fl *ForwardLink) Hash() []byte {
+	hash := sha256.New()
+	hash.Write(fl.From)
+	hash.Write(fl.To)
+	if fl.NewRoster != nil {
+		hash.Write(fl.NewRoster.ID[:])
+	}
+	return hash.Sum(nil)
+}
+
+// Verify checks the collective signature of the forward-link against the
+// public keys of the roster that signed it, in the order of the roster or in
+// one of its rotations, as the view-changes rotate the roster.
+func (fl *ForwardLink) Verify(pubs []kyber.Point) error {
+	if !bytes.Equal(fl.Signature.Msg, fl.Hash()) {
+		return errors.New("wrong hash of forward link")
+	}
+	n := len(pubs)
+	if n == 0 {
+		return errors.New("no public keys")
+	}
+	policy := cosi.NewThresholdPolicy(n - (n-1)/3)
+	var err error
+	for i := 0; i < n; i++ {
+		err = cosi.Verify(cothority.Suite, pubs, fl.Signature.Msg, fl.Signature.Sig, policy)
+		if err == nil {
+			return nil
+		}
+		pubs = append(pubs[1:], pubs[0])
+	}
+	return err
+}
+
+// verifyRoster checks that the forward-link hands over the roster from the
+// block from to the block to, like skipchain.ForwardLink.VerifyRoster.
+func (fl *ForwardLink) verifyRoster(from, to *SkipBlockFix, fromHash, toHash []byte) error {
+	if !bytes.Equal(fl.From, fromHash) || !bytes.Equal(fl.To, toHash) {
+		return errors.New("forward-link doesn't link the given blocks")
+	}
+	if from.Roster == nil || to.Roster == nil {
+		return errors.New("missing roster in block")
+	}
+	if fl.NewRoster == nil {
+		if from.Roster.ID != to.Roster.ID {
+			return errors.New("roster changed without being in the forward-link")
+		}
+		return nil
+	}
+	if fl.NewRoster.ID != to.Roster.ID {
+		return errors.New("new roster of forward-link doesn't match roster of block")
+	}
+	if len(fl.NewRoster.List) != len(to.Roster.List) {
+		return errors.New("new roster of forward-link has wrong number of nodes")
+	}
+	for i, si := range fl.NewRoster.List {
+		if !bytes.Equal(si.Public, to.Roster.List[i].Public) {
+			return errors.New("new roster of forward-link has wrong public keys")
+		}
+	}
+	return nil
+}
+
+// collectionRoot returns the CollectionRoot of the service.DataHeader in
+// data. The header is encoded by network.Marshal, which puts the 16 bytes of
+// the type before the protobuf encoding, and the root is its first field.
+func collectionRoot(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, errors.New("couldn't unmarshal header")
+	}
+	buf := data[16:]
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errors.New("couldn't unmarshal header")
+		}
+		buf = buf[n:]
+		var size uint64
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return nil, errors.New("couldn't unmarshal header")
+			}
+			buf = buf[n:]
+			continue
+		case 1:
+			size = 8
+		case 2:
+			size, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return nil, errors.New("couldn't unmarshal header")
+			}
+			buf = buf[n:]
+		case 5:
+			size = 4
+		default:
+			return nil, errors.New("couldn't unmarshal header")
+		}
+		if size > uint64(len(buf)) {
+			return nil, errors.New("couldn't unmarshal header")
+		}
+		if key>>3 == 1 && key&7 == 2 {
+			return buf[:size], nil
+		}
+		buf = buf[size:]
+	}
+	return nil, errors.New("header has no collection root")
+}
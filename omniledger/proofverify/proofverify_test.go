@@ -0,0 +1,61 @@
+package proofverify_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/client"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/proofverify"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestVerify(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	owner := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+	msg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:darc"}, owner.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 500 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cl, err := client.CreateChain(ctx, msg)
+	require.Nil(t, err)
+	key := service.InstanceID{DarcID: msg.GenesisDarc.GetBaseID()}.Slice()
+	proof, err := cl.GetProof(ctx, key)
+	require.Nil(t, err)
+	buf, err := protobuf.Encode(proof)
+	require.Nil(t, err)
+
+	p, err := proofverify.Verify(buf, cl.ID)
+	require.Nil(t, err)
+	k, values, err := p.KeyValue()
+	require.Nil(t, err)
+	require.Equal(t, key, k)
+	require.Equal(t, []byte(service.ContractDarcID), values[1])
+
+	_, err = proofverify.Verify(buf, []byte("another chain"))
+	require.Equal(t, proofverify.ErrorVerifySkipchain, err)
+	_, err = proofverify.Verify(buf[1:], cl.ID)
+	require.NotNil(t, err)
+
+	// A block that has been changed is refused.
+	require.Nil(t, p.Verify(cl.ID))
+	latest := p.Chain.Blocks[len(p.Chain.Blocks)-1]
+	latest.BackLinkIDs = append(latest.BackLinkIDs, []byte("block"))
+	require.Equal(t, proofverify.ErrorVerifySkipchain, p.Verify(cl.ID))
+}
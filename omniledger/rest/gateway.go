@@ -0,0 +1,406 @@
+// Package rest is a REST gateway for omniledger. It translates JSON
+// requests over HTTP into requests to the nodes of a roster, so that web
+// backends and curl can use omniledger without the websocket and protobuf
+// protocol of onet. All IDs and binary values are hex encoded.
+//
+// The gateway has the following endpoints:
+//   - POST /v1/chains - creates a chain, see CreateChainRequest
+//   - POST /v1/chains/{chain}/transactions - adds a transaction, see
+//     TransactionRequest
+//   - POST /v1/chains/{chain}/digests - returns the messages the signers of
+//     the instructions of a TransactionRequest must sign
+//   - GET /v1/chains/{chain}/proofs/{instance} - returns the verified proof
+//     of an instance
+//   - GET /v1/chains/{chain}/names/{darc}/{name} - resolves a name
+//   - POST /v1/chains/{chain}/views/{instance}/{view} - calls a view, see
+//     ViewRequest
+//   - GET /v1/chains/{chain}/events?contract=&topic=&from=&to= - searches
+//     events
+//   - GET /v1/chains/{chain}/blocks?before=&count= - lists the latest blocks
+//     with their number of transactions
+//   - GET /v1/chains/{chain}/blocks/{index} - decodes the transactions of a
+//     block
+//   - GET /v1/chains/{chain}/search?q= - searches instances by ID and darcs
+//     by description
+package rest
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/client"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// DefaultTimeout is the time the gateway waits for the nodes to answer a
+// request, unless Timeout is set.
+const DefaultTimeout = 20 * time.Second
+
+// maxBody is the maximum size of the body of a request.
+const maxBody = 1 << 20
+
+// Gateway is an http.Handler that sends the requests to the nodes of its
+// roster, using the failover and proof verification of the client package.
+type Gateway struct {
+	// Timeout is the time the gateway waits for the nodes to answer.
+	Timeout time.Duration
+
+	roster *onet.Roster
+}
+
+// NewGateway returns a gateway to the nodes of roster. New chains are also
+// created on this roster.
+func NewGateway(roster *onet.Roster) *Gateway {
+	return &Gateway{
+		Timeout: DefaultTimeout,
+		roster:  roster,
+	}
+}
+
+// httpError is an error with the HTTP status to return.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(err error) error {
+	return httpError{http.StatusBadRequest, err}
+}
+
+var errNotFound = httpError{http.StatusNotFound, errors.New("unknown endpoint")}
+
+// ServeHTTP answers the request with JSON.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), g.Timeout)
+	defer cancel()
+
+	reply, err := g.route(ctx, r)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusBadGateway
+		if he, ok := err.(httpError); ok {
+			status = he.status
+		}
+		log.Lvl2("REST request", r.Method, r.URL.Path, "failed:", err)
+		w.WriteHeader(status)
+		reply = &ErrorResponse{Error: err.Error()}
+	}
+	if err = json.NewEncoder(w).Encode(reply); err != nil {
+		log.Error("Couldn't write reply:", err)
+	}
+}
+
+func (g *Gateway) route(ctx context.Context, r *http.Request) (interface{}, error) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" || parts[1] != "chains" {
+		return nil, errNotFound
+	}
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			return nil, errNotFound
+		}
+		return g.createChain(ctx, r)
+	}
+	if len(parts) < 4 {
+		return nil, errNotFound
+	}
+	c, err := g.client(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	args := parts[4:]
+	switch {
+	case r.Method == http.MethodPost && parts[3] == "transactions" && len(args) == 0:
+		return addTransaction(ctx, c, r)
+	case r.Method == http.MethodPost && parts[3] == "digests" && len(args) == 0:
+		return digests(c, r)
+	case r.Method == http.MethodGet && parts[3] == "proofs" && len(args) == 1:
+		return getProof(ctx, c, args[0])
+	case r.Method == http.MethodGet && parts[3] == "names" && len(args) >= 2:
+		return resolve(ctx, c, args[0], strings.Join(args[1:], "/"))
+	case r.Method == http.MethodPost && parts[3] == "views" && len(args) == 2:
+		return callView(ctx, c, r, args[0], args[1])
+	case r.Method == http.MethodGet && parts[3] == "events" && len(args) == 0:
+		return searchEvents(ctx, c, r)
+	case r.Method == http.MethodGet && parts[3] == "blocks" && len(args) == 0:
+		return listBlocks(ctx, c, r)
+	case r.Method == http.MethodGet && parts[3] == "blocks" && len(args) == 1:
+		return decodeBlock(ctx, c, args[0])
+	case r.Method == http.MethodGet && parts[3] == "search" && len(args) == 0:
+		return searchInstances(ctx, c, r)
+	}
+	return nil, errNotFound
+}
+
+// client returns a client of the chain with the hex encoded ID. No clients
+// are kept, so that requests for unknown chains don't use any memory.
+func (g *Gateway) client(chain string) (*client.Client, error) {
+	id, err := hex.DecodeString(chain)
+	if err != nil || len(id) == 0 {
+		return nil, badRequest(errors.New("chain must be a hex encoded ID"))
+	}
+	return client.New(g.roster, id), nil
+}
+
+func decodeBody(r *http.Request, msg interface{}) error {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBody)).Decode(msg); err != nil {
+		return badRequest(errors.New("invalid JSON: " + err.Error()))
+	}
+	return nil
+}
+
+func (g *Gateway) createChain(ctx context.Context, r *http.Request) (interface{}, error) {
+	var req CreateChainRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	interval, err := time.ParseDuration(req.BlockInterval)
+	if err != nil || interval <= 0 {
+		return nil, badRequest(errors.New("invalid block interval"))
+	}
+	var owners []darc.Identity
+	for _, o := range req.Owners {
+		id, err := darc.ParseIdentity(o)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+		owners = append(owners, id)
+	}
+	if len(owners) == 0 {
+		return nil, badRequest(errors.New("no owners"))
+	}
+	msg, err := service.DefaultGenesisMsg(service.CurrentVersion, g.roster, req.Rules, owners...)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	msg.BlockInterval = interval
+	c, err := client.CreateChain(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	return &CreateChainResponse{
+		Chain:       hex.EncodeToString(c.ID),
+		GenesisDarc: hex.EncodeToString(msg.GenesisDarc.GetBaseID()),
+	}, nil
+}
+
+func addTransaction(ctx context.Context, c *client.Client, r *http.Request) (interface{}, error) {
+	var req TransactionRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	ct, err := toTransaction(req)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	if err = c.AddTransaction(ctx, ct); err != nil {
+		return nil, err
+	}
+	resp := &TransactionResponse{}
+	for _, inst := range ct.Instructions {
+		resp.Hashes = append(resp.Hashes, hex.EncodeToString(inst.Hash()))
+	}
+	return resp, nil
+}
+
+func digests(c *client.Client, r *http.Request) (interface{}, error) {
+	var req TransactionRequest
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	ct, err := toTransaction(req)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	resp := &TransactionResponse{}
+	for _, inst := range ct.Instructions {
+		dr, err := inst.ToDarcRequest(c.ID)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+		resp.Hashes = append(resp.Hashes, hex.EncodeToString(dr.Hash()))
+	}
+	return resp, nil
+}
+
+func getProof(ctx context.Context, c *client.Client, instance string) (interface{}, error) {
+	id, err := decodeInstanceID(instance)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	pr, err := c.GetProof(ctx, id.Slice())
+	if err != nil {
+		return nil, err
+	}
+	buf, err := protobuf.Encode(pr)
+	if err != nil {
+		return nil, err
+	}
+	resp := &ProofResponse{
+		Match:      pr.InclusionProof.Match(),
+		BlockIndex: pr.Latest.Index,
+		Proof:      hex.EncodeToString(buf),
+	}
+	if resp.Match {
+		_, vs, err := pr.KeyValue()
+		if err != nil {
+			return nil, err
+		}
+		resp.Value = hex.EncodeToString(vs[0])
+		resp.ContractID = string(vs[1])
+	}
+	return resp, nil
+}
+
+func resolve(ctx context.Context, c *client.Client, darcID, name string) (interface{}, error) {
+	id, err := hex.DecodeString(darcID)
+	if err != nil || len(id) != 32 {
+		return nil, badRequest(errors.New("darc must be 32 hex encoded bytes"))
+	}
+	instID, err := c.Resolve(ctx, darc.ID(id), name)
+	if err != nil {
+		return nil, err
+	}
+	return &ResolveResponse{InstanceID: hex.EncodeToString(instID.Slice())}, nil
+}
+
+func callView(ctx context.Context, c *client.Client, r *http.Request, instance, view string) (interface{}, error) {
+	id, err := decodeInstanceID(instance)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	var req ViewRequest
+	if err = decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	args := make(service.Arguments, len(req.Args))
+	for i, a := range req.Args {
+		args[i].Name = a.Name
+		if args[i].Value, err = hex.DecodeString(a.Value); err != nil {
+			return nil, badRequest(errors.New("argument " + a.Name + " is not hex encoded"))
+		}
+	}
+	result, err := c.CallView(ctx, id, view, args)
+	if err != nil {
+		return nil, err
+	}
+	return &ViewResponse{Result: hex.EncodeToString(result)}, nil
+}
+
+func searchEvents(ctx context.Context, c *client.Client, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	var bounds [2]int
+	for i, name := range []string{"from", "to"} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, badRequest(errors.New(name + " must be a block index"))
+			}
+			bounds[i] = n
+		}
+	}
+	reply, err := c.SearchEvents(ctx, q.Get("contract"), q.Get("topic"), bounds[0], bounds[1])
+	if err != nil {
+		return nil, err
+	}
+	resp := &EventsResponse{Events: []Event{}, Truncated: reply.Truncated}
+	for _, e := range reply.Events {
+		resp.Events = append(resp.Events, Event{
+			BlockIndex: e.BlockIndex,
+			BlockID:    hex.EncodeToString(e.BlockID),
+			ContractID: e.Event.ContractID,
+			InstanceID: hex.EncodeToString(e.Event.InstanceID.Slice()),
+			Topic:      e.Event.Topic,
+			Value:      hex.EncodeToString(e.Event.Value),
+		})
+	}
+	return resp, nil
+}
+
+func listBlocks(ctx context.Context, c *client.Client, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	var params [2]int
+	for i, name := range []string{"before", "count"} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, badRequest(errors.New(name + " must be a positive number"))
+			}
+			params[i] = n
+		}
+	}
+	reply, err := c.ListBlocks(ctx, params[0], params[1])
+	if err != nil {
+		return nil, err
+	}
+	resp := &BlocksResponse{Blocks: []Block{}}
+	for _, b := range reply.Blocks {
+		resp.Blocks = append(resp.Blocks, toBlock(b))
+	}
+	return resp, nil
+}
+
+func decodeBlock(ctx context.Context, c *client.Client, index string) (interface{}, error) {
+	n, err := strconv.Atoi(index)
+	if err != nil || n < 0 {
+		return nil, badRequest(errors.New("index must be a block index"))
+	}
+	reply, err := c.DecodeBlock(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	resp := &BlockResponse{
+		Block:        toBlock(reply.Block),
+		Transactions: []TransactionSummary{},
+	}
+	for _, tx := range reply.Transactions {
+		var ts TransactionSummary
+		for _, is := range tx.Instructions {
+			ts.Instructions = append(ts.Instructions, InstructionSummary{
+				InstanceID: hex.EncodeToString(is.InstanceID.Slice()),
+				Action:     is.Action,
+				ContractID: is.ContractID,
+				Command:    is.Command,
+				Args:       is.Args,
+				Signers:    is.Signers,
+			})
+		}
+		resp.Transactions = append(resp.Transactions, ts)
+	}
+	return resp, nil
+}
+
+func searchInstances(ctx context.Context, c *client.Client, r *http.Request) (interface{}, error) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		return nil, badRequest(errors.New("q must not be empty"))
+	}
+	reply, err := c.SearchInstances(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	resp := &SearchResponse{Instances: []Instance{}, Truncated: reply.Truncated}
+	for _, inst := range reply.Instances {
+		resp.Instances = append(resp.Instances, Instance{
+			InstanceID:  hex.EncodeToString(inst.InstanceID.Slice()),
+			ContractID:  inst.ContractID,
+			Description: inst.Description,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/contracts"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestGateway(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+	_, roster, _ := local.GenTree(3, true)
+	srv := httptest.NewServer(NewGateway(roster))
+	defer srv.Close()
+
+	// call sends the request and decodes the reply into reply, it returns
+	// the HTTP status.
+	call := func(method, path string, req, reply interface{}) int {
+		var body bytes.Buffer
+		if req != nil {
+			require.Nil(t, json.NewEncoder(&body).Encode(req))
+		}
+		r, err := http.NewRequest(method, srv.URL+path, &body)
+		require.Nil(t, err)
+		resp, err := http.DefaultClient.Do(r)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		require.Nil(t, json.NewDecoder(resp.Body).Decode(reply))
+		return resp.StatusCode
+	}
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	var chain CreateChainResponse
+	require.Equal(t, http.StatusOK, call("POST", "/v1/chains", &CreateChainRequest{
+		BlockInterval: "500ms",
+		Rules:         []string{"spawn:value"},
+		Owners:        []string{signer.Identity().String()},
+	}, &chain))
+	prefix := "/v1/chains/" + chain.Chain
+
+	// The signer gets the digest of the instruction from the gateway.
+	value := []byte("1234")
+	nonce := service.GenNonce()
+	tx := &TransactionRequest{Instructions: []Instruction{{
+		InstanceID:       chain.GenesisDarc + hex.EncodeToString(make([]byte, 32)),
+		Nonce:            hex.EncodeToString(nonce[:]),
+		Length:           1,
+		Spawn:            contracts.ContractValueID,
+		Args:             []Argument{{Name: "value", Value: hex.EncodeToString(value)}},
+		Signatures:       []Signature{{Signer: signer.Identity().String()}},
+		SignatureVersion: darc.CurrentRequestVersion,
+	}}}
+	var digests TransactionResponse
+	require.Equal(t, http.StatusOK, call("POST", prefix+"/digests", tx, &digests))
+	require.Equal(t, 1, len(digests.Hashes))
+	digest, err := hex.DecodeString(digests.Hashes[0])
+	require.Nil(t, err)
+	sig, err := signer.Sign(digest)
+	require.Nil(t, err)
+	tx.Instructions[0].Signatures[0].Signature = hex.EncodeToString(sig)
+
+	var added TransactionResponse
+	require.Equal(t, http.StatusOK, call("POST", prefix+"/transactions", tx, &added))
+	inst, err := tx.Instructions[0].toInstruction()
+	require.Nil(t, err)
+	require.Equal(t, hex.EncodeToString(inst.Hash()), added.Hashes[0])
+
+	id := hex.EncodeToString(inst.DeriveID(contracts.ContractValueID).Slice())
+	var proof ProofResponse
+	for i := 0; i < 20 && !proof.Match; i++ {
+		time.Sleep(250 * time.Millisecond)
+		require.Equal(t, http.StatusOK, call("GET", prefix+"/proofs/"+id, nil, &proof))
+	}
+	require.True(t, proof.Match)
+	require.Equal(t, hex.EncodeToString(value), proof.Value)
+	require.Equal(t, contracts.ContractValueID, proof.ContractID)
+
+	var events EventsResponse
+	require.Equal(t, http.StatusOK, call("GET", prefix+"/events?from=0", nil, &events))
+
+	var blocks BlocksResponse
+	require.Equal(t, http.StatusOK, call("GET", prefix+"/blocks?count=10", nil, &blocks))
+	require.NotEqual(t, 0, len(blocks.Blocks))
+	var block BlockResponse
+	for _, b := range blocks.Blocks {
+		if b.TxCount > 0 {
+			require.Equal(t, http.StatusOK, call("GET", fmt.Sprintf("%s/blocks/%d", prefix, b.Index), nil, &block))
+		}
+	}
+	require.Equal(t, 1, len(block.Transactions))
+	summary := block.Transactions[0].Instructions[0]
+	require.Equal(t, "spawn", summary.Action)
+	require.Equal(t, contracts.ContractValueID, summary.ContractID)
+	require.Equal(t, []string{signer.Identity().String()}, summary.Signers)
+
+	var found SearchResponse
+	require.Equal(t, http.StatusOK, call("GET", prefix+"/search?q=genesis", nil, &found))
+	require.Equal(t, 1, len(found.Instances))
+	require.Equal(t, service.ContractDarcID, found.Instances[0].ContractID)
+
+	var e ErrorResponse
+	require.Equal(t, http.StatusBadRequest, call("GET", prefix+"/search", nil, &e))
+	require.Equal(t, http.StatusBadRequest, call("GET", prefix+"/blocks/first", nil, &e))
+	require.Equal(t, http.StatusBadGateway, call("GET", prefix+"/names/"+chain.GenesisDarc+"/unknown", nil, &e))
+	require.NotEqual(t, "", e.Error)
+	require.Equal(t, http.StatusBadRequest, call("GET", prefix+"/proofs/1234", nil, &e))
+	require.Equal(t, http.StatusBadRequest, call("POST", prefix+"/transactions",
+		&TransactionRequest{Instructions: []Instruction{{InstanceID: id}}}, &e))
+	require.Equal(t, http.StatusNotFound, call("GET", "/v2/chains", nil, &e))
+
+	local.WaitDone(500 * time.Millisecond)
+}
@@ -0,0 +1,253 @@
+package rest
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+)
+
+// CreateChainRequest is the body of POST /v1/chains.
+type CreateChainRequest struct {
+	// BlockInterval is a duration like "5s".
+	BlockInterval string `json:"block_interval"`
+	// Rules are the actions of the genesis darc, like "spawn:value".
+	Rules []string `json:"rules"`
+	// Owners are the identities that are allowed to do the actions of
+	// Rules, like "ed25519:" followed by the hex encoded public key.
+	Owners []string `json:"owners"`
+}
+
+// CreateChainResponse holds the IDs of a new chain.
+type CreateChainResponse struct {
+	Chain       string `json:"chain"`
+	GenesisDarc string `json:"genesis_darc"`
+}
+
+// Argument is an argument of an instruction, with the hex encoded value.
+type Argument struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Signature is the hex encoded signature of an instruction by the signer,
+// which is given as the string of its identity.
+type Signature struct {
+	Signer    string `json:"signer"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Instruction is the JSON form of service.Instruction. Exactly one of Spawn,
+// Invoke or Delete must be set.
+type Instruction struct {
+	InstanceID string `json:"instance_id"`
+	Nonce      string `json:"nonce,omitempty"`
+	Index      int    `json:"index"`
+	Length     int    `json:"length"`
+	// Spawn is the ID of the contract to spawn.
+	Spawn string `json:"spawn,omitempty"`
+	// Invoke is the command to invoke.
+	Invoke           string      `json:"invoke,omitempty"`
+	Delete           bool        `json:"delete,omitempty"`
+	Args             []Argument  `json:"args,omitempty"`
+	Signatures       []Signature `json:"signatures,omitempty"`
+	SignatureVersion uint32      `json:"signature_version"`
+}
+
+// TransactionRequest is the body of the transactions and digests endpoints.
+type TransactionRequest struct {
+	Instructions []Instruction `json:"instructions"`
+}
+
+// TransactionResponse holds one hex encoded hash per instruction. For
+// transactions, it is the hash of the instruction, for digests it is the
+// message that the signers must sign.
+type TransactionResponse struct {
+	Hashes []string `json:"hashes"`
+}
+
+// ProofResponse is the content of a verified proof of an instance.
+type ProofResponse struct {
+	// Match is false if the instance doesn't exist.
+	Match      bool   `json:"match"`
+	Value      string `json:"value,omitempty"`
+	ContractID string `json:"contract_id,omitempty"`
+	// BlockIndex is the index of the block the proof has been taken from.
+	BlockIndex int `json:"block_index"`
+	// Proof is the hex encoded protobuf of the service.Proof, for clients
+	// that want to verify it themselves.
+	Proof string `json:"proof"`
+}
+
+// ResolveResponse holds the instance of a name.
+type ResolveResponse struct {
+	InstanceID string `json:"instance_id"`
+}
+
+// ViewRequest is the body of the views endpoint.
+type ViewRequest struct {
+	Args []Argument `json:"args"`
+}
+
+// ViewResponse holds the hex encoded result of a view.
+type ViewResponse struct {
+	Result string `json:"result"`
+}
+
+// Event is the JSON form of service.BlockEvent.
+type Event struct {
+	BlockIndex int    `json:"block_index"`
+	BlockID    string `json:"block_id"`
+	ContractID string `json:"contract_id"`
+	InstanceID string `json:"instance_id"`
+	Topic      string `json:"topic"`
+	Value      string `json:"value"`
+}
+
+// EventsResponse holds the events found by a search.
+type EventsResponse struct {
+	Events    []Event `json:"events"`
+	Truncated bool    `json:"truncated"`
+}
+
+// Block is the JSON form of service.BlockSummary.
+type Block struct {
+	Index   int    `json:"index"`
+	BlockID string `json:"block_id"`
+	// Time is the timestamp of the block in RFC 3339 format.
+	Time             string `json:"time"`
+	TxCount          int    `json:"tx_count"`
+	EncryptedTxCount int    `json:"encrypted_tx_count"`
+}
+
+// BlocksResponse holds the latest blocks, starting with the newest one.
+type BlocksResponse struct {
+	Blocks []Block `json:"blocks"`
+}
+
+// InstructionSummary is the JSON form of service.InstructionSummary.
+type InstructionSummary struct {
+	InstanceID string `json:"instance_id"`
+	// Action is spawn, invoke or delete.
+	Action     string   `json:"action"`
+	ContractID string   `json:"contract_id,omitempty"`
+	Command    string   `json:"command,omitempty"`
+	Args       []string `json:"args,omitempty"`
+	Signers    []string `json:"signers"`
+}
+
+// TransactionSummary holds the instructions of a transaction.
+type TransactionSummary struct {
+	Instructions []InstructionSummary `json:"instructions"`
+}
+
+// BlockResponse holds a block and its decoded transactions.
+type BlockResponse struct {
+	Block        Block                `json:"block"`
+	Transactions []TransactionSummary `json:"transactions"`
+}
+
+// Instance is the JSON form of service.InstanceSummary.
+type Instance struct {
+	InstanceID  string `json:"instance_id"`
+	ContractID  string `json:"contract_id"`
+	Description string `json:"description,omitempty"`
+}
+
+// SearchResponse holds the instances found by a search.
+type SearchResponse struct {
+	Instances []Instance `json:"instances"`
+	Truncated bool       `json:"truncated"`
+}
+
+// ErrorResponse is returned with every status other than 200.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// toInstruction converts the JSON instruction.
+func (ji Instruction) toInstruction() (service.Instruction, error) {
+	var inst service.Instruction
+	id, err := decodeInstanceID(ji.InstanceID)
+	if err != nil {
+		return inst, err
+	}
+	inst.InstanceID = id
+	if ji.Nonce != "" {
+		buf, err := hex.DecodeString(ji.Nonce)
+		if err != nil || len(buf) != len(inst.Nonce) {
+			return inst, errors.New("nonce must be 32 hex encoded bytes")
+		}
+		copy(inst.Nonce[:], buf)
+	}
+	inst.Index = ji.Index
+	inst.Length = ji.Length
+	inst.SignatureVersion = ji.SignatureVersion
+
+	args := make(service.Arguments, len(ji.Args))
+	for i, a := range ji.Args {
+		args[i].Name = a.Name
+		if args[i].Value, err = hex.DecodeString(a.Value); err != nil {
+			return inst, fmt.Errorf("argument %s is not hex encoded", a.Name)
+		}
+	}
+	switch {
+	case ji.Spawn != "" && ji.Invoke == "" && !ji.Delete:
+		inst.Spawn = &service.Spawn{ContractID: ji.Spawn, Args: args}
+	case ji.Spawn == "" && ji.Invoke != "" && !ji.Delete:
+		inst.Invoke = &service.Invoke{Command: ji.Invoke, Args: args}
+	case ji.Spawn == "" && ji.Invoke == "" && ji.Delete:
+		inst.Delete = &service.Delete{}
+	default:
+		return inst, errors.New("exactly one of spawn, invoke or delete must be given")
+	}
+
+	for _, s := range ji.Signatures {
+		signer, err := darc.ParseIdentity(s.Signer)
+		if err != nil {
+			return inst, err
+		}
+		sig, err := hex.DecodeString(s.Signature)
+		if err != nil {
+			return inst, errors.New("signature is not hex encoded")
+		}
+		inst.Signatures = append(inst.Signatures, darc.Signature{Signer: signer, Signature: sig})
+	}
+	return inst, nil
+}
+
+func toTransaction(req TransactionRequest) (service.ClientTransaction, error) {
+	var ct service.ClientTransaction
+	if len(req.Instructions) == 0 {
+		return ct, errors.New("no instructions")
+	}
+	for _, ji := range req.Instructions {
+		inst, err := ji.toInstruction()
+		if err != nil {
+			return ct, err
+		}
+		ct.Instructions = append(ct.Instructions, inst)
+	}
+	return ct, nil
+}
+
+func decodeInstanceID(s string) (service.InstanceID, error) {
+	buf, err := hex.DecodeString(s)
+	if err != nil || len(buf) != 64 {
+		return service.InstanceID{}, errors.New("instance ID must be 64 hex encoded bytes")
+	}
+	return service.NewInstanceID(buf), nil
+}
+
+func toBlock(b service.BlockSummary) Block {
+	return Block{
+		Index:            b.Index,
+		BlockID:          hex.EncodeToString(b.BlockID),
+		Time:             time.Unix(0, b.Timestamp).UTC().Format(time.RFC3339Nano),
+		TxCount:          b.TxCount,
+		EncryptedTxCount: b.EncryptedTxCount,
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/onet/log"
+)
+
+// The administrative requests of the service, like Backup, Restore or
+// SetQuota, as well as DeleteChain and RepairForwardLinks of the skipchain
+// service, are only accepted from an administrator of the conode. The
+// administrators are the clients linked to the conode with
+// skipchain.Client.CreateLinkPrivate, and the signers of the admin darc set
+// with SetAdminDarc. As the darc is stored on a skipchain, the administrators
+// can be changed by evolving it, without access to the conode.
+
+// adminMaxSkew is the maximum difference between the timestamp of an
+// administrative request and the time of the conode.
+const adminMaxSkew = 5 * time.Minute
+
+// adminMaxDepth is how deep the delegations of the admin darc are followed.
+const adminMaxDepth = 10
+
+// verifyAdmin checks the signature of an administrative request, and that
+// its timestamp is recent, so that it can't be replayed later.
+func (s *Service) verifyAdmin(msg []byte, timestamp int64, sig []byte) error {
+	if d := time.Since(time.Unix(timestamp, 0)); d > adminMaxSkew || d < -adminMaxSkew {
+		return errors.New("the timestamp of the request is too far from the time of the conode")
+	}
+	return s.skService().VerifyAdmin(msg, sig)
+}
+
+// SetAdminDarcMessage returns the message an administrator signs for a
+// SetAdminDarc request.
+func SetAdminDarcMessage(req *SetAdminDarc) []byte {
+	msg := append([]byte("admindarc:"), req.SkipchainID...)
+	msg = append(msg, req.DarcID...)
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(req.Timestamp))
+	return append(msg, buf...)
+}
+
+// SetAdminDarc sets the darc whose signers are administrators of the conode,
+// or removes it if the DarcID is empty. The darc must be stored on an
+// omniledger skipchain this conode holds.
+func (s *Service) SetAdminDarc(req *SetAdminDarc) (*SetAdminDarcResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if err := s.verifyAdmin(SetAdminDarcMessage(req), req.Timestamp, req.Signature); err != nil {
+		return nil, err
+	}
+	if len(req.DarcID) > 0 {
+		if !s.isOurChain(req.SkipchainID) {
+			return nil, errors.New("not an omniledger skipchain")
+		}
+		d, err := s.loadLatestDarc(req.SkipchainID, req.DarcID)
+		if err != nil {
+			return nil, errors.New("couldn't load the darc: " + err.Error())
+		}
+		if len(d.Rules.GetSignExpr()) == 0 {
+			return nil, errors.New("the darc has no sign rule")
+		}
+	}
+
+	s.storage.Lock()
+	if len(req.DarcID) > 0 {
+		s.storage.AdminSkipchain = req.SkipchainID
+		s.storage.AdminDarc = req.DarcID
+	} else {
+		s.storage.AdminSkipchain = nil
+		s.storage.AdminDarc = nil
+	}
+	s.storage.Unlock()
+	s.save()
+	log.Lvlf1("%s: set the admin darc to %x", s.ServerIdentity(), req.DarcID)
+	return &SetAdminDarcResponse{Version: CurrentVersion}, nil
+}
+
+// verifyAdminDarc returns true if sig is a signature on msg of an identity
+// that fulfills the sign rule of the latest version of the admin darc. The
+// darc is registered with the skipchain service, so that its
+// administrative requests accept the signers of the darc, too.
+func (s *Service) verifyAdminDarc(msg, sig []byte) bool {
+	s.storage.Lock()
+	scID, dID := s.storage.AdminSkipchain, s.storage.AdminDarc
+	s.storage.Unlock()
+	if len(dID) == 0 {
+		return false
+	}
+	d, err := s.loadLatestDarc(scID, dID)
+	if err != nil {
+		log.Warn(s.ServerIdentity(), "couldn't load the admin darc:", err)
+		return false
+	}
+	getDarc := s.darcGetter(s.GetCollectionView(scID))
+	return evalAdminExpr(d.Rules.GetSignExpr(), getDarc, msg, sig, 0)
+}
+
+// evalAdminExpr evaluates expr where an identity is true if it signed msg, and
+// a darc is true if its sign rule is.
+func evalAdminExpr(expr expression.Expr, getDarc darc.GetDarc, msg, sig []byte, depth int) bool {
+	if depth > adminMaxDepth {
+		return false
+	}
+	parser := expression.InitParser(func(str string) bool {
+		if strings.HasPrefix(str, "darc:") || strings.HasPrefix(str, "chaindarc:") {
+			d := getDarc(str, true)
+			return d != nil && evalAdminExpr(d.Rules.GetSignExpr(), getDarc, msg, sig, depth+1)
+		}
+		id, err := darc.ParseIdentity(str)
+		return err == nil && id.Verify(msg, sig) == nil
+	})
+	ok, err := expression.Evaluate(parser, expr)
+	return err == nil && ok
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_SetAdminDarc(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+	host := s.hosts[0]
+
+	signerPriv, err := s.signer.GetPrivate()
+	require.Nil(t, err)
+	verify := func(priv kyber.Scalar) error {
+		msg := []byte("admin request")
+		sig, err := schnorr.Sign(cothority.Suite, priv, msg)
+		require.Nil(t, err)
+		return s.service().verifyAdmin(msg, time.Now().Unix(), sig)
+	}
+
+	// Without an administrator, the darc can't be set.
+	cl := NewClient()
+	require.NotNil(t, cl.SetAdminDarc(host.ServerIdentity, signerPriv, scID, s.darc.GetBaseID()))
+	require.NotNil(t, verify(signerPriv))
+
+	kp := key.NewKeyPair(cothority.Suite)
+	require.Nil(t, skipchain.NewClient().CreateLinkPrivate(host.ServerIdentity,
+		s.local.GetPrivate(host), kp.Public))
+	require.NotNil(t, cl.SetAdminDarc(host.ServerIdentity, kp.Private, scID, []byte("unknown darc")))
+	require.Nil(t, cl.SetAdminDarc(host.ServerIdentity, kp.Private, scID, s.darc.GetBaseID()))
+
+	// The signers of the darc are administrators, too.
+	require.Nil(t, verify(signerPriv))
+	require.NotNil(t, verify(key.NewKeyPair(cothority.Suite).Private))
+
+	require.Nil(t, cl.SetAdminDarc(host.ServerIdentity, signerPriv, scID, nil))
+	require.NotNil(t, verify(signerPriv))
+}
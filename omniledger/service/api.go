@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"strings"
 	"time"
 
@@ -15,6 +17,8 @@ import (
 	"github.com/dedis/cothority/omniledger/darc"
 	"github.com/dedis/cothority/omniledger/darc/expression"
 	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
 	"github.com/dedis/onet"
 )
 
@@ -27,8 +31,20 @@ type Client struct {
 	ID      skipchain.SkipBlockID
 	Roster  *onet.Roster
 	OwnerID darc.Identity
+	// Replicas are read replicas of the skipchain. If there are any, the
+	// proofs and the searches are sent to them instead of the roster, and
+	// the proofs are verified against the genesis block.
+	Replicas []*network.ServerIdentity
+	// RefuseRedacted makes GetProof and GetProofSigned return
+	// ErrRedactedProof instead of a proof whose values have been removed
+	// because of a ReadRule.
+	RefuseRedacted bool
 }
 
+// ErrRedactedProof is returned for a redacted proof if the client refuses
+// them.
+var ErrRedactedProof = errors.New("the proof is redacted")
+
 // NewClient instantiates a new Omniledger client.
 // TODO: this needs to be changed to avoid having an invalid Client.
 func NewClient() *Client {
@@ -76,7 +92,9 @@ func (c *Client) AddTransaction(tx ClientTransaction) (*AddTxResponse, error) {
 
 // AddTransactionAndWait adds a transaction and will wait for it to be included
 // in omniledger, up to a maximum of wait block intervals. It does not return
-// any feedback on the transaction. The Client's Roster and ID should be
+// any feedback on the transaction. It returns ErrInclusionTimeout if the
+// transaction is not in the blocks, and ErrTooManyWaiters if the conode can't
+// let more clients wait. The Client's Roster and ID should be
 // initialized before calling this method (see NewClientFromConfig).
 func (c *Client) AddTransactionAndWait(tx ClientTransaction, wait int) (*AddTxResponse, error) {
 	reply := &AddTxResponse{}
@@ -86,6 +104,38 @@ func (c *Client) AddTransactionAndWait(tx ClientTransaction, wait int) (*AddTxRe
 		Transaction:   tx,
 		InclusionWait: wait,
 	}, reply)
+	if err != nil {
+		return nil, inclusionError(err)
+	}
+	return reply, nil
+}
+
+// CreateTxKey asks the first node of the roster for the key to encrypt
+// transactions with EncryptTransaction. The key is created if it doesn't
+// exist yet.
+func (c *Client) CreateTxKey() (*CreateTxKeyResponse, error) {
+	reply := &CreateTxKeyResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &CreateTxKey{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// AddEncryptedTransaction sends a transaction encrypted with
+// EncryptTransaction to the leader. It is ordered in the next block and
+// executed in the block after, if it is valid. Use GetProof to find out if
+// the transaction was committed.
+func (c *Client) AddEncryptedTransaction(etx EncryptedTransaction) (*AddEncryptedTxResponse, error) {
+	reply := &AddEncryptedTxResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &AddEncryptedTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		Transaction: etx,
+	}, reply)
 	if err != nil {
 		return nil, err
 	}
@@ -97,11 +147,367 @@ func (c *Client) AddTransactionAndWait(tx ClientTransaction, wait int) (*AddTxRe
 // absence of the key. The Client's Roster and ID should be initialized before
 // calling this method (see NewClientFromConfig).
 func (c *Client) GetProof(key []byte) (*GetProofResponse, error) {
-	reply := &GetProofResponse{}
-	err := c.SendProtobuf(c.Roster.List[0], &GetProof{
+	return c.getProof(&GetProof{
+		Version: CurrentVersion,
+		ID:      c.ID,
+		Key:     key,
+	})
+}
+
+// GetProofSigned is like GetProof, but signs the request with the signers,
+// so that the values of instances with a ReadRule are included if the
+// signers satisfy it.
+func (c *Client) GetProofSigned(key []byte, signers ...darc.Signer) (*GetProofResponse, error) {
+	req := &GetProof{
 		Version: CurrentVersion,
 		ID:      c.ID,
 		Key:     key,
+		Expires: time.Now().Add(getProofValidity).UnixNano(),
+	}
+	for _, signer := range signers {
+		sig, err := signer.Sign(GetProofMsg(req.ID, req.Key, req.Expires))
+		if err != nil {
+			return nil, err
+		}
+		req.Signatures = append(req.Signatures, darc.Signature{
+			Signature: sig,
+			Signer:    signer.Identity(),
+		})
+	}
+	return c.getProof(req)
+}
+
+// getProof sends the request and refuses the redacted proofs if the client
+// is set up to do so.
+func (c *Client) getProof(req *GetProof) (*GetProofResponse, error) {
+	reply, err := c.sendGetProof(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.RefuseRedacted && reply.Proof.Redacted {
+		return nil, ErrRedactedProof
+	}
+	return reply, nil
+}
+
+// sendGetProof sends the request to the first node of the roster, or to a
+// random replica if the client has some. As a replica is not part of the
+// roster, its proof is verified and the next replica is asked if it is
+// wrong.
+func (c *Client) sendGetProof(req *GetProof) (*GetProofResponse, error) {
+	if len(c.Replicas) == 0 {
+		reply := &GetProofResponse{}
+		if err := c.SendProtobuf(c.Roster.List[0], req, reply); err != nil {
+			return nil, err
+		}
+		return reply, nil
+	}
+	var err error
+	for _, i := range rand.Perm(len(c.Replicas)) {
+		reply := &GetProofResponse{}
+		if err = c.SendProtobuf(c.Replicas[i], req, reply); err != nil {
+			continue
+		}
+		if err = reply.Proof.Verify(c.ID); err == nil {
+			return reply, nil
+		}
+	}
+	return nil, err
+}
+
+// sendRead sends a read-only request to a random replica, trying the next
+// ones if it fails, or to the first node of the roster if the client has no
+// replica.
+func (c *Client) sendRead(req, reply interface{}) error {
+	if len(c.Replicas) == 0 {
+		return c.SendProtobuf(c.Roster.List[0], req, reply)
+	}
+	var err error
+	for _, i := range rand.Perm(len(c.Replicas)) {
+		if err = c.SendProtobuf(c.Replicas[i], req, reply); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// CallView asks the first node of the roster for the result of the view of
+// the contract of the instance id.
+func (c *Client) CallView(id InstanceID, view string, args Arguments) (*CallViewResponse, error) {
+	reply := &CallViewResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &CallView{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		InstanceID:  id,
+		View:        view,
+		Args:        args,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetRandomness asks the roster for the shares of the randomness of the
+// instance id. The contract of the instance verifies them with Randomness.
+func (c *Client) GetRandomness(id InstanceID) (*GetRandomnessResponse, error) {
+	reply := &GetRandomnessResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &GetRandomness{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		InstanceID:  id,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetContractRegistry asks the node dst for the contracts it has
+// registered, for example to find out why it doesn't verify the blocks.
+func (c *Client) GetContractRegistry(dst *network.ServerIdentity) (*GetContractRegistryResponse, error) {
+	reply := &GetContractRegistryResponse{}
+	err := c.SendProtobuf(dst, &GetContractRegistry{Version: CurrentVersion}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// ResolveName asks the first node of the roster for the instance with the
+// name of the darc darcID.
+func (c *Client) ResolveName(darcID darc.ID, name string) (*ResolveNameResponse, error) {
+	reply := &ResolveNameResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &ResolveName{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		DarcID:      darcID,
+		Name:        name,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// SearchEvents asks the first node of the roster for the events emitted by
+// contractID with the given topic in the blocks from the index from to the
+// index to. Empty strings match any contract or topic, and to == 0 searches
+// until the latest block.
+func (c *Client) SearchEvents(contractID, topic string, from, to int) (*SearchEventsResponse, error) {
+	reply := &SearchEventsResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &SearchEvents{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		ContractID:  contractID,
+		Topic:       topic,
+		From:        from,
+		To:          to,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// ListBlocks asks the first node of the roster for the summaries of count
+// blocks before the block with index before, or before the latest block if
+// before == 0.
+func (c *Client) ListBlocks(before, count int) (*ListBlocksResponse, error) {
+	reply := &ListBlocksResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &ListBlocks{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		Before:      before,
+		Count:       count,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// DecodeBlock asks the first node of the roster for the summaries of the
+// transactions of the block with the given index.
+func (c *Client) DecodeBlock(index int) (*DecodeBlockResponse, error) {
+	reply := &DecodeBlockResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &DecodeBlock{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		Index:       index,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// SearchInstances asks the first node of the roster, or a replica, for the
+// instances whose ID contains the hex encoded query and the darcs whose
+// description contains it. The summaries can't be verified, GetProof has to
+// be used for the instances that are needed.
+func (c *Client) SearchInstances(query string) (*SearchInstancesResponse, error) {
+	reply := &SearchInstancesResponse{}
+	err := c.sendRead(&SearchInstances{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		Query:       query,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Backup downloads a consistent copy of the database of the conode si into
+// w. clientPriv must be the private key of a client linked to the conode,
+// e.g. with "scmgr link add".
+func (c *Client) Backup(si *network.ServerIdentity, clientPriv kyber.Scalar, w io.Writer) error {
+	req := &Backup{Version: CurrentVersion}
+	for {
+		req.Timestamp = time.Now().Unix()
+		sig, err := schnorr.Sign(cothority.Suite, clientPriv, BackupMessage(req))
+		if err != nil {
+			return err
+		}
+		req.Signature = sig
+		reply := &BackupResponse{}
+		if err = c.SendProtobuf(si, req, reply); err != nil {
+			return err
+		}
+		if _, err = w.Write(reply.Data); err != nil {
+			return err
+		}
+		req.BackupID = reply.BackupID
+		req.Offset += int64(len(reply.Data))
+		if req.Offset >= reply.Size {
+			return nil
+		}
+		if len(reply.Data) == 0 {
+			return errors.New("got an empty chunk of the backup")
+		}
+	}
+}
+
+// Restore uploads the backup read from r to the conode si, which verifies it
+// and replaces its skipchains and collections. clientPriv must be the
+// private key of a client linked to the conode.
+func (c *Client) Restore(si *network.ServerIdentity, clientPriv kyber.Scalar, r io.Reader) (*RestoreResponse, error) {
+	req := &Restore{Version: CurrentVersion}
+	buf := make([]byte, backupChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			req.Last = true
+		} else if err != nil {
+			return nil, err
+		}
+		req.Data = buf[:n]
+		req.Timestamp = time.Now().Unix()
+		req.Signature, err = schnorr.Sign(cothority.Suite, clientPriv, RestoreMessage(req))
+		if err != nil {
+			return nil, err
+		}
+		reply := &RestoreResponse{}
+		if err = c.SendProtobuf(si, req, reply); err != nil {
+			return nil, err
+		}
+		if req.Last {
+			return reply, nil
+		}
+		req.RestoreID = reply.RestoreID
+	}
+}
+
+// SetQuota sets the quota of the skipchain scID on the conode si, an empty
+// quota removes it. clientPriv must be the private key of a client linked to
+// the conode.
+func (c *Client) SetQuota(si *network.ServerIdentity, clientPriv kyber.Scalar, scID skipchain.SkipBlockID, q Quota) error {
+	req := &SetQuota{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Quota:       q,
+		Timestamp:   time.Now().Unix(),
+	}
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, SetQuotaMessage(req))
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return c.SendProtobuf(si, req, &SetQuotaResponse{})
+}
+
+// CloneChain asks the conode si to copy the instances of the skipchain scID
+// into a new skipchain with the given roster. The conode must be the first
+// node of the roster and clientPriv the key of a client linked to it. It
+// returns the genesis block and the genesis darc of the new skipchain.
+func (c *Client) CloneChain(si *network.ServerIdentity, clientPriv kyber.Scalar, scID skipchain.SkipBlockID,
+	roster *onet.Roster) (*CloneChainResponse, error) {
+	req := &CloneChain{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Roster:      *roster,
+		Timestamp:   time.Now().Unix(),
+	}
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, CloneChainMessage(req))
+	if err != nil {
+		return nil, err
+	}
+	req.Signature = sig
+	reply := &CloneChainResponse{}
+	if err := c.SendProtobuf(si, req, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Replicate makes the conode si a read replica of the skipchain scID, whose
+// genesis block is fetched from roster. If stop is true, the conode stops
+// replicating it. clientPriv must be the key of a client linked to the
+// conode.
+func (c *Client) Replicate(si *network.ServerIdentity, clientPriv kyber.Scalar, scID skipchain.SkipBlockID,
+	roster *onet.Roster, stop bool) error {
+	req := &Replicate{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Roster:      *roster,
+		Stop:        stop,
+		Timestamp:   time.Now().Unix(),
+	}
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, ReplicateMessage(req))
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return c.SendProtobuf(si, req, &ReplicateResponse{})
+}
+
+// SetAdminDarc makes the signers of the darc dID of the skipchain scID
+// administrators of the conode si, or removes the darc if dID is nil.
+// clientPriv must be the private key of a current administrator.
+func (c *Client) SetAdminDarc(si *network.ServerIdentity, clientPriv kyber.Scalar, scID skipchain.SkipBlockID,
+	dID darc.ID) error {
+	req := &SetAdminDarc{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		DarcID:      dID,
+		Timestamp:   time.Now().Unix(),
+	}
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, SetAdminDarcMessage(req))
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return c.SendProtobuf(si, req, &SetAdminDarcResponse{})
+}
+
+// GetRosterHealth asks the leader of the skipchain how responsive the nodes
+// of the roster are, and for a proposal to exclude the unreachable ones.
+func (c *Client) GetRosterHealth() (*GetRosterHealthResponse, error) {
+	reply := &GetRosterHealthResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &GetRosterHealth{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
 	}, reply)
 	if err != nil {
 		return nil, err
@@ -109,6 +515,34 @@ func (c *Client) GetProof(key []byte) (*GetProofResponse, error) {
 	return reply, nil
 }
 
+// ListChains returns the omniledger skipchains held by the conode si.
+func (c *Client) ListChains(si *network.ServerIdentity) ([]ChainInfo, error) {
+	reply := &ListChainsResponse{}
+	err := c.SendProtobuf(si, &ListChains{Version: CurrentVersion}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Chains, nil
+}
+
+// SetChainEnabled asks the conode si to stop or resume serving the skipchain
+// scID. The key adminPriv must be the one of an administrator of the conode.
+func (c *Client) SetChainEnabled(si *network.ServerIdentity, adminPriv kyber.Scalar, scID skipchain.SkipBlockID,
+	enabled bool) error {
+	req := &SetChainEnabled{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Enabled:     enabled,
+		Timestamp:   time.Now().Unix(),
+	}
+	sig, err := schnorr.Sign(cothority.Suite, adminPriv, SetChainEnabledMessage(req))
+	if err != nil {
+		return err
+	}
+	req.Signature = sig
+	return c.SendProtobuf(si, req, &SetChainEnabledResponse{})
+}
+
 // GetGenDarc uses the GetProof method to fetch the latest version of the
 // Genesis Darc from OmniLedger and parses it.
 func (c *Client) GetGenDarc() (*darc.Darc, error) {
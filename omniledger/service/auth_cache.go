@@ -0,0 +1,166 @@
+package service
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// maxAuthEvals bounds the number of evaluations an authCache holds. The cache
+// is emptied when it is full.
+const maxAuthEvals = 4096
+
+// authCache holds the darcs of a collection and the results of the evaluation
+// of their rules, so that the instructions governed by the same darc and signed
+// by the same identities are only evaluated once. The evaluations are keyed by
+// the ID of the darc, which changes with every version, the action and the set
+// of identities. As the rules can delegate to other darcs, the whole cache is
+// emptied whenever a darc of the collection changes.
+type authCache struct {
+	sync.Mutex
+	darcs map[string]*darc.Darc
+	evals map[string]error
+	// limits of the evaluations, from the configuration of the skipchain.
+	limits *darc.Limits
+	// gen is increased every time the cache is emptied, so that an
+	// evaluation that started before a change isn't stored after it.
+	gen  int
+	hits int
+}
+
+func newAuthCache() *authCache {
+	return &authCache{
+		darcs: make(map[string]*darc.Darc),
+		evals: make(map[string]error),
+	}
+}
+
+// generation returns the current generation of the cache, to be given to
+// store.
+func (a *authCache) generation() int {
+	a.Lock()
+	defer a.Unlock()
+	return a.gen
+}
+
+// invalidate empties the cache if sc changes a darc or the configuration.
+func (a *authCache) invalidate(sc *StateChange) {
+	a.Lock()
+	defer a.Unlock()
+	_, cached := a.darcs[string(sc.InstanceID)]
+	contract := string(sc.ContractID)
+	if cached || sc.StateAction == Remove || contract == ContractDarcID ||
+		contract == ContractConfigID {
+		a.reset()
+	}
+}
+
+func (a *authCache) reset() {
+	a.darcs = make(map[string]*darc.Darc)
+	a.evals = make(map[string]error)
+	a.limits = nil
+	a.gen++
+}
+
+// darcLimits returns the limits of the evaluations, calling load if they
+// aren't in the cache.
+func (a *authCache) darcLimits(load func() darc.Limits) darc.Limits {
+	a.Lock()
+	l := a.limits
+	gen := a.gen
+	a.Unlock()
+	if l != nil {
+		return *l
+	}
+	loaded := load()
+	a.Lock()
+	if a.gen == gen {
+		a.limits = &loaded
+	}
+	a.Unlock()
+	return loaded
+}
+
+// darc returns the darc stored at key, calling load if it isn't in the cache.
+func (a *authCache) darc(key []byte, load func() (*darc.Darc, error)) (*darc.Darc, error) {
+	a.Lock()
+	d, ok := a.darcs[string(key)]
+	gen := a.gen
+	a.Unlock()
+	if ok {
+		return d, nil
+	}
+	d, err := load()
+	if err != nil {
+		return nil, err
+	}
+	a.Lock()
+	if a.gen == gen {
+		a.darcs[string(key)] = d
+	}
+	a.Unlock()
+	return d, nil
+}
+
+// lookup returns the result of the evaluation stored at key, if any.
+func (a *authCache) lookup(key string) (ok bool, err error) {
+	a.Lock()
+	defer a.Unlock()
+	err, ok = a.evals[key]
+	if ok {
+		a.hits++
+	}
+	return
+}
+
+// store keeps the result of an evaluation that started at the generation gen.
+func (a *authCache) store(gen int, key string, err error) {
+	a.Lock()
+	defer a.Unlock()
+	if a.gen != gen {
+		return
+	}
+	if len(a.evals) >= maxAuthEvals {
+		a.reset()
+	}
+	a.evals[key] = err
+}
+
+// authKey returns the key of the evaluation of the rule action of d for the
+// identities ids, in any order.
+func authKey(d *darc.Darc, action darc.Action, ids []string) string {
+	sorted := append([]string{}, ids...)
+	sort.Strings(sorted)
+	return hex.EncodeToString(d.GetID()) + "/" + string(action) + "/" + strings.Join(sorted, ",")
+}
+
+// cachedDarcGetter is like darcGetter, but it loads the darcs of cdb, the
+// collection of the skipchain scID, through its cache. It sets foreign to true
+// if a darc of another skipchain is needed, as it depends on the proofs of the
+// instruction and on the chain time.
+func (s *Service) cachedDarcGetter(scID skipchain.SkipBlockID, cdb *collectionDB, foreign *bool, proofs []Proof) darc.GetDarc {
+	coll := &roCollection{cdb.coll}
+	getDarc := newDarcGetter(coll, s.chainTimeOf(coll, scID), proofs)
+	return func(str string, latest bool) *darc.Darc {
+		if strings.HasPrefix(str, "chaindarc:") {
+			*foreign = true
+			return getDarc(str, latest)
+		}
+		darcID, err := hex.DecodeString(str[5:])
+		if err != nil {
+			return nil
+		}
+		key := InstanceID{darcID, SubID{}}.Slice()
+		d, err := cdb.auth.darc(key, func() (*darc.Darc, error) {
+			return LoadDarcFromColl(coll, key)
+		})
+		if err != nil {
+			return nil
+		}
+		return d
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthCache(t *testing.T) {
+	d := darc.NewDarc(darc.InitRules(nil, nil), []byte("cache"))
+	require.Equal(t, authKey(d, "spawn:dummy", []string{"a", "b"}),
+		authKey(d, "spawn:dummy", []string{"b", "a"}))
+	require.NotEqual(t, authKey(d, "spawn:dummy", []string{"a"}),
+		authKey(d, "invoke:update", []string{"a"}))
+
+	a := newAuthCache()
+	gen := a.generation()
+	a.store(gen, "key", nil)
+	ok, err := a.lookup("key")
+	require.True(t, ok)
+	require.Nil(t, err)
+
+	// Only the changes of darcs empty the cache.
+	a.invalidate(&StateChange{StateAction: Update, InstanceID: []byte("value"), ContractID: []byte("value")})
+	ok, _ = a.lookup("key")
+	require.True(t, ok)
+	a.invalidate(&StateChange{StateAction: Update, InstanceID: []byte("darc"), ContractID: []byte(ContractDarcID)})
+	ok, _ = a.lookup("key")
+	require.False(t, ok)
+
+	// An evaluation that started before the change isn't stored.
+	a.store(gen, "key", nil)
+	ok, _ = a.lookup("key")
+	require.False(t, ok)
+}
+
+func TestService_AuthCache(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+	cache := s.service().getCollection(scID).auth
+
+	for i := 0; i < 2; i++ {
+		tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+		require.Nil(t, err)
+		require.Nil(t, s.service().verifyClientTx(scID, tx))
+	}
+	require.Equal(t, 1, cache.hits)
+
+	// The refusals are cached, too, but the signatures are always checked.
+	other := darc.NewSignerEd25519(nil, nil)
+	for i := 0; i < 2; i++ {
+		tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, other)
+		require.Nil(t, err)
+		require.NotNil(t, s.service().verifyClientTx(scID, tx))
+	}
+	require.Equal(t, 2, cache.hits)
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	tx.Instructions[0].Signatures[0].Signature[0] ^= 1
+	require.NotNil(t, s.service().verifyClientTx(scID, tx))
+}
+
+func TestAuthCache_DarcLimits(t *testing.T) {
+	a := newAuthCache()
+	var loads int
+	load := func() darc.Limits {
+		loads++
+		return darc.DefaultLimits
+	}
+	require.Equal(t, darc.DefaultLimits, a.darcLimits(load))
+	require.Equal(t, darc.DefaultLimits, a.darcLimits(load))
+	require.Equal(t, 1, loads)
+
+	// A change of the configuration can change the limits.
+	a.invalidate(&StateChange{StateAction: Update, InstanceID: []byte("config"), ContractID: []byte(ContractConfigID)})
+	a.darcLimits(load)
+	require.Equal(t, 2, loads)
+}
+
+func TestService_DarcLimits(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+	coll := s.service().GetCollectionView(scID)
+
+	spawn := func(n int) error {
+		var ids []darc.Identity
+		for i := 0; i < n; i++ {
+			ids = append(ids, darc.NewSignerEd25519(nil, nil).Identity())
+		}
+		d := darc.NewDarc(darc.InitRules(ids, nil), []byte("limits"))
+		dBuf, err := d.ToProto()
+		require.Nil(t, err)
+		_, _, err = s.service().ContractDarc(coll, Instruction{
+			InstanceID: InstanceID{DarcID: s.darc.GetBaseID()},
+			Spawn: &Spawn{
+				ContractID: ContractDarcID,
+				Args:       Arguments{{Name: "darc", Value: dBuf}},
+			},
+		}, nil)
+		return err
+	}
+	require.Nil(t, spawn(2))
+	// The limits only apply once the skipchain activated them.
+	require.Nil(t, spawn(darc.DefaultLimits.MaxIdentities+1))
+
+	config, err := s.service().LoadConfig(scID)
+	require.Nil(t, err)
+	config.MinServiceVersion = darcLimitsVersion
+	s.sendTx(t, configTx(t, s, *config))
+	for i := 0; i < 10; i++ {
+		if v, _ := s.service().ActiveServiceVersion(scID); v == darcLimitsVersion {
+			break
+		}
+		time.Sleep(s.interval)
+	}
+	coll = s.service().GetCollectionView(scID)
+	require.Nil(t, spawn(darc.DefaultLimits.MaxIdentities))
+	require.NotNil(t, spawn(darc.DefaultLimits.MaxIdentities+1))
+}
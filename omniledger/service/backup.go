@@ -0,0 +1,607 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/migration"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// backupChunkSize is the size of the chunks of a backup sent in one message.
+const backupChunkSize = 1 << 20
+
+// backupTimeout is how long an unfinished backup or restore is kept after
+// its last request.
+const backupTimeout = 10 * time.Minute
+
+// backupRetries is how many copies of the database are made before a backup
+// fails. A copy is inconsistent if it is made between the storage of a block
+// and the update of its collection.
+const backupRetries = 3
+
+// BackupMessage returns the message a linked client signs for a Backup
+// request.
+func BackupMessage(req *Backup) []byte {
+	msg := append([]byte("backup:"), req.BackupID...)
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, uint64(req.Offset))
+	binary.BigEndian.PutUint64(buf[8:], uint64(req.Timestamp))
+	return append(msg, buf...)
+}
+
+// RestoreMessage returns the message a linked client signs for a Restore
+// request.
+func RestoreMessage(req *Restore) []byte {
+	h := sha256.Sum256(req.Data)
+	msg := append([]byte("restore:"), req.RestoreID...)
+	msg = append(msg, h[:]...)
+	if req.Last {
+		msg = append(msg, 1)
+	} else {
+		msg = append(msg, 0)
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(req.Timestamp))
+	return append(msg, buf...)
+}
+
+// Backup returns a chunk of a consistent copy of the database. The copy is
+// made while the conode is running, and is removed once its last chunk has
+// been sent.
+func (s *Service) Backup(req *Backup) (*BackupResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if err := s.verifyAdmin(BackupMessage(req), req.Timestamp, req.Signature); err != nil {
+		return nil, err
+	}
+	s.backups.expire()
+
+	var f *backupFile
+	var err error
+	if len(req.BackupID) == 0 {
+		f, err = s.createBackup()
+	} else {
+		f, err = s.backups.get(req.BackupID, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.read(req.Offset, backupChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	if req.Offset+int64(len(data)) >= f.size {
+		s.backups.remove(f)
+	}
+	return &BackupResponse{
+		Version:  CurrentVersion,
+		BackupID: f.id,
+		Size:     f.size,
+		Data:     data,
+	}, nil
+}
+
+// Restore stores a chunk of a backup. With the last chunk, the backup is
+// verified and its skipchains and collections replace the ones of the
+// conode. The configuration of the services, like the linked clients, is
+// not restored.
+func (s *Service) Restore(req *Restore) (*RestoreResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if err := s.verifyAdmin(RestoreMessage(req), req.Timestamp, req.Signature); err != nil {
+		return nil, err
+	}
+	s.backups.expire()
+
+	var f *backupFile
+	var err error
+	if len(req.RestoreID) == 0 {
+		f, err = s.backups.create(filepath.Dir(s.db().Path()), true)
+	} else {
+		f, err = s.backups.get(req.RestoreID, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = f.append(req.Data); err != nil {
+		s.backups.remove(f)
+		return nil, err
+	}
+	resp := &RestoreResponse{Version: CurrentVersion, RestoreID: f.id}
+	if !req.Last {
+		return resp, nil
+	}
+	defer s.backups.remove(f)
+
+	db, err := bolt.Open(f.path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.New("couldn't open the backup: " + err.Error())
+	}
+	defer db.Close()
+	gens, err := s.verifyBackup(db)
+	if err != nil {
+		return nil, errors.New("invalid backup: " + err.Error())
+	}
+	if err = s.restoreBackup(db, gens); err != nil {
+		return nil, err
+	}
+	for _, gen := range gens {
+		resp.Skipchains = append(resp.Skipchains, gen.Hash)
+	}
+	log.Lvlf1("%s: restored %d skipchains from a backup", s.ServerIdentity(), len(gens))
+	return resp, nil
+}
+
+// createBackup copies the database into a new backup file. The copy is made
+// in a read-only transaction, so the conode keeps on running.
+func (s *Service) createBackup() (*backupFile, error) {
+	db := s.db().DB
+	var err error
+	for i := 0; i < backupRetries; i++ {
+		var f *backupFile
+		f, err = s.backups.create(filepath.Dir(db.Path()), false)
+		if err != nil {
+			return nil, err
+		}
+		err = db.View(func(tx *bolt.Tx) error {
+			return f.write(func(file *os.File) error {
+				_, err := tx.WriteTo(file)
+				return err
+			})
+		})
+		if err == nil {
+			err = f.verify(s)
+		}
+		if err == nil {
+			return f, nil
+		}
+		log.Warn(s.ServerIdentity(), "couldn't create the backup:", err)
+		s.backups.remove(f)
+	}
+	return nil, errors.New("couldn't create a consistent backup: " + err.Error())
+}
+
+// verifyBackup checks all skipchains of the backup from their genesis block,
+// and the collections of the omniledger skipchains against the root of their
+// latest block. It returns the genesis blocks of the skipchains.
+func (s *Service) verifyBackup(db *bolt.DB) ([]*skipchain.SkipBlock, error) {
+	bucket := s.db().BucketNames()[0]
+	err := db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucket) == nil {
+			return errors.New("no skipchains in the backup")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sdb := skipchain.NewSkipBlockDB(db, bucket)
+	blocks, err := sdb.GetSkipchains()
+	if err != nil {
+		return nil, err
+	}
+
+	var gens []*skipchain.SkipBlock
+	for _, sb := range blocks {
+		if sb.Index == 0 {
+			gens = append(gens, sb)
+		}
+	}
+	verified := make(map[string]bool)
+	for _, gen := range gens {
+		cp, err := sdb.GetProof(gen.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("skipchain %x: %v", gen.Hash, err)
+		}
+		if err = cp.Verify(); err != nil {
+			return nil, fmt.Errorf("skipchain %x: %v", gen.Hash, err)
+		}
+		verified[string(gen.Hash)] = true
+		if !isOmniLedger(gen) {
+			continue
+		}
+		latest := cp.Latest()
+		_, headerI, err := network.Unmarshal(latest.Data, cothority.Suite)
+		if err != nil {
+			return nil, fmt.Errorf("skipchain %x: %v", gen.Hash, err)
+		}
+		header, ok := headerI.(*DataHeader)
+		if !ok {
+			return nil, fmt.Errorf("skipchain %x: no data header in the latest block", gen.Hash)
+		}
+		cdb := newCollectionDB(db, s.backupBuckets(gen.Hash)[0])
+		if !bytes.Equal(cdb.RootHash(), header.CollectionRoot) {
+			return nil, fmt.Errorf("the collection of skipchain %x doesn't match block %d",
+				gen.Hash, latest.Index)
+		}
+	}
+	// The blocks that are not part of the proofs must be correct, too.
+	for _, sb := range blocks {
+		if !verified[string(sb.SkipChainID())] {
+			return nil, fmt.Errorf("block %x has no genesis block", sb.Hash)
+		}
+		if !sb.CalculateHash().Equal(sb.Hash) {
+			return nil, fmt.Errorf("wrong hash of block %x", sb.Hash)
+		}
+		if err = sb.VerifyForwardSignatures(); err != nil {
+			return nil, fmt.Errorf("block %x: %v", sb.Hash, err)
+		}
+	}
+	return gens, nil
+}
+
+// restoreBackup merges the skipchains of the backup into the ones of the
+// conode and replaces the collections and events of the omniledger
+// skipchains of the backup, in one transaction. A skipchain that is ahead of
+// the backup is never rolled back, and the skipchains that are not in the
+// backup are left untouched. The polling is stopped in the meantime and the
+// restored skipchains are reloaded afterwards.
+func (s *Service) restoreBackup(backup *bolt.DB, gens []*skipchain.SkipBlock) error {
+	// The latest blocks are searched by following the forward links, as
+	// the blocks stored before the index was introduced are not indexed.
+	bdb := skipchain.NewSkipBlockDB(backup, s.db().BucketNames()[0])
+	indexes := make(map[string][2]int)
+	for _, gen := range gens {
+		restored, err := bdb.GetLatestByID(gen.Hash)
+		if err != nil {
+			return err
+		}
+		current := -1
+		if sb, err := s.db().GetLatestByID(gen.Hash); err == nil {
+			current = sb.Index
+		}
+		indexes[string(gen.Hash)] = [2]int{current, restored.Index}
+	}
+
+	s.pollChanMut.Lock()
+	defer s.pollChanMut.Unlock()
+	s.stopPolling()
+	err := backup.View(func(btx *bolt.Tx) error {
+		return s.db().Update(func(tx *bolt.Tx) error {
+			return s.mergeBackup(btx, tx, gens, indexes)
+		})
+	})
+	if err != nil {
+		err = errors.New("couldn't restore the backup: " + err.Error())
+	} else {
+		err = s.reloadChains(gens)
+	}
+	if errPoll := s.startLeaderPolling(); err == nil {
+		err = errPoll
+	}
+	return err
+}
+
+// mergeBackup checks that none of the skipchains of the backup btx is
+// rolled back or has been removed from tx, then merges the skipchain buckets
+// and replaces the buckets of the omniledger skipchains. The indexes hold the
+// current and the restored index of the latest block of every skipchain of
+// the backup.
+func (s *Service) mergeBackup(btx, tx *bolt.Tx, gens []*skipchain.SkipBlock, indexes map[string][2]int) error {
+	names := s.db().BucketNames()
+	blocks, index, tombstones := names[0], names[1], names[3]
+	var replace [][]byte
+	for _, gen := range gens {
+		if b := tx.Bucket(tombstones); b != nil && b.Get(gen.Hash) != nil {
+			return fmt.Errorf("skipchain %x has been removed from this conode", gen.Hash)
+		}
+		// A block stored since the indexes were read is in the index.
+		current, restored := indexes[string(gen.Hash)][0], indexes[string(gen.Hash)][1]
+		if i := latestIndex(tx.Bucket(index), gen.Hash); i > current {
+			current = i
+		}
+		if current > restored {
+			return fmt.Errorf("skipchain %x would be rolled back from block %d to %d",
+				gen.Hash, current, restored)
+		}
+		if isOmniLedger(gen) {
+			replace = append(replace, s.backupBuckets(gen.Hash)...)
+		}
+	}
+	if b := btx.Bucket(tombstones); b != nil {
+		err := b.ForEach(func(scID, _ []byte) error {
+			if b := tx.Bucket(blocks); b != nil && b.Get(scID) != nil {
+				return fmt.Errorf("skipchain %x has been removed in the backup", scID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		b := btx.Bucket(name)
+		if b == nil {
+			continue
+		}
+		v, err := migration.Version(btx, name)
+		if err != nil {
+			return err
+		}
+		if tx.Bucket(name) != nil {
+			current, err := migration.Version(tx, name)
+			if err != nil {
+				return err
+			}
+			if current != v {
+				return fmt.Errorf("bucket %s has version %d in the backup instead of %d",
+					name, v, current)
+			}
+		}
+		if err = mergeBucket(tx, name, b); err != nil {
+			return err
+		}
+		if err = migration.SetVersion(tx, name, v); err != nil {
+			return err
+		}
+	}
+	for _, name := range replace {
+		if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if b := btx.Bucket(name); b != nil {
+			if err := copyBucket(tx, name, b); err != nil {
+				return err
+			}
+		}
+		// The buckets keep the layout of the backup.
+		v, err := migration.Version(btx, name)
+		if err != nil {
+			return err
+		}
+		if err = migration.SetVersion(tx, name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reloadChains reloads the state of the restored omniledger skipchains. The
+// caller must hold pollChanMut.
+func (s *Service) reloadChains(gens []*skipchain.SkipBlock) error {
+	s.db().ClearCache()
+	for _, gen := range gens {
+		if !isOmniLedger(gen) {
+			continue
+		}
+		if err := s.loadChain(gen.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latestIndex returns the highest index of the indexed blocks of the
+// skipchain scID in the index bucket b of the skipchain database, or -1 if
+// there are none. The keys of the index are the skipchain ID followed by the
+// big-endian index.
+func latestIndex(b *bolt.Bucket, scID skipchain.SkipBlockID) int {
+	latest := -1
+	if b == nil {
+		return latest
+	}
+	c := b.Cursor()
+	for k, _ := c.Seek(scID); k != nil && bytes.HasPrefix(k, scID) &&
+		len(k) == len(scID)+4; k, _ = c.Next() {
+		latest = int(binary.BigEndian.Uint32(k[len(scID):]))
+	}
+	return latest
+}
+
+// backupBuckets returns the names of the buckets of the collection and of
+// the events of the skipchain.
+func (s *Service) backupBuckets(scID skipchain.SkipBlockID) [][]byte {
+	idStr := fmt.Sprintf("%x", scID)
+	_, coll := s.GetAdditionalBucket([]byte(idStr))
+	_, events := s.GetAdditionalBucket([]byte("events_" + idStr))
+	return [][]byte{coll, events}
+}
+
+// isOmniLedger returns true if the genesis block is the one of an
+// omniledger skipchain.
+func isOmniLedger(gen *skipchain.SkipBlock) bool {
+	for _, x := range gen.VerifierIDs {
+		if x.Equal(verifyOmniLedger) {
+			return true
+		}
+	}
+	return false
+}
+
+// bucketCreator is implemented by bolt.Tx and bolt.Bucket.
+type bucketCreator interface {
+	CreateBucket(name []byte) (*bolt.Bucket, error)
+	CreateBucketIfNotExists(name []byte) (*bolt.Bucket, error)
+}
+
+// copyBucket copies src and its nested buckets to the new bucket name.
+func copyBucket(dst bucketCreator, name []byte, src *bolt.Bucket) error {
+	b, err := dst.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return copyBucket(b, k, src.Bucket(k))
+		}
+		return b.Put(k, v)
+	})
+}
+
+// mergeBucket puts the values of src and of its nested buckets into the
+// bucket name, which is created if needed.
+func mergeBucket(dst bucketCreator, name []byte, src *bolt.Bucket) error {
+	b, err := dst.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return mergeBucket(b, k, src.Bucket(k))
+		}
+		return b.Put(k, v)
+	})
+}
+
+// backupFile is a copy of the database that is downloaded, or a backup that
+// is uploaded.
+type backupFile struct {
+	sync.Mutex
+	id      []byte
+	path    string
+	size    int64
+	restore bool
+	touched time.Time
+}
+
+// write calls f with the file opened for writing at its end.
+func (f *backupFile) write(w func(*os.File) error) error {
+	f.Lock()
+	defer f.Unlock()
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if err = w(file); err != nil {
+		file.Close()
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.size = fi.Size()
+	return file.Close()
+}
+
+func (f *backupFile) append(data []byte) error {
+	return f.write(func(file *os.File) error {
+		_, err := file.Write(data)
+		return err
+	})
+}
+
+// read returns at most n bytes of the file, starting at offset.
+func (f *backupFile) read(offset int64, n int) ([]byte, error) {
+	f.Lock()
+	defer f.Unlock()
+	if offset < 0 || offset > f.size {
+		return nil, errors.New("offset outside of the backup")
+	}
+	if rest := f.size - offset; rest < int64(n) {
+		n = int(rest)
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	buf := make([]byte, n)
+	if _, err = file.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// verify opens the copy of the database and verifies it like a backup that
+// is restored.
+func (f *backupFile) verify(s *Service) error {
+	f.Lock()
+	defer f.Unlock()
+	db, err := bolt.Open(f.path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = s.verifyBackup(db)
+	return err
+}
+
+// backupFiles holds the ongoing backups and restores.
+type backupFiles struct {
+	sync.Mutex
+	files map[string]*backupFile
+}
+
+func newBackupFiles() backupFiles {
+	return backupFiles{files: make(map[string]*backupFile)}
+}
+
+// create returns a new empty file in dir.
+func (b *backupFiles) create(dir string, restore bool) (*backupFile, error) {
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	file, err := ioutil.TempFile(dir, "backup-")
+	if err != nil {
+		return nil, err
+	}
+	f := &backupFile{
+		id:      id,
+		path:    file.Name(),
+		restore: restore,
+		touched: time.Now(),
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(f.path)
+		return nil, err
+	}
+	b.Lock()
+	b.files[string(id)] = f
+	b.Unlock()
+	return f, nil
+}
+
+func (b *backupFiles) get(id []byte, restore bool) (*backupFile, error) {
+	b.Lock()
+	defer b.Unlock()
+	f, ok := b.files[string(id)]
+	if !ok || f.restore != restore {
+		return nil, errors.New("unknown backup")
+	}
+	f.touched = time.Now()
+	return f, nil
+}
+
+func (b *backupFiles) remove(f *backupFile) {
+	b.Lock()
+	delete(b.files, string(f.id))
+	b.Unlock()
+	if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		log.Error("couldn't remove backup:", err)
+	}
+}
+
+// expire removes the files that haven't been used for backupTimeout.
+func (b *backupFiles) expire() {
+	var expired []*backupFile
+	b.Lock()
+	for _, f := range b.files {
+		if time.Since(f.touched) > backupTimeout {
+			expired = append(expired, f)
+		}
+	}
+	b.Unlock()
+	for _, f := range expired {
+		b.remove(f)
+	}
+}
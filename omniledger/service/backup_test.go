@@ -0,0 +1,143 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_BackupRestore(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	// The backup and restore happen on a follower.
+	host := s.hosts[1]
+	cl := NewClient()
+	tx1, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx1)
+	require.True(t, s.waitProofWithIdx(t, tx1.Instructions[0].InstanceID, 1).InclusionProof.Match())
+
+	// A linked client is needed.
+	kp := key.NewKeyPair(cothority.Suite)
+	var buf bytes.Buffer
+	require.NotNil(t, cl.Backup(host.ServerIdentity, kp.Private, &buf))
+	require.Nil(t, skipchain.NewClient().CreateLinkPrivate(host.ServerIdentity,
+		s.local.GetPrivate(host), kp.Public))
+	require.NotNil(t, cl.Backup(host.ServerIdentity, key.NewKeyPair(cothority.Suite).Private, &buf))
+	buf.Reset()
+	require.Nil(t, cl.Backup(host.ServerIdentity, kp.Private, &buf))
+	backup := buf.Bytes()
+
+	tx2, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, []byte("value2"), s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx2)
+	require.True(t, s.waitProofWithIdx(t, tx2.Instructions[0].InstanceID, 1).InclusionProof.Match())
+
+	// A backup whose collection has been modified is refused.
+	_, err = cl.Restore(host.ServerIdentity, kp.Private, bytes.NewReader(tamper(t, backup,
+		s.services[1].backupBuckets(s.sb.SkipChainID())[0])))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "doesn't match")
+
+	// The backup would roll the skipchain back.
+	_, err = cl.Restore(host.ServerIdentity, kp.Private, bytes.NewReader(backup))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "rolled back")
+
+	buf.Reset()
+	require.Nil(t, cl.Backup(host.ServerIdentity, kp.Private, &buf))
+	backup = buf.Bytes()
+	// A skipchain that is not in the backup is kept.
+	other := skipchain.NewSkipBlock()
+	other.Roster = s.roster
+	other.Data = []byte("other")
+	other.Hash = other.CalculateHash()
+	s.services[1].db().Store(other)
+
+	resp, err := cl.Restore(host.ServerIdentity, kp.Private, bytes.NewReader(backup))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(resp.Skipchains))
+	require.True(t, resp.Skipchains[0].Equal(s.sb.SkipChainID()))
+	require.NotNil(t, s.services[1].db().GetByID(other.Hash))
+	for _, tx := range []ClientTransaction{tx1, tx2} {
+		pr, err := s.services[1].GetProof(&GetProof{
+			Version: CurrentVersion,
+			Key:     tx.Instructions[0].InstanceID.Slice(),
+			ID:      s.sb.SkipChainID(),
+		})
+		require.Nil(t, err)
+		require.True(t, pr.Proof.InclusionProof.Match())
+		require.Nil(t, pr.Proof.Verify(s.sb.SkipChainID()))
+	}
+
+	// The service keeps on adding blocks after the restore.
+	tx3, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, []byte("value3"), s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx3)
+	require.True(t, s.waitProofWithIdx(t, tx3.Instructions[0].InstanceID, 1).InclusionProof.Match())
+}
+
+func TestLatestIndex(t *testing.T) {
+	f, err := ioutil.TempFile("", "index")
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+	defer os.Remove(f.Name())
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	require.Nil(t, err)
+	defer db.Close()
+
+	scID := skipchain.SkipBlockID(bytes.Repeat([]byte{1}, 32))
+	other := skipchain.SkipBlockID(bytes.Repeat([]byte{2}, 32))
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		require.Equal(t, -1, latestIndex(tx.Bucket([]byte("index")), scID))
+		b, err := tx.CreateBucket([]byte("index"))
+		require.Nil(t, err)
+		for _, i := range []uint32{0, 1, 256, 2} {
+			key := make([]byte, 36)
+			copy(key, scID)
+			binary.BigEndian.PutUint32(key[32:], i)
+			require.Nil(t, b.Put(key, []byte{1}))
+		}
+		key := make([]byte, 36)
+		copy(key, other)
+		binary.BigEndian.PutUint32(key[32:], 1000)
+		require.Nil(t, b.Put(key, []byte{1}))
+
+		require.Equal(t, 256, latestIndex(b, scID))
+		require.Equal(t, 1000, latestIndex(b, other))
+		require.Equal(t, -1, latestIndex(b, skipchain.SkipBlockID(bytes.Repeat([]byte{3}, 32))))
+		return nil
+	}))
+}
+
+// tamper returns a copy of the backup where a value of the bucket is
+// changed.
+func tamper(t *testing.T, backup []byte, bucket []byte) []byte {
+	f, err := ioutil.TempFile("", "backup")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(backup)
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	require.Nil(t, err)
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		k, _ := b.Cursor().First()
+		return b.Put(append([]byte{}, k...), []byte("tampered"))
+	}))
+	require.Nil(t, db.Close())
+	buf, err := ioutil.ReadFile(f.Name())
+	require.Nil(t, err)
+	return buf
+}
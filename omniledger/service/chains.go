@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+)
+
+// The roles of a conode in a skipchain, as returned by ListChains.
+const (
+	// RoleLeader is the first node of the roster, it creates the blocks.
+	RoleLeader = "leader"
+	// RoleFollower is another node of the roster, it signs the blocks.
+	RoleFollower = "follower"
+	// RoleObserver isn't in the roster, like a read replica.
+	RoleObserver = "observer"
+)
+
+// ErrChainDisabled is returned to the clients of a skipchain that the conode
+// stopped serving.
+var ErrChainDisabled = errors.New("the skipchain is disabled on this conode")
+
+// ListChains returns the omniledger skipchains held by the conode, with its
+// role in each of them and the storage they use.
+func (s *Service) ListChains(req *ListChains) (*ListChainsResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	chains := s.state.chains()
+	sort.Slice(chains, func(i, j int) bool {
+		return bytes.Compare(chains[i], chains[j]) < 0
+	})
+	resp := &ListChainsResponse{Version: CurrentVersion}
+	for _, scID := range chains {
+		info, err := s.chainInfo(scID)
+		if err != nil {
+			log.Warnf("%s: couldn't describe %x: %s", s.ServerIdentity(), scID, err)
+			continue
+		}
+		resp.Chains = append(resp.Chains, *info)
+	}
+	return resp, nil
+}
+
+// chainInfo describes the skipchain scID as seen by this conode.
+func (s *Service) chainInfo(scID skipchain.SkipBlockID) (*ChainInfo, error) {
+	latest, err := s.db().GetLatestByID(scID)
+	if err != nil {
+		return nil, err
+	}
+	gd, err := s.LoadGenesisDarc(scID)
+	if err != nil {
+		return nil, err
+	}
+	size, instances, err := s.storageUsage(scID)
+	if err != nil {
+		return nil, err
+	}
+	role := RoleObserver
+	if i, _ := latest.Roster.Search(s.ServerIdentity().ID); i == 0 {
+		role = RoleLeader
+	} else if i > 0 {
+		role = RoleFollower
+	}
+	return &ChainInfo{
+		SkipchainID: scID,
+		Role:        role,
+		GenesisDarc: gd.GetBaseID(),
+		Index:       latest.Index,
+		Bytes:       size,
+		Instances:   instances,
+		Enabled:     s.chainEnabled(scID),
+	}, nil
+}
+
+// SetChainEnabledMessage returns the message an administrator signs for a
+// SetChainEnabled request.
+func SetChainEnabledMessage(req *SetChainEnabled) []byte {
+	msg := append([]byte("chainenabled:"), req.SkipchainID...)
+	buf := make([]byte, 9)
+	if req.Enabled {
+		buf[0] = 1
+	}
+	binary.BigEndian.PutUint64(buf[1:], uint64(req.Timestamp))
+	return append(msg, buf...)
+}
+
+// SetChainEnabled stops or resumes serving a skipchain. The data of a
+// disabled skipchain is kept and the new blocks propagated by the roster are
+// still stored, but the conode refuses the requests of the clients, doesn't
+// create or sign blocks and doesn't hand its transactions to the leader.
+// Only an administrator of the conode can enable or disable a skipchain.
+func (s *Service) SetChainEnabled(req *SetChainEnabled) (*SetChainEnabledResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if err := s.verifyAdmin(SetChainEnabledMessage(req), req.Timestamp, req.Signature); err != nil {
+		return nil, err
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("not an omniledger skipchain")
+	}
+
+	s.storage.Lock()
+	if req.Enabled {
+		delete(s.storage.Disabled, string(req.SkipchainID))
+	} else {
+		if s.storage.Disabled == nil {
+			s.storage.Disabled = make(map[string]bool)
+		}
+		s.storage.Disabled[string(req.SkipchainID)] = true
+	}
+	s.storage.Unlock()
+	s.save()
+	log.Lvlf1("%s: serving of %x set to %t", s.ServerIdentity(), req.SkipchainID, req.Enabled)
+	return &SetChainEnabledResponse{Version: CurrentVersion}, nil
+}
+
+// chainEnabled returns false if the conode stopped serving the skipchain
+// scID.
+func (s *Service) chainEnabled(scID skipchain.SkipBlockID) bool {
+	s.storage.Lock()
+	defer s.storage.Unlock()
+	return !s.storage.Disabled[string(scID)]
+}
+
+// checkEnabled returns ErrChainDisabled if the conode stopped serving the
+// skipchain scID.
+func (s *Service) checkEnabled(scID skipchain.SkipBlockID) error {
+	if !s.chainEnabled(scID) {
+		return ErrChainDisabled
+	}
+	return nil
+}
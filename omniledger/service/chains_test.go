@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ListChains(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+
+	cl := NewClient()
+	chains, err := cl.ListChains(s.hosts[0].ServerIdentity)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(chains))
+	c := chains[0]
+	require.True(t, c.SkipchainID.Equal(scID))
+	require.Equal(t, RoleLeader, c.Role)
+	require.Equal(t, s.darc.GetBaseID(), c.GenesisDarc)
+	require.True(t, c.Bytes > 0)
+	require.True(t, c.Instances > 0)
+	require.True(t, c.Enabled)
+
+	chains, err = cl.ListChains(s.hosts[1].ServerIdentity)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(chains))
+	require.Equal(t, RoleFollower, chains[0].Role)
+}
+
+func TestService_SetChainEnabled(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+	host := s.hosts[0]
+
+	cl := NewClient()
+	kp := key.NewKeyPair(cothority.Suite)
+	require.NotNil(t, cl.SetChainEnabled(host.ServerIdentity, kp.Private, scID, false))
+	require.Nil(t, skipchain.NewClient().CreateLinkPrivate(host.ServerIdentity,
+		s.local.GetPrivate(host), kp.Public))
+	require.NotNil(t, cl.SetChainEnabled(host.ServerIdentity, kp.Private, []byte("unknown"), false))
+	require.Nil(t, cl.SetChainEnabled(host.ServerIdentity, kp.Private, scID, false))
+
+	chains, err := cl.ListChains(host.ServerIdentity)
+	require.Nil(t, err)
+	require.False(t, chains[0].Enabled)
+	getProof := func() error {
+		_, err := s.service().GetProof(&GetProof{
+			Version: CurrentVersion,
+			Key:     InstanceID{DarcID: s.darc.GetBaseID()}.Slice(),
+			ID:      scID,
+		})
+		return err
+	}
+	require.Equal(t, ErrChainDisabled, getProof())
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	_, err = s.service().AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Transaction: tx,
+	})
+	require.Equal(t, ErrChainDisabled, err)
+
+	// The data is still there once the skipchain is enabled again.
+	require.Nil(t, cl.SetChainEnabled(host.ServerIdentity, kp.Private, scID, true))
+	require.Nil(t, getProof())
+	s.sendTx(t, tx)
+	pr := s.waitProof(t, tx.Instructions[0].InstanceID)
+	require.True(t, pr.InclusionProof.Match())
+}
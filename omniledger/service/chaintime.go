@@ -0,0 +1,109 @@
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+// chainTimeVersion is the ServiceVersion from which the chain time instance
+// is updated.
+const chainTimeVersion = 2
+
+// ContractChainTimeID is the contract of the chain time instance. No contract
+// is registered with this ID, so no instruction can change the instance.
+var ContractChainTimeID = "chaintime"
+
+// ChainTimeID is the instance that holds the timestamp and the index of the
+// latest block. It is updated by all the nodes once they executed the
+// transactions of a block, as soon as the skipchain activated the version 2
+// of the service.
+var ChainTimeID = InstanceID{
+	DarcID: zeroDarc,
+	SubID:  SubID(sha256.Sum256([]byte(ContractChainTimeID))),
+}
+
+// LoadChainTime returns the value of the chain time instance in coll. Unlike
+// ChainTime, it can be used outside of the contracts, for example on a
+// CollectionView of the service, and it also returns the index of the block.
+func LoadChainTime(coll CollectionView) (*ChainTimeValue, error) {
+	val, contract, err := getValueContract(coll, ChainTimeID.Slice())
+	if err != nil {
+		return nil, errors.New("no chain time: " + err.Error())
+	}
+	if string(contract) != ContractChainTimeID {
+		return nil, errors.New("did not get " + ContractChainTimeID)
+	}
+	var ct ChainTimeValue
+	if err := protobuf.Decode(val, &ct); err != nil {
+		return nil, err
+	}
+	return &ct, nil
+}
+
+// storedChainTime returns the timestamp of the chain time instance of coll,
+// or false if the skipchain didn't activate chainTimeVersion or if the
+// instance hasn't been written yet.
+func storedChainTime(coll CollectionView) (int64, bool) {
+	config, err := LoadConfigFromColl(coll)
+	if err != nil || config.MinServiceVersion < chainTimeVersion {
+		return 0, false
+	}
+	ct, err := LoadChainTime(coll)
+	if err != nil {
+		return 0, false
+	}
+	return ct.Timestamp, true
+}
+
+// UnixNano returns the time of the block in unix nanoseconds. The blocks
+// created before TimestampNano only have the Timestamp in seconds.
+func (h *DataHeader) UnixNano() int64 {
+	if h.TimestampNano != 0 {
+		return h.TimestampNano
+	}
+	return h.Timestamp * int64(time.Second)
+}
+
+// blockInfo is the block whose transactions are executed.
+type blockInfo struct {
+	index     int
+	timestamp int64
+}
+
+// chainTimeChange returns the state change that stores the block b in the
+// chain time instance of coll, or nil if the skipchain didn't activate
+// chainTimeVersion.
+func chainTimeChange(coll CollectionView, b *blockInfo) (*StateChange, error) {
+	config, err := LoadConfigFromColl(coll)
+	if err != nil || config.MinServiceVersion < chainTimeVersion {
+		return nil, nil
+	}
+	buf, err := protobuf.Encode(&ChainTimeValue{
+		Timestamp:  b.timestamp,
+		BlockIndex: b.index,
+	})
+	if err != nil {
+		return nil, err
+	}
+	action := Update
+	if _, _, err := getValueContract(coll, ChainTimeID.Slice()); err != nil {
+		action = Create
+	}
+	sc := NewStateChange(action, ChainTimeID, ContractChainTimeID, buf)
+	return &sc, nil
+}
+
+// txStateChanges returns the number of state changes of scs that come from
+// the transactions.
+func txStateChanges(scs StateChanges) int {
+	var n int
+	for _, sc := range scs {
+		if string(sc.ContractID) != ContractChainTimeID {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ChainTime(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+
+	// The instance only exists once the version is active.
+	_, err := LoadChainTime(s.service().GetCollectionView(scID))
+	require.NotNil(t, err)
+	config, err := s.service().LoadConfig(scID)
+	require.Nil(t, err)
+	config.MinServiceVersion = chainTimeVersion
+	s.sendTx(t, configTx(t, s, *config))
+	for i := 0; i < 10; i++ {
+		if v, _ := s.service().ActiveServiceVersion(scID); v == chainTimeVersion {
+			break
+		}
+		time.Sleep(s.interval)
+	}
+
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx)
+	for i := range s.services {
+		s.waitProofWithIdx(t, tx.Instructions[0].InstanceID, i)
+	}
+
+	latest, err := s.service().db().GetLatestByID(scID)
+	require.Nil(t, err)
+	_, headerI, err := network.Unmarshal(latest.Data, cothority.Suite)
+	require.Nil(t, err)
+	for _, service := range s.services {
+		ct, err := LoadChainTime(service.GetCollectionView(scID))
+		require.Nil(t, err)
+		require.Equal(t, latest.Index, ct.BlockIndex)
+		require.Equal(t, headerI.(*DataHeader).UnixNano(), ct.Timestamp)
+	}
+
+	// The expiration and the contracts use the instance, not the header.
+	ct, err := LoadChainTime(s.service().GetCollectionView(scID))
+	require.Nil(t, err)
+	require.Equal(t, ct.Timestamp, s.service().chainTime(scID))
+	now, err := ChainTime(&contractView{CollectionView: s.service().GetCollectionView(scID), chainTime: 1})
+	require.Nil(t, err)
+	require.Equal(t, ct.Timestamp, now.UnixNano())
+
+	// Nobody can change the instance.
+	_, _, err = s.service().executeInstruction(s.service().GetCollectionView(scID), nil, Instruction{
+		InstanceID: ChainTimeID,
+		Invoke:     &Invoke{Command: "update"},
+	})
+	require.NotNil(t, err)
+}
+
+func TestDataHeader_UnixNano(t *testing.T) {
+	// The blocks created before TimestampNano only have seconds.
+	h := &DataHeader{Timestamp: 1500000000}
+	require.Equal(t, int64(1500000000)*int64(time.Second), h.UnixNano())
+	h.TimestampNano = 1500000000123456789
+	require.Equal(t, int64(1500000000123456789), h.UnixNano())
+}
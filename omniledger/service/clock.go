@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/skipchain"
+)
+
+// produceTimeout is how long ProduceBlock waits for the polling go-routine of
+// the skipchain to take the request.
+var produceTimeout = 10 * time.Second
+
+// Clock is the time source of the block production: the leader waits for the
+// block interval and the protocol timeouts with After, and the timestamps of
+// the blocks come from Now. The default uses the system clock, tests can
+// replace it with a ManualClock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// serviceClock protects the Clock of the service, as it can be changed while
+// the polling go-routines run.
+type serviceClock struct {
+	sync.Mutex
+	Clock
+}
+
+func (c *serviceClock) get() Clock {
+	c.Lock()
+	defer c.Unlock()
+	return c.Clock
+}
+
+// SetClock replaces the time source of the block production. With a
+// ManualClock, the leader only produces a block when the clock is advanced
+// past the block interval, or when ProduceBlock is called, which makes the
+// tests of contracts fast and deterministic. The heartbeats and the view
+// changes still use the system clock.
+func (s *Service) SetClock(c Clock) {
+	s.clock.Lock()
+	s.clock.Clock = c
+	s.clock.Unlock()
+}
+
+// ProduceBlock makes the leader of the skipchain scID collect the
+// transactions and produce a block now, without waiting for the block
+// interval. It must be called on the leader, and returns once the block has
+// been stored by the roster, or right away if there were no transactions.
+// With a ManualClock, the leader waits for the answers of all the nodes,
+// unless the clock is advanced past the protocol timeout.
+func (s *Service) ProduceBlock(scID skipchain.SkipBlockID) error {
+	done := make(chan bool)
+	select {
+	case s.triggers.get(scID) <- done:
+	case <-time.After(produceTimeout):
+		return errors.New("the conode doesn't produce the blocks of this skipchain")
+	}
+	<-done
+	return nil
+}
+
+// blockTriggers holds, for every skipchain, the channel of the requests of
+// ProduceBlock. A request is closed once its block has been produced.
+type blockTriggers struct {
+	sync.Mutex
+	chans map[string]chan chan bool
+}
+
+func newBlockTriggers() blockTriggers {
+	return blockTriggers{chans: make(map[string]chan chan bool)}
+}
+
+func (b *blockTriggers) get(scID skipchain.SkipBlockID) chan chan bool {
+	b.Lock()
+	defer b.Unlock()
+	c, ok := b.chans[string(scID)]
+	if !ok {
+		c = make(chan chan bool)
+		b.chans[string(scID)] = c
+	}
+	return c
+}
+
+// ManualClock is a Clock that only moves forward when Advance is called. It
+// can be given to SetClock to test contracts without waiting for the block
+// interval.
+type ManualClock struct {
+	sync.Mutex
+	now    time.Time
+	timers []manualTimer
+}
+
+type manualTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewManualClock returns a ManualClock set to now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+// After returns a channel that gets the time once the clock has been
+// advanced by at least d.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.Lock()
+	defer c.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, manualTimer{at: c.now.Add(d), c: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d and fires the timers that expired.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	var timers []manualTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			timers = append(timers, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	c.timers = timers
+}
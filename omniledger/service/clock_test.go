@@ -0,0 +1,74 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewManualClock(start)
+	after := c.After(time.Second)
+	select {
+	case <-after:
+		require.Fail(t, "the timer fired too early")
+	default:
+	}
+	c.Advance(time.Second / 2)
+	require.Equal(t, start.Add(time.Second/2), c.Now())
+	require.Equal(t, 1, len(c.timers))
+	c.Advance(time.Second / 2)
+	require.Equal(t, start.Add(time.Second), <-after)
+	require.Equal(t, 0, len(c.timers))
+	require.Equal(t, c.Now(), <-c.After(0))
+}
+
+func TestService_ProduceBlock(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+
+	c := NewManualClock(time.Unix(1000, 0))
+	for _, service := range s.services {
+		service.SetClock(c)
+	}
+	// Let the timer of the system clock expire.
+	time.Sleep(2 * s.interval)
+
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx)
+	time.Sleep(2 * s.interval)
+	pr, err := s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		Key:     tx.Instructions[0].InstanceID.Slice(),
+		ID:      scID,
+	})
+	require.Nil(t, err)
+	require.False(t, pr.Proof.InclusionProof.Match())
+
+	require.Nil(t, s.service().ProduceBlock(scID))
+	pr, err = s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		Key:     tx.Instructions[0].InstanceID.Slice(),
+		ID:      scID,
+	})
+	require.Nil(t, err)
+	require.True(t, pr.Proof.InclusionProof.Match())
+
+	latest, err := s.service().db().GetLatestByID(scID)
+	require.Nil(t, err)
+	_, headerI, err := network.Unmarshal(latest.Data, cothority.Suite)
+	require.Nil(t, err)
+	require.Equal(t, c.Now().UnixNano(), headerI.(*DataHeader).UnixNano())
+	require.Equal(t, c.Now().Unix(), headerI.(*DataHeader).Timestamp)
+
+	// Only the leader produces blocks.
+	defer func(d time.Duration) { produceTimeout = d }(produceTimeout)
+	produceTimeout = s.interval
+	require.NotNil(t, s.services[1].ProduceBlock(scID))
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// A clone is a new skipchain that starts with a copy of the instances of an
+// existing skipchain, so that new contracts can be tested on realistic data.
+// The clone has its own genesis darc: the instances of the genesis darc of
+// the original skipchain are moved to the new genesis darc, all the other
+// instances keep their ID. The values are copied as they are, so a value
+// that refers to the original genesis darc, like a rule of another darc,
+// still refers to it in the clone.
+
+// ContractCloneID denotes the contract that copies the instances into a
+// clone.
+var ContractCloneID = "clone"
+
+// cloneBatchSize is the maximum size of the values copied in one block of
+// the clone.
+const cloneBatchSize = 256 * 1024
+
+// cloneDoneSubID is the SubID of the instance that marks the end of the
+// copy, under the genesis darc of the clone.
+var cloneDoneSubID = func() SubID {
+	h := sha256.Sum256([]byte(ContractCloneID))
+	return SubID(h)
+}()
+
+// cloneBatch is the argument "instances" of the clone contract.
+type cloneBatch struct {
+	Instances []StateChange
+	// Source is the ID of the original skipchain, only set in the last
+	// batch.
+	Source []byte
+}
+
+// CloneChainMessage returns the message a linked client signs for a
+// CloneChain request.
+func CloneChainMessage(req *CloneChain) []byte {
+	msg := append([]byte("clone:"), req.SkipchainID...)
+	msg = append(msg, req.Roster.ID[:]...)
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(req.Timestamp))
+	return append(msg, buf...)
+}
+
+// CloneChain creates a new skipchain with the roster of the request and
+// copies the instances of an existing skipchain into it. It must be sent to
+// the first node of the new roster, which must also hold the original
+// skipchain. Only a client linked to the conode can clone a skipchain.
+func (s *Service) CloneChain(req *CloneChain) (*CloneChainResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if err := s.verifyAdmin(CloneChainMessage(req), req.Timestamp, req.Signature); err != nil {
+		return nil, err
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("not an omniledger skipchain")
+	}
+	if len(req.Roster.List) == 0 || !req.Roster.List[0].Equal(s.ServerIdentity()) {
+		return nil, errors.New("the conode must be the first node of the roster")
+	}
+
+	oldDarc, err := s.LoadGenesisDarc(req.SkipchainID)
+	if err != nil {
+		return nil, err
+	}
+	interval, err := s.LoadBlockInterval(req.SkipchainID)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := s.cloneInstances(req.SkipchainID, oldDarc.GetBaseID())
+	if err != nil {
+		return nil, err
+	}
+
+	// The conode copies the instances with the "spawn:clone" rule of the
+	// new genesis darc. A new description gives it a new ID.
+	signer := darc.NewSignerEd25519(s.ServerIdentity().Public, s.getPrivateKey())
+	newDarc := darc.NewDarc(oldDarc.Copy().Rules,
+		append(append([]byte{}, oldDarc.Description...), []byte(" (clone)")...))
+	if err := newDarc.Rules.AddRule(darc.Action("spawn:"+ContractCloneID),
+		expression.InitOrExpr(signer.Identity().String())); err != nil {
+		return nil, err
+	}
+	genesis, err := s.CreateGenesisBlock(&CreateGenesisBlock{
+		Version:       CurrentVersion,
+		Roster:        req.Roster,
+		GenesisDarc:   *newDarc,
+		BlockInterval: interval,
+	})
+	if err != nil {
+		return nil, err
+	}
+	scID := genesis.Skipblock.SkipChainID()
+	newID := newDarc.GetBaseID()
+	log.Lvlf1("%s: cloning %d instances of %x into %x", s.ServerIdentity(), len(instances),
+		req.SkipchainID, scID)
+
+	count := len(instances)
+	for len(instances) > 0 {
+		batch := cloneBatch{}
+		size := 0
+		for len(instances) > 0 && (len(batch.Instances) == 0 || size+len(instances[0].Value) <= cloneBatchSize) {
+			sc := instances[0]
+			instances = instances[1:]
+			if id := NewInstanceID(sc.InstanceID); id.DarcID.Equal(oldDarc.GetBaseID()) {
+				sc.InstanceID = InstanceID{DarcID: newID, SubID: id.SubID}.Slice()
+			}
+			batch.Instances = append(batch.Instances, sc)
+			size += len(sc.Value)
+		}
+		if len(instances) == 0 {
+			batch.Source = req.SkipchainID
+		}
+		if err := s.cloneBlock(scID, genesis.Skipblock, newID, batch, signer); err != nil {
+			return nil, fmt.Errorf("couldn't clone the instances: %v", err)
+		}
+	}
+
+	return &CloneChainResponse{
+		Version:     CurrentVersion,
+		Skipblock:   genesis.Skipblock,
+		GenesisDarc: *newDarc,
+		Instances:   count,
+	}, nil
+}
+
+// cloneInstances returns the instances of the skipchain scID that are
+// copied into a clone. The genesis reference, the configuration and the
+// genesis darc belong to the skipchain and are left out, as well as the
+// marker of a skipchain that is a clone itself.
+func (s *Service) cloneInstances(scID skipchain.SkipBlockID, genesisID darc.ID) ([]StateChange, error) {
+	skip := [][]byte{
+		GenesisReferenceID.Slice(),
+		InstanceID{DarcID: genesisID, SubID: oneSubID}.Slice(),
+		InstanceID{DarcID: genesisID}.Slice(),
+	}
+	var instances []StateChange
+	cdb := s.getCollection(scID)
+	err := cdb.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(cdb.bucketName)
+		cur := b.Cursor()
+	next:
+		for k, v := cur.Seek([]byte{collValuePrefix}); k != nil && k[0] == collValuePrefix; k, v = cur.Next() {
+			k = k[1:]
+			for _, id := range skip {
+				if bytes.Equal(k, id) {
+					continue next
+				}
+			}
+			cv := b.Get(collContractKey(k))
+			if cv == nil || string(cv) == ContractCloneID {
+				continue
+			}
+			instances = append(instances, NewStateChange(Create, NewInstanceID(dup(k)),
+				string(cv), dup(v)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("couldn't read the instances: " + err.Error())
+	}
+	return instances, nil
+}
+
+// cloneBlock adds a block with a batch of instances to the clone scID.
+func (s *Service) cloneBlock(scID skipchain.SkipBlockID, genesis *skipchain.SkipBlock,
+	darcID darc.ID, batch cloneBatch, signer darc.Signer) error {
+	buf, err := protobuf.Encode(&batch)
+	if err != nil {
+		return err
+	}
+	ct := ClientTransaction{
+		Instructions: []Instruction{{
+			InstanceID: InstanceID{DarcID: darcID},
+			Nonce:      GenNonce(),
+			Index:      0,
+			Length:     1,
+			Spawn: &Spawn{
+				ContractID: ContractCloneID,
+				Args:       Arguments{{Name: "instances", Value: buf}},
+			},
+		}},
+	}
+	if err := ct.Instructions[0].SignWith(scID, signer); err != nil {
+		return err
+	}
+	_, err = s.createNewBlock(scID, genesis.Roster, ClientTransactions{ct}, nil, nil, 0, 0, 0)
+	return err
+}
+
+// contractClone accepts the following instruction:
+//   - Spawn - sent to the genesis darc of a clone, creates the instances in
+//     the argument "instances". Once the last batch is copied, the contract
+//     refuses new instances.
+var contractClone = BasicContract{
+	SpawnFn: cloneSpawn,
+}
+
+func cloneSpawn(coll CollectionView, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	var batch cloneBatch
+	if err := protobuf.Decode(inst.Spawn.Args.Search("instances"), &batch); err != nil {
+		return nil, nil, errors.New("couldn't decode the instances: " + err.Error())
+	}
+	darcID := inst.InstanceID.DarcID
+	// The "spawn:clone" rule lets its signers create any instance, so only
+	// the genesis darc of a clone may hold it.
+	genesisID, _, err := coll.GetValues(GenesisReferenceID.Slice())
+	if err != nil || !darcID.Equal(genesisID) {
+		return nil, nil, errors.New("instances can only be cloned by the genesis darc")
+	}
+	done := InstanceID{DarcID: darcID, SubID: cloneDoneSubID}
+	if _, _, err := coll.GetValues(done.Slice()); err == nil {
+		return nil, nil, errors.New("the clone is already done")
+	}
+	reserved := [][]byte{
+		GenesisReferenceID.Slice(),
+		InstanceID{DarcID: darcID, SubID: oneSubID}.Slice(),
+		InstanceID{DarcID: darcID}.Slice(),
+	}
+	var sc []StateChange
+	for _, c := range batch.Instances {
+		if c.StateAction != Create || len(c.InstanceID) != 64 {
+			return nil, nil, errors.New("only new instances can be cloned")
+		}
+		for _, id := range reserved {
+			if bytes.Equal(c.InstanceID, id) {
+				return nil, nil, fmt.Errorf("instance %x is reserved", c.InstanceID)
+			}
+		}
+		if _, _, err := coll.GetValues(c.InstanceID); err == nil {
+			return nil, nil, fmt.Errorf("instance %x already exists", c.InstanceID)
+		}
+		sc = append(sc, c)
+	}
+	if batch.Source != nil {
+		sc = append(sc, NewStateChange(Create, done, ContractCloneID, batch.Source))
+	}
+	return sc, coins, nil
+}
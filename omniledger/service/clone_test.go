@@ -0,0 +1,83 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_CloneChain(t *testing.T) {
+	s := newSer(t, 2, testInterval)
+	defer s.local.CloseAll()
+
+	id := s.tx.Instructions[0].InstanceID
+	require.True(t, s.waitProof(t, id).InclusionProof.Match())
+
+	host := s.hosts[0]
+	kp := key.NewKeyPair(cothority.Suite)
+	require.Nil(t, skipchain.NewClient().CreateLinkPrivate(host.ServerIdentity,
+		s.local.GetPrivate(host), kp.Public))
+	cl := NewClient()
+	scID := s.sb.SkipChainID()
+
+	// Only a linked client can clone, and only on the leader of the clone.
+	_, err := cl.CloneChain(host.ServerIdentity, key.NewKeyPair(cothority.Suite).Private, scID, s.roster)
+	require.NotNil(t, err)
+	other := onet.NewRoster(append(s.roster.List[1:], s.roster.List[0]))
+	_, err = cl.CloneChain(host.ServerIdentity, kp.Private, scID, other)
+	require.NotNil(t, err)
+
+	resp, err := cl.CloneChain(host.ServerIdentity, kp.Private, scID, s.roster)
+	require.Nil(t, err)
+	require.Equal(t, 1, resp.Instances)
+	cloneID := resp.Skipblock.SkipChainID()
+	require.False(t, cloneID.Equal(scID))
+	genesis, err := s.service().LoadGenesisDarc(cloneID)
+	require.Nil(t, err)
+	require.Equal(t, resp.GenesisDarc.GetBaseID(), genesis.GetBaseID())
+	require.NotEqual(t, s.darc.GetBaseID(), genesis.GetBaseID())
+
+	// The instance of the genesis darc is moved to the new one.
+	newIID := InstanceID{DarcID: genesis.GetBaseID(), SubID: id.SubID}
+	var pr Proof
+	for i := 0; i < 10; i++ {
+		reply, err := s.service().GetProof(&GetProof{
+			Version: CurrentVersion,
+			Key:     newIID.Slice(),
+			ID:      cloneID,
+		})
+		require.Nil(t, err)
+		pr = reply.Proof
+		if pr.InclusionProof.Match() {
+			break
+		}
+		time.Sleep(s.interval)
+	}
+	require.True(t, pr.InclusionProof.Match())
+	_, vs, err := pr.KeyValue()
+	require.Nil(t, err)
+	require.Equal(t, s.value, vs[0])
+	_, _, err = s.service().GetCollectionView(cloneID).GetValues(id.Slice())
+	require.NotNil(t, err)
+
+	// A finished clone refuses new instances.
+	buf, err := protobuf.Encode(&cloneBatch{Instances: []StateChange{
+		NewStateChange(Create, InstanceID{DarcID: genesis.GetBaseID(), SubID: SubID{1}},
+			dummyKind, s.value),
+	}})
+	require.Nil(t, err)
+	_, _, err = cloneSpawn(s.service().GetCollectionView(cloneID), Instruction{
+		InstanceID: InstanceID{DarcID: genesis.GetBaseID()},
+		Spawn: &Spawn{
+			ContractID: ContractCloneID,
+			Args:       Arguments{{Name: "instances", Value: buf}},
+		},
+	}, nil)
+	require.NotNil(t, err)
+}
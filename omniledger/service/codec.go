@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// The caps on the size of the blocks and of their transactions. They are
+// checked before anything is decoded, so that a block or a transaction can't
+// make a conode allocate more memory than that. All the conodes of a roster
+// must use the same caps, or they disagree on the validity of the blocks.
+var (
+	maxPayloadSize = 32 << 20
+	maxTxSize      = 1 << 20
+)
+
+// sizeCapsVersion is the ServiceVersion from which the caps apply to the new
+// transactions and blocks. The blocks created before can be bigger, so the
+// stored blocks are always decoded without the caps.
+const sizeCapsVersion = 7
+
+// The fields of DataBody on the wire.
+const (
+	bodyTransactions = iota + 1
+	bodyEncryptedTransactions
+	bodyDecryptions
+)
+
+// bodyType returns the type ID that network.Marshal puts in front of a
+// DataBody. It is only known once the messages are registered.
+func bodyType() []byte {
+	id := network.MessageType(&DataBody{})
+	return id[:]
+}
+
+// encodeBody returns the payload of a block holding body, in the format of
+// network.Marshal. The encoding of the body is copied only once, into a
+// payload of the exact size. If capped is true, the payload must fit in
+// maxPayloadSize.
+func encodeBody(body *DataBody, capped bool) ([]byte, error) {
+	buf, err := protobuf.Encode(body)
+	if err != nil {
+		return nil, err
+	}
+	typ := bodyType()
+	if capped && len(typ)+len(buf) > maxPayloadSize {
+		return nil, fmt.Errorf("the body has %d bytes, more than %d", len(buf), maxPayloadSize)
+	}
+	payload := make([]byte, len(typ)+len(buf))
+	copy(payload, typ)
+	copy(payload[len(typ):], buf)
+	return payload, nil
+}
+
+// decodeBody decodes the payload of sb without checking the caps, as sb can
+// have been created before sizeCapsVersion. Unlike network.Unmarshal, it
+// walks the payload and decodes the transactions one by one, straight from
+// the payload.
+func decodeBody(sb *skipchain.SkipBlock) (*DataBody, error) {
+	return decodePayload(sb, false)
+}
+
+// decodeNewBody decodes the payload of a new block like decodeBody, but
+// refuses the payload and the transactions that are bigger than the caps.
+func decodeNewBody(sb *skipchain.SkipBlock) (*DataBody, error) {
+	return decodePayload(sb, true)
+}
+
+// decodePayload decodes the payload of sb, and checks the caps if capped is
+// true.
+func decodePayload(sb *skipchain.SkipBlock, capped bool) (*DataBody, error) {
+	if capped && len(sb.Payload) > maxPayloadSize {
+		return nil, fmt.Errorf("the payload has %d bytes, more than %d", len(sb.Payload), maxPayloadSize)
+	}
+	typ := bodyType()
+	if len(sb.Payload) < len(typ) || !bytes.Equal(sb.Payload[:len(typ)], typ) {
+		return nil, errors.New("couldn't unmarshal body")
+	}
+	body := &DataBody{}
+	cons := network.DefaultConstructors(cothority.Suite)
+	err := walkMessage(sb.Payload[len(typ):], func(field uint64, buf []byte) error {
+		if capped && len(buf) > maxTxSize {
+			return fmt.Errorf("field %d has %d bytes, more than %d", field, len(buf), maxTxSize)
+		}
+		switch field {
+		case bodyTransactions:
+			var ct ClientTransaction
+			if err := protobuf.DecodeWithConstructors(buf, &ct, cons); err != nil {
+				return err
+			}
+			body.Transactions = append(body.Transactions, ct)
+		case bodyEncryptedTransactions:
+			var et EncryptedTransaction
+			if err := protobuf.DecodeWithConstructors(buf, &et, cons); err != nil {
+				return err
+			}
+			body.EncryptedTransactions = append(body.EncryptedTransactions, et)
+		case bodyDecryptions:
+			var dec TxDecryption
+			if err := protobuf.DecodeWithConstructors(buf, &dec, cons); err != nil {
+				return err
+			}
+			body.Decryptions = append(body.Decryptions, dec)
+		default:
+			return fmt.Errorf("unknown field %d", field)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal body: " + err.Error())
+	}
+	return body, nil
+}
+
+// walkMessage calls f with the number and the bytes of every field of the
+// protobuf message buf. All the fields must be length-delimited, as are the
+// repeated messages. The bytes given to f are not copied.
+func walkMessage(buf []byte, f func(field uint64, buf []byte) error) error {
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		buf = buf[n:]
+		if key&7 != 2 {
+			return fmt.Errorf("field %d is not length-delimited", key>>3)
+		}
+		size, n := binary.Uvarint(buf)
+		if n <= 0 || size > uint64(len(buf)-n) {
+			return fmt.Errorf("invalid length of field %d", key>>3)
+		}
+		buf = buf[n:]
+		if err := f(key>>3, buf[:size]); err != nil {
+			return err
+		}
+		buf = buf[size:]
+	}
+	return nil
+}
+
+// nextBlock returns a copy of latest to build the next block on. The data and
+// the payload of latest are not copied, as they are replaced anyway.
+func nextBlock(latest *skipchain.SkipBlock) *skipchain.SkipBlock {
+	fix := *latest.SkipBlockFix
+	fix.Data = nil
+	sb := *latest
+	sb.SkipBlockFix = &fix
+	sb.Payload = nil
+	return sb.Copy()
+}
+
+// sizeCapped returns true if the caps apply to the new transactions and
+// blocks of the skipchain scID.
+func (s *Service) sizeCapped(scID skipchain.SkipBlockID) bool {
+	v, err := s.ActiveServiceVersion(scID)
+	return err == nil && v >= sizeCapsVersion
+}
+
+// checkTxSize refuses the transactions that are too big to be in a block.
+func checkTxSize(tx ClientTransaction) error {
+	buf, err := protobuf.Encode(&tx)
+	if err != nil {
+		return err
+	}
+	if len(buf) > maxTxSize {
+		return fmt.Errorf("transaction has %d bytes, more than %d", len(buf), maxTxSize)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodec_Body(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	var body DataBody
+	for i := 0; i < 3; i++ {
+		tx, err := createOneClientTx(darc.ID("darc"), dummyKind, []byte{byte(i)}, signer)
+		require.Nil(t, err)
+		body.Transactions = append(body.Transactions, tx)
+	}
+	body.EncryptedTransactions = []EncryptedTransaction{{
+		K:       cothority.Suite.Point().Pick(cothority.Suite.RandomStream()),
+		C:       cothority.Suite.Point().Pick(cothority.Suite.RandomStream()),
+		Payload: []byte("encrypted"),
+	}}
+
+	// The payload is the same as with network.Marshal.
+	payload, err := encodeBody(&body, true)
+	require.Nil(t, err)
+	buf, err := network.Marshal(&body)
+	require.Nil(t, err)
+	require.Equal(t, buf, payload)
+
+	sb := skipchain.NewSkipBlock()
+	sb.Payload = payload
+	decoded, err := decodeBody(sb)
+	require.Nil(t, err)
+	_, expected, err := network.Unmarshal(payload, cothority.Suite)
+	require.Nil(t, err)
+	require.Equal(t, expected, decoded)
+
+	sb.Payload = payload[:len(payload)-1]
+	_, err = decodeBody(sb)
+	require.NotNil(t, err)
+	sb.Payload = payload[1:]
+	_, err = decodeBody(sb)
+	require.NotNil(t, err)
+
+	defer func(p, tx int) { maxPayloadSize, maxTxSize = p, tx }(maxPayloadSize, maxTxSize)
+	maxTxSize = 10
+	sb.Payload = payload
+	_, err = decodeNewBody(sb)
+	require.NotNil(t, err)
+	require.NotNil(t, checkTxSize(body.Transactions[0]))
+	maxPayloadSize = len(payload) - 1
+	_, err = encodeBody(&body, true)
+	require.NotNil(t, err)
+	_, err = decodeNewBody(sb)
+	require.NotNil(t, err)
+
+	// The blocks before sizeCapsVersion can be bigger than the caps.
+	decoded, err = decodeBody(sb)
+	require.Nil(t, err)
+	require.Equal(t, expected, decoded)
+	_, err = encodeBody(&body, false)
+	require.Nil(t, err)
+}
+
+func TestCodec_NextBlock(t *testing.T) {
+	latest := skipchain.NewSkipBlock()
+	latest.Data = []byte("data")
+	latest.Payload = []byte("payload")
+	latest.Index = 3
+	next := nextBlock(latest)
+	require.Equal(t, 3, next.Index)
+	require.Equal(t, 0, len(next.Data))
+	require.Equal(t, 0, len(next.Payload))
+	require.Equal(t, []byte("data"), latest.Data)
+	require.Equal(t, []byte("payload"), latest.Payload)
+}
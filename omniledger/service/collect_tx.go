@@ -23,6 +23,11 @@ type CollectTxProtocol struct {
 	responseChan chan structCollectTxResponse
 	getTxs       func(*network.ServerIdentity, skipchain.SkipBlockID) ClientTransactions
 	Finish       chan bool
+	// OnVersion is called by the root with the ServiceVersion of every
+	// node that answered.
+	OnVersion func(*network.ServerIdentity, int)
+	// dropRequest makes a child ignore the request, as if it was lost.
+	dropRequest bool
 }
 
 // CollectTxRequest is the request message that asks the receiver to send their
@@ -35,6 +40,8 @@ type CollectTxRequest struct {
 // transactions on the node.
 type CollectTxResponse struct {
 	Txs ClientTransactions
+	// Version is the ServiceVersion of the node.
+	Version int `protobuf:"opt"`
 }
 
 type structCollectTxRequest struct {
@@ -104,10 +111,15 @@ func (p *CollectTxProtocol) Dispatch() error {
 		// it is not like our usual timeout that detect failures.
 		return errors.New("did not receive request")
 	}
+	if p.dropRequest && !p.IsRoot() {
+		log.Lvl2(p.ServerIdentity(), "dropping the request for transactions")
+		return nil
+	}
 
 	// send the result of the callback to the root
 	resp := &CollectTxResponse{
-		Txs: p.getTxs(req.ServerIdentity, req.SkipchainID),
+		Txs:     p.getTxs(req.ServerIdentity, req.SkipchainID),
+		Version: ServiceVersion,
 	}
 	if p.IsRoot() {
 		if err := p.SendTo(p.TreeNode(), resp); err != nil {
@@ -125,6 +137,9 @@ func (p *CollectTxProtocol) Dispatch() error {
 		for range p.List() {
 			select {
 			case resp := <-p.responseChan:
+				if p.OnVersion != nil {
+					p.OnVersion(resp.ServerIdentity, resp.Version)
+				}
 				p.TxsChan <- resp.Txs
 			case <-p.Finish:
 				return nil
@@ -3,9 +3,11 @@ package service
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoinx"
 	"github.com/dedis/cothority/omniledger/darc"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
@@ -71,6 +73,24 @@ func LoadConfigFromColl(coll CollectionView) (*ChainConfig, error) {
 	return &config, nil
 }
 
+// darcLimitsVersion is the ServiceVersion from which the darcs are bounded
+// by the limits of the configuration.
+const darcLimitsVersion = 6
+
+// LoadDarcLimits returns the limits of the evaluation of the darcs from the
+// configuration in coll, or darc.DefaultLimits if there are none. Until the
+// skipchain activated darcLimitsVersion, the darcs have no limits.
+func LoadDarcLimits(coll CollectionView) darc.Limits {
+	config, err := LoadConfigFromColl(coll)
+	if err != nil || config.MinServiceVersion < darcLimitsVersion {
+		return darc.Limits{}
+	}
+	if config.DarcLimits == nil {
+		return darc.DefaultLimits
+	}
+	return *config.DarcLimits
+}
+
 // LoadBlockIntervalFromColl loads the block interval from the collections.
 func LoadBlockIntervalFromColl(coll CollectionView) (time.Duration, error) {
 	config, err := LoadConfigFromColl(coll)
@@ -142,6 +162,48 @@ func (s *Service) invokeContractConfig(cdb CollectionView, inst Instruction, coi
 			err = errors.New("block interval is less than or equal to zero")
 			return
 		}
+		if err = newConfig.checkTimeouts(); err != nil {
+			return
+		}
+		if newConfig.DarcLimits != nil {
+			if err = newConfig.DarcLimits.Check(); err != nil {
+				return
+			}
+		}
+		if newConfig.TxKey != nil {
+			if err = newConfig.TxKey.check(); err != nil {
+				return
+			}
+		}
+		var oldConfig *ChainConfig
+		oldConfig, err = LoadConfigFromColl(cdb)
+		if err != nil {
+			return
+		}
+		rosterChange := !oldConfig.Roster.ID.Equal(newConfig.Roster.ID)
+		if rosterChange {
+			if err = s.rosterChangeAllowed(cdb, inst.InstanceID.DarcID, oldConfig); err != nil {
+				return
+			}
+			if err = validRosterChange(oldConfig.Roster, newConfig.Roster); err != nil {
+				return
+			}
+		}
+		if oldConfig.MinServiceVersion >= rosterChangeVersion {
+			// The index of the last roster change is kept by the
+			// service, whatever the client sends.
+			newConfig.RosterChangeIndex = oldConfig.RosterChangeIndex
+			if rosterChange {
+				newConfig.RosterChangeIndex, err = blockIndex(cdb)
+				if err != nil {
+					return
+				}
+			}
+			configBuf, err = protobuf.Encode(&newConfig)
+			if err != nil {
+				return
+			}
+		}
 		sc = []StateChange{
 			NewStateChange(Update, InstanceID{
 				DarcID: inst.InstanceID.DarcID,
@@ -169,6 +231,9 @@ func (s *Service) invokeContractConfig(cdb CollectionView, inst Instruction, coi
 		}
 		sc, err = updateRosterScs(cdb, inst.InstanceID.DarcID, newRoster)
 		return
+	} else if inst.Invoke.Command == "activate_version" {
+		sc, err = s.activateVersion(cdb, inst)
+		return
 	}
 	err = errors.New("invalid invoke command: " + inst.Invoke.Command)
 	return
@@ -206,6 +271,73 @@ func validRotation(oldRoster, newRoster onet.Roster) error {
 	return nil
 }
 
+// validRosterChange checks that the nodes of the old roster that are kept in
+// the new roster are enough to sign blocks with the new roster, so that the
+// chain can continue even if none of the new nodes work.
+func validRosterChange(oldRoster, newRoster onet.Roster) error {
+	if len(newRoster.List) == 0 {
+		return errors.New("the new roster is empty")
+	}
+	newRoster2 := onet.NewRoster(newRoster.List)
+	if newRoster2 == nil || !newRoster2.ID.Equal(newRoster.ID) {
+		return errors.New("re-created roster does not have the same ID")
+	}
+	if !newRoster2.Aggregate.Equal(newRoster.Aggregate) {
+		return errors.New("re-created roster does not have the same aggregate public key")
+	}
+	var kept int
+	for i, si := range newRoster.List {
+		for _, si2 := range newRoster.List[:i] {
+			if si.Equal(si2) {
+				return errors.New("the new roster holds a node twice")
+			}
+		}
+		if j, _ := oldRoster.Search(si.ID); j >= 0 {
+			kept++
+		}
+	}
+	if threshold := byzcoinx.Threshold(len(newRoster.List)); kept < threshold {
+		return fmt.Errorf("the new roster only keeps %d nodes of the old roster, but needs %d to sign",
+			kept, threshold)
+	}
+	return nil
+}
+
+// rosterChangeVersion is the ServiceVersion from which the config stores the
+// index of the block of the last roster change.
+const rosterChangeVersion = 5
+
+// rosterChangeAllowed returns an error if the roster has already been changed
+// by an earlier transaction of the block. Once the skipchain activated
+// rosterChangeVersion, this is the case if the config holds the index of the
+// block whose transactions are executed with cdb. Before, it is the case if
+// the roster in the config differs from the roster of the latest block.
+func (s *Service) rosterChangeAllowed(cdb CollectionView, darcID darc.ID, config *ChainConfig) error {
+	if config.MinServiceVersion >= rosterChangeVersion {
+		index, err := blockIndex(cdb)
+		if err != nil {
+			return err
+		}
+		if config.RosterChangeIndex == index {
+			return errors.New("the roster can only change once per block")
+		}
+		return nil
+	}
+	roster := config.Roster
+	scID, err := s.scIDFromGenesisDarc(darcID)
+	if err != nil {
+		return err
+	}
+	sb := s.db().GetByID(s.state.getLast(scID))
+	if sb == nil {
+		return errors.New("couldn't find the latest block")
+	}
+	if !sb.Roster.ID.Equal(roster.ID) {
+		return errors.New("the roster can only change once per block")
+	}
+	return nil
+}
+
 func (s *Service) spawnContractConfig(cdb CollectionView, inst Instruction, coins []Coin) (sc []StateChange, c []Coin, err error) {
 	c = coins
 	darcBuf := inst.Spawn.Args.Search("darc")
@@ -271,6 +403,12 @@ func (s *Service) ContractDarc(coll CollectionView, inst Instruction, coins []Co
 			if err != nil {
 				return nil, nil, errors.New("given darc could not be decoded: " + err.Error())
 			}
+			if err := d.Rules.Validate(); err != nil {
+				return nil, nil, err
+			}
+			if err := d.Rules.CheckLimits(LoadDarcLimits(coll), nil); err != nil {
+				return nil, nil, err
+			}
 			return []StateChange{
 				NewStateChange(Create, InstanceID{d.GetBaseID(), SubID{}}, ContractDarcID, darcBuf),
 			}, coins, nil
@@ -284,7 +422,7 @@ func (s *Service) ContractDarc(coll CollectionView, inst Instruction, coins []Co
 		if !found {
 			return nil, nil, errors.New("couldn't find this contract type")
 		}
-		return c(coll, inst, coins)
+		return c.Spawn(coll, inst, coins)
 	case inst.Invoke != nil:
 		switch inst.Invoke.Command {
 		case "evolve":
@@ -300,6 +438,12 @@ func (s *Service) ContractDarc(coll CollectionView, inst Instruction, coins []Co
 			if err := newD.SanityCheck(oldD); err != nil {
 				return nil, nil, err
 			}
+			if err := newD.Rules.Validate(); err != nil {
+				return nil, nil, err
+			}
+			if err := newD.Rules.CheckLimits(LoadDarcLimits(coll), oldD.Rules); err != nil {
+				return nil, nil, err
+			}
 			return []StateChange{
 				NewStateChange(Update, inst.InstanceID, ContractDarcID, darcBuf),
 			}, coins, nil
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+func init() {
+	network.RegisterMessages(DecryptTxRequest{}, DecryptTxResponse{})
+}
+
+// DecryptTxProtocol is a protocol for collecting the decryption shares of
+// the encrypted transactions of a block, or the shares of the randomness of
+// an instance.
+type DecryptTxProtocol struct {
+	*onet.TreeNodeInstance
+	SharesChan chan []DecryptionShare
+	BlockID    skipchain.SkipBlockID
+	// Randomness, if set, asks for the shares of the randomness of this
+	// instance of the skipchain of BlockID.
+	Randomness   *InstanceID
+	requestChan  chan structDecryptTxRequest
+	responseChan chan structDecryptTxResponse
+	getShares    func(*DecryptTxRequest) []DecryptionShare
+	Finish       chan bool
+}
+
+// DecryptTxRequest is the request message that asks the receiver to send
+// its decryption shares of the encrypted transactions of a block, or its
+// share of the randomness of an instance.
+type DecryptTxRequest struct {
+	BlockID    skipchain.SkipBlockID
+	Randomness *InstanceID
+}
+
+// DecryptTxResponse is the response message that contains one decryption
+// share for every encrypted transaction of the block, or nothing if the
+// node refuses.
+type DecryptTxResponse struct {
+	Shares []DecryptionShare
+}
+
+type structDecryptTxRequest struct {
+	*onet.TreeNode
+	DecryptTxRequest
+}
+
+type structDecryptTxResponse struct {
+	*onet.TreeNode
+	DecryptTxResponse
+}
+
+// NewDecryptTxProtocol is used for registering the protocol.
+func NewDecryptTxProtocol(getShares func(*DecryptTxRequest) []DecryptionShare) func(*onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	return func(node *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		c := &DecryptTxProtocol{
+			TreeNodeInstance: node,
+			// The channel is buffered so that the protocol doesn't block
+			// when the receiver stops reading from it.
+			SharesChan: make(chan []DecryptionShare, len(node.List())),
+			getShares:  getShares,
+			Finish:     make(chan bool),
+		}
+		if err := node.RegisterChannels(&c.requestChan, &c.responseChan); err != nil {
+			return c, err
+		}
+		return c, nil
+	}
+}
+
+// Start starts the protocol, it should only be called on the root node.
+func (p *DecryptTxProtocol) Start() error {
+	if !p.IsRoot() {
+		return errors.New("only the root should call start")
+	}
+	if len(p.BlockID) == 0 {
+		return errors.New("missing block ID")
+	}
+	req := &DecryptTxRequest{
+		BlockID:    p.BlockID,
+		Randomness: p.Randomness,
+	}
+	// send to myself and the children
+	if err := p.SendTo(p.TreeNode(), req); err != nil {
+		return err
+	}
+	// do not return an error if we fail to send to some children
+	if errs := p.SendToChildrenInParallel(req); len(errs) > 0 {
+		for _, err := range errs {
+			log.Error(p.ServerIdentity(), err)
+		}
+	}
+	return nil
+}
+
+// Dispatch runs the protocol.
+func (p *DecryptTxProtocol) Dispatch() error {
+	defer p.Done()
+
+	var req structDecryptTxRequest
+	select {
+	case req = <-p.requestChan:
+	case <-p.Finish:
+		return nil
+	case <-time.After(time.Second):
+		// This timeout checks whether the root started the protocol,
+		// it is not like our usual timeout that detect failures.
+		return errors.New("did not receive request")
+	}
+
+	// send the shares to the root
+	resp := &DecryptTxResponse{
+		Shares: p.getShares(&req.DecryptTxRequest),
+	}
+	if p.IsRoot() {
+		if err := p.SendTo(p.TreeNode(), resp); err != nil {
+			return err
+		}
+	} else {
+		if err := p.SendToParent(resp); err != nil {
+			return err
+		}
+	}
+
+	// wait for the results to come back and write to the channel
+	defer close(p.SharesChan)
+	if p.IsRoot() {
+		for range p.List() {
+			select {
+			case resp := <-p.responseChan:
+				p.SharesChan <- resp.Shares
+			case <-p.Finish:
+				return nil
+			}
+		}
+	}
+	return nil
+}
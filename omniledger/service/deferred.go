@@ -0,0 +1,201 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// The deferred contract holds a proposed transaction until enough
+// identities approved it. Every identity adds its signature with an
+// "addProof" instruction, and the contract executes the proposed transaction
+// as soon as the identities satisfy the rules of all its instructions. The
+// rule of every instruction is checked once the previous ones are executed,
+// so an instruction can use a darc that an earlier one evolved. So the
+// signers of a multi-signature don't need to get together off-chain.
+
+// ContractDeferredID denotes a deferred-contract
+var ContractDeferredID = "deferred"
+
+// DeferredProofMsg returns the message that an identity signs to approve
+// the instruction of the proposed transaction stored in the deferred
+// instance id.
+func DeferredProofMsg(id InstanceID, instr Instruction) []byte {
+	h := sha256.New()
+	h.Write(id.Slice())
+	h.Write(instr.Hash())
+	return h.Sum(nil)
+}
+
+// ContractDeferred accepts the following instructions:
+//   - Spawn - stores the transaction given in the argument "transaction"
+//   - Invoke.addProof - adds the signature in the argument "signature" of the
+//     identity in the argument "identity" on the instruction with the index
+//     in the argument "index", a 32-bit uint in LittleEndian. If the
+//     proposed transaction can be executed afterwards, it is run and its
+//     result is recorded.
+func (s *Service) ContractDeferred(cdb CollectionView, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	switch {
+	case inst.Spawn != nil:
+		txBuf := inst.Spawn.Args.Search("transaction")
+		var dd DeferredData
+		err := protobuf.DecodeWithConstructors(txBuf, &dd.ProposedTransaction,
+			network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return nil, nil, errors.New("couldn't decode transaction: " + err.Error())
+		}
+		if len(dd.ProposedTransaction.Instructions) == 0 {
+			return nil, nil, errors.New("the proposed transaction has no instructions")
+		}
+		ddBuf, err := protobuf.Encode(&dd)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []StateChange{
+			NewStateChange(Create, inst.DeriveID(ContractDeferredID), ContractDeferredID, ddBuf),
+		}, coins, nil
+	case inst.Invoke != nil:
+		if inst.Invoke.Command != "addProof" {
+			return nil, nil, errors.New("invalid command: " + inst.Invoke.Command)
+		}
+		return s.addDeferredProof(cdb, inst, coins)
+	default:
+		return nil, nil, errors.New("Only invoke and spawn are defined yet")
+	}
+}
+
+// addDeferredProof verifies and stores the proof of an addProof instruction
+// and runs the proposed transaction if it can be executed.
+func (s *Service) addDeferredProof(cdb CollectionView, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	ddBuf, _, err := cdb.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, err
+	}
+	var dd DeferredData
+	err = protobuf.DecodeWithConstructors(ddBuf, &dd, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, nil, err
+	}
+	if dd.Executed {
+		return nil, nil, errors.New("the proposed transaction has already been executed")
+	}
+
+	indexBuf := inst.Invoke.Args.Search("index")
+	if len(indexBuf) != 4 {
+		return nil, nil, errors.New("argument \"index\" must be a 32-bit uint")
+	}
+	index := int(binary.LittleEndian.Uint32(indexBuf))
+	if index >= len(dd.ProposedTransaction.Instructions) {
+		return nil, nil, fmt.Errorf("index %d out of range", index)
+	}
+	var id darc.Identity
+	err = protobuf.DecodeWithConstructors(inst.Invoke.Args.Search("identity"), &id,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, nil, errors.New("couldn't decode identity: " + err.Error())
+	}
+	for _, p := range dd.Proofs {
+		if p.Index == index && p.Signature.Signer.Equal(&id) {
+			return nil, nil, errors.New("identity already added a proof for this instruction")
+		}
+	}
+	sig := inst.Invoke.Args.Search("signature")
+	msg := DeferredProofMsg(inst.InstanceID, dd.ProposedTransaction.Instructions[index])
+	if err = id.Verify(msg, sig); err != nil {
+		return nil, nil, errors.New("invalid signature: " + err.Error())
+	}
+	if err = s.verifyIdentity(cdb, dd.ProposedTransaction.Instructions[index], id); err != nil {
+		return nil, nil, errors.New("invalid identity: " + err.Error())
+	}
+	dd.Proofs = append(dd.Proofs, DeferredProof{
+		Index:     index,
+		Signature: darc.Signature{Signature: sig, Signer: id},
+	})
+
+	var scs []StateChange
+	execScs, cout, approved, err := s.executeDeferred(cdb, coins, &dd)
+	if approved {
+		log.Lvlf2("%s: executed deferred transaction %x", s.ServerIdentity(), inst.InstanceID.Slice())
+		dd.Executed = true
+		if err != nil {
+			dd.ExecResult = err.Error()
+		} else {
+			scs, coins = execScs, cout
+		}
+	}
+
+	ddBuf, err = protobuf.Encode(&dd)
+	if err != nil {
+		return nil, nil, err
+	}
+	scs = append(scs, NewStateChange(Update, inst.InstanceID, ContractDeferredID, ddBuf))
+	return scs, coins, nil
+}
+
+// deferredApproved returns true if the identities of the proofs satisfy the
+// rule of the darc of the instruction with the index i in the proposed
+// transaction.
+func (s *Service) deferredApproved(cdb CollectionView, dd *DeferredData, i int) bool {
+	instr := dd.ProposedTransaction.Instructions[i]
+	d, err := LoadDarcFromColl(cdb, InstanceID{instr.InstanceID.DarcID, SubID{}}.Slice())
+	if err != nil {
+		log.Lvl2("couldn't load darc of deferred instruction:", err)
+		return false
+	}
+	action := darc.Action(instr.Action())
+	if !d.Rules.Contains(action) {
+		return false
+	}
+	var ids []string
+	for _, p := range dd.Proofs {
+		if p.Index == i {
+			ids = append(ids, p.Signature.Signer.String())
+		}
+	}
+	return darc.EvalExpr(d.Rules[action], s.darcGetter(cdb), ids...) == nil
+}
+
+// executeDeferred runs the instructions of the proposed transaction one
+// after the other on a copy-on-write view of the collection, so that every
+// instruction sees the changes of the previous ones. Before an instruction is
+// executed, the proofs must satisfy its darc in this view, or approved is
+// false and nothing is executed yet. Otherwise it returns all state changes,
+// or an error if an instruction fails. The events of the instructions are
+// only kept if all of them succeed.
+func (s *Service) executeDeferred(cdb CollectionView, coins []Coin, dd *DeferredData) (scs []StateChange, cout []Coin,
+	approved bool, err error) {
+	cv, ok := cdb.(*contractView)
+	if !ok {
+		return nil, nil, false, errors.New("cannot execute deferred transaction on this collection")
+	}
+	coll := newOverlayView(cv.CollectionView)
+	view := &contractView{CollectionView: coll, s: s, depth: cv.depth, blockIndex: cv.blockIndex,
+		chainTime: cv.chainTime}
+	var events []Event
+	for i, instr := range dd.ProposedTransaction.Instructions {
+		if !s.deferredApproved(view, dd, i) {
+			return nil, nil, false, nil
+		}
+		instrScs, instrCoins, instrEvents, err := s.executeInstructionEvents(view, coins, instr)
+		if err != nil {
+			return nil, nil, true, err
+		}
+		for _, sc := range instrScs {
+			if err := coll.store(sc); err != nil {
+				return nil, nil, true, err
+			}
+		}
+		scs = append(scs, instrScs...)
+		events = append(events, instrEvents...)
+		coins = instrCoins
+	}
+	cv.emit(events...)
+	return scs, coins, true, nil
+}
@@ -0,0 +1,528 @@
+package service
+
+/*
+Encrypted transactions protect the clients against front-running: a client
+encrypts its transaction with the shared public key of the roster, created by
+the DKG service, whose commitments are stored in the config. The leader
+orders the encrypted transactions in a block without knowing their content.
+Only once this block is stored, the nodes give their decryption shares, and
+the decrypted transactions are executed at the beginning of the next block,
+before its own transactions. The next block is refused if it doesn't hold
+the decryptions, so the leader can't read the transactions and leave them
+out.
+*/
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/dkg"
+	"github.com/dedis/cothority/ocs/protocol"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/share"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// txKeyPurpose is the purpose of the transaction keys in the DKG service.
+const txKeyPurpose = "omniledger"
+
+const decryptTxProtocol = "DecryptTxProtocol"
+
+// EncryptTransaction encrypts ct with the key X returned by CreateTxKey.
+func EncryptTransaction(X kyber.Point, ct ClientTransaction) (*EncryptedTransaction, error) {
+	buf, err := protobuf.Encode(&ct)
+	if err != nil {
+		return nil, err
+	}
+	m := cothority.Suite.Point().Pick(cothority.Suite.RandomStream())
+	r := cothority.Suite.Scalar().Pick(cothority.Suite.RandomStream())
+	aead, err := txAEAD(m)
+	if err != nil {
+		return nil, err
+	}
+	// Every symmetric key is only used once, so the nonce can be fixed.
+	nonce := make([]byte, aead.NonceSize())
+	return &EncryptedTransaction{
+		K:       cothority.Suite.Point().Mul(r, nil),
+		C:       cothority.Suite.Point().Add(cothority.Suite.Point().Mul(r, X), m),
+		Payload: aead.Seal(nil, nonce, buf, nil),
+	}, nil
+}
+
+// open decrypts the payload of the transaction with xK, the private key of
+// the roster multiplied with K.
+func (etx EncryptedTransaction) open(xK kyber.Point) (*ClientTransaction, error) {
+	m := cothority.Suite.Point().Sub(etx.C, xK)
+	aead, err := txAEAD(m)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	buf, err := aead.Open(nil, nonce, etx.Payload, nil)
+	if err != nil {
+		return nil, err
+	}
+	ct := &ClientTransaction{}
+	err = protobuf.DecodeWithConstructors(buf, ct, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// txAEAD returns the cipher of the payload, whose key is derived from m.
+func txAEAD(m kyber.Point) (cipher.AEAD, error) {
+	buf, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(buf)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newDecryptionShare returns the decryption share of K for the share of the
+// private key, with a proof that both use the same share.
+func newDecryptionShare(shared *protocol.SharedSecret, K kyber.Point) DecryptionShare {
+	ui := cothority.Suite.Point().Mul(shared.V, K)
+	w := cothority.Suite.Scalar().Pick(cothority.Suite.RandomStream())
+	w1 := cothority.Suite.Point().Mul(w, nil)
+	w2 := cothority.Suite.Point().Mul(w, K)
+	ei := decryptionChallenge(K, ui, w1, w2)
+	return DecryptionShare{
+		Index: shared.Index,
+		Ui:    ui,
+		Ei:    ei,
+		Fi:    cothority.Suite.Scalar().Add(w, cothority.Suite.Scalar().Mul(ei, shared.V)),
+	}
+}
+
+// verify checks the proof of the decryption share of K against the public
+// share of the node in poly.
+func (ds DecryptionShare) verify(poly *share.PubPoly, n int, K kyber.Point) error {
+	if ds.Index < 0 || ds.Index >= n {
+		return errors.New("wrong index")
+	}
+	if ds.Ui == nil || ds.Ei == nil || ds.Fi == nil {
+		return errors.New("incomplete decryption share")
+	}
+	hi := poly.Eval(ds.Index).V
+	w1 := cothority.Suite.Point().Sub(cothority.Suite.Point().Mul(ds.Fi, nil),
+		cothority.Suite.Point().Mul(ds.Ei, hi))
+	w2 := cothority.Suite.Point().Sub(cothority.Suite.Point().Mul(ds.Fi, K),
+		cothority.Suite.Point().Mul(ds.Ei, ds.Ui))
+	if !decryptionChallenge(K, ds.Ui, w1, w2).Equal(ds.Ei) {
+		return errors.New("wrong proof of decryption share")
+	}
+	return nil
+}
+
+func decryptionChallenge(points ...kyber.Point) kyber.Scalar {
+	hash := sha256.New()
+	for _, p := range points {
+		p.MarshalTo(hash)
+	}
+	return cothority.Suite.Scalar().SetBytes(hash.Sum(nil))
+}
+
+// recoverXK verifies the decryption shares of K and combines a threshold of
+// them.
+func recoverXK(poly *share.PubPoly, n int, K kyber.Point, d TxDecryption) (kyber.Point, error) {
+	if len(d.Shares) != poly.Threshold() {
+		return nil, fmt.Errorf("need %d decryption shares", poly.Threshold())
+	}
+	seen := make(map[int]bool)
+	var uis []*share.PubShare
+	for _, ds := range d.Shares {
+		if seen[ds.Index] {
+			return nil, errors.New("decryption share is used twice")
+		}
+		seen[ds.Index] = true
+		if err := ds.verify(poly, n, K); err != nil {
+			return nil, err
+		}
+		uis = append(uis, &share.PubShare{I: ds.Index, V: ds.Ui})
+	}
+	return share.RecoverCommit(cothority.Suite, uis, poly.Threshold(), n)
+}
+
+// encryptedHash returns the hash of the encrypted transactions and the
+// decryptions of the body, or nil if it has none.
+func encryptedHash(body *DataBody) ([]byte, error) {
+	if len(body.EncryptedTransactions) == 0 && len(body.Decryptions) == 0 {
+		return nil, nil
+	}
+	buf, err := protobuf.Encode(&DataBody{
+		EncryptedTransactions: body.EncryptedTransactions,
+		Decryptions:           body.Decryptions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(buf)
+	return h[:], nil
+}
+
+// countDecrypted returns how many of the valid transactions ctsOK are
+// decrypted transactions, which are always executed first.
+func countDecrypted(decrypted, ctsOK ClientTransactions) int {
+	n := 0
+	for _, ct := range decrypted {
+		if n < len(ctsOK) && string(ct.Instructions.Hash()) == string(ctsOK[n].Instructions.Hash()) {
+			n++
+		}
+	}
+	return n
+}
+
+// CreateTxKey creates the key of the roster to encrypt the transactions of
+// the skipchain, with the DKG service. If the key exists, it is returned.
+// The public part of the key must then be stored in the config.
+func (s *Service) CreateTxKey(req *CreateTxKey) (*CreateTxKeyResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if _, err := s.dkgService().GetPublic(&dkg.GetPublic{ID: req.SkipchainID}); err != nil {
+		gen := s.db().GetByID(req.SkipchainID)
+		if gen == nil || gen.Index != 0 {
+			return nil, errors.New("skipchain ID is does not exist")
+		}
+		sb, err := s.db().GetLatestByID(req.SkipchainID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = s.dkgService().Setup(&dkg.Setup{
+			Roster:  *sb.Roster,
+			ID:      req.SkipchainID,
+			Purpose: txKeyPurpose,
+			Data:    req.SkipchainID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	poly, n, _, err := s.txKey(req.SkipchainID)
+	if err != nil {
+		return nil, err
+	}
+	_, commits := poly.Info()
+	return &CreateTxKeyResponse{
+		Version: CurrentVersion,
+		X:       poly.Commit(),
+		Key:     TxKey{Commits: commits, N: n},
+	}, nil
+}
+
+// AddEncryptedTransaction buffers an encrypted transaction on the leader,
+// which orders it in the next block.
+func (s *Service) AddEncryptedTransaction(req *AddEncryptedTxRequest) (*AddEncryptedTxResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if s.shuttingDown() {
+		return nil, ErrShuttingDown
+	}
+	gen := s.db().GetByID(req.SkipchainID)
+	if gen == nil || gen.Index != 0 {
+		return nil, errors.New("skipchain ID is does not exist")
+	}
+	if err := s.checkEnabled(req.SkipchainID); err != nil {
+		return nil, err
+	}
+	leader, err := s.getLeader(req.SkipchainID)
+	if err != nil {
+		return nil, err
+	}
+	if !leader.Equal(s.ServerIdentity()) {
+		return nil, errors.New("only the leader accepts encrypted transactions")
+	}
+	if _, _, err := s.configTxKey(req.SkipchainID); err != nil {
+		return nil, errors.New("no key to decrypt transactions: " + err.Error())
+	}
+	etx := req.Transaction
+	if etx.K == nil || etx.C == nil || len(etx.Payload) == 0 {
+		return nil, errors.New("incomplete encrypted transaction")
+	}
+	if err := s.checkQuota(req.SkipchainID); err != nil {
+		return nil, err
+	}
+	if err := s.checkOverload(req.SkipchainID); err != nil {
+		return nil, err
+	}
+	s.encTxBuffer.add(string(req.SkipchainID), etx)
+	return &AddEncryptedTxResponse{
+		Version: CurrentVersion,
+	}, nil
+}
+
+func (s *Service) dkgService() *dkg.Service {
+	return s.Service(dkg.ServiceName).(*dkg.Service)
+}
+
+// txKey returns the public polynomial of the transaction key of the
+// skipchain, the number of nodes holding it and the share of this node, as
+// stored by the DKG service of this node.
+func (s *Service) txKey(scID skipchain.SkipBlockID) (*share.PubPoly, int, *protocol.SharedSecret, error) {
+	roster, _, shared, err := s.dkgService().GetShare(scID)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return share.NewPubPoly(cothority.Suite, nil, shared.Commits), len(roster.List), shared, nil
+}
+
+// configTxKey returns the public polynomial of the transaction key stored in
+// the config of the skipchain, and the number of shares. The decryption
+// shares are verified against it, so that all the nodes verify them the same
+// way.
+func (s *Service) configTxKey(scID skipchain.SkipBlockID) (*share.PubPoly, int, error) {
+	config, err := s.LoadConfig(scID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if config.TxKey == nil {
+		return nil, 0, errors.New("the config holds no transaction key")
+	}
+	return config.TxKey.pubPoly(), config.TxKey.N, nil
+}
+
+// pubPoly returns the public polynomial of the key.
+func (k *TxKey) pubPoly() *share.PubPoly {
+	return share.NewPubPoly(cothority.Suite, nil, k.Commits)
+}
+
+// check returns an error if the key can't verify decryption shares.
+func (k *TxKey) check() error {
+	if len(k.Commits) == 0 || len(k.Commits) > k.N {
+		return errors.New("the transaction key needs between 1 and N commits")
+	}
+	for _, c := range k.Commits {
+		if c == nil {
+			return errors.New("the transaction key has an empty commit")
+		}
+	}
+	return nil
+}
+
+// verifyTxKeyReshare only lets the DKG service move the transaction key of a
+// skipchain to the roster of its latest block.
+func (s *Service) verifyTxKeyReshare(id, data []byte, newRoster *onet.Roster) bool {
+	latest, err := s.db().GetLatestByID(data)
+	if err != nil {
+		log.Lvl2(s.ServerIdentity(), "unknown skipchain:", err)
+		return false
+	}
+	return latest.Roster.ID.Equal(newRoster.ID)
+}
+
+// getShares returns the shares of this node asked for by req.
+func (s *Service) getShares(req *DecryptTxRequest) []DecryptionShare {
+	if req.Randomness != nil {
+		return s.getRandomnessShares(req.BlockID, *req.Randomness)
+	}
+	return s.getDecryptionShares(req.BlockID)
+}
+
+// getDecryptionShares returns the decryption shares of this node for the
+// encrypted transactions of a stored block. Blocks that are not stored yet
+// are refused, so nobody can see a transaction before it is ordered.
+func (s *Service) getDecryptionShares(blockID skipchain.SkipBlockID) []DecryptionShare {
+	sb := s.db().GetByID(blockID)
+	if sb == nil {
+		log.Lvl2(s.ServerIdentity(), "refusing to decrypt unknown block")
+		return nil
+	}
+	body, err := decodeBody(sb)
+	if err != nil {
+		log.Error(s.ServerIdentity(), err)
+		return nil
+	}
+	_, _, shared, err := s.txKey(sb.SkipChainID())
+	if err != nil {
+		log.Error(s.ServerIdentity(), err)
+		return nil
+	}
+	shares := make([]DecryptionShare, len(body.EncryptedTransactions))
+	for i, etx := range body.EncryptedTransactions {
+		shares[i] = newDecryptionShare(shared, etx.K)
+	}
+	return shares
+}
+
+// collectDecryptions asks the roster for the decryption shares of the
+// encrypted transactions of sb, and returns a threshold of valid shares
+// for each of them.
+func (s *Service) collectDecryptions(sb *skipchain.SkipBlock, timeout time.Duration) ([]TxDecryption, error) {
+	body, err := decodeBody(sb)
+	if err != nil {
+		return nil, err
+	}
+	if len(body.EncryptedTransactions) == 0 {
+		return nil, nil
+	}
+	Ks := make([]kyber.Point, len(body.EncryptedTransactions))
+	for i, etx := range body.EncryptedTransactions {
+		Ks[i] = etx.K
+	}
+	return s.collectShares(sb, nil, Ks, timeout)
+}
+
+// collectShares asks the roster of sb for their shares of the points Ks,
+// which are the encrypted transactions of sb, or the randomness point of
+// the instance randomness of the skipchain of sb. It returns a threshold of
+// valid shares for each point.
+func (s *Service) collectShares(sb *skipchain.SkipBlock, randomness *InstanceID, Ks []kyber.Point,
+	timeout time.Duration) ([]TxDecryption, error) {
+	poly, n, err := s.configTxKey(sb.SkipChainID())
+	if err != nil {
+		return nil, err
+	}
+	tree := sb.Roster.GenerateNaryTree(len(sb.Roster.List))
+	proto, err := s.CreateProtocol(decryptTxProtocol, tree)
+	if err != nil {
+		return nil, err
+	}
+	root := proto.(*DecryptTxProtocol)
+	root.BlockID = sb.Hash
+	root.Randomness = randomness
+	if err := root.Start(); err != nil {
+		return nil, err
+	}
+	defer close(root.Finish)
+
+	decs := make([]TxDecryption, len(Ks))
+	seen := make(map[int]bool)
+	deadline := s.clock.get().After(timeout)
+	for len(seen) < poly.Threshold() {
+		select {
+		case shares, more := <-root.SharesChan:
+			if !more {
+				return nil, errors.New("not enough decryption shares")
+			}
+			if len(shares) != len(Ks) || seen[shares[0].Index] {
+				continue
+			}
+			valid := true
+			for i, ds := range shares {
+				if ds.Index != shares[0].Index || ds.verify(poly, n, Ks[i]) != nil {
+					valid = false
+					break
+				}
+			}
+			if !valid {
+				log.Lvl2(s.ServerIdentity(), "got invalid decryption shares")
+				continue
+			}
+			seen[shares[0].Index] = true
+			for i, ds := range shares {
+				decs[i].Shares = append(decs[i].Shares, ds)
+			}
+		case <-deadline:
+			return nil, errors.New("timeout while collecting decryption shares")
+		}
+	}
+	return decs, nil
+}
+
+// decryptTransactions decrypts the encrypted transactions of prev with the
+// decryptions of the next block. It fails if the decryptions are missing or
+// not valid, but drops the transactions that can't be decoded or are not
+// signed correctly.
+func (s *Service) decryptTransactions(prev *skipchain.SkipBlock, decs []TxDecryption) (ClientTransactions, error) {
+	if prev == nil {
+		if len(decs) == 0 {
+			return nil, nil
+		}
+		return nil, errors.New("decryptions without previous block")
+	}
+	body, err := decodeBody(prev)
+	if err != nil {
+		return nil, err
+	}
+	if len(decs) == 0 && len(body.EncryptedTransactions) == 0 {
+		return nil, nil
+	}
+	if len(decs) != len(body.EncryptedTransactions) {
+		return nil, errors.New("decryptions don't match the encrypted transactions")
+	}
+	poly, n, err := s.configTxKey(prev.SkipChainID())
+	if err != nil {
+		return nil, err
+	}
+	var cts ClientTransactions
+	l := s.txLog(prev.SkipChainID()).block(prev.Index + 1)
+	for i, etx := range body.EncryptedTransactions {
+		xK, err := recoverXK(poly, n, etx.K, decs[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid decryption %d: %v", i, err)
+		}
+		ct, err := etx.open(xK)
+		if err != nil {
+			log.Lvl2(l.msgf("dropping encrypted transaction %d: %v", i, err))
+			continue
+		}
+		if err := s.verifyClientTx(prev.SkipChainID(), *ct); err != nil {
+			log.Lvl2(l.tx(*ct).msg("dropping decrypted transaction:", err))
+			continue
+		}
+		cts = append(cts, *ct)
+	}
+	return cts, nil
+}
+
+// blockTransactions returns the transactions executed by sb: the decrypted
+// transactions of the previous block, followed by the transactions of the
+// body. It fails if sb doesn't decrypt all the encrypted transactions of the
+// previous block.
+func (s *Service) blockTransactions(sb *skipchain.SkipBlock, body *DataBody) (ClientTransactions, error) {
+	if len(sb.BackLinkIDs) == 0 {
+		if len(body.Decryptions) > 0 {
+			return nil, errors.New("decryptions in genesis block")
+		}
+		return body.Transactions, nil
+	}
+	decrypted, err := s.decryptTransactions(s.db().GetByID(sb.BackLinkIDs[0]), body.Decryptions)
+	if err != nil {
+		return nil, err
+	}
+	return append(decrypted, body.Transactions...), nil
+}
+
+type encryptedTxBuffer struct {
+	sync.Mutex
+	txsMap map[string][]EncryptedTransaction
+}
+
+func newEncryptedTxBuffer() encryptedTxBuffer {
+	return encryptedTxBuffer{
+		txsMap: make(map[string][]EncryptedTransaction),
+	}
+}
+
+func (r *encryptedTxBuffer) take(key string) []EncryptedTransaction {
+	r.Lock()
+	defer r.Unlock()
+
+	txs := r.txsMap[key]
+	delete(r.txsMap, key)
+	return txs
+}
+
+func (r *encryptedTxBuffer) add(key string, newTxs ...EncryptedTransaction) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.txsMap[key] = append(r.txsMap[key], newTxs...)
+}
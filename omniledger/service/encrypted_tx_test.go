@@ -0,0 +1,135 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/ocs/protocol"
+	"github.com/dedis/kyber/share"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptTransaction(t *testing.T) {
+	n, threshold := 4, 3
+	poly := share.NewPriPoly(cothority.Suite, threshold, nil, cothority.Suite.RandomStream())
+	pubPoly := poly.Commit(nil)
+	ct := ClientTransaction{Instructions: Instructions{{
+		InstanceID: NewInstanceID([]byte("instance")),
+		Nonce:      GenNonce(),
+		Length:     1,
+	}}}
+	etx, err := EncryptTransaction(pubPoly.Commit(), ct)
+	require.Nil(t, err)
+
+	var d TxDecryption
+	for _, ps := range poly.Shares(n)[1:] {
+		shared := &protocol.SharedSecret{Index: ps.I, V: ps.V}
+		d.Shares = append(d.Shares, newDecryptionShare(shared, etx.K))
+	}
+	xK, err := recoverXK(pubPoly, n, etx.K, d)
+	require.Nil(t, err)
+	decrypted, err := etx.open(xK)
+	require.Nil(t, err)
+	require.Equal(t, ct.Instructions.Hash(), decrypted.Instructions.Hash())
+
+	// A share with a wrong proof or index must be refused.
+	wrong := d.Shares[0]
+	d.Shares[0].Ui = cothority.Suite.Point().Pick(cothority.Suite.RandomStream())
+	_, err = recoverXK(pubPoly, n, etx.K, d)
+	require.NotNil(t, err)
+	d.Shares[0] = wrong
+	d.Shares[0].Index = d.Shares[1].Index
+	_, err = recoverXK(pubPoly, n, etx.K, d)
+	require.NotNil(t, err)
+
+	_, commits := pubPoly.Info()
+	require.Nil(t, (&TxKey{Commits: commits, N: n}).check())
+	require.NotNil(t, (&TxKey{Commits: commits, N: threshold - 1}).check())
+	require.NotNil(t, (&TxKey{N: n}).check())
+}
+
+func TestService_EncryptedTransaction(t *testing.T) {
+	s := newSer(t, 1, 500*time.Millisecond)
+	defer s.local.CloseAll()
+
+	// Encrypted transactions need the key of the roster.
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	etx, err := EncryptTransaction(cothority.Suite.Point().Pick(cothority.Suite.RandomStream()), tx)
+	require.Nil(t, err)
+	_, err = s.service().AddEncryptedTransaction(&AddEncryptedTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		Transaction: *etx,
+	})
+	require.NotNil(t, err)
+
+	key, err := s.services[1].CreateTxKey(&CreateTxKey{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+	})
+	require.Nil(t, err)
+	key2, err := s.service().CreateTxKey(&CreateTxKey{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+	})
+	require.Nil(t, err)
+	require.True(t, key.X.Equal(key2.X))
+	require.True(t, key.X.Equal(key.Key.Commits[0]))
+	require.Equal(t, len(s.roster.List), key.Key.N)
+
+	// The leader only takes encrypted transactions once the public part of
+	// the key is in the config.
+	etx, err = EncryptTransaction(key.X, tx)
+	require.Nil(t, err)
+	req := &AddEncryptedTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		Transaction: *etx,
+	}
+	_, err = s.service().AddEncryptedTransaction(req)
+	require.NotNil(t, err)
+	config, err := s.service().LoadConfig(s.sb.SkipChainID())
+	require.Nil(t, err)
+	config.TxKey = &key.Key
+	s.sendTx(t, configTx(t, s, *config))
+	for i := 0; i < 10; i++ {
+		if _, _, err = s.service().configTxKey(s.sb.SkipChainID()); err == nil {
+			break
+		}
+		time.Sleep(s.interval)
+	}
+	require.Nil(t, err)
+
+	// Only the leader takes encrypted transactions.
+	_, err = s.services[1].AddEncryptedTransaction(req)
+	require.NotNil(t, err)
+	_, err = s.service().AddEncryptedTransaction(req)
+	require.Nil(t, err)
+
+	pr := s.waitProof(t, tx.Instructions[0].InstanceID)
+	require.True(t, pr.InclusionProof.Match())
+	_, vs, err := pr.KeyValue()
+	require.Nil(t, err)
+	require.Equal(t, s.value, vs[0])
+
+	// The transaction is ordered encrypted in one block and executed in
+	// the next one.
+	latest, err := s.service().db().GetLatestByID(s.sb.SkipChainID())
+	require.Nil(t, err)
+	body, err := decodeBody(latest)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(body.Decryptions))
+	require.Equal(t, 0, len(body.Transactions))
+	prev, err := decodeBody(s.service().db().GetByID(latest.BackLinkIDs[0]))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(prev.EncryptedTransactions))
+
+	// A block that doesn't decrypt them is refused.
+	cts, err := s.service().blockTransactions(latest, body)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(cts))
+	_, err = s.service().blockTransactions(latest, &DataBody{Transactions: body.Transactions})
+	require.NotNil(t, err)
+}
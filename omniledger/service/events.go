@@ -0,0 +1,225 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/protobuf"
+)
+
+// Contracts emit events with EmitEvent to tell the clients about their
+// progress, without storing it in the instances. The events of the
+// transactions included in a block are collected when the block is applied to
+// the collection, and stored in a bucket per skipchain under the index of the
+// block. They can be searched by block, contract and topic with SearchEvents,
+// and the services on the same node can subscribe to new events with
+// SubscribeEvents.
+
+// maxSearchEvents is the number of events after which SearchEvents
+// truncates its result.
+const maxSearchEvents = 1000
+
+// subscriptionBuffer is how many events a subscription holds before new
+// events are dropped.
+const subscriptionBuffer = 100
+
+// matches returns true if the event has been emitted by contractID with the
+// given topic. Empty strings match everything.
+func (e *Event) matches(contractID, topic string) bool {
+	return (contractID == "" || e.ContractID == contractID) &&
+		(topic == "" || e.Topic == topic)
+}
+
+// eventDB stores the events of one skipchain.
+type eventDB struct {
+	db         *bolt.DB
+	bucketName []byte
+}
+
+func newEventDB(db *bolt.DB, name []byte) *eventDB {
+	e := &eventDB{
+		db:         db,
+		bucketName: name,
+	}
+	e.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		return nil
+	})
+	return e
+}
+
+// eventKey returns the key of the n'th event of the block with the given
+// index. The keys sort by block and then by the order of the events.
+func eventKey(index, n int) []byte {
+	key := make([]byte, 12)
+	binary.BigEndian.PutUint64(key, uint64(index))
+	binary.BigEndian.PutUint32(key[8:], uint32(n))
+	return key
+}
+
+// store saves the events emitted by the transactions of sb. Storing the
+// same block twice overwrites the events.
+func (e *eventDB) store(sb *skipchain.SkipBlock, events []Event) error {
+	return e.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(e.bucketName)
+		for i, ev := range events {
+			buf, err := protobuf.Encode(&BlockEvent{
+				BlockIndex: sb.Index,
+				BlockID:    sb.Hash,
+				Event:      ev,
+			})
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(eventKey(sb.Index, i), buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// search returns the events matching req. The result is only truncated
+// between two blocks, so that the search can continue with the next block.
+func (e *eventDB) search(req *SearchEvents) (events []BlockEvent, truncated bool, err error) {
+	err = e.db.View(func(tx *bolt.Tx) error {
+		cur := tx.Bucket(e.bucketName).Cursor()
+		for k, v := cur.Seek(eventKey(req.From, 0)); k != nil; k, v = cur.Next() {
+			var be BlockEvent
+			if err := protobuf.Decode(v, &be); err != nil {
+				return err
+			}
+			if req.To > 0 && be.BlockIndex > req.To {
+				return nil
+			}
+			if !be.Event.matches(req.ContractID, req.Topic) {
+				continue
+			}
+			if len(events) >= maxSearchEvents &&
+				events[len(events)-1].BlockIndex != be.BlockIndex {
+				truncated = true
+				return nil
+			}
+			events = append(events, be)
+		}
+		return nil
+	})
+	return
+}
+
+// SearchEvents returns the events emitted in the blocks from req.From to
+// req.To that match the contract and the topic of req.
+func (s *Service) SearchEvents(req *SearchEvents) (*SearchEventsResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if s.state.getLast(req.SkipchainID) == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+	if req.From < 0 || req.To < 0 {
+		return nil, errors.New("block indexes must not be negative")
+	}
+	log.Lvlf2("%s: Searching events of %x", s.ServerIdentity(), req.SkipchainID)
+	events, truncated, err := s.getEventDB(req.SkipchainID).search(req)
+	if err != nil {
+		return nil, errors.New("couldn't search events: " + err.Error())
+	}
+	return &SearchEventsResponse{
+		Version:   CurrentVersion,
+		Events:    events,
+		Truncated: truncated,
+	}, nil
+}
+
+// getEventDB returns the event store of the skipchain id.
+func (s *Service) getEventDB(id skipchain.SkipBlockID) *eventDB {
+	s.eventDBMut.Lock()
+	defer s.eventDBMut.Unlock()
+	idStr := fmt.Sprintf("%x", id)
+	edb := s.eventDB[idStr]
+	if edb == nil {
+		db, name := s.GetAdditionalBucket([]byte("events_" + idStr))
+		edb = newEventDB(db, name)
+		s.eventDB[idStr] = edb
+	}
+	return edb
+}
+
+// SubscribeEvents returns a channel that receives the new events of the
+// skipchain scID emitted by contractID with the given topic. Empty strings
+// match everything. The returned function ends the subscription and closes
+// the channel. If the channel is not read fast enough, events are dropped.
+//
+// Clients that are not on the node can follow the events by calling
+// SearchEvents with From set after the last block they got events for.
+func (s *Service) SubscribeEvents(scID skipchain.SkipBlockID, contractID, topic string) (<-chan BlockEvent, func()) {
+	return s.subscriptions.subscribe(scID, contractID, topic)
+}
+
+// eventSubscriptions holds the channels of SubscribeEvents.
+type eventSubscriptions struct {
+	sync.Mutex
+	subs map[int]*eventSubscription
+	next int
+}
+
+type eventSubscription struct {
+	scID       skipchain.SkipBlockID
+	contractID string
+	topic      string
+	c          chan BlockEvent
+}
+
+func (es *eventSubscriptions) subscribe(scID skipchain.SkipBlockID, contractID, topic string) (<-chan BlockEvent, func()) {
+	es.Lock()
+	defer es.Unlock()
+	if es.subs == nil {
+		es.subs = make(map[int]*eventSubscription)
+	}
+	id := es.next
+	es.next++
+	sub := &eventSubscription{
+		scID:       scID,
+		contractID: contractID,
+		topic:      topic,
+		c:          make(chan BlockEvent, subscriptionBuffer),
+	}
+	es.subs[id] = sub
+	return sub.c, func() {
+		es.Lock()
+		defer es.Unlock()
+		if _, ok := es.subs[id]; ok {
+			delete(es.subs, id)
+			close(sub.c)
+		}
+	}
+}
+
+// notify sends the events of sb to the matching subscriptions.
+func (es *eventSubscriptions) notify(sb *skipchain.SkipBlock, events []Event) {
+	es.Lock()
+	defer es.Unlock()
+	for _, sub := range es.subs {
+		if !sub.scID.Equal(sb.SkipChainID()) {
+			continue
+		}
+		for _, ev := range events {
+			if !ev.matches(sub.contractID, sub.topic) {
+				continue
+			}
+			select {
+			case sub.c <- BlockEvent{BlockIndex: sb.Index, BlockID: sb.Hash, Event: ev}:
+			default:
+				log.Error("dropping event of a subscription that doesn't read them")
+			}
+		}
+	}
+}
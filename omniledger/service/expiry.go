@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+)
+
+// expiryVersion is the ServiceVersion from which the transactions can have
+// an expiration.
+const expiryVersion = 3
+
+// ErrTxExpired is returned for a transaction that can't be included anymore.
+var ErrTxExpired = errors.New("the transaction expired")
+
+// SetExpiry sets the expiration of all the instructions of the transaction.
+// As the expiration is part of the hash of the instructions, it must be set
+// before they are signed. The leader doesn't include the transaction once it
+// expired, and the nodes drop it from their buffer.
+func (ct *ClientTransaction) SetExpiry(e Expiry) {
+	for i := range ct.Instructions {
+		v := e
+		ct.Instructions[i].ValidUntil = &v
+	}
+}
+
+// Expired returns true if the transaction can't be executed in a block with
+// the given index and chain time.
+func (ct ClientTransaction) Expired(index int, chainTime int64) bool {
+	for _, instr := range ct.Instructions {
+		if instr.ValidUntil.expired(index, chainTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Expiry) expired(index int, chainTime int64) bool {
+	if e == nil {
+		return false
+	}
+	return (e.BlockIndex > 0 && index > e.BlockIndex) ||
+		(e.ChainTime > 0 && chainTime > e.ChainTime)
+}
+
+// hasExpiry returns true if an instruction of the transaction has an
+// expiration.
+func (ct ClientTransaction) hasExpiry() bool {
+	for _, instr := range ct.Instructions {
+		if instr.ValidUntil != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExpiry returns an error if the transaction has an expiration and
+// can't be included in the next block of the skipchain scID.
+func (s *Service) checkExpiry(scID skipchain.SkipBlockID, ct ClientTransaction) error {
+	if !ct.hasExpiry() {
+		return nil
+	}
+	if v, err := s.ActiveServiceVersion(scID); err != nil || v < expiryVersion {
+		return errors.New("the skipchain doesn't support the expiration of transactions yet")
+	}
+	latest, err := s.db().GetLatestByID(scID)
+	if err != nil {
+		return err
+	}
+	if ct.Expired(latest.Index+1, s.chainTime(scID)) {
+		return ErrTxExpired
+	}
+	return nil
+}
+
+// dropExpired returns the transactions of txs that can still be included in
+// a block with the given index and chain time. The clients waiting for the
+// others are told that they are not included.
+func (s *Service) dropExpired(scID skipchain.SkipBlockID, txs ClientTransactions, index int,
+	chainTime int64) ClientTransactions {
+	var kept ClientTransactions
+	for _, ct := range txs {
+		if ct.Expired(index, chainTime) {
+			log.Lvl3(s.txLog(scID).tx(ct).msg("dropping expired transaction"))
+			s.state.informWaitChannel(ct.Instructions.Hash(), false)
+			continue
+		}
+		kept = append(kept, ct)
+	}
+	return kept
+}
+
+// dropExpired removes the expired transactions of the skipchain key from the
+// buffer and returns them.
+func (r *txBuffer) dropExpired(key string, index int, chainTime int64) ClientTransactions {
+	r.Lock()
+	defer r.Unlock()
+	var kept, dropped ClientTransactions
+	for _, ct := range r.txsMap[key] {
+		if ct.Expired(index, chainTime) {
+			dropped = append(dropped, ct)
+		} else {
+			kept = append(kept, ct)
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	if len(kept) == 0 {
+		delete(r.txsMap, key)
+	} else {
+		r.txsMap[key] = kept
+	}
+	return dropped
+}
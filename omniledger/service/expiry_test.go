@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientTransaction_Expiry(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	ct, err := createOneClientTx(darc.ID(make([]byte, 32)), dummyKind, []byte("value"), signer)
+	require.Nil(t, err)
+	hash := ct.Instructions[0].Hash()
+	require.False(t, ct.Expired(1000, time.Now().UnixNano()))
+
+	ct.SetExpiry(Expiry{BlockIndex: 10})
+	require.NotEqual(t, hash, ct.Instructions[0].Hash())
+	require.False(t, ct.Expired(10, time.Now().UnixNano()))
+	require.True(t, ct.Expired(11, 0))
+
+	ct.SetExpiry(Expiry{ChainTime: 100})
+	require.False(t, ct.Expired(1000, 100))
+	require.True(t, ct.Expired(0, 101))
+
+	buf := newTxBuffer()
+	other, err := createOneClientTx(darc.ID(make([]byte, 32)), dummyKind, []byte("value"), signer)
+	require.Nil(t, err)
+	buf.add("sc", ct)
+	buf.add("sc", other)
+	require.Equal(t, 0, len(buf.dropExpired("sc", 0, 100)))
+	require.Equal(t, 1, len(buf.dropExpired("sc", 0, 101)))
+	require.Equal(t, 1, buf.size("sc"))
+}
+
+func TestService_TxExpiry(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+
+	newTx := func(e Expiry) ClientTransaction {
+		tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+		require.Nil(t, err)
+		tx.SetExpiry(e)
+		require.Nil(t, tx.Instructions[0].SignBy(s.signer))
+		return tx
+	}
+	addTx := func(tx ClientTransaction) error {
+		_, err := s.service().AddTransaction(&AddTxRequest{
+			Version:     CurrentVersion,
+			SkipchainID: scID,
+			Transaction: tx,
+		})
+		return err
+	}
+
+	// The expiration needs the version 3 of the service.
+	latest, err := s.service().db().GetLatestByID(scID)
+	require.Nil(t, err)
+	require.NotNil(t, addTx(newTx(Expiry{BlockIndex: latest.Index + 5})))
+	config, err := s.service().LoadConfig(scID)
+	require.Nil(t, err)
+	config.MinServiceVersion = expiryVersion
+	s.sendTx(t, configTx(t, s, *config))
+	for i := 0; i < 10; i++ {
+		if v, _ := s.service().ActiveServiceVersion(scID); v == expiryVersion {
+			break
+		}
+		time.Sleep(s.interval)
+	}
+
+	latest, err = s.service().db().GetLatestByID(scID)
+	require.Nil(t, err)
+	require.Equal(t, ErrTxExpired, addTx(newTx(Expiry{BlockIndex: latest.Index})))
+	require.Equal(t, ErrTxExpired, addTx(newTx(Expiry{ChainTime: 1})))
+
+	tx := newTx(Expiry{BlockIndex: latest.Index + 5})
+	require.Nil(t, addTx(tx))
+	require.True(t, s.waitProof(t, tx.Instructions[0].InstanceID).InclusionProof.Match())
+
+	// An expired transaction in a block is not executed.
+	expired := newTx(Expiry{BlockIndex: 1})
+	cdb := s.service().getCollection(scID)
+	_, ctsOK, _, _, err := s.service().createBlockStateChanges(cdb.coll, scID, ClientTransactions{expired},
+		&blockInfo{index: latest.Index + 1})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(ctsOK))
+}
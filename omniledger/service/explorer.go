@@ -0,0 +1,215 @@
+package service
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// The explorer endpoints summarize the blocks, transactions and instances
+// of a chain for block explorers. Unlike proofs, their answers can't be
+// verified, so they should only be trusted as much as the node.
+
+// maxListBlocks is the maximum number of blocks returned by ListBlocks.
+const maxListBlocks = 100
+
+// maxSearchInstances is the number of instances after which SearchInstances
+// truncates its result.
+const maxSearchInstances = 100
+
+// ListBlocks returns the summaries of req.Count blocks, going back from the
+// latest block or from the block before req.Before.
+func (s *Service) ListBlocks(req *ListBlocks) (*ListBlocksResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if s.state.getLast(req.SkipchainID) == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+	if req.Count <= 0 || req.Count > maxListBlocks {
+		req.Count = maxListBlocks
+	}
+	var sb *skipchain.SkipBlock
+	var err error
+	switch {
+	case req.Before < 0:
+		return nil, errors.New("block indexes must not be negative")
+	case req.Before == 0:
+		sb, err = s.db().GetLatestByID(req.SkipchainID)
+	default:
+		sb, err = s.db().GetByIndex(req.SkipchainID, req.Before-1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := &ListBlocksResponse{Version: CurrentVersion}
+	for sb != nil && len(resp.Blocks) < req.Count {
+		summary, _, err := summarizeBlock(sb)
+		if err != nil {
+			return nil, err
+		}
+		resp.Blocks = append(resp.Blocks, *summary)
+		if sb.Index == 0 || len(sb.BackLinkIDs) == 0 {
+			break
+		}
+		sb = s.db().GetByID(sb.BackLinkIDs[0])
+	}
+	return resp, nil
+}
+
+// DecodeBlock returns the summaries of the transactions executed in the
+// block with index req.Index.
+func (s *Service) DecodeBlock(req *DecodeBlock) (*DecodeBlockResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if s.state.getLast(req.SkipchainID) == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+	sb, err := s.db().GetByIndex(req.SkipchainID, req.Index)
+	if err != nil {
+		return nil, err
+	}
+	if sb == nil {
+		return nil, errors.New("unknown block")
+	}
+	summary, body, err := summarizeBlock(sb)
+	if err != nil {
+		return nil, err
+	}
+	cts, err := s.blockTransactions(sb, body)
+	if err != nil {
+		return nil, errors.New("couldn't decrypt transactions: " + err.Error())
+	}
+	coll := s.GetCollectionView(req.SkipchainID)
+	resp := &DecodeBlockResponse{
+		Version:      CurrentVersion,
+		Block:        *summary,
+		Transactions: make([]TransactionSummary, len(cts)),
+	}
+	for i, ct := range cts {
+		for _, instr := range ct.Instructions {
+			resp.Transactions[i].Instructions = append(resp.Transactions[i].Instructions,
+				summarizeInstruction(coll, instr))
+		}
+	}
+	return resp, nil
+}
+
+// summarizeBlock returns the summary and the body of sb.
+func summarizeBlock(sb *skipchain.SkipBlock) (*BlockSummary, *DataBody, error) {
+	_, headerI, err := network.Unmarshal(sb.Data, cothority.Suite)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, ok := headerI.(*DataHeader)
+	if !ok {
+		return nil, nil, errors.New("couldn't unmarshal header")
+	}
+	body, err := decodeBody(sb)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &BlockSummary{
+		Index:            sb.Index,
+		BlockID:          sb.Hash,
+		Timestamp:        header.UnixNano(),
+		TxCount:          len(body.Transactions),
+		EncryptedTxCount: len(body.EncryptedTransactions),
+	}, body, nil
+}
+
+// summarizeInstruction describes instr, looking up the contract of the
+// instance in coll for invoke and delete.
+func summarizeInstruction(coll CollectionView, instr Instruction) InstructionSummary {
+	is := InstructionSummary{InstanceID: instr.InstanceID}
+	var args Arguments
+	switch {
+	case instr.Spawn != nil:
+		is.Action = "spawn"
+		is.ContractID = instr.Spawn.ContractID
+		args = instr.Spawn.Args
+	case instr.Invoke != nil:
+		is.Action = "invoke"
+		is.Command = instr.Invoke.Command
+		args = instr.Invoke.Args
+	case instr.Delete != nil:
+		is.Action = "delete"
+	}
+	if is.ContractID == "" {
+		if _, contractID, err := coll.GetValues(instr.InstanceID.Slice()); err == nil {
+			is.ContractID = contractID
+		}
+	}
+	for _, a := range args {
+		is.Args = append(is.Args, a.Name)
+	}
+	for _, sig := range instr.Signatures {
+		is.Signers = append(is.Signers, sig.Signer.String())
+	}
+	return is
+}
+
+// SearchInstances returns the instances whose hex encoded ID contains the
+// query, and the darcs whose description contains it, unless they have a
+// ReadRule.
+func (s *Service) SearchInstances(req *SearchInstances) (*SearchInstancesResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if s.state.getLast(req.SkipchainID) == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+	query := strings.ToLower(strings.TrimSpace(req.Query))
+	if query == "" {
+		return nil, errors.New("empty query")
+	}
+	log.Lvlf2("%s: Searching instances of %x", s.ServerIdentity(), req.SkipchainID)
+	resp := &SearchInstancesResponse{Version: CurrentVersion}
+	cdb := s.getCollection(req.SkipchainID)
+	coll := &roCollection{cdb.coll}
+	err := cdb.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(cdb.bucketName)
+		cur := b.Cursor()
+		for k, v := cur.Seek([]byte{collValuePrefix}); k != nil && k[0] == collValuePrefix; k, v = cur.Next() {
+			k = k[1:]
+			cv := b.Get(collContractKey(k))
+			if cv == nil {
+				continue
+			}
+			is := InstanceSummary{
+				InstanceID: NewInstanceID(dup(k)),
+				ContractID: string(cv),
+			}
+			match := strings.Contains(hex.EncodeToString(k), query)
+			// The description of a darc with a ReadRule is not public.
+			if is.ContractID == ContractDarcID && s.canRead(coll, k, nil) {
+				if d, err := darc.NewFromProtobuf(v); err == nil {
+					is.Description = string(d.Description)
+					match = match || bytes.Contains(bytes.ToLower(d.Description), []byte(query))
+				}
+			}
+			if !match {
+				continue
+			}
+			if len(resp.Instances) >= maxSearchInstances {
+				resp.Truncated = true
+				return nil
+			}
+			resp.Instances = append(resp.Instances, is)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("couldn't search instances: " + err.Error())
+	}
+	return resp, nil
+}
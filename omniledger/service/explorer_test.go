@@ -0,0 +1,89 @@
+package service
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Explorer(t *testing.T) {
+	s := newSer(t, 2, testInterval)
+	defer s.local.CloseAll()
+
+	id := s.tx.Instructions[0].InstanceID
+	s.waitProof(t, id)
+
+	blocks, err := s.service().ListBlocks(&ListBlocks{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+	})
+	require.Nil(t, err)
+	require.True(t, len(blocks.Blocks) >= 2)
+	require.Equal(t, 0, blocks.Blocks[len(blocks.Blocks)-1].Index)
+	index := -1
+	for i, b := range blocks.Blocks {
+		if i > 0 {
+			require.Equal(t, blocks.Blocks[i-1].Index-1, b.Index)
+		}
+		if b.TxCount == 1 {
+			index = b.Index
+		}
+	}
+	require.NotEqual(t, -1, index)
+
+	// Paging goes on with the blocks before the given index.
+	page, err := s.service().ListBlocks(&ListBlocks{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		Before:      blocks.Blocks[0].Index,
+		Count:       1,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(page.Blocks))
+	require.Equal(t, blocks.Blocks[1], page.Blocks[0])
+
+	decoded, err := s.service().DecodeBlock(&DecodeBlock{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		Index:       index,
+	})
+	require.Nil(t, err)
+	require.Equal(t, index, decoded.Block.Index)
+	require.Equal(t, 1, len(decoded.Transactions))
+	is := decoded.Transactions[0].Instructions[0]
+	require.True(t, is.InstanceID.Equal(id))
+	require.Equal(t, "spawn", is.Action)
+	require.Equal(t, dummyKind, is.ContractID)
+	require.Equal(t, []string{"data"}, is.Args)
+	require.Equal(t, []string{s.signer.Identity().String()}, is.Signers)
+
+	search := func(query string) []InstanceSummary {
+		resp, err := s.service().SearchInstances(&SearchInstances{
+			Version:     CurrentVersion,
+			SkipchainID: s.sb.SkipChainID(),
+			Query:       query,
+		})
+		require.Nil(t, err)
+		return resp.Instances
+	}
+	found := search("GENESIS")
+	require.Equal(t, 1, len(found))
+	require.Equal(t, ContractDarcID, found[0].ContractID)
+	require.Equal(t, "genesis darc", found[0].Description)
+	found = search(hex.EncodeToString(id.SubID[:]))
+	require.Equal(t, 1, len(found))
+	require.Equal(t, dummyKind, found[0].ContractID)
+	require.Equal(t, 0, len(search("no such description")))
+
+	_, err = s.service().SearchInstances(&SearchInstances{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+	})
+	require.NotNil(t, err)
+	_, err = s.service().ListBlocks(&ListBlocks{
+		Version:     CurrentVersion,
+		SkipchainID: make([]byte, 32),
+	})
+	require.NotNil(t, err)
+}
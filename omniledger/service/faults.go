@@ -0,0 +1,82 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+)
+
+// Stage is a step of the production of a block by the leader.
+type Stage int
+
+const (
+	// StageNone is no stage at all.
+	StageNone Stage = iota
+	// StageCollect is before the leader collects the transactions.
+	StageCollect
+	// StageCreate is after the transactions have been collected, before
+	// the new block is created.
+	StageCreate
+	// StageStored is after the new block has been stored by the roster.
+	StageStored
+)
+
+// Faults are failures that a test injects in a conode, so that the view
+// changes and the catch-up of the nodes can be tested deterministically. The
+// skipchain service has its own skipchain.Faults for the propagation and the
+// signature of the blocks. They must not be used in production.
+type Faults struct {
+	// DropCollectTx makes the node ignore the requests of the leader for
+	// its transactions, as if they were lost. The leader waits for the
+	// protocol timeout, and the node gets no heartbeat.
+	DropCollectTx bool
+	// CrashAt makes the leader stop producing blocks once it reaches the
+	// stage, as if it crashed. The node still answers the other requests,
+	// so the server has to be paused to crash it completely.
+	CrashAt Stage
+	// CorruptBlock is called with every new block the leader proposes,
+	// before the roster verifies it.
+	CorruptBlock func(*skipchain.SkipBlock)
+}
+
+// faults protects the Faults of the service.
+type faults struct {
+	sync.Mutex
+	Faults
+}
+
+func (f *faults) get() Faults {
+	f.Lock()
+	defer f.Unlock()
+	return f.Faults
+}
+
+// SetFaults replaces the faults injected in the service. An empty Faults
+// removes them, but a leader that crashed doesn't produce blocks anymore.
+func (s *Service) SetFaults(f Faults) {
+	s.faults.Lock()
+	s.faults.Faults = f
+	s.faults.Unlock()
+}
+
+// crashAt returns true if the leader must crash at the stage.
+func (s *Service) crashAt(scID skipchain.SkipBlockID, stage Stage) bool {
+	if s.faults.get().CrashAt != stage {
+		return false
+	}
+	log.Lvlf2("%s: injected crash of the leader of %x at stage %d", s.ServerIdentity(), scID, stage)
+	return true
+}
+
+// newCollectTxProtocol creates the protocol to collect the transactions with
+// the faults of the service.
+func (s *Service) newCollectTxProtocol(node *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	pi, err := NewCollectTxProtocol(s.getTxs)(node)
+	if err != nil {
+		return nil, err
+	}
+	pi.(*CollectTxProtocol).dropRequest = s.faults.get().DropCollectTx
+	return pi, nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_FaultCrashLeader(t *testing.T) {
+	interval := 2 * time.Second
+	s := newSerN(t, 1, interval, 4, true)
+	defer s.local.CloseAll()
+
+	for _, service := range s.services {
+		service.SetPropagationTimeout(interval / 2)
+	}
+	s.service().SetFaults(Faults{CrashAt: StageCollect})
+
+	var ok bool
+	for i := 0; i < 5; i++ {
+		time.Sleep(2 * s.interval)
+		config, err := s.services[1].LoadConfig(s.sb.SkipChainID())
+		require.NoError(t, err)
+		if config.Roster.List[0].Equal(s.services[1].ServerIdentity()) {
+			ok = true
+			break
+		}
+	}
+	require.True(t, ok, "leader rotation failed")
+}
+
+func TestService_FaultCorruptBlock(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	s.service().SetFaults(Faults{CorruptBlock: func(sb *skipchain.SkipBlock) {
+		sb.Payload = []byte("corrupted")
+	}})
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx)
+	time.Sleep(4 * s.interval)
+
+	pr, err := s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		Key:     tx.Instructions[0].InstanceID.Slice(),
+		ID:      s.sb.SkipChainID(),
+	})
+	require.Nil(t, err)
+	require.False(t, pr.Proof.InclusionProof.Match())
+
+	s.service().SetFaults(Faults{})
+	tx, err = createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx)
+	pr2 := s.waitProof(t, tx.Instructions[0].InstanceID)
+	require.True(t, pr2.InclusionProof.Match())
+}
+
+func TestService_FaultDropCollectTx(t *testing.T) {
+	s := newSerN(t, 1, testInterval, 4, false)
+	defer s.local.CloseAll()
+
+	s.services[2].SetFaults(Faults{DropCollectTx: true})
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	s.sendTxTo(t, tx, 2)
+	time.Sleep(4 * s.interval)
+
+	pr, err := s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		Key:     tx.Instructions[0].InstanceID.Slice(),
+		ID:      s.sb.SkipChainID(),
+	})
+	require.Nil(t, err)
+	require.False(t, pr.Proof.InclusionProof.Match())
+
+	// Once the requests get through, the transaction is collected.
+	s.services[2].SetFaults(Faults{})
+	pr2 := s.waitProof(t, tx.Instructions[0].InstanceID)
+	require.True(t, pr2.InclusionProof.Match())
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// defaultMaxWaiters is how many clients can wait for the inclusion of their
+// transactions on a conode at the same time.
+const defaultMaxWaiters = 1000
+
+// defaultMaxInclusionWait is the longest a client can wait for the inclusion
+// of its transaction, whatever its InclusionWait.
+const defaultMaxInclusionWait = 5 * time.Minute
+
+// ErrInclusionTimeout is returned when the transaction was not in the blocks
+// of the InclusionWait of the request.
+var ErrInclusionTimeout = errors.New("didn't find transaction in blocks")
+
+// ErrTooManyWaiters is returned for a transaction with an InclusionWait when
+// the conode already has too many clients waiting. The transaction is in the
+// buffer anyway, so the client can look for it with a proof.
+var ErrTooManyWaiters = errors.New("too many clients waiting for their transactions")
+
+// SetInclusionWaitLimits sets how many clients can wait for the inclusion of
+// their transactions at the same time, and how long they can wait at most. A
+// value of zero or less keeps the current limit.
+func (s *Service) SetInclusionWaitLimits(waiters int, wait time.Duration) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	if waiters > 0 {
+		s.state.maxWaiters = waiters
+	}
+	if wait > 0 {
+		s.state.maxInclusionWait = wait
+	}
+}
+
+// inclusionError returns the typed error of InclusionWait that the error err
+// of a conode stands for, or err itself.
+func inclusionError(err error) error {
+	for _, e := range []error{ErrInclusionTimeout, ErrTooManyWaiters} {
+		if strings.Contains(err.Error(), e.Error()) {
+			return e
+		}
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOlState_WaitChannels(t *testing.T) {
+	ol := olState{
+		waitChannels:     make(map[string][]chan bool),
+		maxWaiters:       2,
+		maxInclusionWait: time.Minute,
+	}
+	ch1, err := ol.createWaitChannel([]byte("tx"))
+	require.Nil(t, err)
+	ch2, err := ol.createWaitChannel([]byte("tx"))
+	require.Nil(t, err)
+	_, err = ol.createWaitChannel([]byte("other"))
+	require.Equal(t, ErrTooManyWaiters, err)
+
+	// All the clients waiting for the transaction are informed, and
+	// informing them twice doesn't block.
+	ol.informWaitChannel([]byte("tx"), true)
+	ol.informWaitChannel([]byte("tx"), false)
+	require.True(t, <-ch1)
+	require.True(t, <-ch2)
+
+	ol.deleteWaitChannel([]byte("tx"), ch1)
+	_, err = ol.createWaitChannel([]byte("other"))
+	require.Nil(t, err)
+	ol.deleteWaitChannel([]byte("tx"), ch2)
+	require.Equal(t, 1, ol.waiting)
+	require.Equal(t, 1, len(ol.waitChannels))
+
+	require.Equal(t, 2*time.Second, ol.inclusionWait(2, time.Second))
+	require.Equal(t, time.Minute, ol.inclusionWait(100, time.Second))
+}
+
+func TestInclusionError(t *testing.T) {
+	require.Equal(t, ErrInclusionTimeout,
+		inclusionError(errors.New("websocket error: "+ErrInclusionTimeout.Error())))
+	require.Equal(t, ErrTooManyWaiters, inclusionError(errors.New(ErrTooManyWaiters.Error())))
+	other := errors.New("other")
+	require.Equal(t, other, inclusionError(other))
+}
+
+func TestService_InclusionWaitLimits(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	s.service().SetInclusionWaitLimits(0, s.interval)
+
+	// The transaction is refused, so it is never in a block.
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value,
+		darc.NewSignerEd25519(nil, nil))
+	require.Nil(t, err)
+	start := time.Now()
+	_, err = s.service().AddTransaction(&AddTxRequest{
+		Version:       CurrentVersion,
+		SkipchainID:   s.sb.SkipChainID(),
+		Transaction:   tx,
+		InclusionWait: 100,
+	})
+	require.Equal(t, ErrInclusionTimeout, err)
+	require.True(t, time.Since(start) < 10*s.interval)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/cothority/skipchain"
+)
+
+// LogJSON makes the transaction pipeline write its log messages as JSON
+// objects instead of key=value pairs, so that they can be indexed by a log
+// collector. It is set by the --log-json flag of the conode.
+var LogJSON = false
+
+// txLog holds the fields that tell what a log message of the transaction
+// pipeline is about. The transaction is identified by the hash of its
+// instructions, the same on the client, the leader and the followers, so
+// grepping for it shows the whole life of the transaction.
+type txLog struct {
+	Node  string `json:"node,omitempty"`
+	Chain string `json:"chain,omitempty"`
+	Block *int   `json:"block,omitempty"`
+	Tx    string `json:"tx,omitempty"`
+	Msg   string `json:"msg"`
+}
+
+// txLog returns the log fields of this node for the skipchain scID, which
+// can be nil.
+func (s *Service) txLog(scID skipchain.SkipBlockID) txLog {
+	l := txLog{Chain: hex.EncodeToString(scID)}
+	if si := s.ServerIdentity(); si != nil {
+		l.Node = si.Address.String()
+	}
+	return l
+}
+
+// block returns a copy of the fields with the index of a block.
+func (l txLog) block(index int) txLog {
+	l.Block = &index
+	return l
+}
+
+// tx returns a copy of the fields with the hash of a transaction.
+func (l txLog) tx(ct ClientTransaction) txLog {
+	l.Tx = hex.EncodeToString(ct.Instructions.Hash())
+	return l
+}
+
+// msg returns the message with the fields, to be passed to the onet log
+// functions so that they still show where the message comes from.
+func (l txLog) msg(args ...interface{}) string {
+	l.Msg = strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+	return l.String()
+}
+
+// msgf is like msg with a format string.
+func (l txLog) msgf(f string, args ...interface{}) string {
+	l.Msg = fmt.Sprintf(f, args...)
+	return l.String()
+}
+
+// String returns the fields and the message as JSON if LogJSON is set, or
+// as key=value pairs followed by the message.
+func (l txLog) String() string {
+	if LogJSON {
+		buf, err := json.Marshal(l)
+		if err != nil {
+			return l.Msg
+		}
+		return string(buf)
+	}
+	var fields []string
+	if l.Node != "" {
+		fields = append(fields, "node="+l.Node)
+	}
+	if l.Chain != "" {
+		fields = append(fields, "chain="+l.Chain)
+	}
+	if l.Block != nil {
+		fields = append(fields, "block="+strconv.Itoa(*l.Block))
+	}
+	if l.Tx != "" {
+		fields = append(fields, "tx="+l.Tx)
+	}
+	return strings.Join(fields, " ") + ": " + l.Msg
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxLog(t *testing.T) {
+	ct := ClientTransaction{Instructions: Instructions{{Index: 0, Length: 1}}}
+	hash := hex.EncodeToString(ct.Instructions.Hash())
+	l := txLog{Node: "tls://127.0.0.1:7770", Chain: "abcd"}
+
+	require.Equal(t, "node=tls://127.0.0.1:7770 chain=abcd: a message 1",
+		l.msg("a message", 1))
+	require.Equal(t, "node=tls://127.0.0.1:7770 chain=abcd block=0 tx="+hash+": block 0",
+		l.block(0).tx(ct).msgf("block %d", 0))
+	// The fields are copied, not shared.
+	require.Nil(t, l.Block)
+	require.Equal(t, "", l.Tx)
+
+	LogJSON = true
+	defer func() { LogJSON = false }()
+	var fields map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(l.block(2).tx(ct).msg("a message")), &fields))
+	require.Equal(t, map[string]interface{}{
+		"node":  "tls://127.0.0.1:7770",
+		"chain": "abcd",
+		"block": 2.0,
+		"tx":    hash,
+		"msg":   "a message",
+	}, fields)
+}
@@ -13,6 +13,25 @@ func init() {
 	network.RegisterMessages(
 		&CreateGenesisBlock{}, &CreateGenesisBlockResponse{},
 		&AddTxRequest{}, &AddTxResponse{},
+		&CallView{}, &CallViewResponse{},
+		&SearchEvents{}, &SearchEventsResponse{},
+		&ResolveName{}, &ResolveNameResponse{},
+		&ListBlocks{}, &ListBlocksResponse{},
+		&DecodeBlock{}, &DecodeBlockResponse{},
+		&SearchInstances{}, &SearchInstancesResponse{},
+		&GetUpdates{}, &GetUpdatesResponse{},
+		&GetContractRegistry{}, &GetContractRegistryResponse{},
+		&CreateTxKey{}, &CreateTxKeyResponse{},
+		&AddEncryptedTxRequest{}, &AddEncryptedTxResponse{},
+		&Backup{}, &BackupResponse{},
+		&Restore{}, &RestoreResponse{},
+		&SetQuota{}, &SetQuotaResponse{},
+		&CloneChain{}, &CloneChainResponse{},
+		&Replicate{}, &ReplicateResponse{},
+		&SetAdminDarc{}, &SetAdminDarcResponse{},
+		&GetRosterHealth{}, &GetRosterHealthResponse{},
+		&ListChains{}, &ListChainsResponse{},
+		&SetChainEnabled{}, &SetChainEnabledResponse{},
 	)
 }
 
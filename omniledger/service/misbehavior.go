@@ -0,0 +1,361 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoinx"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/cosi"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// The misbehavior contract stores verifiable evidence against the nodes of
+// the roster. Every node has one record under MisbehaviorKey, which only
+// holds evidence that the contract could verify itself. So the governance
+// darc can decide to remove a node from the roster with "update_config"
+// based on its record, and everybody can verify the evidence again.
+
+// ContractMisbehaviorID denotes a misbehavior-contract
+var ContractMisbehaviorID = "misbehavior"
+
+const (
+	// EvidenceEquivocation is an EquivocationEvidence of nodes that signed
+	// two different blocks with the same index.
+	EvidenceEquivocation = "equivocation"
+	// EvidenceInvalidBlock is an InvalidBlockEvidence of nodes that signed
+	// a block with invalid transactions.
+	EvidenceInvalidBlock = "invalid_block"
+	// EvidenceRefusal is a RefusalEvidence of a node that refused to
+	// propagate a block. As it can't be proven, the instruction must be
+	// signed by more nodes of the roster than can be faulty.
+	EvidenceRefusal = "refusal"
+)
+
+// MisbehaviorKey returns the key of the record of the node with the given
+// public key, stored under the darc darcID.
+func MisbehaviorKey(darcID darc.ID, public kyber.Point) InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractMisbehaviorID))
+	public.MarshalTo(h)
+	return InstanceID{DarcID: darcID, SubID: NewSubID(h.Sum(nil))}
+}
+
+// LoadMisbehaviorRecord returns the record of the node with the given public
+// key, or an error if there is no evidence against it.
+func LoadMisbehaviorRecord(coll CollectionView, darcID darc.ID, public kyber.Point) (*MisbehaviorRecord, error) {
+	value, contractID, err := coll.GetValues(MisbehaviorKey(darcID, public).Slice())
+	if err != nil {
+		return nil, err
+	}
+	if contractID != ContractMisbehaviorID {
+		return nil, errors.New("not a misbehavior record")
+	}
+	var rec MisbehaviorRecord
+	err = protobuf.DecodeWithConstructors(value, &rec, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// contractMisbehavior accepts the following instructions:
+//   - Spawn - sent to a darc, verifies the argument "evidence" of the type in
+//     the argument "type" and adds it to the records of all the culprits
+//     that are in the current roster
+var contractMisbehavior = BasicContract{
+	SpawnFn: misbehaviorSpawn,
+}
+
+func misbehaviorSpawn(coll CollectionView, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	config, err := LoadConfigFromColl(coll)
+	if err != nil {
+		return nil, nil, err
+	}
+	scID, err := skipChainID(coll)
+	if err != nil {
+		return nil, nil, err
+	}
+	evType := string(inst.Spawn.Args.Search("type"))
+	evidence := inst.Spawn.Args.Search("evidence")
+	var culprits []kyber.Point
+	switch evType {
+	case EvidenceEquivocation:
+		culprits, err = verifyEquivocation(scID, config.Roster.Publics(), evidence)
+	case EvidenceInvalidBlock:
+		culprits, err = verifyInvalidBlock(scID, evidence)
+	case EvidenceRefusal:
+		culprits, err = verifyRefusal(config.Roster.Publics(), inst, evidence)
+	default:
+		return nil, nil, fmt.Errorf("unknown evidence type \"%s\"", evType)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s evidence: %v", evType, err)
+	}
+
+	var scs []StateChange
+	for _, public := range culprits {
+		if !inRoster(config.Roster.Publics(), public) {
+			continue
+		}
+		key := MisbehaviorKey(inst.InstanceID.DarcID, public)
+		action := Update
+		rec, err := LoadMisbehaviorRecord(coll, inst.InstanceID.DarcID, public)
+		if err != nil {
+			action = Create
+			rec = &MisbehaviorRecord{Public: public}
+		}
+		if rec.has(evType, evidence) {
+			continue
+		}
+		rec.Evidence = append(rec.Evidence, MisbehaviorEvidence{Type: evType, Evidence: evidence})
+		buf, err := protobuf.Encode(rec)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Lvlf2("Storing %s evidence against %s", evType, public)
+		scs = append(scs, NewStateChange(action, key, ContractMisbehaviorID, buf))
+	}
+	if len(scs) == 0 {
+		return nil, nil, errors.New("no new evidence against a node of the roster")
+	}
+	return scs, coins, nil
+}
+
+func (rec *MisbehaviorRecord) has(evType string, evidence []byte) bool {
+	for _, e := range rec.Evidence {
+		if e.Type == evType && bytes.Equal(e.Evidence, evidence) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyEquivocation returns the nodes that signed the forward-links of the
+// EquivocationEvidence to two blocks of the skipchain scID with the same
+// index. As the leader changes with every view-change, all the rotations of
+// the roster are tried.
+func verifyEquivocation(scID skipchain.SkipBlockID, publics []kyber.Point, buf []byte) ([]kyber.Point, error) {
+	var e EquivocationEvidence
+	err := protobuf.DecodeWithConstructors(buf, &e, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	if err = checkLinkedBlock(scID, &e.First, &e.FirstLink); err != nil {
+		return nil, err
+	}
+	if err = checkLinkedBlock(scID, &e.Second, &e.SecondLink); err != nil {
+		return nil, err
+	}
+	if e.First.Index != e.Second.Index {
+		return nil, errors.New("the blocks have different indexes")
+	}
+	if !e.FirstLink.From.Equal(e.SecondLink.From) {
+		return nil, errors.New("the forward-links don't follow the same block")
+	}
+	ev := byzcoinx.Evidence{
+		Round:      e.FirstLink.From,
+		First:      e.FirstLink.Signature,
+		Second:     e.SecondLink.Signature,
+		FirstData:  linkData(&e.FirstLink),
+		SecondData: linkData(&e.SecondLink),
+	}
+	n := len(publics)
+	for i := 0; i < n; i++ {
+		var idx []int
+		idx, err = ev.Verify(cothority.Suite, publics, byzcoinx.Threshold(n))
+		if err == nil {
+			culprits := make([]kyber.Point, len(idx))
+			for j, k := range idx {
+				culprits[j] = publics[k]
+			}
+			return culprits, nil
+		}
+		publics = append(publics[1:], publics[0])
+	}
+	return nil, err
+}
+
+// verifyInvalidBlock returns the nodes that signed the forward-link to a
+// block of the skipchain scID that none of the honest nodes would have
+// accepted. Only the checks that don't need the state of the chain are done,
+// so the block is invalid if its header doesn't match its body or if one of
+// its instructions has an invalid signature.
+func verifyInvalidBlock(scID skipchain.SkipBlockID, buf []byte) ([]kyber.Point, error) {
+	var e InvalidBlockEvidence
+	err := protobuf.DecodeWithConstructors(buf, &e, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	sb := &e.Block
+	if err = checkLinkedBlock(scID, sb, &e.Link); err != nil {
+		return nil, err
+	}
+	culprits, err := linkSigners(&e.Link, sb.Roster.Publics())
+	if err != nil {
+		return nil, err
+	}
+	if err = invalidBlock(sb); err == nil {
+		return nil, errors.New("the block is valid")
+	}
+	log.Lvl3("Block", sb.Hash, "is invalid:", err)
+	return culprits, nil
+}
+
+// checkLinkedBlock returns an error if sb is not an omniledger block of the
+// skipchain scID, or if fl doesn't point to it. Honest nodes of other
+// skipchains sign blocks that omniledger can't verify, so they are no
+// evidence.
+func checkLinkedBlock(scID skipchain.SkipBlockID, sb *skipchain.SkipBlock, fl *skipchain.ForwardLink) error {
+	if sb.SkipBlockFix == nil || sb.Roster == nil {
+		return errors.New("missing block")
+	}
+	if !sb.CalculateHash().Equal(sb.Hash) {
+		return errors.New("wrong block hash")
+	}
+	if !sb.SkipChainID().Equal(scID) {
+		return errors.New("block of another skipchain")
+	}
+	omniledger := false
+	for _, v := range sb.VerifierIDs {
+		if v.Equal(verifyOmniLedger) {
+			omniledger = true
+		}
+	}
+	if !omniledger {
+		return errors.New("not an omniledger block")
+	}
+	if !fl.To.Equal(sb.Hash) {
+		return errors.New("forward-link doesn't point to the block")
+	}
+	if !bytes.Equal(fl.Signature.Msg, fl.Hash()) {
+		return errors.New("wrong hash of forward-link")
+	}
+	return nil
+}
+
+// linkSigners verifies the forward-link with the threshold of the skipchain
+// service and returns the nodes that signed it. As the leader changes with
+// every view-change, all the rotations of the roster are tried.
+func linkSigners(fl *skipchain.ForwardLink, publics []kyber.Point) ([]kyber.Point, error) {
+	n := len(publics)
+	if n == 0 {
+		return nil, errors.New("no public keys")
+	}
+	policy := cosi.NewThresholdPolicy(byzcoinx.Threshold(n))
+	var err error
+	for i := 0; i < n; i++ {
+		err = cosi.Verify(cothority.Suite, publics, fl.Signature.Msg, fl.Signature.Sig, policy)
+		if err == nil {
+			var mask *cosi.Mask
+			mask, err = cosi.NewMask(cothority.Suite, publics, nil)
+			if err != nil {
+				return nil, err
+			}
+			sig := fl.Signature.Sig
+			if err = mask.SetMask(sig[len(sig)-mask.Len():]); err != nil {
+				return nil, err
+			}
+			var signers []kyber.Point
+			for _, p := range publics {
+				if enabled, _ := mask.KeyEnabled(p); enabled {
+					signers = append(signers, p)
+				}
+			}
+			return signers, nil
+		}
+		publics = append(publics[1:], publics[0])
+	}
+	return nil, err
+}
+
+// linkData returns the data of the round of a forward-link, whose round is
+// the block it comes from, so that its message is byzcoinx.RoundMessage.
+func linkData(fl *skipchain.ForwardLink) []byte {
+	data := append([]byte{}, fl.To...)
+	if fl.NewRoster != nil {
+		data = append(data, fl.NewRoster.ID[:]...)
+	}
+	return data
+}
+
+// invalidBlock returns the reason why the block is invalid, or nil if the
+// block passes all the checks that don't need the state.
+func invalidBlock(sb *skipchain.SkipBlock) error {
+	_, headerI, err := network.Unmarshal(sb.Data, cothority.Suite)
+	header, ok := headerI.(*DataHeader)
+	if err != nil || !ok {
+		return errors.New("couldn't unmarshal header")
+	}
+	body, err := decodeBody(sb)
+	if err != nil {
+		return errors.New("couldn't unmarshal body")
+	}
+	if !bytes.Equal(header.ClientTransactionHash, body.Transactions.Hash()) {
+		return errors.New("client transaction hash doesn't match")
+	}
+	encHash, err := encryptedHash(body)
+	if err != nil || !bytes.Equal(header.EncryptedHash, encHash) {
+		return errors.New("encrypted transactions hash doesn't match")
+	}
+	for _, ct := range body.Transactions {
+		for _, instr := range ct.Instructions {
+			req, err := instr.ToDarcRequest(sb.SkipChainID())
+			if err != nil {
+				return err
+			}
+			digest := req.Hash()
+			for _, sig := range instr.Signatures {
+				if err = sig.Signer.Verify(digest, sig.Signature); err != nil {
+					return fmt.Errorf("instruction %x has an invalid signature: %v", instr.Hash(), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// verifyRefusal returns the node of the RefusalEvidence if the instruction
+// is signed by more nodes of the roster than FaultThreshold, so that at
+// least one honest node saw the refusal. The accused node doesn't count.
+func verifyRefusal(publics []kyber.Point, inst Instruction, buf []byte) ([]kyber.Point, error) {
+	var e RefusalEvidence
+	err := protobuf.DecodeWithConstructors(buf, &e, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	if e.Public == nil || len(e.BlockID) == 0 {
+		return nil, errors.New("missing node or block")
+	}
+	var witnesses []kyber.Point
+	for _, sig := range inst.Signatures {
+		if sig.Signer.Ed25519 == nil {
+			continue
+		}
+		p := sig.Signer.Ed25519.Point
+		if p.Equal(e.Public) || !inRoster(publics, p) || inRoster(witnesses, p) {
+			continue
+		}
+		witnesses = append(witnesses, p)
+	}
+	if len(witnesses) <= byzcoinx.FaultThreshold(len(publics)) {
+		return nil, fmt.Errorf("only %d nodes of the roster signed the evidence", len(witnesses))
+	}
+	return []kyber.Point{e.Public}, nil
+}
+
+func inRoster(publics []kyber.Point, p kyber.Point) bool {
+	for _, q := range publics {
+		if q.Equal(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/cosi"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMisbehavior(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	hosts, _, _ := local.GenTree(1, false)
+	s := local.GetServices(hosts, OmniledgerID)[0].(*Service)
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+	apply := func(scs StateChanges) {
+		for _, sc := range scs {
+			require.Nil(t, storeInColl(coll.c, &sc))
+		}
+	}
+
+	roster, privates := genRoster(4)
+	publics := roster.Publics()
+	darcID := make([]byte, 32)
+	configBuf, err := protobuf.Encode(&ChainConfig{BlockInterval: defaultInterval, Roster: *roster})
+	require.Nil(t, err)
+	apply(StateChanges{
+		NewStateChange(Create, GenesisReferenceID, ContractConfigID, darcID),
+		NewStateChange(Create, InstanceID{darcID, oneSubID}, ContractConfigID, configBuf),
+	})
+
+	spawn := func(evType string, evidence interface{}, signers ...int) Instruction {
+		buf, err := protobuf.Encode(evidence)
+		require.Nil(t, err)
+		inst := Instruction{
+			InstanceID: InstanceID{DarcID: darcID},
+			Spawn: &Spawn{
+				ContractID: ContractMisbehaviorID,
+				Args: Arguments{
+					{Name: "type", Value: []byte(evType)},
+					{Name: "evidence", Value: buf},
+				},
+			},
+		}
+		for _, i := range signers {
+			inst.Signatures = append(inst.Signatures,
+				darc.Signature{Signer: darc.NewIdentityEd25519(publics[i])})
+		}
+		return inst
+	}
+	count := func(i int) int {
+		rec, err := LoadMisbehaviorRecord(coll, darcID, publics[i])
+		if err != nil {
+			return 0
+		}
+		return len(rec.Evidence)
+	}
+
+	// The evidence must be about blocks of the skipchain of the contract.
+	scID := skipchain.SkipBlockID(make([]byte, 32))
+	scID[0] = 1
+	s.darcToScMut.Lock()
+	s.darcToSc[string(darcID)] = scID
+	s.darcToScMut.Unlock()
+	forward := func(sb *skipchain.SkipBlock, signers ...int) skipchain.ForwardLink {
+		sb.Hash = sb.CalculateHash()
+		fl := skipchain.ForwardLink{From: []byte("previous"), To: sb.Hash}
+		fl.Signature.Msg = fl.Hash()
+		fl.Signature.Sig = cosiSign(t, privates, publics, signers, fl.Signature.Msg)
+		return fl
+	}
+
+	// Nodes 0 to 2 signed two blocks with the same index.
+	first := newBlockWithTxs(t, scID, roster, ClientTransactions{}, nil)
+	second := newBlockWithTxs(t, scID, roster, ClientTransactions{{}}, nil)
+	equivocation := &EquivocationEvidence{
+		FirstLink:  forward(first, 0, 1, 2, 3),
+		SecondLink: forward(second, 0, 1, 2),
+	}
+	equivocation.First, equivocation.Second = *first, *second
+	scs, _, err := s.executeInstruction(coll, nil, spawn(EvidenceEquivocation, equivocation))
+	require.Nil(t, err)
+	apply(scs)
+	require.Equal(t, []int{1, 1, 1, 0}, []int{count(0), count(1), count(2), count(3)})
+	_, _, err = s.executeInstruction(coll, nil, spawn(EvidenceEquivocation, equivocation))
+	require.NotNil(t, err)
+
+	// Honest nodes sign forward-links of different heights from the same
+	// block.
+	higher := newBlockWithTxs(t, scID, roster, ClientTransactions{{}}, nil)
+	higher.Index = 2
+	honest := *equivocation
+	honest.SecondLink = forward(higher, 0, 1, 2)
+	honest.Second = *higher
+	_, _, err = s.executeInstruction(coll, nil, spawn(EvidenceEquivocation, &honest))
+	require.NotNil(t, err)
+	honest = *equivocation
+	honest.Second, honest.SecondLink = honest.First, honest.FirstLink
+	_, _, err = s.executeInstruction(coll, nil, spawn(EvidenceEquivocation, &honest))
+	require.NotNil(t, err)
+
+	// Nodes 0 to 2 signed a block whose header doesn't match its
+	// transactions.
+	link := func(sb *skipchain.SkipBlock, signers ...int) *InvalidBlockEvidence {
+		return &InvalidBlockEvidence{Link: forward(sb, signers...), Block: *sb}
+	}
+	sb := newBlockWithTxs(t, scID, roster, ClientTransactions{{Instructions: Instructions{{
+		InstanceID: InstanceID{DarcID: darcID},
+		Invoke:     &Invoke{Command: "update"},
+	}}}}, nil)
+	_, _, err = s.executeInstruction(coll, nil, spawn(EvidenceInvalidBlock, link(sb, 0, 1, 2)))
+	require.NotNil(t, err)
+	sb = newBlockWithTxs(t, scID, roster, ClientTransactions{{}}, []byte("wrong hash"))
+	_, _, err = s.executeInstruction(coll, nil, spawn(EvidenceInvalidBlock, link(sb, 0)))
+	require.NotNil(t, err)
+	scs, _, err = s.executeInstruction(coll, nil, spawn(EvidenceInvalidBlock, link(sb, 0, 1, 2)))
+	require.Nil(t, err)
+	apply(scs)
+	require.Equal(t, []int{2, 2, 2, 0}, []int{count(0), count(1), count(2), count(3)})
+
+	// The blocks of other skipchains are no evidence, even if omniledger
+	// can't read them.
+	other := newBlockWithTxs(t, []byte("other chain"), roster, ClientTransactions{{}}, []byte("wrong hash"))
+	_, _, err = s.executeInstruction(coll, nil, spawn(EvidenceInvalidBlock, link(other, 0, 1, 2)))
+	require.NotNil(t, err)
+	other = newBlockWithTxs(t, scID, roster, ClientTransactions{{}}, nil)
+	other.VerifierIDs = []skipchain.VerifierID{skipchain.VerifyBase}
+	other.Data = []byte("not an omniledger header")
+	_, _, err = s.executeInstruction(coll, nil, spawn(EvidenceInvalidBlock, link(other, 0, 1, 2)))
+	require.NotNil(t, err)
+
+	// A refusal must be reported by more nodes than can be faulty.
+	refusal := &RefusalEvidence{Public: publics[3], BlockID: sb.Hash}
+	_, _, err = s.executeInstruction(coll, nil, spawn(EvidenceRefusal, refusal, 0, 3))
+	require.NotNil(t, err)
+	scs, _, err = s.executeInstruction(coll, nil, spawn(EvidenceRefusal, refusal, 0, 1))
+	require.Nil(t, err)
+	apply(scs)
+	require.Equal(t, 1, count(3))
+	rec, err := LoadMisbehaviorRecord(coll, darcID, publics[3])
+	require.Nil(t, err)
+	require.Equal(t, EvidenceRefusal, rec.Evidence[0].Type)
+
+	_, _, err = s.executeInstruction(coll, nil, spawn("hearsay", refusal, 0, 1, 2))
+	require.NotNil(t, err)
+}
+
+// newBlockWithTxs returns the second block of the omniledger skipchain scID,
+// with the transactions in its body. If txHash is nil, the header holds the
+// correct hash of the transactions.
+func newBlockWithTxs(t *testing.T, scID skipchain.SkipBlockID, roster *onet.Roster, txs ClientTransactions,
+	txHash []byte) *skipchain.SkipBlock {
+	if txHash == nil {
+		txHash = txs.Hash()
+	}
+	var err error
+	sb := skipchain.NewSkipBlock()
+	sb.Index = 1
+	sb.GenesisID = scID
+	sb.VerifierIDs = []skipchain.VerifierID{skipchain.VerifyBase, verifyOmniLedger}
+	sb.Roster = roster
+	sb.Data, err = network.Marshal(&DataHeader{ClientTransactionHash: txHash})
+	require.Nil(t, err)
+	sb.Payload, err = network.Marshal(&DataBody{Transactions: txs})
+	require.Nil(t, err)
+	return sb
+}
+
+// cosiSign returns the collective signature of msg by the nodes with the
+// indexes in signers.
+func cosiSign(t *testing.T, privates []kyber.Scalar, publics []kyber.Point, signers []int, msg []byte) []byte {
+	suite := cothority.Suite
+	mask, err := cosi.NewMask(suite, publics, nil)
+	require.Nil(t, err)
+	secrets := make([]kyber.Scalar, len(signers))
+	commitment := suite.Point().Null()
+	for j, i := range signers {
+		var c kyber.Point
+		secrets[j], c = cosi.Commit(suite)
+		commitment.Add(commitment, c)
+		require.Nil(t, mask.SetBit(i, true))
+	}
+	challenge, err := cosi.Challenge(suite, commitment, mask.AggregatePublic, msg)
+	require.Nil(t, err)
+	response := suite.Scalar().Zero()
+	for j, i := range signers {
+		r, err := cosi.Response(suite, privates[i], secrets[j], challenge)
+		require.Nil(t, err)
+		response.Add(response, r)
+	}
+	sig, err := cosi.Sign(suite, commitment, response, mask)
+	require.Nil(t, err)
+	return sig
+}
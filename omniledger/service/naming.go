@@ -0,0 +1,96 @@
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/onet/log"
+)
+
+// The naming contract gives human readable names to instances. A name
+// belongs to a darc, which decides who can add or remove names with its
+// "spawn:naming" and "Delete" rules. Every name is stored in its own
+// instance under NamingKey, so a name can only exist once per darc and the
+// clients can get a proof for it.
+
+// ContractNamingID denotes a naming-contract
+var ContractNamingID = "naming"
+
+// NamingKey returns the key of the instance holding the name of the darc
+// darcID.
+func NamingKey(darcID darc.ID, name string) InstanceID {
+	h := sha256.New()
+	h.Write([]byte(ContractNamingID))
+	h.Write([]byte(name))
+	return InstanceID{DarcID: darcID, SubID: NewSubID(h.Sum(nil))}
+}
+
+// contractNaming accepts the following instructions:
+//   - Spawn - sent to a darc, stores the name in the argument "name" for the
+//     existing instance in the argument "instanceID"
+//   - Delete - removes the name
+var contractNaming = BasicContract{
+	SpawnFn:  namingSpawn,
+	DeleteFn: namingDelete,
+}
+
+func namingSpawn(coll CollectionView, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	name := string(inst.Spawn.Args.Search("name"))
+	if name == "" {
+		return nil, nil, errors.New("argument \"name\" is missing")
+	}
+	idBuf := inst.Spawn.Args.Search("instanceID")
+	if len(idBuf) != 64 {
+		return nil, nil, errors.New("argument \"instanceID\" must be 64 bytes")
+	}
+	if _, _, err := coll.GetValues(idBuf); err != nil {
+		return nil, nil, errors.New("couldn't find instance to name: " + err.Error())
+	}
+	key := NamingKey(inst.InstanceID.DarcID, name)
+	if _, _, err := coll.GetValues(key.Slice()); err == nil {
+		return nil, nil, fmt.Errorf("name %s is already taken", name)
+	}
+	return []StateChange{
+		NewStateChange(Create, key, ContractNamingID, idBuf),
+	}, coins, nil
+}
+
+func namingDelete(coll CollectionView, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	return []StateChange{
+		NewStateChange(Remove, inst.InstanceID, ContractNamingID, nil),
+	}, coins, nil
+}
+
+// resolveName returns the instance with the name of the darc darcID.
+func resolveName(coll CollectionView, darcID darc.ID, name string) (InstanceID, error) {
+	value, contractID, err := coll.GetValues(NamingKey(darcID, name).Slice())
+	if err != nil {
+		return InstanceID{}, fmt.Errorf("unknown name %s: %v", name, err)
+	}
+	if contractID != ContractNamingID || len(value) != 64 {
+		return InstanceID{}, errors.New("invalid name record")
+	}
+	return NewInstanceID(value), nil
+}
+
+// ResolveName returns the instance that has been given the name in the
+// request. The client can verify it with a proof of NamingKey.
+func (s *Service) ResolveName(req *ResolveName) (*ResolveNameResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if s.state.getLast(req.SkipchainID) == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+	log.Lvlf2("%s: Resolving name %s of darc %x", s.ServerIdentity(), req.Name, req.DarcID)
+	id, err := resolveName(s.GetCollectionView(req.SkipchainID), req.DarcID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &ResolveNameResponse{
+		Version:    CurrentVersion,
+		InstanceID: id,
+	}, nil
+}
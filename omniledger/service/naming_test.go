@@ -0,0 +1,70 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/onet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNaming(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	hosts, _, _ := local.GenTree(1, false)
+	s := local.GetServices(hosts, OmniledgerID)[0].(*Service)
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+	apply := func(scs StateChanges) {
+		for _, sc := range scs {
+			require.Nil(t, storeInColl(coll.c, &sc))
+		}
+	}
+
+	darcID := make([]byte, 32)
+	target := InstanceID{DarcID: darcID, SubID: genSubID()}
+	apply(StateChanges{NewStateChange(Create, target, dummyKind, []byte("value"))})
+
+	spawn := func(name string, id InstanceID) Instruction {
+		return Instruction{
+			InstanceID: InstanceID{DarcID: darcID},
+			Spawn: &Spawn{
+				ContractID: ContractNamingID,
+				Args: Arguments{
+					{Name: "name", Value: []byte(name)},
+					{Name: "instanceID", Value: id.Slice()},
+				},
+			},
+		}
+	}
+	scs, _, err := s.executeInstruction(coll, nil, spawn("accounts/alice", target))
+	require.Nil(t, err)
+	apply(scs)
+	id, err := resolveName(coll, darcID, "accounts/alice")
+	require.Nil(t, err)
+	require.True(t, id.Equal(target))
+
+	// Names are unique, must be given and must point to an instance.
+	_, _, err = s.executeInstruction(coll, nil, spawn("accounts/alice", target))
+	require.NotNil(t, err)
+	_, _, err = s.executeInstruction(coll, nil, spawn("", target))
+	require.NotNil(t, err)
+	_, _, err = s.executeInstruction(coll, nil, spawn("accounts/bob",
+		InstanceID{DarcID: darcID, SubID: genSubID()}))
+	require.NotNil(t, err)
+
+	// Names belong to a darc.
+	otherDarc := make([]byte, 32)
+	otherDarc[0] = 1
+	_, err = resolveName(coll, otherDarc, "accounts/alice")
+	require.NotNil(t, err)
+
+	del := Instruction{
+		InstanceID: NamingKey(darcID, "accounts/alice"),
+		Delete:     &Delete{},
+	}
+	scs, _, err = s.executeInstruction(coll, nil, del)
+	require.Nil(t, err)
+	apply(scs)
+	_, err = resolveName(coll, darcID, "accounts/alice")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// maxBacklog is the maximum number of transactions a leader keeps for its
+// next blocks. The transactions beyond it are dropped, so an overloaded
+// leader doesn't run out of memory.
+const maxBacklog = 10000
+
+// overloadedMsg starts the error returned for the transactions that are
+// refused because the leader is overloaded. It is followed by the duration
+// after which the client should try again.
+const overloadedMsg = "leader overloaded, retry after "
+
+// RetryAfter returns how long to wait before sending a transaction again,
+// if err says that the leader is overloaded.
+func RetryAfter(err error) (time.Duration, bool) {
+	if err == nil {
+		return 0, false
+	}
+	msg := err.Error()
+	i := strings.Index(msg, overloadedMsg)
+	if i < 0 {
+		return 0, false
+	}
+	msg = msg[i+len(overloadedMsg):]
+	if end := strings.IndexAny(msg, " \n"); end >= 0 {
+		msg = msg[:end]
+	}
+	d, err := time.ParseDuration(msg)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
+
+// checkOverload refuses a new transaction for the skipchain scID if its
+// latest block says that the leader has more transactions left than fit in
+// the next block. The error tells the client how many block intervals it
+// takes to process them.
+func (s *Service) checkOverload(scID skipchain.SkipBlockID) error {
+	sb, err := s.db().GetLatestByID(scID)
+	if err != nil {
+		return err
+	}
+	_, headerI, err := network.Unmarshal(sb.Data, cothority.Suite)
+	header, ok := headerI.(*DataHeader)
+	if err != nil || !ok {
+		return errors.New("couldn't unmarshal header")
+	}
+	if header.Backlog == 0 {
+		return nil
+	}
+	body, err := decodeBody(sb)
+	if err != nil {
+		return err
+	}
+	perBlock := len(body.Transactions)
+	if perBlock == 0 {
+		perBlock = 1
+	}
+	blocks := (header.Backlog + perBlock - 1) / perBlock
+	if blocks <= 1 {
+		return nil
+	}
+	interval, err := s.LoadBlockInterval(scID)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%s%v", overloadedMsg, time.Duration(blocks)*interval)
+}
+
+// EnableOverloadHandOff makes a leader give up its leadership of a
+// skipchain after the given number of blocks in a row that couldn't hold
+// all the transactions. The leader stops collecting transactions, so the
+// next node of the roster takes over with a view-change once the
+// heartbeats time out. It only works if the view-change is enabled.
+func (s *Service) EnableOverloadHandOff(blocks int) {
+	s.overloadHandOff = blocks
+}
+
+// handOff stops the polling of an overloaded leader. The transactions that
+// are not in a block yet are put back in the buffer, where the new leader
+// collects them.
+func (s *Service) handOff(scID skipchain.SkipBlockID, closeSignal chan bool, txs ClientTransactions) {
+	log.Warn(s.txLog(scID).msgf("overloaded for %d blocks, handing off the leadership", s.overloadHandOff))
+	for _, ct := range txs {
+		s.txBuffer.add(string(scID), ct)
+	}
+	// The polling routine must not wait for pollChanMut, as TestClose
+	// holds it while waiting for the routine.
+	go func() {
+		s.pollChanMut.Lock()
+		if s.pollChan[string(scID)] == closeSignal {
+			delete(s.pollChan, string(scID))
+		}
+		s.pollChanMut.Unlock()
+	}()
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryAfter(t *testing.T) {
+	d, ok := RetryAfter(errors.New(overloadedMsg + "1.5s"))
+	require.True(t, ok)
+	require.Equal(t, 1500*time.Millisecond, d)
+	// The errors of the service are prefixed by onet.
+	d, ok = RetryAfter(errors.New("websocket error: " + overloadedMsg + "2s"))
+	require.True(t, ok)
+	require.Equal(t, 2*time.Second, d)
+	_, ok = RetryAfter(errors.New("version mismatch"))
+	require.False(t, ok)
+	_, ok = RetryAfter(nil)
+	require.False(t, ok)
+}
+
+func TestService_Overload(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	// A block that left five times its transactions for the next blocks.
+	tx1, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	_, err = s.service().createNewBlock(s.sb.SkipChainID(), s.sb.Roster, ClientTransactions{tx1}, nil, nil, 5, 0, 0)
+	require.Nil(t, err)
+
+	tx2, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, []byte("value2"), s.signer)
+	require.Nil(t, err)
+	for _, service := range s.services {
+		_, err = service.AddTransaction(&AddTxRequest{
+			Version:     CurrentVersion,
+			SkipchainID: s.sb.SkipChainID(),
+			Transaction: tx2,
+		})
+		d, ok := RetryAfter(err)
+		require.True(t, ok)
+		require.Equal(t, 5*testInterval, d)
+	}
+
+	// A backlog that fits in the next block is accepted.
+	_, err = s.service().createNewBlock(s.sb.SkipChainID(), s.sb.Roster, ClientTransactions{tx2}, nil, nil, 1, 0, 0)
+	require.Nil(t, err)
+	tx3, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, []byte("value3"), s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx3)
+}
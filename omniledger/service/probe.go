@@ -0,0 +1,250 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/skipchain"
+	status "github.com/dedis/cothority/status/service"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// rosterProbes holds the responsiveness of the nodes of the rosters of the
+// skipchains that the conode leads.
+type rosterProbes struct {
+	sync.Mutex
+	// interval is the time between two probes, the probing is disabled
+	// while it is 0. A node that doesn't answer for longer than
+	// unreachable is proposed for exclusion.
+	interval    time.Duration
+	unreachable time.Duration
+	chains      map[string]map[network.ServerIdentityID]*nodeProbe
+}
+
+// nodeProbe is what the leader measured of a node.
+type nodeProbe struct {
+	first    time.Time
+	lastSeen time.Time
+	latency  time.Duration
+	warned   bool
+}
+
+func newRosterProbes() rosterProbes {
+	return rosterProbes{chains: make(map[string]map[network.ServerIdentityID]*nodeProbe)}
+}
+
+func (rp *rosterProbes) enabled() bool {
+	rp.Lock()
+	defer rp.Unlock()
+	return rp.interval > 0
+}
+
+// record stores the answer of the node si to a probe, and returns true if the
+// node just became unreachable.
+func (rp *rosterProbes) record(scID skipchain.SkipBlockID, si *network.ServerIdentity,
+	latency time.Duration, ok bool) bool {
+	rp.Lock()
+	defer rp.Unlock()
+	nodes := rp.chains[string(scID)]
+	if nodes == nil {
+		nodes = make(map[network.ServerIdentityID]*nodeProbe)
+		rp.chains[string(scID)] = nodes
+	}
+	now := time.Now()
+	np := nodes[si.ID]
+	if np == nil {
+		np = &nodeProbe{first: now}
+		nodes[si.ID] = np
+	}
+	if ok {
+		np.lastSeen = now
+		np.latency = latency
+		np.warned = false
+		return false
+	}
+	if np.warned || !np.unreachable(now, rp.unreachable) {
+		return false
+	}
+	np.warned = true
+	return true
+}
+
+// unreachable returns true if the node didn't answer for longer than d.
+func (np *nodeProbe) unreachable(now time.Time, d time.Duration) bool {
+	since := np.lastSeen
+	if since.IsZero() {
+		since = np.first
+	}
+	return now.Sub(since) > d
+}
+
+// health returns the responsiveness of the nodes of the roster, but the
+// leader, and forgets the nodes that are not in the roster anymore.
+func (rp *rosterProbes) health(scID skipchain.SkipBlockID, roster *onet.Roster) []NodeHealth {
+	rp.Lock()
+	defer rp.Unlock()
+	nodes := rp.chains[string(scID)]
+	now := time.Now()
+	kept := make(map[network.ServerIdentityID]*nodeProbe)
+	var health []NodeHealth
+	for _, si := range roster.List[1:] {
+		nh := NodeHealth{ServerIdentity: si}
+		if np := nodes[si.ID]; np != nil {
+			kept[si.ID] = np
+			nh.Latency = np.latency
+			if !np.lastSeen.IsZero() {
+				nh.LastSeen = np.lastSeen.UnixNano()
+			}
+			nh.Unreachable = np.unreachable(now, rp.unreachable)
+		}
+		health = append(health, nh)
+	}
+	rp.chains[string(scID)] = kept
+	return health
+}
+
+// EnableRosterProbing makes the conode ask the nodes of the rosters of the
+// skipchains it leads for their status, every interval. A node that doesn't
+// answer for longer than unreachable is reported by GetRosterHealth, with a
+// proposal to exclude it from the roster. The probing can't be turned off,
+// but calling it again changes the durations.
+func (s *Service) EnableRosterProbing(interval, unreachable time.Duration) {
+	s.probes.Lock()
+	running := s.probes.interval > 0
+	s.probes.interval = interval
+	s.probes.unreachable = unreachable
+	s.probes.Unlock()
+	if !running {
+		go s.probeRosters()
+	}
+}
+
+// probeRosters probes the rosters of the skipchains the conode leads until
+// the service shuts down.
+func (s *Service) probeRosters() {
+	for {
+		s.probes.Lock()
+		interval := s.probes.interval
+		s.probes.Unlock()
+		select {
+		case <-s.shutdown:
+			return
+		case <-time.After(interval):
+		}
+		for _, scID := range s.state.chains() {
+			sb, err := s.db().GetLatestByID(scID)
+			if err != nil || sb.Roster == nil || !sb.Roster.List[0].Equal(s.ServerIdentity()) {
+				continue
+			}
+			s.probeRoster(scID, sb.Roster)
+		}
+	}
+}
+
+// probeRoster asks all the nodes of the roster for their status at the same
+// time, and records their answers.
+func (s *Service) probeRoster(scID skipchain.SkipBlockID, roster *onet.Roster) {
+	var wg sync.WaitGroup
+	for _, si := range roster.List[1:] {
+		wg.Add(1)
+		go func(si *network.ServerIdentity) {
+			defer wg.Done()
+			start := time.Now()
+			_, err := status.NewClient().Request(si)
+			if s.probes.record(scID, si, time.Since(start), err == nil) {
+				log.Warn(s.txLog(scID).msgf("node %s is unreachable, it can be excluded with the proposal of GetRosterHealth", si))
+			}
+		}(si)
+	}
+	wg.Wait()
+}
+
+// GetRosterHealth returns the responsiveness of the nodes of the roster of a
+// skipchain, as measured by its leader, and an update_config transaction to
+// exclude the unreachable nodes.
+func (s *Service) GetRosterHealth(req *GetRosterHealth) (*GetRosterHealthResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if !s.probes.enabled() {
+		return nil, errors.New("the probing of the rosters is not enabled")
+	}
+	sb, err := s.db().GetLatestByID(req.SkipchainID)
+	if err != nil {
+		return nil, err
+	}
+	if sb.Roster == nil || !sb.Roster.List[0].Equal(s.ServerIdentity()) {
+		return nil, errors.New("only the leader probes the roster")
+	}
+	resp := &GetRosterHealthResponse{
+		Version: CurrentVersion,
+		Nodes:   s.probes.health(req.SkipchainID, sb.Roster),
+	}
+	var unreachable []*network.ServerIdentity
+	for _, nh := range resp.Nodes {
+		if nh.Unreachable {
+			unreachable = append(unreachable, nh.ServerIdentity)
+		}
+	}
+	if len(unreachable) > 0 {
+		resp.Proposal, err = s.exclusionProposal(req.SkipchainID, unreachable)
+		if err != nil {
+			log.Warn(s.txLog(req.SkipchainID).msg("couldn't propose to exclude the unreachable nodes:", err))
+		}
+	}
+	return resp, nil
+}
+
+// exclusionProposal returns an unsigned update_config transaction that
+// removes the nodes from the roster of the skipchain.
+func (s *Service) exclusionProposal(scID skipchain.SkipBlockID, nodes []*network.ServerIdentity) (*ClientTransaction, error) {
+	config, err := s.LoadConfig(scID)
+	if err != nil {
+		return nil, err
+	}
+	var list []*network.ServerIdentity
+	for _, si := range config.Roster.List {
+		excluded := false
+		for _, n := range nodes {
+			if si.Equal(n) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			list = append(list, si)
+		}
+	}
+	newRoster := onet.NewRoster(list)
+	if newRoster == nil {
+		return nil, errors.New("no node left in the roster")
+	}
+	if err := validRosterChange(config.Roster, *newRoster); err != nil {
+		return nil, err
+	}
+	config.Roster = *newRoster
+	configBuf, err := protobuf.Encode(config)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.LoadGenesisDarc(scID)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientTransaction{
+		Instructions: []Instruction{{
+			InstanceID: InstanceID{DarcID: d.GetBaseID(), SubID: oneSubID},
+			Nonce:      GenNonce(),
+			Index:      0,
+			Length:     1,
+			Invoke: &Invoke{
+				Command: "update_config",
+				Args:    []Argument{{Name: "config", Value: configBuf}},
+			},
+		}},
+	}, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_RosterHealth(t *testing.T) {
+	s := newSerN(t, 1, testInterval, 4, false)
+	defer s.local.CloseAll()
+	req := &GetRosterHealth{Version: CurrentVersion, SkipchainID: s.sb.SkipChainID()}
+
+	_, err := s.service().GetRosterHealth(req)
+	require.NotNil(t, err)
+	s.service().EnableRosterProbing(s.interval, 4*s.interval)
+	_, err = s.services[1].GetRosterHealth(req)
+	require.NotNil(t, err)
+
+	time.Sleep(2 * s.interval)
+	resp, err := s.service().GetRosterHealth(req)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(resp.Nodes))
+	for _, nh := range resp.Nodes {
+		require.False(t, nh.Unreachable)
+		require.NotEqual(t, int64(0), nh.LastSeen)
+	}
+	require.Nil(t, resp.Proposal)
+
+	// A node that doesn't answer anymore is proposed for exclusion.
+	s.hosts[3].Pause()
+	time.Sleep(8 * s.interval)
+	resp, err = s.service().GetRosterHealth(req)
+	require.Nil(t, err)
+	require.False(t, resp.Nodes[0].Unreachable)
+	require.True(t, resp.Nodes[2].Unreachable)
+	require.NotNil(t, resp.Proposal)
+
+	var config ChainConfig
+	instr := resp.Proposal.Instructions[0]
+	require.Nil(t, protobuf.DecodeWithConstructors(instr.Invoke.Args.Search("config"), &config,
+		network.DefaultConstructors(cothority.Suite)))
+	require.Equal(t, 3, len(config.Roster.List))
+	i, _ := config.Roster.Search(s.hosts[3].ServerIdentity.ID)
+	require.Equal(t, -1, i)
+
+	// The proposal needs the signature of the genesis darc.
+	require.Nil(t, resp.Proposal.Instructions[0].SignBy(s.signer))
+	s.sendTx(t, *resp.Proposal)
+	for i := 0; i < 10; i++ {
+		time.Sleep(s.interval)
+		c, err := s.service().LoadConfig(s.sb.SkipChainID())
+		require.Nil(t, err)
+		if len(c.Roster.List) == 3 {
+			return
+		}
+	}
+	require.Fail(t, "the node hasn't been excluded")
+}
@@ -2,17 +2,23 @@ package service
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/cothority/omniledger/darc"
 	"github.com/dedis/cothority/skipchain"
-	"github.com/dedis/kyber"
+	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
 )
 
 // NewProof creates a proof for key in the skipchain with the given id. It uses
-// the collectionDB to look up the key and the skipblockdb to create the correct
-// proof for the forward links.
+// the collectionDB to look up the key and the skipblockdb to create the proof
+// from the genesis block to the latest block.
 func NewProof(c *collectionDB, s *skipchain.SkipBlockDB, id skipchain.SkipBlockID,
 	key []byte) (p *Proof, err error) {
 	p = &Proof{}
@@ -20,25 +26,16 @@ func NewProof(c *collectionDB, s *skipchain.SkipBlockDB, id skipchain.SkipBlockI
 	if err != nil {
 		return
 	}
-	sb := s.GetByID(id)
+	chain, err := s.GetProof(id)
+	if err != nil {
+		return nil, err
+	}
+	p.Chain = *chain
+	sb := s.GetByID(chain.Latest().Hash)
 	if sb == nil {
-		return nil, errors.New("didn't find skipchain")
-	}
-	p.Links = []skipchain.ForwardLink{{
-		From:      []byte{},
-		To:        id,
-		NewRoster: sb.Roster,
-	}}
-	for len(sb.ForwardLink) > 0 {
-		link := sb.ForwardLink[len(sb.ForwardLink)-1]
-		p.Links = append(p.Links, *link)
-		sb = s.GetByID(link.To)
-		if sb == nil {
-			return nil, errors.New("missing block in chain")
-		}
+		return nil, errors.New("missing block in chain")
 	}
 	p.Latest = *sb
-	// p.ProofBytes = p.proof.Consistent()
 	return
 }
 
@@ -58,37 +55,47 @@ var ErrorVerifySkipchain = errors.New("stored skipblock is not properly evolved
 // It verifies the collection-proof, that the merkle-root is stored in the skipblock
 // of the proof and the fact that the skipblock is indeed part of the skipchain.
 // If all verifications are correct, the error will be nil.
+//
+// A redacted proof shows that the leaf with the key is in the collection,
+// but not its values. Its label is verified with the hash of the values.
 func (p Proof) Verify(scID skipchain.SkipBlockID) error {
-	if !p.InclusionProof.Consistent() {
+	if err := p.VerifyInclusion(); err != nil {
+		return err
+	}
+	if !p.Chain.GenesisID.Equal(scID) {
+		return ErrorVerifySkipchain
+	}
+	if err := p.Chain.Verify(); err != nil {
+		return ErrorVerifySkipchain
+	}
+	latest := p.Chain.Latest()
+	if !p.Latest.Hash.Equal(latest.Hash) || !p.Latest.CalculateHash().Equal(latest.Hash) {
+		return ErrorVerifySkipchain
+	}
+	return nil
+}
+
+// VerifyInclusion only verifies the collection-proof and that its root is
+// stored in the Latest skipblock. It is for clients that already verified
+// that Latest is part of the skipchain, Verify checks both.
+func (p Proof) VerifyInclusion() error {
+	if p.Redacted {
+		if !p.InclusionProof.ConsistentRedacted() {
+			return ErrorVerifyCollection
+		}
+	} else if !p.InclusionProof.Consistent() {
 		return ErrorVerifyCollection
 	}
 	_, d, err := network.Unmarshal(p.Latest.Data, cothority.Suite)
 	if err != nil {
 		return err
 	}
-	if !bytes.Equal(p.InclusionProof.TreeRootHash(), d.(*DataHeader).CollectionRoot) {
-		return ErrorVerifyCollectionRoot
+	header, ok := d.(*DataHeader)
+	if !ok {
+		return errors.New("couldn't unmarshal header")
 	}
-	var sbID skipchain.SkipBlockID
-	var publics []kyber.Point
-	for i, l := range p.Links {
-		if i == 0 {
-			// The first forward link is a pointer from []byte{} to the genesis
-			// block and holds the roster of the genesis block.
-			sbID = scID
-			publics = l.NewRoster.Publics()
-			continue
-		}
-		if err = l.Verify(cothority.Suite, publics); err != nil {
-			return ErrorVerifySkipchain
-		}
-		if !l.From.Equal(sbID) {
-			return ErrorVerifySkipchain
-		}
-		sbID = l.To
-		if l.NewRoster != nil {
-			publics = l.NewRoster.Publics()
-		}
+	if !bytes.Equal(p.InclusionProof.TreeRootHash(), header.CollectionRoot) {
+		return ErrorVerifyCollectionRoot
 	}
 	return nil
 }
@@ -99,3 +106,145 @@ func (p Proof) KeyValue() (key []byte, values [][]byte, err error) {
 	values, err = p.InclusionProof.RawValues()
 	return
 }
+
+// ReadRule is the rule of a darc that protects the values of its instances.
+// If it is present, GetProof only returns the values of the instances if the
+// signatures of the request satisfy it.
+var ReadRule = darc.Action("read")
+
+// hashedValuesVersion is the ServiceVersion from which the labels of the
+// leaves of the collection commit to the hash of their values, so that the
+// proofs of protected instances can be redacted.
+const hashedValuesVersion = 4
+
+// hashValuesIfActive switches coll to hashed values once its configuration
+// activated hashedValuesVersion. It is called after every block, so that all
+// the nodes switch in the same block.
+func hashValuesIfActive(coll *collection.Collection) error {
+	if coll.HashesValues() {
+		return nil
+	}
+	config, err := LoadConfigFromColl(&roCollection{coll})
+	if err != nil || config.MinServiceVersion < hashedValuesVersion {
+		return nil
+	}
+	return coll.HashValues()
+}
+
+// getProofValidity is how long the signatures of a GetProof request created
+// by GetProofSigned are valid. The nodes refuse the requests that are valid
+// for longer.
+const getProofValidity = time.Minute
+
+// GetProofMsg returns the message that is signed to read the key in the
+// skipchain with the given id, until the time expires in unix nanoseconds.
+func GetProofMsg(id skipchain.SkipBlockID, key []byte, expires int64) []byte {
+	h := sha256.New()
+	h.Write(id)
+	h.Write(key)
+	binary.Write(h, binary.LittleEndian, expires)
+	return h.Sum(nil)
+}
+
+// redactProof removes the values of the instances in the proof whose darc
+// has a ReadRule that is not satisfied by the signatures of the request. The
+// neighbours of the key are redacted, too. The signatures are refused once
+// the request expired, so that they can't be replayed later.
+func (s *Service) redactProof(coll CollectionView, req *GetProof, p *Proof) error {
+	if len(req.Signatures) > 0 {
+		now := time.Now()
+		if req.Expires < now.UnixNano() {
+			return errors.New("the signatures of the request expired")
+		}
+		if req.Expires > now.Add(getProofValidity).UnixNano() {
+			return fmt.Errorf("the signatures of the request must expire within %v", getProofValidity)
+		}
+	}
+	msg := GetProofMsg(req.ID, req.Key, req.Expires)
+	var ids []string
+	for _, sig := range req.Signatures {
+		if err := sig.Signer.Verify(msg, sig.Signature); err != nil {
+			return errors.New("invalid signature: " + err.Error())
+		}
+		ids = append(ids, sig.Signer.String())
+	}
+	var err error
+	p.Redacted, err = p.InclusionProof.Redact(func(key []byte) bool {
+		return !s.canRead(coll, key, ids)
+	})
+	return err
+}
+
+// maxUpdateKeys is the maximum number of keys of a GetUpdates request.
+const maxUpdateKeys = 1000
+
+// GetUpdates returns the blocks added after req.LatestID and the proofs of
+// req.Keys in the collection of the latest block. As no signatures are given,
+// the instances protected by a ReadRule are redacted.
+func (s *Service) GetUpdates(req *GetUpdates) (*GetUpdatesResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if s.state.getLast(req.SkipchainID) == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+	if err := s.checkEnabled(req.SkipchainID); err != nil {
+		return nil, err
+	}
+	if len(req.Keys) > maxUpdateKeys {
+		return nil, errors.New("too many keys")
+	}
+	from := s.db().GetByID(req.LatestID)
+	if from == nil || !from.SkipChainID().Equal(req.SkipchainID) {
+		return nil, errors.New("unknown block")
+	}
+	log.Lvlf2("%s: Getting updates of %x after block %d", s.ServerIdentity(), req.SkipchainID, from.Index)
+	cdb := s.getCollection(req.SkipchainID)
+	coll := &roCollection{cdb.coll}
+	resp := &GetUpdatesResponse{
+		Version: CurrentVersion,
+		Proofs:  make([]KeyProof, len(req.Keys)),
+	}
+	for i, key := range req.Keys {
+		p, err := cdb.coll.Get(key).Proof()
+		if err != nil {
+			return nil, err
+		}
+		resp.Proofs[i].Redacted, err = p.Redact(func(k []byte) bool {
+			return !s.canRead(coll, k, nil)
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.Proofs[i].InclusionProof = p
+	}
+	chain, err := s.db().GetProofFrom(from.Hash)
+	if err != nil {
+		return nil, err
+	}
+	sb := s.db().GetByID(chain.Latest().Hash)
+	if sb == nil {
+		return nil, errors.New("missing block in chain")
+	}
+	resp.Chain = *chain
+	resp.Latest = *sb
+	return resp, nil
+}
+
+// canRead returns true if the instance key has no read policy, or if the
+// identities ids satisfy it.
+func (s *Service) canRead(coll CollectionView, key []byte, ids []string) bool {
+	if len(key) != 64 {
+		return true
+	}
+	d, err := LoadDarcFromColl(coll, InstanceID{NewInstanceID(key).DarcID, SubID{}}.Slice())
+	if err != nil {
+		// Instances without a darc can't have a read policy.
+		return true
+	}
+	expr, ok := d.Rules[ReadRule]
+	if !ok {
+		return true
+	}
+	return darc.EvalExpr(expr, s.darcGetter(coll), ids...) == nil
+}
@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/byzcoinx"
+	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
 	"github.com/dedis/cothority/skipchain"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/sign/cosi"
@@ -43,6 +47,16 @@ func TestVerify(t *testing.T) {
 
 	require.Equal(t, ErrorVerifySkipchain, p.Verify(s.genesis2.SkipChainID()))
 
+	// The latest block must be the one at the end of the chain proof.
+	wrong := *p
+	wrong.Latest = *s.sb2.Copy()
+	wrong.Latest.Index = 2
+	require.Equal(t, ErrorVerifySkipchain, wrong.Verify(s.genesis.SkipChainID()))
+	wrong = *p
+	wrong.Chain.Links = nil
+	wrong.Chain.Blocks = wrong.Chain.Blocks[1:]
+	require.Equal(t, ErrorVerifySkipchain, wrong.Verify(s.genesis.SkipChainID()))
+
 	p.Latest.Data, err = network.Marshal(&DataHeader{
 		CollectionRoot: getSBID("123"),
 	})
@@ -50,6 +64,110 @@ func TestVerify(t *testing.T) {
 	require.Equal(t, ErrorVerifyCollectionRoot, p.Verify(s.genesis.SkipChainID()))
 }
 
+func TestRedactProof(t *testing.T) {
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+	reader := darc.NewSignerEd25519(nil, nil)
+	other := darc.NewSignerEd25519(nil, nil)
+	d := darc.NewDarc(darc.InitRules([]darc.Identity{other.Identity()}, []darc.Identity{other.Identity()}),
+		[]byte("protected"))
+	require.Nil(t, d.Rules.AddRule(ReadRule, expression.InitOrExpr(reader.Identity().String())))
+	dBuf, err := d.ToProto()
+	require.Nil(t, err)
+	id := InstanceID{d.GetBaseID(), genSubID()}
+	for _, sc := range []StateChange{
+		NewStateChange(Create, InstanceID{d.GetBaseID(), SubID{}}, ContractDarcID, dBuf),
+		NewStateChange(Create, id, dummyKind, []byte("secret")),
+	} {
+		require.Nil(t, storeInColl(coll.c, &sc))
+	}
+
+	s := &Service{}
+	expires := time.Now().Add(getProofValidity).UnixNano()
+	getProofExpires := func(expires int64, signers ...darc.Signer) (*Proof, error) {
+		req := &GetProof{Version: CurrentVersion, Key: id.Slice(), ID: getSBID("chain"), Expires: expires}
+		for _, signer := range signers {
+			sig, err := signer.Sign(GetProofMsg(req.ID, req.Key, req.Expires))
+			require.Nil(t, err)
+			req.Signatures = append(req.Signatures, darc.Signature{Signature: sig, Signer: signer.Identity()})
+		}
+		p := &Proof{}
+		p.InclusionProof, err = coll.c.Get(req.Key).Proof()
+		require.Nil(t, err)
+		return p, s.redactProof(coll, req, p)
+	}
+	getProof := func(signers ...darc.Signer) (*Proof, error) {
+		return getProofExpires(expires, signers...)
+	}
+
+	// Without hashed values, the proof can't be redacted.
+	_, err = getProof()
+	require.NotNil(t, err)
+	require.Nil(t, coll.c.HashValues())
+
+	p, err := getProof()
+	require.Nil(t, err)
+	require.True(t, p.Redacted)
+	require.True(t, p.InclusionProof.Match())
+	require.False(t, p.InclusionProof.Consistent())
+	require.True(t, p.InclusionProof.ConsistentRedacted())
+	_, values, err := p.KeyValue()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(values))
+
+	p, err = getProof(other)
+	require.Nil(t, err)
+	require.True(t, p.Redacted)
+
+	p, err = getProof(reader)
+	require.Nil(t, err)
+	require.False(t, p.Redacted)
+	_, values, err = p.KeyValue()
+	require.Nil(t, err)
+	require.Equal(t, []byte("secret"), values[0])
+
+	// A signature on another key is refused.
+	req := &GetProof{Version: CurrentVersion, Key: id.Slice(), ID: getSBID("chain"), Expires: expires}
+	sig, err := reader.Sign(GetProofMsg(req.ID, []byte("other key"), req.Expires))
+	require.Nil(t, err)
+	req.Signatures = []darc.Signature{{Signature: sig, Signer: reader.Identity()}}
+	require.NotNil(t, s.redactProof(coll, req, p))
+
+	// The signatures can't be replayed once they expired, and they can't
+	// be valid for too long.
+	_, err = getProofExpires(time.Now().Add(-time.Second).UnixNano(), reader)
+	require.NotNil(t, err)
+	_, err = getProofExpires(time.Now().Add(2*getProofValidity).UnixNano(), reader)
+	require.NotNil(t, err)
+}
+
+func TestService_HashedValues(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+	require.False(t, s.service().getCollection(scID).coll.HashesValues())
+
+	config, err := s.service().LoadConfig(scID)
+	require.Nil(t, err)
+	config.MinServiceVersion = hashedValuesVersion
+	s.sendTx(t, configTx(t, s, *config))
+	for i := 0; i < 10; i++ {
+		if v, _ := s.service().ActiveServiceVersion(scID); v == hashedValuesVersion {
+			break
+		}
+		time.Sleep(s.interval)
+	}
+
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx)
+	for i, service := range s.services {
+		p := s.waitProofWithIdx(t, tx.Instructions[0].InstanceID, i)
+		require.True(t, service.getCollection(scID).coll.HashesValues())
+		require.True(t, p.InclusionProof.Consistent())
+		require.Nil(t, p.Verify(scID))
+	}
+}
+
 type sc struct {
 	c            *collectionDB          // a usable collectionDB to store key/value pairs
 	s            *skipchain.SkipBlockDB // a usable skipchain DB to store blocks
@@ -98,6 +216,8 @@ func createSC(t *testing.T) (s sc) {
 	s.genesis.Hash = s.genesis.CalculateHash()
 
 	s.sb2 = skipchain.NewSkipBlock()
+	s.sb2.Index = 1
+	s.sb2.GenesisID = s.genesis.Hash
 	s.sb2.Roster, _ = genRoster(2)
 	s.sb2.Data, err = network.Marshal(&DataHeader{
 		CollectionRoot: s.c.RootHash(),
@@ -171,3 +291,39 @@ func overwriteSB(t *testing.T, s sc, sb *skipchain.SkipBlock) {
 	})
 	require.Nil(t, err)
 }
+
+func TestService_GetUpdates(t *testing.T) {
+	s := newSer(t, 2, testInterval)
+	defer s.local.CloseAll()
+
+	id := s.tx.Instructions[0].InstanceID
+	s.waitProof(t, id)
+
+	req := &GetUpdates{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		LatestID:    s.sb.Hash,
+		Keys:        [][]byte{id.Slice(), GenesisReferenceID.Slice()},
+	}
+	resp, err := s.service().GetUpdates(req)
+	require.Nil(t, err)
+	require.Nil(t, resp.Chain.VerifyFrom(s.sb))
+	require.True(t, resp.Chain.Latest().Hash.Equal(resp.Latest.Hash))
+	require.Equal(t, 2, len(resp.Proofs))
+	for i, kp := range resp.Proofs {
+		p := Proof{InclusionProof: kp.InclusionProof, Latest: resp.Latest}
+		require.Nil(t, p.VerifyInclusion())
+		require.True(t, p.InclusionProof.Match())
+		require.Equal(t, req.Keys[i], p.InclusionProof.Key)
+	}
+
+	// From the latest block, only that block is returned.
+	req.LatestID = resp.Latest.Hash
+	resp, err = s.service().GetUpdates(req)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(resp.Chain.Blocks))
+
+	req.LatestID = []byte("unknown")
+	_, err = s.service().GetUpdates(req)
+	require.NotNil(t, err)
+}
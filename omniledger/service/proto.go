@@ -6,7 +6,9 @@ import (
 	"github.com/dedis/cothority/omniledger/collection"
 	"github.com/dedis/cothority/omniledger/darc"
 	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
 	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
 )
 
 // PROTOSTART
@@ -34,14 +36,34 @@ type DataHeader struct {
 	// StateChangesHash is the sha256 of all the stateChanges occuring through the
 	// clientTransactions.
 	StateChangesHash []byte
-	// Timestamp is a unix timestamp in nanoseconds.
+	// Timestamp is a unix timestamp in seconds. Use UnixNano to get the
+	// time of the block.
 	Timestamp int64
+	// EncryptedHash is the sha256 hash of the encrypted transactions and the
+	// decryptions in the body.
+	EncryptedHash []byte `protobuf:"opt"`
+	// Backlog is the number of transactions the leader had to leave for
+	// the next blocks because they didn't fit in this one.
+	Backlog int `protobuf:"opt"`
+	// Versions are the ServiceVersion the nodes of the roster sent to the
+	// leader for this block, in the order of the roster. Zero means that
+	// the node didn't answer.
+	Versions []int `protobuf:"opt"`
+	// TimestampNano is the same time as Timestamp, in nanoseconds. It is
+	// zero in the blocks created before it was added.
+	TimestampNano int64 `protobuf:"opt"`
 }
 
 // DataBody is stored in the body of the skipblock but is not hashed. This reduces
 // the proof needed for a key/value pair.
 type DataBody struct {
 	Transactions ClientTransactions
+	// EncryptedTransactions are ordered in this block, and decrypted and
+	// executed in the next block.
+	EncryptedTransactions []EncryptedTransaction `protobuf:"opt"`
+	// Decryptions hold the decryption shares of the encrypted transactions
+	// of the previous block, in the same order.
+	Decryptions []TxDecryption `protobuf:"opt"`
 }
 
 // ***
@@ -58,6 +80,11 @@ type CreateGenesisBlock struct {
 	GenesisDarc darc.Darc
 	// BlockInterval in int64.
 	BlockInterval time.Duration
+	// BaseHeight of the skipchain, if 0 the default of 10 is used. Higher
+	// values give shorter proofs, but each block has to be signed more often.
+	BaseHeight int
+	// MaximumHeight of the skipchain, if 0 the default of 10 is used.
+	MaximumHeight int
 }
 
 // CreateGenesisBlockResponse holds the genesis-block of the new skipchain.
@@ -87,6 +114,65 @@ type AddTxResponse struct {
 	Version Version
 }
 
+// CreateTxKey asks a node of the roster to create the key used to encrypt
+// transactions. If the key already exists, it is returned.
+type CreateTxKey struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+}
+
+// CreateTxKeyResponse holds the key used to encrypt transactions.
+type CreateTxKeyResponse struct {
+	// Version of the protocol
+	Version Version
+	// X is the shared public key of the roster.
+	X kyber.Point
+	// Key must be stored in the config with "invoke:update_config" before
+	// the leader accepts encrypted transactions.
+	Key TxKey
+}
+
+// AddEncryptedTxRequest asks the leader to order an encrypted transaction in
+// the next block. It is decrypted and executed in the block after.
+type AddEncryptedTxRequest struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// Transaction is created with EncryptTransaction.
+	Transaction EncryptedTransaction
+}
+
+// AddEncryptedTxResponse is the reply after an AddEncryptedTxRequest is
+// finished.
+type AddEncryptedTxResponse struct {
+	// Version of the protocol
+	Version Version
+}
+
+// GetRandomness asks a node of the roster to collect the shares of the
+// randomness of an instance. The contract of the instance decides when the
+// nodes give their shares.
+type GetRandomness struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// InstanceID is the instance the randomness is for.
+	InstanceID InstanceID
+}
+
+// GetRandomnessResponse holds a threshold of shares of the randomness, which
+// the contract verifies with Randomness.
+type GetRandomnessResponse struct {
+	// Version of the protocol
+	Version Version
+	// Shares of the randomness of the instance.
+	Shares TxDecryption
+}
+
 // GetProof returns the proof that the given key is in the collection.
 type GetProof struct {
 	// Version of the protocol
@@ -96,6 +182,12 @@ type GetProof struct {
 	// ID is any block that is known to us in the skipchain, can be the genesis
 	// block or any later block. The proof returned will be starting at this block.
 	ID skipchain.SkipBlockID
+	// Signatures on the message returned by GetProofMsg. They are only
+	// needed for instances whose darc has a ReadRule.
+	Signatures []darc.Signature
+	// Expires is the time in unix nanoseconds after which the signatures
+	// are refused.
+	Expires int64
 }
 
 // GetProofResponse can be used together with the Genesis block to proof that
@@ -108,12 +200,573 @@ type GetProofResponse struct {
 	Proof Proof
 }
 
+// GetUpdates asks for the blocks added after LatestID and the proofs of
+// Keys in the latest block, so that a client that already verified the chain
+// up to LatestID only needs to verify the new forward-links.
+type GetUpdates struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// LatestID is the latest block the client verified.
+	LatestID skipchain.SkipBlockID
+	// Keys whose proofs are returned.
+	Keys [][]byte
+}
+
+// GetUpdatesResponse holds the new part of the chain and the proofs of the
+// keys.
+type GetUpdatesResponse struct {
+	// Version of the protocol
+	Version Version
+	// Chain goes from the block LatestID to the latest block and must be
+	// verified with VerifyFrom. It only holds the block LatestID if no block
+	// has been added.
+	Chain skipchain.ChainProof
+	// Latest is the latest block, which holds the root of the proofs.
+	Latest skipchain.SkipBlock
+	// Proofs of the keys, in the order of the request.
+	Proofs []KeyProof
+}
+
+// KeyProof is the proof of a key in the collection of a block that is not
+// part of the KeyProof.
+type KeyProof struct {
+	// InclusionProof proofs the presence or absence of the key.
+	InclusionProof collection.Proof
+	// Redacted is true if the values of some instances have been removed
+	// because of their ReadRule.
+	Redacted bool
+}
+
+// CallView asks for the result of a view of a contract on an instance. A
+// view is a read-only function registered with RegisterView.
+type CallView struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// InstanceID is the instance the view is called on.
+	InstanceID InstanceID
+	// View is the name of the view in the contract of the instance.
+	View string
+	// Args are given to the view.
+	Args Arguments
+}
+
+// CallViewResponse holds the result of a view.
+type CallViewResponse struct {
+	// Version of the protocol
+	Version Version
+	// Result is the value returned by the view.
+	Result []byte
+	// BlockID is the latest block included in the collection the view has
+	// been computed against.
+	BlockID skipchain.SkipBlockID
+}
+
+// GetContractRegistry asks a node for its registered contracts.
+type GetContractRegistry struct {
+	// Version of the protocol
+	Version Version
+}
+
+// GetContractRegistryResponse holds the contracts registered on the node.
+type GetContractRegistryResponse struct {
+	// Version of the protocol
+	Version Version
+	// Contracts sorted by their ID.
+	Contracts []ContractInfo
+}
+
+// ContractInfo describes a registered contract.
+type ContractInfo struct {
+	// ContractID of the contract.
+	ContractID string
+	// Versions that are registered, in increasing order.
+	Versions []uint32
+}
+
+// ResolveName asks for the instance that has been given a name with the
+// naming contract.
+type ResolveName struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// DarcID is the darc the name belongs to.
+	DarcID darc.ID
+	// Name of the instance.
+	Name string
+}
+
+// ResolveNameResponse holds the instance of the name.
+type ResolveNameResponse struct {
+	// Version of the protocol
+	Version Version
+	// InstanceID of the name.
+	InstanceID InstanceID
+}
+
+// SearchEvents asks for the events emitted in a range of blocks. All given
+// search parameters must match. The blocks are given by their index.
+type SearchEvents struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// ContractID of the events, "" means any contract.
+	ContractID string
+	// Topic of the events, "" means any topic.
+	Topic string
+	// From is the index of the first block searched.
+	From int
+	// To is the index of the last block searched, 0 means until the latest
+	// block.
+	To int
+}
+
+// SearchEventsResponse holds the events found, in the order they have been
+// emitted.
+type SearchEventsResponse struct {
+	// Version of the protocol
+	Version Version
+	// Events that matched the search.
+	Events []BlockEvent
+	// Truncated is true if not all events could be returned. The caller
+	// should continue the search with From set to the index of the block of
+	// the last event plus one.
+	Truncated bool
+}
+
+// ListBlocks asks for the summaries of the latest blocks, for explorers.
+type ListBlocks struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// Before is the index of the block following the first block returned, 0
+	// means to start with the latest block.
+	Before int
+	// Count is the maximum number of blocks returned.
+	Count int
+}
+
+// ListBlocksResponse holds the summaries of the blocks, starting with the
+// newest one.
+type ListBlocksResponse struct {
+	// Version of the protocol
+	Version Version
+	// Blocks in decreasing order of their index.
+	Blocks []BlockSummary
+}
+
+// BlockSummary describes a block for explorers.
+type BlockSummary struct {
+	// Index of the block.
+	Index int
+	// BlockID is the hash of the block.
+	BlockID skipchain.SkipBlockID
+	// Timestamp is a unix timestamp in nanoseconds.
+	Timestamp int64
+	// TxCount is the number of clear transactions in the block.
+	TxCount int
+	// EncryptedTxCount is the number of encrypted transactions ordered in
+	// the block.
+	EncryptedTxCount int
+}
+
+// DecodeBlock asks for the summaries of the transactions executed in a
+// block.
+type DecodeBlock struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// Index of the block.
+	Index int
+}
+
+// DecodeBlockResponse holds the summaries of the transactions of the block.
+type DecodeBlockResponse struct {
+	// Version of the protocol
+	Version Version
+	// Block is the summary of the block.
+	Block BlockSummary
+	// Transactions executed in the block, including the encrypted
+	// transactions of the previous block that have been decrypted.
+	Transactions []TransactionSummary
+}
+
+// TransactionSummary describes a transaction for explorers.
+type TransactionSummary struct {
+	// Instructions of the transaction.
+	Instructions []InstructionSummary
+}
+
+// InstructionSummary describes an instruction in a human-readable way.
+type InstructionSummary struct {
+	// InstanceID the instruction is sent to.
+	InstanceID InstanceID
+	// Action is spawn, invoke or delete.
+	Action string
+	// ContractID is the contract spawned, or the current contract of the
+	// instance for invoke and delete. It is empty if the instance has been
+	// deleted since.
+	ContractID string
+	// Command of an invoke.
+	Command string
+	// Args are the names of the arguments.
+	Args []string
+	// Signers are the identities that signed the instruction.
+	Signers []string
+}
+
+// SearchInstances asks for the instances whose ID contains the hex encoded
+// query, or darcs whose description contains the query.
+type SearchInstances struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// Query is searched case insensitively.
+	Query string
+}
+
+// SearchInstancesResponse holds the instances found, sorted by their ID.
+type SearchInstancesResponse struct {
+	// Version of the protocol
+	Version Version
+	// Instances that matched the query.
+	Instances []InstanceSummary
+	// Truncated is true if more instances matched.
+	Truncated bool
+}
+
+// InstanceSummary describes an instance found by SearchInstances.
+type InstanceSummary struct {
+	// InstanceID of the instance.
+	InstanceID InstanceID
+	// ContractID of the instance.
+	ContractID string
+	// Description of the darc, if the instance is a darc.
+	Description string
+}
+
+// Backup asks for a chunk of a consistent copy of the database of the conode,
+// which holds the skipchains and the collections of omniledger. The first
+// request has an empty BackupID and creates the copy, the next ones give the
+// BackupID of the response and the Offset of the chunk. The Signature is on
+// BackupMessage and must come from a client linked to the conode.
+type Backup struct {
+	// Version of the protocol
+	Version Version
+	// BackupID of the copy, empty to create a new one.
+	BackupID []byte
+	// Offset of the chunk in the copy.
+	Offset int64
+	// Timestamp is the time of the request in seconds since the epoch.
+	Timestamp int64
+	// Signature of a linked client.
+	Signature []byte
+}
+
+// BackupResponse holds a chunk of the copy of the database.
+type BackupResponse struct {
+	// Version of the protocol
+	Version Version
+	// BackupID of the copy.
+	BackupID []byte
+	// Size of the copy.
+	Size int64
+	// Data of the chunk, empty once Offset reaches Size.
+	Data []byte
+}
+
+// Restore sends a chunk of a backup to the conode. The chunks are sent in
+// order, the first one with an empty RestoreID. Once the last chunk is
+// received, the skipchains of the backup are verified from their genesis
+// block, and the collections against the roots of their latest blocks,
+// before they replace the ones of the conode. The Signature is on
+// RestoreMessage and must come from a client linked to the conode.
+type Restore struct {
+	// Version of the protocol
+	Version Version
+	// RestoreID of the upload, empty for the first chunk.
+	RestoreID []byte
+	// Data of the chunk.
+	Data []byte
+	// Last is true for the last chunk.
+	Last bool
+	// Timestamp is the time of the request in seconds since the epoch.
+	Timestamp int64
+	// Signature of a linked client.
+	Signature []byte
+}
+
+// RestoreResponse is returned for every chunk of a restore.
+type RestoreResponse struct {
+	// Version of the protocol
+	Version Version
+	// RestoreID of the upload.
+	RestoreID []byte
+	// Skipchains that have been restored, once the last chunk is received.
+	Skipchains []skipchain.SkipBlockID
+}
+
+// Quota limits what a skipchain can use on a conode. A field of zero means
+// no limit. New transactions for the skipchain are refused with a quota
+// error once a limit is reached.
+type Quota struct {
+	// MaxBytes is the maximum storage used by the collection and the
+	// events of the skipchain.
+	MaxBytes int64
+	// MaxTxPerSecond is the maximum rate of new transactions.
+	MaxTxPerSecond int64
+	// MaxInstances is the maximum number of instances in the collection.
+	MaxInstances int64
+}
+
+// SetQuota sets the quota of a skipchain on the conode, an empty Quota
+// removes it. The Signature is on SetQuotaMessage and must come from a
+// client linked to the conode.
+type SetQuota struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID of the limited skipchain.
+	SkipchainID skipchain.SkipBlockID
+	// Quota of the skipchain.
+	Quota Quota
+	// Timestamp is the time of the request in seconds since the epoch.
+	Timestamp int64
+	// Signature of a linked client.
+	Signature []byte
+}
+
+// SetQuotaResponse is returned once the quota is set.
+type SetQuotaResponse struct {
+	// Version of the protocol
+	Version Version
+}
+
+// CloneChain copies the instances of an existing skipchain into a new
+// skipchain with the given roster. The Signature is on CloneChainMessage and
+// must come from a client linked to the conode, which must be the first node
+// of the roster.
+type CloneChain struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID of the skipchain to clone.
+	SkipchainID skipchain.SkipBlockID
+	// Roster of the new skipchain.
+	Roster onet.Roster
+	// Timestamp is the time of the request in seconds since the epoch.
+	Timestamp int64
+	// Signature of a linked client.
+	Signature []byte
+}
+
+// CloneChainResponse is returned once all the instances are copied.
+type CloneChainResponse struct {
+	// Version of the protocol
+	Version Version
+	// Skipblock is the genesis block of the new skipchain.
+	Skipblock *skipchain.SkipBlock
+	// GenesisDarc is the genesis darc of the new skipchain.
+	GenesisDarc darc.Darc
+	// Instances is the number of copied instances.
+	Instances int
+}
+
+// Replicate makes the conode a read replica of a skipchain whose roster it
+// is not part of, or stops it if Stop is true. The Signature is on
+// ReplicateMessage and must come from a client linked to the conode.
+type Replicate struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID of the replicated skipchain.
+	SkipchainID skipchain.SkipBlockID
+	// Roster to fetch the genesis block from, the later blocks are fetched
+	// from the roster of the latest block.
+	Roster onet.Roster
+	// Stop replicating the skipchain.
+	Stop bool
+	// Timestamp is the time of the request in seconds since the epoch.
+	Timestamp int64
+	// Signature of a linked client.
+	Signature []byte
+}
+
+// ReplicateResponse is returned once the replica has the genesis block.
+type ReplicateResponse struct {
+	// Version of the protocol
+	Version Version
+}
+
+// SetAdminDarc sets the darc whose signers are administrators of the conode,
+// in addition to the linked clients, or removes it if DarcID is empty. The
+// Signature is on SetAdminDarcMessage and must come from an administrator.
+type SetAdminDarc struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID of the skipchain that holds the darc.
+	SkipchainID skipchain.SkipBlockID
+	// DarcID is the base ID of the darc.
+	DarcID darc.ID
+	// Timestamp is the time of the request in seconds since the epoch.
+	Timestamp int64
+	// Signature of an administrator.
+	Signature []byte
+}
+
+// GetRosterHealth asks the leader of a skipchain how responsive the nodes of
+// its roster are. The leader must have enabled the probing of its rosters.
+type GetRosterHealth struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID of the skipchain
+	SkipchainID skipchain.SkipBlockID
+}
+
+// GetRosterHealthResponse holds what the leader measured of the nodes of the
+// roster, and a proposal to exclude the unreachable ones.
+type GetRosterHealthResponse struct {
+	// Version of the protocol
+	Version Version
+	// Nodes are in the order of the roster, without the leader.
+	Nodes []NodeHealth
+	// Proposal is an update_config transaction that removes the
+	// unreachable nodes from the roster, or nil if there is none. It is not
+	// signed: the identities of the genesis darc must sign it, or approve
+	// it with a deferred contract, before it is sent.
+	Proposal *ClientTransaction `protobuf:"opt"`
+}
+
+// NodeHealth is what the leader measured of a node of the roster.
+type NodeHealth struct {
+	// ServerIdentity of the node
+	ServerIdentity *network.ServerIdentity
+	// Latency of the last answer of the node.
+	Latency time.Duration
+	// LastSeen is the time of the last answer of the node, in unix
+	// nanoseconds, or 0 if it never answered.
+	LastSeen int64
+	// Unreachable is true if the node didn't answer for longer than the
+	// period given to EnableRosterProbing.
+	Unreachable bool
+}
+
+// ListChains asks a conode for the omniledger skipchains it holds.
+type ListChains struct {
+	// Version of the protocol
+	Version Version
+}
+
+// ListChainsResponse holds the skipchains of the conode.
+type ListChainsResponse struct {
+	// Version of the protocol
+	Version Version
+	// Chains are sorted by skipchain ID.
+	Chains []ChainInfo
+}
+
+// ChainInfo describes a skipchain held by a conode.
+type ChainInfo struct {
+	// SkipchainID of the skipchain
+	SkipchainID skipchain.SkipBlockID
+	// Role of the conode: RoleLeader, RoleFollower or RoleObserver.
+	Role string
+	// GenesisDarc is the base ID of the genesis darc of the skipchain.
+	GenesisDarc darc.ID
+	// Index of the latest block the conode has.
+	Index int
+	// Bytes used by the collection and the events of the skipchain.
+	Bytes int64
+	// Instances is the number of instances in the collection.
+	Instances int64
+	// Enabled is false if the conode stopped serving the skipchain.
+	Enabled bool
+}
+
+// SetChainEnabled stops or resumes serving a skipchain on the conode,
+// without deleting its data. The Signature is on SetChainEnabledMessage and
+// must come from an administrator of the conode.
+type SetChainEnabled struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID of the skipchain
+	SkipchainID skipchain.SkipBlockID
+	// Enabled is false to stop serving the skipchain.
+	Enabled bool
+	// Timestamp is the time of the request in seconds since the epoch.
+	Timestamp int64
+	// Signature of an administrator.
+	Signature []byte
+}
+
+// SetChainEnabledResponse is returned once the skipchain is enabled or
+// disabled.
+type SetChainEnabledResponse struct {
+	// Version of the protocol
+	Version Version
+}
+
+// SetAdminDarcResponse is returned once the darc is set.
+type SetAdminDarcResponse struct {
+	// Version of the protocol
+	Version Version
+}
+
 // ChainConfig stores all the configuration information for one skipchain. It will
 // be stored under the key "GenesisDarcID || OneNonce", in the collections. The
 // GenesisDarcID is the value of GenesisReferenceID.
 type ChainConfig struct {
 	BlockInterval time.Duration
 	Roster        onet.Roster
+	// PropagationTimeout is how long the propagation of a new block and
+	// its signature may take. If it is zero, it is derived from the
+	// BlockInterval.
+	PropagationTimeout time.Duration `protobuf:"opt"`
+	// ProtocolTimeout is how long the leader waits for the transactions
+	// and the decryptions of the other nodes. If it is zero, it is half of
+	// the BlockInterval.
+	ProtocolTimeout time.Duration `protobuf:"opt"`
+	// MinServiceVersion is the ServiceVersion that the skipchain has
+	// activated with "invoke:activate_version". The conodes with an older
+	// version don't verify its blocks anymore.
+	MinServiceVersion int `protobuf:"opt"`
+	// DarcLimits bound the evaluation of the rules of the darcs, once the
+	// skipchain activated the version 6 of the service. If it is nil,
+	// darc.DefaultLimits are used.
+	DarcLimits *darc.Limits `protobuf:"opt"`
+	// RosterChangeIndex is the index of the block of the last change of
+	// the roster by "invoke:update_config", once the skipchain activated
+	// the version 5. It is set by the service, as the roster can only
+	// change once per block.
+	RosterChangeIndex int `protobuf:"opt"`
+	// TxKey is the public part of the key to encrypt the transactions. The
+	// decryption shares in the blocks are verified against it, so that all
+	// the nodes can verify them, even without a share of the key.
+	TxKey *TxKey `protobuf:"opt"`
+}
+
+// TxKey is the public part of the key created with CreateTxKey.
+type TxKey struct {
+	// Commits are the commitments of the public polynomial of the shares.
+	// The first one is the shared public key.
+	Commits []kyber.Point
+	// N is the number of shares.
+	N int
+}
+
+// ChainTimeValue is the value of the ChainTimeID instance. It is updated at
+// the end of every block, so the transactions of a block see the previous
+// one.
+type ChainTimeValue struct {
+	// Timestamp of the block in unix nanoseconds, as set by the leader.
+	Timestamp int64
+	// BlockIndex is the index of the block.
+	BlockIndex int
 }
 
 // Proof represents everything necessary to verify a given
@@ -122,7 +775,7 @@ type ChainConfig struct {
 //   the key being present, the value is included in the proof
 //   2. Latest is used to verify the merkle tree root used in the collection-proof
 //   is stored in the latest skipblock
-//   3. Links proves that the latest skipblock is part of the skipchain
+//   3. Chain proves that the latest skipblock is part of the skipchain
 //
 // This Structure could later be moved to cothority/skipchain.
 type Proof struct {
@@ -130,10 +783,12 @@ type Proof struct {
 	InclusionProof collection.Proof
 	// Providing the latest skipblock to retrieve the Merkle tree root.
 	Latest skipchain.SkipBlock
-	// Proving the path to the latest skipblock. The first ForwardLink has an
-	// empty-sliced `From` and the genesis-block in `To`, together with the
-	// roster of the genesis-block in the `NewRoster`.
-	Links []skipchain.ForwardLink
+	// Proving the path from the genesis block to the latest skipblock.
+	Chain skipchain.ChainProof
+	// Redacted is true if the values of some instances have been removed
+	// from the InclusionProof, because the signatures of the request
+	// didn't satisfy their ReadRule.
+	Redacted bool
 }
 
 // Instruction holds only one of Spawn, Invoke, or Delete
@@ -159,6 +814,32 @@ type Instruction struct {
 	Delete *Delete
 	// Signatures that can be verified using the darc defined by the instanceID.
 	Signatures []darc.Signature
+	// SignatureVersion is the version of the darc.Request that has been
+	// signed. Starting with darc.RequestVersion1, the signatures also cover
+	// the skipchain ID.
+	SignatureVersion uint32
+	// ValidUntil is the expiration of the transaction of the instruction,
+	// set by ClientTransaction.SetExpiry. It is part of the hash of the
+	// instruction, so it is covered by the signatures.
+	ValidUntil *Expiry `protobuf:"opt"`
+	// DarcProofs prove the darcs of other skipchains that the rules
+	// delegate to with chaindarc identities. They are verified from the
+	// genesis blocks of these skipchains, so the nodes don't need to contact
+	// them. Their latest blocks must not be older than an hour from the
+	// chain time, and they are part of the hash of the instruction.
+	DarcProofs []Proof
+}
+
+// Expiry bounds the blocks a transaction can be included in. A zero field is
+// not checked.
+type Expiry struct {
+	// BlockIndex is the index of the last block that can include the
+	// transaction.
+	BlockIndex int
+	// ChainTime is the latest chain time, in unix nanoseconds, at which the
+	// transaction can be executed. The chain time of a block is the
+	// timestamp of the previous block, see ChainTime.
+	ChainTime int64
 }
 
 // An InstanceID is a unique identifier for one instance of a contract.
@@ -204,6 +885,33 @@ type ClientTransaction struct {
 	Instructions Instructions
 }
 
+// EncryptedTransaction is a ClientTransaction encrypted with the shared
+// public key of the roster. The symmetric key of the payload is derived
+// from a random point, which is ElGamal encrypted in K and C.
+type EncryptedTransaction struct {
+	K       kyber.Point
+	C       kyber.Point
+	Payload []byte
+}
+
+// TxDecryption holds the decryption shares of an encrypted transaction.
+type TxDecryption struct {
+	Shares []DecryptionShare
+}
+
+// DecryptionShare is the share of a node to decrypt an encrypted
+// transaction, with the proof that it used its share of the private key.
+type DecryptionShare struct {
+	// Index of the share of the node.
+	Index int
+	// Ui is the share of the node multiplied with K.
+	Ui kyber.Point
+	// Ei and Fi are the proof that Ui and the public share of the node use
+	// the same private share.
+	Ei kyber.Scalar
+	Fi kyber.Scalar
+}
+
 // StateChange is one new state that will be applied to the collection.
 type StateChange struct {
 	// StateAction can be any of Create, Update, Remove
@@ -224,3 +932,113 @@ type Coin struct {
 	// Value is the total number of coins of that type.
 	Value uint64
 }
+
+// DeferredData is the value of a deferred instance. It holds a proposed
+// transaction that is executed once the identities that added a proof
+// satisfy the rules of all its instructions.
+type DeferredData struct {
+	// ProposedTransaction is the transaction that will be executed.
+	ProposedTransaction ClientTransaction
+	// Proofs holds the signatures that have been added so far.
+	Proofs []DeferredProof
+	// Executed is true once the proposed transaction has been run.
+	Executed bool
+	// ExecResult is empty if the proposed transaction succeeded, else it
+	// holds the error.
+	ExecResult string
+}
+
+// StateMachineData is the value of an instance of a StateMachine.
+type StateMachineData struct {
+	// State is the current state of the instance.
+	State string
+	// Entered is the chain time in nanoseconds when the instance entered
+	// State.
+	Entered int64
+	// Data is the application data of the instance.
+	Data []byte
+}
+
+// DeferredProof is the signature of one identity on one instruction of a
+// proposed transaction.
+type DeferredProof struct {
+	// Index of the instruction in the proposed transaction.
+	Index int
+	// Signature on the message returned by DeferredProofMsg.
+	Signature darc.Signature
+}
+
+// Event is emitted by a contract with EmitEvent. Events are stored by the
+// nodes alongside the blocks, but not in the collection.
+type Event struct {
+	// ContractID is the contract that emitted the event.
+	ContractID string
+	// InstanceID is the instance of the instruction that emitted the event.
+	InstanceID InstanceID
+	// Topic is chosen by the contract and tells the type of the event.
+	Topic string
+	// Value is the content of the event.
+	Value []byte
+}
+
+// BlockEvent is an event together with the block of the transaction that
+// emitted it.
+type BlockEvent struct {
+	// BlockIndex is the index of the block.
+	BlockIndex int
+	// BlockID is the hash of the block.
+	BlockID skipchain.SkipBlockID
+	// Event that has been emitted.
+	Event Event
+}
+
+// MisbehaviorRecord is the value of the instance holding the evidence of
+// misbehavior of one node.
+type MisbehaviorRecord struct {
+	// Public is the key of the node in the roster.
+	Public kyber.Point
+	// Evidence holds all the verified evidence against the node.
+	Evidence []MisbehaviorEvidence
+}
+
+// MisbehaviorEvidence is one piece of evidence that has been verified by
+// the misbehavior contract.
+type MisbehaviorEvidence struct {
+	// Type is one of EvidenceEquivocation, EvidenceInvalidBlock or
+	// EvidenceRefusal.
+	Type string
+	// Evidence is the argument "evidence" of the instruction, so that
+	// everybody can verify it again.
+	Evidence []byte
+}
+
+// EquivocationEvidence is the evidence that the signers of both
+// forward-links signed two different blocks with the same index, following
+// the same block.
+type EquivocationEvidence struct {
+	// First and Second are the two blocks.
+	First  skipchain.SkipBlock
+	Second skipchain.SkipBlock
+	// FirstLink and SecondLink are the forward-links to First and Second,
+	// from the same block.
+	FirstLink  skipchain.ForwardLink
+	SecondLink skipchain.ForwardLink
+}
+
+// InvalidBlockEvidence is the evidence that the signers of Link signed a
+// block with invalid transactions.
+type InvalidBlockEvidence struct {
+	// Block is the invalid block, including its payload.
+	Block skipchain.SkipBlock
+	// Link is the forward-link to Block, signed by the culprits.
+	Link skipchain.ForwardLink
+}
+
+// RefusalEvidence reports that the node with key Public refused to
+// propagate the block with ID BlockID.
+type RefusalEvidence struct {
+	// Public is the key of the node in the roster.
+	Public kyber.Point
+	// BlockID is the block that the node refused to propagate.
+	BlockID skipchain.SkipBlockID
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+)
+
+// SetQuotaMessage returns the message a linked client signs for a SetQuota
+// request.
+func SetQuotaMessage(req *SetQuota) []byte {
+	msg := append([]byte("quota:"), req.SkipchainID...)
+	buf := make([]byte, 32)
+	binary.BigEndian.PutUint64(buf, uint64(req.Quota.MaxBytes))
+	binary.BigEndian.PutUint64(buf[8:], uint64(req.Quota.MaxTxPerSecond))
+	binary.BigEndian.PutUint64(buf[16:], uint64(req.Quota.MaxInstances))
+	binary.BigEndian.PutUint64(buf[24:], uint64(req.Timestamp))
+	return append(msg, buf...)
+}
+
+// SetQuota sets the limits of a skipchain on this conode, or removes them
+// if the quota is empty. Only a client linked to the conode can set quotas.
+func (s *Service) SetQuota(req *SetQuota) (*SetQuotaResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if err := s.verifyAdmin(SetQuotaMessage(req), req.Timestamp, req.Signature); err != nil {
+		return nil, err
+	}
+	q := req.Quota
+	if q.MaxBytes < 0 || q.MaxTxPerSecond < 0 || q.MaxInstances < 0 {
+		return nil, errors.New("negative quota")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("not an omniledger skipchain")
+	}
+
+	s.storage.Lock()
+	if s.storage.Quotas == nil {
+		s.storage.Quotas = make(map[string]Quota)
+	}
+	if q == (Quota{}) {
+		delete(s.storage.Quotas, string(req.SkipchainID))
+	} else {
+		s.storage.Quotas[string(req.SkipchainID)] = q
+	}
+	s.storage.Unlock()
+	s.save()
+
+	s.quotas.reset(req.SkipchainID)
+	if q != (Quota{}) {
+		if err := s.measureUsage(req.SkipchainID); err != nil {
+			return nil, err
+		}
+	}
+	log.Lvlf1("%s: quota of %x set to %+v", s.ServerIdentity(), req.SkipchainID, q)
+	return &SetQuotaResponse{Version: CurrentVersion}, nil
+}
+
+// quota returns the quota of the skipchain scID, and false if it has none.
+func (s *Service) quota(scID skipchain.SkipBlockID) (Quota, bool) {
+	s.storage.Lock()
+	defer s.storage.Unlock()
+	q, ok := s.storage.Quotas[string(scID)]
+	return q, ok
+}
+
+// checkQuota returns an error if a new transaction for the skipchain scID
+// exceeds its quota on this conode.
+func (s *Service) checkQuota(scID skipchain.SkipBlockID) error {
+	q, ok := s.quota(scID)
+	if !ok {
+		return nil
+	}
+	return s.quotas.check(scID, q, time.Now())
+}
+
+// measureUsage updates the storage and the number of instances used by the
+// skipchain scID, if it has a quota. It is called once the collection of a
+// new block is stored.
+func (s *Service) measureUsage(scID skipchain.SkipBlockID) error {
+	if _, ok := s.quota(scID); !ok {
+		return nil
+	}
+	bytes, instances, err := s.storageUsage(scID)
+	if err != nil {
+		return err
+	}
+	s.quotas.setUsage(scID, bytes, instances)
+	return nil
+}
+
+// storageUsage returns the bytes used by the collection and the events of
+// the skipchain scID, and the number of its instances.
+func (s *Service) storageUsage(scID skipchain.SkipBlockID) (bytes, instances int64, err error) {
+	cdb := s.getCollection(scID)
+	edb := s.getEventDB(scID)
+	err = cdb.db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{cdb.bucketName, edb.bucketName} {
+			b := tx.Bucket(name)
+			if b == nil {
+				continue
+			}
+			st := b.Stats()
+			bytes += int64(st.BranchInuse + st.LeafInuse)
+			if string(name) == string(cdb.bucketName) {
+				// Every instance has a value and a contract key.
+				instances = int64(st.KeyN / 2)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// chainUsage is what a skipchain uses on the conode.
+type chainUsage struct {
+	bytes     int64
+	instances int64
+	// tokens of the rate limit, one is taken by every transaction. They
+	// are refilled at MaxTxPerSecond up to MaxTxPerSecond.
+	tokens   float64
+	lastFill time.Time
+}
+
+// quotaUsage holds the usage of the skipchains that have a quota.
+type quotaUsage struct {
+	sync.Mutex
+	chains map[string]*chainUsage
+}
+
+func newQuotaUsage() quotaUsage {
+	return quotaUsage{chains: make(map[string]*chainUsage)}
+}
+
+// get returns the usage of the skipchain scID. The lock must be held.
+func (u *quotaUsage) get(scID skipchain.SkipBlockID) *chainUsage {
+	c := u.chains[string(scID)]
+	if c == nil {
+		c = &chainUsage{tokens: -1}
+		u.chains[string(scID)] = c
+	}
+	return c
+}
+
+func (u *quotaUsage) reset(scID skipchain.SkipBlockID) {
+	u.Lock()
+	delete(u.chains, string(scID))
+	u.Unlock()
+}
+
+func (u *quotaUsage) setUsage(scID skipchain.SkipBlockID, bytes, instances int64) {
+	u.Lock()
+	c := u.get(scID)
+	c.bytes = bytes
+	c.instances = instances
+	u.Unlock()
+}
+
+// check takes a token for a new transaction, or returns an error if the
+// quota q of the skipchain scID is exceeded at time now.
+func (u *quotaUsage) check(scID skipchain.SkipBlockID, q Quota, now time.Time) error {
+	u.Lock()
+	defer u.Unlock()
+	c := u.get(scID)
+	if q.MaxBytes > 0 && c.bytes >= q.MaxBytes {
+		return fmt.Errorf("quota exceeded: the skipchain uses %d bytes, the limit is %d",
+			c.bytes, q.MaxBytes)
+	}
+	if q.MaxInstances > 0 && c.instances >= q.MaxInstances {
+		return fmt.Errorf("quota exceeded: the skipchain has %d instances, the limit is %d",
+			c.instances, q.MaxInstances)
+	}
+	if q.MaxTxPerSecond > 0 {
+		max := float64(q.MaxTxPerSecond)
+		if c.tokens < 0 {
+			c.tokens = max
+		} else {
+			c.tokens += now.Sub(c.lastFill).Seconds() * max
+			if c.tokens > max {
+				c.tokens = max
+			}
+		}
+		c.lastFill = now
+		if c.tokens < 1 {
+			return fmt.Errorf("quota exceeded: more than %d transactions per second",
+				q.MaxTxPerSecond)
+		}
+		c.tokens--
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/util/key"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaUsage_Check(t *testing.T) {
+	u := newQuotaUsage()
+	id := skipchain.SkipBlockID{1}
+	now := time.Now()
+
+	q := Quota{MaxTxPerSecond: 2}
+	require.Nil(t, u.check(id, q, now))
+	require.Nil(t, u.check(id, q, now))
+	require.NotNil(t, u.check(id, q, now))
+	// The tokens are refilled with time.
+	require.Nil(t, u.check(id, q, now.Add(time.Second/2)))
+	require.NotNil(t, u.check(id, q, now.Add(time.Second/2)))
+
+	u.setUsage(id, 100, 10)
+	require.NotNil(t, u.check(id, Quota{MaxBytes: 100}, now))
+	require.Nil(t, u.check(id, Quota{MaxBytes: 101}, now))
+	require.NotNil(t, u.check(id, Quota{MaxInstances: 10}, now))
+	require.Nil(t, u.check(id, Quota{MaxInstances: 11}, now))
+}
+
+func TestService_SetQuota(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	host := s.hosts[0]
+	kp := key.NewKeyPair(cothority.Suite)
+	require.Nil(t, skipchain.NewClient().CreateLinkPrivate(host.ServerIdentity,
+		s.local.GetPrivate(host), kp.Public))
+	cl := NewClient()
+	scID := s.sb.SkipChainID()
+
+	// Only a linked client can set a quota.
+	require.NotNil(t, cl.SetQuota(host.ServerIdentity, key.NewKeyPair(cothority.Suite).Private,
+		scID, Quota{MaxTxPerSecond: 1}))
+	require.NotNil(t, cl.SetQuota(host.ServerIdentity, kp.Private, skipchain.SkipBlockID{1},
+		Quota{MaxTxPerSecond: 1}))
+
+	// The genesis block already holds the config and the darc.
+	require.Nil(t, cl.SetQuota(host.ServerIdentity, kp.Private, scID, Quota{MaxInstances: 2}))
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	_, err = s.service().AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Transaction: tx,
+	})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "quota exceeded")
+
+	require.Nil(t, cl.SetQuota(host.ServerIdentity, kp.Private, scID, Quota{MaxTxPerSecond: 1}))
+	s.sendTx(t, tx)
+	tx2, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, []byte("value2"), s.signer)
+	require.Nil(t, err)
+	_, err = s.service().AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Transaction: tx2,
+	})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "quota exceeded")
+
+	// Without a quota, the transactions are accepted again.
+	require.Nil(t, cl.SetQuota(host.ServerIdentity, kp.Private, scID, Quota{}))
+	s.sendTx(t, tx2)
+	require.True(t, s.waitProofWithIdx(t, tx2.Instructions[0].InstanceID, 0).InclusionProof.Match())
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber"
+	"github.com/dedis/onet/log"
+)
+
+// The randomness of an instance is the transaction key of the roster,
+// created by the DKG service, multiplied with a point derived from the
+// instance ID. Nobody can compute it before a threshold of the nodes gave
+// their shares, and as it only depends on the instance, neither the leader
+// nor the client can choose it. The nodes only give their shares once the
+// RandomnessCheck of the contract of the instance passes, for example once
+// a lottery doesn't take any more participants. The contract then verifies
+// the shares against the key in the config with Randomness.
+
+// RandomnessCheck is the type signature of the functions that can be
+// registered with RegisterRandomness. It returns an error as long as the
+// randomness of the instance id must not be revealed.
+type RandomnessCheck func(coll CollectionView, id InstanceID) error
+
+// RegisterRandomness lets the nodes give their shares of the randomness of
+// the instances of the contract kind, once check passes.
+func RegisterRandomness(s skipchain.GetService, kind string, check RandomnessCheck) error {
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	return scs.(*Service).registerRandomness(kind, check)
+}
+
+// Randomness verifies the shares of the randomness of the instance id
+// against the transaction key in the config of coll, and returns the
+// randomness.
+func Randomness(coll CollectionView, id InstanceID, shares TxDecryption) ([]byte, error) {
+	config, err := LoadConfigFromColl(coll)
+	if err != nil {
+		return nil, err
+	}
+	if config.TxKey == nil {
+		return nil, errors.New("the config holds no transaction key")
+	}
+	xP, err := recoverXK(config.TxKey.pubPoly(), config.TxKey.N, randomnessPoint(id), shares)
+	if err != nil {
+		return nil, fmt.Errorf("invalid randomness: %v", err)
+	}
+	h := sha256.New()
+	if _, err := xP.MarshalTo(h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// randomnessPoint returns the point whose multiplication with the
+// transaction key gives the randomness of the instance id.
+func randomnessPoint(id InstanceID) kyber.Point {
+	seed := append([]byte("randomness"), id.Slice()...)
+	return cothority.Suite.Point().Pick(cothority.Suite.XOF(seed))
+}
+
+// GetRandomness collects a threshold of shares of the randomness of an
+// instance from the roster, if the contract of the instance lets the nodes
+// reveal it.
+func (s *Service) GetRandomness(req *GetRandomness) (*GetRandomnessResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if err := s.checkEnabled(req.SkipchainID); err != nil {
+		return nil, err
+	}
+	sb, err := s.db().GetLatestByID(req.SkipchainID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.randomnessReady(req.SkipchainID, req.InstanceID); err != nil {
+		return nil, err
+	}
+	interval, _ := s.LoadBlockInterval(req.SkipchainID)
+	decs, err := s.collectShares(sb, &req.InstanceID, []kyber.Point{randomnessPoint(req.InstanceID)},
+		s.loadProtocolTimeout(req.SkipchainID, interval))
+	if err != nil {
+		return nil, err
+	}
+	return &GetRandomnessResponse{
+		Version: CurrentVersion,
+		Shares:  decs[0],
+	}, nil
+}
+
+// randomnessReady returns an error if the contract of the instance id
+// doesn't let the nodes reveal its randomness yet.
+func (s *Service) randomnessReady(scID skipchain.SkipBlockID, id InstanceID) error {
+	cdb := s.getCollection(scID)
+	cdb.blockMut.RLock()
+	defer cdb.blockMut.RUnlock()
+	coll := &roCollection{cdb.coll}
+	_, contractID, err := coll.GetValues(id.Slice())
+	if err != nil {
+		return errors.New("couldn't find instance: " + err.Error())
+	}
+	check, exists := s.randomnessChecks[contractID]
+	if !exists {
+		return fmt.Errorf("contract %s has no randomness", contractID)
+	}
+	return check(coll, id)
+}
+
+// getRandomnessShares returns the share of this node of the randomness of
+// the instance id of the skipchain of the stored block blockID, or nothing
+// if it must not be revealed yet.
+func (s *Service) getRandomnessShares(blockID skipchain.SkipBlockID, id InstanceID) []DecryptionShare {
+	sb := s.db().GetByID(blockID)
+	if sb == nil {
+		log.Lvl2(s.ServerIdentity(), "refusing randomness of unknown block")
+		return nil
+	}
+	if err := s.randomnessReady(sb.SkipChainID(), id); err != nil {
+		log.Lvl2(s.ServerIdentity(), "refusing randomness:", err)
+		return nil
+	}
+	_, _, shared, err := s.txKey(sb.SkipChainID())
+	if err != nil {
+		log.Error(s.ServerIdentity(), err)
+		return nil
+	}
+	return []DecryptionShare{newDecryptionShare(shared, randomnessPoint(id))}
+}
+
+// registerRandomness stores the check of the randomness of the contract.
+func (s *Service) registerRandomness(kind string, check RandomnessCheck) error {
+	s.randomnessChecks[kind] = check
+	return nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_GetRandomness(t *testing.T) {
+	s := newSer(t, 1, 500*time.Millisecond)
+	defer s.local.CloseAll()
+
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx)
+	id := tx.Instructions[0].InstanceID
+	s.waitProof(t, id)
+	req := &GetRandomness{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		InstanceID:  id,
+	}
+
+	// Without a check, the nodes don't give their shares.
+	_, err = s.service().GetRandomness(req)
+	require.NotNil(t, err)
+	for _, ser := range s.services {
+		require.Nil(t, ser.registerRandomness(dummyKind, func(CollectionView, InstanceID) error {
+			return errors.New("not ready")
+		}))
+	}
+	_, err = s.service().GetRandomness(req)
+	require.NotNil(t, err)
+
+	// Without the key in the config, there is no randomness.
+	for _, ser := range s.services {
+		require.Nil(t, ser.registerRandomness(dummyKind, func(CollectionView, InstanceID) error {
+			return nil
+		}))
+	}
+	_, err = s.service().GetRandomness(req)
+	require.NotNil(t, err)
+	key, err := s.service().CreateTxKey(&CreateTxKey{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+	})
+	require.Nil(t, err)
+	config, err := s.service().LoadConfig(s.sb.SkipChainID())
+	require.Nil(t, err)
+	config.TxKey = &key.Key
+	s.sendTx(t, configTx(t, s, *config))
+	for i := 0; i < 10; i++ {
+		if _, _, err = s.service().configTxKey(s.sb.SkipChainID()); err == nil {
+			break
+		}
+		time.Sleep(s.interval)
+	}
+	require.Nil(t, err)
+
+	resp, err := s.service().GetRandomness(req)
+	require.Nil(t, err)
+	coll := s.service().GetCollectionView(s.sb.SkipChainID())
+	r, err := Randomness(coll, id, resp.Shares)
+	require.Nil(t, err)
+	require.Equal(t, 32, len(r))
+
+	// The randomness only depends on the instance.
+	resp2, err := s.services[1].GetRandomness(req)
+	require.Nil(t, err)
+	r2, err := Randomness(coll, id, resp2.Shares)
+	require.Nil(t, err)
+	require.Equal(t, r, r2)
+	_, err = Randomness(coll, NewInstanceID([]byte("other")), resp.Shares)
+	require.NotNil(t, err)
+
+	// Tampered shares are refused.
+	resp.Shares.Shares[0].Ui = resp.Shares.Shares[1].Ui
+	_, err = Randomness(coll, id, resp.Shares)
+	require.NotNil(t, err)
+}
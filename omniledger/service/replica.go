@@ -0,0 +1,156 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+)
+
+// A read replica is a conode that follows a skipchain whose roster it is not
+// part of, to serve proofs and searches. It fetches the new blocks from the
+// roster, verifies them against the forward-link of the previous block and
+// updates its collection like the nodes of the roster do. The clients verify
+// the proofs of a replica against the genesis block, so they don't need to
+// trust it, but the latest block of a replica can be behind the roster.
+
+// replicaRetry is how long a replica waits after it failed to fetch new
+// blocks.
+var replicaRetry = 5 * time.Second
+
+// ReplicateMessage returns the message a linked client signs for a
+// Replicate request.
+func ReplicateMessage(req *Replicate) []byte {
+	msg := append([]byte("replicate:"), req.SkipchainID...)
+	msg = append(msg, req.Roster.ID[:]...)
+	buf := make([]byte, 9)
+	if req.Stop {
+		buf[0] = 1
+	}
+	binary.BigEndian.PutUint64(buf[1:], uint64(req.Timestamp))
+	return append(msg, buf...)
+}
+
+// Replicate makes the conode a read replica of a skipchain, or stops it.
+// The genesis block is fetched from the roster of the request before it
+// returns, the other blocks are fetched in the background. Only a client
+// linked to the conode can start or stop a replica.
+func (s *Service) Replicate(req *Replicate) (*ReplicateResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if err := s.verifyAdmin(ReplicateMessage(req), req.Timestamp, req.Signature); err != nil {
+		return nil, err
+	}
+	id := string(req.SkipchainID)
+	if req.Stop {
+		s.replicas.stop(req.SkipchainID)
+		s.storage.Lock()
+		delete(s.storage.Replicas, id)
+		s.storage.Unlock()
+		s.save()
+		return &ReplicateResponse{Version: CurrentVersion}, nil
+	}
+
+	if len(req.Roster.List) == 0 {
+		return nil, errors.New("empty roster")
+	}
+	if i, _ := req.Roster.Search(s.ServerIdentity().ID); i >= 0 {
+		return nil, errors.New("the conode is in the roster of the skipchain")
+	}
+	if _, err := s.skService().FetchGenesis(&req.Roster, req.SkipchainID); err != nil {
+		return nil, errors.New("couldn't get the genesis block: " + err.Error())
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("not an omniledger skipchain")
+	}
+
+	s.storage.Lock()
+	if s.storage.Replicas == nil {
+		s.storage.Replicas = make(map[string]bool)
+	}
+	s.storage.Replicas[id] = true
+	s.storage.Unlock()
+	s.save()
+	s.startReplica(req.SkipchainID)
+	log.Lvlf1("%s: replicating %x", s.ServerIdentity(), req.SkipchainID)
+	return &ReplicateResponse{Version: CurrentVersion}, nil
+}
+
+// isReplica returns true if the conode is a read replica of the skipchain
+// scID.
+func (s *Service) isReplica(scID skipchain.SkipBlockID) bool {
+	s.storage.Lock()
+	defer s.storage.Unlock()
+	return s.storage.Replicas[string(scID)]
+}
+
+// startReplica starts fetching the new blocks of the skipchain scID, if it
+// isn't done yet.
+func (s *Service) startReplica(scID skipchain.SkipBlockID) {
+	s.replicas.Lock()
+	defer s.replicas.Unlock()
+	if _, ok := s.replicas.done[string(scID)]; ok {
+		return
+	}
+	done := make(chan bool)
+	s.replicas.done[string(scID)] = done
+	go s.replicate(scID, done)
+}
+
+// replicate fetches the new blocks of the skipchain scID until done is
+// closed. Storing the blocks updates the collection.
+func (s *Service) replicate(scID skipchain.SkipBlockID, done chan bool) {
+	for {
+		latest, err := s.db().GetLatestByID(scID)
+		if err == nil {
+			_, err = s.skService().FetchNewBlocks(latest)
+		}
+		if err != nil {
+			log.Warn(s.txLog(scID).msg("couldn't fetch new blocks:", err))
+			select {
+			case <-done:
+				return
+			case <-time.After(replicaRetry):
+			}
+			continue
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
+
+// replicas holds the channels that stop the routines of the replicated
+// skipchains.
+type replicas struct {
+	sync.Mutex
+	done map[string]chan bool
+}
+
+func newReplicas() replicas {
+	return replicas{done: make(map[string]chan bool)}
+}
+
+func (r *replicas) stop(scID skipchain.SkipBlockID) {
+	r.Lock()
+	defer r.Unlock()
+	if done, ok := r.done[string(scID)]; ok {
+		close(done)
+		delete(r.done, string(scID))
+	}
+}
+
+func (r *replicas) stopAll() {
+	r.Lock()
+	defer r.Unlock()
+	for id, done := range r.done {
+		close(done)
+		delete(r.done, id)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Replicate(t *testing.T) {
+	s := newSer(t, 2, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+	require.True(t, s.waitProof(t, s.tx.Instructions[0].InstanceID).InclusionProof.Match())
+
+	host := s.local.GenServers(1)[0]
+	registerDummy([]*onet.Server{host})
+	replica := s.local.GetServices([]*onet.Server{host}, OmniledgerID)[0].(*Service)
+	kp := key.NewKeyPair(cothority.Suite)
+	require.Nil(t, skipchain.NewClient().CreateLinkPrivate(host.ServerIdentity,
+		s.local.GetPrivate(host), kp.Public))
+
+	cl := NewClient()
+	require.NotNil(t, cl.Replicate(host.ServerIdentity, key.NewKeyPair(cothority.Suite).Private,
+		scID, s.roster, false))
+	require.Nil(t, cl.Replicate(host.ServerIdentity, kp.Private, scID, s.roster, false))
+	defer cl.Replicate(host.ServerIdentity, kp.Private, scID, s.roster, true)
+
+	// The proofs of the replica are verified against the genesis block.
+	cl.ID = scID
+	cl.Roster = s.roster
+	cl.Replicas = []*network.ServerIdentity{host.ServerIdentity}
+	waitReplica := func(id InstanceID) {
+		for i := 0; i < 20; i++ {
+			resp, err := cl.GetProof(id.Slice())
+			require.Nil(t, err)
+			if resp.Proof.InclusionProof.Match() {
+				return
+			}
+			time.Sleep(s.interval)
+		}
+		require.Fail(t, "the replica didn't get the instance")
+	}
+	waitReplica(s.tx.Instructions[0].InstanceID)
+
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, []byte("value2"), s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx)
+	waitReplica(tx.Instructions[0].InstanceID)
+	search, err := cl.SearchInstances(hex.EncodeToString(s.darc.GetBaseID())[:8])
+	require.Nil(t, err)
+	require.NotEmpty(t, search.Instances)
+
+	// A replica doesn't take part in the consensus.
+	_, err = replica.AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Transaction: tx,
+	})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// Contracts can register the arguments their instructions take. The service
+// then refuses instructions with missing, unknown or malformed arguments
+// before executing them. The node receiving a transaction checks it, too, so
+// that the client learns about a typo in an argument name right away instead
+// of finding its transaction refused in the next block.
+
+// ArgumentType tells how the value of an argument must look like.
+type ArgumentType int
+
+const (
+	// ArgBytes accepts any value.
+	ArgBytes ArgumentType = iota
+	// ArgString is a non-empty UTF-8 string.
+	ArgString
+	// ArgUint32 is a 32-bit uint in LittleEndian.
+	ArgUint32
+	// ArgUint64 is a 64-bit uint in LittleEndian.
+	ArgUint64
+	// ArgInstanceID is the slice of an InstanceID.
+	ArgInstanceID
+	// ArgDarc is a protobuf-encoded darc.
+	ArgDarc
+)
+
+// ArgumentSpec describes one argument of an instruction.
+type ArgumentSpec struct {
+	Name     string
+	Type     ArgumentType
+	Required bool
+}
+
+// ArgumentSchema lists all arguments an instruction accepts.
+type ArgumentSchema []ArgumentSpec
+
+// ArgumentError tells which argument of which instruction doesn't match the
+// schema of its contract.
+type ArgumentError struct {
+	// Index of the instruction in the transaction.
+	Index int
+	// Name of the argument.
+	Name string
+	// Problem with the argument.
+	Problem string
+}
+
+func (ae ArgumentError) Error() string {
+	return fmt.Sprintf("instruction %d: argument \"%s\" %s", ae.Index, ae.Name, ae.Problem)
+}
+
+// ArgumentErrors holds all problems with the arguments of a transaction.
+type ArgumentErrors []ArgumentError
+
+func (aes ArgumentErrors) Error() string {
+	var strs []string
+	for _, ae := range aes {
+		strs = append(strs, ae.Error())
+	}
+	return strings.Join(strs, "; ")
+}
+
+// RegisterArgumentSchema stores the schema of the arguments of the
+// instructions of contract kind. action is "spawn" or "invoke:" followed by
+// the command. Instructions without a schema are not checked.
+func RegisterArgumentSchema(s skipchain.GetService, kind, action string, schema ArgumentSchema) error {
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	return scs.(*Service).registerArgumentSchema(kind, action, schema)
+}
+
+func (s *Service) registerArgumentSchema(kind, action string, schema ArgumentSchema) error {
+	for i, spec := range schema {
+		for _, spec2 := range schema[:i] {
+			if spec.Name == spec2.Name {
+				return fmt.Errorf("argument %s is in the schema twice", spec.Name)
+			}
+		}
+	}
+	s.schemas[kind+"/"+action] = schema
+	return nil
+}
+
+// schemaAction returns the action of the schema that applies to instr.
+func schemaAction(instr Instruction) string {
+	switch {
+	case instr.Spawn != nil:
+		return "spawn"
+	case instr.Invoke != nil:
+		return "invoke:" + instr.Invoke.Command
+	default:
+		return "delete"
+	}
+}
+
+// checkArguments returns the problems with the arguments of instr, which is
+// sent to contract kind.
+func (s *Service) checkArguments(kind string, instr Instruction) ArgumentErrors {
+	schema, ok := s.schemas[kind+"/"+schemaAction(instr)]
+	if !ok {
+		return nil
+	}
+	var args Arguments
+	switch {
+	case instr.Spawn != nil:
+		args = instr.Spawn.Args
+	case instr.Invoke != nil:
+		args = instr.Invoke.Args
+	}
+	var errs ArgumentErrors
+	problem := func(name, format string, a ...interface{}) {
+		errs = append(errs, ArgumentError{
+			Index:   instr.Index,
+			Name:    name,
+			Problem: fmt.Sprintf(format, a...),
+		})
+	}
+	for i, arg := range args {
+		for _, arg2 := range args[:i] {
+			if arg.Name == arg2.Name {
+				problem(arg.Name, "is given twice")
+			}
+		}
+		var spec *ArgumentSpec
+		for j := range schema {
+			if schema[j].Name == arg.Name {
+				spec = &schema[j]
+			}
+		}
+		if spec == nil {
+			problem(arg.Name, "is unknown")
+			continue
+		}
+		if err := spec.Type.check(arg.Value); err != nil {
+			problem(arg.Name, "%v", err)
+		}
+	}
+	for _, spec := range schema {
+		if spec.Required && args.Search(spec.Name) == nil {
+			problem(spec.Name, "is missing")
+		}
+	}
+	return errs
+}
+
+// check returns an error if value is not of the type at.
+func (at ArgumentType) check(value []byte) error {
+	switch at {
+	case ArgBytes:
+	case ArgString:
+		if len(value) == 0 || !utf8.Valid(value) {
+			return errors.New("is not a string")
+		}
+	case ArgUint32:
+		if len(value) != 4 {
+			return errors.New("is not a 32-bit uint")
+		}
+	case ArgUint64:
+		if len(value) != 8 {
+			return errors.New("is not a 64-bit uint")
+		}
+	case ArgInstanceID:
+		if len(value) != 64 {
+			return errors.New("is not an instance ID")
+		}
+	case ArgDarc:
+		if _, err := darc.NewFromProtobuf(value); err != nil {
+			return fmt.Errorf("is not a darc: %v", err)
+		}
+	default:
+		return fmt.Errorf("has unknown type %d", at)
+	}
+	return nil
+}
+
+// checkTxArguments checks the arguments of all instructions of ct that have
+// a schema. The contract of instances that don't exist yet is not known, so
+// their instructions are only checked when they are executed.
+func (s *Service) checkTxArguments(scID skipchain.SkipBlockID, ct ClientTransaction) error {
+	coll := s.GetCollectionView(scID)
+	var errs ArgumentErrors
+	for _, instr := range ct.Instructions {
+		kind, _, err := instr.GetContractState(coll)
+		if err != nil {
+			continue
+		}
+		errs = append(errs, s.checkArguments(kind, instr)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
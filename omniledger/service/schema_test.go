@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/onet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgumentSchema(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	hosts, _, _ := local.GenTree(1, false)
+	s := local.GetServices(hosts, OmniledgerID)[0].(*Service)
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+
+	require.Nil(t, RegisterArgumentSchema(hosts[0], dummyKind, "spawn", ArgumentSchema{
+		{"data", ArgBytes, true},
+		{"count", ArgUint64, false},
+	}))
+	require.NotNil(t, s.registerArgumentSchema(dummyKind, "spawn", ArgumentSchema{
+		{"data", ArgBytes, true},
+		{"data", ArgUint64, false},
+	}))
+
+	spawn := func(args ...Argument) Instruction {
+		return Instruction{
+			InstanceID: InstanceID{DarcID: make([]byte, 32), SubID: genSubID()},
+			Index:      1,
+			Spawn:      &Spawn{ContractID: dummyKind, Args: args},
+		}
+	}
+	require.Nil(t, s.checkArguments(dummyKind, spawn(Argument{Name: "data", Value: []byte{}})))
+	require.Nil(t, s.checkArguments(dummyKind, spawn(
+		Argument{Name: "data", Value: []byte{1}},
+		Argument{Name: "count", Value: make([]byte, 8)})))
+	// Invoke instructions have no schema.
+	require.Nil(t, s.checkArguments(dummyKind, Instruction{Invoke: &Invoke{Command: "any"}}))
+
+	errs := s.checkArguments(dummyKind, spawn(
+		Argument{Name: "dtaa", Value: []byte{1}},
+		Argument{Name: "count", Value: make([]byte, 4)}))
+	require.Equal(t, ArgumentErrors{
+		{Index: 1, Name: "dtaa", Problem: "is unknown"},
+		{Index: 1, Name: "count", Problem: "is not a 64-bit uint"},
+		{Index: 1, Name: "data", Problem: "is missing"},
+	}, errs)
+	require.Equal(t, "instruction 1: argument \"dtaa\" is unknown", errs[0].Error())
+
+	// The instruction is refused before the contract is called.
+	_, _, err := s.executeInstruction(coll, nil, spawn(Argument{Name: "dtaa", Value: []byte{1}}))
+	require.NotNil(t, err)
+	_, ok := err.(ArgumentErrors)
+	require.True(t, ok)
+}
+
+func TestService_ArgumentSchema(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	d, err := s.service().LoadGenesisDarc(s.sb.SkipChainID())
+	require.Nil(t, err)
+	darcBuf, err := d.ToProto()
+	require.Nil(t, err)
+	ctx := ClientTransaction{
+		Instructions: []Instruction{{
+			InstanceID: InstanceID{DarcID: s.darc.GetBaseID(), SubID: SubID{}},
+			Nonce:      GenNonce(),
+			Index:      0,
+			Length:     1,
+			Invoke: &Invoke{
+				Command: CmdDarcEvolve,
+				Args:    []Argument{{Name: "drac", Value: darcBuf}},
+			},
+		}},
+	}
+	require.Nil(t, ctx.Instructions[0].SignBy(s.signer))
+	_, err = s.service().AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		Transaction: ctx,
+	})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "\"darc\" is missing")
+}
@@ -6,16 +6,18 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"encoding/hex"
 
 	"github.com/dedis/cothority"
-	"github.com/dedis/cothority/messaging"
+	"github.com/dedis/cothority/metrics"
 	"github.com/dedis/cothority/omniledger/collection"
 	"github.com/dedis/cothority/omniledger/darc"
 	"github.com/dedis/cothority/skipchain"
+	status "github.com/dedis/cothority/status/service"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/util/random"
 	"github.com/dedis/onet"
@@ -42,7 +44,7 @@ func init() {
 	var err error
 	OmniledgerID, err = onet.RegisterNewService(ServiceName, newService)
 	log.ErrFatal(err)
-	network.RegisterMessages(&omniStorage{}, &DataHeader{}, &updateCollection{})
+	network.RegisterMessages(&omniStorage{}, &DataHeader{})
 }
 
 // GenNonce returns a random nonce.
@@ -64,26 +66,55 @@ type Service struct {
 	// TODO: merge collectionDB and pollChan into olState structure.
 	state olState
 
+	// eventDB holds the events emitted by the contracts of every omniledger,
+	// and subscriptions the channels waiting for new events.
+	eventDB       map[string]*eventDB
+	eventDBMut    sync.Mutex
+	subscriptions eventSubscriptions
+
 	// pollChan maintains a map of channels that can be used to stop the
 	// polling go-routing.
 	pollChan    map[string]chan bool
 	pollChanMut sync.Mutex
 	pollChanWG  sync.WaitGroup
 
+	// clock is the time source of the block production, and triggers the
+	// polling go-routines to produce a block now.
+	clock    serviceClock
+	triggers blockTriggers
+
+	// faults are the failures injected by the tests.
+	faults faults
+
+	// probes holds the responsiveness of the nodes of the rosters.
+	probes rosterProbes
+
 	// NOTE: If we have a lot of skipchains, then using mutex most likely
 	// will slow down our service, an improvement is to go-routines to
 	// store transactions. But there is more management overhead, e.g.,
 	// restarting after shutdown, answer getTxs requests and so on.
 	txBuffer txBuffer
+	// encTxBuffer holds the encrypted transactions sent to the leader.
+	encTxBuffer encryptedTxBuffer
 
 	heartbeats        heartbeats
 	heartbeatsTimeout chan string
 	heartbeatsClose   chan bool
 
 	// contracts map kinds to kind specific verification functions
-	contracts map[string]OmniLedgerContract
-	// propagate the new transactions
-	propagateTransactions messaging.PropagationFunc
+	contracts map[string]Contract
+	// contractVersions holds all registered versions of the contracts
+	contractVersions map[string]map[uint32]Contract
+	// views map "kind/name" to the read-only functions of the contracts
+	views map[string]OmniLedgerView
+	// randomnessChecks map the contracts to the functions that tell when
+	// the randomness of their instances can be revealed.
+	randomnessChecks map[string]RandomnessCheck
+	// schemas map "kind/action" to the arguments of the instructions
+	schemas map[string]ArgumentSchema
+	// identityVerifiers map identity types to the functions that check
+	// them against the state of the chain
+	identityVerifiers map[string]IdentityVerifier
 
 	storage *omniStorage
 
@@ -91,6 +122,33 @@ type Service struct {
 
 	darcToSc    map[string]skipchain.SkipBlockID
 	darcToScMut sync.Mutex
+
+	// shutdown is closed when Shutdown is called, and closed once the last
+	// blocks are created and the waiting clients can be answered.
+	shutdown    chan bool
+	closed      chan bool
+	shutdownMut sync.Mutex
+
+	// backups holds the copies of the database that are being downloaded
+	// and the backups that are being uploaded.
+	backups backupFiles
+
+	// quotas holds the usage of the skipchains that have a quota.
+	quotas quotaUsage
+
+	// propTimeouts holds the propagation timeouts of the skipchains.
+	propTimeouts propagationTimeouts
+
+	// replicas stops the routines of the replicated skipchains.
+	replicas replicas
+
+	// nodeVersions holds the ServiceVersion the nodes sent while the
+	// transactions were collected.
+	nodeVersions nodeVersions
+
+	// overloadHandOff is the number of overloaded blocks in a row after
+	// which a leader hands off, 0 if it never does.
+	overloadHandOff int
 }
 
 // storageID reflects the data we're storing - we could store more
@@ -101,19 +159,34 @@ const storageID = "OmniLedger"
 // transaction is not set.
 var defaultInterval = 5 * time.Second
 
+// defaultBaseHeight and defaultMaximumHeight are used for the skipchain if the
+// genesis request doesn't set them.
+const (
+	defaultBaseHeight    = 10
+	defaultMaximumHeight = 10
+)
+
 // omniStorage is used to save our data locally.
 type omniStorage struct {
-	// PropTimeout is used when sending the request to integrate a new block
-	// to all nodes.
+	// PropTimeout is not used anymore, the propagation timeout is derived
+	// from the configuration of the skipchains.
 	PropTimeout time.Duration
+	// Quotas of the skipchains, indexed by skipchain ID.
+	Quotas map[string]Quota
+	// Replicas are the skipchains this conode follows as a read replica,
+	// indexed by skipchain ID.
+	Replicas map[string]bool
+	// Disabled are the skipchains this conode stopped serving, indexed by
+	// skipchain ID.
+	Disabled map[string]bool
+	// AdminSkipchain and AdminDarc point to the darc whose signers are
+	// administrators of the conode.
+	AdminSkipchain skipchain.SkipBlockID
+	AdminDarc      darc.ID
 
 	sync.Mutex
 }
 
-type updateCollection struct {
-	ID skipchain.SkipBlockID
-}
-
 // CreateGenesisBlock asks the service to create a new skipchain ready to
 // store key/value pairs. If it is given exactly one writer, this writer will
 // be stored in the skipchain.
@@ -146,6 +219,15 @@ func (s *Service) CreateGenesisBlock(req *CreateGenesisBlock) (
 	if req.BlockInterval == 0 {
 		req.BlockInterval = defaultInterval
 	}
+	if req.BaseHeight == 0 {
+		req.BaseHeight = defaultBaseHeight
+	}
+	if req.MaximumHeight == 0 {
+		req.MaximumHeight = defaultMaximumHeight
+	}
+	if req.BaseHeight < 1 || req.MaximumHeight < 1 {
+		return nil, errors.New("base height and maximum height must be positive")
+	}
 	intervalBuf := make([]byte, 8)
 	binary.PutVarint(intervalBuf, int64(req.BlockInterval))
 
@@ -175,7 +257,7 @@ func (s *Service) CreateGenesisBlock(req *CreateGenesisBlock) (
 		}},
 	}}
 
-	sb, err := s.createNewBlock(nil, &req.Roster, transaction)
+	sb, err := s.createNewBlock(nil, &req.Roster, transaction, nil, nil, 0, req.BaseHeight, req.MaximumHeight)
 	if err != nil {
 		return nil, err
 	}
@@ -191,17 +273,49 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 	if req.Version != CurrentVersion {
 		return nil, errors.New("version mismatch")
 	}
+	if s.shuttingDown() {
+		return nil, ErrShuttingDown
+	}
 
 	if len(req.Transaction.Instructions) == 0 {
 		return nil, errors.New("no transactions to add")
 	}
+	if s.sizeCapped(req.SkipchainID) {
+		if err := checkTxSize(req.Transaction); err != nil {
+			return nil, err
+		}
+	}
 
 	gen := s.db().GetByID(req.SkipchainID)
 	if gen == nil || gen.Index != 0 {
 		return nil, errors.New("skipchain ID is does not exist")
 	}
+	if s.isReplica(req.SkipchainID) {
+		return nil, errors.New("a read replica doesn't accept transactions")
+	}
+	if err := s.checkEnabled(req.SkipchainID); err != nil {
+		return nil, err
+	}
+	if err := s.checkExpiry(req.SkipchainID, req.Transaction); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkTxArguments(req.SkipchainID, req.Transaction); err != nil {
+		return nil, err
+	}
+	if err := s.checkNewNodes(req.SkipchainID, req.Transaction); err != nil {
+		return nil, err
+	}
+	if err := s.checkQuota(req.SkipchainID); err != nil {
+		return nil, err
+	}
+	if err := s.checkOverload(req.SkipchainID); err != nil {
+		return nil, err
+	}
 
 	s.txBuffer.add(string(req.SkipchainID), req.Transaction)
+	l := s.txLog(req.SkipchainID).tx(req.Transaction)
+	log.Lvl3(l.msg("added transaction to the buffer"))
 
 	if req.InclusionWait > 0 {
 		// Wait for InclusionWait new blocks and look if our transaction is in it.
@@ -210,15 +324,37 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 			return nil, errors.New("couldn't get collectionView: " + err.Error())
 		}
 		ctxHash := req.Transaction.Instructions.Hash()
-		ch := s.state.createWaitChannel(ctxHash)
-		defer s.state.deleteWaitChannel(ctxHash)
+		ch, err := s.state.createWaitChannel(ctxHash)
+		if err != nil {
+			log.Lvl2(l.msg(err))
+			return nil, err
+		}
+		defer s.state.deleteWaitChannel(ctxHash, ch)
+		timeout := time.NewTimer(s.state.inclusionWait(req.InclusionWait, interval))
+		defer timeout.Stop()
 		select {
 		case success := <-ch:
 			if !success {
+				if err := s.checkExpiry(req.SkipchainID, req.Transaction); err == ErrTxExpired {
+					log.Lvl2(l.msg("transaction expired before it got in a block"))
+					return nil, err
+				}
+				log.Lvl2(l.msg("transaction is in block, but got refused"))
 				return nil, errors.New("transaction is in block, but got refused")
 			}
-		case <-time.After(time.Duration(req.InclusionWait) * interval):
-			return nil, errors.New("didn't find transaction in blocks")
+		case <-timeout.C:
+			log.Lvl2(l.msgf("didn't find transaction in %d blocks", req.InclusionWait))
+			return nil, ErrInclusionTimeout
+		case <-s.closed:
+			// The last block might hold our transaction.
+			select {
+			case success := <-ch:
+				if !success {
+					return nil, errors.New("transaction is in block, but got refused")
+				}
+			default:
+				return nil, ErrShuttingDown
+			}
 		}
 	}
 	return &AddTxResponse{
@@ -226,37 +362,119 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 	}, nil
 }
 
+// checkNewNodes makes sure that the nodes added to the roster by an
+// update_config instruction of the transaction are reachable. This is done
+// when the transaction is added and not in the contract, because the nodes
+// verifying a block might not get the same answer.
+func (s *Service) checkNewNodes(scID skipchain.SkipBlockID, ct ClientTransaction) error {
+	for _, instr := range ct.Instructions {
+		if instr.Invoke == nil || instr.Invoke.Command != "update_config" {
+			continue
+		}
+		var newConfig ChainConfig
+		err := protobuf.DecodeWithConstructors(instr.Invoke.Args.Search("config"), &newConfig,
+			network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return errors.New("couldn't decode config: " + err.Error())
+		}
+		config, err := s.LoadConfig(scID)
+		if err != nil {
+			return err
+		}
+		for _, si := range newConfig.Roster.List {
+			if i, _ := config.Roster.Search(si.ID); i >= 0 {
+				continue
+			}
+			if _, err := status.NewClient().Request(si); err != nil {
+				return fmt.Errorf("new node %s is not reachable: %v", si, err)
+			}
+		}
+	}
+	return nil
+}
+
 // GetProof searches for a key and returns a proof of the
-// presence or the absence of this key.
+// presence or the absence of this key. The values of instances with a
+// ReadRule are removed from the proof, unless the request is signed by
+// identities satisfying the rule.
 func (s *Service) GetProof(req *GetProof) (resp *GetProofResponse, err error) {
 	if req.Version != CurrentVersion {
 		return nil, errors.New("version mismatch")
 	}
-	log.Lvlf2("%s: Getting proof for key %x on sc %x", s.ServerIdentity(), req.Key, req.ID)
-	latest, err := s.db().GetLatestByID(req.ID)
-	if err != nil && latest == nil {
+	if err = s.checkEnabled(req.ID); err != nil {
 		return
 	}
-	proof, err := NewProof(s.getCollection(req.ID), s.db(), latest.Hash, req.Key)
+	log.Lvlf2("%s: Getting proof for key %x on sc %x", s.ServerIdentity(), req.Key, req.ID)
+	start := time.Now()
+	cdb := s.getCollection(req.ID)
+	proof, err := NewProof(cdb, s.db(), req.ID, req.Key)
 	if err != nil {
 		return
 	}
+	if err = s.redactProof(cdb, req, proof); err != nil {
+		return
+	}
 	resp = &GetProofResponse{
 		Version: CurrentVersion,
 		Proof:   *proof,
 	}
+	// Only the known skipchains are labeled, so that clients can't
+	// create new series.
+	metrics.ProofLatency.WithLabelValues(metrics.Chain(req.ID)).Observe(time.Since(start).Seconds())
 	return
 }
 
-// SetPropagationTimeout overrides the default propagation timeout that is used
-// when a new block is announced to the nodes as well as the skipchain
-// propagation timeout.
-func (s *Service) SetPropagationTimeout(p time.Duration) {
-	s.storage.Lock()
-	s.storage.PropTimeout = p
-	s.storage.Unlock()
-	s.save()
-	s.skService().SetPropTimeout(p)
+// CallView runs a view of the contract of the given instance against the
+// latest collection and returns its result. Views can't change the
+// collection, so no transaction is needed.
+func (s *Service) CallView(req *CallView) (*CallViewResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if s.state.getLast(req.SkipchainID) == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+	if err := s.checkEnabled(req.SkipchainID); err != nil {
+		return nil, err
+	}
+	// The view must see the state of the block it returns, so no block may
+	// be stored in the meantime.
+	cdb := s.getCollection(req.SkipchainID)
+	cdb.blockMut.RLock()
+	defer cdb.blockMut.RUnlock()
+	blockID := s.state.getLast(req.SkipchainID)
+	coll := &roCollection{cdb.coll}
+	_, contractID, err := coll.GetValues(req.InstanceID.Slice())
+	if err != nil {
+		return nil, errors.New("couldn't find instance: " + err.Error())
+	}
+	view, exists := s.views[contractID+"/"+req.View]
+	if !exists {
+		return nil, fmt.Errorf("contract %s has no view %s", contractID, req.View)
+	}
+	log.Lvlf2("%s: Calling view %s of %x", s.ServerIdentity(), req.View, req.InstanceID.Slice())
+	result, err := view(coll, req.InstanceID, req.Args)
+	if err != nil {
+		return nil, err
+	}
+	return &CallViewResponse{
+		Version: CurrentVersion,
+		Result:  result,
+		BlockID: blockID,
+	}, nil
+}
+
+// GetContractRegistry returns the contracts registered on this node with
+// their versions. All nodes of a roster need the same contracts to verify
+// the blocks.
+func (s *Service) GetContractRegistry(req *GetContractRegistry) (*GetContractRegistryResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	return &GetContractRegistryResponse{
+		Version:   CurrentVersion,
+		Contracts: s.contractRegistry(),
+	}, nil
 }
 
 func toInstanceID(dID darc.ID) InstanceID {
@@ -287,43 +505,129 @@ func (s *Service) verifyClientTx(scID skipchain.SkipBlockID, tx ClientTransactio
 	return nil
 }
 
+// verifyInstruction checks the signatures of instr against the latest version
+// of its darc. The darcs and the evaluations of their rules come from the
+// cache of the collection, so the instructions of a block that are governed by
+// the same darc and signed by the same identities are evaluated only once.
 func (s *Service) verifyInstruction(scID skipchain.SkipBlockID, instr Instruction) error {
-	d, err := s.loadLatestDarc(scID, instr.InstanceID.DarcID)
+	cdb := s.getCollection(scID)
+	gen := cdb.auth.generation()
+	dID := instr.InstanceID.DarcID
+	d, err := cdb.auth.darc(toInstanceID(dID).Slice(), func() (*darc.Darc, error) {
+		return s.loadLatestDarc(scID, dID)
+	})
 	if err != nil {
 		return errors.New("darc not found: " + err.Error())
 	}
-	req, err := instr.ToDarcRequest()
+	req, err := instr.ToDarcRequest(scID)
 	if err != nil {
 		return errors.New("couldn't create darc request: " + err.Error())
 	}
 	// Verify the request is signed by appropriate identities.
 	// A callback is required to get any delegated DARC(s) during
 	// expression evaluation.
-	err = req.VerifyWithCB(d, func(str string, latest bool) *darc.Darc {
+	if err = req.VerifySignatures(d); err != nil {
+		return errors.New("request verification failed: " + err.Error())
+	}
+	ids := req.GetIdentityStrings()
+	key := authKey(d, req.Action, ids)
+	ok, err := cdb.auth.lookup(key)
+	if !ok {
+		var foreign bool
+		limits := cdb.auth.darcLimits(func() darc.Limits {
+			return LoadDarcLimits(&roCollection{cdb.coll})
+		})
+		err = darc.EvalExprWithLimits(d.Rules[req.Action], s.cachedDarcGetter(scID, cdb, &foreign, instr.DarcProofs),
+			limits, ids...)
+		if !foreign {
+			cdb.auth.store(gen, key, err)
+		}
+	}
+	if err != nil {
+		return errors.New("request verification failed: " + err.Error())
+	}
+	coll := &roCollection{cdb.coll}
+	for _, sig := range instr.Signatures {
+		if err := s.verifyIdentity(coll, instr, sig.Signer); err != nil {
+			return errors.New("identity verification failed: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// verifyIdentity calls the verifier registered for the type of the identity
+// id, if any. Pop-token identities are refused if there is no verifier,
+// because their signature alone doesn't prove anything.
+func (s *Service) verifyIdentity(coll CollectionView, instr Instruction, id darc.Identity) error {
+	v, exists := s.identityVerifiers[id.TypeString()]
+	if !exists {
+		if id.PoP != nil {
+			return errors.New("no verifier for pop-token identities")
+		}
+		return nil
+	}
+	return v(coll, instr, id)
+}
+
+// darcGetter returns a callback that loads the darcs of delegations from
+// coll. Without proofs, chaindarc identities are never satisfied.
+func (s *Service) darcGetter(coll CollectionView) darc.GetDarc {
+	return NewDarcGetter(coll)
+}
+
+// NewDarcGetter returns the callback the service uses to load the darcs of
+// delegations when it evaluates an expression: from coll, or from the proofs
+// for chaindarc identities. Contracts use it to evaluate their own rules. As
+// the age of the proofs is checked against the chain time, they are only
+// accepted if coll is the CollectionView of a contract.
+func NewDarcGetter(coll CollectionView, proofs ...Proof) darc.GetDarc {
+	var now int64
+	if t, err := ChainTime(coll); err == nil {
+		now = t.UnixNano()
+	}
+	return newDarcGetter(coll, now, proofs)
+}
+
+// newDarcGetter is NewDarcGetter with the chain time now in unix nanoseconds,
+// which the proofs must not be older than darcProofMaxAge from.
+func newDarcGetter(coll CollectionView, now int64, proofs []Proof) darc.GetDarc {
+	return func(str string, latest bool) *darc.Darc {
+		if strings.HasPrefix(str, "chaindarc:") {
+			d, err := loadChainDarc(str, proofs, now)
+			if err != nil {
+				log.Lvl2("couldn't load foreign darc:", err)
+				return nil
+			}
+			return d
+		}
 		darcID, err := hex.DecodeString(str[5:])
 		if err != nil {
 			return nil
 		}
-		d, err := LoadDarcFromColl(s.GetCollectionView(scID), InstanceID{darcID, SubID{}}.Slice())
+		d, err := LoadDarcFromColl(coll, InstanceID{darcID, SubID{}}.Slice())
 		if err != nil {
 			return nil
 		}
 		return d
-	})
-	if err != nil {
-		return errors.New("request verification failed: " + err.Error())
 	}
-	return nil
 }
 
 // createNewBlock creates a new block and proposes it to the
 // skipchain-service. Once the block has been created, we
 // inform all nodes to update their internal collections
-// to include the new transactions.
-func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, cts ClientTransactions) (*skipchain.SkipBlock, error) {
+// to include the new transactions. The base and maximum height
+// are only used for a genesis block, later blocks use the ones of
+// the genesis block.
+// The encrypted transactions enc are ordered in the new block, and the
+// transactions of the previous block that decs decrypt are executed before
+// cts.
+func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, cts ClientTransactions,
+	enc []EncryptedTransaction, decs []TxDecryption, backlog, base, maxHeight int) (*skipchain.SkipBlock, error) {
 	var sb *skipchain.SkipBlock
 	var mr []byte
 	var coll *collection.Collection
+	var decrypted ClientTransactions
+	l := s.txLog(scID)
 
 	if scID.IsNull() {
 		// For a genesis block, we create a throwaway collection.
@@ -331,10 +635,11 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, cts
 		// it.
 		sb = skipchain.NewSkipBlock()
 		sb.Roster = r
-		sb.MaximumHeight = 10
-		sb.BaseHeight = 10
+		sb.MaximumHeight = maxHeight
+		sb.BaseHeight = base
 		// We have to register the verification functions in the genesis block
 		sb.VerifierIDs = []skipchain.VerifierID{skipchain.VerifyBase, verifyOmniLedger}
+		l = l.block(0)
 
 		coll = collection.New(&collection.Data{}, &collection.Data{})
 	} else {
@@ -346,21 +651,26 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, cts
 			return nil, errors.New(
 				"Could not get latest block from the skipchain: " + err.Error())
 		}
-		log.Lvlf3("Creating new block #%d with %d transactions", sbLatest.Index+1,
-			len(cts))
-		sb = sbLatest.Copy()
+		l = l.block(sbLatest.Index + 1)
+		log.Lvl3(l.msgf("creating new block with %d transactions", len(cts)))
+		sb = nextBlock(sbLatest)
 		if r != nil {
 			sb.Roster = r
 		}
 
 		cts = s.verifyAndFilterTxs(sb.SkipChainID(), cts)
-		if len(cts) == 0 {
+		decrypted, err = s.decryptTransactions(sbLatest, decs)
+		if err != nil {
+			return nil, err
+		}
+		if len(cts) == 0 && len(enc) == 0 && len(decs) == 0 {
 			return nil, errors.New("no valid transaction")
 		}
 		coll = s.getCollection(scID).coll
 	}
 
-	// Note that the transactions are sorted in-place.
+	// Note that the transactions are sorted in-place. The decrypted
+	// transactions keep the order of the previous block.
 	if err := sortTransactions(cts); err != nil {
 		return nil, err
 	}
@@ -370,20 +680,37 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, cts
 	var err error
 	var ctsOK ClientTransactions
 
-	log.Lvl3("Creating state changes")
-	mr, ctsOK, scs, err = s.createStateChanges(coll, scID, cts)
+	log.Lvl3(l.msg("creating state changes"))
+	now := s.clock.get().Now().UnixNano()
+	mr, ctsOK, scs, _, err = s.createBlockStateChanges(coll, scID, append(decrypted, cts...),
+		&blockInfo{index: sb.Index, timestamp: now})
 
 	if err != nil {
 		return nil, err
 	}
-	if len(scs) == 0 {
+	if txStateChanges(scs) == 0 && len(enc) == 0 && len(decs) == 0 {
 		return nil, errors.New("no state changes")
 	}
+	// The decrypted transactions are not stored, they are in the previous
+	// block.
+	body := &DataBody{
+		Transactions:          ctsOK[countDecrypted(decrypted, ctsOK):],
+		EncryptedTransactions: enc,
+		Decryptions:           decs,
+	}
+	encHash, err := encryptedHash(body)
+	if err != nil {
+		return nil, err
+	}
 	header := &DataHeader{
 		CollectionRoot:        mr,
-		ClientTransactionHash: ctsOK.Hash(),
+		ClientTransactionHash: body.Transactions.Hash(),
 		StateChangesHash:      scs.Hash(),
-		Timestamp:             time.Now().Unix(),
+		Timestamp:             now / int64(time.Second),
+		EncryptedHash:         encHash,
+		Backlog:               backlog,
+		Versions:              s.nodeVersions.list(scID, sb.Roster, s.ServerIdentity()),
+		TimestampNano:         now,
 	}
 	sb.Data, err = network.Marshal(header)
 	if err != nil {
@@ -391,112 +718,129 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, cts
 	}
 
 	// Store transactions in the body
-	body := &DataBody{Transactions: ctsOK}
-	sb.Payload, err = network.Marshal(body)
+	sb.Payload, err = encodeBody(body, s.sizeCapped(scID))
 	if err != nil {
 		return nil, errors.New("Couldn't marshal data: " + err.Error())
 	}
+	if corrupt := s.faults.get().CorruptBlock; corrupt != nil && !scID.IsNull() {
+		log.Lvl2(l.msg("corrupting the new block"))
+		corrupt(sb)
+	}
 
 	var ssb = skipchain.StoreSkipBlock{
 		NewBlock:          sb,
 		TargetSkipChainID: scID,
 	}
-	log.Lvlf3("Storing skipblock with %d transactions.", len(ctsOK))
+	for _, ct := range ctsOK {
+		log.Lvl3(l.tx(ct).msg("proposing transaction"))
+	}
+	log.Lvl3(l.msgf("storing skipblock with %d transactions", len(ctsOK)))
+	// Every node updates its collection in updateCollection, which the
+	// skipchain service calls before the propagation of the block returns.
 	ssbReply, err := s.skService().StoreSkipBlock(&ssb)
 	if err != nil {
 		return nil, err
 	}
-
-	s.storage.Lock()
-	pto := s.storage.PropTimeout
-	s.storage.Unlock()
-	// TODO: replace this with some kind of callback from the skipchain-service
-	log.Lvl3("Asking all nodes to update their collections")
-	replies, err := s.propagateTransactions(sb.Roster, &updateCollection{sb.Hash}, pto)
-	if err != nil {
-		log.Lvl1("Propagation-error:", err.Error())
-	}
-	if replies != len(sb.Roster.List) {
-		log.Lvlf1("%s: only got %d out of %d for block %x", s.ServerIdentity(), replies, len(sb.Roster.List), sb.Hash)
-	}
-	log.Lvl3("All nodes have the latest transactions stored")
 	return ssbReply.Latest, nil
 }
 
-// updateCollection is called once a skipblock has been stored.
-// It is called by the leader, and every node will add the
-// transactions in the block to its collection.
-func (s *Service) updateCollection(msg network.Message) {
-	uc, ok := msg.(*updateCollection)
-	if !ok {
-		log.Error("updateCollection cast failure")
-		return
-	}
-
-	sb, err := s.db().GetLatestByID(uc.ID)
-	if err != nil {
-		log.Errorf("didn't find latest block for %x", uc.ID)
-		return
-	}
+// updateCollection is called by the skipchain service once a skipblock of an
+// omniledger skipchain has been stored. Every node will add the transactions
+// in the block to its collection.
+func (s *Service) updateCollection(sb *skipchain.SkipBlock) error {
 	_, dataI, err := network.Unmarshal(sb.Data, cothority.Suite)
 	data, ok := dataI.(*DataHeader)
 	if err != nil || !ok {
-		log.Error("couldn't unmarshal header")
-		return
+		return errors.New("couldn't unmarshal header")
 	}
-	_, bodyI, err := network.Unmarshal(sb.Payload, cothority.Suite)
-	body, ok := bodyI.(*DataBody)
-	if err != nil || !ok {
-		log.Error("couldn't unmarshal body", err, ok)
-		return
+	body, err := decodeBody(sb)
+	if err != nil {
+		return err
 	}
 
-	log.Lvlf2("%s: Updating transactions for %x", s.ServerIdentity(), sb.SkipChainID())
+	l := s.txLog(sb.SkipChainID()).block(sb.Index)
+	log.Lvl2(l.msg("updating transactions"))
 	cdb := s.getCollection(sb.SkipChainID())
-	_, _, scs, err := s.createStateChanges(cdb.coll, sb.SkipChainID(), body.Transactions)
+	cts, err := s.blockTransactions(sb, body)
 	if err != nil {
-		log.Error("Couldn't recreate state changes:", err.Error())
-		return
+		return errors.New("couldn't decrypt transactions: " + err.Error())
+	}
+	_, _, scs, events, err := s.createBlockStateChanges(cdb.coll, sb.SkipChainID(), cts,
+		&blockInfo{index: sb.Index, timestamp: data.UnixNano()})
+	if err != nil {
+		return errors.New("couldn't recreate state changes: " + err.Error())
 	}
 
-	log.Lvlf3("%s: Storing %d state changes %v", s.ServerIdentity(), len(scs), scs.ShortStrings())
+	log.Lvl3(l.msgf("storing %d state changes %v", len(scs), scs.ShortStrings()))
+	cdb.blockMut.Lock()
 	for _, sc := range scs {
 		err = cdb.Store(&sc)
 		if err != nil {
-			log.Error("error while storing in collection: " + err.Error())
+			log.Error(l.msg("error while storing in collection:", err))
 		}
 	}
+	if err = hashValuesIfActive(cdb.coll); err != nil {
+		log.Error(l.msg("couldn't hash the values of the collection:", err))
+	}
 	if !bytes.Equal(cdb.RootHash(), data.CollectionRoot) {
-		log.Error("hash of collection doesn't correspond to root hash")
+		log.Error(l.msg("hash of collection doesn't correspond to root hash"))
 	}
 	s.state.setLast(sb)
+	cdb.blockMut.Unlock()
+	for _, ct := range cts {
+		for _, instr := range ct.Instructions {
+			if instr.Invoke != nil && instr.Invoke.Command == "view_change" {
+				s.state.addViewChange(sb.SkipChainID())
+			}
+		}
+	}
+
+	if len(events) > 0 {
+		log.Lvl3(l.msgf("storing %d events", len(events)))
+		if err := s.getEventDB(sb.SkipChainID()).store(sb, events); err != nil {
+			log.Error(l.msg("couldn't store events:", err))
+		}
+		s.subscriptions.notify(sb, events)
+	}
 
 	// Send OK to all waiting channels
 	for _, ct := range body.Transactions {
+		log.Lvl3(l.tx(ct).msg("transaction is in the block"))
 		s.state.informWaitChannel(ct.Instructions.Hash(), true)
 	}
+	// The buffer drops the transactions that can't be in the next block.
+	for _, ct := range s.txBuffer.dropExpired(string(sb.SkipChainID()), sb.Index+1, data.UnixNano()) {
+		log.Lvl3(l.tx(ct).msg("dropping expired transaction"))
+		s.state.informWaitChannel(ct.Instructions.Hash(), false)
+	}
+	metrics.Transactions.WithLabelValues(metrics.Chain(sb.SkipChainID())).Add(float64(len(body.Transactions)))
+	if err := s.measureUsage(sb.SkipChainID()); err != nil {
+		log.Error(l.msg("couldn't measure the usage of the quota:", err))
+	}
+	if err := s.loadPropagationTimeout(sb.SkipChainID()); err != nil {
+		log.Error(l.msg("couldn't load the propagation timeout:", err))
+	}
 
 	// check whether the heartbeat monitor exists, if it doesn't we start a
 	// new one
 	interval, err := s.LoadBlockInterval(sb.SkipChainID())
 	if err != nil {
-		log.Error(s.ServerIdentity(), err)
-		return
+		return err
 	}
 	if s.heartbeats.enabled() && sb.Index == 0 {
 		if s.heartbeats.exists(string(sb.SkipChainID())) {
 			panic("This is a new genesis block, but we're already running " +
 				"the heartbeat monitor, it should never happen.")
 		}
-		log.Lvlf2("%s: started heartbeat monitor for %x", s.ServerIdentity(), sb.SkipChainID())
+		log.Lvl2(l.msg("started heartbeat monitor"))
 		s.heartbeats.start(string(sb.SkipChainID()), interval*rotationWindow, s.heartbeatsTimeout)
 	}
 
 	// if we are the new leader, then start polling
-	if sb.Roster.List[0].Equal(s.ServerIdentity()) {
+	if sb.Roster.List[0].Equal(s.ServerIdentity()) && !s.shuttingDown() {
 		s.pollChanMut.Lock()
 		if _, ok := s.pollChan[string(sb.SkipChainID())]; !ok {
-			log.Lvlf2("%s: new leader started polling for %x", s.ServerIdentity(), sb.SkipChainID())
+			log.Lvl2(l.msg("new leader started polling"))
 			s.pollChanWG.Add(1)
 			s.pollChan[string(sb.SkipChainID())] = s.startPolling(sb.SkipChainID(), interval)
 		}
@@ -509,13 +853,13 @@ func (s *Service) updateCollection(msg network.Message) {
 		// the information should already be in the collections
 		d, err := s.LoadGenesisDarc(sb.SkipChainID())
 		if err != nil {
-			log.Error(err)
-			return
+			return err
 		}
 		s.darcToScMut.Lock()
 		s.darcToSc[string(d.GetBaseID())] = sb.SkipChainID()
 		s.darcToScMut.Unlock()
 	}
+	return nil
 }
 
 // GetCollectionView returns a read-only accessor to the collection
@@ -596,151 +940,398 @@ func (s *Service) loadLatestDarc(scID skipchain.SkipBlockID, dID darc.ID) (*darc
 	return darc.NewFromProtobuf(value)
 }
 
+// darcProofMaxAge is how much older than the chain time the latest block of
+// a proof of a foreign darc can be. A foreign darc that has been evolved, for
+// example to revoke an identity, can't be replayed after this time.
+const darcProofMaxAge = time.Hour
+
+// loadChainDarc returns the darc of another skipchain that the chaindarc
+// identity str points to, from the proof for it in proofs. The proof is
+// verified from the genesis block of the other skipchain, whose ID is part of
+// the identity, so that all the nodes take the same decision without
+// contacting the other skipchain. The darc is only as recent as the proof
+// given by the client, so the latest block of the proof must not be older
+// than darcProofMaxAge from the chain time now, in unix nanoseconds.
+func loadChainDarc(str string, proofs []Proof, now int64) (*darc.Darc, error) {
+	if now == 0 {
+		return nil, errors.New("the age of the proofs of foreign darcs is only known within a block")
+	}
+	idc, err := darc.ParseIdentityChainDarc(str)
+	if err != nil {
+		return nil, err
+	}
+	scID := skipchain.SkipBlockID(idc.SkipchainID)
+	key := toInstanceID(idc.BaseID).Slice()
+	for _, p := range proofs {
+		if !p.Chain.GenesisID.Equal(scID) || !bytes.Equal(p.InclusionProof.Key, key) {
+			continue
+		}
+		if p.Redacted {
+			return nil, errors.New("proof of foreign darc is redacted")
+		}
+		if err = p.Verify(scID); err != nil {
+			return nil, err
+		}
+		_, headerI, err := network.Unmarshal(p.Latest.Data, cothority.Suite)
+		header, ok := headerI.(*DataHeader)
+		if err != nil || !ok {
+			return nil, errors.New("couldn't unmarshal header of the proof")
+		}
+		if now-header.UnixNano() > int64(darcProofMaxAge) {
+			return nil, errors.New("proof of foreign darc is too old")
+		}
+		if !p.InclusionProof.Match() {
+			return nil, errors.New("foreign darc not found")
+		}
+		_, vs, err := p.KeyValue()
+		if err != nil {
+			return nil, err
+		}
+		if len(vs) < 2 {
+			return nil, errors.New("not enough values in proof")
+		}
+		if string(vs[1]) != "darc" {
+			return nil, errors.New("expected contract to be darc but got: " + string(vs[1]))
+		}
+		return darc.NewFromProtobuf(vs[0])
+	}
+	return nil, fmt.Errorf("no proof for darc %x of skipchain %x", idc.BaseID, idc.SkipchainID)
+}
+
 func (s *Service) startPolling(scID skipchain.SkipBlockID, interval time.Duration) chan bool {
 	closeSignal := make(chan bool)
 	go func() {
 		defer s.pollChanWG.Done()
 		var txs ClientTransactions
+		var stop bool
+		var overloaded int
+		trigger := s.triggers.get(scID)
 		for {
+			var done chan bool
 			select {
-			case <-time.After(interval):
-				sb, err := s.db().GetLatestByID(scID)
-				if err != nil {
-					panic("DB is in bad state and cannot find skipchain anymore: " + err.Error() +
-						" This function should never be called on a skipchain that does not exist.")
-				}
-
-				log.Lvl3("Starting new block", sb.Index+1)
-				leader, err := s.getLeader(scID)
-				if err != nil {
-					panic("getLeader should not return an error if roster is initialised.")
-				}
-				if !leader.Equal(s.ServerIdentity()) {
-					panic("startPolling should always be called by the leader," +
-						" if it isn't, then it did not start or shutdown properly.")
+			case <-s.clock.get().After(interval):
+			case done = <-trigger:
+			case <-closeSignal:
+				if s.shuttingDown() {
+					s.drainBlocks(scID, interval, txs)
 				}
-				tree := sb.Roster.GenerateNaryTree(len(sb.Roster.List))
+				log.Lvl2(s.txLog(scID).msg("stopping polling"))
+				return
+			}
+			txs, stop = s.pollBlock(scID, interval, txs, closeSignal)
+			if done != nil {
+				close(done)
+			}
+			if stop {
+				return
+			}
+			// Transactions left for the next block mean that the
+			// leader couldn't process them in time.
+			if len(txs) == 0 {
+				overloaded = 0
+				continue
+			}
+			overloaded++
+			if s.overloadHandOff > 0 && overloaded >= s.overloadHandOff {
+				s.handOff(scID, closeSignal, txs)
+				return
+			}
+		}
+	}()
+	return closeSignal
+}
 
-				proto, err := s.CreateProtocol(collectTxProtocol, tree)
-				if err != nil {
-					panic("Protocol creation failed with error: " + err.Error() +
-						" This panic indicates that there is most likely a programmer error," +
-						" e.g., the protocol does not exist." +
-						" Hence, we cannot recover from this failure without putting" +
-						" the server in a strange state, so we panic.")
-				}
-				root := proto.(*CollectTxProtocol)
-				root.SkipchainID = scID
-				if err := root.Start(); err != nil {
-					panic("Failed to start the protocol with error: " + err.Error() +
-						" Start() only returns an error when the protocol is not initialised correctly," +
-						" e.g., not all the required fields are set." +
-						" If you see this message then there may be a programmer error.")
-				}
+// pollBlock collects the transactions of the roster and creates a new block
+// with the transactions that fit in half of the block interval. It returns
+// the transactions that didn't fit, and true if closeSignal has been closed
+// while collecting. During a shutdown, closeSignal is ignored so that the
+// block is finished.
+func (s *Service) pollBlock(scID skipchain.SkipBlockID, interval time.Duration, txs ClientTransactions,
+	closeSignal chan bool) (ClientTransactions, bool) {
+	sb, err := s.db().GetLatestByID(scID)
+	if err != nil {
+		panic("DB is in bad state and cannot find skipchain anymore: " + err.Error() +
+			" This function should never be called on a skipchain that does not exist.")
+	}
 
-				// When we poll, the child nodes must reply within half of the block interval,
-				// because we'll use the other half to process the transactions.
-				protocolTimeout := time.After(interval / 2)
-			collectTxLoop:
-				for {
-					select {
-					case newTxs, more := <-root.TxsChan:
-						if more {
-							txs = append(txs, newTxs...)
-						} else {
-							break collectTxLoop
-						}
-					case <-protocolTimeout:
-						log.Lvl2(s.ServerIdentity(), "timeout while collecting transactions from other nodes")
-						close(root.Finish)
-						break collectTxLoop
-					case <-closeSignal:
-						log.Lvl2(s.ServerIdentity(), "stopping polling")
-						close(root.Finish)
-						return
-					}
-				}
-				log.Lvl3("Collected all new transactions:", len(txs))
+	l := s.txLog(scID).block(sb.Index + 1)
+	log.Lvl3(l.msg("starting new block"))
+	leader, err := s.getLeader(scID)
+	if err != nil {
+		panic("getLeader should not return an error if roster is initialised.")
+	}
+	if !leader.Equal(s.ServerIdentity()) {
+		panic("startPolling should always be called by the leader," +
+			" if it isn't, then it did not start or shutdown properly.")
+	}
+	if s.crashAt(scID, StageCollect) {
+		return txs, true
+	}
+	if !s.chainEnabled(scID) {
+		log.Lvl3(l.msg("the skipchain is disabled, not creating a block"))
+		return txs, false
+	}
+	tree := sb.Roster.GenerateNaryTree(len(sb.Roster.List))
 
-				if txs.IsEmpty() {
-					log.Lvl3(s.ServerIdentity(), "no new transactions, not creating new block")
-					continue
-				}
+	proto, err := s.CreateProtocol(collectTxProtocol, tree)
+	if err != nil {
+		panic("Protocol creation failed with error: " + err.Error() +
+			" This panic indicates that there is most likely a programmer error," +
+			" e.g., the protocol does not exist." +
+			" Hence, we cannot recover from this failure without putting" +
+			" the server in a strange state, so we panic.")
+	}
+	root := proto.(*CollectTxProtocol)
+	root.SkipchainID = scID
+	s.nodeVersions.clear(scID)
+	root.OnVersion = func(si *network.ServerIdentity, version int) {
+		s.nodeVersions.set(scID, si, version)
+	}
+	if err := root.Start(); err != nil {
+		panic("Failed to start the protocol with error: " + err.Error() +
+			" Start() only returns an error when the protocol is not initialised correctly," +
+			" e.g., not all the required fields are set." +
+			" If you see this message then there may be a programmer error.")
+	}
+
+	// When we poll, the child nodes must reply within the protocol timeout,
+	// by default half of the block interval, because we'll use the other
+	// half to process the transactions.
+	timeout := s.loadProtocolTimeout(scID, interval)
+	protocolTimeout := s.clock.get().After(timeout)
+collectTxLoop:
+	for {
+		select {
+		case newTxs, more := <-root.TxsChan:
+			if more {
+				txs = append(txs, newTxs...)
+			} else {
+				break collectTxLoop
+			}
+		case <-protocolTimeout:
+			log.Lvl2(l.msg("timeout while collecting transactions from other nodes"))
+			metrics.ProtocolFailures.WithLabelValues(collectTxProtocol).Inc()
+			close(root.Finish)
+			break collectTxLoop
+		case <-closeSignal:
+			if s.shuttingDown() {
+				// Finish the block, it is the last one.
+				closeSignal = nil
+				continue
+			}
+			log.Lvl2(l.msg("stopping polling"))
+			close(root.Finish)
+			return txs, true
+		}
+	}
+	log.Lvl3(l.msg("collected all new transactions:", len(txs)))
+	txs = s.dropExpired(scID, txs, sb.Index+1, s.chainTime(scID))
 
-				// Pre-run transactions to look how many we can fit in the alloted time
-				// slot. Perhaps we can run this in parallel during the wait-phase?
-				log.Lvl3("Counting how many transactions fit in", interval/2)
-				var txsCollect ClientTransactions
-				cdbI := s.GetCollectionView(scID)
-				now := time.Now()
-				for len(txs) > 0 {
-					if err := s.verifyClientTx(scID, txs[0]); err == nil {
-						var cin []Coin
-						for _, instr := range txs[0].Instructions {
-							_, cin, err = s.executeInstruction(cdbI, cin, instr)
-							if err != nil {
-								continue
-							}
-						}
-						if time.Now().Sub(now) < interval/2 {
-							txsCollect = append(txsCollect, txs[0])
-							txs = txs[1:]
-						} else {
-							log.Lvlf3("Got more transactions than what I can do in half the blockInterval. "+
-								"%d transactions left", len(txs))
-							break
-						}
-					} else {
-						log.Lvl3("Removing badly signed transaction")
-						txs = txs[1:]
-					}
-				}
-				_, err = s.createNewBlock(scID, sb.Roster, txsCollect)
+	// The encrypted transactions of the latest block are
+	// decrypted now that their order is fixed. The next block
+	// must hold the decryptions, so if the roster doesn't give
+	// enough shares, no block is created and the leader tries
+	// again at the next round.
+	decs, err := s.collectDecryptions(sb, timeout)
+	if err != nil {
+		log.Error(l.msg("couldn't decrypt transactions:", err))
+		return txs, false
+	}
+	encTxs := s.encTxBuffer.take(string(scID))
+
+	if txs.IsEmpty() && len(encTxs) == 0 && len(decs) == 0 {
+		log.Lvl3(l.msg("no new transactions, not creating new block"))
+		return txs, false
+	}
+
+	// Pre-run transactions to look how many we can fit in the alloted time
+	// slot. Perhaps we can run this in parallel during the wait-phase?
+	log.Lvl3(l.msg("counting how many transactions fit in", interval/2))
+	var txsCollect ClientTransactions
+	cdbI := s.GetCollectionView(scID)
+	now := s.clock.get().Now()
+	for len(txs) > 0 {
+		if err := s.verifyClientTx(scID, txs[0]); err == nil {
+			var cin []Coin
+			for _, instr := range txs[0].Instructions {
+				_, cin, err = s.executeInstruction(cdbI, cin, instr)
 				if err != nil {
-					log.Error("couldn't create new block: " + err.Error())
+					continue
 				}
-			case <-closeSignal:
-				log.Lvl2(s.ServerIdentity(), "stopping polling")
-				return
 			}
+			if s.clock.get().Now().Sub(now) < interval/2 {
+				txsCollect = append(txsCollect, txs[0])
+				txs = txs[1:]
+			} else {
+				log.Lvl3(l.msgf("got more transactions than what I can do in half the blockInterval, "+
+					"%d transactions left", len(txs)))
+				break
+			}
+		} else {
+			log.Lvl3(l.tx(txs[0]).msg("removing badly signed transaction"))
+			txs = txs[1:]
 		}
-	}()
-	return closeSignal
+	}
+	if len(txs) > maxBacklog {
+		log.Error(l.msgf("dropping %d transactions over the backlog", len(txs)-maxBacklog))
+		txs = txs[:maxBacklog]
+	}
+	if s.crashAt(scID, StageCreate) {
+		return txs, true
+	}
+	_, err = s.createNewBlock(scID, sb.Roster, txsCollect, encTxs, decs, len(txs), 0, 0)
+	if err != nil {
+		log.Error(l.msg("couldn't create new block:", err))
+		s.encTxBuffer.add(string(scID), encTxs...)
+	}
+	if s.crashAt(scID, StageStored) {
+		return txs, true
+	}
+	return txs, false
+}
+
+// verifyBlock is the verification function of the omniledger skipchains. It
+// is registered as a genesis verification, so the skipchain service calls it
+// on the genesis blocks, too.
+func (s *Service) verifyBlock(newID []byte, newSB *skipchain.SkipBlock) bool {
+	if newSB.Index == 0 {
+		return s.verifyGenesisBlock(newSB)
+	}
+	return s.verifySkipBlock(newID, newSB)
+}
+
+// verifyGenesisBlock executes the transactions of a genesis block in an empty
+// collection, like createNewBlock does, and checks that they lead to the
+// state of the header and to a config with the roster of the block.
+func (s *Service) verifyGenesisBlock(sb *skipchain.SkipBlock) bool {
+	l := s.txLog(nil).block(0)
+	_, headerI, err := network.Unmarshal(sb.Data, cothority.Suite)
+	header, ok := headerI.(*DataHeader)
+	if err != nil || !ok {
+		log.Error(l.msg("couldn't unmarshal header"))
+		return false
+	}
+	body, err := decodeBody(sb)
+	if err != nil {
+		log.Error(l.msg(err))
+		return false
+	}
+	if len(body.EncryptedTransactions) > 0 || len(body.Decryptions) > 0 {
+		log.Lvl2(l.msg("genesis block with encrypted transactions"))
+		return false
+	}
+	encHash, err := encryptedHash(body)
+	if err != nil || !bytes.Equal(header.EncryptedHash, encHash) {
+		log.Lvl2(l.msg("Encrypted transactions hash doesn't verify"))
+		return false
+	}
+	if !bytes.Equal(header.ClientTransactionHash, body.Transactions.Hash()) {
+		log.Lvl2(l.msg("Client Transaction Hash doesn't verify"))
+		return false
+	}
+	coll := collection.New(&collection.Data{}, &collection.Data{})
+	mtr, ctsOK, scs, _, err := s.createBlockStateChanges(coll, nil, body.Transactions,
+		&blockInfo{index: 0, timestamp: header.UnixNano()})
+	if err != nil {
+		log.Error(l.msg("Couldn't create state changes:", err))
+		return false
+	}
+	if len(ctsOK) != len(body.Transactions) {
+		log.Lvl2(l.msg("genesis block with invalid transactions"))
+		return false
+	}
+	if !bytes.Equal(header.CollectionRoot, mtr) {
+		log.Lvl2(l.msg("Collection root doesn't verify"))
+		return false
+	}
+	if !bytes.Equal(header.StateChangesHash, scs.Hash()) {
+		log.Lvl2(l.msg("State Changes hash doesn't verify"))
+		return false
+	}
+	for _, sc := range scs {
+		if err := storeInColl(coll, &sc); err != nil {
+			log.Error(l.msg(err))
+			return false
+		}
+	}
+	config, err := LoadConfigFromColl(&roCollection{coll})
+	if err != nil {
+		log.Error(l.msg(err))
+		return false
+	}
+	if !config.Roster.ID.Equal(sb.Roster.ID) || len(config.Roster.List) != len(sb.Roster.List) {
+		log.Error(l.msg("rosters have unequal IDs"))
+		return false
+	}
+	for i := range config.Roster.List {
+		if !sb.Roster.List[i].Equal(config.Roster.List[i]) {
+			log.Error(l.msg("roster in config is not equal to the one in skipblock"))
+			return false
+		}
+	}
+	return true
 }
 
 // We use the OmniLedger as a receiver (as is done in the identity service),
 // so we can access e.g. the collectionDBs of the service.
 func (s *Service) verifySkipBlock(newID []byte, newSB *skipchain.SkipBlock) bool {
+	l := s.txLog(newSB.SkipChainID()).block(newSB.Index)
 	_, headerI, err := network.Unmarshal(newSB.Data, cothority.Suite)
 	header, ok := headerI.(*DataHeader)
 	if err != nil || !ok {
-		log.Errorf("couldn't unmarshal header")
+		log.Error(l.msg("couldn't unmarshal header"))
 		return false
 	}
-	_, bodyI, err := network.Unmarshal(newSB.Payload, cothority.Suite)
-	body, ok := bodyI.(*DataBody)
-	if err != nil || !ok {
-		log.Error("couldn't unmarshal body", err, ok)
+	decode := decodeBody
+	if s.sizeCapped(newSB.SkipChainID()) {
+		decode = decodeNewBody
+	}
+	body, err := decode(newSB)
+	if err != nil {
+		log.Error(l.msg(err))
+		return false
+	}
+	log.Lvl3(l.msgf("verifying block with %d transactions", len(body.Transactions)))
+	if !s.chainEnabled(newSB.SkipChainID()) {
+		log.Lvl2(l.msg("the skipchain is disabled, refusing to sign"))
 		return false
 	}
 
 	if bytes.Compare(header.ClientTransactionHash, body.Transactions.Hash()) != 0 {
-		log.Lvl2(s.ServerIdentity(), "Client Transaction Hash doesn't verify")
+		log.Lvl2(l.msg("Client Transaction Hash doesn't verify"))
+		return false
+	}
+	encHash, err := encryptedHash(body)
+	if err != nil || !bytes.Equal(header.EncryptedHash, encHash) {
+		log.Lvl2(l.msg("Encrypted transactions hash doesn't verify"))
+		return false
+	}
+	ctx, err := s.blockTransactions(newSB, body)
+	if err != nil {
+		log.Lvl2(l.msg("Couldn't decrypt transactions:", err))
 		return false
 	}
-	ctx := body.Transactions
 	cdb := s.getCollection(newSB.SkipChainID())
-	mtr, _, scs, err := s.createStateChanges(cdb.coll, newSB.SkipChainID(), ctx)
+	if err := s.checkContracts(cdb, ctx); err != nil {
+		log.Error(l.msg("can't verify block:", err))
+		return false
+	}
+	mtr, _, scs, _, err := s.createBlockStateChanges(cdb.coll, newSB.SkipChainID(), ctx,
+		&blockInfo{index: newSB.Index, timestamp: header.UnixNano()})
 	if err != nil {
-		log.Error("Couldn't create state changes:", err)
+		log.Error(l.msg("Couldn't create state changes:", err))
 		return false
 	}
 	if bytes.Compare(header.CollectionRoot, mtr) != 0 {
-		log.Lvl2(s.ServerIdentity(), "Collection root doesn't verify")
+		log.Lvl2(l.msg("Collection root doesn't verify"))
 		return false
 	}
 	if bytes.Compare(header.StateChangesHash, scs.Hash()) != 0 {
-		log.Lvl2(s.ServerIdentity(), "State Changes hash doesn't verify")
+		log.Lvl2(l.msg("State Changes hash doesn't verify"))
+		return false
+	}
+	if err := s.verifyVersions(cdb, newSB, header); err != nil {
+		log.Error(l.msg(err))
 		return false
 	}
 
@@ -749,22 +1340,22 @@ func (s *Service) verifySkipBlock(newID []byte, newSB *skipchain.SkipBlock) bool
 	collClone := s.getCollection(newSB.SkipChainID()).coll.Clone()
 	for _, sc := range scs {
 		if err := storeInColl(collClone, &sc); err != nil {
-			log.Error(err)
+			log.Error(l.msg(err))
 			return false
 		}
 	}
 	config, err := LoadConfigFromColl(&roCollection{collClone})
 	if err != nil {
-		log.Error(err)
+		log.Error(l.msg(err))
 		return false
 	}
 	if !config.Roster.ID.Equal(newSB.Roster.ID) {
-		log.Error("rosters have unequal IDs")
+		log.Error(l.msg("rosters have unequal IDs"))
 		return false
 	}
 	for i := range config.Roster.List {
 		if !newSB.Roster.List[i].Equal(config.Roster.List[i]) {
-			log.Error("roster in config is not equal to the one in skipblock")
+			log.Error(l.msg("roster in config is not equal to the one in skipblock"))
 			return false
 		}
 	}
@@ -774,48 +1365,142 @@ func (s *Service) verifySkipBlock(newID []byte, newSB *skipchain.SkipBlock) bool
 // createStateChanges goes through all ClientTransactions and creates
 // the appropriate StateChanges. If any of the transactions are invalid,
 // it returns an error.
-func (s *Service) createStateChanges(coll *collection.Collection, scID skipchain.SkipBlockID, cts ClientTransactions) (merkleRoot []byte, ctsOK ClientTransactions, states StateChanges, err error) {
+// The events emitted by the contracts of the valid transactions are
+// returned, too.
+func (s *Service) createStateChanges(coll *collection.Collection, scID skipchain.SkipBlockID, cts ClientTransactions) (merkleRoot []byte, ctsOK ClientTransactions, states StateChanges, events []Event, err error) {
+	return s.createBlockStateChanges(coll, scID, cts, nil)
+}
+
+// createBlockStateChanges is like createStateChanges, but once the
+// transactions are executed, it updates the chain time instance with the
+// block b, if the skipchain activated it.
+func (s *Service) createBlockStateChanges(coll *collection.Collection, scID skipchain.SkipBlockID, cts ClientTransactions,
+	b *blockInfo) (merkleRoot []byte, ctsOK ClientTransactions, states StateChanges, events []Event, err error) {
 
 	// TODO: Because we depend on making at least one clone per transaction
 	// we need to find out if this is as expensive as it looks, and if so if
 	// we could use some kind of copy-on-write technique.
 
 	cdbTemp := coll.Clone()
+	chainTime := s.chainTimeOf(&roCollection{cdbTemp}, scID)
+	blockIndex := -1
+	if b != nil {
+		blockIndex = b.index
+	}
+	l := s.txLog(scID)
 	var cin []Coin
 clientTransactions:
 	for _, ct := range cts {
+		if b != nil && ct.Expired(b.index, chainTime) {
+			log.Lvl2(l.tx(ct).msg("transaction expired"))
+			continue
+		}
 		// Make a new collection for each instruction. If the instruction is sucessfully
 		// implemented and changes applied, then keep it (via cdbTemp = cdbI.c),
 		// otherwise dump it.
 		cdbI := &roCollection{cdbTemp.Clone()}
+		var ctEvents []Event
 		for _, instr := range ct.Instructions {
-			scs, cout, err := s.executeInstruction(cdbI, cin, instr)
+			scs, cout, instrEvents, err := s.executeInstructionAt(cdbI, cin, instr, 0, blockIndex, chainTime)
 			if err != nil {
-				log.Errorf("%s: Call to contract returned error: %s", s.ServerIdentity(), err)
+				log.Error(l.tx(ct).msg("Call to contract returned error:", err))
 				continue clientTransactions
 			}
 			for _, sc := range scs {
 				if err := storeInColl(cdbI.c, &sc); err != nil {
-					log.Error("failed to add to collections with error: " + err.Error())
+					log.Error(l.tx(ct).msg("failed to add to collections with error:", err))
 					continue clientTransactions
 				}
 			}
 			states = append(states, scs...)
+			ctEvents = append(ctEvents, instrEvents...)
 			cin = cout
 		}
 		cdbTemp = cdbI.c
 		ctsOK = append(ctsOK, ct)
+		events = append(events, ctEvents...)
+	}
+	if b != nil {
+		var sc *StateChange
+		sc, err = chainTimeChange(&roCollection{cdbTemp}, b)
+		if err != nil {
+			return
+		}
+		if sc != nil {
+			if err = storeInColl(cdbTemp, sc); err != nil {
+				return
+			}
+			states = append(states, *sc)
+		}
+	}
+	if err = hashValuesIfActive(cdbTemp); err != nil {
+		return
+	}
+	return cdbTemp.GetRoot(), ctsOK, states, events, nil
+}
+
+// chainTime returns the chain time at which the next block of the skipchain
+// scID is executed, which is the same on all nodes.
+func (s *Service) chainTime(scID skipchain.SkipBlockID) int64 {
+	return s.chainTimeOf(s.GetCollectionView(scID), scID)
+}
+
+// chainTimeOf returns the timestamp of the chain time instance of coll once
+// the skipchain activated chainTimeVersion. Before, it returns the timestamp
+// of the last block of the skipchain scID. The genesis block is executed at
+// chain time 0.
+func (s *Service) chainTimeOf(coll CollectionView, scID skipchain.SkipBlockID) int64 {
+	if ts, ok := storedChainTime(coll); ok {
+		return ts
+	}
+	id := s.state.getLast(scID)
+	if id == nil {
+		return 0
+	}
+	sb := s.db().GetByID(id)
+	if sb == nil {
+		return 0
+	}
+	_, headerI, err := network.Unmarshal(sb.Data, cothority.Suite)
+	header, ok := headerI.(*DataHeader)
+	if err != nil || !ok {
+		log.Error("couldn't unmarshal header of last block")
+		return 0
+	}
+	return header.UnixNano()
+}
+
+func (s *Service) executeInstruction(cdbI CollectionView, cin []Coin, instr Instruction) (StateChanges, []Coin, error) {
+	scs, cout, _, err := s.executeInstructionEvents(cdbI, cin, instr)
+	return scs, cout, err
+}
+
+// executeInstructionEvents is like executeInstruction, but also returns the
+// events emitted by the contract. If cdbI is the view of a contract, instr is
+// executed one level deeper, in the same block and at the same chain time.
+func (s *Service) executeInstructionEvents(cdbI CollectionView, cin []Coin, instr Instruction) (StateChanges, []Coin, []Event, error) {
+	if cv, ok := cdbI.(*contractView); ok {
+		return s.executeInstructionAt(cv.CollectionView, cin, instr, cv.depth+1, cv.blockIndex, cv.chainTime)
 	}
-	return cdbTemp.GetRoot(), ctsOK, states, nil
+	return s.executeInstructionAt(cdbI, cin, instr, 0, -1, 0)
 }
 
-func (s *Service) executeInstruction(cdbI CollectionView, cin []Coin, instr Instruction) (scs StateChanges, cout []Coin, err error) {
+// executeInstructionAt executes instr with contracts nested depth deep, for
+// the block with the given index, or -1 if it is not executed for a block,
+// at the given chain time.
+func (s *Service) executeInstructionAt(cdbI CollectionView, cin []Coin, instr Instruction, depth int,
+	blockIndex int, chainTime int64) (scs StateChanges, cout []Coin, events []Event, err error) {
 	defer func() {
 		if re := recover(); re != nil {
 			err = errors.New(re.(string))
 		}
 	}()
 
+	if depth > maxCallDepth {
+		err = fmt.Errorf("contract calls are nested deeper than %d", maxCallDepth)
+		return
+	}
+
 	contractID, _, err := instr.GetContractState(cdbI)
 	if err != nil {
 		err = errors.New("Couldn't get contract type of instruction: " + err.Error())
@@ -829,9 +1514,49 @@ func (s *Service) executeInstruction(cdbI CollectionView, cin []Coin, instr Inst
 		err = errors.New("Leader is dropping instruction of unknown contract: " + contractID)
 		return
 	}
+	if errs := s.checkArguments(contractID, instr); len(errs) > 0 {
+		err = errs
+		return
+	}
+	// Existing instances are executed by the version of the contract they
+	// have been created with, or migrated to.
+	var migration StateChanges
+	if instr.Spawn == nil {
+		contract, cdbI, migration, err = s.migrate(cdbI, contractID, instr.InstanceID)
+		if err != nil {
+			return
+		}
+	}
 	// Now we call the contract function with the data of the key.
 	log.Lvlf3("%s: Calling contract %s", s.ServerIdentity(), contractID)
-	return contract(cdbI, instr, cin)
+	cv := &contractView{
+		CollectionView: cdbI,
+		s:              s,
+		depth:          depth,
+		contractID:     contractID,
+		instanceID:     instr.InstanceID,
+		events:         &events,
+		blockIndex:     blockIndex,
+		chainTime:      chainTime,
+	}
+	switch {
+	case instr.Spawn != nil:
+		scs, cout, err = contract.Spawn(cv, instr, cin)
+	case instr.Invoke != nil:
+		scs, cout, err = contract.Invoke(cv, instr, cin)
+	case instr.Delete != nil:
+		scs, cout, err = contract.Delete(cv, instr, cin)
+	default:
+		err = errors.New("instruction has no spawn, invoke or delete")
+	}
+	if err != nil {
+		return
+	}
+	scs = s.recordVersions(cdbI, scs)
+	if len(migration) > 0 {
+		scs = append(migration, scs...)
+	}
+	return
 }
 
 func (s *Service) getLeader(scID skipchain.SkipBlockID) (*network.ServerIdentity, error) {
@@ -848,17 +1573,25 @@ func (s *Service) getLeader(scID skipchain.SkipBlockID) (*network.ServerIdentity
 func (s *Service) getTxs(leader *network.ServerIdentity, scID skipchain.SkipBlockID) ClientTransactions {
 	actualLeader, err := s.getLeader(scID)
 	if err != nil {
-		log.Lvlf1("could not find a leader on %x with error %s", scID, err)
+		log.Lvl1(s.txLog(scID).msg("could not find a leader with error", err))
 		return []ClientTransaction{}
 	}
 	if !leader.Equal(actualLeader) {
-		log.Warn(s.ServerIdentity(), "getTxs came from a wrong leader")
+		log.Warn(s.txLog(scID).msg("getTxs came from a wrong leader"))
+		return []ClientTransaction{}
+	}
+	if !s.chainEnabled(scID) {
 		return []ClientTransaction{}
 	}
 	if s.heartbeats.enabled() {
 		s.heartbeats.beat(string(scID))
 	}
-	return s.txBuffer.take(string(scID))
+	txs := s.txBuffer.take(string(scID))
+	l := s.txLog(scID)
+	for _, ct := range txs {
+		log.Lvl3(l.tx(ct).msg("sending transaction to the leader", leader))
+	}
+	return txs
 }
 
 // TestClose closes the go-routines that are polling for transactions. It is
@@ -867,15 +1600,12 @@ func (s *Service) getTxs(leader *network.ServerIdentity, scID skipchain.SkipBloc
 func (s *Service) TestClose() {
 	// No need to use locks because the only non-test code tryLoad that
 	// uses this function holds the pollChanMut lock.
-	for k, c := range s.pollChan {
-		close(c)
-		delete(s.pollChan, k)
-	}
+	s.stopPolling()
 	if s.heartbeats.enabled() {
 		s.heartbeats.closeAll()
 		s.heartbeatsClose <- true
 	}
-	s.pollChanWG.Wait()
+	s.replicas.stopAll()
 }
 
 func (s *Service) monitorLeaderFailure() {
@@ -952,12 +1682,20 @@ func (s *Service) startViewChange(scID skipchain.SkipBlockID) error {
 		}},
 	}
 	signer := darc.NewSignerEd25519(s.ServerIdentity().Public, s.getPrivateKey())
-	if err = ctx.Instructions[0].SignBy(signer); err != nil {
+	if err = ctx.Instructions[0].SignWith(scID, signer); err != nil {
+		return err
+	}
+
+	// The view-change block must decrypt the encrypted transactions of
+	// the latest block, like any other block.
+	interval, _ := s.LoadBlockInterval(scID)
+	decs, err := s.collectDecryptions(sb, s.loadProtocolTimeout(scID, interval))
+	if err != nil {
 		return err
 	}
 
 	log.Lvlf2("%s: proposing view-change for %x", s.ServerIdentity(), scID)
-	_, err = s.createNewBlock(scID, newRoster, []ClientTransaction{ctx})
+	_, err = s.createNewBlock(scID, newRoster, []ClientTransaction{ctx}, nil, decs, 0, 0, 0)
 	return err
 }
 
@@ -1040,15 +1778,28 @@ func (s *Service) withinInterval(genesisDarcID darc.ID, targetPk kyber.Point) er
 
 // registerContract stores the contract in a map and will
 // call it whenever a contract needs to be done.
-func (s *Service) registerContract(contractID string, c OmniLedgerContract) error {
-	s.contracts[contractID] = c
+func (s *Service) registerContract(contractID string, c Contract) error {
+	return s.registerContractVersion(contractID, 1, c)
+}
+
+// registerView stores the view of the contract kind under its name.
+func (s *Service) registerView(kind, name string, v OmniLedgerView) error {
+	s.views[kind+"/"+name] = v
+	return nil
+}
+
+// registerIdentityVerifier stores the verifier of the identity type.
+func (s *Service) registerIdentityVerifier(idType string, v IdentityVerifier) error {
+	s.identityVerifiers[idType] = v
 	return nil
 }
 
 // Tries to load the configuration and updates the data in the service
 // if it finds a valid config-file.
 func (s *Service) tryLoad() error {
-	s.SetPropagationTimeout(120 * time.Second)
+	s.propTimeouts.Lock()
+	s.propTimeouts.chains = make(map[string]time.Duration)
+	s.propTimeouts.Unlock()
 
 	msg, err := s.Load([]byte(storageID))
 	if err != nil {
@@ -1062,9 +1813,15 @@ func (s *Service) tryLoad() error {
 		}
 	}
 	s.collectionDB = map[string]*collectionDB{}
+	s.eventDBMut.Lock()
+	s.eventDB = map[string]*eventDB{}
+	s.eventDBMut.Unlock()
 	s.state = olState{
-		lastBlock:    make(map[string]skipchain.SkipBlockID),
-		waitChannels: make(map[string]chan bool),
+		lastBlock:        make(map[string]skipchain.SkipBlockID),
+		waitChannels:     make(map[string][]chan bool),
+		viewChanges:      make(map[string]int),
+		maxWaiters:       defaultMaxWaiters,
+		maxInclusionWait: defaultMaxInclusionWait,
 	}
 
 	// NOTE: Usually tryLoad is only called when services start up. but for
@@ -1085,31 +1842,103 @@ func (s *Service) tryLoad() error {
 		if !s.isOurChain(gen) {
 			continue
 		}
-		interval, err := s.LoadBlockInterval(gen)
-		if err != nil {
+		if err := s.loadChain(gen); err != nil {
 			return err
 		}
-		s.pollChanWG.Add(1)
-		s.pollChan[string(gen)] = s.startPolling(gen, interval)
-		sb, err := s.db().GetLatestByID(gen)
+	}
+	s.updatePropagationTimeout()
+	if err := s.startLeaderPolling(); err != nil {
+		return err
+	}
+
+	s.storage.Lock()
+	for id := range s.storage.Replicas {
+		s.startReplica(skipchain.SkipBlockID(id))
+	}
+	s.storage.Unlock()
+
+	return nil
+}
+
+// loadChain migrates and loads the collection of the omniledger skipchain
+// gen, and loads its state from the latest block and the config.
+func (s *Service) loadChain(gen skipchain.SkipBlockID) error {
+	// The collection is migrated before it is used, so that a failed
+	// migration stops the service.
+	idStr := fmt.Sprintf("%x", gen)
+	db, name := s.GetAdditionalBucket([]byte(idStr))
+	if err := upgradeCollection(db, name); err != nil {
+		return err
+	}
+	s.collectionDB[idStr] = newCollectionDB(db, name)
+	s.eventDBMut.Lock()
+	delete(s.eventDB, idStr)
+	s.eventDBMut.Unlock()
+
+	sb, err := s.db().GetLatestByID(gen)
+	if err != nil {
+		return err
+	}
+	s.state.setLast(sb)
+	if err := s.measureUsage(gen); err != nil {
+		log.Error(s.ServerIdentity(), "couldn't measure the usage of the quota:", err)
+	}
+	if err := s.loadPropagationTimeout(gen); err != nil {
+		return err
+	}
+
+	// populate the darcID to skipchainID mapping
+	d, err := s.LoadGenesisDarc(gen)
+	if err != nil {
+		return err
+	}
+	s.darcToScMut.Lock()
+	s.darcToSc[string(d.GetBaseID())] = gen
+	s.darcToScMut.Unlock()
+	return nil
+}
+
+// startLeaderPolling starts polling the omniledger skipchains this node
+// leads and doesn't poll yet. The caller must hold pollChanMut.
+func (s *Service) startLeaderPolling() error {
+	gasr, err := s.skService().GetAllSkipChainIDs(&skipchain.GetAllSkipChainIDs{})
+	if err != nil {
+		return err
+	}
+	for _, gen := range gasr.IDs {
+		if !s.isOurChain(gen) {
+			continue
+		}
+		if _, ok := s.pollChan[string(gen)]; ok {
+			continue
+		}
+		leader, err := s.getLeader(gen)
 		if err != nil {
 			return err
 		}
-		s.state.setLast(sb)
-
-		// populate the darcID to skipchainID mapping
-		d, err := s.LoadGenesisDarc(gen)
+		if !leader.Equal(s.ServerIdentity()) {
+			continue
+		}
+		interval, err := s.LoadBlockInterval(gen)
 		if err != nil {
 			return err
 		}
-		s.darcToScMut.Lock()
-		s.darcToSc[string(d.GetBaseID())] = gen
-		s.darcToScMut.Unlock()
+		s.pollChanWG.Add(1)
+		s.pollChan[string(gen)] = s.startPolling(gen, interval)
 	}
-
 	return nil
 }
 
+// stopPolling stops polling all skipchains and waits for the polling
+// routines to return. The caller must hold pollChanMut.
+func (s *Service) stopPolling() {
+	for k, c := range s.pollChan {
+		close(c)
+		delete(s.pollChan, k)
+	}
+	s.pollChanWG.Wait()
+}
+
 // checks that a given chain has a verifier we recognize
 func (s *Service) isOurChain(gen skipchain.SkipBlockID) bool {
 	sb := s.db().GetByID(gen)
@@ -1118,12 +1947,7 @@ func (s *Service) isOurChain(gen skipchain.SkipBlockID) bool {
 		// if it does, just say "not ours".
 		return false
 	}
-	for _, x := range sb.VerifierIDs {
-		if x.Equal(verifyOmniLedger) {
-			return true
-		}
-	}
-	return false
+	return isOmniLedger(sb)
 }
 
 // EnableViewChange enables the view-change functionality. View-change is
@@ -1153,15 +1977,35 @@ func (s *Service) save() {
 func newService(c *onet.Context) (onet.Service, error) {
 	s := &Service{
 		ServiceProcessor:  onet.NewServiceProcessor(c),
-		contracts:         make(map[string]OmniLedgerContract),
+		contracts:         make(map[string]Contract),
+		contractVersions:  make(map[string]map[uint32]Contract),
+		views:             make(map[string]OmniLedgerView),
+		randomnessChecks:  make(map[string]RandomnessCheck),
+		schemas:           make(map[string]ArgumentSchema),
+		identityVerifiers: make(map[string]IdentityVerifier),
 		txBuffer:          newTxBuffer(),
+		encTxBuffer:       newEncryptedTxBuffer(),
 		heartbeatsTimeout: make(chan string, 1),
 		heartbeatsClose:   make(chan bool, 1),
 		storage:           &omniStorage{},
 		darcToSc:          make(map[string]skipchain.SkipBlockID),
+		backups:           newBackupFiles(),
+		quotas:            newQuotaUsage(),
+		propTimeouts:      newPropagationTimeouts(),
+		replicas:          newReplicas(),
+		nodeVersions:      newNodeVersions(),
+		clock:             serviceClock{Clock: realClock{}},
+		triggers:          newBlockTriggers(),
+		probes:            newRosterProbes(),
+		shutdown:          make(chan bool),
+		closed:            make(chan bool),
 	}
 	if err := s.RegisterHandlers(s.CreateGenesisBlock, s.AddTransaction,
-		s.GetProof); err != nil {
+		s.GetProof, s.CallView, s.SearchEvents, s.ResolveName,
+		s.GetContractRegistry, s.CreateTxKey, s.AddEncryptedTransaction, s.GetRandomness,
+		s.ListBlocks, s.DecodeBlock, s.SearchInstances, s.GetUpdates, s.Backup,
+		s.Restore, s.SetQuota, s.CloneChain, s.Replicate, s.SetAdminDarc,
+		s.GetRosterHealth, s.ListChains, s.SetChainEnabled); err != nil {
 		log.ErrFatal(err, "Couldn't register messages")
 	}
 	if err := s.tryLoad(); err != nil {
@@ -1169,17 +2013,47 @@ func newService(c *onet.Context) (onet.Service, error) {
 		return nil, err
 	}
 
-	var err error
-	s.propagateTransactions, err = messaging.NewPropagationFunc(c, "OmniLedgerPropagate", s.updateCollection, -1)
-	if err != nil {
+	s.registerContract(ContractConfigID, OmniLedgerContract(s.ContractConfig))
+	s.registerContract(ContractDarcID, OmniLedgerContract(s.ContractDarc))
+	s.registerContract(ContractDeferredID, OmniLedgerContract(s.ContractDeferred))
+	s.registerContract(ContractNamingID, contractNaming)
+	s.registerContract(ContractMisbehaviorID, contractMisbehavior)
+	s.registerContract(ContractCloneID, contractClone)
+	s.registerArgumentSchema(ContractDarcID, "spawn", ArgumentSchema{{"darc", ArgDarc, true}})
+	s.registerArgumentSchema(ContractDarcID, "invoke:"+CmdDarcEvolve, ArgumentSchema{{"darc", ArgDarc, true}})
+	s.registerArgumentSchema(ContractDeferredID, "spawn", ArgumentSchema{{"transaction", ArgBytes, true}})
+	s.registerArgumentSchema(ContractDeferredID, "invoke:addProof", ArgumentSchema{
+		{"index", ArgUint32, true},
+		{"identity", ArgBytes, true},
+		{"signature", ArgBytes, true},
+	})
+	s.registerArgumentSchema(ContractNamingID, "spawn", ArgumentSchema{
+		{"name", ArgString, true},
+		{"instanceID", ArgInstanceID, true},
+	})
+	s.registerArgumentSchema(ContractConfigID, "invoke:activate_version", ArgumentSchema{
+		{"version", ArgUint32, true},
+		{"block", ArgBytes, true},
+	})
+	s.registerArgumentSchema(ContractCloneID, "spawn", ArgumentSchema{{"instances", ArgBytes, true}})
+	s.registerArgumentSchema(ContractMisbehaviorID, "spawn", ArgumentSchema{
+		{"type", ArgString, true},
+		{"evidence", ArgBytes, true},
+	})
+	s.dkgService().RegisterReshareVerifier(txKeyPurpose, s.verifyTxKeyReshare)
+	s.skService().RegisterAdminVerifier(s.verifyAdminDarc)
+	if err := skipchain.RegisterGenesisVerification(c, verifyOmniLedger, s.verifyBlock); err != nil {
 		return nil, err
 	}
-
-	s.registerContract(ContractConfigID, s.ContractConfig)
-	s.registerContract(ContractDarcID, s.ContractDarc)
-	skipchain.RegisterVerification(c, verifyOmniLedger, s.verifySkipBlock)
-	if _, err := s.ProtocolRegister(collectTxProtocol, NewCollectTxProtocol(s.getTxs)); err != nil {
+	if err := skipchain.RegisterStoreBlockCallback(c, verifyOmniLedger, s.updateCollection); err != nil {
+		return nil, err
+	}
+	if _, err := s.ProtocolRegister(decryptTxProtocol, NewDecryptTxProtocol(s.getShares)); err != nil {
+		return nil, err
+	}
+	if _, err := s.ProtocolRegister(collectTxProtocol, s.newCollectTxProtocol); err != nil {
 		return nil, err
 	}
+	s.RegisterStatusReporter("OmniLedger", s)
 	return s, nil
 }
@@ -7,6 +7,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/collection"
 	"github.com/dedis/cothority/omniledger/darc"
 	"github.com/dedis/cothority/omniledger/darc/expression"
 	"github.com/dedis/cothority/skipchain"
@@ -14,6 +16,7 @@ import (
 	"github.com/dedis/kyber/util/random"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
 	"github.com/dedis/protobuf"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -61,6 +64,37 @@ func TestService_CreateSkipchain(t *testing.T) {
 	assert.NotNil(t, resp.Skipblock)
 }
 
+func TestService_CreateSkipchainHeights(t *testing.T) {
+	s := newSer(t, 0, testInterval)
+	defer s.local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	genesisMsg, err := DefaultGenesisMsg(CurrentVersion, s.roster, []string{"spawn:dummy"}, signer.Identity())
+	require.Nil(t, err)
+	genesisMsg.BlockInterval = 100 * time.Millisecond
+
+	// negative heights are refused
+	genesisMsg.BaseHeight = -1
+	_, err = s.service().CreateGenesisBlock(genesisMsg)
+	require.NotNil(t, err)
+
+	// the heights end up in the genesis block
+	genesisMsg.BaseHeight = 2
+	genesisMsg.MaximumHeight = 4
+	resp, err := s.service().CreateGenesisBlock(genesisMsg)
+	require.Nil(t, err)
+	require.Equal(t, 2, resp.Skipblock.BaseHeight)
+	require.Equal(t, 4, resp.Skipblock.MaximumHeight)
+
+	// unset heights use the defaults
+	genesisMsg.BaseHeight = 0
+	genesisMsg.MaximumHeight = 0
+	resp, err = s.service().CreateGenesisBlock(genesisMsg)
+	require.Nil(t, err)
+	require.Equal(t, defaultBaseHeight, resp.Skipblock.BaseHeight)
+	require.Equal(t, defaultMaximumHeight, resp.Skipblock.MaximumHeight)
+}
+
 func padDarc(key []byte) []byte {
 	keyPadded := make([]byte, 32)
 	copy(keyPadded, key)
@@ -303,7 +337,7 @@ func TestService_InvalidVerification(t *testing.T) {
 	defer s.local.CloseAll()
 
 	for i := range s.hosts {
-		RegisterContract(s.hosts[i], "panic", panicContractFunc)
+		RegisterContract(s.hosts[i], "panic", OmniLedgerContract(panicContractFunc))
 	}
 
 	// tx0 uses the panicing contract, so it should _not_ be stored.
@@ -436,7 +470,7 @@ func TestService_StateChange(t *testing.T) {
 		}, nil, nil
 
 	}
-	RegisterContract(s.hosts[0], "add", f)
+	RegisterContract(s.hosts[0], "add", OmniLedgerContract(f))
 
 	cdb := s.service().getCollection(s.sb.SkipChainID())
 	require.NotNil(t, cdb)
@@ -470,7 +504,7 @@ func TestService_StateChange(t *testing.T) {
 		},
 	}
 
-	_, ctsOK, scs, err := s.service().createStateChanges(cdb.coll, s.sb.SkipChainID(), cts)
+	_, ctsOK, scs, _, err := s.service().createStateChanges(cdb.coll, s.sb.SkipChainID(), cts)
 	require.Nil(t, err)
 	require.Equal(t, 1, len(ctsOK))
 	require.Equal(t, n, len(scs))
@@ -629,6 +663,281 @@ func TestService_DarcDelegation(t *testing.T) {
 	require.True(t, pr.InclusionProof.Match())
 }
 
+func TestService_Deferred(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	// Spawn a darc where two signers are needed to spawn a dummy instance.
+	signer2 := darc.NewSignerEd25519(nil, nil)
+	id := []darc.Identity{s.signer.Identity()}
+	darc2 := darc.NewDarc(darc.InitRules(id, id), []byte("multisig darc"))
+	darc2.Rules.AddRule("spawn:dummy", expression.InitAndExpr(s.signer.Identity().String(),
+		signer2.Identity().String()))
+	darc2Buf, err := darc2.ToProto()
+	require.Nil(t, err)
+	ctx := ClientTransaction{
+		Instructions: []Instruction{{
+			InstanceID: InstanceID{DarcID: s.darc.GetBaseID()},
+			Nonce:      GenNonce(),
+			Index:      0,
+			Length:     1,
+			Spawn: &Spawn{
+				ContractID: ContractDarcID,
+				Args:       []Argument{{Name: "darc", Value: darc2Buf}},
+			},
+		}},
+	}
+	require.Nil(t, ctx.Instructions[0].SignBy(s.signer))
+	s.sendTx(t, ctx)
+	require.True(t, s.waitProof(t, InstanceID{darc2.GetBaseID(), SubID{}}).InclusionProof.Match())
+
+	// Propose the spawn of a dummy instance on-chain.
+	proposed := Instruction{
+		InstanceID: InstanceID{darc2.GetBaseID(), genSubID()},
+		Nonce:      GenNonce(),
+		Index:      0,
+		Length:     1,
+		Spawn: &Spawn{
+			ContractID: dummyKind,
+			Args:       Arguments{{Name: "data", Value: s.value}},
+		},
+	}
+	txBuf, err := protobuf.Encode(&ClientTransaction{Instructions: []Instruction{proposed}})
+	require.Nil(t, err)
+	ctx = ClientTransaction{
+		Instructions: []Instruction{{
+			InstanceID: InstanceID{DarcID: s.darc.GetBaseID()},
+			Nonce:      GenNonce(),
+			Index:      0,
+			Length:     1,
+			Spawn: &Spawn{
+				ContractID: ContractDeferredID,
+				Args:       []Argument{{Name: "transaction", Value: txBuf}},
+			},
+		}},
+	}
+	require.Nil(t, ctx.Instructions[0].SignBy(s.signer))
+	s.sendTx(t, ctx)
+	deferredID := ctx.Instructions[0].DeriveID(ContractDeferredID)
+	require.True(t, s.waitProof(t, deferredID).InclusionProof.Match())
+
+	addProof := func(signer darc.Signer) {
+		sig, err := signer.Sign(DeferredProofMsg(deferredID, proposed))
+		require.Nil(t, err)
+		id := signer.Identity()
+		idBuf, err := protobuf.Encode(&id)
+		require.Nil(t, err)
+		ctx := ClientTransaction{
+			Instructions: []Instruction{{
+				InstanceID: deferredID,
+				Nonce:      GenNonce(),
+				Index:      0,
+				Length:     1,
+				Invoke: &Invoke{
+					Command: "addProof",
+					Args: []Argument{
+						{Name: "index", Value: make([]byte, 4)},
+						{Name: "identity", Value: idBuf},
+						{Name: "signature", Value: sig},
+					},
+				},
+			}},
+		}
+		require.Nil(t, ctx.Instructions[0].SignBy(s.signer))
+		s.sendTx(t, ctx)
+	}
+	// waitDeferred waits until the deferred instance holds n proofs.
+	waitDeferred := func(n int) DeferredData {
+		var dd DeferredData
+		for i := 0; i < 10; i++ {
+			pr := s.waitProof(t, deferredID)
+			vs, err := pr.InclusionProof.RawValues()
+			require.Nil(t, err)
+			require.Nil(t, protobuf.DecodeWithConstructors(vs[0], &dd,
+				network.DefaultConstructors(cothority.Suite)))
+			if len(dd.Proofs) == n {
+				return dd
+			}
+			time.Sleep(s.interval)
+		}
+		require.Fail(t, "proofs didn't get added")
+		return dd
+	}
+
+	// One proof is not enough.
+	addProof(s.signer)
+	dd := waitDeferred(1)
+	require.False(t, dd.Executed)
+
+	// With the second proof the transaction is executed.
+	addProof(signer2)
+	dd = waitDeferred(2)
+	require.True(t, dd.Executed)
+	require.Equal(t, "", dd.ExecResult)
+	pr := s.waitProof(t, proposed.InstanceID)
+	require.True(t, pr.InclusionProof.Match())
+}
+
+func TestService_DeferredOrder(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	hosts, _, _ := local.GenTree(1, false)
+	s := local.GetServices(hosts, OmniledgerID)[0].(*Service)
+	s.registerContract(dummyKind, OmniLedgerContract(dummyContractFunc))
+
+	// The first instruction stores darc2, which the second one needs.
+	signer1, signer2 := darc.NewSignerEd25519(nil, nil), darc.NewSignerEd25519(nil, nil)
+	ids := []darc.Identity{signer1.Identity()}
+	darc1 := darc.NewDarc(darc.InitRules(ids, ids), []byte("first"))
+	require.Nil(t, darc1.Rules.AddRule("spawn:storedarc", []byte(signer1.Identity().String())))
+	darc2 := darc.NewDarc(darc.InitRules(ids, ids), []byte("second"))
+	require.Nil(t, darc2.Rules.AddRule(darc.Action("spawn:"+dummyKind), []byte(signer2.Identity().String())))
+	darc2Buf, err := darc2.ToProto()
+	require.Nil(t, err)
+	s.registerContract("storedarc", OmniLedgerContract(func(coll CollectionView, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
+		return []StateChange{NewStateChange(Create, InstanceID{DarcID: darc2.GetBaseID()}, ContractDarcID, darc2Buf)}, c, nil
+	}))
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+	darc1Buf, err := darc1.ToProto()
+	require.Nil(t, err)
+	sc := NewStateChange(Create, InstanceID{DarcID: darc1.GetBaseID()}, ContractDarcID, darc1Buf)
+	require.Nil(t, storeInColl(coll.c, &sc))
+	root := coll.c.GetRoot()
+
+	dd := &DeferredData{ProposedTransaction: ClientTransaction{Instructions: []Instruction{{
+		InstanceID: InstanceID{DarcID: darc1.GetBaseID(), SubID: genSubID()},
+		Spawn:      &Spawn{ContractID: "storedarc"},
+	}, {
+		InstanceID: InstanceID{DarcID: darc2.GetBaseID(), SubID: genSubID()},
+		Spawn:      &Spawn{ContractID: dummyKind, Args: Arguments{{Name: "data", Value: []byte("value")}}},
+	}}}}
+	addProof := func(index int, signer darc.Signer) {
+		dd.Proofs = append(dd.Proofs, DeferredProof{
+			Index:     index,
+			Signature: darc.Signature{Signer: signer.Identity()},
+		})
+	}
+	cv := &contractView{CollectionView: coll, s: s, events: &[]Event{}, blockIndex: -1}
+
+	// Without a proof for the second instruction, nothing is executed.
+	addProof(0, signer1)
+	_, _, approved, err := s.executeDeferred(cv, nil, dd)
+	require.Nil(t, err)
+	require.False(t, approved)
+
+	// The darc of the second instruction is checked after the first one
+	// stored it.
+	addProof(1, signer2)
+	scs, _, approved, err := s.executeDeferred(cv, nil, dd)
+	require.Nil(t, err)
+	require.True(t, approved)
+	require.Equal(t, 2, len(scs))
+	require.Equal(t, []byte("value"), scs[1].Value)
+
+	// The collection is not changed.
+	require.Equal(t, root, coll.c.GetRoot())
+	_, _, err = coll.GetValues(InstanceID{DarcID: darc2.GetBaseID()}.Slice())
+	require.NotNil(t, err)
+}
+
+func TestService_CallView(t *testing.T) {
+	s := newSer(t, 2, testInterval)
+	defer s.local.CloseAll()
+
+	req := &CallView{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		InstanceID:  s.tx.Instructions[0].InstanceID,
+		View:        "value",
+	}
+	resp, err := s.service().CallView(req)
+	require.Nil(t, err)
+	require.Equal(t, s.value, resp.Result)
+	latest, err := s.service().db().GetLatestByID(s.sb.SkipChainID())
+	require.Nil(t, err)
+	require.Equal(t, latest.Hash, resp.BlockID)
+
+	// The view waits for the block that is being stored.
+	cdb := s.service().getCollection(s.sb.SkipChainID())
+	cdb.blockMut.Lock()
+	done := make(chan error)
+	go func() {
+		_, err := s.service().CallView(req)
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("the view didn't wait for the block")
+	case <-time.After(100 * time.Millisecond):
+	}
+	cdb.blockMut.Unlock()
+	require.Nil(t, <-done)
+
+	req.View = "missing"
+	_, err = s.service().CallView(req)
+	require.NotNil(t, err)
+
+	req.View = "value"
+	req.InstanceID = InstanceID{s.darc.GetBaseID(), genSubID()}
+	_, err = s.service().CallView(req)
+	require.NotNil(t, err)
+}
+
+func TestService_Events(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	events, cancel := s.services[1].SubscribeEvents(s.sb.SkipChainID(), dummyKind, "")
+	defer cancel()
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	s.sendTx(t, tx)
+	pr := s.waitProof(t, tx.Instructions[0].InstanceID)
+	require.True(t, pr.InclusionProof.Match())
+
+	select {
+	case be := <-events:
+		require.Equal(t, dummyKind, be.Event.ContractID)
+		require.Equal(t, "spawn", be.Event.Topic)
+		require.Equal(t, s.value, be.Event.Value)
+		require.True(t, be.Event.InstanceID.Equal(tx.Instructions[0].InstanceID))
+	case <-time.After(10 * s.interval):
+		require.Fail(t, "didn't get the event")
+	}
+
+	req := &SearchEvents{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+	}
+	for _, service := range s.services {
+		resp, err := service.SearchEvents(req)
+		require.Nil(t, err)
+		require.Equal(t, 1, len(resp.Events))
+		require.False(t, resp.Truncated)
+		require.Equal(t, s.value, resp.Events[0].Event.Value)
+		sb := service.db().GetByID(resp.Events[0].BlockID)
+		require.NotNil(t, sb)
+		require.Equal(t, sb.Index, resp.Events[0].BlockIndex)
+	}
+
+	search := func(contractID, topic string, from int) int {
+		req.ContractID, req.Topic, req.From = contractID, topic, from
+		resp, err := s.service().SearchEvents(req)
+		require.Nil(t, err)
+		return len(resp.Events)
+	}
+	require.Equal(t, 1, search(dummyKind, "spawn", 0))
+	require.Equal(t, 0, search(ContractDarcID, "", 0))
+	require.Equal(t, 0, search("", "other", 0))
+	latest, err := s.service().db().GetLatestByID(s.sb.SkipChainID())
+	require.Nil(t, err)
+	require.Equal(t, 0, search("", "", latest.Index+1))
+
+	req.SkipchainID = make([]byte, 32)
+	_, err = s.service().SearchEvents(req)
+	require.NotNil(t, err)
+}
+
 func TestService_GetLeader(t *testing.T) {
 	s := newSer(t, 1, testInterval)
 	defer s.local.CloseAll()
@@ -662,6 +971,70 @@ func TestService_SetConfig(t *testing.T) {
 	require.Fail(t, "did not find new config in time")
 }
 
+func TestService_VerifyGenesis(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	genesis := s.service().db().GetByID(s.sb.SkipChainID())
+	require.NotNil(t, genesis)
+	require.True(t, s.service().verifyBlock(genesis.Hash, genesis))
+
+	// A genesis block whose state doesn't come from its transactions.
+	_, headerI, err := network.Unmarshal(genesis.Data, cothority.Suite)
+	require.Nil(t, err)
+	header := headerI.(*DataHeader)
+	header.CollectionRoot = make([]byte, 32)
+	genesis.Data, err = network.Marshal(header)
+	require.Nil(t, err)
+	genesis.Hash = genesis.CalculateHash()
+	require.False(t, s.service().verifyBlock(genesis.Hash, genesis))
+}
+
+func TestService_LoadChainDarc(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+	id := darc.NewIdentityChainDarc(scID, s.darc.GetBaseID()).String()
+
+	now := time.Now().UnixNano()
+
+	// Without a proof the foreign darc is not found.
+	_, err := loadChainDarc(id, nil, now)
+	require.NotNil(t, err)
+
+	resp, err := s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		Key:     InstanceID{DarcID: s.darc.GetBaseID()}.Slice(),
+		ID:      scID,
+	})
+	require.Nil(t, err)
+	d, err := loadChainDarc(id, []Proof{resp.Proof}, now)
+	require.Nil(t, err)
+	require.Equal(t, s.darc.GetID(), d.GetID())
+
+	// The proof must be for the skipchain of the identity.
+	other := darc.NewIdentityChainDarc(random.Bits(256, true, random.New()), s.darc.GetBaseID())
+	_, err = loadChainDarc(other.String(), []Proof{resp.Proof}, now)
+	require.NotNil(t, err)
+
+	// Old proofs, or proofs outside of a block, are refused.
+	_, err = loadChainDarc(id, []Proof{resp.Proof}, now+int64(darcProofMaxAge+time.Minute))
+	require.NotNil(t, err)
+	_, err = loadChainDarc(id, []Proof{resp.Proof}, 0)
+	require.NotNil(t, err)
+
+	// The proofs are covered by the signatures of the instruction.
+	instr := Instruction{DarcProofs: []Proof{resp.Proof}}
+	hash := instr.Hash()
+	require.NotEqual(t, Instruction{}.Hash(), hash)
+	instr.DarcProofs[0].Latest.Hash = random.Bits(256, true, random.New())
+	require.NotEqual(t, hash, instr.Hash())
+
+	resp.Proof.Latest.Data = []byte("forged")
+	_, err = loadChainDarc(id, []Proof{resp.Proof}, now)
+	require.NotNil(t, err)
+}
+
 func TestService_SetBadConfig(t *testing.T) {
 	s := newSer(t, 1, testInterval)
 	defer s.local.CloseAll()
@@ -681,6 +1054,88 @@ func TestService_SetBadConfig(t *testing.T) {
 	}
 }
 
+func TestService_SetConfigUnreachable(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	fresh, _ := genRoster(1)
+	roster := onet.NewRoster(append(append([]*network.ServerIdentity{}, s.roster.List...), fresh.List...))
+	_, err := s.service().AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		Transaction: configTx(t, s, ChainConfig{BlockInterval: s.interval, Roster: *roster}),
+	})
+	require.NotNil(t, err)
+}
+
+func TestValidRosterChange(t *testing.T) {
+	old, _ := genRoster(4)
+	fresh, _ := genRoster(2)
+	newRoster := func(ids ...*network.ServerIdentity) onet.Roster {
+		return *onet.NewRoster(ids)
+	}
+
+	require.Nil(t, validRosterChange(*old, newRoster(old.List[1:]...)))
+	require.Nil(t, validRosterChange(*old, newRoster(append(old.List[:3:3], fresh.List[0])...)))
+	require.NotNil(t, validRosterChange(*old, newRoster(append(old.List[:2:2], fresh.List...)...)))
+	require.NotNil(t, validRosterChange(*old, newRoster(append(old.List[:3:3], old.List[0])...)))
+	require.NotNil(t, validRosterChange(*old, onet.Roster{}))
+}
+
+func TestService_RosterChangeIndex(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+
+	config, err := s.service().LoadConfig(scID)
+	require.Nil(t, err)
+	config.MinServiceVersion = rosterChangeVersion
+	s.sendTx(t, configTx(t, s, *config))
+	for i := 0; i < 10; i++ {
+		if v, _ := s.service().ActiveServiceVersion(scID); v == rosterChangeVersion {
+			break
+		}
+		time.Sleep(s.interval)
+	}
+
+	config, err = s.service().LoadConfig(scID)
+	require.Nil(t, err)
+	latest, err := s.service().db().GetLatestByID(scID)
+	require.Nil(t, err)
+	smaller := *config
+	smaller.Roster = *onet.NewRoster(config.Roster.List[:2])
+	smallest := *config
+	smallest.Roster = *onet.NewRoster(config.Roster.List[:1])
+
+	// Only the first roster change of a block is accepted.
+	coll := s.service().getCollection(scID).coll.Clone()
+	_, ctsOK, scs, _, err := s.service().createBlockStateChanges(coll, scID,
+		ClientTransactions{configTx(t, s, smaller), configTx(t, s, smallest)},
+		&blockInfo{index: latest.Index + 1})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(ctsOK))
+	for _, sc := range scs {
+		require.Nil(t, storeInColl(coll, &sc))
+	}
+	stored, err := LoadConfigFromColl(&roCollection{coll})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(stored.Roster.List))
+	require.Equal(t, latest.Index+1, stored.RosterChangeIndex)
+
+	// The index sent by the client is ignored, and the next block can
+	// change the roster again.
+	smallest.RosterChangeIndex = latest.Index + 2
+	_, ctsOK, _, _, err = s.service().createBlockStateChanges(coll, scID,
+		ClientTransactions{configTx(t, s, smallest)}, &blockInfo{index: latest.Index + 2})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(ctsOK))
+
+	// Outside of a block, the roster can't change.
+	_, _, err = s.service().executeInstruction(&roCollection{coll}, nil,
+		configTx(t, s, smallest).Instructions[0])
+	require.NotNil(t, err)
+}
+
 // TestService_RotateLeader is an end-to-end test for view-change. We kill the
 // current leader, at index 0. Then the node at index 1 becomes the new leader.
 // Then, we try to send a transaction to a follower, at index 2. The new leader
@@ -720,6 +1175,7 @@ func TestService_RotateLeader(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, leader)
 		require.True(t, leader.Equal(s.services[1].ServerIdentity()))
+		require.NotEqual(t, 0, service.state.getViewChanges(s.sb.SkipChainID()))
 	}
 
 	// try to send a transaction to the node on index 2, which is a
@@ -767,10 +1223,16 @@ func TestService_DarcToSc(t *testing.T) {
 func createConfigTx(t *testing.T, s *ser, isgood bool) (ClientTransaction, ChainConfig) {
 	var config ChainConfig
 	if isgood {
-		config = ChainConfig{420 * time.Millisecond, *s.roster}
+		config = ChainConfig{BlockInterval: 420 * time.Millisecond, Roster: *s.roster}
 	} else {
-		config = ChainConfig{-1, *s.roster.RandomSubset(s.services[1].ServerIdentity(), 2)}
+		config = ChainConfig{BlockInterval: -1, Roster: *s.roster.RandomSubset(s.services[1].ServerIdentity(), 2)}
 	}
+	return configTx(t, s, config), config
+}
+
+// configTx returns a transaction that updates the config, signed by the
+// owner of the genesis darc.
+func configTx(t *testing.T, s *ser, config ChainConfig) ClientTransaction {
 	configBuf, err := protobuf.Encode(&config)
 	require.NoError(t, err)
 
@@ -793,7 +1255,7 @@ func createConfigTx(t *testing.T, s *ser, isgood bool) (ClientTransaction, Chain
 		}},
 	}
 	require.NoError(t, ctx.Instructions[0].SignBy(s.signer))
-	return ctx, config
+	return ctx
 }
 
 func darcToTx(t *testing.T, d2 darc.Darc, signer darc.Signer) ClientTransaction {
@@ -932,7 +1394,8 @@ func newSerN(t *testing.T, step int, interval time.Duration, n int, viewchange b
 	}
 
 	genesisMsg, err := DefaultGenesisMsg(CurrentVersion, s.roster,
-		[]string{"spawn:dummy", "spawn:invalid", "spawn:panic", "spawn:darc", "invoke:update_config", "spawn:slow"}, s.signer.Identity())
+		[]string{"spawn:dummy", "spawn:invalid", "spawn:panic", "spawn:darc", "invoke:update_config", "spawn:slow",
+			"spawn:deferred", "invoke:addProof"}, s.signer.Identity())
 	require.Nil(t, err)
 	s.darc = &genesisMsg.GenesisDarc
 
@@ -977,11 +1440,19 @@ func dummyContractFunc(cdb CollectionView, inst Instruction, c []Coin) ([]StateC
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := EmitEvent(cdb, "spawn", args); err != nil {
+		return nil, nil, err
+	}
 	return []StateChange{
 		NewStateChange(Create, inst.InstanceID, cid, args),
 	}, nil, nil
 }
 
+func dummyViewFunc(cdb CollectionView, id InstanceID, args Arguments) ([]byte, error) {
+	value, _, err := cdb.GetValues(id.Slice())
+	return value, err
+}
+
 func slowContractFunc(cdb CollectionView, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
 	// This has to sleep for less than testInterval / 2 or else it will
 	// block the system from processing txs. See #1359.
@@ -1002,9 +1473,10 @@ func registerDummy(servers []*onet.Server) {
 	// For testing - there must be a better way to do that. But putting
 	// services []skipchain.GetService in the method signature doesn't work :(
 	for _, s := range servers {
-		RegisterContract(s, dummyKind, dummyContractFunc)
-		RegisterContract(s, slowKind, slowContractFunc)
-		RegisterContract(s, invalidKind, invalidContractFunc)
+		RegisterContract(s, dummyKind, OmniLedgerContract(dummyContractFunc))
+		RegisterContract(s, slowKind, OmniLedgerContract(slowContractFunc))
+		RegisterContract(s, invalidKind, OmniLedgerContract(invalidContractFunc))
+		RegisterView(s, dummyKind, "value", dummyViewFunc)
 	}
 }
 
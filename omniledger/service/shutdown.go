@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+)
+
+// ErrShuttingDown is returned for the transactions that the node can't
+// handle anymore because it is shutting down.
+var ErrShuttingDown = errors.New("node shutting down")
+
+// shutdownPoll is how often Shutdown checks if the buffered transactions
+// have been collected by the leaders.
+const shutdownPoll = 100 * time.Millisecond
+
+// Shutdown stops the service gracefully, it must be called before the
+// server is closed:
+//   - new transactions are refused with ErrShuttingDown
+//   - the transactions buffered by a follower are collected by the leaders
+//     for their next block
+//   - a leader finishes the current block and creates a last one with the
+//     remaining transactions, before it stops polling. The other nodes will
+//     start a view-change if the node doesn't come back
+//   - the clients that still wait for their transactions get
+//     ErrShuttingDown
+//
+// Once Shutdown returns, no more blocks are created by this node and the
+// bolt database can be closed by onet.Server.Close. It returns an error if
+// the timeout passed before all transactions are in a block.
+func (s *Service) Shutdown(timeout time.Duration) error {
+	s.shutdownMut.Lock()
+	if s.shuttingDown() {
+		s.shutdownMut.Unlock()
+		return errors.New("the service is already shut down")
+	}
+	close(s.shutdown)
+	s.shutdownMut.Unlock()
+	log.Lvl2(s.ServerIdentity(), "shutting down")
+
+	var err error
+	deadline := time.After(timeout)
+followers:
+	for !s.txBuffer.empty() {
+		select {
+		case <-deadline:
+			err = errors.New("timeout while waiting for the leaders to collect the transactions")
+			break followers
+		case <-time.After(shutdownPoll):
+		}
+	}
+
+	done := make(chan bool)
+	go func() {
+		s.pollChanMut.Lock()
+		s.TestClose()
+		s.pollChanMut.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-deadline:
+		err = errors.New("timeout while creating the last blocks")
+	}
+	close(s.closed)
+	return err
+}
+
+// shuttingDown returns true once Shutdown has been called.
+func (s *Service) shuttingDown() bool {
+	select {
+	case <-s.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// drainBlocks creates the last blocks of a leader that is shutting down,
+// until all transactions are in a block or no more transaction fits in a
+// block.
+func (s *Service) drainBlocks(scID skipchain.SkipBlockID, interval time.Duration, txs ClientTransactions) {
+	for {
+		left, _ := s.pollBlock(scID, interval, txs, nil)
+		if len(left) == 0 {
+			return
+		}
+		if len(left) == len(txs) {
+			log.Error(s.txLog(scID).msgf("dropping %d transactions at shutdown", len(left)))
+			return
+		}
+		txs = left
+	}
+}
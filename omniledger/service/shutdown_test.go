@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Shutdown(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	// A transaction that is still buffered by a follower must be in the last
+	// block of the leader.
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	_, err = s.services[1].AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		Transaction: tx,
+	})
+	require.Nil(t, err)
+	require.Nil(t, s.service().Shutdown(10*s.interval))
+
+	resp, err := s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		Key:     tx.Instructions[0].InstanceID.Slice(),
+		ID:      s.sb.SkipChainID(),
+	})
+	require.Nil(t, err)
+	require.True(t, resp.Proof.InclusionProof.Match())
+
+	tx, err = createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	_, err = s.service().AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		Transaction: tx,
+	})
+	require.Equal(t, ErrShuttingDown, err)
+	require.NotNil(t, s.service().Shutdown(s.interval))
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/protobuf"
+)
+
+// A StateMachine is a contract for workflows that go through a fixed set of
+// states, like an escrow or a vote. The application declares which commands
+// move an instance from one state to the next, and the StateMachine checks
+// that only these transitions happen. As every transition is an invoke
+// instruction, the darc of the instance decides who can do it with its
+// "invoke:<command>" rules.
+//
+// A state can time out, measured in chain time. Once the timeout passed,
+// the transitions of the state are refused and anybody allowed to send the
+// "timeout" command can move the instance on.
+
+// CmdStateTimeout is the command that moves an instance out of a state that
+// timed out.
+const CmdStateTimeout = "timeout"
+
+// TopicState is the topic of the event emitted when an instance of a
+// StateMachine enters a new state. The value of the event is the state.
+const TopicState = "state"
+
+// TransitionFn is called when an instance of a StateMachine moves to a new
+// state. It gets the data of the instance and returns the new data, together
+// with the state changes of other instances, for example from CallContract.
+type TransitionFn func(coll CollectionView, inst Instruction, data []byte, coins []Coin) ([]byte, []StateChange, []Coin, error)
+
+// Transition lets the invoke instruction with Command move an instance from
+// the state From to the state To.
+type Transition struct {
+	Command string
+	From    string
+	To      string
+	// Apply is called before the instance moves. If nil, the data of the
+	// instance doesn't change.
+	Apply TransitionFn
+}
+
+// Timeout moves an instance that stayed for After in State to the state To,
+// once a "timeout" command is sent.
+type Timeout struct {
+	State string
+	After time.Duration
+	// AfterFn returns the timeout from the data of the instance. If set,
+	// After is ignored.
+	AfterFn func(data []byte) (time.Duration, error)
+	To      string
+	// Apply is called before the instance moves. If nil, the data of the
+	// instance doesn't change.
+	Apply TransitionFn
+}
+
+// StateMachine implements Contract and accepts the following instructions:
+//   - Spawn - creates an instance in the Initial state under
+//     inst.DeriveID(ContractID)
+//   - Invoke - runs the transition of the command from the current state,
+//     or the timeout of the state for the "timeout" command
+//   - Delete - removes the instance if it is in one of the Final states
+type StateMachine struct {
+	// ContractID the state machine is registered with.
+	ContractID string
+	// Initial is the state of new instances.
+	Initial string
+	// SpawnFn is called with nil data and returns the data of a new
+	// instance. If nil, the data is the argument "data".
+	SpawnFn TransitionFn
+	// Transitions lists all allowed transitions between the states.
+	Transitions []Transition
+	// Timeouts lists the states that time out. A state can only have one
+	// timeout.
+	Timeouts []Timeout
+	// Final lists the states in which an instance can be deleted.
+	Final []string
+}
+
+// RegisterStateMachine checks that the transitions of sm are unambiguous
+// and registers it as contract sm.ContractID.
+func RegisterStateMachine(s skipchain.GetService, sm StateMachine) error {
+	if err := sm.check(); err != nil {
+		return err
+	}
+	return RegisterContract(s, sm.ContractID, sm)
+}
+
+// check returns an error if the state machine is incomplete or a command
+// has more than one transition from the same state.
+func (sm StateMachine) check() error {
+	if sm.ContractID == "" || sm.Initial == "" {
+		return errors.New("the state machine needs a contract ID and an initial state")
+	}
+	for i, t := range sm.Transitions {
+		if t.Command == "" || t.Command == CmdStateTimeout {
+			return fmt.Errorf("transition from %s has invalid command \"%s\"", t.From, t.Command)
+		}
+		for _, t2 := range sm.Transitions[:i] {
+			if t.Command == t2.Command && t.From == t2.From {
+				return fmt.Errorf("command %s has two transitions from %s", t.Command, t.From)
+			}
+		}
+	}
+	for i, to := range sm.Timeouts {
+		if to.After <= 0 && to.AfterFn == nil {
+			return fmt.Errorf("timeout of %s must be positive", to.State)
+		}
+		for _, to2 := range sm.Timeouts[:i] {
+			if to.State == to2.State {
+				return fmt.Errorf("state %s has two timeouts", to.State)
+			}
+		}
+	}
+	return nil
+}
+
+// Spawn implements Contract.
+func (sm StateMachine) Spawn(coll CollectionView, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	data := inst.Spawn.Args.Search("data")
+	var scs []StateChange
+	if sm.SpawnFn != nil {
+		var err error
+		data, scs, coins, err = sm.SpawnFn(coll, inst, nil, coins)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	now, err := ChainTime(coll)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc, err := sm.enter(coll, Create, inst.DeriveID(sm.ContractID), sm.Initial, now, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(scs, sc), coins, nil
+}
+
+// Invoke implements Contract.
+func (sm StateMachine) Invoke(coll CollectionView, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	smd, err := LoadStateMachineData(coll, inst.InstanceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	now, err := ChainTime(coll)
+	if err != nil {
+		return nil, nil, err
+	}
+	to := sm.timeout(smd.State)
+	timedOut := false
+	if to != nil {
+		after := to.After
+		if to.AfterFn != nil {
+			after, err = to.AfterFn(smd.Data)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		timedOut = now.Sub(time.Unix(0, smd.Entered)) >= after
+	}
+
+	var next string
+	var apply TransitionFn
+	if inst.Invoke.Command == CmdStateTimeout {
+		if !timedOut {
+			return nil, nil, fmt.Errorf("state %s didn't time out", smd.State)
+		}
+		next, apply = to.To, to.Apply
+	} else {
+		if timedOut {
+			return nil, nil, fmt.Errorf("state %s timed out", smd.State)
+		}
+		t := sm.transition(inst.Invoke.Command, smd.State)
+		if t == nil {
+			return nil, nil, fmt.Errorf("command %s is not allowed in state %s",
+				inst.Invoke.Command, smd.State)
+		}
+		next, apply = t.To, t.Apply
+	}
+
+	data := smd.Data
+	var scs []StateChange
+	if apply != nil {
+		data, scs, coins, err = apply(coll, inst, smd.Data, coins)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	sc, err := sm.enter(coll, Update, inst.InstanceID, next, now, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(scs, sc), coins, nil
+}
+
+// Delete implements Contract.
+func (sm StateMachine) Delete(coll CollectionView, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	smd, err := LoadStateMachineData(coll, inst.InstanceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, state := range sm.Final {
+		if state == smd.State {
+			return []StateChange{
+				NewStateChange(Remove, inst.InstanceID, sm.ContractID, nil),
+			}, coins, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("cannot delete instance in state %s", smd.State)
+}
+
+// enter returns the state change that puts the instance id in state with
+// data, and emits the TopicState event.
+func (sm StateMachine) enter(coll CollectionView, action StateAction, id InstanceID, state string, now time.Time, data []byte) (StateChange, error) {
+	buf, err := protobuf.Encode(&StateMachineData{
+		State:   state,
+		Entered: now.UnixNano(),
+		Data:    data,
+	})
+	if err != nil {
+		return StateChange{}, err
+	}
+	if err := EmitEvent(coll, TopicState, []byte(state)); err != nil {
+		return StateChange{}, err
+	}
+	return NewStateChange(action, id, sm.ContractID, buf), nil
+}
+
+func (sm StateMachine) transition(command, from string) *Transition {
+	for i := range sm.Transitions {
+		if sm.Transitions[i].Command == command && sm.Transitions[i].From == from {
+			return &sm.Transitions[i]
+		}
+	}
+	return nil
+}
+
+func (sm StateMachine) timeout(state string) *Timeout {
+	for i := range sm.Timeouts {
+		if sm.Timeouts[i].State == state {
+			return &sm.Timeouts[i]
+		}
+	}
+	return nil
+}
+
+// LoadStateMachineData returns the state and the data of the instance id of
+// a StateMachine.
+func LoadStateMachineData(coll CollectionView, id InstanceID) (*StateMachineData, error) {
+	value, _, err := coll.GetValues(id.Slice())
+	if err != nil {
+		return nil, err
+	}
+	smd := &StateMachineData{}
+	if err := protobuf.Decode(value, smd); err != nil {
+		return nil, errors.New("couldn't decode state machine: " + err.Error())
+	}
+	return smd, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/onet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateMachine(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	hosts, _, _ := local.GenTree(1, false)
+	s := local.GetServices(hosts, OmniledgerID)[0].(*Service)
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+
+	// A vote that is opened, and closed before the deadline or expires.
+	require.NotNil(t, RegisterStateMachine(hosts[0], StateMachine{ContractID: "vote"}))
+	require.NotNil(t, RegisterStateMachine(hosts[0], StateMachine{
+		ContractID: "vote",
+		Initial:    "draft",
+		Transitions: []Transition{
+			{Command: "open", From: "draft", To: "open"},
+			{Command: "open", From: "draft", To: "closed"},
+		},
+	}))
+	require.Nil(t, RegisterStateMachine(hosts[0], StateMachine{
+		ContractID: "vote",
+		Initial:    "draft",
+		Transitions: []Transition{
+			{Command: "open", From: "draft", To: "open"},
+			{Command: "close", From: "open", To: "closed",
+				Apply: func(coll CollectionView, inst Instruction, data []byte, coins []Coin) ([]byte, []StateChange, []Coin, error) {
+					return append(data, []byte(" - done")...), nil, coins, nil
+				}},
+		},
+		Timeouts: []Timeout{{State: "open", After: time.Hour, To: "expired"}},
+		Final:    []string{"closed", "expired"},
+	}))
+
+	start := time.Now()
+	exec := func(instr Instruction, at time.Time) error {
+		scs, _, events, err := s.executeInstructionAt(coll, nil, instr, 0, -1, at.UnixNano())
+		if err != nil {
+			return err
+		}
+		for _, sc := range scs {
+			require.Nil(t, storeInColl(coll.c, &sc))
+		}
+		require.Equal(t, 1, len(events))
+		require.Equal(t, TopicState, events[0].Topic)
+		return nil
+	}
+	state := func(id InstanceID) string {
+		smd, err := LoadStateMachineData(coll, id)
+		require.Nil(t, err)
+		return smd.State
+	}
+	invoke := func(id InstanceID, cmd string) Instruction {
+		return Instruction{InstanceID: id, Invoke: &Invoke{Command: cmd}}
+	}
+
+	darcID := make([]byte, 32)
+	newVote := func() InstanceID {
+		spawn := Instruction{
+			InstanceID: InstanceID{DarcID: darcID, SubID: genSubID()},
+			Spawn: &Spawn{
+				ContractID: "vote",
+				Args:       Arguments{{Name: "data", Value: []byte("vote")}},
+			},
+		}
+		require.Nil(t, exec(spawn, start))
+		return spawn.DeriveID("vote")
+	}
+
+	id := newVote()
+	require.Equal(t, "draft", state(id))
+	require.NotNil(t, exec(invoke(id, "close"), start))
+	require.NotNil(t, exec(Instruction{InstanceID: id, Delete: &Delete{}}, start))
+	require.Nil(t, exec(invoke(id, "open"), start))
+	require.NotNil(t, exec(invoke(id, CmdStateTimeout), start.Add(time.Minute)))
+	require.Nil(t, exec(invoke(id, "close"), start.Add(time.Minute)))
+	require.Equal(t, "closed", state(id))
+	smd, err := LoadStateMachineData(coll, id)
+	require.Nil(t, err)
+	require.Equal(t, "vote - done", string(smd.Data))
+	require.Equal(t, start.Add(time.Minute).UnixNano(), smd.Entered)
+	require.Nil(t, exec(Instruction{InstanceID: id, Delete: &Delete{}}, start))
+
+	// Once the vote timed out, it can't be closed anymore.
+	id = newVote()
+	require.Nil(t, exec(invoke(id, "open"), start))
+	require.NotNil(t, exec(invoke(id, "close"), start.Add(2*time.Hour)))
+	require.Nil(t, exec(invoke(id, CmdStateTimeout), start.Add(2*time.Hour)))
+	require.Equal(t, "expired", state(id))
+}
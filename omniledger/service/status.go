@@ -0,0 +1,91 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+)
+
+// GetStatus returns the status report of all omniledgers hosted by this
+// node. Besides the number of chains, it has the following fields for every
+// chain, prefixed by the short skipchain ID:
+//   - Index - index of the latest block
+//   - Age - time since the latest block has been created
+//   - Mempool - number of transactions waiting for the next block
+//   - ViewChanges - number of view-changes since the node started
+//   - Bytes - size of the collection in the database
+func (s *Service) GetStatus() *onet.Status {
+	out := make(map[string]string)
+	chains := s.state.chains()
+	out["Chains"] = strconv.Itoa(len(chains))
+	for _, scID := range chains {
+		key := scID.Short() + "/"
+		idStr := string(scID)
+		if sb, err := s.db().GetLatestByID(scID); err == nil {
+			out[key+"Index"] = strconv.Itoa(sb.Index)
+			_, headerI, err := network.Unmarshal(sb.Data, cothority.Suite)
+			if header, ok := headerI.(*DataHeader); err == nil && ok {
+				age := time.Since(time.Unix(0, header.UnixNano()))
+				out[key+"Age"] = age.Round(time.Second).String()
+			}
+		}
+		mempool := s.txBuffer.size(idStr) + s.encTxBuffer.size(idStr)
+		out[key+"Mempool"] = strconv.Itoa(mempool)
+		out[key+"ViewChanges"] = strconv.Itoa(s.state.getViewChanges(scID))
+		out[key+"Bytes"] = strconv.Itoa(s.getCollection(scID).size())
+	}
+	return &onet.Status{Field: out}
+}
+
+// chains returns the IDs of the omniledgers that have a collection.
+func (ol *olState) chains() []skipchain.SkipBlockID {
+	ol.Lock()
+	defer ol.Unlock()
+	ids := make([]skipchain.SkipBlockID, 0, len(ol.lastBlock))
+	for id := range ol.lastBlock {
+		ids = append(ids, skipchain.SkipBlockID(id))
+	}
+	return ids
+}
+
+func (ol *olState) addViewChange(id skipchain.SkipBlockID) {
+	ol.Lock()
+	defer ol.Unlock()
+	ol.viewChanges[string(id)]++
+}
+
+func (ol *olState) getViewChanges(id skipchain.SkipBlockID) int {
+	ol.Lock()
+	defer ol.Unlock()
+	return ol.viewChanges[string(id)]
+}
+
+func (r *txBuffer) size(key string) int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.txsMap[key])
+}
+
+func (r *encryptedTxBuffer) size(key string) int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.txsMap[key])
+}
+
+// size returns the number of bytes the collection uses in the database.
+func (c *collectionDB) size() int {
+	var total int
+	c.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(c.bucketName); b != nil {
+			st := b.Stats()
+			total = st.BranchInuse + st.LeafInuse
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_GetStatus(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyKind, s.value, s.signer)
+	require.Nil(t, err)
+	_, err = s.service().AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		Transaction: tx,
+	})
+	require.Nil(t, err)
+	s.waitProof(t, tx.Instructions[0].InstanceID)
+
+	latest, err := s.service().db().GetLatestByID(s.sb.SkipChainID())
+	require.Nil(t, err)
+	st := s.service().GetStatus().Field
+	key := s.sb.SkipChainID().Short() + "/"
+	require.Equal(t, "1", st["Chains"])
+	require.Equal(t, strconv.Itoa(latest.Index), st[key+"Index"])
+	require.NotEmpty(t, st[key+"Age"])
+	require.Equal(t, "0", st[key+"Mempool"])
+	require.Equal(t, "0", st[key+"ViewChanges"])
+	require.NotEqual(t, "0", st[key+"Bytes"])
+}
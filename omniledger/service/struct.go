@@ -1,14 +1,18 @@
 package service
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority/migration"
 	"github.com/dedis/cothority/omniledger/collection"
 	"github.com/dedis/cothority/omniledger/darc"
 	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
 )
 
@@ -22,6 +26,12 @@ type collectionDB struct {
 	bucketName []byte
 	coll       *collection.Collection
 	scID       skipchain.SkipBlockID
+	// auth caches the darcs and the evaluations of their rules.
+	auth *authCache
+	// blockMut is held for writing while the state changes of a block are
+	// stored, the readers that need the state of a whole block take it for
+	// reading.
+	blockMut sync.RWMutex
 }
 
 // A CollectionView is an interface that defines the read-only operations
@@ -60,12 +70,274 @@ func (r *roCollection) GetValues(key []byte) (value []byte, contractID string, e
 	return getValuesFromRecord(record, key)
 }
 
-// OmniLedgerContract is the type signature of the class functions
-// which can be registered with the OmniLedger service.
-// Since the outcome of the verification depends on the state of the collection
-// which is to be modified, we pass it as a pointer here.
+// overlayView is a copy-on-write CollectionView: it reads the state changes
+// stored in it, and everything else from its base, which is neither changed
+// nor cloned. The deferred transactions and the migrations use it to execute
+// instructions that see the changes of the previous ones.
+type overlayView struct {
+	base    CollectionView
+	changes map[string]StateChange
+}
+
+// newOverlayView returns an overlay without changes on base.
+func newOverlayView(base CollectionView) *overlayView {
+	return &overlayView{base: base, changes: make(map[string]StateChange)}
+}
+
+// Get returns the collection.Getter for the key. A changed key is read from
+// a collection that only holds its new value, so its proof is not a proof of
+// the overlay.
+func (o *overlayView) Get(key []byte) collection.Getter {
+	sc, ok := o.changes[string(key)]
+	if !ok {
+		return o.base.Get(key)
+	}
+	c := collection.New(&collection.Data{}, &collection.Data{})
+	if sc.StateAction != Remove {
+		c.Add(key, sc.Value, sc.ContractID)
+	}
+	return c.Get(key)
+}
+
+// GetValues returns the value of the key and the contractID. If the key
+// does not exist, it returns an error.
+func (o *overlayView) GetValues(key []byte) (value []byte, contractID string, err error) {
+	sc, ok := o.changes[string(key)]
+	if !ok {
+		return o.base.GetValues(key)
+	}
+	if sc.StateAction == Remove {
+		return nil, "", errors.New("no match found")
+	}
+	return sc.Value, string(sc.ContractID), nil
+}
+
+// store applies the state change to the overlay, with the same checks as
+// storeInColl.
+func (o *overlayView) store(sc StateChange) error {
+	_, _, err := o.GetValues(sc.InstanceID)
+	exists := err == nil
+	switch sc.StateAction {
+	case Create:
+		if exists {
+			return errors.New("instance already exists")
+		}
+	case Update, Remove:
+		if !exists {
+			return errors.New("instance doesn't exist")
+		}
+	default:
+		return errors.New("invalid state action")
+	}
+	o.changes[string(sc.InstanceID)] = sc
+	return nil
+}
+
+// Contract is implemented by the contracts registered with the OmniLedger
+// service. The service calls the method matching the type of the
+// instruction. Since the outcome of the verification depends on the state of
+// the collection which is to be modified, we pass it as a pointer here.
+type Contract interface {
+	// Spawn creates new instances.
+	Spawn(coll CollectionView, inst Instruction, inCoins []Coin) (sc []StateChange, outCoins []Coin, err error)
+	// Invoke calls the command inst.Invoke.Command on an instance.
+	Invoke(coll CollectionView, inst Instruction, inCoins []Coin) (sc []StateChange, outCoins []Coin, err error)
+	// Delete removes an instance.
+	Delete(coll CollectionView, inst Instruction, inCoins []Coin) (sc []StateChange, outCoins []Coin, err error)
+}
+
+// OmniLedgerContract is the type signature of a contract that handles all
+// types of instructions in one function. It implements Contract by calling
+// the function for every method.
 type OmniLedgerContract func(coll CollectionView, inst Instruction, inCoins []Coin) (sc []StateChange, outCoins []Coin, err error)
 
+// Spawn calls the contract function.
+func (f OmniLedgerContract) Spawn(coll CollectionView, inst Instruction, inCoins []Coin) ([]StateChange, []Coin, error) {
+	return f(coll, inst, inCoins)
+}
+
+// Invoke calls the contract function.
+func (f OmniLedgerContract) Invoke(coll CollectionView, inst Instruction, inCoins []Coin) ([]StateChange, []Coin, error) {
+	return f(coll, inst, inCoins)
+}
+
+// Delete calls the contract function.
+func (f OmniLedgerContract) Delete(coll CollectionView, inst Instruction, inCoins []Coin) ([]StateChange, []Coin, error) {
+	return f(coll, inst, inCoins)
+}
+
+// BasicContract implements Contract with one function per instruction type
+// and routes the invoke instructions to the function of their command. A nil
+// function or a missing command refuses the instruction.
+type BasicContract struct {
+	SpawnFn  OmniLedgerContract
+	Commands map[string]OmniLedgerContract
+	DeleteFn OmniLedgerContract
+}
+
+// Spawn calls SpawnFn.
+func (bc BasicContract) Spawn(coll CollectionView, inst Instruction, inCoins []Coin) ([]StateChange, []Coin, error) {
+	if bc.SpawnFn == nil {
+		return nil, nil, errors.New("contract doesn't support spawn")
+	}
+	return bc.SpawnFn(coll, inst, inCoins)
+}
+
+// Invoke calls the function of the command of the instruction.
+func (bc BasicContract) Invoke(coll CollectionView, inst Instruction, inCoins []Coin) ([]StateChange, []Coin, error) {
+	f, ok := bc.Commands[inst.Invoke.Command]
+	if !ok {
+		return nil, nil, errors.New("invalid command: " + inst.Invoke.Command)
+	}
+	return f(coll, inst, inCoins)
+}
+
+// Delete calls DeleteFn.
+func (bc BasicContract) Delete(coll CollectionView, inst Instruction, inCoins []Coin) ([]StateChange, []Coin, error) {
+	if bc.DeleteFn == nil {
+		return nil, nil, errors.New("contract doesn't support delete")
+	}
+	return bc.DeleteFn(coll, inst, inCoins)
+}
+
+// maxCallDepth is how deep contracts can call other contracts with
+// CallContract.
+const maxCallDepth = 8
+
+// contractView is the CollectionView given to the contracts. It remembers
+// how deep the contract is nested, so that CallContract can call the next
+// contract, collects the events emitted with EmitEvent and holds the index of
+// the block and the time returned by ChainTime.
+type contractView struct {
+	CollectionView
+	s          *Service
+	depth      int
+	contractID string
+	instanceID InstanceID
+	events     *[]Event
+	blockIndex int
+	chainTime  int64
+}
+
+// emit adds events to the events of the instruction.
+func (cv *contractView) emit(events ...Event) {
+	*cv.events = append(*cv.events, events...)
+}
+
+// ContractIdentity returns the identity a contract has in the rules of the
+// darcs when it calls another contract with CallContract.
+func ContractIdentity(contractID string) string {
+	return "contract:" + hex.EncodeToString([]byte(contractID))
+}
+
+// InstanceIdentity returns the identity an instance has in the rules of the
+// darcs when its contract calls another contract with CallContract.
+func InstanceIdentity(id InstanceID) string {
+	return "instance:" + hex.EncodeToString(id.Slice())
+}
+
+// CallContract lets a contract execute inst with the contract of the
+// instance it points to, for example to move coins with the coin contract.
+// coll must be the CollectionView the calling contract got. The instruction
+// has no signatures, instead the rule of its action in the darc of the
+// instance must be fulfilled by the ContractIdentity of the calling contract
+// or the InstanceIdentity of the calling instance. The calling contract must
+// add the returned state changes to its own, and the instruction doesn't see
+// the changes of the calling contract.
+func CallContract(coll CollectionView, inst Instruction, inCoins []Coin) ([]StateChange, []Coin, error) {
+	cv, ok := coll.(*contractView)
+	if !ok {
+		return nil, nil, errors.New("contracts can only be called from within a contract")
+	}
+	if err := cv.authorizeCall(inst); err != nil {
+		return nil, nil, err
+	}
+	scs, cout, events, err := cv.s.executeInstructionEvents(cv, inCoins, inst)
+	if err != nil {
+		return nil, nil, err
+	}
+	cv.emit(events...)
+	return scs, cout, nil
+}
+
+// authorizeCall returns an error if the darc of the instance of inst doesn't
+// let the contract of cv call it.
+func (cv *contractView) authorizeCall(inst Instruction) error {
+	d, err := LoadDarcFromColl(cv, InstanceID{DarcID: inst.InstanceID.DarcID}.Slice())
+	if err != nil {
+		return errors.New("couldn't load the darc of the called instance: " + err.Error())
+	}
+	action := darc.Action(inst.Action())
+	if !d.Rules.Contains(action) {
+		return fmt.Errorf("the darc of the called instance has no rule for %s", action)
+	}
+	err = darc.EvalExprWithLimits(d.Rules[action], NewDarcGetter(cv, inst.DarcProofs...),
+		LoadDarcLimits(cv), ContractIdentity(cv.contractID), InstanceIdentity(cv.instanceID))
+	if err != nil {
+		return fmt.Errorf("%s is not allowed to call %s: %v", cv.contractID, action, err)
+	}
+	return nil
+}
+
+// EmitEvent lets a contract emit an event with the given topic and value.
+// coll must be the CollectionView the contract got. The event is stored by
+// the nodes together with the index of the block if the transaction is
+// included, and can be found with SearchEvents. Events of refused
+// transactions are dropped.
+func EmitEvent(coll CollectionView, topic string, value []byte) error {
+	cv, ok := coll.(*contractView)
+	if !ok {
+		return errors.New("events can only be emitted from within a contract")
+	}
+	cv.emit(Event{
+		ContractID: cv.contractID,
+		InstanceID: cv.instanceID,
+		Topic:      topic,
+		Value:      value,
+	})
+	return nil
+}
+
+// ChainTime returns the time of the blockchain for the contract that got
+// coll. It is the timestamp of the block before the one the instruction is
+// included in, so all nodes execute the instruction at the same time. Use it
+// instead of the clock of the node for timeouts. Once the skipchain activated
+// chainTimeVersion, it is read from the chain time instance.
+func ChainTime(coll CollectionView) (time.Time, error) {
+	cv, ok := coll.(*contractView)
+	if !ok {
+		return time.Time{}, errors.New("the chain time is only known within a contract")
+	}
+	if ts, ok := storedChainTime(cv.CollectionView); ok {
+		return time.Unix(0, ts), nil
+	}
+	return time.Unix(0, cv.chainTime), nil
+}
+
+// blockIndex returns the index of the block whose transactions are executed
+// with coll. It is only known within a contract executed for a block.
+func blockIndex(coll CollectionView) (int, error) {
+	cv, ok := coll.(*contractView)
+	if !ok || cv.blockIndex < 0 {
+		return 0, errors.New("the block index is only known within a contract executed for a block")
+	}
+	return cv.blockIndex, nil
+}
+
+// skipChainID returns the ID of the skipchain for which the contract that got
+// coll is executed.
+func skipChainID(coll CollectionView) (skipchain.SkipBlockID, error) {
+	cv, ok := coll.(*contractView)
+	if !ok {
+		return nil, errors.New("the skipchain is only known within a contract")
+	}
+	val, _, err := getValueContract(coll, GenesisReferenceID.Slice())
+	if err != nil {
+		return nil, err
+	}
+	return cv.s.scIDFromGenesisDarc(darc.ID(val))
+}
+
 // newCollectionDB initialises a structure and reads all key/value pairs to store
 // it in the collection.
 func newCollectionDB(db *bolt.DB, name []byte) *collectionDB {
@@ -73,15 +345,15 @@ func newCollectionDB(db *bolt.DB, name []byte) *collectionDB {
 		db:         db,
 		bucketName: name,
 		coll:       collection.New(collection.Data{}, collection.Data{}),
+		auth:       newAuthCache(),
+	}
+	if err := upgradeCollection(db, name); err != nil {
+		log.Error(err)
 	}
-	c.db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucket(name)
-		if err != nil {
-			return fmt.Errorf("create bucket: %s", err)
-		}
-		return nil
-	})
 	c.loadAll()
+	if err := hashValuesIfActive(c.coll); err != nil {
+		log.Error(err)
+	}
 	// TODO: Check the merkle tree root.
 	return c
 }
@@ -93,26 +365,91 @@ func dup(in []byte) []byte {
 	return append([]byte{}, in...)
 }
 
+// The value of an instance is stored under collValuePrefix || InstanceID and
+// its contract ID under collContractPrefix || InstanceID.
+const (
+	collValuePrefix    = 0
+	collContractPrefix = 1
+)
+
+func collValueKey(id []byte) []byte {
+	return append([]byte{collValuePrefix}, id...)
+}
+
+func collContractKey(id []byte) []byte {
+	return append([]byte{collContractPrefix}, id...)
+}
+
+// collectionSchema holds the migrations of the buckets of the collections.
+var collectionSchema = migration.Schema{
+	{
+		Description: "prefix the keys of the values and of the contracts",
+		Run:         migratePrefixedKeys,
+	},
+}
+
+// upgradeCollection creates the bucket of a collection if needed and
+// migrates it to the latest layout.
+func upgradeCollection(db *bolt.DB, name []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		_, err := collectionSchema.Upgrade(tx, name)
+		return err
+	})
+}
+
+// migratePrefixedKeys moves the values from InstanceID and the contracts
+// from 'C' || InstanceID to the prefixed keys. The old layout couldn't tell
+// the contract keys from the instances whose ID starts with 'C', so a key
+// starting with 'C' is only a contract key if the instance exists.
+func migratePrefixedKeys(tx *bolt.Tx, name []byte) error {
+	b := tx.Bucket(name)
+	var old [][]byte
+	var moved [][2][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		old = append(old, dup(k))
+		if len(k) > 0 && k[0] == 'C' && b.Get(k[1:]) != nil {
+			return nil
+		}
+		cv := b.Get(append([]byte{'C'}, k...))
+		if cv == nil {
+			return fmt.Errorf("contract type missing for object ID %x", k)
+		}
+		moved = append(moved, [2][]byte{collValueKey(k), dup(v)},
+			[2][]byte{collContractKey(k), dup(cv)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range old {
+		if err = b.Delete(k); err != nil {
+			return err
+		}
+	}
+	for _, kv := range moved {
+		if err = b.Put(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *collectionDB) loadAll() error {
 	return c.db.View(func(tx *bolt.Tx) error {
 		// Assume bucket exists and has keys
 		b := tx.Bucket([]byte(c.bucketName))
 		cur := b.Cursor()
 
-		for k, v := cur.First(); k != nil; k, v = cur.Next() {
-			// This is a Contract key, skip it.
-			if len(k) > 0 && k[0] == 'C' {
-				continue
-			}
-			kc := make([]byte, len(k)+1)
-			kc[0] = 'C'
-			copy(kc[1:], k)
-
-			cv := b.Get(kc)
+		for k, v := cur.Seek([]byte{collValuePrefix}); k != nil && k[0] == collValuePrefix; k, v = cur.Next() {
+			id := k[1:]
+			cv := b.Get(collContractKey(id))
 			if cv == nil {
-				return fmt.Errorf("contract ype missing for object ID %x", k)
+				return fmt.Errorf("contract type missing for object ID %x", id)
 			}
-			err := c.coll.Add(dup(k), dup(v), dup(cv))
+			err := c.coll.Add(dup(id), dup(v), dup(cv))
 			if err != nil {
 				return err
 			}
@@ -151,25 +488,21 @@ func (c *collectionDB) Store(t *StateChange) error {
 	if err := storeInColl(c.coll, t); err != nil {
 		return err
 	}
+	c.auth.invalidate(t)
 	err := c.db.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(c.bucketName))
 
-		// The contract type is stored in a key starting with C
-		keyC := make([]byte, 1+len(t.InstanceID))
-		keyC[0] = byte('C')
-		copy(keyC[1:], t.InstanceID)
-
 		switch t.StateAction {
 		case Create, Update:
-			if err := bucket.Put(t.InstanceID, t.Value); err != nil {
+			if err := bucket.Put(collValueKey(t.InstanceID), t.Value); err != nil {
 				return err
 			}
-			return bucket.Put(keyC, t.ContractID)
+			return bucket.Put(collContractKey(t.InstanceID), t.ContractID)
 		case Remove:
-			if err := bucket.Delete(t.InstanceID); err != nil {
+			if err := bucket.Delete(collValueKey(t.InstanceID)); err != nil {
 				return err
 			}
-			return bucket.Delete(keyC)
+			return bucket.Delete(collContractKey(t.InstanceID))
 		default:
 			return errors.New("invalid state action")
 		}
@@ -258,12 +591,45 @@ func (c *collectionDB) tryHash(ts []StateChange) (mr []byte, rerr error) {
 // call it whenever a contract needs to be done.
 // GetService makes it possible to give either an `onet.Context` or
 // `onet.Server` to `RegisterContract`.
-func RegisterContract(s skipchain.GetService, kind string, f OmniLedgerContract) error {
+// A contract function can be given as OmniLedgerContract(f).
+func RegisterContract(s skipchain.GetService, kind string, c Contract) error {
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	return scs.(*Service).registerContract(kind, c)
+}
+
+// OmniLedgerView is the type signature of the read-only functions of a
+// contract that can be registered with RegisterView. They get the instance
+// the view is called on and return the result to the client.
+type OmniLedgerView func(coll CollectionView, id InstanceID, args Arguments) ([]byte, error)
+
+// RegisterView stores the view so that clients can call it with CallView on
+// the instances of the contract kind.
+func RegisterView(s skipchain.GetService, kind, name string, f OmniLedgerView) error {
 	scs := s.Service(ServiceName)
 	if scs == nil {
 		return errors.New("Didn't find our service: " + ServiceName)
 	}
-	return scs.(*Service).registerContract(kind, f)
+	return scs.(*Service).registerView(kind, name, f)
+}
+
+// IdentityVerifier is the type signature of the functions that can be
+// registered with RegisterIdentityVerifier. They check that the identity id,
+// which signed instr, is valid given the state of the chain, e.g., that a
+// pop-token has been issued.
+type IdentityVerifier func(coll CollectionView, instr Instruction, id darc.Identity) error
+
+// RegisterIdentityVerifier stores the verifier for the identities of the
+// given type, as returned by darc.Identity.TypeString. It is called for every
+// signer of that type after the signatures have been verified.
+func RegisterIdentityVerifier(s skipchain.GetService, idType string, v IdentityVerifier) error {
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	return scs.(*Service).registerIdentityVerifier(idType, v)
 }
 
 type olState struct {
@@ -273,8 +639,16 @@ type olState struct {
 	// waitChannels will be informed by Service.updateCollection that a
 	// given ClientTransaction has been included. updateCollection will
 	// send true for a valid ClientTransaction and false for an invalid
-	// ClientTransaction.
-	waitChannels map[string]chan bool
+	// ClientTransaction. Many clients can wait for the same transaction.
+	waitChannels map[string][]chan bool
+	// waiting is the number of channels in waitChannels, which can't be
+	// more than maxWaiters. maxInclusionWait caps how long a client waits.
+	waiting          int
+	maxWaiters       int
+	maxInclusionWait time.Duration
+	// viewChanges counts the view-changes of every omniledger since the
+	// service started.
+	viewChanges map[string]int
 }
 
 func (ol *olState) setLast(sb *skipchain.SkipBlock) {
@@ -289,25 +663,60 @@ func (ol *olState) getLast(id skipchain.SkipBlockID) skipchain.SkipBlockID {
 	return ol.lastBlock[string(id)]
 }
 
-func (ol *olState) createWaitChannel(ctxHash []byte) chan bool {
+// createWaitChannel registers a new channel for the transaction with the hash
+// ctxHash. It returns ErrTooManyWaiters if maxWaiters channels are already
+// registered.
+func (ol *olState) createWaitChannel(ctxHash []byte) (chan bool, error) {
 	ol.Lock()
 	defer ol.Unlock()
+	if ol.waiting >= ol.maxWaiters {
+		return nil, ErrTooManyWaiters
+	}
 	ch := make(chan bool, 1)
-	ol.waitChannels[string(ctxHash)] = ch
-	return ch
+	ol.waitChannels[string(ctxHash)] = append(ol.waitChannels[string(ctxHash)], ch)
+	ol.waiting++
+	return ch, nil
 }
 
+// informWaitChannel sends valid to the channels of the transaction with the
+// hash ctxHash. It never blocks, a channel that already got a result keeps it.
 func (ol *olState) informWaitChannel(ctxHash []byte, valid bool) {
 	ol.Lock()
 	defer ol.Unlock()
-	ch := ol.waitChannels[string(ctxHash)]
-	if ch != nil {
-		ch <- valid
+	for _, ch := range ol.waitChannels[string(ctxHash)] {
+		select {
+		case ch <- valid:
+		default:
+		}
+	}
+}
+
+func (ol *olState) deleteWaitChannel(ctxHash []byte, ch chan bool) {
+	ol.Lock()
+	defer ol.Unlock()
+	chs := ol.waitChannels[string(ctxHash)]
+	for i, c := range chs {
+		if c == ch {
+			chs = append(chs[:i], chs[i+1:]...)
+			ol.waiting--
+			break
+		}
+	}
+	if len(chs) == 0 {
+		delete(ol.waitChannels, string(ctxHash))
+	} else {
+		ol.waitChannels[string(ctxHash)] = chs
 	}
 }
 
-func (ol *olState) deleteWaitChannel(ctxHash []byte) {
+// inclusionWait returns how long a client can wait for blocks blocks of the
+// given interval.
+func (ol *olState) inclusionWait(blocks int, interval time.Duration) time.Duration {
 	ol.Lock()
 	defer ol.Unlock()
-	delete(ol.waitChannels, string(ctxHash))
+	wait := time.Duration(blocks) * interval
+	if wait > ol.maxInclusionWait || wait < 0 {
+		return ol.maxInclusionWait
+	}
+	return wait
 }
@@ -7,6 +7,11 @@ import (
 	"testing"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority/migration"
+	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/darc/expression"
+	"github.com/dedis/onet"
 	"github.com/stretchr/testify/require"
 )
 
@@ -120,6 +125,53 @@ func TestCollectionDB(t *testing.T) {
 	}
 }
 
+func TestCollectionDBMigration(t *testing.T) {
+	tmpDB, err := ioutil.TempFile("", "tmpDB")
+	require.Nil(t, err)
+	tmpDB.Close()
+	defer os.Remove(tmpDB.Name())
+
+	db, err := bolt.Open(tmpDB.Name(), 0600, nil)
+	require.Nil(t, err)
+	defer db.Close()
+
+	// Store the instances with the layout of older versions, including
+	// one whose ID starts with 'C'.
+	pairs := map[string]string{"key": "value", "Cinst": "value2"}
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(testName)
+		if err != nil {
+			return err
+		}
+		for k, v := range pairs {
+			if err = b.Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+			if err = b.Put([]byte("C"+k), []byte("contract")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	for i := 0; i < 2; i++ {
+		cdb := newCollectionDB(db, testName)
+		for k, v := range pairs {
+			stored, contract, err := cdb.GetValueContract([]byte(k))
+			require.Nil(t, err)
+			require.Equal(t, v, string(stored))
+			require.Equal(t, "contract", string(contract))
+		}
+	}
+	require.Nil(t, db.View(func(tx *bolt.Tx) error {
+		v, err := migration.Version(tx, testName)
+		require.Nil(t, err)
+		require.Equal(t, collectionSchema.Current(), v)
+		require.Equal(t, 2*len(pairs), tx.Bucket(testName).Stats().KeyN)
+		return nil
+	}))
+}
+
 // TODO: Test good case, bad add case, bad remove case
 func TestCollectionDBtryHash(t *testing.T) {
 	tmpDB, err := ioutil.TempFile("", "tmpDB")
@@ -155,3 +207,113 @@ func TestCollectionDBtryHash(t *testing.T) {
 	mrReal := cdb.RootHash()
 	require.Equal(t, mrTrial, mrReal)
 }
+
+func TestOverlayView(t *testing.T) {
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+	for _, key := range []string{"keep", "update", "remove"} {
+		sc := StateChange{StateAction: Create, InstanceID: []byte(key), ContractID: []byte("c"), Value: []byte(key)}
+		require.Nil(t, storeInColl(coll.c, &sc))
+	}
+	root := coll.c.GetRoot()
+
+	o := newOverlayView(coll)
+	require.Nil(t, o.store(StateChange{StateAction: Update, InstanceID: []byte("update"), ContractID: []byte("c"),
+		Value: []byte("new")}))
+	require.Nil(t, o.store(StateChange{StateAction: Remove, InstanceID: []byte("remove")}))
+	require.Nil(t, o.store(StateChange{StateAction: Create, InstanceID: []byte("create"), ContractID: []byte("c2"),
+		Value: []byte("created")}))
+	require.NotNil(t, o.store(StateChange{StateAction: Create, InstanceID: []byte("keep")}))
+	require.NotNil(t, o.store(StateChange{StateAction: Update, InstanceID: []byte("remove")}))
+	require.NotNil(t, o.store(StateChange{StateAction: Remove, InstanceID: []byte("missing")}))
+
+	for key, value := range map[string]string{"keep": "keep", "update": "new", "create": "created"} {
+		v, _, err := o.GetValues([]byte(key))
+		require.Nil(t, err)
+		require.Equal(t, []byte(value), v)
+		rec, err := o.Get([]byte(key)).Record()
+		require.Nil(t, err)
+		require.True(t, rec.Match())
+		v, _, err = getValuesFromRecord(rec, []byte(key))
+		require.Nil(t, err)
+		require.Equal(t, []byte(value), v)
+	}
+	_, cid, err := o.GetValues([]byte("create"))
+	require.Nil(t, err)
+	require.Equal(t, "c2", cid)
+	_, _, err = o.GetValues([]byte("remove"))
+	require.NotNil(t, err)
+	rec, err := o.Get([]byte("remove")).Record()
+	require.Nil(t, err)
+	require.False(t, rec.Match())
+
+	// The base is not changed.
+	require.Equal(t, root, coll.c.GetRoot())
+	v, _, err := coll.GetValues([]byte("update"))
+	require.Nil(t, err)
+	require.Equal(t, []byte("update"), v)
+}
+
+func TestCallContract(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	hosts, _, _ := local.GenTree(1, false)
+	s := local.GetServices(hosts, OmniledgerID)[0].(*Service)
+
+	// caller spawns a dummy instance by calling the dummy contract.
+	s.registerContract(dummyKind, OmniLedgerContract(dummyContractFunc))
+	s.registerContract("caller", OmniLedgerContract(func(coll CollectionView, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
+		return CallContract(coll, Instruction{
+			InstanceID: inst.InstanceID,
+			Spawn:      &Spawn{ContractID: dummyKind, Args: inst.Spawn.Args},
+		}, c)
+	}))
+	// recursive calls itself until the depth is exceeded.
+	s.registerContract("recursive", OmniLedgerContract(func(coll CollectionView, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
+		return CallContract(coll, inst, c)
+	}))
+
+	// The darc of the instances lets the caller contract spawn dummy
+	// instances, and the recursive instance spawn itself.
+	owner := darc.NewSignerEd25519(nil, nil).Identity()
+	d := darc.NewDarc(darc.InitRules([]darc.Identity{owner}, []darc.Identity{owner}), []byte("calls"))
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+	inst := Instruction{
+		InstanceID: InstanceID{DarcID: d.GetBaseID(), SubID: genSubID()},
+		Spawn: &Spawn{
+			ContractID: "caller",
+			Args:       Arguments{{Name: "data", Value: []byte("value")}},
+		},
+	}
+	storeDarc := func() {
+		dBuf, err := d.ToProto()
+		require.Nil(t, err)
+		sc := NewStateChange(Create, InstanceID{DarcID: d.GetBaseID()}, ContractDarcID, dBuf)
+		coll = &roCollection{collection.New(collection.Data{}, collection.Data{})}
+		require.Nil(t, storeInColl(coll.c, &sc))
+	}
+	storeDarc()
+	_, _, err := s.executeInstruction(coll, nil, inst)
+	require.NotNil(t, err, "the darc has no rule for the call")
+
+	require.Nil(t, d.Rules.AddRule(darc.Action("spawn:"+dummyKind), expression.Expr(ContractIdentity("other"))))
+	storeDarc()
+	_, _, err = s.executeInstruction(coll, nil, inst)
+	require.NotNil(t, err, "the rule doesn't allow the caller")
+
+	require.Nil(t, d.Rules.UpdateRule(darc.Action("spawn:"+dummyKind), expression.InitOrExpr(ContractIdentity("other"),
+		ContractIdentity("caller"))))
+	require.Nil(t, d.Rules.AddRule("spawn:recursive", expression.Expr(InstanceIdentity(inst.InstanceID))))
+	storeDarc()
+	scs, _, err := s.executeInstruction(coll, nil, inst)
+	require.Nil(t, err)
+	require.Equal(t, StateChanges{NewStateChange(Create, inst.InstanceID, dummyKind, []byte("value"))}, scs)
+
+	inst.Spawn.ContractID = "recursive"
+	_, _, err = s.executeInstruction(coll, nil, inst)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "nested deeper")
+
+	// Contracts can only be called from within a contract.
+	_, _, err = CallContract(coll, inst, nil)
+	require.NotNil(t, err)
+}
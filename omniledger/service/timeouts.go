@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/skipchain"
+)
+
+// propagationIntervals is the number of block intervals the propagation of
+// a new block may take, if the configuration has no PropagationTimeout.
+const propagationIntervals = 20
+
+// defaultPropagationTimeout is used as long as the conode holds no
+// skipchain.
+const defaultPropagationTimeout = 120 * time.Second
+
+// propagationTimeout returns how long the propagation of a new block and of
+// its signature may take.
+func (c ChainConfig) propagationTimeout() time.Duration {
+	if c.PropagationTimeout > 0 {
+		return c.PropagationTimeout
+	}
+	return propagationIntervals * c.BlockInterval
+}
+
+// protocolTimeout returns how long the leader waits for the transactions and
+// the decryptions of the other nodes.
+func (c ChainConfig) protocolTimeout() time.Duration {
+	if c.ProtocolTimeout > 0 {
+		return c.ProtocolTimeout
+	}
+	return c.BlockInterval / 2
+}
+
+// checkTimeouts returns an error if the timeouts of the configuration are
+// invalid.
+func (c ChainConfig) checkTimeouts() error {
+	if c.PropagationTimeout < 0 || c.ProtocolTimeout < 0 {
+		return errors.New("negative timeout")
+	}
+	if c.ProtocolTimeout >= c.BlockInterval {
+		return errors.New("the protocol timeout must be shorter than the block interval")
+	}
+	return nil
+}
+
+// propagationTimeouts holds the propagation timeouts of the skipchains. The
+// skipchain service has one timeout for all skipchains, so it gets the
+// longest one.
+type propagationTimeouts struct {
+	sync.Mutex
+	chains map[string]time.Duration
+	// override replaces the timeouts of the skipchains if it is not zero.
+	override time.Duration
+	// current is the timeout of the skipchain service.
+	current time.Duration
+}
+
+func newPropagationTimeouts() propagationTimeouts {
+	return propagationTimeouts{chains: make(map[string]time.Duration)}
+}
+
+// max returns the timeout for the skipchain service. The lock must be held.
+func (p *propagationTimeouts) max() time.Duration {
+	if p.override > 0 {
+		return p.override
+	}
+	var max time.Duration
+	for _, t := range p.chains {
+		if t > max {
+			max = t
+		}
+	}
+	if max == 0 {
+		return defaultPropagationTimeout
+	}
+	return max
+}
+
+// SetPropagationTimeout overrides the propagation timeout that is derived
+// from the configuration of the skipchains. It is used when a new block is
+// announced to the nodes as well as by the skipchain propagation. A timeout
+// of zero removes the override.
+func (s *Service) SetPropagationTimeout(p time.Duration) {
+	s.propTimeouts.Lock()
+	s.propTimeouts.override = p
+	s.propTimeouts.Unlock()
+	s.updatePropagationTimeout()
+}
+
+// loadPropagationTimeout reads the propagation timeout of the skipchain scID
+// from its configuration.
+func (s *Service) loadPropagationTimeout(scID skipchain.SkipBlockID) error {
+	config, err := s.LoadConfig(scID)
+	if err != nil {
+		return err
+	}
+	s.propTimeouts.Lock()
+	s.propTimeouts.chains[string(scID)] = config.propagationTimeout()
+	s.propTimeouts.Unlock()
+	s.updatePropagationTimeout()
+	return nil
+}
+
+// updatePropagationTimeout passes the propagation timeout to the skipchain
+// service if it changed.
+func (s *Service) updatePropagationTimeout() {
+	s.propTimeouts.Lock()
+	defer s.propTimeouts.Unlock()
+	if t := s.propTimeouts.max(); t != s.propTimeouts.current {
+		s.propTimeouts.current = t
+		s.skService().SetPropTimeout(t)
+	}
+}
+
+// loadProtocolTimeout returns the protocol timeout of the skipchain scID, or
+// half of the interval if the configuration can't be read.
+func (s *Service) loadProtocolTimeout(scID skipchain.SkipBlockID, interval time.Duration) time.Duration {
+	config, err := s.LoadConfig(scID)
+	if err != nil {
+		return interval / 2
+	}
+	return config.protocolTimeout()
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainConfig_Timeouts(t *testing.T) {
+	c := ChainConfig{BlockInterval: time.Second}
+	require.Equal(t, propagationIntervals*time.Second, c.propagationTimeout())
+	require.Equal(t, time.Second/2, c.protocolTimeout())
+	require.Nil(t, c.checkTimeouts())
+
+	c.PropagationTimeout = time.Minute
+	c.ProtocolTimeout = time.Second / 4
+	require.Equal(t, time.Minute, c.propagationTimeout())
+	require.Equal(t, time.Second/4, c.protocolTimeout())
+	require.Nil(t, c.checkTimeouts())
+
+	c.ProtocolTimeout = time.Second
+	require.NotNil(t, c.checkTimeouts())
+	c.ProtocolTimeout = 0
+	c.PropagationTimeout = -1
+	require.NotNil(t, c.checkTimeouts())
+}
+
+func TestService_PropagationTimeout(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	current := func() time.Duration {
+		s.service().propTimeouts.Lock()
+		defer s.service().propTimeouts.Unlock()
+		return s.service().propTimeouts.current
+	}
+	require.Equal(t, propagationIntervals*testInterval, current())
+	s.service().SetPropagationTimeout(time.Second)
+	require.Equal(t, time.Second, current())
+	s.service().SetPropagationTimeout(0)
+	require.Equal(t, propagationIntervals*testInterval, current())
+
+	// The timeout follows the configuration of the skipchain.
+	s.sendTx(t, configTx(t, s, ChainConfig{
+		BlockInterval:      s.interval,
+		Roster:             *s.roster,
+		PropagationTimeout: 42 * time.Second,
+	}))
+	for i := 0; i < 10 && current() != 42*time.Second; i++ {
+		time.Sleep(s.interval)
+	}
+	require.Equal(t, 42*time.Second, current())
+}
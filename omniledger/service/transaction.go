@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"sync"
 
 	"github.com/dedis/cothority"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/dedis/cothority/omniledger/collection"
 	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/skipchain"
 	"github.com/dedis/protobuf"
 )
 
@@ -89,6 +91,42 @@ func (args Arguments) Search(name string) []byte {
 	return nil
 }
 
+// Bytes returns the value of the argument name, or an error if it is
+// missing.
+func (args Arguments) Bytes(name string) ([]byte, error) {
+	v := args.Search(name)
+	if v == nil {
+		return nil, fmt.Errorf("argument \"%s\" is missing", name)
+	}
+	return v, nil
+}
+
+// Uint64 returns the value of the argument name, which must be a 64-bit uint
+// in LittleEndian.
+func (args Arguments) Uint64(name string) (uint64, error) {
+	v, err := args.Bytes(name)
+	if err != nil {
+		return 0, err
+	}
+	if len(v) != 8 {
+		return 0, fmt.Errorf("argument \"%s\" is not a 64-bit uint", name)
+	}
+	return binary.LittleEndian.Uint64(v), nil
+}
+
+// Decode decodes the protobuf-encoded value of the argument name into msg.
+func (args Arguments) Decode(name string, msg interface{}) error {
+	v, err := args.Bytes(name)
+	if err != nil {
+		return err
+	}
+	err = protobuf.DecodeWithConstructors(v, msg, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return fmt.Errorf("couldn't decode argument \"%s\": %v", name, err)
+	}
+	return nil
+}
+
 // Hash computes the digest of the hash function
 func (instr Instruction) Hash() []byte {
 	h := sha256.New()
@@ -116,6 +154,25 @@ func (instr Instruction) Hash() []byte {
 		h.Write([]byte(a.Name))
 		h.Write(a.Value)
 	}
+	// The instructions without an expiration keep the hash they had
+	// before it existed.
+	if e := instr.ValidUntil; e != nil {
+		h.Write([]byte("validuntil"))
+		b := make([]byte, 16)
+		binary.LittleEndian.PutUint64(b, uint64(e.BlockIndex))
+		binary.LittleEndian.PutUint64(b[8:], uint64(e.ChainTime))
+		h.Write(b)
+	}
+	// The proofs of foreign darcs are covered by the signatures, so that
+	// nobody can replace them with older ones. The latest block fixes the
+	// darc of the proof.
+	if len(instr.DarcProofs) > 0 {
+		h.Write([]byte("darcproofs"))
+		for _, p := range instr.DarcProofs {
+			h.Write(p.Latest.Hash)
+			h.Write(p.InclusionProof.Key)
+		}
+	}
 	return h.Sum(nil)
 }
 
@@ -206,8 +263,25 @@ func (instr Instruction) String() string {
 	return out
 }
 
-// SignBy gets signers to sign the (receiver) transaction.
+// SignBy gets signers to sign the (receiver) transaction. It uses the legacy
+// request hashing which does not include the skipchain ID, so the signatures
+// can be replayed on another skipchain with the same darc.
+//
+// Deprecated: use SignWith, which binds the signatures to a skipchain.
 func (instr *Instruction) SignBy(signers ...darc.Signer) error {
+	instr.SignatureVersion = darc.RequestVersionLegacy
+	return instr.sign(nil, signers...)
+}
+
+// SignWith gets signers to sign the (receiver) transaction using the
+// current version of the request hashing. The signature is only valid on the
+// skipchain given by scID.
+func (instr *Instruction) SignWith(scID skipchain.SkipBlockID, signers ...darc.Signer) error {
+	instr.SignatureVersion = darc.CurrentRequestVersion
+	return instr.sign(scID, signers...)
+}
+
+func (instr *Instruction) sign(scID skipchain.SkipBlockID, signers ...darc.Signer) error {
 	// Create the request and populate it with the right identities.  We
 	// need to do this prior to signing because identities are a part of
 	// the digest.
@@ -217,7 +291,7 @@ func (instr *Instruction) SignBy(signers ...darc.Signer) error {
 	}
 	instr.Signatures = sigs
 
-	req, err := instr.ToDarcRequest()
+	req, err := instr.ToDarcRequest(scID)
 	if err != nil {
 		return err
 	}
@@ -242,8 +316,10 @@ func (instr *Instruction) SignBy(signers ...darc.Signer) error {
 	return nil
 }
 
-// ToDarcRequest converts the Instruction content into a darc.Request.
-func (instr Instruction) ToDarcRequest() (*darc.Request, error) {
+// ToDarcRequest converts the Instruction content into a darc.Request. The
+// skipchain ID is only part of the request if the instruction has been signed
+// with darc.RequestVersion1 or later.
+func (instr Instruction) ToDarcRequest(scID skipchain.SkipBlockID) (*darc.Request, error) {
 	baseID := instr.InstanceID.DarcID
 	action := instr.Action()
 	ids := make([]darc.Identity, len(instr.Signatures))
@@ -266,9 +342,66 @@ func (instr Instruction) ToDarcRequest() (*darc.Request, error) {
 	} else {
 		req = darc.InitRequest(baseID, darc.Action(action), instr.Hash(), ids, sigs)
 	}
+	req.Version = instr.SignatureVersion
+	if req.Version >= darc.RequestVersion1 {
+		req.SkipchainID = scID
+	}
+	if req.Version == darc.RequestVersionHardware {
+		req.Details = instr.hardwareDetails()
+	}
 	return &req, nil
 }
 
+// maxShownValue is the size of the largest argument that is shown as text on
+// a hardware wallet. Values that aren't text are shown in hex up to half of
+// this size, larger values only by their size and hash.
+const maxShownValue = 64
+
+// hardwareDetails returns the lines that describe the instruction on a
+// hardware wallet, besides its action and its darc: the instance that is
+// invoked or deleted, the arguments and the expiry.
+func (instr Instruction) hardwareDetails() []string {
+	var lines []string
+	var args Arguments
+	switch {
+	case instr.Spawn != nil:
+		args = instr.Spawn.Args
+	case instr.Invoke != nil:
+		lines = append(lines, fmt.Sprintf("instance %x", instr.InstanceID.SubID[:]))
+		args = instr.Invoke.Args
+	case instr.Delete != nil:
+		lines = append(lines, fmt.Sprintf("instance %x", instr.InstanceID.SubID[:]))
+	}
+	for _, a := range args {
+		lines = append(lines, a.Name+": "+hardwareValue(a.Value))
+	}
+	if e := instr.ValidUntil; e != nil {
+		lines = append(lines, fmt.Sprintf("valid until block %d and time %d", e.BlockIndex, e.ChainTime))
+	}
+	return lines
+}
+
+// hardwareValue returns how the value of an argument is shown on a hardware
+// wallet.
+func hardwareValue(v []byte) string {
+	if len(v) <= maxShownValue {
+		text := true
+		for _, c := range v {
+			if c < 0x20 || c > 0x7e {
+				text = false
+				break
+			}
+		}
+		if text {
+			return strconv.Quote(string(v))
+		}
+		if len(v) <= maxShownValue/2 {
+			return fmt.Sprintf("%x", v)
+		}
+	}
+	return fmt.Sprintf("%d bytes with sha256 %x", len(v), sha256.Sum256(v))
+}
+
 // Instructions is a slice of Instruction
 type Instructions []Instruction
 
@@ -438,6 +571,13 @@ func (r *txBuffer) take(key string) ClientTransactions {
 	return txs
 }
 
+// empty returns true if no transaction waits to be collected.
+func (r *txBuffer) empty() bool {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.txsMap) == 0
+}
+
 func (r *txBuffer) add(key string, newTx ClientTransaction) {
 	r.Lock()
 	defer r.Unlock()
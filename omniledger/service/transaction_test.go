@@ -1,9 +1,13 @@
 package service
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"testing"
 
 	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/util/random"
 	"github.com/stretchr/testify/require"
 )
 
@@ -103,9 +107,63 @@ func TestTransaction_Signing(t *testing.T) {
 
 	require.Nil(t, instr.SignBy(signer))
 
-	req, err := instr.ToDarcRequest()
+	req, err := instr.ToDarcRequest(nil)
 	require.Nil(t, err)
 	require.Nil(t, req.Verify(d))
+
+	// Signatures with the current version are bound to the skipchain ID.
+	scID := skipchain.SkipBlockID(random.Bits(256, true, random.New()))
+	require.Nil(t, instr.SignWith(scID, signer))
+	req, err = instr.ToDarcRequest(scID)
+	require.Nil(t, err)
+	require.Equal(t, darc.CurrentRequestVersion, req.Version)
+	require.Nil(t, req.Verify(d))
+
+	otherID := skipchain.SkipBlockID(random.Bits(256, true, random.New()))
+	req, err = instr.ToDarcRequest(otherID)
+	require.Nil(t, err)
+	require.NotNil(t, req.Verify(d))
+
+	// Unknown versions are rejected.
+	instr.SignatureVersion = darc.CurrentRequestVersion + 1
+	req, err = instr.ToDarcRequest(scID)
+	require.Nil(t, err)
+	require.NotNil(t, req.Verify(d))
+}
+
+func TestInstruction_HardwareDetails(t *testing.T) {
+	long := make([]byte, maxShownValue+1)
+	instr := Instruction{
+		InstanceID: InstanceID{DarcID: darcidStr("darc"), SubID: subidStr("instance")},
+		Invoke: &Invoke{
+			Command: "transfer",
+			Args: Arguments{
+				{Name: "text", Value: []byte("hello")},
+				{Name: "binary", Value: []byte{1, 2}},
+				{Name: "long", Value: long},
+			},
+		},
+		ValidUntil:       &Expiry{BlockIndex: 10},
+		SignatureVersion: darc.RequestVersionHardware,
+	}
+	scID := skipchain.SkipBlockID(random.Bits(256, true, random.New()))
+	req, err := instr.ToDarcRequest(scID)
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		fmt.Sprintf("instance %x", instr.InstanceID.SubID[:]),
+		`text: "hello"`,
+		"binary: 0102",
+		fmt.Sprintf("long: %d bytes with sha256 %x", len(long), sha256.Sum256(long)),
+		"valid until block 10 and time 0",
+	}, req.Details)
+
+	// Another argument changes the summary that is signed.
+	summary, _ := req.HardwarePayload()
+	instr.Invoke.Args[0].Value = []byte("world")
+	req2, err := instr.ToDarcRequest(scID)
+	require.Nil(t, err)
+	summary2, _ := req2.HardwarePayload()
+	require.NotEqual(t, summary, summary2)
 }
 
 func createOneClientTx(dID darc.ID, kind string, value []byte, signer darc.Signer) (ClientTransaction, error) {
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// ServiceVersion is the version of the behavior of the service. It is
+// increased with every change that makes the conodes disagree on the blocks,
+// for example a new way to execute the transactions. Such a change must only
+// be enabled once the skipchain activated its version, which is returned by
+// ActiveServiceVersion.
+//
+// The nodes send their version to the leader that collects the transactions,
+// and the leader writes them in the header of the new block. Once enough nodes
+// of the roster upgraded, an "invoke:activate_version" instruction on the
+// config points to such a block and stores the version in the configuration.
+// The nodes that didn't upgrade stop verifying the blocks, so the skipchain
+// doesn't fork.
+//
+// Version 2 updates the chain time instance in every block, version 3 accepts
+// transactions with an expiration, version 4 hashes the values of the leaves
+// of the collection, version 5 stores the index of the last roster change in
+// the config, version 6 bounds the darcs by the limits of the config and
+// version 7 caps the size of the new transactions and blocks.
+const ServiceVersion = 7
+
+// ActiveServiceVersion returns the ServiceVersion the skipchain scID
+// activated, 0 if it never activated one.
+func (s *Service) ActiveServiceVersion(scID skipchain.SkipBlockID) (int, error) {
+	config, err := s.LoadConfig(scID)
+	if err != nil {
+		return 0, err
+	}
+	return config.MinServiceVersion, nil
+}
+
+// activateVersion returns the state change that stores the version of the
+// instruction in the configuration. The argument "block" must be the ID of a
+// block of the current roster where a threshold of the nodes advertised this
+// version or a newer one.
+func (s *Service) activateVersion(cdb CollectionView, inst Instruction) ([]StateChange, error) {
+	buf := inst.Invoke.Args.Search("version")
+	if len(buf) != 4 {
+		return nil, errors.New("need a version as a 32-bit number")
+	}
+	version := int(binary.LittleEndian.Uint32(buf))
+	config, err := LoadConfigFromColl(cdb)
+	if err != nil {
+		return nil, err
+	}
+	if version <= config.MinServiceVersion {
+		return nil, fmt.Errorf("version %d is already active", config.MinServiceVersion)
+	}
+	if version > ServiceVersion {
+		return nil, fmt.Errorf("unknown version %d, this conode runs version %d", version, ServiceVersion)
+	}
+
+	scID, err := s.scIDFromGenesisDarc(inst.InstanceID.DarcID)
+	if err != nil {
+		return nil, err
+	}
+	sb := s.db().GetByID(inst.Invoke.Args.Search("block"))
+	if sb == nil || !sb.SkipChainID().Equal(scID) {
+		return nil, errors.New("unknown block")
+	}
+	if !sb.Roster.ID.Equal(config.Roster.ID) {
+		return nil, errors.New("the block doesn't have the current roster")
+	}
+	var header DataHeader
+	if err := protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite)); err != nil {
+		return nil, err
+	}
+	var upgraded int
+	for _, v := range header.Versions {
+		if v >= version {
+			upgraded++
+		}
+	}
+	n := len(sb.Roster.List)
+	if threshold := n - (n-1)/3; upgraded < threshold {
+		return nil, fmt.Errorf("%d of %d nodes run version %d, %d are needed", upgraded, n, version, threshold)
+	}
+
+	config.MinServiceVersion = version
+	configBuf, err := protobuf.Encode(config)
+	if err != nil {
+		return nil, err
+	}
+	return []StateChange{
+		NewStateChange(Update, InstanceID{
+			DarcID: inst.InstanceID.DarcID,
+			SubID:  oneSubID,
+		}, ContractConfigID, configBuf),
+	}, nil
+}
+
+// verifyVersions returns an error if the header of newSB advertises a wrong
+// version for this node, or if the skipchain activated a version this node
+// doesn't have.
+func (s *Service) verifyVersions(cdb CollectionView, newSB *skipchain.SkipBlock, header *DataHeader) error {
+	if len(header.Versions) > 0 {
+		if len(header.Versions) != len(newSB.Roster.List) {
+			return errors.New("the versions don't match the roster")
+		}
+		i, _ := newSB.Roster.Search(s.ServerIdentity().ID)
+		if i >= 0 && header.Versions[i] != 0 && header.Versions[i] != ServiceVersion {
+			return fmt.Errorf("the block has version %d for this node, which runs version %d",
+				header.Versions[i], ServiceVersion)
+		}
+	}
+	// The genesis block has no configuration yet.
+	config, err := LoadConfigFromColl(cdb)
+	if err != nil {
+		return nil
+	}
+	if config.MinServiceVersion > ServiceVersion {
+		return fmt.Errorf("the skipchain needs version %d, this conode runs version %d: please upgrade",
+			config.MinServiceVersion, ServiceVersion)
+	}
+	return nil
+}
+
+// nodeVersions holds, for every skipchain, the ServiceVersion the nodes sent
+// while the transactions of the next block were collected.
+type nodeVersions struct {
+	sync.Mutex
+	chains map[string]map[network.ServerIdentityID]int
+}
+
+func newNodeVersions() nodeVersions {
+	return nodeVersions{chains: make(map[string]map[network.ServerIdentityID]int)}
+}
+
+// clear forgets the versions of the skipchain scID, so that the nodes which
+// don't answer anymore have no version.
+func (v *nodeVersions) clear(scID skipchain.SkipBlockID) {
+	v.Lock()
+	defer v.Unlock()
+	delete(v.chains, string(scID))
+}
+
+func (v *nodeVersions) set(scID skipchain.SkipBlockID, si *network.ServerIdentity, version int) {
+	v.Lock()
+	defer v.Unlock()
+	versions, ok := v.chains[string(scID)]
+	if !ok {
+		versions = make(map[network.ServerIdentityID]int)
+		v.chains[string(scID)] = versions
+	}
+	versions[si.ID] = version
+}
+
+// list returns the versions of the nodes of r, in the order of the roster.
+// The version of own is always ServiceVersion.
+func (v *nodeVersions) list(scID skipchain.SkipBlockID, r *onet.Roster, own *network.ServerIdentity) []int {
+	v.Lock()
+	defer v.Unlock()
+	list := make([]int, len(r.List))
+	for i, si := range r.List {
+		if si.Equal(own) {
+			list[i] = ServiceVersion
+		} else {
+			list[i] = v.chains[string(scID)][si.ID]
+		}
+	}
+	return list
+}
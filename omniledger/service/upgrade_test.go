@@ -0,0 +1,62 @@
+package service
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_ActivateVersion(t *testing.T) {
+	s := newSer(t, 2, testInterval)
+	defer s.local.CloseAll()
+	scID := s.sb.SkipChainID()
+	require.True(t, s.waitProof(t, s.tx.Instructions[0].InstanceID).InclusionProof.Match())
+
+	// The nodes advertise their version in the blocks.
+	latest, err := s.service().db().GetLatestByID(scID)
+	require.Nil(t, err)
+	require.NotEqual(t, 0, latest.Index)
+	_, headerI, err := network.Unmarshal(latest.Data, cothority.Suite)
+	require.Nil(t, err)
+	header := headerI.(*DataHeader)
+	require.Equal(t, []int{ServiceVersion, ServiceVersion, ServiceVersion}, header.Versions)
+	require.Nil(t, s.service().verifyVersions(s.service().getCollection(scID), latest, header))
+
+	activate := func(version uint32) ([]StateChange, error) {
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(buf, version)
+		return s.service().activateVersion(s.service().getCollection(scID), Instruction{
+			InstanceID: InstanceID{DarcID: s.darc.GetBaseID(), SubID: oneSubID},
+			Invoke: &Invoke{
+				Command: "activate_version",
+				Args: Arguments{
+					{Name: "version", Value: buf},
+					{Name: "block", Value: latest.Hash},
+				},
+			},
+		})
+	}
+	_, err = activate(ServiceVersion + 1)
+	require.NotNil(t, err)
+	scs, err := activate(ServiceVersion)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(scs))
+	var config ChainConfig
+	require.Nil(t, protobuf.DecodeWithConstructors(scs[0].Value, &config,
+		network.DefaultConstructors(cothority.Suite)))
+	require.Equal(t, ServiceVersion, config.MinServiceVersion)
+
+	version, err := s.service().ActiveServiceVersion(scID)
+	require.Nil(t, err)
+	require.Equal(t, 0, version)
+
+	// A block with a wrong version for the node is refused.
+	header.Versions = []int{ServiceVersion + 1, ServiceVersion, ServiceVersion}
+	require.NotNil(t, s.service().verifyVersions(s.service().getCollection(scID), latest, header))
+	header.Versions = []int{ServiceVersion}
+	require.NotNil(t, s.service().verifyVersions(s.service().getCollection(scID), latest, header))
+}
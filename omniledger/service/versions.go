@@ -0,0 +1,231 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+)
+
+// A contract can be registered in more than one version, so that an upgrade
+// of the conodes doesn't change how the existing instances are executed. New
+// instances are spawned with the latest version. If a contract has more than
+// one version, the version of every instance is stored under its versionKey,
+// else nothing is stored and the instance has version 1.
+//
+// When an instance of an older version is invoked or deleted, it is migrated
+// one version after the other, as long as the next version implements
+// Migrator. The instruction is then executed by the version the instance has
+// been migrated to.
+
+// contractVersionID is the contract of the records holding the version of
+// an instance.
+const contractVersionID = "contract_version"
+
+// Migrator is implemented by the versions of a contract that can upgrade
+// the instances of the previous version.
+type Migrator interface {
+	// Migrate returns the state changes that upgrade the instance id from
+	// version from to the version of this contract. The version record is
+	// updated by the service.
+	Migrate(coll CollectionView, id InstanceID, from uint32) ([]StateChange, error)
+}
+
+// RegisterContractVersion stores the given version of the contract. The
+// latest version is used for new instances, and version 1 is the same as
+// registering with RegisterContract.
+func RegisterContractVersion(s skipchain.GetService, kind string, version uint32, c Contract) error {
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	return scs.(*Service).registerContractVersion(kind, version, c)
+}
+
+// LoadContractVersion returns the version of the contract that the instance
+// id has been created with or migrated to.
+func LoadContractVersion(coll CollectionView, id InstanceID) (uint32, error) {
+	key := versionKey(id).Slice()
+	rec, err := coll.Get(key).Record()
+	if err != nil {
+		return 0, err
+	}
+	if !rec.Match() {
+		// Instances of contracts with one version don't have a record.
+		return 1, nil
+	}
+	value, contractID, err := getValuesFromRecord(rec, key)
+	if err != nil {
+		return 0, err
+	}
+	if contractID != contractVersionID || len(value) != 4 {
+		return 0, errors.New("invalid version record")
+	}
+	return binary.LittleEndian.Uint32(value), nil
+}
+
+// versionKey returns the key of the version record of the instance id.
+func versionKey(id InstanceID) InstanceID {
+	h := sha256.New()
+	h.Write([]byte(contractVersionID))
+	h.Write(id.Slice())
+	return InstanceID{DarcID: id.DarcID, SubID: NewSubID(h.Sum(nil))}
+}
+
+// versionStateChange returns the state change that stores version as the
+// version of the instance id.
+func versionStateChange(coll CollectionView, id InstanceID, version uint32) StateChange {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, version)
+	action := Update
+	if _, _, err := coll.GetValues(versionKey(id).Slice()); err != nil {
+		action = Create
+	}
+	return NewStateChange(action, versionKey(id), contractVersionID, buf)
+}
+
+func (s *Service) registerContractVersion(kind string, version uint32, c Contract) error {
+	if version < 1 {
+		return errors.New("contract versions start at 1")
+	}
+	if s.contractVersions[kind] == nil {
+		s.contractVersions[kind] = make(map[uint32]Contract)
+	}
+	s.contractVersions[kind][version] = c
+	if version == s.latestVersion(kind) {
+		s.contracts[kind] = c
+	}
+	return nil
+}
+
+// latestVersion returns the highest registered version of the contract.
+func (s *Service) latestVersion(kind string) uint32 {
+	var latest uint32
+	for v := range s.contractVersions[kind] {
+		if v > latest {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// migrate returns the version of the contract that executes instructions
+// on the instance id, together with the collection and the state changes of
+// the migrations done before. The migrations are stored in a copy-on-write
+// view of coll.
+func (s *Service) migrate(coll CollectionView, kind string, id InstanceID) (Contract, CollectionView, StateChanges, error) {
+	latest := s.latestVersion(kind)
+	if latest <= 1 {
+		return s.contracts[kind], coll, nil, nil
+	}
+	v, err := LoadContractVersion(coll, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if v > latest {
+		return nil, nil, nil, fmt.Errorf("instance has version %d of %s, but the latest known is %d",
+			v, kind, latest)
+	}
+	var scs StateChanges
+	var overlay *overlayView
+	for ; v < latest; v++ {
+		m, ok := s.contractVersions[kind][v+1].(Migrator)
+		if !ok {
+			break
+		}
+		if overlay == nil {
+			overlay = newOverlayView(coll)
+			coll = overlay
+		}
+		log.Lvlf3("%s: migrating %x to version %d of %s", s.ServerIdentity(), id.Slice(), v+1, kind)
+		mscs, err := m.Migrate(coll, id, v)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("couldn't migrate to version %d: %v", v+1, err)
+		}
+		mscs = append(mscs, versionStateChange(coll, id, v+1))
+		for _, sc := range mscs {
+			if err := overlay.store(sc); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		scs = append(scs, mscs...)
+	}
+	c, ok := s.contractVersions[kind][v]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("version %d of %s is not registered", v, kind)
+	}
+	return c, coll, scs, nil
+}
+
+// recordVersions adds the version records of the instances created in scs,
+// and removes them for the instances removed in scs.
+func (s *Service) recordVersions(coll CollectionView, scs StateChanges) StateChanges {
+	var records StateChanges
+	for _, sc := range scs {
+		kind := string(sc.ContractID)
+		if kind == contractVersionID {
+			continue
+		}
+		id := NewInstanceID(sc.InstanceID)
+		switch sc.StateAction {
+		case Create:
+			if latest := s.latestVersion(kind); latest > 1 {
+				records = append(records, versionStateChange(coll, id, latest))
+			}
+		case Remove:
+			if _, _, err := coll.GetValues(versionKey(id).Slice()); err == nil {
+				records = append(records, NewStateChange(Remove, versionKey(id), contractVersionID, nil))
+			}
+		}
+	}
+	return append(scs, records...)
+}
+
+// contractRegistry returns all registered contracts with their versions,
+// sorted by contract ID.
+func (s *Service) contractRegistry() []ContractInfo {
+	var infos []ContractInfo
+	for kind, versions := range s.contractVersions {
+		info := ContractInfo{ContractID: kind}
+		for v := range versions {
+			info.Versions = append(info.Versions, v)
+		}
+		sort.Slice(info.Versions, func(i, j int) bool { return info.Versions[i] < info.Versions[j] })
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ContractID < infos[j].ContractID })
+	return infos
+}
+
+// checkContracts returns an error naming the first contract used by the
+// transactions that is not registered on this node, or whose instance has a
+// newer version than the registered ones. Instances spawned in the same
+// transactions are not checked.
+func (s *Service) checkContracts(coll CollectionView, cts ClientTransactions) error {
+	for _, ct := range cts {
+		for _, instr := range ct.Instructions {
+			if instr.Spawn != nil {
+				if _, ok := s.contracts[instr.Spawn.ContractID]; !ok {
+					return fmt.Errorf("contract %s is not registered", instr.Spawn.ContractID)
+				}
+				continue
+			}
+			kind, _, err := instr.GetContractState(coll)
+			if err != nil {
+				continue
+			}
+			if _, ok := s.contracts[kind]; !ok {
+				return fmt.Errorf("contract %s is not registered", kind)
+			}
+			v, err := LoadContractVersion(coll, instr.InstanceID)
+			if err == nil && v > s.latestVersion(kind) {
+				return fmt.Errorf("version %d of contract %s is not registered", v, kind)
+			}
+		}
+	}
+	return nil
+}
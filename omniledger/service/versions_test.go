@@ -0,0 +1,145 @@
+package service
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/dedis/cothority/omniledger/collection"
+	"github.com/dedis/onet"
+	"github.com/stretchr/testify/require"
+)
+
+// newVersionedContract returns a contract that stores name on spawn and on
+// invoke.
+func newVersionedContract(name string) BasicContract {
+	store := func(action StateAction) OmniLedgerContract {
+		return func(coll CollectionView, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
+			return []StateChange{NewStateChange(action, inst.InstanceID, "versioned", []byte(name))}, c, nil
+		}
+	}
+	return BasicContract{
+		SpawnFn:  store(Create),
+		Commands: map[string]OmniLedgerContract{"store": store(Update)},
+	}
+}
+
+// migratingContract migrates the instances of the previous version.
+type migratingContract struct {
+	BasicContract
+}
+
+func (mc migratingContract) Migrate(coll CollectionView, id InstanceID, from uint32) ([]StateChange, error) {
+	return []StateChange{NewStateChange(Update, id, "versioned", []byte("migrated"))}, nil
+}
+
+func TestContractVersions(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	hosts, _, _ := local.GenTree(1, false)
+	s := local.GetServices(hosts, OmniledgerID)[0].(*Service)
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+	apply := func(scs StateChanges) {
+		for _, sc := range scs {
+			require.Nil(t, storeInColl(coll.c, &sc))
+		}
+	}
+
+	// With only one version, no version is recorded.
+	require.Nil(t, s.registerContract("versioned", newVersionedContract("v1")))
+	id1 := InstanceID{DarcID: make([]byte, 32), SubID: genSubID()}
+	spawn := Instruction{InstanceID: id1, Spawn: &Spawn{ContractID: "versioned"}}
+	scs, _, err := s.executeInstruction(coll, nil, spawn)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(scs))
+	apply(scs)
+	v, err := LoadContractVersion(coll, id1)
+	require.Nil(t, err)
+	require.Equal(t, uint32(1), v)
+
+	// New instances get the latest version, old ones keep their version if
+	// it can't be migrated.
+	require.Nil(t, RegisterContractVersion(hosts[0], "versioned", 2, newVersionedContract("v2")))
+	id2 := InstanceID{DarcID: make([]byte, 32), SubID: genSubID()}
+	spawn.InstanceID = id2
+	scs, _, err = s.executeInstruction(coll, nil, spawn)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(scs))
+	require.Equal(t, []byte("v2"), scs[0].Value)
+	apply(scs)
+	v, err = LoadContractVersion(coll, id2)
+	require.Nil(t, err)
+	require.Equal(t, uint32(2), v)
+
+	invoke := Instruction{InstanceID: id1, Invoke: &Invoke{Command: "store"}}
+	scs, _, err = s.executeInstruction(coll, nil, invoke)
+	require.Nil(t, err)
+	require.Equal(t, []byte("v1"), scs[0].Value)
+
+	// Version 3 migrates version 2, but not version 1.
+	require.Nil(t, RegisterContractVersion(hosts[0], "versioned", 3,
+		migratingContract{newVersionedContract("v3")}))
+	scs, _, err = s.executeInstruction(coll, nil, invoke)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(scs))
+	require.Equal(t, []byte("v1"), scs[0].Value)
+
+	invoke.InstanceID = id2
+	scs, _, err = s.executeInstruction(coll, nil, invoke)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(scs))
+	v, err = LoadContractVersion(coll, id2)
+	require.Nil(t, err)
+	require.Equal(t, uint32(2), v, "the migration must not change the collection")
+	require.Equal(t, []byte("migrated"), scs[0].Value)
+	require.Equal(t, versionKey(id2).Slice(), scs[1].InstanceID)
+	require.Equal(t, []byte("v3"), scs[2].Value)
+	apply(scs)
+	v, err = LoadContractVersion(coll, id2)
+	require.Nil(t, err)
+	require.Equal(t, uint32(3), v)
+
+	// A record that isn't a version is an error, not version 1.
+	bad := NewStateChange(Update, versionKey(id2), "other", []byte{1})
+	apply(StateChanges{bad})
+	_, err = LoadContractVersion(coll, id2)
+	require.NotNil(t, err)
+
+	require.NotNil(t, s.registerContractVersion("versioned", 0, newVersionedContract("v0")))
+}
+
+func TestContractRegistry(t *testing.T) {
+	local := onet.NewLocalTest(tSuite)
+	defer local.CloseAll()
+	hosts, _, _ := local.GenTree(1, false)
+	s := local.GetServices(hosts, OmniledgerID)[0].(*Service)
+	require.Nil(t, s.registerContract("versioned", newVersionedContract("v1")))
+	require.Nil(t, s.registerContractVersion("versioned", 3, newVersionedContract("v3")))
+
+	resp, err := s.GetContractRegistry(&GetContractRegistry{Version: CurrentVersion})
+	require.Nil(t, err)
+	var kinds []string
+	for _, info := range resp.Contracts {
+		kinds = append(kinds, info.ContractID)
+		if info.ContractID == "versioned" {
+			require.Equal(t, []uint32{1, 3}, info.Versions)
+		}
+	}
+	require.Contains(t, kinds, ContractDarcID)
+	require.Contains(t, kinds, "versioned")
+	require.True(t, sort.StringsAreSorted(kinds))
+
+	// Block verification names the contracts that are missing.
+	coll := &roCollection{collection.New(collection.Data{}, collection.Data{})}
+	id := InstanceID{DarcID: make([]byte, 32), SubID: genSubID()}
+	require.Nil(t, storeInColl(coll.c, &StateChange{StateAction: Create,
+		InstanceID: id.Slice(), ContractID: []byte("unknown"), Value: []byte{}}))
+	cts := ClientTransactions{{Instructions: Instructions{{
+		InstanceID: id, Invoke: &Invoke{Command: "store"}}}}}
+	err = s.checkContracts(coll, cts)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "unknown")
+	cts[0].Instructions[0].InstanceID.SubID = genSubID()
+	cts[0].Instructions[0].Invoke = nil
+	cts[0].Instructions[0].Spawn = &Spawn{ContractID: "versioned"}
+	require.Nil(t, s.checkContracts(coll, cts))
+}
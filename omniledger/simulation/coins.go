@@ -84,7 +84,7 @@ func (s *SimulationService) Run(config *onet.SimulationConfig) error {
 
 	// Create omniledger
 	gm, err := service.DefaultGenesisMsg(service.CurrentVersion, config.Roster,
-		[]string{"spawn:coin", "invoke:mint", "invoke:transfer"}, signer.Identity())
+		[]string{"spawn:coin", "invoke:mint", "invoke:transfer", "mint:coin"}, signer.Identity())
 	if err != nil {
 		return errors.New("couldn't setup genesis message: " + err.Error())
 	}
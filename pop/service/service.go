@@ -581,56 +581,56 @@ func (final *FinalStatement) VerifyMergeStatement(mergeFinal *FinalStatement) in
 }
 
 // Verification function for signing during Finalization
-func (s *Service) bftVerifyFinal(Msg, Data []byte) bool {
+func (s *Service) bftVerifyFinal(Msg, Data []byte) error {
 	final, err := NewFinalStatementFromToml(Data)
 	if err != nil {
 		log.Error(err.Error())
-		return false
+		return err
 	}
 	hash, err := final.Hash()
 	if err != nil {
 		log.Error(err.Error())
-		return false
+		return err
 	}
 	if !bytes.Equal(hash, Msg) {
 		log.Error("hash of received Final stmt and msg are not equal")
-		return false
+		return errors.New("hash of received Final stmt and msg are not equal")
 	}
 	var fs *FinalStatement
 	var ok bool
 
 	if fs, ok = s.data.Finals[string(final.Desc.Hash())]; !ok {
 		log.Error(s.ServerIdentity(), "final Statement not found")
-		return false
+		return errors.New("final statement not found")
 	}
 
 	hash, err = fs.Hash()
 
 	if !bytes.Equal(hash, Msg) {
 		log.Error("hash of lccocal Final stmt and msg are not equal")
-		return false
+		return errors.New("hash of local Final stmt and msg are not equal")
 	}
 	s.verifyFinalBuffer.Store(sliceToArr(Msg), true)
-	return true
+	return nil
 }
 
-func (s *Service) bftVerifyFinalAck(msg, data []byte) bool {
+func (s *Service) bftVerifyFinalAck(msg, data []byte) error {
 	arr := sliceToArr(msg)
 	_, ok := s.verifyFinalBuffer.Load(arr)
-	if ok {
-		s.verifyFinalBuffer.Delete(arr)
-	} else {
+	if !ok {
 		log.Error(s.ServerIdentity().Address, "ack failed for msg", msg)
+		return errors.New("message has not been verified in the prepare phase")
 	}
-	return ok
+	s.verifyFinalBuffer.Delete(arr)
+	return nil
 }
 
 // Verification function for sighning during Merging
-func (s *Service) bftVerifyMerge(Msg []byte, Data []byte) bool {
+func (s *Service) bftVerifyMerge(Msg []byte, Data []byte) error {
 	stmtsMap, err := decodeMapFinal(Data)
 	if err != nil {
 		log.Lvl2("VerifyMerge: can't decode Data: " + err.Error())
-		return false
+		return errors.New("can't decode Data: " + err.Error())
 	}
 
 	// We need to find all local parties are supposed to merge
@@ -649,28 +649,28 @@ func (s *Service) bftVerifyMerge(Msg []byte, Data []byte) bool {
 			hashLocal, err := final.Hash()
 			if err != nil {
 				log.Error("VerifyMerge: hash computation failed")
-				return false
+				return errors.New("hash computation failed")
 			}
 			hashReceived, err := finalReceived.Hash()
 			if err != nil {
 				log.Error("VerifyMerge: hash computation failed")
-				return false
+				return errors.New("hash computation failed")
 			}
 			if !bytes.Equal(hashLocal, hashReceived) {
 				log.Lvl2("VerifyMerge: hashes Received and Local are not equal", s.ServerIdentity())
-				return false
+				return errors.New("hashes received and local are not equal")
 			}
 
 			// check that merge config is completed in merge
 			if len(stmtsMap) != len(final.Desc.Parties) {
 				log.Lvl2("VerifyMerge: length of Merge and Merge Config are not equal", s.ServerIdentity())
-				return false
+				return errors.New("length of merge and merge config are not equal")
 			}
 			for _, mergeStmt := range stmtsMap {
 				status := final.VerifyMergeStatement(mergeStmt)
 				if status < PopStatusOK {
 					log.Lvl2("VerifyMerge: Received non valid FinalStatement", s.ServerIdentity())
-					return false
+					return errors.New("received non valid FinalStatement")
 				}
 			}
 			finals = append(finals, final)
@@ -679,14 +679,14 @@ func (s *Service) bftVerifyMerge(Msg []byte, Data []byte) bool {
 
 	if !found {
 		log.Lvl2("VerifyMerge: no party from merge was found locally")
-		return false
+		return errors.New("no party from merge was found locally")
 	}
 
 	m := &merge{stmtsMap, true}
 	var syncData *syncChans
 	if syncData, ok = s.syncs[string(final.Desc.Hash())]; !ok {
 		log.Lvl2("VerifyMerge: No sync data with given hash")
-		return false
+		return errors.New("no sync data with given hash")
 	}
 
 	// Merge fields
@@ -711,12 +711,12 @@ func (s *Service) bftVerifyMerge(Msg []byte, Data []byte) bool {
 	hashLocal, err := final.Hash()
 	if err != nil {
 		log.Error("VerifyMerge: hash computation failed")
-		return false
+		return errors.New("hash computation failed")
 	}
 
 	if !bytes.Equal(hashLocal, Msg) {
 		log.Lvl2("Msg is invalid", s.ServerIdentity())
-		return false
+		return errors.New("msg is invalid")
 	}
 
 	// update local data
@@ -739,18 +739,18 @@ func (s *Service) bftVerifyMerge(Msg []byte, Data []byte) bool {
 
 	s.save()
 	s.verifyMergeBuffer.Store(sliceToArr(Msg), true)
-	return true
+	return nil
 }
 
-func (s *Service) bftVerifyMergeAck(msg, data []byte) bool {
+func (s *Service) bftVerifyMergeAck(msg, data []byte) error {
 	arr := sliceToArr(msg)
 	_, ok := s.verifyMergeBuffer.Load(arr)
-	if ok {
-		s.verifyMergeBuffer.Delete(arr)
-	} else {
+	if !ok {
 		log.Error(s.ServerIdentity().Address, "ack failed for msg", msg)
+		return errors.New("message has not been verified in the prepare phase")
 	}
-	return ok
+	s.verifyMergeBuffer.Delete(arr)
+	return nil
 }
 
 // PropagateFinal saves the new final statement
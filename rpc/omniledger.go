@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"errors"
+
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"google.golang.org/grpc"
+)
+
+// omniledgerAPI holds the methods of the omniledger service that are served
+// over gRPC.
+type omniledgerAPI interface {
+	CreateGenesisBlock(*service.CreateGenesisBlock) (*service.CreateGenesisBlockResponse, error)
+	AddTransaction(*service.AddTxRequest) (*service.AddTxResponse, error)
+	GetProof(*service.GetProof) (*service.GetProofResponse, error)
+	CallView(*service.CallView) (*service.CallViewResponse, error)
+	ResolveName(*service.ResolveName) (*service.ResolveNameResponse, error)
+	SearchEvents(*service.SearchEvents) (*service.SearchEventsResponse, error)
+	GetContractRegistry(*service.GetContractRegistry) (*service.GetContractRegistryResponse, error)
+	ListBlocks(*service.ListBlocks) (*service.ListBlocksResponse, error)
+	DecodeBlock(*service.DecodeBlock) (*service.DecodeBlockResponse, error)
+	SearchInstances(*service.SearchInstances) (*service.SearchInstancesResponse, error)
+	SubscribeEvents(skipchain.SkipBlockID, string, string) (<-chan service.BlockEvent, func())
+}
+
+const omniledgerName = "omniledger.OmniLedger"
+
+var omniledgerDesc = grpc.ServiceDesc{
+	ServiceName: omniledgerName,
+	HandlerType: (*omniledgerAPI)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(omniledgerName, "CreateGenesisBlock",
+			func() interface{} { return &service.CreateGenesisBlock{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).CreateGenesisBlock(req.(*service.CreateGenesisBlock))
+			}),
+		unary(omniledgerName, "AddTransaction",
+			func() interface{} { return &service.AddTxRequest{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).AddTransaction(req.(*service.AddTxRequest))
+			}),
+		unary(omniledgerName, "GetProof",
+			func() interface{} { return &service.GetProof{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).GetProof(req.(*service.GetProof))
+			}),
+		unary(omniledgerName, "CallView",
+			func() interface{} { return &service.CallView{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).CallView(req.(*service.CallView))
+			}),
+		unary(omniledgerName, "ResolveName",
+			func() interface{} { return &service.ResolveName{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).ResolveName(req.(*service.ResolveName))
+			}),
+		unary(omniledgerName, "SearchEvents",
+			func() interface{} { return &service.SearchEvents{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).SearchEvents(req.(*service.SearchEvents))
+			}),
+		unary(omniledgerName, "GetContractRegistry",
+			func() interface{} { return &service.GetContractRegistry{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).GetContractRegistry(req.(*service.GetContractRegistry))
+			}),
+		unary(omniledgerName, "ListBlocks",
+			func() interface{} { return &service.ListBlocks{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).ListBlocks(req.(*service.ListBlocks))
+			}),
+		unary(omniledgerName, "DecodeBlock",
+			func() interface{} { return &service.DecodeBlock{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).DecodeBlock(req.(*service.DecodeBlock))
+			}),
+		unary(omniledgerName, "SearchInstances",
+			func() interface{} { return &service.SearchInstances{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(omniledgerAPI).SearchInstances(req.(*service.SearchInstances))
+			}),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "SubscribeEvents",
+		Handler:       subscribeEvents,
+		ServerStreams: true,
+	}},
+	Metadata: "omniledger_service.proto",
+}
+
+// subscribeEvents sends the new events of the contract and topic of the
+// SearchEvents request, From and To are ignored. If the client doesn't read
+// the events fast enough, some are dropped, and it has to use SearchEvents
+// to get them.
+func subscribeEvents(srv interface{}, stream grpc.ServerStream) error {
+	req := &service.SearchEvents{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	if req.Version != service.CurrentVersion {
+		return errors.New("version mismatch")
+	}
+	events, cancel := srv.(omniledgerAPI).SubscribeEvents(req.SkipchainID, req.ContractID, req.Topic)
+	defer cancel()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return errors.New("subscription closed")
+			}
+			if err := stream.SendMsg(&e); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Package rpc serves the APIs of the skipchain and omniledger services over
+// gRPC, next to the websocket of onet. The services are described in
+// external/proto/skipchain_service.proto and
+// external/proto/omniledger_service.proto, so that clients in any language
+// can be generated from them. The messages are encoded with the same
+// protobuf encoding as the messages sent over the websocket.
+//
+// Besides the request/response calls, the gRPC services stream the new
+// blocks of a skipchain and the new events of an omniledger.
+//
+// The calls are not authenticated, and they include CreateGenesisBlock and
+// AddTransaction, like the websocket. So Start only serves them on a
+// loopback address, unless it has TLS credentials.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Codec encodes the gRPC messages with the protobuf library of onet, as the
+// messages are not generated by protoc. Clients written in Go must use it
+// with grpc.WithCodec.
+type Codec struct{}
+
+// Marshal encodes v.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return protobuf.Encode(v)
+}
+
+// Unmarshal decodes data into v.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return protobuf.DecodeWithConstructors(data, v, network.DefaultConstructors(cothority.Suite))
+}
+
+// String returns the name of the codec.
+func (Codec) String() string {
+	return "proto"
+}
+
+// NewServer returns a gRPC server with the skipchain service of srv and,
+// if srv runs it, the omniledger service.
+func NewServer(srv *onet.Server, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	gs := grpc.NewServer(append([]grpc.ServerOption{grpc.CustomCodec(Codec{})}, opts...)...)
+	sc, ok := srv.Service(skipchain.ServiceName).(*skipchain.Service)
+	if !ok {
+		return nil, errors.New("the server doesn't run the skipchain service")
+	}
+	gs.RegisterService(&skipchainDesc, sc)
+	if ol, ok := srv.Service(service.ServiceName).(*service.Service); ok {
+		gs.RegisterService(&omniledgerDesc, ol)
+	}
+	return gs, nil
+}
+
+// Start listens on the address and serves the gRPC APIs of srv in the
+// background, until the returned server is stopped. Without TLS
+// credentials in creds, the address must be a loopback address, for example
+// for a reverse proxy on the same host that adds TLS.
+func Start(srv *onet.Server, address string, creds credentials.TransportCredentials) (*grpc.Server, error) {
+	var opts []grpc.ServerOption
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	} else if err := checkLoopback(address); err != nil {
+		return nil, err
+	}
+	gs, err := NewServer(srv, opts...)
+	if err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	log.Lvl1("Serving gRPC on", lis.Addr())
+	go func() {
+		if err := gs.Serve(lis); err != nil {
+			log.Error("gRPC server stopped:", err)
+		}
+	}()
+	return gs, nil
+}
+
+// checkLoopback returns an error if the host of address is not localhost or
+// a loopback IP.
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("gRPC without TLS is only served on loopback addresses, not on %s", address)
+	}
+	return nil
+}
+
+// unary returns the description of a method of the service serviceName,
+// which decodes its request into newReq() and answers with call.
+func unary(serviceName, name string, newReq func() interface{},
+	call func(srv, req interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+			interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv, req)
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + serviceName + "/" + name,
+			}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/omniledger/contracts"
+	"github.com/dedis/cothority/omniledger/darc"
+	"github.com/dedis/cothority/omniledger/service"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestServer(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+	servers, roster, _ := local.GenTree(2, true)
+
+	gs, err := NewServer(servers[0])
+	require.Nil(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithCodec(Codec{}))
+	require.Nil(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	msg, err := service.DefaultGenesisMsg(service.CurrentVersion, roster,
+		[]string{"spawn:value"}, signer.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 500 * time.Millisecond
+	genesis := &service.CreateGenesisBlockResponse{}
+	require.Nil(t, conn.Invoke(ctx, "/omniledger.OmniLedger/CreateGenesisBlock", msg, genesis))
+	scID := genesis.Skipblock.Hash
+
+	sb := &skipchain.SkipBlock{}
+	require.Nil(t, conn.Invoke(ctx, "/skipchain.Skipchain/GetSingleBlock",
+		&skipchain.GetSingleBlock{ID: scID}, sb))
+	require.True(t, sb.Hash.Equal(scID))
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true},
+		"/skipchain.Skipchain/SubscribeBlocks")
+	require.Nil(t, err)
+	require.Nil(t, stream.SendMsg(&skipchain.GetNewBlocks{LatestID: scID}))
+	require.Nil(t, stream.CloseSend())
+
+	tx := service.ClientTransaction{Instructions: service.Instructions{{
+		InstanceID: service.InstanceID{DarcID: msg.GenesisDarc.GetBaseID()},
+		Nonce:      service.GenNonce(),
+		Index:      0,
+		Length:     1,
+		Spawn: &service.Spawn{
+			ContractID: contracts.ContractValueID,
+			Args:       service.Arguments{{Name: "value", Value: []byte("1234")}},
+		},
+	}}}
+	require.Nil(t, tx.Instructions[0].SignWith(scID, signer))
+	require.Nil(t, conn.Invoke(ctx, "/omniledger.OmniLedger/AddTransaction", &service.AddTxRequest{
+		Version:     service.CurrentVersion,
+		SkipchainID: scID,
+		Transaction: tx,
+	}, &service.AddTxResponse{}))
+
+	// The block with the transaction is streamed.
+	next := &skipchain.SkipBlock{}
+	require.Nil(t, stream.RecvMsg(next))
+	require.Equal(t, 1, next.Index)
+	require.True(t, next.SkipChainID().Equal(scID))
+
+	// Errors of the services are returned.
+	err = conn.Invoke(ctx, "/omniledger.OmniLedger/GetProof", &service.GetProof{
+		Version: service.CurrentVersion,
+		ID:      []byte("unknown"),
+		Key:     make([]byte, 64),
+	}, &service.GetProofResponse{})
+	require.NotNil(t, err)
+
+	local.WaitDone(msg.BlockInterval)
+}
+
+func TestStart(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenTree(1, true)
+
+	// Without TLS, only loopback addresses are served.
+	for _, address := range []string{"0.0.0.0:0", ":0", "example.com:7772", "10.0.0.1:0"} {
+		_, err := Start(servers[0], address, nil)
+		require.NotNil(t, err, address)
+	}
+	for _, address := range []string{"127.0.0.1:0", "localhost:0", "[::1]:0"} {
+		require.Nil(t, checkLoopback(address), address)
+	}
+	gs, err := Start(servers[0], "127.0.0.1:0", nil)
+	require.Nil(t, err)
+	gs.Stop()
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"github.com/dedis/cothority/skipchain"
+	"google.golang.org/grpc"
+)
+
+// skipchainAPI holds the methods of the skipchain service that are served
+// over gRPC.
+type skipchainAPI interface {
+	GetSingleBlock(*skipchain.GetSingleBlock) (*skipchain.SkipBlock, error)
+	GetUpdateChain(*skipchain.GetUpdateChain) (*skipchain.GetUpdateChainReply, error)
+	GetBlocksByID(*skipchain.GetBlocksByID) (*skipchain.GetBlocksByIDReply, error)
+	GetChainProof(*skipchain.GetChainProof) (*skipchain.GetChainProofReply, error)
+	GetNewBlocks(*skipchain.GetNewBlocks) (*skipchain.GetNewBlocksReply, error)
+}
+
+const skipchainName = "skipchain.Skipchain"
+
+var skipchainDesc = grpc.ServiceDesc{
+	ServiceName: skipchainName,
+	HandlerType: (*skipchainAPI)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(skipchainName, "GetSingleBlock",
+			func() interface{} { return &skipchain.GetSingleBlock{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(skipchainAPI).GetSingleBlock(req.(*skipchain.GetSingleBlock))
+			}),
+		unary(skipchainName, "GetUpdateChain",
+			func() interface{} { return &skipchain.GetUpdateChain{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(skipchainAPI).GetUpdateChain(req.(*skipchain.GetUpdateChain))
+			}),
+		unary(skipchainName, "GetBlocksByID",
+			func() interface{} { return &skipchain.GetBlocksByID{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(skipchainAPI).GetBlocksByID(req.(*skipchain.GetBlocksByID))
+			}),
+		unary(skipchainName, "GetChainProof",
+			func() interface{} { return &skipchain.GetChainProof{} },
+			func(srv, req interface{}) (interface{}, error) {
+				return srv.(skipchainAPI).GetChainProof(req.(*skipchain.GetChainProof))
+			}),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "SubscribeBlocks",
+		Handler:       subscribeBlocks,
+		ServerStreams: true,
+	}},
+	Metadata: "skipchain_service.proto",
+}
+
+// subscribeBlocks sends every block stored after the LatestID of the
+// request. As GetNewBlocks waits for a new block up to its timeout, a client
+// that leaves is only noticed after the next block or the timeout.
+func subscribeBlocks(srv interface{}, stream grpc.ServerStream) error {
+	req := &skipchain.GetNewBlocks{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	latest := req.LatestID
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		default:
+		}
+		reply, err := srv.(skipchainAPI).GetNewBlocks(&skipchain.GetNewBlocks{LatestID: latest})
+		if err != nil {
+			return err
+		}
+		if len(reply.Update) == 0 {
+			continue
+		}
+		for _, sb := range reply.Update[1:] {
+			if err = stream.SendMsg(sb); err != nil {
+				return err
+			}
+		}
+		latest = reply.Update[len(reply.Update)-1].Hash
+	}
+}
@@ -20,6 +20,7 @@ import (
 	bolt "github.com/coreos/bbolt"
 	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/identity"
+	omniledger "github.com/dedis/cothority/omniledger/service"
 	"github.com/dedis/cothority/skipchain"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/util/encoding"
@@ -169,6 +170,77 @@ func linkQuery(c *cli.Context) error {
 	return nil
 }
 
+func dbBackup(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("please give: ip:port file")
+	}
+	cfg := getConfigOrFail(c)
+	link, err := findLinkFromAddress(cfg, c.Args().First())
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	if err = omniledger.NewClient().Backup(link.Conode, link.Private, f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.New("couldn't get backup: " + err.Error())
+	}
+	log.Infof("Stored the backup of %s in %s", link.Address, f.Name())
+	return f.Close()
+}
+
+func dbRestore(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("please give: ip:port file")
+	}
+	cfg := getConfigOrFail(c)
+	link, err := findLinkFromAddress(cfg, c.Args().First())
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reply, err := omniledger.NewClient().Restore(link.Conode, link.Private, f)
+	if err != nil {
+		return errors.New("couldn't restore backup: " + err.Error())
+	}
+	for _, id := range reply.Skipchains {
+		log.Infof("Restored skipchain %x", id)
+	}
+	return nil
+}
+
+func quotaSet(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("please give: ip:port skipchain-id")
+	}
+	cfg := getConfigOrFail(c)
+	link, err := findLinkFromAddress(cfg, c.Args().First())
+	if err != nil {
+		return err
+	}
+	scid, err := hex.DecodeString(c.Args().Get(1))
+	if err != nil {
+		return errors.New("invalid skipchain-id: " + err.Error())
+	}
+	q := omniledger.Quota{
+		MaxBytes:       c.Int64("bytes"),
+		MaxTxPerSecond: c.Int64("tps"),
+		MaxInstances:   c.Int64("instances"),
+	}
+	if err = omniledger.NewClient().SetQuota(link.Conode, link.Private, scid, q); err != nil {
+		return errors.New("couldn't set quota: " + err.Error())
+	}
+	log.Infof("Set the quota of %x on %s to %+v", scid, link.Address, q)
+	return nil
+}
+
 func followAddID(c *cli.Context) error {
 	cfg := getConfigOrFail(c)
 	if c.NArg() != 2 {
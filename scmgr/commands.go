@@ -40,6 +40,46 @@ func getCommands() cli.Commands {
 			},
 		},
 
+		{
+			Name:  "db",
+			Usage: "back up and restore the database of a linked conode",
+			Subcommands: cli.Commands{
+				{
+					Name:      "backup",
+					Usage:     "store a copy of the database of the conode, without stopping it",
+					ArgsUsage: "ip:port file",
+					Action:    dbBackup,
+				},
+				{
+					Name:      "restore",
+					Usage:     "verify a backup and restore its skipchains on the conode",
+					ArgsUsage: "ip:port file",
+					Action:    dbRestore,
+				},
+			},
+		},
+
+		{
+			Name:      "quota",
+			Usage:     "limit what an omniledger skipchain can use on a linked conode, no flags remove the limits",
+			ArgsUsage: "ip:port skipchain-id",
+			Action:    quotaSet,
+			Flags: []cli.Flag{
+				cli.Int64Flag{
+					Name:  "bytes",
+					Usage: "maximum storage of the collection and the events",
+				},
+				cli.Int64Flag{
+					Name:  "tps",
+					Usage: "maximum number of new transactions per second",
+				},
+				cli.Int64Flag{
+					Name:  "instances",
+					Usage: "maximum number of instances",
+				},
+			},
+		},
+
 		{
 			Name:    "follow",
 			Usage:   "allow conode to be included in skipchain",
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"time"
 
 	"github.com/dedis/cothority"
 	status "github.com/dedis/cothority/status/service"
@@ -112,25 +113,59 @@ func (c *Client) StoreSkipBlock(target *SkipBlock, ro *onet.Roster, d network.Me
 // This function returns the created skipblock or nil and an error.
 func (c *Client) CreateGenesisSignature(ro *onet.Roster, baseH, maxH int, ver []VerifierID,
 	data interface{}, parent SkipBlockID, priv kyber.Scalar) (*SkipBlock, error) {
-	genesis := NewSkipBlock()
-	genesis.Roster = ro
-	genesis.VerifierIDs = ver
-	genesis.MaximumHeight = maxH
-	genesis.BaseHeight = baseH
-	genesis.ParentBlockID = parent
-	if data != nil {
-		var ok bool
-		genesis.Data, ok = data.([]byte)
-		if !ok {
-			buf, err := network.Marshal(data)
-			if err != nil {
-				return nil, errors.New(
-					"Couldn't marshal data: " + err.Error())
+	return c.CreateGenesisFromTemplate(&GenesisTemplate{
+		Roster:        ro,
+		BaseHeight:    baseH,
+		MaximumHeight: maxH,
+		VerifierIDs:   ver,
+		Data:          data,
+		Parent:        parent,
+	}, priv)
+}
 
-			}
-			genesis.Data = buf
+// GenesisTemplate holds everything needed to create a new skipchain in one
+// call: the configuration of the chain, the verifiers and the application
+// data. Data and Payload can be nil, a []byte that is stored as-is, or any
+// message that will be network.Marshaled. If one of the verifiers has been
+// registered with RegisterGenesisVerification, the conodes will call it on
+// the genesis block before creating the skipchain.
+type GenesisTemplate struct {
+	Roster        *onet.Roster
+	BaseHeight    int
+	MaximumHeight int
+	VerifierIDs   []VerifierID
+	Data          interface{}
+	Payload       interface{}
+	Parent        SkipBlockID
+}
+
+// NewBlock returns the genesis block described by the template.
+func (t *GenesisTemplate) NewBlock() (*SkipBlock, error) {
+	genesis := NewSkipBlock()
+	genesis.Roster = t.Roster
+	genesis.VerifierIDs = t.VerifierIDs
+	genesis.MaximumHeight = t.MaximumHeight
+	genesis.BaseHeight = t.BaseHeight
+	genesis.ParentBlockID = t.Parent
+	var err error
+	if t.Data != nil {
+		if genesis.Data, err = marshalData(t.Data); err != nil {
+			return nil, err
 		}
 	}
+	if genesis.Payload, err = marshalData(t.Payload); err != nil {
+		return nil, err
+	}
+	return genesis, nil
+}
+
+// CreateGenesisFromTemplate creates a new skipchain from the template. priv
+// can be nil, or a private key that is allowed to sign for new skipblocks.
+func (c *Client) CreateGenesisFromTemplate(t *GenesisTemplate, priv kyber.Scalar) (*SkipBlock, error) {
+	genesis, err := t.NewBlock()
+	if err != nil {
+		return nil, err
+	}
 	sb, err := c.StoreSkipBlockSignature(genesis, nil, nil, priv)
 	if err != nil {
 		return nil, err
@@ -138,6 +173,23 @@ func (c *Client) CreateGenesisSignature(ro *onet.Roster, baseH, maxH int, ver []
 	return sb.Latest, nil
 }
 
+// marshalData returns d if it is a []byte, or else the network.Marshaled
+// version of d. A nil d returns nil.
+func marshalData(d interface{}) ([]byte, error) {
+	if d == nil {
+		return nil, nil
+	}
+	if buf, ok := d.([]byte); ok {
+		return buf, nil
+	}
+	buf, err := network.Marshal(d)
+	if err != nil {
+		return nil, errors.New(
+			"Couldn't marshal data: " + err.Error())
+	}
+	return buf, nil
+}
+
 // CreateGenesis is a convenience function to create a new SkipChain with the
 // given parameters.
 //  - ro is the responsible roster
@@ -220,6 +272,18 @@ func (c *Client) GetUpdateChain(roster *onet.Roster, latest SkipBlockID) (reply
 				}
 			}
 
+			// The hash binds the roster of the block, which is used to
+			// verify the forward-links. As the first block is the one we
+			// asked for, this makes the whole chain verifiable starting
+			// from a block that we trust.
+			if !b.CalculateHash().Equal(b.Hash) {
+				return nil, errors.New("hash of returned block doesn't match its content")
+			}
+			for _, fl := range b.ForwardLink {
+				if !fl.IsEmpty() && !fl.From.Equal(b.Hash) {
+					return nil, errors.New("forward-link doesn't start at its block")
+				}
+			}
 			if err := b.VerifyForwardSignatures(); err != nil {
 				return nil, err
 			}
@@ -248,6 +312,12 @@ func (c *Client) GetUpdateChain(roster *onet.Roster, latest SkipBlockID) (reply
 				if !prevBlock.ForwardLink[link-1].To.Equal(b.Hash) {
 					return nil, errors.New("corresponding forwardlink doesn't point to next block")
 				}
+				// The roster of this block must have been handed over
+				// by the roster of the previous block, which is the one
+				// that signed the forward-link.
+				if err := prevBlock.ForwardLink[link-1].VerifyRoster(prevBlock, b); err != nil {
+					return nil, err
+				}
 			}
 
 			reply.Update = append(reply.Update, b)
@@ -271,6 +341,140 @@ func (c *Client) GetUpdateChain(roster *onet.Roster, latest SkipBlockID) (reply
 	}
 }
 
+// StreamBlocks sends every block stored after latest to the blocks channel,
+// until done is closed or an error occurs. Every block is verified against
+// the forward-link of the previous block, so the blocks can be trusted as
+// long as latest can be trusted. If the roster of the skipchain changes, the
+// new roster is used to ask for further blocks. As every request waits on the
+// conode for a new block, closing done can take up to the timeout of the
+// conode to be noticed.
+func (c *Client) StreamBlocks(latest *SkipBlock, blocks chan<- *SkipBlock, done <-chan bool) error {
+	for {
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+
+		reply := &GetNewBlocksReply{}
+		var err error
+		for _, i := range rand.Perm(len(latest.Roster.List)) {
+			err = c.SendProtobuf(latest.Roster.List[i], &GetNewBlocks{LatestID: latest.Hash}, reply)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return errors.New("couldn't get new blocks: " + err.Error())
+		}
+		if len(reply.Update) == 0 {
+			continue
+		}
+		if err := verifyNewBlocks(latest, reply.Update); err != nil {
+			return err
+		}
+
+		for _, sb := range reply.Update[1:] {
+			select {
+			case blocks <- sb:
+			case <-done:
+				return nil
+			}
+		}
+		latest = reply.Update[len(reply.Update)-1]
+	}
+}
+
+// verifyNewBlocks makes sure that the update starts with latest and that every
+// block is linked to the previous one by a valid level-0 forward-link.
+func verifyNewBlocks(latest *SkipBlock, update []*SkipBlock) error {
+	if !update[0].Hash.Equal(latest.Hash) {
+		return errors.New("first returned block does not match requested hash")
+	}
+	for i, sb := range update {
+		if !sb.CalculateHash().Equal(sb.Hash) {
+			return errors.New("hash of returned block doesn't match its content")
+		}
+		if i == 0 {
+			continue
+		}
+		prev := update[i-1]
+		if len(prev.ForwardLink) == 0 {
+			return errors.New("returned block has no forward-link")
+		}
+		fl := prev.ForwardLink[0]
+		if err := fl.Verify(cothority.Suite, prev.Roster.Publics()); err != nil {
+			return errors.New("wrong signature in forward-link: " + err.Error())
+		}
+		if err := fl.VerifyRoster(prev, sb); err != nil {
+			return err
+		}
+		if len(sb.BackLinkIDs) == 0 || !sb.BackLinkIDs[0].Equal(prev.Hash) {
+			return errors.New("backlink doesn't point to previous block")
+		}
+	}
+	return nil
+}
+
+// GetBlocks returns the blocks with the given IDs in one request. Every
+// returned block is checked to have the requested hash.
+func (c *Client) GetBlocks(roster *onet.Roster, ids []SkipBlockID) ([]*SkipBlock, error) {
+	reply := &GetBlocksByIDReply{}
+	err := c.SendProtobuf(roster.RandomServerIdentity(), &GetBlocksByID{IDs: ids}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.Blocks) != len(ids) {
+		return nil, errors.New("got wrong number of blocks")
+	}
+	for i, sb := range reply.Blocks {
+		if !sb.Hash.Equal(ids[i]) || !sb.CalculateHash().Equal(ids[i]) {
+			return nil, errors.New("got wrong block")
+		}
+	}
+	return reply.Blocks, nil
+}
+
+// GetChainProof returns a verified proof from the genesis block of the
+// skipchain to the latest block known by the conode.
+func (c *Client) GetChainProof(roster *onet.Roster, id SkipBlockID) (*ChainProof, error) {
+	reply := &GetChainProofReply{}
+	err := c.SendProtobuf(roster.RandomServerIdentity(), &GetChainProof{SkipchainID: id}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Proof == nil || !reply.Proof.GenesisID.Equal(id) {
+		return nil, errors.New("got proof for wrong skipchain")
+	}
+	if err = reply.Proof.Verify(); err != nil {
+		return nil, err
+	}
+	return reply.Proof, nil
+}
+
+// GetChildren returns the genesis blocks of all child skipchains of the block
+// parentID. The parent-block returned by the conode is checked to be the
+// requested block, and every child is verified against the child-links
+// signed by the roster of the parent.
+func (c *Client) GetChildren(roster *onet.Roster, parentID SkipBlockID) ([]*SkipBlock, error) {
+	reply := &GetChildrenReply{}
+	err := c.SendProtobuf(roster.RandomServerIdentity(), &GetChildren{ParentID: parentID}, reply)
+	if err != nil {
+		return nil, err
+	}
+	parent := reply.Parent
+	if parent == nil || !parent.Hash.Equal(parentID) ||
+		!parent.CalculateHash().Equal(parentID) {
+		return nil, errors.New("got wrong parent-block")
+	}
+	for _, child := range reply.Children {
+		if err := parent.VerifyChildLink(child); err != nil {
+			return nil, err
+		}
+	}
+	return reply.Children, nil
+}
+
 // GetAllSkipchains is deprecated and should no longer be used. See GetAllSkipChainIDs.
 func (c *Client) GetAllSkipchains(si *network.ServerIdentity) (reply *GetAllSkipchainsReply,
 	err error) {
@@ -294,15 +498,31 @@ func (c *Client) GetSingleBlock(roster *onet.Roster, id SkipBlockID) (reply *Ski
 	reply = &SkipBlock{}
 	err = c.SendProtobuf(roster.RandomServerIdentity(),
 		&GetSingleBlock{id}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if !reply.Hash.Equal(id) || !reply.CalculateHash().Equal(id) {
+		return nil, errors.New("returned block doesn't match the requested ID")
+	}
 	return
 }
 
 // GetSingleBlockByIndex searches for a block with the given index following the genesis-block.
+// If index is -1, the latest block of the skipchain is returned.
 // It returns that block, or an error if that block is not found.
 func (c *Client) GetSingleBlockByIndex(roster *onet.Roster, genesis SkipBlockID, index int) (reply *SkipBlock, err error) {
 	reply = &SkipBlock{}
 	err = c.SendProtobuf(roster.RandomServerIdentity(),
 		&GetSingleBlockByIndex{genesis, index}, reply)
+	if err != nil {
+		return nil, err
+	}
+	if !reply.SkipChainID().Equal(genesis) || (index >= 0 && reply.Index != index) {
+		return nil, errors.New("returned block doesn't match the request")
+	}
+	if !reply.CalculateHash().Equal(reply.Hash) {
+		return nil, errors.New("hash of returned block doesn't match its content")
+	}
 	return
 }
 
@@ -403,6 +623,46 @@ func (c *Client) DelFollow(si *network.ServerIdentity, clientPriv kyber.Scalar,
 	return c.SendProtobuf(si, &DelFollow{SkipchainID: scid, Signature: sig}, nil)
 }
 
+// DeleteChain asks the conode to remove all blocks of the given skipchain. The
+// skipchain cannot be stored again on that conode afterwards. clientPriv
+// must be linked to the conode.
+func (c *Client) DeleteChain(si *network.ServerIdentity, clientPriv kyber.Scalar, scid SkipBlockID) error {
+	return c.deleteChain(si, clientPriv, scid, false)
+}
+
+// ArchiveChain is like DeleteChain, but the conode keeps the blocks in an
+// archive instead of deleting them.
+func (c *Client) ArchiveChain(si *network.ServerIdentity, clientPriv kyber.Scalar, scid SkipBlockID) error {
+	return c.deleteChain(si, clientPriv, scid, true)
+}
+
+func (c *Client) deleteChain(si *network.ServerIdentity, clientPriv kyber.Scalar, scid SkipBlockID, archive bool) error {
+	now := time.Now().Unix()
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, deleteChainMsg(scid, archive, si.Public, now))
+	if err != nil {
+		return err
+	}
+	return c.SendProtobuf(si, &DeleteChain{SkipchainID: scid, Archive: archive, Timestamp: now,
+		Signature: sig}, nil)
+}
+
+// RepairForwardLinks asks the conode to sign again all missing forward-links
+// of the skipchain. clientPriv has to be the private key of an administrator
+// of the conode.
+func (c *Client) RepairForwardLinks(si *network.ServerIdentity, clientPriv kyber.Scalar, scid SkipBlockID) (*RepairForwardLinksReply, error) {
+	now := time.Now().Unix()
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, repairChainMsg(scid, si.Public, now))
+	if err != nil {
+		return nil, err
+	}
+	reply := &RepairForwardLinksReply{}
+	err = c.SendProtobuf(si, &RepairForwardLinks{SkipchainID: scid, Timestamp: now, Signature: sig}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
 // ListFollow returns the list of latest skipblock of all skipchains that are followed
 // for authentication purposes.
 func (c *Client) ListFollow(si *network.ServerIdentity, clientPriv kyber.Scalar) (*ListFollowReply, error) {
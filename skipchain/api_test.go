@@ -10,6 +10,7 @@ import (
 	"bytes"
 
 	"sync"
+	"time"
 
 	"github.com/dedis/cothority"
 	"github.com/dedis/kyber"
@@ -19,8 +20,15 @@ import (
 	"github.com/dedis/onet/network"
 )
 
+const forgedName = "ForgedSkipchain"
+
+var forgedSID onet.ServiceID
+
 func init() {
 	network.RegisterMessage(&testData{})
+	var err error
+	forgedSID, err = onet.RegisterNewService(forgedName, newForgedService)
+	log.ErrFatal(err)
 }
 
 func TestClient_CreateGenesis(t *testing.T) {
@@ -44,6 +52,30 @@ func TestClient_CreateGenesis(t *testing.T) {
 	require.NotNil(t, err)
 }
 
+func TestClient_CreateGenesisFromTemplate(t *testing.T) {
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(3, true)
+	defer l.CloseAll()
+	c := newTestClient(l)
+	sb, err := c.CreateGenesisFromTemplate(&GenesisTemplate{
+		Roster:        roster,
+		BaseHeight:    1,
+		MaximumHeight: 1,
+		VerifierIDs:   VerificationNone,
+		Data:          &testData{},
+		Payload:       []byte{1, 2, 3},
+	}, nil)
+	require.Nil(t, err)
+	require.Equal(t, []byte{1, 2, 3}, sb.Payload)
+	_, msg, err := network.Unmarshal(sb.Data, cothority.Suite)
+	require.Nil(t, err)
+	_, ok := msg.(*testData)
+	require.True(t, ok)
+
+	_, err = c.CreateGenesisFromTemplate(&GenesisTemplate{Roster: roster}, nil)
+	require.NotNil(t, err)
+}
+
 func TestClient_CreateRootControl(t *testing.T) {
 	l := onet.NewTCPTest(cothority.Suite)
 	_, roster, _ := l.GenTree(3, true)
@@ -75,6 +107,13 @@ func TestClient_CreateRootInter(t *testing.T) {
 	if !bytes.Equal(inter.ParentBlockID, root.Hash) {
 		t.Fatal("Intermediate doesn't point to root")
 	}
+
+	children, err := c.GetChildren(ro, root.Hash)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(children))
+	require.True(t, inter.Equal(children[0]))
+	_, err = c.GetChildren(ro, inter.Hash)
+	require.Nil(t, err)
 }
 
 func TestClient_GetUpdateChain(t *testing.T) {
@@ -145,6 +184,71 @@ func TestClient_GetUpdateChain(t *testing.T) {
 	}
 }
 
+// TestClient_GetUpdateChainForged makes sure that the client refuses the
+// update-chains of a conode that doesn't follow the skipchain.
+func TestClient_GetUpdateChainForged(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, roster, gs := local.MakeSRS(cothority.Suite, 1, skipchainSID)
+	s := gs.(*Service)
+
+	sbs := make([]*SkipBlock, 4)
+	var err error
+	sbs[0], err = makeGenesisRoster(s, roster)
+	require.Nil(t, err)
+	for i := 1; i < len(sbs); i++ {
+		newSB := NewSkipBlock()
+		newSB.Roster = roster
+		reply, err := s.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: sbs[i-1].Hash, NewBlock: newSB})
+		require.Nil(t, err)
+		sbs[i] = reply.Latest
+	}
+	update, err := s.GetUpdateChain(&GetUpdateChain{LatestID: sbs[0].Hash})
+	require.Nil(t, err)
+	require.Equal(t, len(sbs), len(update.Update))
+
+	forged := local.Services[servers[0].ServerIdentity.ID][forgedSID].(*forgedService)
+	c := &Client{Client: local.NewClient(forgedName)}
+	getUpdate := func(blocks ...*SkipBlock) error {
+		forged.reply = &GetUpdateChainReply{Update: blocks}
+		_, err := c.GetUpdateChain(roster, sbs[0].Hash)
+		return err
+	}
+	require.Nil(t, getUpdate(update.Update...))
+
+	// A forward-link to a block that the roster didn't sign.
+	fake := update.Update[1].Copy()
+	fake.Data = []byte("forged")
+	fake.ForwardLink = nil
+	fake.Hash = fake.CalculateHash()
+	first := update.Update[0].Copy()
+	first.ForwardLink[0].To = fake.Hash
+	require.NotNil(t, getUpdate(first, fake))
+
+	// A chain with a missing block.
+	require.NotNil(t, getUpdate(update.Update[0], update.Update[2], update.Update[3]))
+
+	// A chain that stops before the latest block.
+	require.NotNil(t, getUpdate(update.Update[:2]...))
+}
+
+// forgedService answers GetUpdateChain with a fixed reply, like a conode
+// that lies about the skipchain.
+type forgedService struct {
+	*onet.ServiceProcessor
+	reply *GetUpdateChainReply
+}
+
+func newForgedService(c *onet.Context) (onet.Service, error) {
+	s := &forgedService{ServiceProcessor: onet.NewServiceProcessor(c)}
+	return s, s.RegisterHandler(s.GetUpdateChain)
+}
+
+func (s *forgedService) GetUpdateChain(req *GetUpdateChain) (*GetUpdateChainReply, error) {
+	return s.reply, nil
+}
+
 func TestClient_StoreSkipBlock(t *testing.T) {
 	nbrHosts := 3
 	l := onet.NewTCPTest(cothority.Suite)
@@ -275,9 +379,53 @@ func TestClient_GetSingleBlockByIndex(t *testing.T) {
 	log.ErrFatal(err)
 	require.True(t, reply2.Latest.Equal(search))
 
+	// latest
+	search, err = c.GetSingleBlockByIndex(roster, sb1.Hash, -1)
+	log.ErrFatal(err)
+	require.True(t, reply2.Latest.Equal(search))
+
 	// non existing
 	_, err = c.GetSingleBlockByIndex(roster, sb1.Hash, 2)
 	require.NotNil(t, err)
+	_, err = c.GetSingleBlockByIndex(roster, sb1.Hash, -2)
+	require.NotNil(t, err)
+}
+
+func TestClient_StreamBlocks(t *testing.T) {
+	// Make sure the stream survives empty replies.
+	defer func(d time.Duration) { defaultNewBlocksTimeout = d }(defaultNewBlocksTimeout)
+	defaultNewBlocksTimeout = 100 * time.Millisecond
+
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(3, true)
+	defer l.CloseAll()
+
+	c := newTestClient(l)
+	sb, err := c.CreateGenesis(roster, 1, 1, VerificationNone, nil, nil)
+	require.Nil(t, err)
+
+	blocks := make(chan *SkipBlock)
+	done := make(chan bool)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- newTestClient(l).StreamBlocks(sb, blocks, done)
+	}()
+
+	time.Sleep(2 * defaultNewBlocksTimeout)
+	for i := 1; i <= 3; i++ {
+		reply, err := c.StoreSkipBlock(sb, roster, []byte{byte(i)})
+		require.Nil(t, err)
+		sb = reply.Latest
+		select {
+		case b := <-blocks:
+			require.Equal(t, i, b.Index)
+			require.True(t, sb.Equal(b))
+		case <-time.After(10 * time.Second):
+			t.Fatal("didn't get new block")
+		}
+	}
+	close(done)
+	require.Nil(t, <-streamErr)
 }
 
 func TestClient_CreateLinkPrivate(t *testing.T) {
@@ -0,0 +1,94 @@
+package skipchain
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultBlockCacheSize is the number of skipblocks kept in memory by the
+// SkipBlockDB.
+const defaultBlockCacheSize = 256
+
+// blockCache is a least-recently-used cache of skipblocks, indexed by their
+// hash. As stored blocks get updated with new forward-links, every write to
+// the database has to invalidate the written blocks. The generation makes
+// sure that a block read from the database before such a write doesn't end up
+// in the cache after the write.
+type blockCache struct {
+	sync.Mutex
+	size       int
+	generation uint64
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+func newBlockCache(size int) *blockCache {
+	return &blockCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns a copy of the block, or nil if it is not in the cache.
+func (c *blockCache) get(id SkipBlockID) *SkipBlock {
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[string(id)]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*SkipBlock).Copy()
+}
+
+// gen returns the current generation of the cache. It has to be called
+// before reading a block from the database that will be added to the cache.
+func (c *blockCache) gen() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.generation
+}
+
+// add stores a copy of the block, unless some blocks have been invalidated
+// since the generation gen was returned.
+func (c *blockCache) add(sb *SkipBlock, gen uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if gen != c.generation || c.size <= 0 {
+		return
+	}
+	if e, ok := c.entries[string(sb.Hash)]; ok {
+		e.Value = sb.Copy()
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[string(sb.Hash)] = c.order.PushFront(sb.Copy())
+	for c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.entries, string(last.Value.(*SkipBlock).Hash))
+	}
+}
+
+// clear removes all blocks from the cache.
+func (c *blockCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// invalidate removes the blocks from the cache.
+func (c *blockCache) invalidate(ids ...SkipBlockID) {
+	c.Lock()
+	defer c.Unlock()
+	c.generation++
+	for _, id := range ids {
+		if e, ok := c.entries[string(id)]; ok {
+			c.order.Remove(e)
+			delete(c.entries, string(id))
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package skipchain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockCache(t *testing.T) {
+	c := newBlockCache(2)
+	blocks := make([]*SkipBlock, 3)
+	for i := range blocks {
+		blocks[i] = NewSkipBlock()
+		blocks[i].Index = i
+		blocks[i].Hash = SkipBlockID{byte(i + 1)}
+	}
+
+	gen := c.gen()
+	c.add(blocks[0], gen)
+	c.add(blocks[1], gen)
+	require.Equal(t, 0, c.get(blocks[0].Hash).Index)
+	// The least recently used block is evicted.
+	c.add(blocks[2], gen)
+	require.Nil(t, c.get(blocks[1].Hash))
+	require.NotNil(t, c.get(blocks[0].Hash))
+	require.NotNil(t, c.get(blocks[2].Hash))
+
+	// Changing the returned block doesn't change the cache.
+	c.get(blocks[0].Hash).Index = 10
+	require.Equal(t, 0, c.get(blocks[0].Hash).Index)
+
+	// Blocks read before an invalidation are not added.
+	c.invalidate(blocks[0].Hash)
+	require.Nil(t, c.get(blocks[0].Hash))
+	c.add(blocks[0], gen)
+	require.Nil(t, c.get(blocks[0].Hash))
+	c.add(blocks[0], c.gen())
+	require.NotNil(t, c.get(blocks[0].Hash))
+}
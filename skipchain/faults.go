@@ -0,0 +1,41 @@
+package skipchain
+
+import (
+	"sync"
+	"time"
+)
+
+// Faults are failures that a test injects in a conode, so that the view
+// changes and the catch-up of the services built on skipchains can be tested
+// without a real network failure. They must not be used in production.
+type Faults struct {
+	// PropagationDelay is waited by the node before it propagates new
+	// blocks.
+	PropagationDelay time.Duration
+	// DropPropagation makes the node ignore the propagated blocks, as if
+	// the messages were lost. The node has to catch up later.
+	DropPropagation bool
+	// RefuseSignatures makes the node refuse to sign new blocks, as if
+	// its answers were lost.
+	RefuseSignatures bool
+}
+
+// faults protects the Faults of the service.
+type faults struct {
+	sync.Mutex
+	Faults
+}
+
+func (f *faults) get() Faults {
+	f.Lock()
+	defer f.Unlock()
+	return f.Faults
+}
+
+// SetFaults replaces the faults injected in the service. An empty Faults
+// removes them.
+func (s *Service) SetFaults(f Faults) {
+	s.faults.Lock()
+	s.faults.Faults = f
+	s.faults.Unlock()
+}
@@ -0,0 +1,64 @@
+package skipchain
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/dedis/onet"
+)
+
+// FetchGenesis returns the genesis block id. If the conode doesn't know it,
+// it is fetched from the roster and stored. As the hash of the block must be
+// id, it can be trusted as much as id.
+func (s *Service) FetchGenesis(roster *onet.Roster, id SkipBlockID) (*SkipBlock, error) {
+	if sb := s.db.GetByID(id); sb != nil {
+		return sb, nil
+	}
+	sb, err := NewClient().GetSingleBlock(roster, id)
+	if err != nil {
+		return nil, err
+	}
+	if sb.Index != 0 {
+		return nil, errors.New("not a genesis block")
+	}
+	if err := s.storeBlocks([]*SkipBlock{sb}); err != nil {
+		return nil, err
+	}
+	return sb, nil
+}
+
+// FetchNewBlocks asks the roster of latest for the blocks stored after it,
+// like Client.StreamBlocks does. The blocks are verified against the
+// forward-links of the previous blocks, then stored together with the new
+// forward-links of latest, so that the registered callbacks are called. It
+// returns the new latest block, which is still latest if no block has been
+// stored before the timeout of the conode. This lets a conode follow a
+// skipchain whose roster it is not part of.
+func (s *Service) FetchNewBlocks(latest *SkipBlock) (*SkipBlock, error) {
+	cl := NewClient()
+	reply := &GetNewBlocksReply{}
+	err := errors.New("no other node in the roster")
+	for _, i := range rand.Perm(len(latest.Roster.List)) {
+		si := latest.Roster.List[i]
+		if si.Equal(s.ServerIdentity()) {
+			continue
+		}
+		err = cl.SendProtobuf(si, &GetNewBlocks{LatestID: latest.Hash}, reply)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, errors.New("couldn't get new blocks: " + err.Error())
+	}
+	if len(reply.Update) < 2 {
+		return latest, nil
+	}
+	if err := verifyNewBlocks(latest, reply.Update); err != nil {
+		return nil, err
+	}
+	if err := s.storeBlocks(reply.Update); err != nil {
+		return nil, err
+	}
+	return reply.Update[len(reply.Update)-1], nil
+}
@@ -0,0 +1,189 @@
+package skipchain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+)
+
+// The propagation of new blocks is a single push from the leader. A node that
+// misses it, for example because of a network partition, would only learn
+// about the missing blocks with the next push. So every node regularly asks a
+// random peer for the blocks following the latest block it knows of every
+// skipchain it is part of. The hashes of the latest blocks are the state
+// compared between the nodes.
+
+// SetGossipInterval sets how often the service pulls missing blocks from a
+// random peer. An interval of 0 stops the gossiping.
+func (s *Service) SetGossipInterval(d time.Duration) {
+	s.gossipMutex.Lock()
+	defer s.gossipMutex.Unlock()
+	s.gossipInterval = d
+	s.scheduleGossip()
+}
+
+// StopGossip stops the gossiping for good, it must be called before the
+// database is closed. It waits for a round in progress to finish, which
+// doesn't schedule the next one.
+func (s *Service) StopGossip() {
+	s.gossipMutex.Lock()
+	s.gossipStopped = true
+	s.scheduleGossip()
+	s.gossipMutex.Unlock()
+	s.gossipRounds.Wait()
+}
+
+// scheduleGossip replaces the pending gossip round, if any, with a new one.
+// The caller must hold gossipMutex.
+func (s *Service) scheduleGossip() {
+	if s.gossipTimer != nil {
+		s.gossipTimer.Stop()
+		s.gossipTimer = nil
+	}
+	if s.gossipInterval <= 0 || s.gossipStopped {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(s.gossipInterval, func() {
+		// The round is added under gossipMutex, so that StopGossip
+		// either prevents it or waits for it.
+		s.gossipMutex.Lock()
+		stopped := s.gossipTimer != t
+		if !stopped {
+			s.gossipRounds.Add(1)
+		}
+		s.gossipMutex.Unlock()
+		if stopped {
+			return
+		}
+		defer s.gossipRounds.Done()
+		s.gossipRound()
+		s.gossipMutex.Lock()
+		defer s.gossipMutex.Unlock()
+		// Only re-schedule if the interval didn't change and the
+		// gossiping didn't stop during the round.
+		if s.gossipTimer == t {
+			s.scheduleGossip()
+		}
+	})
+	s.gossipTimer = t
+}
+
+// gossipRound pulls the missing blocks of all skipchains this node is part
+// of.
+func (s *Service) gossipRound() {
+	// Only the skipchains used since the start are known to the database, so
+	// look up all others once.
+	s.gossipLoad.Do(func() {
+		sbs, err := s.db.getAllSkipchains()
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		for _, sb := range sbs {
+			s.db.latestUpdate(sb)
+		}
+	})
+	for _, id := range s.db.latestIDs() {
+		latest, err := s.db.GetLatest(s.db.GetByID(id))
+		if err != nil {
+			continue
+		}
+		if latest.Roster == nil || len(latest.Roster.List) < 2 {
+			continue
+		}
+		if i, _ := latest.Roster.Search(s.ServerIdentity().ID); i < 0 {
+			continue
+		}
+		peer := latest.Roster.RandomSubset(s.ServerIdentity(), 1)
+		if err := s.pullBlocks(peer, latest); err != nil {
+			log.Lvlf2("%s: couldn't pull blocks of %x: %s", s.ServerIdentity(),
+				latest.SkipChainID(), err)
+		}
+	}
+}
+
+// pullBlocks asks the nodes of the roster for the blocks following latest,
+// verifies them and stores those that are new.
+func (s *Service) pullBlocks(roster *onet.Roster, latest *SkipBlock) error {
+	blocks, err := s.requestBlocks(roster, &ProtoGetBlocks{
+		SBID:  latest.Hash,
+		Count: maxNewBlocks,
+	})
+	if err != nil {
+		return err
+	}
+	// The peer doesn't know our latest block, it is probably behind us.
+	if len(blocks) == 0 {
+		return nil
+	}
+	if !blocks[0].Hash.Equal(latest.Hash) {
+		return errors.New("got blocks of another skipchain")
+	}
+	for i, sb := range blocks {
+		if !sb.CalculateHash().Equal(sb.Hash) {
+			return errors.New("hash of pulled block doesn't match its content")
+		}
+		if err := sb.VerifyForwardSignatures(); err != nil {
+			return err
+		}
+		if i == 0 {
+			continue
+		}
+		if err := s.verifyBlock(sb); err != nil {
+			return err
+		}
+		prev := blocks[i-1]
+		if len(prev.ForwardLink) == 0 {
+			return errors.New("pulled block has no forward-link")
+		}
+		if err := prev.ForwardLink[0].VerifyRoster(prev, sb); err != nil {
+			return err
+		}
+	}
+
+	var newBlocks []*SkipBlock
+	for _, sb := range blocks {
+		if !s.knownBlock(sb) {
+			newBlocks = append(newBlocks, sb)
+		}
+	}
+	if len(newBlocks) == 0 {
+		return nil
+	}
+	log.Lvlf2("%s: pulled %d new blocks of %x", s.ServerIdentity(), len(newBlocks),
+		latest.SkipChainID())
+	return s.storeBlocks(newBlocks)
+}
+
+// knownBlock returns true if the block is already stored together with all
+// its forward-links and child-links, so that storing it again wouldn't change
+// anything.
+func (s *Service) knownBlock(sb *SkipBlock) bool {
+	stored := s.db.GetByID(sb.Hash)
+	if stored == nil {
+		return false
+	}
+	if len(stored.ForwardLink) < len(sb.ForwardLink) {
+		return false
+	}
+	for i, fl := range sb.ForwardLink {
+		if fl != nil && !fl.IsEmpty() &&
+			(stored.ForwardLink[i] == nil || stored.ForwardLink[i].IsEmpty()) {
+			return false
+		}
+	}
+	for _, child := range sb.ChildSL {
+		if !containsID(stored.ChildSL, child) {
+			return false
+		}
+	}
+	for _, cl := range sb.ChildLinks {
+		if cl != nil && !stored.hasChildLink(cl.To) {
+			return false
+		}
+	}
+	return true
+}
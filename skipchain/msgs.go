@@ -15,8 +15,20 @@ func init() {
 		// Requests for data
 		&GetUpdateChain{},
 		&GetUpdateChainReply{},
+		// Waiting for new blocks
+		&GetNewBlocks{},
+		&GetNewBlocksReply{},
 		// Request updated block
 		&GetSingleBlock{},
+		// Request many blocks at once
+		&GetBlocksByID{},
+		&GetBlocksByIDReply{},
+		// Request a proof for light clients
+		&GetChainProof{},
+		&GetChainProofReply{},
+		// Request children of a block
+		&GetChildren{},
+		&GetChildrenReply{},
 		// Fetch all skipchains
 		&GetAllSkipchains{},
 		&GetAllSkipchainsReply{},
@@ -36,6 +48,11 @@ func init() {
 		&AddFollow{},
 		// Removing a skipchain from following
 		&DelFollow{},
+		// Removing or archiving a skipchain
+		&DeleteChain{},
+		// Repairing missing forward-links
+		&RepairForwardLinks{},
+		&RepairForwardLinksReply{},
 		// EmptyReply for calls that only return errors
 		&EmptyReply{},
 		// Lists all skipchains we follow
@@ -91,10 +108,27 @@ type GetUpdateChain struct {
 
 // GetUpdateChainReply - returns the shortest chain to the current SkipBlock,
 // starting from the SkipBlock the client sent
+// Every block holds the roster that signed its forward-links, so the roster
+// valid at each hop is the Roster of the block, which is handed over to the
+// next block by the NewRoster field of the forward-link.
 type GetUpdateChainReply struct {
 	Update []*SkipBlock
 }
 
+// GetNewBlocks asks for the blocks following LatestID. If LatestID is the
+// latest block of its skipchain, the conode waits for a new block to be
+// stored before replying, or replies with an empty list after a timeout.
+type GetNewBlocks struct {
+	LatestID SkipBlockID
+}
+
+// GetNewBlocksReply returns the block LatestID with its forward-links,
+// followed by the blocks stored after it. Update is empty if no new block has
+// been stored in time.
+type GetNewBlocksReply struct {
+	Update []*SkipBlock
+}
+
 // GetAllSkipchains - erronously returns all blocks. Deprecated.
 type GetAllSkipchains struct {
 }
@@ -114,6 +148,42 @@ type GetAllSkipChainIDsReply struct {
 	IDs []SkipBlockID
 }
 
+// GetBlocksByID asks for many blocks in one request.
+type GetBlocksByID struct {
+	IDs []SkipBlockID
+}
+
+// GetBlocksByIDReply returns the requested blocks in the same order as the
+// IDs of the request.
+type GetBlocksByIDReply struct {
+	Blocks []*SkipBlock
+}
+
+// GetChainProof asks for a proof from the genesis block to the latest block
+// of the skipchain.
+type GetChainProof struct {
+	SkipchainID SkipBlockID
+}
+
+// GetChainProofReply returns the proof, which can be verified without
+// contacting the network.
+type GetChainProofReply struct {
+	Proof *ChainProof
+}
+
+// GetChildren asks for the genesis blocks of all child skipchains of the
+// block ParentID.
+type GetChildren struct {
+	ParentID SkipBlockID
+}
+
+// GetChildrenReply returns the parent-block, which holds the signed
+// child-links, and the genesis blocks of its children.
+type GetChildrenReply struct {
+	Parent   *SkipBlock
+	Children []*SkipBlock
+}
+
 // Internal calls
 
 // PropagateSkipBlocks sends a newly signed SkipBlock to all members of
@@ -299,6 +369,46 @@ type DelFollow struct {
 	Signature   []byte
 }
 
+// DeleteChain removes all blocks of a skipchain from the conode and stores a
+// tombstone, so that the skipchain cannot be stored again. If Archive is true,
+// the blocks are kept in an archive instead of being deleted. The Signature
+// has to be on "deletechain:", or "archivechain:" if Archive is true,
+// followed by SkipchainID, the public key of the conode and Timestamp, and
+// must come from an administrator of the conode. Timestamp is in unix
+// seconds and must be within five minutes of the time of the conode.
+type DeleteChain struct {
+	SkipchainID SkipBlockID
+	Archive     bool
+	Timestamp   int64
+	Signature   []byte
+}
+
+// RepairForwardLinks asks the conode to look for missing forward-links in the
+// skipchain and to have them signed again. The Signature has to be on
+// "repairchain:" + SkipchainID + the public key of the conode + Timestamp,
+// and must come from an administrator of the conode. Timestamp is in unix
+// seconds and must be within five minutes of the time of the conode.
+type RepairForwardLinks struct {
+	SkipchainID SkipBlockID
+	Timestamp   int64
+	Signature   []byte
+}
+
+// RepairForwardLinksReply lists the forward-links that have been repaired and
+// the ones that could not be signed.
+type RepairForwardLinksReply struct {
+	Repaired []*MissingLink
+	Failed   []*MissingLink
+}
+
+// MissingLink is a forward-link at the given height that was missing from
+// the block From to the block To.
+type MissingLink struct {
+	From   SkipBlockID
+	To     SkipBlockID
+	Height int
+}
+
 // ListFollow returns all followed lists all skipchains we follow.
 // The signature has to be on the following message:
 // "listfollow:" + the public key of the conode
@@ -0,0 +1,139 @@
+package skipchain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority"
+)
+
+// ChainProof proves that a block is part of a skipchain, so that a light
+// client can follow the chain without trusting the conode that returned the
+// proof. It holds the fixed part of every block on the path from the genesis
+// block to the latest block, following the highest forward-links. As the hash
+// of a block binds its roster, the blocks also give the roster evolution of
+// the chain.
+type ChainProof struct {
+	// GenesisID is the ID of the skipchain.
+	GenesisID SkipBlockID
+	// Blocks goes from the genesis block to the latest block.
+	Blocks []*SkipBlockFix
+	// Links[i] is the forward-link from Blocks[i] to Blocks[i+1], signed by
+	// the roster of Blocks[i].
+	Links []*ForwardLink
+}
+
+// Verify checks that the proof starts at the genesis block and that every
+// forward-link is correctly signed by the roster of the block it comes from.
+// It doesn't need to contact any node.
+func (cp *ChainProof) Verify() error {
+	if len(cp.Blocks) == 0 {
+		return errors.New("proof has no blocks")
+	}
+	if !cp.Blocks[0].CalculateHash().Equal(cp.GenesisID) {
+		return errors.New("first block is not the genesis block")
+	}
+	return cp.verifyLinks()
+}
+
+// VerifyFrom checks a proof returned by GetProofFrom: it must start at the
+// trusted block, and every forward-link is verified like in Verify. The
+// blocks before the trusted block are not verified again.
+func (cp *ChainProof) VerifyFrom(trusted *SkipBlock) error {
+	if len(cp.Blocks) == 0 {
+		return errors.New("proof has no blocks")
+	}
+	if !trusted.SkipChainID().Equal(cp.GenesisID) {
+		return errors.New("trusted block is not part of the skipchain")
+	}
+	if !cp.Blocks[0].CalculateHash().Equal(trusted.Hash) {
+		return errors.New("first block is not the trusted block")
+	}
+	return cp.verifyLinks()
+}
+
+// verifyLinks checks the forward-links from the first block of the proof.
+func (cp *ChainProof) verifyLinks() error {
+	if len(cp.Links) != len(cp.Blocks)-1 {
+		return errors.New("proof needs one forward-link between two blocks")
+	}
+	from := &SkipBlock{SkipBlockFix: cp.Blocks[0]}
+	from.Hash = from.CalculateHash()
+	for i, fl := range cp.Links {
+		if fl == nil || from.Roster == nil {
+			return fmt.Errorf("missing forward-link or roster at block %d", i)
+		}
+		if err := fl.Verify(cothority.Suite, from.Roster.Publics()); err != nil {
+			return fmt.Errorf("wrong forward-link at block %d: %v", i, err)
+		}
+		to := &SkipBlock{SkipBlockFix: cp.Blocks[i+1]}
+		to.Hash = to.CalculateHash()
+		if err := fl.VerifyRoster(from, to); err != nil {
+			return fmt.Errorf("wrong forward-link at block %d: %v", i, err)
+		}
+		if !to.GenesisID.Equal(cp.GenesisID) {
+			return fmt.Errorf("block %d is not part of the skipchain", i+1)
+		}
+		from = to
+	}
+	return nil
+}
+
+// Latest returns the last block of the proof together with its hash, or nil
+// if the proof is empty. Its content can only be trusted once Verify returns
+// nil.
+func (cp *ChainProof) Latest() *SkipBlock {
+	if len(cp.Blocks) == 0 {
+		return nil
+	}
+	latest := &SkipBlock{SkipBlockFix: cp.Blocks[len(cp.Blocks)-1]}
+	latest.Hash = latest.CalculateHash()
+	return latest
+}
+
+// GetProof returns a ChainProof from the genesis block to the latest known
+// block of the skipchain.
+func (db *SkipBlockDB) GetProof(genesisID SkipBlockID) (*ChainProof, error) {
+	sb := db.GetByID(genesisID)
+	if sb == nil {
+		return nil, errors.New("couldn't find genesis block")
+	}
+	if sb.Index != 0 {
+		return nil, errors.New("not a genesis block")
+	}
+	return db.proofFrom(sb)
+}
+
+// GetProofFrom returns a ChainProof from the block with the given ID to the
+// latest known block of its skipchain, for clients that already trust that
+// block. It must be verified with VerifyFrom.
+func (db *SkipBlockDB) GetProofFrom(id SkipBlockID) (*ChainProof, error) {
+	sb := db.GetByID(id)
+	if sb == nil {
+		return nil, errors.New("couldn't find block")
+	}
+	return db.proofFrom(sb)
+}
+
+// proofFrom follows the highest forward-links from sb.
+func (db *SkipBlockDB) proofFrom(sb *SkipBlock) (*ChainProof, error) {
+	cp := &ChainProof{GenesisID: sb.SkipChainID()}
+	for {
+		cp.Blocks = append(cp.Blocks, sb.SkipBlockFix)
+		var link *ForwardLink
+		for i := len(sb.ForwardLink) - 1; i >= 0; i-- {
+			if !sb.ForwardLink[i].IsEmpty() {
+				link = sb.ForwardLink[i]
+				break
+			}
+		}
+		if link == nil {
+			return cp, nil
+		}
+		cp.Links = append(cp.Links, link)
+		sb = db.GetByID(link.To)
+		if sb == nil {
+			return nil, fmt.Errorf("missing block %x in chain", link.To)
+		}
+	}
+}
@@ -13,6 +13,7 @@ package skipchain
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"reflect"
@@ -23,7 +24,9 @@ import (
 
 	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/byzcoinx"
+	"github.com/dedis/cothority/ftcosi/protocol"
 	"github.com/dedis/cothority/messaging"
+	"github.com/dedis/cothority/metrics"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/sign/schnorr"
 	"github.com/dedis/kyber/util/random"
@@ -37,6 +40,7 @@ import (
 const ServiceName = "Skipchain"
 const bftNewBlock = "SkipchainBFTNew"
 const bftFollowBlock = "SkipchainBFTFollow"
+const bftChildLink = "SkipchainBFTChild"
 
 var storageKey = []byte("skipchainconfig")
 
@@ -64,13 +68,30 @@ type Service struct {
 	db                      *SkipBlockDB
 	propagate               messaging.PropagationFunc
 	verifiers               map[VerifierID]SkipBlockVerifier
+	genesisVerifiers        map[VerifierID]bool
+	storeCallbacks          map[VerifierID][]StoreBlockCallback
+	verifiersMutex          sync.Mutex
+	adminVerifiers          []AdminVerifier
+	faults                  faults
 	storageMutex            sync.Mutex
 	Storage                 *Storage
 	bftTimeout              time.Duration
 	propTimeout             time.Duration
+	propTimeoutMutex        sync.Mutex
 	chains                  chainLocker
+	newBlocks               blockNotifier
+	newBlocksTimeout        time.Duration
+	maxBlockSize            int
+	gossipMutex             sync.Mutex
+	gossipInterval          time.Duration
+	gossipTimer             *time.Timer
+	gossipStopped           bool
+	gossipRounds            sync.WaitGroup
+	gossipLoad              sync.Once
 	verifyNewBlockBuffer    sync.Map
 	verifyFollowBlockBuffer sync.Map
+	verifyChildLinkBuffer   sync.Map
+	bftSigners              map[string]*byzcoinx.Signer
 }
 
 type chainLocker struct {
@@ -84,6 +105,43 @@ type chainLocker struct {
 
 var errTimeout = errors.New("timeout waiting to lock chain")
 
+// blockNotifier wakes up the GetNewBlocks requests that wait for a new block
+// of a skipchain.
+type blockNotifier struct {
+	sync.Mutex
+	waiters map[string]chan bool
+}
+
+// wait returns a channel that is closed the next time a block of the
+// skipchain is stored.
+func (bn *blockNotifier) wait(scID SkipBlockID) <-chan bool {
+	bn.Lock()
+	defer bn.Unlock()
+	// Lazy initialization.
+	if bn.waiters == nil {
+		bn.waiters = make(map[string]chan bool)
+	}
+	ch, ok := bn.waiters[string(scID)]
+	if !ok {
+		ch = make(chan bool)
+		bn.waiters[string(scID)] = ch
+	}
+	return ch
+}
+
+// notify wakes up everybody waiting on the skipchains of the blocks.
+func (bn *blockNotifier) notify(sbs []*SkipBlock) {
+	bn.Lock()
+	defer bn.Unlock()
+	for _, sb := range sbs {
+		id := string(sb.SkipChainID())
+		if ch, ok := bn.waiters[id]; ok {
+			close(ch)
+			delete(bn.waiters, id)
+		}
+	}
+}
+
 func (cl *chainLocker) lock(chain SkipBlockID) {
 	cl.Lock()
 	// Lazy initializtion.
@@ -163,13 +221,14 @@ type Storage struct {
 // If TargetSkipChainID is an empty slice, the service will create a new
 // skipchain and store the given block as genesis-block.
 func (s *Service) StoreSkipBlock(psbd *StoreSkipBlock) (*StoreSkipBlockReply, error) {
+	start := time.Now()
 	// Initial checks on the proposed block.
 	prop := psbd.NewBlock
 	if !s.ServerIdentity().Equal(prop.Roster.Get(0)) {
 		return nil, errors.New(
 			"only leader is allowed to add blocks")
 	}
-	if len(s.Storage.Clients) > 0 {
+	if s.hasClients() {
 		if psbd.Signature == nil {
 			return nil, errors.New(
 				"cannot create new skipblock without authentication")
@@ -198,6 +257,9 @@ func (s *Service) StoreSkipBlock(psbd *StoreSkipBlock) (*StoreSkipBlockReply, er
 		if err != nil {
 			return nil, err
 		}
+		if err := s.verifyGenesis(prop); err != nil {
+			return nil, err
+		}
 
 		var changed []*SkipBlock
 		if !prop.ParentBlockID.IsNull() {
@@ -206,7 +268,17 @@ func (s *Service) StoreSkipBlock(psbd *StoreSkipBlock) (*StoreSkipBlockReply, er
 				return nil, errors.New(
 					"Didn't find parent")
 			}
+			// Children of the same parent can be created in parallel, so
+			// lock the chain of the parent and read it again.
+			s.chains.lock(parent.SkipChainID())
+			defer s.chains.unlock(parent.SkipChainID())
+			parent = s.db.GetByID(prop.ParentBlockID)
+			cl, err := s.childLink(parent, prop)
+			if err != nil {
+				return nil, err
+			}
 			parent.ChildSL = append(parent.ChildSL, prop.Hash)
+			parent.ChildLinks = append(parent.ChildLinks, cl)
 			changed = append(changed, parent)
 		}
 		changed = append(changed, prop)
@@ -285,13 +357,7 @@ func (s *Service) StoreSkipBlock(psbd *StoreSkipBlock) (*StoreSkipBlockReply, er
 		prop.Index = prev.Index + 1
 		prop.GenesisID = scID
 		// And calculate the height of that block.
-		index := prop.Index
-		for prop.Height = 1; index%prop.BaseHeight == 0; prop.Height++ {
-			index /= prop.BaseHeight
-			if prop.Height >= prop.MaximumHeight {
-				break
-			}
-		}
+		prop.Height = blockHeight(prop.Index, prop.BaseHeight, prop.MaximumHeight)
 		log.Lvl4("Found height", prop.Height, "for index", prop.Index,
 			"and maxHeight", prop.MaximumHeight, "and base", prop.BaseHeight)
 
@@ -321,6 +387,9 @@ func (s *Service) StoreSkipBlock(psbd *StoreSkipBlock) (*StoreSkipBlockReply, er
 			prop.BackLinkIDs[h] = pointer.Hash
 		}
 		prop.updateHash()
+		if err := s.verifyBlock(prop); err != nil {
+			return nil, err
+		}
 
 		// Only check changing roster, or if this is the block after the genesis-block,
 		// as we don't verify the roster for the genesis-block.
@@ -370,6 +439,8 @@ func (s *Service) StoreSkipBlock(psbd *StoreSkipBlock) (*StoreSkipBlockReply, er
 		Latest:   prop,
 	}
 	log.Lvlf3("Block added, replying. New latest is: %x, at index %d", prop.Hash, prop.Index)
+	metrics.BlockLatency.WithLabelValues(metrics.Chain(prop.SkipChainID())).Observe(
+		time.Since(start).Seconds())
 	return reply, nil
 }
 
@@ -412,6 +483,50 @@ func (s *Service) GetUpdateChain(guc *GetUpdateChain) (*GetUpdateChainReply, err
 	return reply, nil
 }
 
+// GetNewBlocks returns the block with the id LatestID, followed by the blocks
+// that have been stored after it. If there are no such blocks, it waits until
+// a new block of the skipchain is stored. This allows clients to follow a
+// skipchain without polling GetUpdateChain. If no block has been stored before
+// the timeout, an empty reply is returned and the client has to ask again.
+func (s *Service) GetNewBlocks(req *GetNewBlocks) (*GetNewBlocksReply, error) {
+	sb := s.db.GetByID(req.LatestID)
+	if sb == nil {
+		return nil, errors.New("couldn't find latest skipblock")
+	}
+	timeout := time.After(s.newBlocksTimeout)
+	for {
+		// The channel has to be fetched before looking for new blocks,
+		// else we might miss a block stored in between.
+		stored := s.newBlocks.wait(sb.SkipChainID())
+		update := s.blocksFrom(req.LatestID, maxNewBlocks+1)
+		if len(update) > 1 {
+			return &GetNewBlocksReply{Update: update}, nil
+		}
+		select {
+		case <-stored:
+		case <-timeout:
+			return &GetNewBlocksReply{}, nil
+		}
+	}
+}
+
+// blocksFrom returns up to n consecutive blocks, starting with the block id.
+func (s *Service) blocksFrom(id SkipBlockID, n int) []*SkipBlock {
+	var blocks []*SkipBlock
+	for len(blocks) < n {
+		sb := s.db.GetByID(id)
+		if sb == nil {
+			break
+		}
+		blocks = append(blocks, sb)
+		if len(sb.ForwardLink) == 0 {
+			break
+		}
+		id = sb.ForwardLink[0].To
+	}
+	return blocks
+}
+
 // SyncChain communicates with conodes in the Roster via getBlocks
 // in order traverse the chain and save the blocks locally. It starts with
 // the given 'latest' skipblockid and fetches all blocks up to the latest block.
@@ -431,6 +546,28 @@ func (s *Service) SyncChain(roster *onet.Roster, latest SkipBlockID) error {
 			return errors.New("didn't find any corresponding blocks")
 		}
 
+		for i, b := range blocks {
+			if !b.CalculateHash().Equal(b.Hash) {
+				return errors.New("hash of synched block doesn't match its content")
+			}
+			if err := b.VerifyForwardSignatures(); err != nil {
+				return err
+			}
+			// getBlocks follows the highest forward-link, so the roster of
+			// each block has to be handed over by that link of the previous
+			// block.
+			if i > 0 {
+				prev := blocks[i-1]
+				if len(prev.ForwardLink) == 0 {
+					return errors.New("synched block has no forward-link")
+				}
+				fl := prev.ForwardLink[len(prev.ForwardLink)-1]
+				if err := fl.VerifyRoster(prev, b); err != nil {
+					return err
+				}
+			}
+		}
+
 		fBlock := blocks[0]
 		if !s.db.HasForwardLink(fBlock) {
 			if latest.Equal(fBlock.SkipChainID()) {
@@ -447,8 +584,7 @@ func (s *Service) SyncChain(roster *onet.Roster, latest SkipBlockID) error {
 		}
 		latest = lBlock.Hash
 	}
-	_, err := s.db.StoreBlocks(allBlocks)
-	return err
+	return s.storeBlocks(allBlocks)
 }
 
 // getBlocks uses ProtocolGetBlocks to return up to n blocks, traversing the
@@ -462,6 +598,16 @@ func (s *Service) getBlocks(roster *onet.Roster, id SkipBlockID, n int) ([]*Skip
 		subCount /= 2
 	}
 	r := roster.RandomSubset(s.ServerIdentity(), subCount)
+	return s.requestBlocks(r, &ProtoGetBlocks{
+		SBID:     id,
+		Count:    n,
+		Skipping: true,
+	})
+}
+
+// requestBlocks sends the request to all other nodes of the roster, which
+// must start with this node, and returns the first non-empty answer.
+func (s *Service) requestBlocks(r *onet.Roster, req *ProtoGetBlocks) ([]*SkipBlock, error) {
 	tr := r.GenerateStar()
 	pi, err := s.CreateProtocol(ProtocolGetBlocks, tr)
 	if err != nil {
@@ -469,18 +615,14 @@ func (s *Service) getBlocks(roster *onet.Roster, id SkipBlockID, n int) ([]*Skip
 	}
 
 	pisc := pi.(*GetBlocks)
-	pisc.GetBlocks = &ProtoGetBlocks{
-		SBID:     id,
-		Count:    n,
-		Skipping: true,
-	}
+	pisc.GetBlocks = req
 	if err := pi.Start(); err != nil {
 		log.ErrFatal(err)
 	}
 	select {
 	case result := <-pisc.GetBlocksReply:
 		return result, nil
-	case <-time.After(s.propTimeout):
+	case <-time.After(s.getPropTimeout()):
 		return nil, errors.New("timeout waiting for GetBlocks reply")
 	}
 }
@@ -525,26 +667,60 @@ func (s *Service) GetSingleBlock(id *GetSingleBlock) (*SkipBlock, error) {
 	return sb, nil
 }
 
-// GetSingleBlockByIndex searches for the given block and returns it. If no such block is
-// found, a nil is returned.
-func (s *Service) GetSingleBlockByIndex(id *GetSingleBlockByIndex) (*SkipBlock, error) {
-	sb := s.db.GetByID(id.Genesis)
-	if sb == nil {
-		return nil, errors.New("No such genesis-block")
+// GetBlocksByID returns all requested blocks, so that clients don't need to
+// send one request per block. It fails if one of the blocks is not found.
+func (s *Service) GetBlocksByID(req *GetBlocksByID) (*GetBlocksByIDReply, error) {
+	if len(req.IDs) > maxBlocksByID {
+		return nil, fmt.Errorf("cannot request more than %d blocks", maxBlocksByID)
 	}
-	if sb.Index == id.Index {
-		return sb, nil
+	blocks, err := s.db.GetBlocks(req.IDs)
+	if err != nil {
+		return nil, err
 	}
-	for len(sb.ForwardLink) > 0 {
-		sb = s.db.GetByID(sb.ForwardLink[0].To)
+	for i, sb := range blocks {
 		if sb == nil {
-			return nil, errors.New("didn't find block in forward link")
+			return nil, fmt.Errorf("couldn't find block %x", req.IDs[i])
 		}
-		if sb.Index == id.Index {
-			return sb, nil
+	}
+	return &GetBlocksByIDReply{Blocks: blocks}, nil
+}
+
+// GetChainProof returns a proof that the latest known block is part of the
+// skipchain, for clients that don't want to trust this conode.
+func (s *Service) GetChainProof(req *GetChainProof) (*GetChainProofReply, error) {
+	proof, err := s.db.GetProof(req.SkipchainID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetChainProofReply{Proof: proof}, nil
+}
+
+// GetChildren returns the block with the id ParentID and the genesis blocks
+// of all its child skipchains. Each child can be verified using the signed
+// child-links of the parent.
+func (s *Service) GetChildren(req *GetChildren) (*GetChildrenReply, error) {
+	parent := s.db.GetByID(req.ParentID)
+	if parent == nil {
+		return nil, errors.New("couldn't find parent-block")
+	}
+	reply := &GetChildrenReply{Parent: parent}
+	for _, id := range parent.ChildSL {
+		child := s.db.GetByID(id)
+		if child == nil {
+			return nil, fmt.Errorf("couldn't find child %x", id)
 		}
+		reply.Children = append(reply.Children, child)
 	}
-	return nil, errors.New("No block with this index found")
+	return reply, nil
+}
+
+// GetSingleBlockByIndex searches for the given block and returns it. If no such block is
+// found, a nil is returned. An index of -1 returns the latest block of the skipchain.
+func (s *Service) GetSingleBlockByIndex(id *GetSingleBlockByIndex) (*SkipBlock, error) {
+	if id.Index == -1 {
+		return s.db.GetLatestByID(id.Genesis)
+	}
+	return s.db.GetByIndex(id.Genesis, id.Index)
 }
 
 // GetAllSkipchains currently returns a list of all the known blocks.
@@ -617,6 +793,8 @@ func (s *Service) Unlink(unlink *Unlink) (*EmptyReply, error) {
 		return &EmptyReply{}, err
 	}
 	msg = append([]byte("unlink:"), msg...)
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
 	found := false
 	for _, pub := range s.Storage.Clients {
 		if pub.Equal(unlink.Public) {
@@ -642,7 +820,7 @@ func (s *Service) Unlink(unlink *Unlink) (*EmptyReply, error) {
 		return &EmptyReply{}, errors.New("didn't find this clients public key")
 	}
 	s.Storage.Clients = append(s.Storage.Clients[:client], s.Storage.Clients[client+1:]...)
-	s.save()
+	s.saveLocked()
 	return &EmptyReply{}, nil
 }
 
@@ -651,6 +829,8 @@ func (s *Service) Unlink(unlink *Unlink) (*EmptyReply, error) {
 // tasks.
 func (s *Service) Listlink(list *Listlink) (*ListlinkReply, error) {
 	reply := &ListlinkReply{}
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
 	for _, pub := range s.Storage.Clients {
 		reply.Publics = append(reply.Publics, pub)
 	}
@@ -741,6 +921,8 @@ func (s *Service) DelFollow(del *DelFollow) (*EmptyReply, error) {
 	if !s.verifySigs(msg, del.Signature) {
 		return &EmptyReply{}, errors.New("wrong signature of unknown signer")
 	}
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
 	deleted := false
 	for i, scid := range s.Storage.FollowIDs {
 		if scid.Equal(del.SkipchainID) {
@@ -761,10 +943,150 @@ func (s *Service) DelFollow(del *DelFollow) (*EmptyReply, error) {
 	if !deleted {
 		return &EmptyReply{}, errors.New("didn't find any block of that id")
 	}
-	s.save()
+	s.saveLocked()
 	return &EmptyReply{}, nil
 }
 
+// DeleteChain removes or archives all blocks of a skipchain. Because this
+// cannot be undone, it is an administrative request.
+func (s *Service) DeleteChain(del *DeleteChain) (*EmptyReply, error) {
+	msg := deleteChainMsg(del.SkipchainID, del.Archive, s.ServerIdentity().Public, del.Timestamp)
+	if err := s.verifyAdminRequest(msg, del.Timestamp, del.Signature); err != nil {
+		return nil, err
+	}
+	s.chains.lock(del.SkipchainID)
+	defer s.chains.unlock(del.SkipchainID)
+	n, err := s.db.RemoveChain(del.SkipchainID, del.Archive)
+	if err != nil {
+		return nil, err
+	}
+	log.Lvlf2("%s: removed %d blocks of skipchain %x", s.ServerIdentity(), n, del.SkipchainID)
+	return &EmptyReply{}, nil
+}
+
+// AdminVerifier returns true if sig is a signature on msg of an
+// administrator of the conode that another service knows of.
+type AdminVerifier func(msg, sig []byte) bool
+
+// RegisterAdminVerifier adds a verifier to VerifyAdmin, so that a service
+// can add its own administrators, for example the signers of a darc.
+func (s *Service) RegisterAdminVerifier(v AdminVerifier) {
+	s.verifiersMutex.Lock()
+	defer s.verifiersMutex.Unlock()
+	s.adminVerifiers = append(s.adminVerifiers, v)
+}
+
+// VerifyAdmin checks that sig is a signature on msg of one of the linked
+// clients, or of an administrator accepted by a registered AdminVerifier.
+// The services use it to authenticate their administrative requests.
+// Contrary to the other requests, it fails if the conode has no linked
+// client and no verifier accepts the signature.
+func (s *Service) VerifyAdmin(msg, sig []byte) error {
+	if s.hasClients() && s.verifySigs(msg, sig) {
+		return nil
+	}
+	s.verifiersMutex.Lock()
+	verifiers := append([]AdminVerifier{}, s.adminVerifiers...)
+	s.verifiersMutex.Unlock()
+	for _, v := range verifiers {
+		if v(msg, sig) {
+			return nil
+		}
+	}
+	if !s.hasClients() && len(verifiers) == 0 {
+		return errors.New("need a linked client for administrative requests")
+	}
+	return errors.New("wrong signature of unknown signer")
+}
+
+func deleteChainMsg(scID SkipBlockID, archive bool, conode kyber.Point, timestamp int64) []byte {
+	if archive {
+		return adminMsg("archivechain", conode, timestamp, scID)
+	}
+	return adminMsg("deletechain", conode, timestamp, scID)
+}
+
+// adminMaxSkew is the maximum difference between the timestamp of an
+// administrative request and the time of the conode.
+const adminMaxSkew = 5 * time.Minute
+
+// verifyAdminRequest is like VerifyAdmin, but also checks that the timestamp
+// of the request is recent, so that it can't be replayed later.
+func (s *Service) verifyAdminRequest(msg []byte, timestamp int64, sig []byte) error {
+	if d := time.Since(time.Unix(timestamp, 0)); d > adminMaxSkew || d < -adminMaxSkew {
+		return errors.New("the timestamp of the request is too far from the time of the conode")
+	}
+	return s.VerifyAdmin(msg, sig)
+}
+
+// adminMsg returns the message an administrator signs for the request with
+// the given prefix and data, sent to the conode with the public key conode at
+// timestamp. It can't be replayed to another conode.
+func adminMsg(prefix string, conode kyber.Point, timestamp int64, data []byte) []byte {
+	msg := append([]byte(prefix+":"), data...)
+	msg = append(msg, []byte(conode.String())...)
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(timestamp))
+	return append(msg, buf...)
+}
+
+// RepairForwardLinks looks for missing higher-level forward-links in the
+// skipchain, for example if the leader crashed while collecting the
+// signatures, and asks the corresponding rosters to sign them again. As a
+// conode can only ask for a signature if it is part of the roster, links of
+// other rosters are reported as failed. It is an administrative request, the
+// signature has to be on the message returned by repairChainMsg.
+func (s *Service) RepairForwardLinks(req *RepairForwardLinks) (*RepairForwardLinksReply, error) {
+	msg := repairChainMsg(req.SkipchainID, s.ServerIdentity().Public, req.Timestamp)
+	if err := s.verifyAdminRequest(msg, req.Timestamp, req.Signature); err != nil {
+		return nil, err
+	}
+	sb := s.db.GetByID(req.SkipchainID)
+	if sb == nil || sb.Index != 0 {
+		return nil, errors.New("didn't find genesis block")
+	}
+	s.chains.lock(req.SkipchainID)
+	defer s.chains.unlock(req.SkipchainID)
+
+	reply := &RepairForwardLinksReply{}
+	for {
+		for h := 1; sb.Index > 0 && h < len(sb.BackLinkIDs); h++ {
+			from := s.db.GetByID(sb.BackLinkIDs[h])
+			if from == nil {
+				continue
+			}
+			if fl := from.GetForward(h); fl != nil && !fl.IsEmpty() {
+				continue
+			}
+			link := &MissingLink{From: from.Hash, To: sb.Hash, Height: h}
+			err := s.addForwardLink(&ForwardSignature{
+				TargetHeight: h,
+				Previous:     from.Hash,
+				Newest:       sb,
+			})
+			if err != nil {
+				log.Errorf("%s: couldn't repair link %d->%d: %s", s.ServerIdentity(),
+					from.Index, sb.Index, err)
+				reply.Failed = append(reply.Failed, link)
+				continue
+			}
+			log.Lvlf2("%s: repaired link %d->%d", s.ServerIdentity(), from.Index, sb.Index)
+			reply.Repaired = append(reply.Repaired, link)
+		}
+		if len(sb.ForwardLink) == 0 {
+			break
+		}
+		if sb = s.db.GetByID(sb.ForwardLink[0].To); sb == nil {
+			break
+		}
+	}
+	return reply, nil
+}
+
+func repairChainMsg(scID SkipBlockID, conode kyber.Point, timestamp int64) []byte {
+	return adminMsg("repairchain", conode, timestamp, scID)
+}
+
 // ListFollow returns the skipchain-ids that are followed
 func (s *Service) ListFollow(list *ListFollow) (*ListFollowReply, error) {
 	reply := &ListFollowReply{}
@@ -776,11 +1098,15 @@ func (s *Service) ListFollow(list *ListFollow) (*ListFollowReply, error) {
 	if !s.verifySigs(msg, list.Signature) {
 		return reply, errors.New("wrong signature of unknown signer")
 	}
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
 	if len(s.Storage.Follow) > 0 {
-		reply.Follow = &s.Storage.Follow
+		follow := append([]FollowChainType{}, s.Storage.Follow...)
+		reply.Follow = &follow
 	}
 	if len(s.Storage.FollowIDs) > 0 {
-		reply.FollowIDs = &s.Storage.FollowIDs
+		followIDs := append([]SkipBlockID{}, s.Storage.FollowIDs...)
+		reply.FollowIDs = &followIDs
 	}
 	return reply, nil
 }
@@ -817,13 +1143,15 @@ func (s *Service) NewProtocol(ti *onet.TreeNodeInstance, conf *onet.GenericConfi
 // AddClientKey can be used by other services to add a key so
 // they can store new Blocks
 func (s *Service) AddClientKey(pub kyber.Point) {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
 	for _, p := range s.Storage.Clients {
 		if p.Equal(pub) {
 			return
 		}
 	}
 	s.Storage.Clients = append(s.Storage.Clients, pub)
-	s.save()
+	s.saveLocked()
 }
 
 // SetBFTTimeout can be used in tests to change the timeout passed
@@ -834,7 +1162,23 @@ func (s *Service) SetBFTTimeout(t time.Duration) {
 
 // SetPropTimeout is used to set the propagation timeout.
 func (s *Service) SetPropTimeout(t time.Duration) {
+	s.propTimeoutMutex.Lock()
 	s.propTimeout = t
+	s.propTimeoutMutex.Unlock()
+}
+
+// getPropTimeout returns the propagation timeout, which can be changed
+// while the service runs.
+func (s *Service) getPropTimeout() time.Duration {
+	s.propTimeoutMutex.Lock()
+	defer s.propTimeoutMutex.Unlock()
+	return s.propTimeout
+}
+
+// SetMaxBlockSize sets the maximum size in bytes of the Data and the Payload
+// of the skipblocks this conode accepts.
+func (s *Service) SetMaxBlockSize(size int) {
+	s.maxBlockSize = size
 }
 
 // EnableViewChange enables view-change, it cannot be turned off afterwards.
@@ -843,6 +1187,8 @@ func (s *Service) EnableViewChange() {
 }
 
 func (s *Service) verifySigs(msg, sig []byte) bool {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
 	// If there are no clients, all signatures verify.
 	if len(s.Storage.Clients) == 0 {
 		return true
@@ -893,7 +1239,10 @@ func (s *Service) forwardLinkLevel0(src, dst *SkipBlock) error {
 		return fmt.Errorf("Couldn't marshal block: %s", err.Error())
 	}
 	fwd := NewForwardLink(src, dst)
-	sig, err := s.startBFT(bftNewBlock, roster, fwd.Hash(), data)
+	// The index of the new block is the sequence of the round, so that
+	// the nodes never sign a delayed proposal for an older block.
+	sig, err := s.startBFTSequence(bftNewBlock, roster, fwd.Hash(), data,
+		src.SkipChainID(), uint64(dst.Index))
 	if err != nil {
 		log.Error(s.ServerIdentity().Address, "startBFT failed with", err)
 		return err
@@ -912,7 +1261,7 @@ func (s *Service) forwardLinkLevel0(src, dst *SkipBlock) error {
 		return errors.New("Wrong BFT-signature: " + err.Error())
 	}
 
-	if _, err := s.db.StoreBlocks([]*SkipBlock{src, dst}); err != nil {
+	if err := s.storeBlocks([]*SkipBlock{src, dst}); err != nil {
 		return errors.New("couldn't store new forward link or new block: " + err.Error())
 	}
 	var proof []*SkipBlock
@@ -937,64 +1286,67 @@ func (s *Service) forwardLinkLevel0(src, dst *SkipBlock) error {
 
 // bftForwardLinkLevel0 makes sure that a signature-request for a forward-link
 // is valid.
-func (s *Service) bftForwardLinkLevel0(msg, data []byte) bool {
+func (s *Service) bftForwardLinkLevel0(msg, data []byte) error {
 	log.Lvlf4("%s verifying block %x", s.ServerIdentity(), msg)
+	if s.faults.get().RefuseSignatures {
+		return errors.New("refusing to sign: injected fault")
+	}
 	_, fsInt, err := network.Unmarshal(data, cothority.Suite)
 	if err != nil {
 		log.Error(s.ServerIdentity().Address, "Couldn't unmarshal ForwardSignature", data)
-		return false
+		return errors.New("couldn't unmarshal ForwardSignature: " + err.Error())
 	}
 	fs, ok := fsInt.(*ForwardSignature)
 	if !ok {
 		log.Errorf("got unexpected type %T", fsInt)
-		return false
+		return fmt.Errorf("got unexpected type %T", fsInt)
 	}
 	prevSB := s.db.GetByID(fs.Previous)
 	if prevSB == nil {
 		if !s.blockIsFriendly(fs.Newest) {
 			log.Lvlf2("%s: block is not friendly: %x", s.ServerIdentity(), fs.Newest.Hash)
-			return false
+			return fmt.Errorf("block is not friendly: %x", fs.Newest.Hash)
 		}
 		log.Lvl3(s.ServerIdentity(), "Didn't find src-skipblock, trying to sync")
 		if err := s.SyncChain(fs.Newest.Roster, fs.Previous); err != nil {
 			log.Error("failed to sync skipchain", err)
-			return false
+			return errors.New("failed to sync skipchain: " + err.Error())
 		}
 		prevSB = s.db.GetByID(fs.Previous)
 		if prevSB == nil {
 			log.Error(s.ServerIdentity(), "Didn't find src-skipblock")
-			return false
+			return errors.New("didn't find src-skipblock")
 		}
 	}
 
 	fl := NewForwardLink(prevSB, fs.Newest)
 	if bytes.Compare(fl.Hash(), msg) != 0 {
 		log.Lvlf2("Hash of ForwardLink is different from msg %x %x", msg, fl.Hash())
-		return false
+		return errors.New("hash of ForwardLink is different from msg")
 	}
 
 	if !fs.Newest.BackLinkIDs[0].Equal(fs.Previous) {
 		log.Lvl2("Backlink does not point to previous block:", prevSB.Index, fs.Newest.Index)
-		return false
+		return errors.New("backlink does not point to previous block")
 	}
 	if len(prevSB.ForwardLink) > 0 {
 		log.Lvl2("previous block already has forward-link")
-		return false
+		return errors.New("previous block already has forward-link")
 	}
 
-	ok = func() bool {
+	err = func() error {
 		for _, ver := range fs.Newest.VerifierIDs {
-			f, exists := s.verifiers[ver]
-			if !exists {
+			f := s.getVerifier(ver)
+			if f == nil {
 				log.Lvlf2("Found no user verification for %x", ver)
-				return false
+				return fmt.Errorf("found no user verification for %x", ver)
 			}
 			// Now we call the verification function. Wrap up f() inside of
 			// g(), so that we can recover panics from f().
 			g := func(to []byte, newest *SkipBlock) (out bool) {
 				defer func() {
 					if re := recover(); re != nil {
-						log.Error("verification function panic: " + re.(string))
+						log.Error("verification function panic:", re)
 						out = false
 					}
 				}()
@@ -1005,92 +1357,190 @@ func (s *Service) bftForwardLinkLevel0(msg, data []byte) bool {
 			if !g(fl.To, fs.Newest) {
 				fname := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
 				log.Lvlf2("verification function failed: %v %s", fname, ver)
-				return false
+				return fmt.Errorf("verification function failed: %v %s", fname, ver)
 			}
 		}
-		return true
+		return nil
 	}()
-	if ok {
+	if err == nil {
 		s.verifyNewBlockBuffer.Store(sliceToArr(msg), true)
 	}
-	return ok
+	return err
+}
+
+func (s *Service) bftForwardLinkLevel0Ack(msg []byte, data []byte) error {
+	return s.bftAck(&s.verifyNewBlockBuffer, msg)
 }
 
-func (s *Service) bftForwardLinkLevel0Ack(msg []byte, data []byte) bool {
+// bftAck makes sure that the message has been verified in the prepare phase
+// and removes it from the buffer.
+func (s *Service) bftAck(buffer *sync.Map, msg []byte) error {
 	arr := sliceToArr(msg)
-	_, ok := s.verifyNewBlockBuffer.Load(arr)
-	if ok {
-		s.verifyNewBlockBuffer.Delete(arr)
-	} else {
+	_, ok := buffer.Load(arr)
+	if !ok {
 		log.Error(s.ServerIdentity().Address, "ack failed for msg", msg)
+		return errors.New("message has not been verified in the prepare phase")
 	}
-	return ok
+	buffer.Delete(arr)
+	return nil
 }
 
-// forwardLink receives a signature request of a newly accepted block.
-// It only needs the 2nd-newest block and the forward-link.
-func (s *Service) forwardLink(req *network.Envelope) {
+// childLink asks the roster of the parent to sign a link from the parent to
+// the genesis block of the new child skipchain.
+func (s *Service) childLink(parent, child *SkipBlock) (*ForwardLink, error) {
+	if i, _ := parent.Roster.Search(s.ServerIdentity().ID); i < 0 {
+		return nil, errors.New("this node is not in the roster of the parent")
+	}
+	data, err := network.Marshal(child)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't marshal block: %s", err.Error())
+	}
+	cl := NewForwardLink(parent, child)
+	sig, err := s.startBFT(bftChildLink, parent.Roster, cl.Hash(), data)
+	if err != nil {
+		return nil, errors.New("Couldn't get signature on child-link: " + err.Error())
+	}
+	cl.Signature = *sig
+	if err := cl.Verify(cothority.Suite, parent.Roster.Publics()); err != nil {
+		return nil, errors.New("Wrong BFT-signature on child-link: " + err.Error())
+	}
+	return cl, nil
+}
+
+// bftChildLink makes sure that the child-link goes from a block we know to
+// the genesis block of a new skipchain that has this block as parent.
+func (s *Service) bftChildLink(msg, data []byte) error {
 	err := func() error {
-		fsOrig, ok := req.Msg.(*ForwardSignature)
+		_, childInt, err := network.Unmarshal(data, cothority.Suite)
+		if err != nil {
+			return errors.New("couldn't unmarshal child: " + err.Error())
+		}
+		child, ok := childInt.(*SkipBlock)
 		if !ok {
-			return errors.New("didn't get ForwardSignature message")
-		}
-		// We need to create a copy here if the message has been sent to ourselves.
-		fs := *fsOrig
-		if fs.TargetHeight >= len(fs.Newest.BackLinkIDs) {
-			return errors.New("This backlink-height doesn't exist")
-		}
-		from := s.db.GetByID(fs.Newest.BackLinkIDs[fs.TargetHeight])
-		if from == nil {
-			return errors.New("Didn't find target-block")
-		}
-		if !fs.Previous.Equal(from.Hash) {
-			return errors.New("TargetHeight backlink doesn't correspond to previous")
-		}
-		// Add links to prove the newest block is valid.
-		pointer := from
-		for !pointer.Hash.Equal(fs.Newest.Hash) {
-			highest := pointer.ForwardLink[len(pointer.ForwardLink)-1]
-			fs.Links = append(fs.Links, highest)
-			next := s.db.GetByID(highest.To)
-			if next == nil {
-				sbs, err := s.getBlocks(pointer.Roster, highest.To, 1)
-				if err != nil || len(sbs) == 0 {
-					return errors.New("cannot create proof that the blocks are linked: " + err.Error())
-				}
-				next = sbs[0]
-			}
-			pointer = next
+			return fmt.Errorf("got unexpected type %T", childInt)
 		}
-		data, err := network.Marshal(&fs)
-		if err != nil {
-			return err
+		if child.Index != 0 || !child.CalculateHash().Equal(child.Hash) {
+			return errors.New("child is not a valid genesis block")
 		}
-		fl := NewForwardLink(from, fs.Newest)
-		sig, err := s.startBFT(bftFollowBlock, from.Roster, fl.Hash(), data)
-		if err != nil {
-			return errors.New("Couldn't get signature: " + err.Error())
+		parent := s.db.GetByID(child.ParentBlockID)
+		if parent == nil {
+			return errors.New("don't have parent-block")
 		}
-		log.Lvl2("Adding forward-link level", fs.TargetHeight, "to block", from.Index)
-
-		fl.Signature = *sig
-		if !from.Roster.ID.Equal(fs.Newest.Roster.ID) {
-			fl.NewRoster = fs.Newest.Roster
+		for _, id := range parent.ChildSL {
+			if id.Equal(child.Hash) {
+				return errors.New("parent already has this child")
+			}
 		}
-		if err = from.AddForwardLink(fl, fs.TargetHeight); err != nil {
-			return err
+		if bytes.Compare(NewForwardLink(parent, child).Hash(), msg) != 0 {
+			return errors.New("hash to sign doesn't correspond to child-link")
 		}
-		s.startPropagation([]*SkipBlock{from})
 		return nil
 	}()
 	if err != nil {
+		log.Error(s.ServerIdentity(), err)
+		return err
+	}
+
+	s.verifyChildLinkBuffer.Store(sliceToArr(msg), true)
+	return nil
+}
+
+func (s *Service) bftChildLinkAck(msg, data []byte) error {
+	return s.bftAck(&s.verifyChildLinkBuffer, msg)
+}
+
+// forwardLink receives a signature request of a newly accepted block.
+// It only needs the 2nd-newest block and the forward-link.
+func (s *Service) forwardLink(req *network.Envelope) {
+	fs, ok := req.Msg.(*ForwardSignature)
+	if !ok {
+		log.Error(s.ServerIdentity(), "didn't get ForwardSignature message")
+		return
+	}
+	// We need to create a copy here if the message has been sent to ourselves.
+	fsCopy := *fs
+	if err := s.addForwardLink(&fsCopy); err != nil {
 		log.Error(s.ServerIdentity(), "couldn't create forwardLink:", err, "requested by", req.ServerIdentity)
 	}
 }
 
+// addForwardLink asks the roster of the block fs.Previous to sign a
+// forward-link at height fs.TargetHeight to fs.Newest, stores it and
+// propagates the updated block.
+func (s *Service) addForwardLink(fs *ForwardSignature) error {
+	if fs.TargetHeight >= len(fs.Newest.BackLinkIDs) {
+		return errors.New("This backlink-height doesn't exist")
+	}
+	from := s.db.GetByID(fs.Newest.BackLinkIDs[fs.TargetHeight])
+	if from == nil {
+		return errors.New("Didn't find target-block")
+	}
+	if !fs.Previous.Equal(from.Hash) {
+		return errors.New("TargetHeight backlink doesn't correspond to previous")
+	}
+	// Add links to prove the newest block is valid.
+	links, err := s.linksBetween(from, fs.Newest)
+	if err != nil {
+		return err
+	}
+	fs.Links = links
+	data, err := network.Marshal(fs)
+	if err != nil {
+		return err
+	}
+	fl := NewForwardLink(from, fs.Newest)
+	sig, err := s.startBFT(bftFollowBlock, from.Roster, fl.Hash(), data)
+	if err != nil {
+		return errors.New("Couldn't get signature: " + err.Error())
+	}
+	log.Lvl2("Adding forward-link level", fs.TargetHeight, "to block", from.Index)
+
+	fl.Signature = *sig
+	if !from.Roster.ID.Equal(fs.Newest.Roster.ID) {
+		fl.NewRoster = fs.Newest.Roster
+	}
+	if err = from.AddForwardLink(fl, fs.TargetHeight); err != nil {
+		return err
+	}
+	return s.startPropagation([]*SkipBlock{from})
+}
+
+// linksBetween returns the forward-links going from the block 'from' to the
+// block 'to', using the highest existing links that don't jump over 'to'.
+func (s *Service) linksBetween(from, to *SkipBlock) ([]*ForwardLink, error) {
+	var links []*ForwardLink
+	pointer := from
+	for !pointer.Hash.Equal(to.Hash) {
+		var next *SkipBlock
+		for h := len(pointer.ForwardLink) - 1; h >= 0 && next == nil; h-- {
+			fl := pointer.ForwardLink[h]
+			if fl.IsEmpty() {
+				continue
+			}
+			sb := s.db.GetByID(fl.To)
+			if sb == nil {
+				sbs, err := s.getBlocks(pointer.Roster, fl.To, 1)
+				if err != nil || len(sbs) == 0 {
+					continue
+				}
+				sb = sbs[0]
+			}
+			if sb.Index <= to.Index {
+				links = append(links, fl)
+				next = sb
+			}
+		}
+		if next == nil {
+			return nil, errors.New("cannot create proof that the blocks are linked")
+		}
+		pointer = next
+	}
+	return links, nil
+}
+
 // verifyFollowBlock makes sure that a signature-request for a forward-link
 // is valid.
-func (s *Service) bftForwardLink(msg, data []byte) bool {
+func (s *Service) bftForwardLink(msg, data []byte) error {
 	err := func() error {
 		_, fsInt, err := network.Unmarshal(data, cothority.Suite)
 		if err != nil {
@@ -1111,7 +1561,7 @@ func (s *Service) bftForwardLink(msg, data []byte) bool {
 		if src == nil {
 			return errors.New("Don't have src-block")
 		}
-		if src.GetForwardLen() >= fs.TargetHeight+1 {
+		if fl := src.GetForward(fs.TargetHeight); fl != nil && !fl.IsEmpty() {
 			return errors.New("Already have forward-link at height " +
 				strconv.Itoa(fs.TargetHeight+1))
 		}
@@ -1157,73 +1607,41 @@ func (s *Service) bftForwardLink(msg, data []byte) bool {
 	}()
 	if err != nil {
 		log.Error(err)
-		return false
+		return err
 	}
 
 	s.verifyFollowBlockBuffer.Store(sliceToArr(msg), true)
-	return true
+	return nil
 }
 
-func (s *Service) bftForwardLinkAck(msg, data []byte) bool {
-	arr := sliceToArr(msg)
-	_, ok := s.verifyFollowBlockBuffer.Load(arr)
-	if ok {
-		s.verifyFollowBlockBuffer.Delete(arr)
-	} else {
-		log.Error(s.ServerIdentity().Address, "ack failed for msg", msg)
-	}
-	return ok
+func (s *Service) bftForwardLinkAck(msg, data []byte) error {
+	return s.bftAck(&s.verifyFollowBlockBuffer, msg)
 }
 
 // startBFT starts a BFT-protocol with the given parameters. We can only
 // start the bft protocol if we're the root.
 func (s *Service) startBFT(proto string, roster *onet.Roster, msg, data []byte) (*byzcoinx.FinalSignature, error) {
-	if len(roster.List) == 0 {
-		return nil, errors.New("found empty Roster")
-	}
+	return s.startBFTSequence(proto, roster, msg, data, nil, 0)
+}
 
-	// Start the protocol
-	bf := 2
-	if len(roster.List)-1 > 2 {
-		bf = len(roster.List) - 1
-	}
-	tree := roster.GenerateNaryTreeWithRoot(bf, s.ServerIdentity())
-	if tree == nil {
-		return nil, errors.New("couldn't form tree")
-	}
-	node, err := s.CreateProtocol(proto, tree)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't create new node: %s", err.Error())
+// startBFTSequence is like startBFT, but the nodes refuse to sign if they
+// already signed a higher sequence than seq for the skipchain scID.
+func (s *Service) startBFTSequence(proto string, roster *onet.Roster, msg, data []byte,
+	scID SkipBlockID, seq uint64) (*byzcoinx.FinalSignature, error) {
+	signer, ok := s.bftSigners[proto]
+	if !ok {
+		return nil, fmt.Errorf("unknown bft protocol %s", proto)
 	}
-	root := node.(*byzcoinx.ByzCoinX)
-
-	// Register the function generating the protocol instance
-	root.Msg = msg
-	root.Data = data
-	root.CreateProtocol = s.CreateProtocol
-	root.FinalSignatureChan = make(chan byzcoinx.FinalSignature, 1)
-	root.Timeout = s.propTimeout
-	root.Threshold = byzcoinx.Threshold(len(tree.List()))
+	timeout := s.getPropTimeout()
 	if s.bftTimeout != 0 {
-		root.Timeout = s.bftTimeout
+		timeout = s.bftTimeout
 	}
-
-	log.Lvl3(s.ServerIdentity(), "starts bft-cosi")
-	if err := node.Start(); err != nil {
-		log.Error("failed to start with error", err)
-		return nil, err
-	}
-
-	select {
-	case sig := <-root.FinalSignatureChan:
-		if sig.Sig == nil {
-			return nil, errors.New("couldn't sign forward-link")
-		}
-		log.Lvl3(s.ServerIdentity(), "bft-cosi done")
-		return &sig, nil
-	case <-time.After(root.Timeout * 2):
-		return nil, errors.New("timed out while waiting for signature")
+	sig, err := signer.SignSequence(roster, msg, data, timeout, scID, seq)
+	if err != nil {
+		metrics.ProtocolFailures.WithLabelValues(proto).Inc()
+		return nil, fmt.Errorf("couldn't sign forward-link: %v", err)
 	}
+	return sig, nil
 }
 
 // PropagateSkipBlock will save a new SkipBlock
@@ -1233,52 +1651,249 @@ func (s *Service) propagateSkipBlock(msg network.Message) {
 		log.Error("Couldn't convert to slice of SkipBlocks")
 		return
 	}
+	if s.faults.get().DropPropagation {
+		log.Lvlf2("%s: dropping the propagated blocks", s.ServerIdentity())
+		return
+	}
+	// The same blocks may arrive from the leader and from other nodes, so
+	// only the new ones are checked and stored.
+	var blocks []*SkipBlock
 	for _, sb := range sbs.SkipBlocks {
+		if !s.knownBlock(sb) {
+			blocks = append(blocks, sb)
+		}
+	}
+	if len(blocks) == 0 {
+		log.Lvlf3("%s: propagated blocks are already known", s.ServerIdentity())
+		return
+	}
+	for _, sb := range blocks {
 		if !s.blockIsFriendly(sb) {
 			log.Lvlf2("%s: block is not friendly: %x", s.ServerIdentity(), sb.Hash)
 			return
 		}
+		if err := s.verifyBlock(sb); err != nil {
+			log.Errorf("%s: refusing propagated block %x: %s", s.ServerIdentity(), sb.Hash, err)
+			return
+		}
+		if sb.Index == 0 && s.db.GetByID(sb.Hash) == nil {
+			if err := s.verifyGenesis(sb); err != nil {
+				log.Errorf("%s: refusing propagated block %x: %s", s.ServerIdentity(), sb.Hash, err)
+				return
+			}
+		}
 	}
-	_, err := s.db.StoreBlocks(sbs.SkipBlocks)
+	err := s.storeBlocks(blocks)
 	if err != nil {
-		log.Error(err)
+		// We might be missing some blocks, for example when we just
+		// got added to the roster, so try to catch up first.
+		log.Lvl2(s.ServerIdentity(), "couldn't store propagated blocks, catching up:", err)
+		if err = s.catchUp(blocks[0]); err == nil {
+			err = s.storeBlocks(blocks)
+		}
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
+}
+
+// storeBlocks stores the blocks, wakes up the clients waiting for new blocks
+// and calls the registered callbacks with the blocks that were not known
+// before.
+func (s *Service) storeBlocks(blocks []*SkipBlock) error {
+	_, stored, err := s.db.storeBlocks(blocks)
+	if err != nil {
+		return err
+	}
+	s.newBlocks.notify(blocks)
+	for _, sb := range stored {
+		for _, f := range s.getStoreCallbacks(sb) {
+			if err := f(sb.Copy()); err != nil {
+				log.Errorf("%s: callback for block %x failed: %s", s.ServerIdentity(), sb.Hash, err)
+			}
+		}
+	}
+	return nil
+}
+
+// catchUp fetches the blocks that are missing between our latest block of the
+// skipchain of sb and sb itself from the roster of sb. The blocks are
+// fetched in batches and linked to the blocks we already know, so every block
+// is verified using the forward-link of the previous one.
+func (s *Service) catchUp(sb *SkipBlock) error {
+	start := sb.SkipChainID()
+	if latest, err := s.db.GetLatestByID(start); err == nil {
+		start = latest.Hash
 	}
+	return s.SyncChain(sb.Roster, start)
 }
 
 // RegisterVerification stores the verification in a map and will
 // call it whenever a verification needs to be done.
 func (s *Service) registerVerification(v VerifierID, f SkipBlockVerifier) error {
+	if f == nil {
+		return errors.New("cannot register a nil verification function")
+	}
+	s.verifiersMutex.Lock()
+	defer s.verifiersMutex.Unlock()
 	s.verifiers[v] = f
 	return nil
 }
 
+// registerGenesisVerification registers f like registerVerification and
+// marks it to be called on genesis blocks, too.
+func (s *Service) registerGenesisVerification(v VerifierID, f SkipBlockVerifier) error {
+	if err := s.registerVerification(v, f); err != nil {
+		return err
+	}
+	s.verifiersMutex.Lock()
+	defer s.verifiersMutex.Unlock()
+	s.genesisVerifiers[v] = true
+	return nil
+}
+
+// registerStoreBlockCallback adds f to the callbacks called once a block
+// with the verifier v is stored.
+func (s *Service) registerStoreBlockCallback(v VerifierID, f StoreBlockCallback) error {
+	if f == nil {
+		return errors.New("cannot register a nil callback")
+	}
+	s.verifiersMutex.Lock()
+	defer s.verifiersMutex.Unlock()
+	s.storeCallbacks[v] = append(s.storeCallbacks[v], f)
+	return nil
+}
+
+// getStoreCallbacks returns the callbacks for the verifiers of the block.
+func (s *Service) getStoreCallbacks(sb *SkipBlock) []StoreBlockCallback {
+	s.verifiersMutex.Lock()
+	defer s.verifiersMutex.Unlock()
+	var fs []StoreBlockCallback
+	for _, v := range sb.VerifierIDs {
+		fs = append(fs, s.storeCallbacks[v]...)
+	}
+	return fs
+}
+
+// verifyGenesis calls all verification functions of the genesis block that
+// have been registered with RegisterGenesisVerification.
+func (s *Service) verifyGenesis(sb *SkipBlock) error {
+	for _, ver := range sb.VerifierIDs {
+		s.verifiersMutex.Lock()
+		f, ok := s.verifiers[ver], s.genesisVerifiers[ver]
+		s.verifiersMutex.Unlock()
+		if !ok {
+			continue
+		}
+		valid := func() (out bool) {
+			defer func() {
+				if re := recover(); re != nil {
+					log.Error("verification function panic:", re)
+					out = false
+				}
+			}()
+			return f(sb.Hash, sb)
+		}()
+		if !valid {
+			return fmt.Errorf("verification %s refused the genesis block",
+				uuid.UUID(ver).String())
+		}
+	}
+	return nil
+}
+
+// getVerifier returns the verification function registered for v, or nil if
+// there is none.
+func (s *Service) getVerifier(v VerifierID) SkipBlockVerifier {
+	s.verifiersMutex.Lock()
+	defer s.verifiersMutex.Unlock()
+	return s.verifiers[v]
+}
+
 // verifyBlock makes sure the basic parameters of a block are correct and returns
 // an error if something fails.
 func (s *Service) verifyBlock(sb *SkipBlock) error {
+	malformed := func(reason string) error {
+		return &MalformedBlockError{Reason: reason}
+	}
 	if sb.MaximumHeight <= 0 {
-		return errors.New("Set a maximumHeight > 0")
+		return malformed("Set a maximumHeight > 0")
 	}
 	if sb.BaseHeight <= 0 {
-		return errors.New("Set a baseHeight > 0")
+		return malformed("Set a baseHeight > 0")
 	}
 	if sb.Index < 0 {
-		return errors.New("Can't have an index < 0")
+		return malformed("Can't have an index < 0")
 	}
 	if len(sb.BackLinkIDs) <= 0 {
-		return errors.New("Need at least one backlinkID")
+		return malformed("Need at least one backlinkID")
 	}
 	if sb.Height < 1 {
-		return errors.New("Minimum height is 1")
+		return malformed("Minimum height is 1")
 	}
 	if sb.Height > sb.MaximumHeight {
-		return errors.New("Height must be <= maximumHeight")
+		return malformed("Height must be <= maximumHeight")
 	}
 	if sb.Roster == nil {
-		return errors.New("Need a roster")
+		return malformed("Need a roster")
+	}
+	if size := len(sb.Data) + len(sb.Payload); size > s.maxBlockSize {
+		return &BlockSizeError{Size: size, MaxSize: s.maxBlockSize}
+	}
+
+	// The roster must be usable for signing.
+	if len(sb.Roster.List) == 0 {
+		return malformed("Roster is empty")
+	}
+	seen := make(map[network.ServerIdentityID]bool)
+	for _, si := range sb.Roster.List {
+		if si == nil || si.Public == nil {
+			return malformed("Roster has an empty entry")
+		}
+		if seen[si.ID] {
+			return malformed("Roster has a duplicate entry")
+		}
+		seen[si.ID] = true
+	}
+
+	// The genesis block has a random back-link and the maximum height,
+	// all other blocks need one back-link per height.
+	if sb.Index == 0 {
+		if len(sb.BackLinkIDs) != 1 || sb.Height != sb.MaximumHeight {
+			return malformed("Genesis block needs one backlink and maximum height")
+		}
+		return nil
+	}
+	if sb.GenesisID.IsNull() {
+		return malformed("Need a genesis ID")
+	}
+	if sb.Height != blockHeight(sb.Index, sb.BaseHeight, sb.MaximumHeight) {
+		return malformed("Height doesn't correspond to index")
+	}
+	if len(sb.BackLinkIDs) != sb.Height {
+		return malformed("Number of backlinks doesn't correspond to height")
+	}
+	if prev := s.db.GetByID(sb.BackLinkIDs[0]); prev != nil {
+		if prev.Index != sb.Index-1 || !prev.SkipChainID().Equal(sb.SkipChainID()) {
+			return malformed("Backlink doesn't point to previous block")
+		}
 	}
 	return nil
 }
 
+// blockHeight returns the height of the block at the given index.
+func blockHeight(index, base, max int) int {
+	height := 1
+	for ; index%base == 0; height++ {
+		index /= base
+		if height >= max {
+			break
+		}
+	}
+	return height
+}
+
 // notify other services about new/updated skipblock
 func (s *Service) startPropagation(blocks []*SkipBlock) error {
 	log.Lvl3("Starting to propagate for service", s.ServerIdentity())
@@ -1305,7 +1920,11 @@ func (s *Service) startPropagation(blocks []*SkipBlock) error {
 	roster := onet.NewRoster(siList)
 
 	log.Lvlf3("%s: propagating %x to %s", s.ServerIdentity(), blocks[0].Hash, siList)
-	replies, err := s.propagate(roster, &PropagateSkipBlocks{blocks}, s.propTimeout)
+	if d := s.faults.get().PropagationDelay; d > 0 {
+		log.Lvlf2("%s: delaying the propagation by %s", s.ServerIdentity(), d)
+		time.Sleep(d)
+	}
+	replies, err := s.propagate(roster, &PropagateSkipBlocks{blocks}, s.getPropTimeout())
 	if err != nil {
 		return err
 	}
@@ -1315,6 +1934,14 @@ func (s *Service) startPropagation(blocks []*SkipBlock) error {
 	return nil
 }
 
+// hasClients returns true if at least one client has been linked to this
+// conode, in which case new blocks need to be authenticated.
+func (s *Service) hasClients() bool {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	return len(s.Storage.Clients) > 0
+}
+
 // authenticate searches if this node or any follower-node can verify the
 // schnorr-signature.
 func (s *Service) authenticate(msg []byte, sig []byte) bool {
@@ -1398,6 +2025,11 @@ func (s *Service) willNodesAcceptBlock(block *SkipBlock) bool {
 func (s *Service) save() {
 	s.storageMutex.Lock()
 	defer s.storageMutex.Unlock()
+	s.saveLocked()
+}
+
+// saveLocked is like save, but the caller must hold storageMutex.
+func (s *Service) saveLocked() {
 	log.Lvl3("Saving service")
 	err := s.Save(storageKey, s.Storage)
 	if err != nil {
@@ -1438,17 +2070,27 @@ func newSkipchainService(c *onet.Context) (onet.Service, error) {
 		db:               NewSkipBlockDB(db, bucket),
 		Storage:          &Storage{},
 		verifiers:        map[VerifierID]SkipBlockVerifier{},
+		genesisVerifiers: map[VerifierID]bool{},
+		storeCallbacks:   map[VerifierID][]StoreBlockCallback{},
 		propTimeout:      defaultPropagateTimeout,
+		newBlocksTimeout: defaultNewBlocksTimeout,
+		maxBlockSize:     defaultMaxBlockSize,
 	}
 
+	if err := s.db.Upgrade(); err != nil {
+		return nil, err
+	}
+	// The highest sequences of the signing rounds are kept with the blocks,
+	// so that a restarted node doesn't sign stale rounds.
+	protocol.RegisterSequenceStore(c.ServerIdentity().ID, s.db)
 	if err := s.tryLoad(); err != nil {
 		return nil, err
 	}
 	log.ErrFatal(s.RegisterHandlers(s.StoreSkipBlock, s.GetUpdateChain,
-		s.GetSingleBlock, s.GetSingleBlockByIndex, s.GetAllSkipchains,
+		s.GetNewBlocks, s.GetSingleBlock, s.GetBlocksByID, s.GetChainProof, s.GetChildren, s.GetSingleBlockByIndex, s.GetAllSkipchains,
 		s.GetAllSkipChainIDs,
 		s.CreateLinkPrivate, s.Unlink, s.AddFollow, s.ListFollow,
-		s.DelFollow, s.Listlink))
+		s.DelFollow, s.Listlink, s.DeleteChain, s.RepairForwardLinks))
 	s.ServiceProcessor.RegisterStatusReporter("Skipblock", s.db)
 	s.RegisterProcessorFunc(network.RegisterMessage(&ForwardSignature{}), s.forwardLink)
 
@@ -1470,16 +2112,22 @@ func newSkipchainService(c *onet.Context) (onet.Service, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = byzcoinx.InitBFTCoSiProtocol(cothority.Suite, s.Context,
-		s.bftForwardLinkLevel0, s.bftForwardLinkLevel0Ack, bftNewBlock)
-	if err != nil {
-		return nil, err
-	}
-	err = byzcoinx.InitBFTCoSiProtocol(cothority.Suite, s.Context,
-		s.bftForwardLink, s.bftForwardLinkAck, bftFollowBlock)
-	if err != nil {
-		return nil, err
+	s.bftSigners = make(map[string]*byzcoinx.Signer)
+	for _, p := range []struct {
+		name    string
+		vf, ack func(msg, data []byte) error
+	}{
+		{bftNewBlock, s.bftForwardLinkLevel0, s.bftForwardLinkLevel0Ack},
+		{bftFollowBlock, s.bftForwardLink, s.bftForwardLinkAck},
+		{bftChildLink, s.bftChildLink, s.bftChildLinkAck},
+	} {
+		s.bftSigners[p.name], err = byzcoinx.NewSigner(s.Context, cothority.Suite, p.vf, p.ack, p.name)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	s.SetGossipInterval(defaultGossipInterval)
+
 	return s, nil
 }
@@ -180,9 +180,7 @@ func TestService_SetChildrenSkipBlock(t *testing.T) {
 		}
 		// We need to verify the signature on the child-link, too. This
 		// has to be signed by the collective signature of sbRoot.
-		if err := sbRoot.VerifyForwardSignatures(); err != nil {
-			t.Fatal("Signature on child-link is not valid")
-		}
+		require.Nil(t, sb.Update[0].VerifyChildLink(sbInter), "Signature on child-link is not valid")
 	}
 
 	// And check for the intermediate-chain to be updated
@@ -370,6 +368,31 @@ func TestService_ProtocolVerificationPanic(t *testing.T) {
 	require.Contains(t, err.Error(), "couldn't sign forward-link")
 }
 
+func TestService_ProtocolVerificationPanicError(t *testing.T) {
+	// A panic with a value that is not a string must also be recovered.
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	_, el, s := local.MakeSRS(cothority.Suite, 3, skipchainSID)
+	s1 := s.(*Service)
+	verifyFunc := func(newID []byte, newSB *SkipBlock) bool {
+		panic(errors.New("nope"))
+	}
+	verifyID := VerifierID(uuid.NewV1())
+	for _, s := range local.Services {
+		s[skipchainSID].(*Service).registerVerification(verifyID, verifyFunc)
+	}
+	require.Error(t, s1.registerVerification(verifyID, nil))
+
+	sbRoot, err := makeGenesisRosterArgs(s1, el, nil, []VerifierID{verifyID}, 1, 1)
+	require.NoError(t, err)
+	sbNext := sbRoot.Copy()
+	sbNext.BackLinkIDs = []SkipBlockID{sbRoot.Hash}
+	_, err = s1.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: sbRoot.Hash, NewBlock: sbNext})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "couldn't sign forward-link")
+}
+
 func TestService_RegisterVerification(t *testing.T) {
 	// Testing whether we sign correctly the SkipBlocks
 	onet.RegisterNewService("ServiceVerify", newServiceVerify)
@@ -804,6 +827,484 @@ func TestService_DelFollow(t *testing.T) {
 	require.Equal(t, 1, len(service.Storage.Follow))
 }
 
+func TestService_VerifyBlock(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	_, ro, genService := local.MakeSRS(cothority.Suite, 2, skipchainSID)
+	service := genService.(*Service)
+
+	gen, err := makeGenesisRosterArgs(service, ro, nil, VerificationNone, 2, 3)
+	require.Nil(t, err)
+	var sb *SkipBlock
+	for i := 0; i < 2; i++ {
+		reply, err := service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: gen.Hash,
+			NewBlock: gen.Copy()})
+		require.Nil(t, err)
+		sb = reply.Latest
+	}
+	require.Equal(t, 2, sb.Height)
+	require.Nil(t, service.verifyBlock(sb))
+
+	malformed := func(sb *SkipBlock) {
+		err := service.verifyBlock(sb)
+		require.NotNil(t, err)
+		_, ok := err.(*MalformedBlockError)
+		require.True(t, ok)
+	}
+	bad := sb.Copy()
+	bad.Height = 1
+	malformed(bad)
+	bad = sb.Copy()
+	bad.BackLinkIDs = bad.BackLinkIDs[0:1]
+	malformed(bad)
+	bad = sb.Copy()
+	bad.Index = 6
+	malformed(bad)
+	bad = sb.Copy()
+	bad.Roster = onet.NewRoster([]*network.ServerIdentity{ro.List[0], ro.List[0]})
+	malformed(bad)
+
+	service.SetMaxBlockSize(10)
+	big := gen.Copy()
+	big.Data = make([]byte, 11)
+	_, err = service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: gen.Hash, NewBlock: big})
+	require.NotNil(t, err)
+	_, ok := err.(*BlockSizeError)
+	require.True(t, ok)
+}
+
+func TestService_RepairForwardLinks(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, ro, genService := local.MakeSRS(cothority.Suite, 3, skipchainSID)
+	service := genService.(*Service)
+
+	gen, err := makeGenesisRosterArgs(service, ro, nil, VerificationNone, 2, 3)
+	require.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		_, err := service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: gen.Hash,
+			NewBlock: gen.Copy()})
+		require.Nil(t, err)
+	}
+	// Wait for all higher-level forward-links to be stored everywhere.
+	services := local.GetServices(servers, skipchainSID)
+	for _, s := range services {
+		for s.(*Service).db.GetByID(gen.Hash).GetForwardLen() < 3 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	// The repair is an administrative request.
+	_, err = service.RepairForwardLinks(&RepairForwardLinks{SkipchainID: gen.Hash})
+	require.NotNil(t, err)
+	kp := key.NewKeyPair(cothority.Suite)
+	service.RegisterAdminVerifier(func(msg, sig []byte) bool {
+		return schnorr.Verify(cothority.Suite, kp.Public, msg, sig) == nil
+	})
+	repairAt := func(conode kyber.Point, timestamp int64) (*RepairForwardLinksReply, error) {
+		sig, err := schnorr.Sign(cothority.Suite, kp.Private, repairChainMsg(gen.Hash, conode, timestamp))
+		require.Nil(t, err)
+		return service.RepairForwardLinks(&RepairForwardLinks{SkipchainID: gen.Hash,
+			Timestamp: timestamp, Signature: sig})
+	}
+	repair := func() (*RepairForwardLinksReply, error) {
+		return repairAt(service.ServerIdentity().Public, time.Now().Unix())
+	}
+	// Old requests, or requests for another conode, can't be replayed.
+	_, err = repairAt(service.ServerIdentity().Public, time.Now().Add(-time.Hour).Unix())
+	require.NotNil(t, err)
+	_, err = repairAt(servers[1].ServerIdentity.Public, time.Now().Unix())
+	require.NotNil(t, err)
+	reply, err := repair()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(reply.Repaired))
+	require.Equal(t, 0, len(reply.Failed))
+
+	// Remove the forward-link from the genesis block to the block 2, as if
+	// the leader crashed before it got signed.
+	for _, s := range services {
+		db := s.(*Service).db
+		sb := db.GetByID(gen.Hash)
+		sb.ForwardLink[1] = &ForwardLink{}
+		require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+			return db.storeToTx(tx, sb)
+		}))
+		db.cache.invalidate(gen.Hash)
+	}
+
+	reply, err = repair()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(reply.Repaired))
+	require.Equal(t, 0, len(reply.Failed))
+	require.Equal(t, 1, reply.Repaired[0].Height)
+	for _, s := range services {
+		fl := s.(*Service).db.GetByID(gen.Hash).ForwardLink[1]
+		require.False(t, fl.IsEmpty())
+		require.Equal(t, reply.Repaired[0].To, fl.To)
+	}
+}
+
+func TestService_GetChainProof(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, ro, genService := local.MakeSRS(cothority.Suite, 3, skipchainSID)
+	service := genService.(*Service)
+
+	gen, err := makeGenesisRosterArgs(service, ro, nil, VerificationNone, 2, 3)
+	require.Nil(t, err)
+	var latest *SkipBlock
+	for i := 0; i < 5; i++ {
+		reply, err := service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: gen.Hash,
+			NewBlock: gen.Copy()})
+		require.Nil(t, err)
+		latest = reply.Latest
+	}
+	for _, s := range local.GetServices(servers, skipchainSID) {
+		for s.(*Service).db.GetByID(gen.Hash).GetForwardLen() < 3 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	_, err = service.GetChainProof(&GetChainProof{SkipchainID: latest.Hash})
+	require.NotNil(t, err)
+	reply, err := service.GetChainProof(&GetChainProof{SkipchainID: gen.Hash})
+	require.Nil(t, err)
+	proof := reply.Proof
+	require.Nil(t, proof.Verify())
+	// The genesis block links to the block 4, which links to the latest one.
+	require.Equal(t, 3, len(proof.Blocks))
+	require.True(t, proof.Latest().Hash.Equal(latest.Hash))
+
+	cl := NewClient()
+	cp, err := cl.GetChainProof(ro, gen.Hash)
+	require.Nil(t, err)
+	require.True(t, cp.Latest().Hash.Equal(latest.Hash))
+
+	// Every change to the proof must be detected.
+	wrong := *proof
+	wrong.GenesisID = latest.Hash
+	require.NotNil(t, wrong.Verify())
+	wrong = *proof
+	wrong.Links = proof.Links[1:]
+	wrong.Blocks = proof.Blocks[1:]
+	require.NotNil(t, wrong.Verify())
+	wrong = *proof
+	wrong.Blocks = append([]*SkipBlockFix{}, proof.Blocks...)
+	wrong.Blocks[2] = proof.Blocks[2].Copy()
+	wrong.Blocks[2].Data = []byte("fake")
+	require.NotNil(t, wrong.Verify())
+	wrong = *proof
+	wrong.Links = append([]*ForwardLink{}, proof.Links...)
+	wrong.Links[1] = proof.Links[1].Copy()
+	wrong.Links[1].Signature.Sig[0] ^= 0xff
+	require.NotNil(t, wrong.Verify())
+
+	// A client that trusts the block 4 only gets the last link.
+	from := service.db.GetByID(proof.Latest().BackLinkIDs[0])
+	require.NotNil(t, from)
+	update, err := service.db.GetProofFrom(from.Hash)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(update.Blocks))
+	require.Nil(t, update.VerifyFrom(from))
+	require.True(t, update.Latest().Hash.Equal(latest.Hash))
+	require.NotNil(t, update.VerifyFrom(gen))
+	require.NotNil(t, update.Verify())
+}
+
+func TestService_Gossip(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, ro, genService := local.MakeSRS(cothority.Suite, 3, skipchainSID)
+	leader := genService.(*Service)
+
+	sbs := make([]*SkipBlock, 4)
+	var err error
+	sbs[0], err = makeGenesisRosterArgs(leader, ro, nil, VerificationNone, 1, 1)
+	require.Nil(t, err)
+	for i := 1; i < len(sbs); i++ {
+		reply, err := leader.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: sbs[i-1].Hash,
+			NewBlock: sbs[0].Copy()})
+		require.Nil(t, err)
+		sbs[i] = reply.Latest
+	}
+	node := local.GetServices(servers, skipchainSID)[2].(*Service)
+	for node.db.GetByID(sbs[3].Hash) == nil {
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.True(t, node.knownBlock(sbs[3]))
+
+	// Make the node forget the last block, as if it missed the propagation.
+	sb := node.db.GetByID(sbs[2].Hash)
+	sb.ForwardLink = nil
+	require.Nil(t, node.db.Update(func(tx *bolt.Tx) error {
+		if err := node.db.storeToTx(tx, sb); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(node.db.bucketName)).Delete(sbs[3].Hash)
+	}))
+	node.db.cache.invalidate(sbs[2].Hash, sbs[3].Hash)
+	node.db.latestMutex.Lock()
+	node.db.latestBlocks[string(sbs[0].Hash)] = sbs[2].Hash
+	node.db.latestMutex.Unlock()
+	require.False(t, node.knownBlock(sbs[3]))
+	require.False(t, node.knownBlock(leader.db.GetByID(sbs[2].Hash)))
+
+	node.SetGossipInterval(100 * time.Millisecond)
+	defer node.SetGossipInterval(0)
+	for i := 0; node.db.GetByID(sbs[3].Hash) == nil; i++ {
+		require.True(t, i < 50, "node didn't pull the missing block")
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.Equal(t, 1, len(node.db.GetByID(sbs[2].Hash).ForwardLink))
+	latest, err := node.db.GetLatestByID(sbs[0].Hash)
+	require.Nil(t, err)
+	require.True(t, latest.Hash.Equal(sbs[3].Hash))
+
+	// Once stopped, the gossiping can't be started again.
+	node.StopGossip()
+	node.SetGossipInterval(100 * time.Millisecond)
+	node.gossipMutex.Lock()
+	require.Nil(t, node.gossipTimer)
+	node.gossipMutex.Unlock()
+}
+
+func TestService_StopGossipWaits(t *testing.T) {
+	s := &Service{}
+	s.gossipRounds.Add(1)
+	stopped := make(chan bool)
+	go func() {
+		s.StopGossip()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		require.Fail(t, "StopGossip didn't wait for the round")
+	case <-time.After(100 * time.Millisecond):
+	}
+	s.gossipRounds.Done()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		require.Fail(t, "StopGossip didn't return after the round")
+	}
+}
+
+func TestService_ConcurrentProposals(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, ro, genService := local.MakeSRS(cothority.Suite, 3, skipchainSID)
+	service := genService.(*Service)
+
+	parent, err := makeGenesisRoster(service, ro)
+	require.Nil(t, err)
+
+	// Create children of the same parent in parallel and add blocks to them.
+	n := 4
+	blocks := 3
+	children := make([]*SkipBlock, n)
+	latest := make([]*SkipBlock, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			children[i], errs[i] = makeGenesisRosterArgs(service, ro, parent.Hash,
+				VerificationNone, 1, 1)
+			if errs[i] != nil {
+				return
+			}
+			latest[i] = children[i]
+			for j := 0; j < blocks; j++ {
+				reply, err := service.StoreSkipBlock(&StoreSkipBlock{
+					TargetSkipChainID: children[i].Hash,
+					NewBlock:          children[i].Copy(),
+				})
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				latest[i] = reply.Latest
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.Nil(t, err)
+	}
+
+	for _, s := range local.GetServices(servers, skipchainSID) {
+		db := s.(*Service).db
+		for i, child := range children {
+			for j := 0; ; j++ {
+				sb, err := db.GetLatestByID(child.Hash)
+				if err == nil && sb.Hash.Equal(latest[i].Hash) {
+					break
+				}
+				require.True(t, j < 50, "chain didn't get all blocks")
+				time.Sleep(100 * time.Millisecond)
+			}
+			require.Equal(t, blocks, latest[i].Index)
+		}
+		p := db.GetByID(parent.Hash)
+		require.Equal(t, n, len(p.ChildSL))
+		for _, child := range children {
+			require.Nil(t, p.VerifyChildLink(child))
+		}
+	}
+}
+
+func TestService_StoreBlockCallback(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, ro, genService := local.MakeSRS(cothority.Suite, 3, skipchainSID)
+	service := genService.(*Service)
+
+	verifier := VerifierID(uuid.NewV5(uuid.NamespaceURL, "StoreBlockCallback"))
+	services := local.GetServices(servers, skipchainSID)
+	var mutex sync.Mutex
+	seen := make([][]SkipBlockID, len(services))
+	for i, s := range services {
+		i := i
+		require.Nil(t, s.(*Service).registerVerification(verifier,
+			func(newID []byte, newSB *SkipBlock) bool {
+				return true
+			}))
+		require.Nil(t, RegisterStoreBlockCallback(servers[i],
+			verifier, func(sb *SkipBlock) error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				seen[i] = append(seen[i], sb.Hash)
+				return nil
+			}))
+	}
+	require.NotNil(t, service.registerStoreBlockCallback(verifier, nil))
+
+	// Blocks of other skipchains are not passed to the callback.
+	_, err := makeGenesisRoster(service, ro)
+	require.Nil(t, err)
+
+	gen, err := makeGenesisRosterArgs(service, ro, nil,
+		[]VerifierID{VerifyBase, verifier}, 1, 1)
+	require.Nil(t, err)
+	ids := []SkipBlockID{gen.Hash}
+	for i := 0; i < 2; i++ {
+		reply, err := service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: gen.Hash,
+			NewBlock: gen.Copy()})
+		require.Nil(t, err)
+		ids = append(ids, reply.Latest.Hash)
+	}
+
+	// As the callbacks are synchronous, every node must have seen every block
+	// exactly once and in order when StoreSkipBlock returns.
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i := range services {
+		require.Equal(t, ids, seen[i])
+	}
+}
+
+func TestService_GenesisVerification(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, ro, genService := local.MakeSRS(cothority.Suite, 2, skipchainSID)
+	service := genService.(*Service)
+
+	genesisVerifier := VerifierID(uuid.NewV5(uuid.NamespaceURL, "GenesisVerifier"))
+	for _, s := range local.GetServices(servers, skipchainSID) {
+		require.Nil(t, s.(*Service).registerGenesisVerification(genesisVerifier,
+			func(newID []byte, newSB *SkipBlock) bool {
+				return !bytes.Equal(newSB.Data, []byte("bad"))
+			}))
+	}
+	// A verifier that isn't registered for genesis blocks is not called.
+	require.Nil(t, service.registerVerification(ServiceVerifier,
+		func(newID []byte, newSB *SkipBlock) bool {
+			return false
+		}))
+
+	genesis := func(data string, ver ...VerifierID) error {
+		sb := NewSkipBlock()
+		sb.Roster = ro
+		sb.MaximumHeight = 1
+		sb.BaseHeight = 1
+		sb.VerifierIDs = ver
+		sb.Data = []byte(data)
+		_, err := service.StoreSkipBlock(&StoreSkipBlock{NewBlock: sb})
+		return err
+	}
+	require.Nil(t, genesis("bad"))
+	require.Nil(t, genesis("bad", ServiceVerifier))
+	require.NotNil(t, genesis("bad", genesisVerifier))
+	require.Nil(t, genesis("good", genesisVerifier))
+}
+
+func TestService_DeleteChain(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	_, ro, genService := local.MakeSRS(cothority.Suite, 1, skipchainSID)
+	service := genService.(*Service)
+
+	public := service.ServerIdentity().Public
+	delAt := func(sb *SkipBlock, priv kyber.Scalar, archive bool, timestamp int64) error {
+		sig, err := schnorr.Sign(cothority.Suite, priv,
+			deleteChainMsg(sb.Hash, archive, public, timestamp))
+		log.ErrFatal(err)
+		_, err = service.DeleteChain(&DeleteChain{SkipchainID: sb.Hash,
+			Archive: archive, Timestamp: timestamp, Signature: sig})
+		return err
+	}
+	del := func(sb *SkipBlock, priv kyber.Scalar, archive bool) error {
+		return delAt(sb, priv, archive, time.Now().Unix())
+	}
+
+	sb1, err := makeGenesisRoster(service, ro)
+	require.Nil(t, err)
+	sb2, err := makeGenesisRoster(service, ro)
+	require.Nil(t, err)
+
+	// Without a linked client nobody can delete skipchains.
+	priv := key.NewKeyPair(cothority.Suite).Private
+	require.NotNil(t, del(sb1, priv, false))
+	priv = setupFollow(service)
+	require.NotNil(t, del(sb1, key.NewKeyPair(cothority.Suite).Private, false))
+	// The signature must match the action.
+	now := time.Now().Unix()
+	sig, err := schnorr.Sign(cothority.Suite, priv, deleteChainMsg(sb1.Hash, true, public, now))
+	log.ErrFatal(err)
+	_, err = service.DeleteChain(&DeleteChain{SkipchainID: sb1.Hash, Timestamp: now, Signature: sig})
+	require.NotNil(t, err)
+	// Old requests can't be replayed, and the signature covers the conode.
+	require.NotNil(t, delAt(sb1, priv, false, time.Now().Add(-time.Hour).Unix()))
+	sig, err = schnorr.Sign(cothority.Suite, priv,
+		deleteChainMsg(sb1.Hash, false, key.NewKeyPair(cothority.Suite).Public, now))
+	log.ErrFatal(err)
+	_, err = service.DeleteChain(&DeleteChain{SkipchainID: sb1.Hash, Timestamp: now, Signature: sig})
+	require.NotNil(t, err)
+
+	require.Nil(t, del(sb1, priv, false))
+	require.Nil(t, service.db.GetByID(sb1.Hash))
+	require.Nil(t, service.db.GetArchived(sb1.Hash))
+	require.True(t, service.db.IsRemoved(sb1.Hash))
+	require.NotNil(t, del(sb1, priv, false))
+
+	require.Nil(t, del(sb2, priv, true))
+	require.Nil(t, service.db.GetByID(sb2.Hash))
+	require.NotNil(t, service.db.GetArchived(sb2.Hash))
+
+	// Removed skipchains cannot be stored again.
+	_, err = service.db.StoreBlocks([]*SkipBlock{sb2})
+	require.NotNil(t, err)
+}
+
 func TestService_ListFollow(t *testing.T) {
 	local := onet.NewLocalTest(cothority.Suite)
 	defer waitPropagationFinished(t, local)
@@ -1170,3 +1671,70 @@ func TestRosterAddCausesSync(t *testing.T) {
 		log.Lvl1("Got block with servers[4]")
 	}
 }
+
+func TestService_PropagationCatchUp(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, _, genService := local.MakeSRS(cothority.Suite, 4, skipchainSID)
+	leader := genService.(*Service)
+
+	sbs := make([]*SkipBlock, 4)
+	var err error
+	sbs[0], err = makeGenesisRosterArgs(leader, local.GenRosterFromHost(servers[0:3]...),
+		nil, VerificationNone, 1, 1)
+	require.Nil(t, err)
+	for i := 1; i < len(sbs); i++ {
+		sb := NewSkipBlock()
+		sb.Roster = sbs[i-1].Roster
+		if i == len(sbs)-1 {
+			// Only the last block includes the new node, which doesn't know
+			// any of the previous blocks.
+			sb.Roster = local.GenRosterFromHost(servers...)
+		}
+		reply, err := leader.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: sbs[i-1].Hash, NewBlock: sb})
+		require.Nil(t, err)
+		sbs[i] = reply.Latest
+	}
+
+	newNode := local.GetServices(servers, skipchainSID)[3].(*Service)
+	for _, sb := range sbs {
+		for i := 0; newNode.db.GetByID(sb.Hash) == nil; i++ {
+			require.True(t, i < 20, "new node didn't catch up")
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+func TestService_Faults(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, ro, genService := local.MakeSRS(cothority.Suite, 3, skipchainSID)
+	service := genService.(*Service)
+	services := local.GetServices(servers, skipchainSID)
+
+	gen, err := makeGenesisRosterArgs(service, ro, nil, VerificationNone, 2, 3)
+	require.Nil(t, err)
+
+	// The third node doesn't get the new block.
+	services[2].(*Service).SetFaults(Faults{DropPropagation: true})
+	reply, err := service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: gen.Hash,
+		NewBlock: gen.Copy()})
+	require.Nil(t, err)
+	require.NotNil(t, services[1].(*Service).db.GetByID(reply.Latest.Hash))
+	require.Nil(t, services[2].(*Service).db.GetByID(reply.Latest.Hash))
+
+	// Without the signatures of the other nodes, no block can be added.
+	services[1].(*Service).SetFaults(Faults{RefuseSignatures: true})
+	services[2].(*Service).SetFaults(Faults{RefuseSignatures: true})
+	_, err = service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: gen.Hash,
+		NewBlock: gen.Copy()})
+	require.NotNil(t, err)
+
+	services[1].(*Service).SetFaults(Faults{})
+	services[2].(*Service).SetFaults(Faults{})
+	_, err = service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: gen.Hash,
+		NewBlock: gen.Copy()})
+	require.Nil(t, err)
+}
@@ -14,6 +14,8 @@ import (
 	bolt "github.com/coreos/bbolt"
 	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/byzcoinx"
+	"github.com/dedis/cothority/metrics"
+	"github.com/dedis/cothority/migration"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/sign/cosi"
 	"github.com/dedis/onet"
@@ -26,6 +28,46 @@ import (
 // set to a constant because we'd like to change it in the test.
 var defaultPropagateTimeout = 15 * time.Second
 
+// How long a GetNewBlocks request waits for a new block before returning an
+// empty reply. Like defaultPropagateTimeout, it is changed in the tests.
+var defaultNewBlocksTimeout = 20 * time.Second
+
+// How often a node asks a random peer for the blocks it might have missed.
+// Like defaultPropagateTimeout, it is changed in the tests.
+var defaultGossipInterval = time.Minute
+
+// maxNewBlocks is the maximum number of blocks returned by GetNewBlocks.
+const maxNewBlocks = 50
+
+// maxBlocksByID is the maximum number of blocks that can be requested with a
+// single GetBlocksByID.
+const maxBlocksByID = 100
+
+// defaultMaxBlockSize is the maximum size of the Data and the Payload of a
+// skipblock together. It can be changed with Service.SetMaxBlockSize.
+const defaultMaxBlockSize = 4 * 1024 * 1024
+
+// MalformedBlockError is returned if a skipblock fails the structural checks
+// done before it is stored or propagated.
+type MalformedBlockError struct {
+	Reason string
+}
+
+func (e *MalformedBlockError) Error() string {
+	return e.Reason
+}
+
+// BlockSizeError is returned if the Data and the Payload of a skipblock are
+// bigger than the maximum size accepted by the conode.
+type BlockSizeError struct {
+	Size    int
+	MaxSize int
+}
+
+func (e *BlockSizeError) Error() string {
+	return fmt.Sprintf("size of block is %d bytes, maximum is %d", e.Size, e.MaxSize)
+}
+
 // SkipBlockID represents the Hash of the SkipBlock
 type SkipBlockID []byte
 
@@ -47,6 +89,16 @@ func (sbid SkipBlockID) Equal(sb SkipBlockID) bool {
 	return bytes.Equal([]byte(sbid), []byte(sb))
 }
 
+// containsID returns true if id is one of ids.
+func containsID(ids []SkipBlockID, id SkipBlockID) bool {
+	for _, i := range ids {
+		if i.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
+
 // VerifierID represents one of the verifications used to accept or
 // deny a SkipBlock.
 type VerifierID uuid.UUID
@@ -200,6 +252,37 @@ func RegisterVerification(s GetService, v VerifierID, f SkipBlockVerifier) error
 	return scs.(*Service).registerVerification(v, f)
 }
 
+// StoreBlockCallback is called by the skipchain service with a block it
+// stored and didn't know before.
+type StoreBlockCallback func(sb *SkipBlock) error
+
+// RegisterStoreBlockCallback makes the service call f every time it stores a
+// new block of a skipchain that has v in its VerifierIDs. This lets other
+// services of the same conode follow their skipchains without polling. The
+// callbacks are called synchronously in the order the blocks are stored, and
+// for propagated blocks before the propagation is acknowledged. As the block
+// is already stored, an error returned by f is only logged.
+func RegisterStoreBlockCallback(s GetService, v VerifierID, f StoreBlockCallback) error {
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	return scs.(*Service).registerStoreBlockCallback(v, f)
+}
+
+// RegisterGenesisVerification is like RegisterVerification, but f is also
+// called on the genesis block of every skipchain that has v in its
+// VerifierIDs. This makes sure that an application chain cannot start from
+// a genesis block that the application would refuse. Verifiers registered with
+// RegisterVerification are not called on genesis blocks.
+func RegisterGenesisVerification(s GetService, v VerifierID, f SkipBlockVerifier) error {
+	scs := s.Service(ServiceName)
+	if scs == nil {
+		return errors.New("Didn't find our service: " + ServiceName)
+	}
+	return scs.(*Service).registerGenesisVerification(v, f)
+}
+
 var (
 	// VerifyBase checks that the base-parameters are correct, i.e.,
 	// the links are correctly set up, the height-parameters and the
@@ -350,6 +433,12 @@ type SkipBlock struct {
 	// using the skipblocks can return simply the SkipBlockFix, as long as they
 	// don't need the payload.
 	Payload []byte `protobuf:"opt"`
+
+	// ChildLinks holds a link for every entry in ChildSL, going from this
+	// block to the genesis block of the child skipchain. The links are
+	// signed by the roster of this block, so that the list of children can
+	// be verified.
+	ChildLinks []*ForwardLink
 }
 
 // NewSkipBlock pre-initialises the block so it can be sent over
@@ -378,6 +467,38 @@ func (sb *SkipBlock) VerifyForwardSignatures() error {
 	return nil
 }
 
+// VerifyChildLink returns nil if the child is the genesis block of a child
+// skipchain of this block, and the link to the child is signed by the roster
+// of this block.
+func (sb *SkipBlock) VerifyChildLink(child *SkipBlock) error {
+	if child.Index != 0 || !child.ParentBlockID.Equal(sb.Hash) {
+		return errors.New("child doesn't point to this block as parent")
+	}
+	if !child.CalculateHash().Equal(child.Hash) {
+		return errors.New("hash of child doesn't match its content")
+	}
+	for _, cl := range sb.ChildLinks {
+		if !cl.To.Equal(child.Hash) {
+			continue
+		}
+		if err := cl.Verify(cothority.Suite, sb.Roster.Publics()); err != nil {
+			return errors.New("wrong signature in child-link: " + err.Error())
+		}
+		return cl.VerifyRoster(sb, child)
+	}
+	return errors.New("no child-link to this child")
+}
+
+// hasChildLink returns true if the block has a child-link to the block id.
+func (sb *SkipBlock) hasChildLink(id SkipBlockID) bool {
+	for _, cl := range sb.ChildLinks {
+		if cl.To.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
+
 // Equal returns bool if both hashes are equal
 func (sb *SkipBlock) Equal(other *SkipBlock) bool {
 	return bytes.Equal(sb.Hash, other.Hash)
@@ -402,6 +523,12 @@ func (sb *SkipBlock) Copy() *SkipBlock {
 		b.ChildSL[i] = make(SkipBlockID, len(child))
 		copy(b.ChildSL[i], child)
 	}
+	if len(sb.ChildLinks) > 0 {
+		b.ChildLinks = make([]*ForwardLink, len(sb.ChildLinks))
+		for i, cl := range sb.ChildLinks {
+			b.ChildLinks[i] = cl.Copy()
+		}
+	}
 	copy(b.Hash, sb.Hash)
 	copy(b.Payload, sb.Payload)
 	b.VerifierIDs = make([]VerifierID, len(sb.VerifierIDs))
@@ -446,9 +573,10 @@ func (sb *SkipBlock) AddForward(fw *ForwardLink) {
 }
 
 // AddForwardLink stores the forward-link at the indicated position. If the
-// forwardlink at pos already exists, it returns an error.
+// forwardlink at pos already exists, it returns an error. An empty
+// placeholder at pos is replaced.
 func (sb *SkipBlock) AddForwardLink(fw *ForwardLink, pos int) error {
-	if len(sb.ForwardLink) > pos || pos < 0 {
+	if pos < 0 || (len(sb.ForwardLink) > pos && !sb.ForwardLink[pos].IsEmpty()) {
 		return errors.New("this forward-link already exists or invalid position")
 	}
 	for len(sb.ForwardLink) <= pos {
@@ -573,6 +701,40 @@ func (fl *ForwardLink) Verify(suite cosi.Suite, pubs []kyber.Point) error {
 		cosi.NewThresholdPolicy(byzcoinx.Threshold(len(pubs))))
 }
 
+// VerifyRoster checks that the forward-link correctly hands over the
+// roster from the block 'from' to the block 'to'. If NewRoster is nil, both
+// blocks must have the same roster. Else NewRoster must hold the same public
+// keys as the roster of 'to', which is bound by the hash of 'to'. Together
+// with Verify this makes sure that the new roster is signed off by the
+// previous one.
+func (fl *ForwardLink) VerifyRoster(from, to *SkipBlock) error {
+	if !fl.From.Equal(from.Hash) || !fl.To.Equal(to.Hash) {
+		return errors.New("forward-link doesn't link the given blocks")
+	}
+	if from.Roster == nil || to.Roster == nil {
+		return errors.New("missing roster in block")
+	}
+	if fl.NewRoster == nil {
+		if !from.Roster.ID.Equal(to.Roster.ID) {
+			return errors.New("roster changed without being in the forward-link")
+		}
+		return nil
+	}
+	if !fl.NewRoster.ID.Equal(to.Roster.ID) {
+		return errors.New("new roster of forward-link doesn't match roster of block")
+	}
+	pubs, toPubs := fl.NewRoster.Publics(), to.Roster.Publics()
+	if len(pubs) != len(toPubs) {
+		return errors.New("new roster of forward-link has wrong number of nodes")
+	}
+	for i, p := range pubs {
+		if !p.Equal(toPubs[i]) {
+			return errors.New("new roster of forward-link has wrong public keys")
+		}
+	}
+	return nil
+}
+
 // IsEmpty indicates whether this forwardlink is merely a placeholder for
 // higher-order forwardlinks to be in the correct place.
 func (fl *ForwardLink) IsEmpty() bool {
@@ -588,6 +750,8 @@ type SkipBlockDB struct {
 	// latestBlocks is used as a simple caching mechanism
 	latestBlocks map[string]SkipBlockID
 	latestMutex  sync.Mutex
+	// cache keeps the most recently used blocks in memory
+	cache *blockCache
 }
 
 // NewSkipBlockDB returns an initialized SkipBlockDB structure.
@@ -596,9 +760,47 @@ func NewSkipBlockDB(db *bolt.DB, bn []byte) *SkipBlockDB {
 		DB:           db,
 		bucketName:   bn,
 		latestBlocks: map[string]SkipBlockID{},
+		cache:        newBlockCache(defaultBlockCacheSize),
 	}
 }
 
+// storeSchema lists the migrations of the bucket holding the blocks.
+var storeSchema = migration.Schema{
+	{Description: "index all blocks", Run: migrateIndex},
+}
+
+// Upgrade migrates the buckets of the database to the current layout. It
+// must be called before the database is used.
+func (db *SkipBlockDB) Upgrade() error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(db.bucketName); err != nil {
+			return err
+		}
+		_, err := storeSchema.Upgrade(tx, db.bucketName)
+		return err
+	})
+}
+
+// migrateIndex adds the blocks stored before the index has been introduced
+// to the index bucket.
+func migrateIndex(tx *bolt.Tx, name []byte) error {
+	idx, err := tx.CreateBucketIfNotExists(append(append([]byte{}, name...), []byte("-index")...))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(name).ForEach(func(k, v []byte) error {
+		_, sbMsg, err := network.Unmarshal(v, cothority.Suite)
+		if err != nil {
+			return err
+		}
+		sb, ok := sbMsg.(*SkipBlock)
+		if !ok {
+			return fmt.Errorf("block %x has the wrong type", k)
+		}
+		return idx.Put(indexKey(sb.SkipChainID(), sb.Index), sb.Hash)
+	})
+}
+
 // GetStatus is a function that returns the status report of the db.
 func (db *SkipBlockDB) GetStatus() *onet.Status {
 	out := make(map[string]string)
@@ -609,6 +811,20 @@ func (db *SkipBlockDB) GetStatus() *onet.Status {
 
 		total := s.BranchInuse + s.LeafInuse
 		out["Bytes"] = strconv.Itoa(total)
+
+		// Every skipchain has its genesis block at index 0. Blocks
+		// stored by an older version are only counted once they have
+		// been indexed.
+		chains := 0
+		if idx := tx.Bucket(db.indexBucketName()); idx != nil {
+			idx.ForEach(func(k, v []byte) error {
+				if len(k) > 4 && binary.BigEndian.Uint32(k[len(k)-4:]) == 0 {
+					chains++
+				}
+				return nil
+			})
+		}
+		out["Chains"] = strconv.Itoa(chains)
 		return nil
 	})
 	return &onet.Status{Field: out}
@@ -616,6 +832,10 @@ func (db *SkipBlockDB) GetStatus() *onet.Status {
 
 // GetByID returns a new copy of the skip-block or nil if it doesn't exist
 func (db *SkipBlockDB) GetByID(sbID SkipBlockID) *SkipBlock {
+	if sb := db.cache.get(sbID); sb != nil {
+		return sb
+	}
+	gen := db.cache.gen()
 	var result *SkipBlock
 	err := db.View(func(tx *bolt.Tx) error {
 		sb, err := db.getFromTx(tx, sbID)
@@ -629,21 +849,85 @@ func (db *SkipBlockDB) GetByID(sbID SkipBlockID) *SkipBlock {
 	if err != nil {
 		log.Error(err)
 	}
+	if result != nil {
+		db.cache.add(result, gen)
+	}
 	return result
 }
 
+// GetBlocks returns the blocks with the given IDs in the same order. Blocks
+// that are not found are returned as nil. All blocks that are not in the
+// cache are read in a single transaction.
+func (db *SkipBlockDB) GetBlocks(ids []SkipBlockID) ([]*SkipBlock, error) {
+	result := make([]*SkipBlock, len(ids))
+	var missing []int
+	for i, id := range ids {
+		if result[i] = db.cache.get(id); result[i] == nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+	gen := db.cache.gen()
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, i := range missing {
+			sb, err := db.getFromTx(tx, ids[i])
+			if err != nil {
+				return err
+			}
+			result[i] = sb
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range missing {
+		if result[i] != nil {
+			db.cache.add(result[i], gen)
+		}
+	}
+	return result, nil
+}
+
 // StoreBlocks stores the set of blocks in the boltdb in a transaction,
 // so that the db is consistent at every moment.
 func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
+	result, _, err := db.storeBlocks(blocks)
+	return result, err
+}
+
+// storeBlocks is like StoreBlocks, but also returns the blocks that were not
+// in the db before.
+func (db *SkipBlockDB) storeBlocks(blocks []*SkipBlock) ([]SkipBlockID, []*SkipBlock, error) {
 	var result []SkipBlockID
+	defer func() {
+		ids := make([]SkipBlockID, len(blocks))
+		for i, sb := range blocks {
+			ids[i] = sb.Hash
+		}
+		db.cache.invalidate(ids...)
+	}()
+	// The latest blocks are only updated once the transaction is committed.
+	var stored []*SkipBlock
 	err := db.Update(func(tx *bolt.Tx) error {
+		// Only use tx to read blocks here: opening a read-only transaction
+		// while holding the read-write transaction can deadlock bolt.
 		fl := blocks[len(blocks)-1].ForwardLink
 		if len(fl) > 0 {
-			if db.GetByID(fl[len(fl)-1].To) == nil {
+			last, err := db.getFromTx(tx, fl[len(fl)-1].To)
+			if err != nil {
+				return err
+			}
+			if last == nil {
 				return errors.New("can't have last block pointing into empty space")
 			}
 		}
 		for i, sb := range blocks {
+			if db.isRemovedTx(tx, sb.SkipChainID()) {
+				return fmt.Errorf("skipchain %x has been removed", sb.SkipChainID())
+			}
 			sbOld, err := db.getFromTx(tx, sb.Hash)
 			if err != nil {
 				return errors.New("failed to get skipblock with error: " + err.Error())
@@ -651,30 +935,47 @@ func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
 			if sbOld != nil {
 				// If this skipblock already exists, only copy forward-links and
 				// new children.
-				if len(sb.ForwardLink) > len(sbOld.ForwardLink) {
-					for i, fl := range sb.ForwardLink {
-						if i < len(sbOld.ForwardLink) || fl.IsEmpty() {
-							// Don't overwrite existing forwardlinks and ignore empty links
-							continue
-						}
-						if err := fl.Verify(cothority.Suite, sbOld.Roster.Publics()); err != nil {
-							return errors.New("Got a known block with wrong signature in forward-link with error: " + err.Error())
-						}
-						if err := sbOld.AddForwardLink(fl, i); err != nil {
-							log.Error(err)
-							return nil
-						}
+				for i, fl := range sb.ForwardLink {
+					if fl.IsEmpty() || (i < len(sbOld.ForwardLink) &&
+						!sbOld.ForwardLink[i].IsEmpty()) {
+						// Don't overwrite existing forwardlinks and ignore empty links,
+						// but fill in placeholders.
+						continue
+					}
+					if err := fl.Verify(cothority.Suite, sbOld.Roster.Publics()); err != nil {
+						return errors.New("Got a known block with wrong signature in forward-link with error: " + err.Error())
+					}
+					if err := sbOld.AddForwardLink(fl, i); err != nil {
+						log.Error(err)
+						return nil
+					}
+				}
+				// Children can be added in parallel by different leaders, so
+				// the lists are merged instead of being replaced by the
+				// longer one.
+				for _, child := range sb.ChildSL {
+					if !containsID(sbOld.ChildSL, child) {
+						sbOld.ChildSL = append(sbOld.ChildSL, child)
 					}
 				}
-				if len(sb.ChildSL) > len(sbOld.ChildSL) {
-					sbOld.ChildSL = append(sbOld.ChildSL, sb.ChildSL[len(sbOld.ChildSL):]...)
+				for _, cl := range sb.ChildLinks {
+					if cl == nil || sbOld.hasChildLink(cl.To) {
+						continue
+					}
+					if !cl.From.Equal(sbOld.Hash) {
+						return errors.New("child-link doesn't start at its block")
+					}
+					if err := cl.Verify(cothority.Suite, sbOld.Roster.Publics()); err != nil {
+						return errors.New("Got a known block with wrong signature in child-link with error: " + err.Error())
+					}
+					sbOld.ChildLinks = append(sbOld.ChildLinks, cl)
 				}
 				err := db.storeToTx(tx, sbOld)
 				if err != nil {
 					return err
 				}
 			} else {
-				if !db.HasForwardLink(sb) {
+				if !db.hasForwardLinkTx(tx, sb) {
 					found := false
 					for j := 0; j < i; j++ {
 						for _, fl := range blocks[j].ForwardLink {
@@ -691,14 +992,20 @@ func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
 				if err != nil {
 					return err
 				}
-				db.latestUpdate(sb)
+				stored = append(stored, sb)
 			}
 			result = append(result, sb.Hash)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, sb := range stored {
+		db.latestUpdate(sb)
+	}
 
-	return result, err
+	return result, stored, nil
 }
 
 // Store stores the given SkipBlock in the service-list
@@ -716,6 +1023,18 @@ func (db *SkipBlockDB) Store(sb *SkipBlock) SkipBlockID {
 // HasForwardLink verififes if sb can be accepted in the database by searching
 // for a forwardlink of any level.
 func (db *SkipBlockDB) HasForwardLink(sb *SkipBlock) bool {
+	var found bool
+	err := db.View(func(tx *bolt.Tx) error {
+		found = db.hasForwardLinkTx(tx, sb)
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	return found
+}
+
+func (db *SkipBlockDB) hasForwardLinkTx(tx *bolt.Tx, sb *SkipBlock) bool {
 	if sb.Index == 0 {
 		// Genesis blocks never have a reference to them.
 		return true
@@ -723,7 +1042,11 @@ func (db *SkipBlockDB) HasForwardLink(sb *SkipBlock) bool {
 
 	// Any non-genesis blocks need to be referenced by a previous block.
 	for i, bl := range sb.BackLinkIDs {
-		prev := db.GetByID(bl)
+		prev, err := db.getFromTx(tx, bl)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
 		if prev != nil {
 			if len(prev.ForwardLink) > i {
 				if prev.ForwardLink[i].To.Equal(sb.Hash) {
@@ -747,8 +1070,23 @@ func (db *SkipBlockDB) latestUpdate(sb *SkipBlock) {
 		if old == nil || old.Index < sb.Index {
 			log.Lvlf3("updating sc %x: storing index %d", idStr, sb.Index)
 			db.latestBlocks[idStr] = sb.Hash
+		} else {
+			return
 		}
 	}
+	metrics.BlockHeight.WithLabelValues(metrics.Chain(sb.SkipChainID())).Set(float64(sb.Index))
+}
+
+// latestIDs returns the IDs of the latest blocks of all skipchains that have
+// been stored or looked up since the database has been opened.
+func (db *SkipBlockDB) latestIDs() []SkipBlockID {
+	db.latestMutex.Lock()
+	defer db.latestMutex.Unlock()
+	ids := make([]SkipBlockID, 0, len(db.latestBlocks))
+	for _, id := range db.latestBlocks {
+		ids = append(ids, id)
+	}
+	return ids
 }
 
 // Length returns the actual length using mutexes
@@ -885,6 +1223,71 @@ func (db *SkipBlockDB) GetLatest(sb *SkipBlock) (*SkipBlock, error) {
 	return latest, nil
 }
 
+// GetByIndex returns the block with the given index in the skipchain
+// identified by its genesis block. Blocks stored before the index has been
+// introduced are not in the index, so the skipchain is followed from the
+// genesis block in that case and the index is updated on the way.
+func (db *SkipBlockDB) GetByIndex(genesis SkipBlockID, index int) (*SkipBlock, error) {
+	if index < 0 {
+		return nil, errors.New("negative index")
+	}
+	var result *SkipBlock
+	err := db.View(func(tx *bolt.Tx) error {
+		idx := tx.Bucket(db.indexBucketName())
+		if idx == nil {
+			return nil
+		}
+		id := idx.Get(indexKey(genesis, index))
+		if id == nil {
+			return nil
+		}
+		sb, err := db.getFromTx(tx, id)
+		result = sb
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result != nil {
+		return result, nil
+	}
+
+	sb := db.GetByID(genesis)
+	if sb == nil {
+		return nil, errors.New("no such genesis-block")
+	}
+	for sb.Index < index {
+		var next *SkipBlock
+		// Take the highest forward link that doesn't go past the
+		// requested index.
+		for i := len(sb.ForwardLink) - 1; i >= 0; i-- {
+			fl := sb.ForwardLink[i]
+			if fl.IsEmpty() {
+				continue
+			}
+			next = db.GetByID(fl.To)
+			if next != nil && next.Index <= index {
+				break
+			}
+			next = nil
+		}
+		if next == nil {
+			break
+		}
+		sb = next
+	}
+	if sb.Index != index {
+		return nil, errors.New("no block with this index found")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return db.storeToTx(tx, sb)
+	})
+	if err != nil {
+		log.Error("couldn't update the index:", err)
+	}
+	return sb, nil
+}
+
 // GetFuzzy searches for a block that resembles the given ID.
 // If there are multiple matching skipblocks, the first one is chosen. If none
 // match, nil will be returned.
@@ -930,6 +1333,122 @@ func (db *SkipBlockDB) GetFuzzy(id string) (*SkipBlock, error) {
 	return sb, nil
 }
 
+// RemoveChain removes all blocks of the skipchain with the given genesis ID
+// from the database and stores a tombstone, so that the skipchain cannot be
+// stored again. If archive is true, the blocks are moved to the archive
+// bucket, where they can still be found with GetArchived. It returns the
+// number of removed blocks.
+func (db *SkipBlockDB) RemoveChain(scID SkipBlockID, archive bool) (int, error) {
+	var removed int
+	var removedIDs []SkipBlockID
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(db.bucketName)
+		idx := tx.Bucket(db.indexBucketName())
+		if idx == nil {
+			return errors.New("unknown skipchain")
+		}
+		// The index holds all the blocks of the skipchain, sorted by
+		// their index.
+		var idxKeys, keys, vals [][]byte
+		c := idx.Cursor()
+		for k, v := c.Seek(scID); k != nil && len(k) == len(scID)+4 &&
+			bytes.HasPrefix(k, scID); k, v = c.Next() {
+			idxKeys = append(idxKeys, append([]byte{}, k...))
+			if val := b.Get(v); val != nil {
+				keys = append(keys, append([]byte{}, v...))
+				vals = append(vals, append([]byte{}, val...))
+			}
+		}
+		if len(keys) == 0 {
+			return errors.New("unknown skipchain")
+		}
+		var arch *bolt.Bucket
+		var err error
+		if archive {
+			arch, err = tx.CreateBucketIfNotExists(db.suffixedBucketName("-archive"))
+			if err != nil {
+				return err
+			}
+		}
+		for i, k := range keys {
+			if arch != nil {
+				if err := arch.Put(k, vals[i]); err != nil {
+					return err
+				}
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		for _, k := range idxKeys {
+			if err := idx.Delete(k); err != nil {
+				return err
+			}
+		}
+		tomb, err := tx.CreateBucketIfNotExists(db.suffixedBucketName("-tombstones"))
+		if err != nil {
+			return err
+		}
+		removed = len(keys)
+		for _, k := range keys {
+			removedIDs = append(removedIDs, SkipBlockID(k))
+		}
+		return tomb.Put(scID, []byte{1})
+	})
+	if err != nil {
+		return 0, err
+	}
+	db.cache.invalidate(removedIDs...)
+	db.latestMutex.Lock()
+	delete(db.latestBlocks, string(scID))
+	db.latestMutex.Unlock()
+	return removed, nil
+}
+
+// IsRemoved returns true if the skipchain with the given genesis ID has been
+// removed with RemoveChain.
+func (db *SkipBlockDB) IsRemoved(scID SkipBlockID) bool {
+	var removed bool
+	db.View(func(tx *bolt.Tx) error {
+		removed = db.isRemovedTx(tx, scID)
+		return nil
+	})
+	return removed
+}
+
+func (db *SkipBlockDB) isRemovedTx(tx *bolt.Tx, scID SkipBlockID) bool {
+	tomb := tx.Bucket(db.suffixedBucketName("-tombstones"))
+	return tomb != nil && tomb.Get(scID) != nil
+}
+
+// GetArchived returns a block of a skipchain that has been archived using
+// RemoveChain, or nil if it doesn't exist.
+func (db *SkipBlockDB) GetArchived(sbID SkipBlockID) *SkipBlock {
+	var result *SkipBlock
+	err := db.View(func(tx *bolt.Tx) error {
+		arch := tx.Bucket(db.suffixedBucketName("-archive"))
+		if arch == nil {
+			return nil
+		}
+		val := arch.Get(sbID)
+		if val == nil {
+			return nil
+		}
+		buf := make([]byte, len(val))
+		copy(buf, val)
+		_, sbMsg, err := network.Unmarshal(buf, cothority.Suite)
+		if err != nil {
+			return err
+		}
+		result = sbMsg.(*SkipBlock)
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	return result
+}
+
 // GetSkipchains returns all latest skipblocks from all skipchains.
 func (db *SkipBlockDB) GetSkipchains() (map[string]*SkipBlock, error) {
 	return db.getAll()
@@ -944,7 +1463,83 @@ func (db *SkipBlockDB) storeToTx(tx *bolt.Tx, sb *SkipBlock) error {
 	if err != nil {
 		return err
 	}
-	return tx.Bucket([]byte(db.bucketName)).Put(key, val)
+	if err := tx.Bucket([]byte(db.bucketName)).Put(key, val); err != nil {
+		return err
+	}
+	idx, err := tx.CreateBucketIfNotExists(db.indexBucketName())
+	if err != nil {
+		return err
+	}
+	return idx.Put(indexKey(sb.SkipChainID(), sb.Index), sb.Hash)
+}
+
+// BucketNames returns the names of all the buckets used by the database: the
+// blocks, their index, the archive and the tombstones.
+func (db *SkipBlockDB) BucketNames() [][]byte {
+	return [][]byte{db.bucketName, db.indexBucketName(),
+		db.suffixedBucketName("-archive"), db.suffixedBucketName("-tombstones")}
+}
+
+// LoadSequence returns the highest sequence of the signing rounds stored for
+// key, or 0. It implements the ftcosi SequenceStore. The sequences are not
+// part of BucketNames, so that restoring a backup doesn't roll them back.
+func (db *SkipBlockDB) LoadSequence(key string) (uint64, error) {
+	var seq uint64
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(db.suffixedBucketName("-sequences"))
+		if b == nil {
+			return nil
+		}
+		if val := b.Get([]byte(key)); len(val) == 8 {
+			seq = binary.BigEndian.Uint64(val)
+		}
+		return nil
+	})
+	return seq, err
+}
+
+// StoreSequence stores seq as the highest sequence of the signing rounds for
+// key. It implements the ftcosi SequenceStore.
+func (db *SkipBlockDB) StoreSequence(key string, seq uint64) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(db.suffixedBucketName("-sequences"))
+		if err != nil {
+			return err
+		}
+		val := make([]byte, 8)
+		binary.BigEndian.PutUint64(val, seq)
+		return b.Put([]byte(key), val)
+	})
+}
+
+// ClearCache forgets the blocks kept in memory. It must be called when the
+// buckets have been replaced, e.g. when a backup is restored.
+func (db *SkipBlockDB) ClearCache() {
+	db.latestMutex.Lock()
+	db.latestBlocks = map[string]SkipBlockID{}
+	db.latestMutex.Unlock()
+	db.cache.clear()
+}
+
+// indexBucketName returns the name of the bucket that maps the skipchain ID
+// and the index of a block to the ID of the block.
+func (db *SkipBlockDB) indexBucketName() []byte {
+	return db.suffixedBucketName("-index")
+}
+
+// suffixedBucketName returns the name of a bucket used next to the bucket
+// holding the blocks.
+func (db *SkipBlockDB) suffixedBucketName(suffix string) []byte {
+	return append(append([]byte{}, db.bucketName...), []byte(suffix)...)
+}
+
+// indexKey returns the key used in the index bucket. The index is stored
+// big-endian so that the blocks of a skipchain are sorted by index.
+func indexKey(scID SkipBlockID, index int) []byte {
+	key := make([]byte, len(scID)+4)
+	copy(key, scID)
+	binary.BigEndian.PutUint32(key[len(scID):], uint32(index))
+	return key
 }
 
 // getFromTx returns the skipblock identified by sbID.
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/migration"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -114,6 +117,40 @@ func TestSkipBlock_Hash2(t *testing.T) {
 	assert.NotEqual(t, h1, h2)
 }
 
+func TestForwardLink_VerifyRoster(t *testing.T) {
+	l := onet.NewLocalTest(cothority.Suite)
+	_, roster3, _ := l.GenTree(3, false)
+	defer l.CloseAll()
+	roster2 := onet.NewRoster(roster3.List[0:2])
+
+	sb1 := NewSkipBlock()
+	sb1.Roster = roster2
+	sb1.updateHash()
+	sb2 := NewSkipBlock()
+	sb2.Index = 1
+	sb2.Roster = roster2
+	sb2.updateHash()
+	sb3 := NewSkipBlock()
+	sb3.Index = 2
+	sb3.Roster = roster3
+	sb3.updateHash()
+
+	require.Nil(t, NewForwardLink(sb1, sb2).VerifyRoster(sb1, sb2))
+	require.NotNil(t, NewForwardLink(sb1, sb2).VerifyRoster(sb2, sb3))
+	fl := NewForwardLink(sb2, sb3)
+	require.NotNil(t, fl.NewRoster)
+	require.Nil(t, fl.VerifyRoster(sb2, sb3))
+
+	// A roster change needs to be in the forward-link.
+	fl.NewRoster = nil
+	require.NotNil(t, fl.VerifyRoster(sb2, sb3))
+	// And the new roster must not be replaced by other nodes.
+	fl.NewRoster = onet.NewRoster([]*network.ServerIdentity{roster3.List[1],
+		roster3.List[0], roster3.List[2]})
+	fl.NewRoster.ID = roster3.ID
+	require.NotNil(t, fl.VerifyRoster(sb2, sb3))
+}
+
 func TestBlockLink_Copy(t *testing.T) {
 	// Test if copy is deep or only shallow
 	b1 := &ForwardLink{}
@@ -198,6 +235,210 @@ func TestSkipBlock_GetFuzzy(t *testing.T) {
 	require.Equal(t, sb.Data[0], sb0.Data[0])
 }
 
+func TestSkipBlockDB_GetByIndex(t *testing.T) {
+	db, fname := setupSkipBlockDB(t)
+	defer db.Close()
+	defer os.Remove(fname)
+
+	blocks := make([]*SkipBlock, 4)
+	for i := range blocks {
+		sb := NewSkipBlock()
+		sb.Index = i
+		sb.Hash = []byte{byte(i + 1)}
+		if i > 0 {
+			sb.GenesisID = blocks[0].Hash
+			prev := blocks[i-1]
+			prev.ForwardLink = []*ForwardLink{{From: prev.Hash, To: sb.Hash}}
+		}
+		blocks[i] = sb
+	}
+	// Add a higher level link to check that it's used when following the
+	// chain.
+	blocks[0].ForwardLink = append(blocks[0].ForwardLink,
+		&ForwardLink{From: blocks[0].Hash, To: blocks[2].Hash})
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		for _, sb := range blocks {
+			if err := db.storeToTx(tx, sb); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	check := func() {
+		for _, sb := range blocks {
+			found, err := db.GetByIndex(blocks[0].Hash, sb.Index)
+			require.Nil(t, err)
+			require.Equal(t, sb.Hash, found.Hash)
+		}
+		_, err := db.GetByIndex(blocks[0].Hash, len(blocks))
+		require.NotNil(t, err)
+		_, err = db.GetByIndex(blocks[0].Hash, -1)
+		require.NotNil(t, err)
+		_, err = db.GetByIndex([]byte{0xff}, 0)
+		require.NotNil(t, err)
+	}
+	check()
+
+	// Remove the index, as if the blocks were stored by an older version.
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(db.indexBucketName())
+	}))
+	check()
+	require.Nil(t, db.View(func(tx *bolt.Tx) error {
+		require.NotNil(t, tx.Bucket(db.indexBucketName()))
+		return nil
+	}))
+	require.Equal(t, "1", db.GetStatus().Field["Chains"])
+	require.Equal(t, "4", db.GetStatus().Field["Blocks"])
+}
+
+func TestSkipBlockDB_Upgrade(t *testing.T) {
+	db, fname := setupSkipBlockDB(t)
+	defer db.Close()
+	defer os.Remove(fname)
+
+	blocks := make([]*SkipBlock, 3)
+	for i := range blocks {
+		sb := NewSkipBlock()
+		sb.Index = i
+		sb.Hash = []byte{byte(i + 1)}
+		if i > 0 {
+			sb.GenesisID = blocks[0].Hash
+		}
+		blocks[i] = sb
+	}
+	// Store the blocks without the index, as an older version did.
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		for _, sb := range blocks {
+			if err := db.storeToTx(tx, sb); err != nil {
+				return err
+			}
+		}
+		return tx.DeleteBucket(db.indexBucketName())
+	}))
+
+	require.Nil(t, db.Upgrade())
+	require.Nil(t, db.View(func(tx *bolt.Tx) error {
+		v, err := migration.Version(tx, db.bucketName)
+		require.Nil(t, err)
+		require.Equal(t, storeSchema.Current(), v)
+		idx := tx.Bucket(db.indexBucketName())
+		require.NotNil(t, idx)
+		for _, sb := range blocks {
+			require.Equal(t, sb.Hash, idx.Get(indexKey(blocks[0].Hash, sb.Index)))
+		}
+		return nil
+	}))
+	require.Equal(t, "1", db.GetStatus().Field["Chains"])
+
+	// An upgraded database is not changed.
+	require.Nil(t, db.Upgrade())
+}
+
+func TestSkipBlockDB_GetBlocks(t *testing.T) {
+	db, fname := setupSkipBlockDB(t)
+	defer db.Close()
+	defer os.Remove(fname)
+
+	sb0 := NewSkipBlock()
+	sb0.Hash = []byte{1}
+	sb1 := NewSkipBlock()
+	sb1.Hash = []byte{2}
+	_, err := db.StoreBlocks([]*SkipBlock{sb0, sb1})
+	require.Nil(t, err)
+
+	blocks, err := db.GetBlocks([]SkipBlockID{sb1.Hash, sb0.Hash, {3}})
+	require.Nil(t, err)
+	require.Equal(t, sb1.Hash, blocks[0].Hash)
+	require.Equal(t, sb0.Hash, blocks[1].Hash)
+	require.Nil(t, blocks[2])
+
+	// The cached block must be updated once it is stored again.
+	sb0.ChildSL = []SkipBlockID{sb1.Hash}
+	_, err = db.StoreBlocks([]*SkipBlock{sb0})
+	require.Nil(t, err)
+	blocks, err = db.GetBlocks([]SkipBlockID{sb0.Hash})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(blocks[0].ChildSL))
+	require.Equal(t, 1, len(db.GetByID(sb0.Hash).ChildSL))
+
+	_, err = db.RemoveChain(sb0.Hash, false)
+	require.Nil(t, err)
+	require.Nil(t, db.GetByID(sb0.Hash))
+	_, err = db.GetByIndex(sb0.Hash, 0)
+	require.NotNil(t, err)
+}
+
+func TestSkipBlockDB_Sequence(t *testing.T) {
+	db, fname := setupSkipBlockDB(t)
+	defer db.Close()
+	defer os.Remove(fname)
+
+	seq, err := db.LoadSequence("a")
+	require.Nil(t, err)
+	require.Equal(t, uint64(0), seq)
+	require.Nil(t, db.StoreSequence("a", 12))
+	require.Nil(t, db.StoreSequence("b", 3))
+	seq, err = db.LoadSequence("a")
+	require.Nil(t, err)
+	require.Equal(t, uint64(12), seq)
+}
+
+func TestSkipBlockDB_StoreBlocksConcurrent(t *testing.T) {
+	db, fname := setupSkipBlockDB(t)
+	defer db.Close()
+	defer os.Remove(fname)
+
+	parent := NewSkipBlock()
+	parent.Hash = parent.CalculateHash()
+	_, err := db.StoreBlocks([]*SkipBlock{parent})
+	require.Nil(t, err)
+
+	// Every goroutine stores a new chain of two blocks and adds it as a child
+	// of the same parent.
+	n := 10
+	gens := make([]*SkipBlock, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		gen := NewSkipBlock()
+		gen.Data = []byte{byte(i)}
+		gen.ParentBlockID = parent.Hash
+		gen.Hash = gen.CalculateHash()
+		gens[i] = gen
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			gen := gens[i].Copy()
+			sb1 := NewSkipBlock()
+			sb1.Index = 1
+			sb1.GenesisID = gen.Hash
+			sb1.BackLinkIDs = []SkipBlockID{gen.Hash}
+			sb1.Hash = sb1.CalculateHash()
+			gen.ForwardLink = []*ForwardLink{{From: gen.Hash, To: sb1.Hash}}
+			p := parent.Copy()
+			p.ChildSL = []SkipBlockID{gen.Hash}
+			_, errs[i] = db.StoreBlocks([]*SkipBlock{p, gen, sb1})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, gen := range gens {
+		require.Nil(t, errs[i])
+		latest, err := db.GetLatestByID(gen.Hash)
+		require.Nil(t, err)
+		require.Equal(t, 1, latest.Index)
+		require.True(t, latest.GenesisID.Equal(gen.Hash))
+	}
+	// No child may be lost.
+	children := db.GetByID(parent.Hash).ChildSL
+	require.Equal(t, n, len(children))
+	for _, gen := range gens {
+		require.True(t, containsID(children, gen.Hash))
+	}
+}
+
 func TestSkipBlock_Payload(t *testing.T) {
 	sb := NewSkipBlock()
 	h := sb.CalculateHash()
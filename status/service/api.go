@@ -1,6 +1,10 @@
 package status
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/dedis/cothority"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/network"
@@ -25,3 +29,23 @@ func (c *Client) Request(dst *network.ServerIdentity) (*Response, error) {
 	}
 	return resp, nil
 }
+
+// GetStatus requests the status of every node of the roster, e.g., for a
+// monitoring dashboard. The responses are in the order of the roster. A node
+// that doesn't answer has a nil response, and the error lists all of them.
+func (c *Client) GetStatus(r *onet.Roster) ([]*Response, error) {
+	resps := make([]*Response, len(r.List))
+	var errs []string
+	for i, si := range r.List {
+		resp, err := c.Request(si)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", si.Address, err))
+			continue
+		}
+		resps[i] = resp
+	}
+	if len(errs) > 0 {
+		return resps, errors.New("couldn't get the status of " + strings.Join(errs, ", "))
+	}
+	return resps, nil
+}
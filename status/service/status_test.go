@@ -7,6 +7,7 @@ import (
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var tSuite = suites.MustFind("Ed25519")
@@ -35,3 +36,17 @@ func TestServiceStatus(t *testing.T) {
 	log.Lvl1(stat)
 	assert.NotEmpty(t, stat.Status["Generic"].Field["Available_Services"])
 }
+
+func TestClient_GetStatus(t *testing.T) {
+	local := onet.NewTCPTest(tSuite)
+	_, el, _ := local.GenTree(3, false)
+	defer local.CloseAll()
+
+	client := NewTestClient(local)
+	stats, err := client.GetStatus(el)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(stats))
+	for i, stat := range stats {
+		require.True(t, stat.ServerIdentity.Equal(el.List[i]))
+	}
+}